@@ -0,0 +1,182 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// topicAliasRecordSize is size of the fixed fields of the topic alias record preceding the topics.
+const topicAliasRecordSize = 4 + 2
+
+type (
+	// _TopicAliases is an append only log of the topic aliases set using AliasTopic. Aliases
+	// are links between the nodes of the trie, they are added to the trie from the log on open.
+	_TopicAliases struct {
+		mu   sync.Mutex
+		path string
+		file *os.File
+	}
+
+	_TopicAlias struct {
+		contract uint32
+		topic    []byte
+		alias    []byte
+	}
+)
+
+func newTopicAliases(dirName string) (*_TopicAliases, error) {
+	a := &_TopicAliases{path: path.Join(dirName, fmt.Sprintf("%s.aliases", prefix))}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	a.file = f
+	return a, nil
+}
+
+// read reads the topic aliases from the log. A partially written record at the end of the log is ignored.
+func (a *_TopicAliases) read() ([]_TopicAlias, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	data, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return nil, err
+	}
+	var aliases []_TopicAlias
+	for len(data) >= 2 {
+		size := int(binary.LittleEndian.Uint16(data[0:2]))
+		if size < topicAliasRecordSize {
+			return nil, errCorrupted
+		}
+		if len(data) < 2+size {
+			break
+		}
+		rec := data[2 : 2+size]
+		data = data[2+size:]
+		topicSize := int(binary.LittleEndian.Uint16(rec[4:6]))
+		if topicAliasRecordSize+topicSize > size {
+			return nil, errCorrupted
+		}
+		aliases = append(aliases, _TopicAlias{
+			contract: binary.LittleEndian.Uint32(rec[0:4]),
+			topic:    rec[topicAliasRecordSize : topicAliasRecordSize+topicSize],
+			alias:    rec[topicAliasRecordSize+topicSize:],
+		})
+	}
+	return aliases, nil
+}
+
+// add appends the topic alias to the log and syncs the log, so the alias is not lost on a crash.
+func (a *_TopicAliases) add(alias _TopicAlias) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	size := topicAliasRecordSize + len(alias.topic) + len(alias.alias)
+	rec := make([]byte, 2+size)
+	binary.LittleEndian.PutUint16(rec[0:2], uint16(size))
+	binary.LittleEndian.PutUint32(rec[2:6], alias.contract)
+	binary.LittleEndian.PutUint16(rec[6:8], uint16(len(alias.topic)))
+	copy(rec[8:], alias.topic)
+	copy(rec[8+len(alias.topic):], alias.alias)
+	if _, err := a.file.Write(rec); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *_TopicAliases) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// AliasTopic maps the new topic to the existing old topic, so queries under either topic return the entries of
+// both topics. It is used to keep the history of a topic accessible when the topic is renamed, the entries put to
+// the old topic before the rename are returned by queries under the new topic and the entries put to the new topic
+// after the rename are returned by queries under the old topic. The alias is persisted and restored on DB open.
+// Wildcard topics cannot be aliased, and the old topic must exist in the DB.
+func (db *DB) AliasTopic(oldTopic, newTopic []byte) error {
+	switch {
+	case db.opts.flags.immutable:
+		return errImmutable
+	case db.opts.replicaOf != "":
+		return errReplica
+	case len(oldTopic) == 0 || len(newTopic) == 0:
+		return errTopicEmpty
+	case len(oldTopic) > maxTopicLength || len(newTopic) > maxTopicLength:
+		return errTopicTooLarge
+	}
+	if err := db.ok(); err != nil {
+		return err
+	}
+	if err := db.authorize(message.MasterContract, oldTopic, OpGet); err != nil {
+		return err
+	}
+	if err := db.authorize(message.MasterContract, newTopic, OpPut); err != nil {
+		return err
+	}
+	if err := db.aliasTopic(message.MasterContract, oldTopic, newTopic); err != nil {
+		return err
+	}
+	return db.internal.aliases.add(_TopicAlias{contract: message.MasterContract, topic: oldTopic, alias: newTopic})
+}
+
+// aliasTopic links the node of the alias in the trie to the node of the topic.
+func (db *DB) aliasTopic(contract uint32, topic, alias []byte) error {
+	t, _, err := db.parseTopic(contract, topic)
+	if err != nil {
+		return err
+	}
+	a, _, err := db.parseTopic(contract, alias)
+	if err != nil {
+		return err
+	}
+	if t.TopicType == message.TopicWildcard || a.TopicType == message.TopicWildcard {
+		return errBadRequest
+	}
+	t.AddContract(contract)
+	a.AddContract(contract)
+	if ok := db.internal.trie.alias(t.GetHash(contract), a.Parts, a.Depth); !ok {
+		return errTopicNotFound
+	}
+	names, _ := db.opts.topicSeparator.SplitTopic(alias)
+	db.internal.trie.setNames(a.Parts, names)
+	db.internal.queryCache.invalidateAll()
+	return nil
+}
+
+// loadTopicAliases adds the topic aliases from the log to the trie. Aliases of the topics
+// that are no longer in the trie are skipped.
+func (db *DB) loadTopicAliases() error {
+	aliases, err := db.internal.aliases.read()
+	if err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		if err := db.aliasTopic(a.contract, a.topic, a.alias); err != nil && err != errTopicNotFound {
+			logger.Error().Err(err).Str("context", "db.aliasTopic")
+		}
+	}
+	return nil
+}
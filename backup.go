@@ -0,0 +1,193 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unit-io/unitdb/memdb"
+)
+
+// backupEntries is the name of the archive member holding entries of the mem store not yet synced to the DB files.
+const backupEntries = "memdb.entries"
+
+// Backup writes a consistent snapshot of the DB to the writer as a tar archive. Entries are synced
+// to the DB files and the DB files are archived while syncs wait, the entries put meanwhile and the
+// entries not yet committed to the write ahead log are archived from the mem store. Puts and Gets
+// are not blocked while Backup runs. Use Restore to restore the archive.
+func (db *DB) Backup(w io.Writer) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+	if err := db.syncLocked(); err != nil {
+		return err
+	}
+	// sync writes header and fsyncs files even if there are no pending entries.
+	if err := db.sync(); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	dir := db.internal.path
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir() && name == memdb.LogDir:
+			// write ahead log is archived from the mem store.
+			return filepath.SkipDir
+		case info.IsDir(), !info.Mode().IsRegular():
+			return nil
+		case strings.HasSuffix(name, lockPostfix), strings.HasSuffix(name, ".tmp"):
+			return nil
+		}
+		return backupFile(tw, filepath.ToSlash(name), path, info.Size())
+	})
+	if err != nil {
+		return err
+	}
+
+	var entries []byte
+	for _, seq := range db.internal.mem.Keys() {
+		if seq&deleteRecordFlag != 0 {
+			continue
+		}
+		data, err := db.internal.mem.Get(seq)
+		if err != nil || data == nil {
+			continue
+		}
+		var scratch [12]byte
+		binary.LittleEndian.PutUint64(scratch[0:8], seq)
+		binary.LittleEndian.PutUint32(scratch[8:12], uint32(len(data)))
+		entries = append(entries, scratch[:]...)
+		entries = append(entries, data...)
+	}
+	hdr := &tar.Header{Name: backupEntries, Mode: 0666, Size: int64(len(entries)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(entries); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// backupFile archives size bytes of the file, the file may grow while it is archived.
+func backupFile(tw *tar.Writer, name, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hdr := &tar.Header{Name: name, Mode: 0666, Size: size, ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, size)
+	return err
+}
+
+// Restore restores the DB archived by Backup to the path. The path must not exist or be an empty
+// directory. Entries of the mem store archived with the DB files are written to the write ahead log
+// of the restored DB, so they are recovered on open of the restored DB.
+func Restore(path string, r io.Reader) error {
+	if fis, err := ioutil.ReadDir(path); err == nil && len(fis) > 0 {
+		return errPathNotEmpty
+	}
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	var entries []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return errBadRequest
+		}
+		if hdr.Name == backupEntries {
+			if entries, err = ioutil.ReadAll(tr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := restoreFile(tr, filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	mem, err := memdb.Open(memdb.WithLogFilePath(path))
+	if err != nil {
+		return err
+	}
+	for len(entries) >= 12 {
+		seq := binary.LittleEndian.Uint64(entries[0:8])
+		size := int(binary.LittleEndian.Uint32(entries[8:12]))
+		if len(entries) < 12+size {
+			mem.Close()
+			return errCorrupted
+		}
+		if _, err := mem.Put(seq, entries[12:12+size]); err != nil {
+			mem.Close()
+			return err
+		}
+		entries = entries[12+size:]
+	}
+	return mem.Close()
+}
+
+func restoreFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -25,6 +25,11 @@ import (
 	"github.com/unit-io/unitdb/message"
 )
 
+// deleteRecordFlag is set on the key of a delete record put to the memdb by the batch. The delete records
+// are written to the WAL with the entries of the batch and the deletes are replayed on sync or recovery
+// if these are not applied on commit of the batch.
+const deleteRecordFlag = 1 << 63
+
 // SetOptions sets batch options.
 func (b *Batch) SetOptions(opts ...Options) {
 	for _, opt := range opts {
@@ -51,6 +56,18 @@ type (
 		index  []_BatchIndex
 		buffer *bpool.Buffer
 		size   int64
+		// count is the number of entries written to the mem batch.
+		count int64
+
+		// topics holds topics of the entries to match wildcard topics of the watchers
+		// and to name the parts of the topics added to the trie.
+		topics map[uint64][]byte
+		// written holds the topics of the entries written to the mem batch to invalidate the cached
+		// query results on commit, the value is set if the topic is added to the trie.
+		written map[uint64]bool
+		// deletes holds the entries deleted by the batch, deletes are applied once the batch is committed.
+		// The delete records of the entries are put to the memdb with the entries of the batch.
+		deletes []_Entry
 
 		// commitComplete is used to signal if batch commit is complete and batch is fully written to DB.
 		commitComplete chan struct{}
@@ -79,10 +96,28 @@ func (b *Batch) PutEntry(e *Entry) error {
 	case len(e.Payload) > maxValueLength:
 		return errValueTooLarge
 	}
+	if err := b.db.authorize(e.Contract, e.Topic, OpPut); err != nil {
+		return err
+	}
+	// entry is dropped if it is a duplicate within the dedup window of the topic.
+	if ok, err := b.db.applyTopic(e); !ok || err != nil {
+		return err
+	}
 	e.Encryption = e.Encryption || b.opts.batchOptions.encryption
 	if err := b.db.setEntry(e); err != nil {
 		return err
 	}
+	if err := b.db.checkQuota(e.Contract, int64(len(e.entry.cache)-entrySize)); err != nil {
+		return err
+	}
+	if b.db.internal.watchers.hasWildcards() || e.entry.topicSize != 0 {
+		if b.topics == nil {
+			b.topics = make(map[uint64][]byte)
+		}
+		if _, ok := b.topics[e.entry.topicHash]; !ok {
+			b.topics[e.entry.topicHash] = append([]byte(nil), e.Topic...)
+		}
+	}
 
 	var scratch [4]byte
 	binary.LittleEndian.PutUint32(scratch[0:4], uint32(len(e.entry.cache)+4))
@@ -95,6 +130,7 @@ func (b *Batch) PutEntry(e *Entry) error {
 
 	b.index = append(b.index, _BatchIndex{delFlag: false, offset: b.size})
 	b.size += int64(len(e.entry.cache) + 4)
+	b.db.internal.recorder.add(recordPut, e.Contract, e.Topic, len(e.Payload))
 
 	// reset message entry
 	e.reset()
@@ -123,6 +159,9 @@ func (b *Batch) DeleteEntry(e *Entry) error {
 	case len(e.Topic) > maxTopicLength:
 		return errTopicTooLarge
 	}
+	if err := b.db.authorize(e.Contract, e.Topic, OpDelete); err != nil {
+		return err
+	}
 
 	if err := b.db.setEntry(e); err != nil {
 		return err
@@ -167,12 +206,14 @@ func (b *Batch) writeInternal(fn func(i int, e _Entry, data []byte) error) error
 		if err := e.UnmarshalBinary(entryData); err != nil {
 			return err
 		}
-		if index.delFlag && e.seq != 0 {
-			/// Test filter block for presence.
-			if !b.db.internal.filter.Test(e.seq) {
-				return nil
+		if index.delFlag {
+			if e.seq != 0 {
+				// put delete record into memdb, so the delete is written to the WAL under the time ID of the batch.
+				if err := b.mem.Put(e.seq|deleteRecordFlag, entryData); err != nil {
+					return err
+				}
+				b.deletes = append(b.deletes, e)
 			}
-			b.db.delete(e.topicHash, e.seq)
 			continue
 		}
 
@@ -204,7 +245,11 @@ func (b *Batch) Write() error {
 	topics := make(map[uint64]*message.Topic)
 	timeID := b.mem.TimeID()
 	var seqs []uint64
-	b.writeInternal(func(i int, e _Entry, data []byte) error {
+	if b.written == nil {
+		b.written = make(map[uint64]bool)
+	}
+	err := b.writeInternal(func(i int, e _Entry, data []byte) error {
+		added := false
 		if e.topicSize != 0 {
 			t, ok := topics[e.topicHash]
 			if !ok {
@@ -213,7 +258,9 @@ func (b *Batch) Write() error {
 				t.Unmarshal(rawTopic)
 				topics[e.topicHash] = t
 			}
-			b.db.internal.trie.add(newTopic(e.topicHash, 0), t.Parts, t.Depth)
+			if added = b.db.internal.trie.add(newTopic(e.topicHash, 0), t.Parts, t.Depth); added {
+				b.db.addTopicName(b.topics[e.topicHash], t.Parts)
+			}
 		}
 		if err := b.mem.Put(e.seq, data); err != nil {
 			return err
@@ -221,9 +268,17 @@ func (b *Batch) Write() error {
 		if ok := b.db.internal.timeWindow.add(timeID, e.topicHash, newWinEntry(e.seq, e.expiresAt)); !ok {
 			return errForbidden
 		}
+		b.written[e.topicHash] = b.written[e.topicHash] || added
 		seqs = append(seqs, e.seq)
+		b.count++
+		b.db.notify(e, data, b.topics[e.topicHash], nil)
 		return nil
 	})
+	if err != nil {
+		// entries of the time ID are released on abort of the batch.
+		b.db.internal.timeWindow.abort(timeID)
+		return err
+	}
 
 	b.mem.Write()
 	b.reset()
@@ -252,21 +307,48 @@ func (b *Batch) Commit() error {
 	if err := b.mem.Commit(); err != nil {
 		return err
 	}
+	b.db.internal.inFlight.add(b.count, b.db.internal.meter.Unsynced)
+	for topicHash, added := range b.written {
+		b.db.internal.queryCache.invalidate(topicHash, added)
+	}
+
+	// Apply deletes once the entries of the batch are committed. The delete records are removed from the memdb
+	// once the deletes are applied, a delete not applied is replayed from its record on sync of the batch.
+	for _, e := range b.deletes {
+		if err := b.db.applyDelete(e); err != nil {
+			logger.Error().Err(err).Str("context", "batch.Commit").Uint64("seq", e.seq).Msg("delete is replayed on sync")
+			continue
+		}
+		b.db.internal.mem.Delete(e.seq | deleteRecordFlag)
+	}
 
 	return nil
 }
 
+// applyDelete deletes the entry of a delete record of a batch. Deleting an entry already deleted is a no-op,
+// so a delete record is replayed on sync or recovery of the WAL if the delete is not applied on commit.
+func (db *DB) applyDelete(e _Entry) error {
+	if db.opts.chunkSize > 0 {
+		if err := db.deleteChunks(e.seq); err != nil {
+			return err
+		}
+	}
+	return db.delete(e.topicHash, e.seq)
+}
+
 func (b *Batch) reset() {
 	b.index = b.index[:0]
 	b.size = 0
 	b.buffer.Reset()
+	b.topics = nil
 }
 
-//Abort abort is a batch cleanup operation on batch complete.
+// Abort abort is a batch cleanup operation on batch complete.
 func (b *Batch) Abort() {
 	_assert(!b.managed, "managed batch abort not allowed")
 
 	b.reset()
+	b.deletes = nil
 	b.mem.Abort()
 	b.db.internal.bufPool.Put(b.buffer)
 	b.db = nil
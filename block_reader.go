@@ -17,7 +17,6 @@
 package unitdb
 
 type _BlockReader struct {
-	indexBlock          _IndexBlock
 	fs                  *_FileSet
 	indexFile, dataFile *_File
 	offset              int64
@@ -42,21 +41,39 @@ func newBlockReader(fs *_FileSet) *_BlockReader {
 }
 
 func (r *_BlockReader) readIndexBlock() (_IndexBlock, error) {
-	buf, err := r.indexFile.slice(r.offset, r.offset+int64(blockSize))
+	return r.readIndexBlockAt(r.offset)
+}
+
+// readIndexBlockAt reads the index block at the offset. It does not change the state of the reader,
+// so the reader shared by the DB is safe to use by concurrent readers.
+func (r *_BlockReader) readIndexBlockAt(off int64) (_IndexBlock, error) {
+	buf, err := r.indexFile.slice(off, off+int64(blockSize))
 	if err != nil {
 		return _IndexBlock{}, err
 	}
-	if err := r.indexBlock.unmarshalBinary(buf); err != nil {
+	var b _IndexBlock
+	if err := b.unmarshalBinary(buf); err != nil {
 		return _IndexBlock{}, err
 	}
 
-	return r.indexBlock, nil
+	return b, nil
 }
 
 func (r *_BlockReader) readEntry(seq uint64) (_IndexEntry, error) {
-	bIdx := blockIndex(seq)
-	r.offset = blockOffset(bIdx)
-	b, err := r.readIndexBlock()
+	e, err := r.readIndexEntry(seq)
+	if err != nil {
+		return e, err
+	}
+	if e.valueSize == 0 {
+		return _IndexEntry{}, errMsgIDDeleted
+	}
+	return e, nil
+}
+
+// readIndexEntry reads the index entry including the deleted entry packing the topic,
+// the topic is kept on delete to load the topic on open.
+func (r *_BlockReader) readIndexEntry(seq uint64) (_IndexEntry, error) {
+	b, err := r.readIndexBlockAt(blockOffset(blockIndex(seq)))
 	if err != nil {
 		return _IndexEntry{}, err
 	}
@@ -89,6 +106,13 @@ func (r *_BlockReader) readMessage(e _IndexEntry) ([]byte, []byte, error) {
 	return message[:idSize], message[e.topicSize+idSize:], nil
 }
 
+func (r *_BlockReader) readMessageID(e _IndexEntry) ([]byte, error) {
+	if e.cache != nil {
+		return e.cache[:idSize], nil
+	}
+	return r.dataFile.slice(e.msgOffset, e.msgOffset+int64(idSize))
+}
+
 func (r *_BlockReader) readTopic(e _IndexEntry) ([]byte, error) {
 	if e.cache != nil {
 		return e.cache[idSize : e.topicSize+idSize], nil
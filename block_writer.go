@@ -31,15 +31,15 @@ type _BlockWriter struct {
 	lease  *_Lease
 	buffer *bpool.Buffer
 
-	indexLeases                     map[uint64]struct{} //map[seq]struct
-	dataLeases                      map[int64]uint32    // map[offset]size
+	rollbackBlocks                  map[int32]_IndexBlock // map[blockIdx]block as persisted before the sync
+	dataLeases                      map[int64]uint32      // map[offset]size
 	indexFile, dataFile             *_File
 	offset, indexOffset, dataOffset int64
 }
 
 func newBlockWriter(fs *_FileSet, lease *_Lease, buf *bpool.Buffer) (*_BlockWriter, error) {
 	w := &_BlockWriter{blockIdx: -1, indexBlocks: make(map[int32]_IndexBlock), fs: fs, lease: lease, buffer: buf}
-	w.indexLeases = make(map[uint64]struct{})
+	w.rollbackBlocks = make(map[int32]_IndexBlock)
 	w.dataLeases = make(map[int64]uint32)
 
 	indexFile, err := fs.getFile(_FileDesc{fileType: typeIndex})
@@ -82,7 +82,7 @@ func (w *_BlockWriter) extend(upperSeq uint64) (int64, error) {
 func (w *_BlockWriter) del(seq uint64) (_IndexEntry, error) {
 	var delEntry _IndexEntry
 	bIdx := blockIndex(seq)
-	if bIdx > w.blockIdx {
+	if bIdx > w.blockIdx || blockOffset(bIdx) >= w.indexOffset {
 		return delEntry, nil // no entry in db to delete
 	}
 	r := _BlockReader{indexFile: w.indexFile, offset: blockOffset(bIdx)}
@@ -98,18 +98,36 @@ func (w *_BlockWriter) del(seq uint64) (_IndexEntry, error) {
 			break
 		}
 	}
-	if entryIdx == -1 {
+	if entryIdx == -1 || b.entries[entryIdx].msgOffset == -1 || b.entries[entryIdx].valueSize == 0 {
 		return delEntry, nil // no entry in db to delete
 	}
 	delEntry = b.entries[entryIdx]
-	delEntry.msgOffset = -1
-	b.entries[entryIdx] = delEntry
+	if delEntry.topicSize != 0 {
+		// keep the topic of the deleted entry to load the topic on open.
+		b.entries[entryIdx].valueSize = 0
+	} else {
+		b.entries[entryIdx].msgOffset = -1
+	}
 	b.dirty = true
 	w.indexBlocks[bIdx] = b
 
 	return delEntry, nil
 }
 
+// writeIndexBlock writes the index block if it is dirty, it is used to persist deletes outside sync.
+func (w *_BlockWriter) writeIndexBlock(bIdx int32) error {
+	b, ok := w.indexBlocks[bIdx]
+	if !ok || !b.dirty {
+		return nil
+	}
+	if _, err := w.indexFile.WriteAt(b.marshalBinary(), blockOffset(bIdx)); err != nil {
+		return err
+	}
+	b.dirty = false
+	w.indexBlocks[bIdx] = b
+	return nil
+}
+
 func (w *_BlockWriter) append(e _IndexEntry) (err error) {
 	var b _IndexBlock
 	var ok bool
@@ -143,6 +161,11 @@ func (w *_BlockWriter) append(e _IndexEntry) (err error) {
 		return errEntryInvalid
 	}
 
+	if _, ok := w.rollbackBlocks[bIdx]; !ok && bIdx < w.blockIdx {
+		// keep the persisted block to restore it if the sync is aborted.
+		w.rollbackBlocks[bIdx] = b
+	}
+
 	dataLen := len(e.cache)
 	off := w.lease.allocate(uint32(dataLen))
 	if off != -1 {
@@ -165,10 +188,6 @@ func (w *_BlockWriter) append(e _IndexEntry) (err error) {
 	}
 	e.msgOffset = off
 
-	if b.leased {
-		w.indexLeases[e.seq] = struct{}{}
-	}
-
 	b.entries[b.entryIdx] = e
 	b.dirty = true
 	b.entryIdx++
@@ -288,23 +307,38 @@ func blockRange(idx []int32) ([][]int32, error) {
 	return parts, nil
 }
 
+// rollback frees the data leases and restores the index blocks persisted before the sync. Blocks
+// written by the sync are restored on the disk and synced before rollback returns, so entries of an
+// aborted sync are not left in the leased blocks.
 func (w *_BlockWriter) rollback() error {
 	// rollback data leases
 	for off, size := range w.dataLeases {
 		w.lease.freeBlock(off, size)
 	}
 
-	// roll back index leases
-	for seq := range w.indexLeases {
-		if _, err := w.del(seq); err != nil {
+	// blocks after the index offset are truncated.
+	for bIdx := range w.indexBlocks {
+		if bIdx >= w.blockIdx {
+			delete(w.indexBlocks, bIdx)
+		}
+	}
+	if len(w.rollbackBlocks) == 0 {
+		return nil
+	}
+	for bIdx, b := range w.rollbackBlocks {
+		if _, err := w.indexFile.WriteAt(b.marshalBinary(), blockOffset(bIdx)); err != nil {
 			return err
 		}
+		b.dirty = false
+		w.indexBlocks[bIdx] = b
 	}
-	return nil
+	return w.indexFile.Sync()
 }
 
 func (w *_BlockWriter) reset() error {
 	w.buffer.Reset()
+	w.rollbackBlocks = make(map[int32]_IndexBlock)
+	w.dataLeases = make(map[int64]uint32)
 
 	w.indexOffset = w.indexFile.currSize()
 	w.blockIdx = int32(w.indexOffset / int64(blockSize))
@@ -0,0 +1,379 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// TopicConfig holds the settings of a declared topic. Settings are applied to the entries put to
+// the topic, zero value of a setting leaves it unset.
+type TopicConfig struct {
+	// Retention sets duration the entries put to the topic expire after unless the entry sets its ttl.
+	Retention time.Duration
+	// MaxEntries sets maximum number of entries kept for the topic. The oldest entries exceeding
+	// MaxEntries are deleted by the key expirer, the DB must be mutable to delete entries.
+	MaxEntries int
+	// Compression sets codec to compress payloads of the entries unless the entry sets its codec.
+	Compression Codec
+	// Encryption sets encryption of payloads of the entries.
+	Encryption bool
+	// DedupWindow sets duration to drop the entries with the payload of an entry put to the topic within the duration.
+	DedupWindow time.Duration
+}
+
+// _TopicOptions is used to set options to create a topic.
+type _TopicOptions struct {
+	contract uint32
+	config   TopicConfig
+}
+
+const (
+	// catalogRecordSize is size of the fixed fields of the catalog record preceding the topic.
+	catalogRecordSize = 15
+	// minDedupPrune is minimum number of payload hashes kept before dedup hashes are pruned.
+	minDedupPrune = 1024
+)
+
+type (
+	_CatalogKey struct {
+		contract uint32
+		topic    string
+	}
+
+	// _Catalog holds the topics declared using CreateTopic and their settings. A declared topic
+	// can be a wildcard topic to declare all topics under a prefix. The catalog is persisted to
+	// the topics file on each change as topics are declared rarely.
+	_Catalog struct {
+		mu       sync.RWMutex
+		path     string
+		required bool
+		topics   map[_CatalogKey]TopicConfig
+		// wildcards holds parts of the declared wildcard topics to match topics on writes.
+		wildcards map[_CatalogKey][][]byte
+
+		// dedup holds expiry time of payload hashes of the entries put to the topics with dedup window.
+		dedup     map[uint64]int64
+		nextPrune int
+		// trims holds max entries of the topics written since the last trim.
+		trims map[_CatalogKey]int
+
+		// separator is the topic separator the declared topics are split and joined with.
+		separator message.Separator
+	}
+)
+
+func newCatalog(dirName string, required bool, separator message.Separator) (*_Catalog, error) {
+	c := &_Catalog{
+		path:      path.Join(dirName, fmt.Sprintf("%s.topics", prefix)),
+		required:  required,
+		topics:    make(map[_CatalogKey]TopicConfig),
+		wildcards: make(map[_CatalogKey][][]byte),
+		dedup:     make(map[uint64]int64),
+		nextPrune: minDedupPrune,
+		trims:     make(map[_CatalogKey]int),
+		separator: separator,
+	}
+	data, err := ioutil.ReadFile(c.path)
+	switch {
+	case os.IsNotExist(err):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+	// Each record is prefixed with its size, so fields added to the record later are read as zero from older records.
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errCorrupted
+		}
+		size := int(binary.LittleEndian.Uint16(data[0:2]))
+		if size < catalogRecordSize || len(data) < 2+size {
+			return nil, errCorrupted
+		}
+		rec := data[2 : 2+size]
+		data = data[2+size:]
+		topicSize := int(binary.LittleEndian.Uint16(rec[13:15]))
+		if len(rec) < catalogRecordSize+topicSize {
+			return nil, errCorrupted
+		}
+		contract := binary.LittleEndian.Uint32(rec[0:4])
+		cfg := TopicConfig{
+			Retention:   time.Duration(binary.LittleEndian.Uint64(rec[4:12])),
+			Compression: Codec(rec[12]),
+		}
+		topic := rec[catalogRecordSize : catalogRecordSize+topicSize]
+		if ext := rec[catalogRecordSize+topicSize:]; len(ext) >= 17 {
+			cfg.MaxEntries = int(binary.LittleEndian.Uint64(ext[0:8]))
+			cfg.Encryption = ext[8] == 1
+			cfg.DedupWindow = time.Duration(binary.LittleEndian.Uint64(ext[9:17]))
+		}
+		c.add(contract, topic, cfg)
+	}
+	return c, nil
+}
+
+func (c *_Catalog) add(contract uint32, topic []byte, cfg TopicConfig) {
+	parts, _ := c.separator.SplitTopic(topic)
+	key := _CatalogKey{contract: contract, topic: string(c.separator.JoinParts(parts, nil))}
+	c.topics[key] = cfg
+	if isWildcard(parts) {
+		c.wildcards[key] = parts
+	}
+}
+
+// declare adds the topic to the catalog or updates the settings of the declared topic.
+func (c *_Catalog) declare(contract uint32, topic []byte, cfg TopicConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(contract, topic, cfg)
+	return c.write()
+}
+
+// match returns settings of the declared topic matching the topic parts. The topic declared
+// without wildcards takes precedence over the wildcard topics matching the topic.
+func (c *_Catalog) match(contract uint32, parts [][]byte) (TopicConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cfg, ok := c.topics[_CatalogKey{contract: contract, topic: string(c.separator.JoinParts(parts, nil))}]; ok {
+		return cfg, true
+	}
+	for key, pattern := range c.wildcards {
+		if key.contract == contract && matchTopic(pattern, parts) {
+			return c.topics[key], true
+		}
+	}
+	return TopicConfig{}, false
+}
+
+// duplicate returns true if the payload is put to the topic within the dedup window, otherwise it
+// records the payload hash. Expired payload hashes are pruned once number of hashes is doubled.
+func (c *_Catalog) duplicate(key _CatalogKey, payload []byte, window time.Duration) bool {
+	h := fnv.New64a()
+	var scratch [4]byte
+	binary.LittleEndian.PutUint32(scratch[:], key.contract)
+	h.Write(scratch[:])
+	io.WriteString(h, key.topic)
+	h.Write([]byte{0})
+	h.Write(payload)
+	sum := h.Sum64()
+
+	now := time.Now().UnixNano()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if expiresAt, ok := c.dedup[sum]; ok && expiresAt > now {
+		return true
+	}
+	c.dedup[sum] = now + int64(window)
+	if len(c.dedup) >= c.nextPrune {
+		for sum, expiresAt := range c.dedup {
+			if expiresAt <= now {
+				delete(c.dedup, sum)
+			}
+		}
+		if c.nextPrune = 2 * len(c.dedup); c.nextPrune < minDedupPrune {
+			c.nextPrune = minDedupPrune
+		}
+	}
+	return false
+}
+
+// markTrim marks the topic to trim its entries exceeding the max entries.
+func (c *_Catalog) markTrim(key _CatalogKey, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trims[key] = maxEntries
+}
+
+// takeTrims returns the topics marked to trim and clears the marks.
+func (c *_Catalog) takeTrims() map[_CatalogKey]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	trims := c.trims
+	c.trims = make(map[_CatalogKey]int)
+	return trims
+}
+
+func (c *_Catalog) empty() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.topics) == 0
+}
+
+// write writes the catalog to the topics file, the caller must hold the catalog lock.
+func (c *_Catalog) write() error {
+	var buf []byte
+	for key, cfg := range c.topics {
+		size := catalogRecordSize + len(key.topic) + 17
+		rec := make([]byte, 2+size)
+		binary.LittleEndian.PutUint16(rec[0:2], uint16(size))
+		binary.LittleEndian.PutUint32(rec[2:6], key.contract)
+		binary.LittleEndian.PutUint64(rec[6:14], uint64(cfg.Retention))
+		rec[14] = byte(cfg.Compression)
+		binary.LittleEndian.PutUint16(rec[15:17], uint16(len(key.topic)))
+		copy(rec[17:], key.topic)
+		ext := rec[2+catalogRecordSize+len(key.topic):]
+		binary.LittleEndian.PutUint64(ext[0:8], uint64(cfg.MaxEntries))
+		if cfg.Encryption {
+			ext[8] = 1
+		}
+		binary.LittleEndian.PutUint64(ext[9:17], uint64(cfg.DedupWindow))
+		buf = append(buf, rec...)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// CreateTopic declares the topic. If DB is opened using WithDeclaredTopics option, writes to the
+// topics not declared are rejected. A wildcard topic declares all topics matching the wildcard topic,
+// for example "teams.alpha..." declares all topics under the "teams.alpha" prefix. Topic options
+// WithTopicContract, WithTopicConfig, WithTopicRetention and WithTopicCompression are used to set
+// the topic, see TopicConfig for the settings applied to the entries put to the topic. Creating a
+// declared topic again updates the settings of the topic.
+func (db *DB) CreateTopic(topic []byte, opts ...Options) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	switch {
+	case len(topic) == 0:
+		return errTopicEmpty
+	case len(topic) > maxTopicLength:
+		return errTopicTooLarge
+	}
+	o := &_Options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(o)
+		}
+	}
+	to := o.topicOptions
+	if to.contract == 0 {
+		to.contract = message.MasterContract
+	}
+	if err := db.authorize(to.contract, topic, OpPut); err != nil {
+		return err
+	}
+	if _, _, err := db.parseTopic(to.contract, topic); err != nil {
+		return err
+	}
+	return db.internal.catalog.declare(to.contract, topic, to.config)
+}
+
+// applyTopic rejects the entry if topics must be declared and the topic of the entry is not declared.
+// Settings of the declared topic are applied to the entry unless the entry sets them. It returns
+// false if the entry is a duplicate within the dedup window of the topic and the entry is dropped.
+func (db *DB) applyTopic(e *Entry) (bool, error) {
+	c := db.internal.catalog
+	if !c.required && c.empty() {
+		return true, nil
+	}
+	contract := e.Contract
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	parts, options := c.separator.SplitTopic(e.Topic)
+	cfg, ok := c.match(contract, parts)
+	if !ok {
+		if c.required {
+			return false, errTopicNotDeclared
+		}
+		return true, nil
+	}
+	key := _CatalogKey{contract: contract, topic: string(c.separator.JoinParts(parts, nil))}
+	if cfg.DedupWindow > 0 && c.duplicate(key, e.Payload, cfg.DedupWindow) {
+		return false, nil
+	}
+	if cfg.MaxEntries > 0 {
+		c.markTrim(key, cfg.MaxEntries)
+	}
+	if e.Compression == CodecDefault {
+		e.Compression = cfg.Compression
+	}
+	e.Encryption = e.Encryption || cfg.Encryption
+	// ttl set on the topic of the entry takes precedence over the retention of the declared topic.
+	if e.ExpiresAt == 0 && cfg.Retention > 0 && !bytes.Contains(options, []byte("ttl=")) {
+		e.ExpiresAt = uint32(time.Now().Add(cfg.Retention).Unix())
+	}
+	return true, nil
+}
+
+// trimTopics deletes the oldest entries of the topics written since the last trim exceeding the max entries of the declared topic.
+func (db *DB) trimTopics() error {
+	if db.opts.flags.immutable {
+		return nil
+	}
+	for key, maxEntries := range db.internal.catalog.takeTrims() {
+		t, _, err := db.parseTopic(key.contract, []byte(key.topic))
+		if err != nil {
+			continue
+		}
+		t.AddContract(key.contract)
+		if err := db.trimTopic(t.GetHash(key.contract), maxEntries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trimTopic deletes the oldest entries of the topic exceeding max entries.
+func (db *DB) trimTopic(topicHash uint64, maxEntries int) error {
+	off, ok := db.internal.trie.getOffset(topicHash)
+	if !ok {
+		return nil
+	}
+	wEntries := db.internal.timeWindow.lookup(db.fs, topicHash, off, _LookupFilter{}, math.MaxInt32)
+	sort.Slice(wEntries, func(i, j int) bool {
+		return wEntries[i].seq() > wEntries[j].seq()
+	})
+	n := 0
+	for _, we := range wEntries {
+		e, err := db.readEntry(_Query{topicHash: topicHash, seq: we.seq()})
+		if err == errMsgIDDeleted || err == errEntryInvalid || err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n++; n <= maxEntries {
+			continue
+		}
+		// The entry packing the topic is kept until it is synced, as the topic is recovered from the log with the entry.
+		if e.topicSize != 0 && e.cache != nil {
+			continue
+		}
+		if err := db.delete(topicHash, we.seq()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
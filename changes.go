@@ -0,0 +1,190 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/uid"
+)
+
+type (
+	// Change is an entry yielded by the change iterator.
+	Change struct {
+		Seq      uint64 // The sequence of the entry, changes are yielded in the order of sequence.
+		ID       []byte // The ID of the entry.
+		Contract uint32 // The contract of the entry.
+		Topic    []byte // The topic of the entry, a part with unknown name is shown as '#' followed by its hash.
+		Payload  []byte // The payload of the entry.
+		TimeID   int64  // The time ID of the entry, that is the unix time in seconds the entry is stored.
+	}
+
+	_ChangeEntry struct {
+		seq       uint64
+		topicHash uint64
+		expiresAt uint32
+	}
+
+	// ChangeIterator iterates over entries committed after a sequence in commit order. The
+	// sequences of the changes are collected when the iterator is created and entries are read
+	// lazily as the iterator advances.
+	ChangeIterator struct {
+		db      *DB
+		entries []_ChangeEntry
+		change  Change
+		err     error
+	}
+)
+
+// Changes returns an iterator over the entries committed after the sequence, across all topics and contracts,
+// in commit order. Use the sequence of the last change to resume the change stream, so external systems can be
+// kept in sync incrementally. Deleted and expired entries are not yielded. The iterator yields entries committed
+// up to the time Changes is called, call Changes again to receive the entries committed later.
+func (db *DB) Changes(sinceSeq uint64) (*ChangeIterator, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	if err := db.authorize(message.MasterContract, nil, OpGet); err != nil {
+		return nil, err
+	}
+	entries, err := db.changeEntries(sinceSeq)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeIterator{db: db, entries: entries}, nil
+}
+
+// changeEntries collects the entries committed after the sequence sorted by sequence.
+func (db *DB) changeEntries(sinceSeq uint64) ([]_ChangeEntry, error) {
+	var entries []_ChangeEntry
+	for _, topic := range db.internal.trie.all() {
+		// entries not yet sync to window file are the most recent entries of the topic.
+		for _, we := range db.internal.timeWindow.ilookup(topic.hash, 0, math.MaxInt32) {
+			if we.seq() > sinceSeq {
+				entries = append(entries, _ChangeEntry{seq: we.seq(), topicHash: topic.hash, expiresAt: we.expiryTime()})
+			}
+		}
+		if err := db.windowChanges(&entries, topic, sinceSeq); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	return entries, nil
+}
+
+// windowChanges collects the entries of the topic in the window file after the sequence.
+func (db *DB) windowChanges(entries *[]_ChangeEntry, topic _Topic, sinceSeq uint64) error {
+	winFile, err := db.fs.getFile(_FileDesc{fileType: typeTimeWindow})
+	if err != nil {
+		return err
+	}
+	for off := topic.offset; off != 0; {
+		r := _WindowReader{winFile: winFile, offset: off}
+		b, err := r.readWindowBlock()
+		if err != nil || b.topicHash != topic.hash {
+			return nil
+		}
+		for i := 0; i < int(b.entryIdx); i++ {
+			if we := b.entries[i]; we.seq() > sinceSeq && !we.isExpired() {
+				*entries = append(*entries, _ChangeEntry{seq: we.seq(), topicHash: topic.hash, expiresAt: we.expiryTime()})
+			}
+		}
+		// window blocks of the topic are linked in reverse time order.
+		if b.entryIdx > 0 && b.entries[0].seq() <= sinceSeq {
+			return nil
+		}
+		off = b.next
+	}
+	return nil
+}
+
+// Next advances the iterator to the next change. It returns false if there are no more
+// changes or an error occurred, check Err for the error.
+func (it *ChangeIterator) Next() bool {
+	for it.err == nil && len(it.entries) > 0 {
+		if err := it.db.ok(); err != nil {
+			it.err = err
+			return false
+		}
+		ce := it.entries[0]
+		it.entries = it.entries[1:]
+		c, ok, err := it.db.readChange(ce)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if !ok {
+			continue
+		}
+		it.change = c
+		return true
+	}
+	return false
+}
+
+// Change returns the current change. It is valid until the next call to Next.
+func (it *ChangeIterator) Change() Change {
+	return it.change
+}
+
+// Err returns the error occurred during the iteration, if any.
+func (it *ChangeIterator) Err() error {
+	return it.err
+}
+
+// readChange reads the entry of the change. It returns false if entry is deleted or it is a chunk of a message.
+func (db *DB) readChange(ce _ChangeEntry) (Change, bool, error) {
+	contract, topic, ok := db.internal.trie.topicName(ce.topicHash)
+	if !ok {
+		// topic is deleted.
+		return Change{}, false, nil
+	}
+	e, err := db.readEntry(_Query{seq: ce.seq})
+	if err != nil {
+		if err == errMsgIDDeleted || err == errEntryInvalid {
+			return Change{}, false, nil
+		}
+		return Change{}, false, err
+	}
+	id, val, err := db.internal.reader.readMessage(e)
+	if err != nil {
+		return Change{}, false, err
+	}
+	msgID := make(message.ID, message.ID(nil).Size())
+	copy(msgID, id[:idSize-1])
+	binary.LittleEndian.PutUint64(msgID[8:16], ce.seq)
+	if !msgID.EvalPrefix(contract, 0) {
+		// chunks of a message are stored under the salted contract of the message.
+		return Change{}, false, nil
+	}
+	payload, _, err := db.decodeValue(id, val)
+	if err != nil {
+		return Change{}, false, err
+	}
+	c := Change{
+		Seq:      ce.seq,
+		ID:       msgID,
+		Contract: contract,
+		Topic:    topic,
+		Payload:  payload,
+		TimeID:   uid.Time(msgID[0:4]),
+	}
+	return c, true, nil
+}
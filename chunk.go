@@ -0,0 +1,155 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// chunkHeaderSize is size of the chunk manifest header, the payload size, checksum and number of chunks.
+	chunkHeaderSize = 12
+
+	// chunkSalt salts the contract of chunk topics, so chunks of a message are not matched by queries of the topic.
+	chunkSalt uint32 = 0x63686b73
+
+	// codecChunked marks the value of a message stored as chunks, the value is the chunk manifest.
+	codecChunked Codec = 0xff
+)
+
+// chunkContract returns the contract salting topic hash of the chunks of a message put under the contract.
+func chunkContract(contract uint32) uint32 {
+	return contract ^ chunkSalt
+}
+
+// isChunked returns true if the decrypted value of a message is a chunk manifest.
+func isChunked(val []byte) bool {
+	return len(val) > 1 && val[0] == codecMarker && Codec(val[1]) == codecChunked
+}
+
+// putChunks splits the payload of the entry into chunks of the chunk size and puts the chunks as separate
+// entries. The payload of the entry is replaced by the manifest of the chunks, that is the payload size,
+// the checksum of the payload and the sequences of the chunks.
+func (db *DB) putChunks(e *Entry) error {
+	size := db.opts.chunkSize
+	n := (len(e.Payload) + size - 1) / size
+	manifest := make([]byte, chunkHeaderSize+8*n)
+	binary.LittleEndian.PutUint32(manifest[0:4], uint32(len(e.Payload)))
+	binary.LittleEndian.PutUint32(manifest[4:8], crc32.ChecksumIEEE(e.Payload))
+	binary.LittleEndian.PutUint32(manifest[8:12], uint32(n))
+	for i := 0; i < n; i++ {
+		end := (i + 1) * size
+		if end > len(e.Payload) {
+			end = len(e.Payload)
+		}
+		c := &Entry{
+			Topic:       e.Topic,
+			Payload:     e.Payload[i*size : end],
+			ExpiresAt:   e.ExpiresAt,
+			Contract:    e.Contract,
+			Encryption:  e.Encryption,
+			Compression: e.Compression,
+		}
+		c.entry.chunk = true
+		if err := db.writeEntry(c); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(manifest[chunkHeaderSize+8*i:], c.entry.seq)
+	}
+	e.Payload = manifest
+	e.entry.chunked = true
+	return nil
+}
+
+// readChunks reads chunks of the manifest and returns the reassembled payload and the codec of the chunks.
+// The size and checksum of the reassembled payload are verified.
+func (db *DB) readChunks(val []byte) ([]byte, Codec, error) {
+	manifest := val[2:]
+	if len(manifest) < chunkHeaderSize {
+		return nil, 0, errChunkCorrupted
+	}
+	size := binary.LittleEndian.Uint32(manifest[0:4])
+	sum := binary.LittleEndian.Uint32(manifest[4:8])
+	n := int(binary.LittleEndian.Uint32(manifest[8:12]))
+	if len(manifest) != chunkHeaderSize+8*n {
+		return nil, 0, errChunkCorrupted
+	}
+	payload := make([]byte, 0, size)
+	var codec Codec
+	for i := 0; i < n; i++ {
+		seq := binary.LittleEndian.Uint64(manifest[chunkHeaderSize+8*i:])
+		s, err := db.readEntry(_Query{seq: seq})
+		switch {
+		case err == errMsgIDDeleted || err == errEntryInvalid || err == io.EOF:
+			return nil, 0, errChunkMissing
+		case err != nil:
+			return nil, 0, err
+		}
+		id, chunk, err := db.internal.reader.readMessage(s)
+		if err != nil {
+			return nil, 0, err
+		}
+		chunk, codec, err = db.decodeValue(id, chunk)
+		if err != nil {
+			return nil, 0, err
+		}
+		payload = append(payload, chunk...)
+	}
+	if uint32(len(payload)) != size || crc32.ChecksumIEEE(payload) != sum {
+		return nil, 0, errChunkCorrupted
+	}
+	return payload, codec, nil
+}
+
+// chunkSeqs returns the sequences of the chunks of the message if the message is stored as chunks.
+func (db *DB) chunkSeqs(seq uint64) []uint64 {
+	s, err := db.readEntry(_Query{seq: seq})
+	if err != nil {
+		return nil
+	}
+	id, val, err := db.internal.reader.readMessage(s)
+	if err != nil {
+		return nil
+	}
+	val, err = db.decrypt(uint8(id[idSize-1]), val)
+	if err != nil || !isChunked(val) || len(val) < 2+chunkHeaderSize {
+		return nil
+	}
+	manifest := val[2:]
+	n := int(binary.LittleEndian.Uint32(manifest[8:12]))
+	if len(manifest) != chunkHeaderSize+8*n {
+		return nil
+	}
+	seqs := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		seqs[i] = binary.LittleEndian.Uint64(manifest[chunkHeaderSize+8*i:])
+	}
+	return seqs
+}
+
+// deleteChunks deletes chunks of the message if the message is stored as chunks.
+func (db *DB) deleteChunks(seq uint64) error {
+	for _, s := range db.chunkSeqs(seq) {
+		// chunks are deleted by seq, the topic hash is not needed to delete an entry.
+		if err := db.delete(0, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
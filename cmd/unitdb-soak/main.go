@@ -0,0 +1,385 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command unitdb-soak runs randomized concurrent puts, gets, deletes, syncs and restarts
+// against a DB in the target directory while checking invariants, to validate durability
+// before releases.
+//
+// Usage:
+//
+//	unitdb-soak [-duration 1h] [-workers 8] [-topics 32] [-restart 1m] [-seed n] <dir>
+//
+// The target directory must not exist or be empty. Each topic keeps a model of the
+// acknowledged writes and deletes, and the messages read from the topic are checked against
+// the model. The following invariants are checked on each get and on each restart:
+//
+//   - no lost writes, every acknowledged write not deleted or expired is returned.
+//   - no duplicates, a message is returned at most once.
+//   - no deleted entries, an acknowledged delete is not returned.
+//   - no expired entries, an entry is not returned after its ttl.
+//
+// A JSON report is written to stdout and the command exits non-zero if any invariant is violated.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unit-io/unitdb"
+)
+
+const (
+	// maxLive is the number of live messages kept per topic, the oldest message is deleted beyond it.
+	maxLive = 200
+
+	// maxDeleted is the number of deleted messages per topic checked against the messages read.
+	maxDeleted = 1000
+
+	// ttl is the ttl of the messages put to the ttl topics.
+	ttl = 3 * time.Second
+
+	// slack is the allowed skew of expiry, expiry time of the entries has second resolution.
+	slack = 2 * time.Second
+)
+
+// Report is the machine-readable result of the soak run.
+type Report struct {
+	Dir        string   `json:"dir"`
+	Seed       int64    `json:"seed"`
+	OK         bool     `json:"ok"`
+	Duration   string   `json:"duration"`
+	Puts       int64    `json:"puts"`
+	Gets       int64    `json:"gets"`
+	Deletes    int64    `json:"deletes"`
+	Syncs      int64    `json:"syncs"`
+	Restarts   int64    `json:"restarts"`
+	Violations []string `json:"violations,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type (
+	_Message struct {
+		id        []byte
+		expiresAt time.Time // zero if the message does not expire.
+	}
+
+	// _Topic is the model of the acknowledged writes and deletes of a topic. Operations on
+	// a topic are serialized by the topic lock so reads are checked against a stable model.
+	_Topic struct {
+		mu      sync.Mutex
+		name    string
+		ttl     bool
+		live    []string // payloads of live messages in put order.
+		msgs    map[string]_Message
+		deleted map[string]struct{}
+		order   []string // payloads of deleted messages in delete order.
+	}
+
+	_Soak struct {
+		dir    string
+		opts   []unitdb.Options
+		mu     sync.RWMutex // held for write on restart.
+		db     *unitdb.DB
+		topics []*_Topic
+		seq    int64
+
+		report   *Report
+		reportMu sync.Mutex
+		reported map[string]struct{}
+	}
+)
+
+func main() {
+	duration := flag.Duration("duration", time.Hour, "duration of the soak run")
+	workers := flag.Int("workers", 8, "number of concurrent workers")
+	topics := flag.Int("topics", 32, "number of topics, every fourth topic puts messages with ttl")
+	restart := flag.Duration("restart", time.Minute, "interval to close and reopen the DB, zero disables restarts")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the random operations")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: unitdb-soak [-duration d] [-workers n] [-topics n] [-restart d] [-seed n] <dir>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *workers < 1 || *topics < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	report := &Report{Dir: flag.Arg(0), Seed: *seed}
+	start := time.Now()
+	if err := soak(report, *duration, *workers, *topics, *restart); err != nil {
+		report.Error = err.Error()
+	}
+	report.OK = report.Error == "" && len(report.Violations) == 0
+	report.Duration = time.Since(start).String()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+func soak(report *Report, duration time.Duration, workers, topics int, restart time.Duration) error {
+	if entries, err := ioutil.ReadDir(report.Dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", report.Dir)
+	}
+	s := &_Soak{
+		dir:      report.Dir,
+		opts:     []unitdb.Options{unitdb.WithDefaultOptions(), unitdb.WithMutable(), unitdb.WithMaxQueryLimit(maxLive * 4)},
+		report:   report,
+		reported: make(map[string]struct{}),
+	}
+	for i := 0; i < topics; i++ {
+		s.topics = append(s.topics, &_Topic{
+			name:    fmt.Sprintf("soak.t%d", i),
+			ttl:     i%4 == 3,
+			msgs:    make(map[string]_Message),
+			deleted: make(map[string]struct{}),
+		})
+	}
+	var err error
+	if s.db, err = s.open(); err != nil {
+		return err
+	}
+
+	stopC := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(r *rand.Rand) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopC:
+					return
+				default:
+				}
+				if err := s.step(r); err != nil {
+					s.violation("%v", err)
+				}
+			}
+		}(rand.New(rand.NewSource(report.Seed + int64(i))))
+	}
+
+	deadline := time.After(duration)
+	var restartC <-chan time.Time
+	if restart > 0 {
+		ticker := time.NewTicker(restart)
+		defer ticker.Stop()
+		restartC = ticker.C
+	}
+	for done := false; !done; {
+		select {
+		case <-deadline:
+			done = true
+		case <-restartC:
+			if err := s.restart(); err != nil {
+				close(stopC)
+				wg.Wait()
+				return err
+			}
+		}
+	}
+	close(stopC)
+	wg.Wait()
+
+	// Final restart checks all topics after the DB is reopened.
+	if err := s.restart(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// step runs a random operation on a random topic.
+func (s *_Soak) step(r *rand.Rand) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t := s.topics[r.Intn(len(s.topics))]
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch n := r.Intn(100); {
+	case n < 60:
+		return s.put(t)
+	case n < 85:
+		return s.check(t)
+	case n < 98:
+		if len(t.live) == 0 {
+			return nil
+		}
+		return s.delete(t, t.live[r.Intn(len(t.live))])
+	default:
+		atomic.AddInt64(&s.report.Syncs, 1)
+		return s.db.Sync()
+	}
+}
+
+func (s *_Soak) put(t *_Topic) error {
+	payload := fmt.Sprintf("%s/%d", t.name, atomic.AddInt64(&s.seq, 1))
+	m := _Message{id: s.db.NewID()}
+	topic := t.name
+	if t.ttl {
+		topic += "?ttl=" + ttl.String()
+		m.expiresAt = time.Now().Add(ttl)
+	}
+	if err := s.db.PutEntry(unitdb.NewEntry([]byte(topic), []byte(payload)).WithID(m.id)); err != nil {
+		return fmt.Errorf("put %s: %v", payload, err)
+	}
+	atomic.AddInt64(&s.report.Puts, 1)
+	t.msgs[payload] = m
+	t.live = append(t.live, payload)
+	if len(t.live) > maxLive {
+		return s.delete(t, t.live[0])
+	}
+	return nil
+}
+
+// delete deletes the message. The message is dropped from the model if delete fails
+// as the message may or may not be deleted.
+func (s *_Soak) delete(t *_Topic, payload string) error {
+	m := t.msgs[payload]
+	err := s.db.DeleteEntry(unitdb.NewEntry([]byte(t.name), nil).WithID(m.id))
+	for i, p := range t.live {
+		if p == payload {
+			t.live = append(t.live[:i], t.live[i+1:]...)
+			break
+		}
+	}
+	delete(t.msgs, payload)
+	if err != nil {
+		return fmt.Errorf("delete %s: %v", payload, err)
+	}
+	atomic.AddInt64(&s.report.Deletes, 1)
+	t.deleted[payload] = struct{}{}
+	t.order = append(t.order, payload)
+	if len(t.order) > maxDeleted {
+		delete(t.deleted, t.order[0])
+		t.order = t.order[1:]
+	}
+	return nil
+}
+
+// check reads the messages of the topic and checks the invariants against the model.
+func (s *_Soak) check(t *_Topic) error {
+	items, err := s.db.Get(unitdb.NewQuery([]byte(t.name)).WithLimit(maxLive * 4))
+	if err != nil {
+		return fmt.Errorf("get %s: %v", t.name, err)
+	}
+	atomic.AddInt64(&s.report.Gets, 1)
+	now := time.Now()
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		payload := string(item)
+		if !strings.HasPrefix(payload, t.name+"/") {
+			s.violation("%s: unknown message %q", t.name, payload)
+			continue
+		}
+		if _, ok := seen[payload]; ok {
+			s.violation("%s: duplicate message %s", t.name, payload)
+		}
+		seen[payload] = struct{}{}
+		if _, ok := t.deleted[payload]; ok {
+			s.violation("%s: deleted message %s returned", t.name, payload)
+			continue
+		}
+		m, ok := t.msgs[payload]
+		if !ok {
+			if _, err := strconv.ParseInt(payload[len(t.name)+1:], 10, 64); err != nil {
+				s.violation("%s: unknown message %q", t.name, payload)
+			}
+			continue
+		}
+		if !m.expiresAt.IsZero() && now.After(m.expiresAt.Add(slack)) {
+			s.violation("%s: expired message %s returned", t.name, payload)
+		}
+	}
+	live := t.live[:0]
+	for _, payload := range t.live {
+		m := t.msgs[payload]
+		if !m.expiresAt.IsZero() && now.After(m.expiresAt.Add(-slack)) {
+			// message is expired or about to expire, it is dropped from the model.
+			if now.After(m.expiresAt.Add(slack)) {
+				delete(t.msgs, payload)
+				continue
+			}
+		} else if _, ok := seen[payload]; !ok {
+			// lost message is reported once.
+			s.violation("%s: acknowledged message %s lost", t.name, payload)
+			delete(t.msgs, payload)
+			continue
+		}
+		live = append(live, payload)
+	}
+	t.live = live
+	return nil
+}
+
+// restart closes and reopens the DB and checks all topics.
+func (s *_Soak) restart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	s.db = db
+	atomic.AddInt64(&s.report.Restarts, 1)
+	for _, t := range s.topics {
+		t.mu.Lock()
+		err := s.check(t)
+		t.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open opens the DB, a panic on open such as a failed recovery is returned as an error.
+func (s *_Soak) open() (db *unitdb.DB, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("open: %v", r)
+		}
+	}()
+	return unitdb.Open(s.dir, s.opts...)
+}
+
+// violation reports the violation, a violation seen on repeated checks is reported once.
+func (s *_Soak) violation(format string, args ...interface{}) {
+	v := fmt.Sprintf(format, args...)
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+	if _, ok := s.reported[v]; ok {
+		return
+	}
+	s.reported[v] = struct{}{}
+	fmt.Fprintln(os.Stderr, v)
+	s.report.Violations = append(s.report.Violations, v)
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command unitdb provides maintenance tools for unitdb databases.
+//
+// Usage:
+//
+//	unitdb verify-backup [-keep] [-key key] <backup>
+//	unitdb metadata [-set key=value]... <db>
+//
+// verify-backup rehearses a restore of the backup. The backup is copied to a scratch directory
+// so the backup itself is left untouched, the DB is opened to replay any bundled WAL, then
+// integrity verification is run along with sample queries. A JSON report is written to stdout
+// and the command exits non-zero if verification fails.
+//
+// metadata writes the DB metadata as JSON to stdout. Metadata keys are set before the metadata
+// is written if -set is given, an empty value deletes the key.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unit-io/unitdb"
+)
+
+// Report is the machine-readable result of verify-backup.
+type Report struct {
+	Backup   string               `json:"backup"`
+	OK       bool                 `json:"ok"`
+	Duration string               `json:"duration"`
+	Verify   *unitdb.VerifyReport `json:"verify,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	switch flag.Arg(0) {
+	case "verify-backup":
+		os.Exit(verifyBackup(flag.Args()[1:]))
+	case "metadata":
+		os.Exit(metadata(flag.Args()[1:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: unitdb verify-backup [-keep] [-key key] <backup>\n")
+	fmt.Fprintf(os.Stderr, "       unitdb metadata [-set key=value]... <db>\n")
+}
+
+// keyValues is a flag collecting repeated key=value arguments.
+type keyValues map[string]string
+
+func (kv keyValues) String() string {
+	return fmt.Sprint(map[string]string(kv))
+}
+
+func (kv keyValues) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not key=value", s)
+	}
+	kv[s[:i]] = s[i+1:]
+	return nil
+}
+
+func metadata(args []string) int {
+	fs := flag.NewFlagSet("metadata", flag.ExitOnError)
+	kvs := keyValues{}
+	fs.Var(kvs, "set", "set metadata key=value, empty value deletes the key")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return 2
+	}
+
+	// Stat the DB so a new DB is not created at the path.
+	if _, err := os.Stat(fs.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// The DB is opened with the metadata options so the metadata is set on open.
+	db, err := unitdb.Open(fs.Arg(0), unitdb.WithDefaultOptions(), unitdb.WithMetadata(kvs))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	md, err := db.Metadata()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(md)
+	return 0
+}
+
+func verifyBackup(args []string) int {
+	fs := flag.NewFlagSet("verify-backup", flag.ExitOnError)
+	keep := fs.Bool("keep", false, "keep the scratch copy of the backup")
+	key := fs.String("key", "", "encryption key of the backup, if it differs from the default key")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return 2
+	}
+
+	start := time.Now()
+	report := &Report{Backup: fs.Arg(0)}
+	verify := func() error {
+		dir, err := ioutil.TempDir("", "unitdb-verify-")
+		if err != nil {
+			return err
+		}
+		if !*keep {
+			defer os.RemoveAll(dir)
+		}
+		if err := copyDir(report.Backup, dir); err != nil {
+			return err
+		}
+		// Opening the DB replays the WAL bundled with the backup.
+		opts := []unitdb.Options{unitdb.WithDefaultOptions()}
+		if *key != "" {
+			opts = append(opts, unitdb.WithEncryptionKey([]byte(*key)))
+		}
+		db, err := unitdb.Open(dir, opts...)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		report.Verify, err = db.Verify()
+		return err
+	}
+	if err := verify(); err != nil {
+		report.Error = err.Error()
+	}
+	report.OK = report.Error == "" && report.Verify.OK()
+	report.Duration = time.Since(start).String()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// copyDir copies the regular files of the src directory tree to the dst directory.
+func copyDir(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", src)
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0777)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+		return copyFile(path, target, info.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
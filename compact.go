@@ -0,0 +1,222 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// _ReadEpochs tracks the epochs of the readers traversing window block chains. Blocks of the chains
+	// replaced by compaction are retired in the current epoch and reclaimed only after the readers that
+	// entered in or before the epoch exit, so the readers traversing the replaced chain finish safely.
+	_ReadEpochs struct {
+		mu      sync.Mutex
+		epoch   uint64
+		readers map[uint64]int // The number of readers per epoch.
+		retired []_RetiredBlocks
+	}
+	_RetiredBlocks struct {
+		epoch   uint64
+		offsets []int64
+	}
+	// _CompactEntry is a window entry kept by compaction with the cutoff time of its window block.
+	_CompactEntry struct {
+		we         _WinEntry
+		cutoffTime int64
+	}
+)
+
+func newReadEpochs() *_ReadEpochs {
+	return &_ReadEpochs{readers: make(map[uint64]int)}
+}
+
+// enter enters the current epoch, the reader must exit the epoch once it stops traversing the chains.
+func (e *_ReadEpochs) enter() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.readers[e.epoch]++
+	return e.epoch
+}
+
+func (e *_ReadEpochs) exit(epoch uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.readers[epoch]--; e.readers[epoch] <= 0 {
+		delete(e.readers, epoch)
+	}
+}
+
+// retire retires the blocks in the current epoch and advances the epoch.
+func (e *_ReadEpochs) retire(offsets []int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.retired = append(e.retired, _RetiredBlocks{epoch: e.epoch, offsets: offsets})
+	e.epoch++
+}
+
+// reclaim returns the retired blocks no reader may traverse, that is the blocks retired before the oldest epoch with readers.
+func (e *_ReadEpochs) reclaim() (offsets []int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	oldest := e.epoch
+	for epoch := range e.readers {
+		if epoch < oldest {
+			oldest = epoch
+		}
+	}
+	i := 0
+	for ; i < len(e.retired) && e.retired[i].epoch < oldest; i++ {
+		offsets = append(offsets, e.retired[i].offsets...)
+	}
+	e.retired = e.retired[i:]
+	return offsets
+}
+
+// CompactTopic rewrites the window block chain of the topic without the entries deleted, see CompactTopicEntry.
+func (db *DB) CompactTopic(topic []byte) error {
+	return db.CompactTopicEntry(NewEntry(topic, nil))
+}
+
+// CompactTopicEntry rewrites the window block chain of the entry topic under the entry contract without the
+// entries deleted, so the blocks of the topic are packed. The topic is queryable while it is compacted, the
+// queries started before the compacted chain is swapped in read the replaced chain and blocks of the replaced
+// chain are reclaimed for reuse by compaction once these queries complete. Iterators returned by Items hold
+// the blocks until they are exhausted. Entries deleted with their tombstones retained are kept.
+func (db *DB) CompactTopicEntry(e *Entry) error {
+	topicHash, err := db.parseDeleteTopic(e)
+	if err != nil {
+		return err
+	}
+
+	// window blocks are written, so the topic is compacted under the sync lock.
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+
+	return db.compactTopic(topicHash)
+}
+
+// compactTopic writes the entries of the chain of the topic not deleted to a new chain and swaps in
+// the new chain. The head of the new chain is appended to the window file, so it is loaded as the
+// head of the topic on DB open. The caller must hold the sync lock.
+func (db *DB) compactTopic(topicHash uint64) error {
+	off, ok := db.internal.trie.getOffset(topicHash)
+	if !ok || off == 0 {
+		return nil
+	}
+	winFile, err := db.fs.getFile(_FileDesc{fileType: typeTimeWindow})
+	if err != nil {
+		return err
+	}
+	var old []int64
+	var entries []_CompactEntry
+	for next := off; next != 0; {
+		r := _WindowReader{winFile: winFile, offset: next}
+		b, err := r.readWindowBlock()
+		if err != nil {
+			return err
+		}
+		if b.topicHash != topicHash {
+			break
+		}
+		old = append(old, next)
+		for _, we := range b.entries[:b.entryIdx] {
+			if we.seq() == 0 || db.compactable(we.seq()) {
+				continue
+			}
+			entries = append(entries, _CompactEntry{we: we, cutoffTime: b.cutoffTime})
+		}
+		next = b.next
+	}
+	nBlocks := (len(entries) + entriesPerWindowBlock - 1) / entriesPerWindowBlock
+	if nBlocks == 0 || nBlocks >= len(old) {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].we.seq() < entries[j].we.seq() })
+
+	var next int64
+	for i := 0; i < nBlocks; i++ {
+		var blockOff int64
+		if n := len(db.internal.freeWinBlocks); n > 0 && i < nBlocks-1 {
+			blockOff = db.internal.freeWinBlocks[n-1]
+			db.internal.freeWinBlocks = db.internal.freeWinBlocks[:n-1]
+		} else if blockOff, err = winFile.extend(uint32(blockSize)); err != nil {
+			return err
+		}
+		b := _WinBlock{topicHash: topicHash, next: next}
+		end := (i + 1) * entriesPerWindowBlock
+		if end > len(entries) {
+			end = len(entries)
+		}
+		for _, ce := range entries[i*entriesPerWindowBlock : end] {
+			b.entries[b.entryIdx] = ce.we
+			b.entryIdx++
+			// the block of the head of the chain is filled on sync.
+			if i < nBlocks-1 {
+				if ce.cutoffTime == 0 {
+					b.cutoffTime = time.Now().Unix()
+				} else if ce.cutoffTime > b.cutoffTime {
+					b.cutoffTime = ce.cutoffTime
+				}
+			}
+		}
+		if _, err := winFile.WriteAt(b.marshalBinary(), blockOff); err != nil {
+			return err
+		}
+		next = blockOff
+	}
+	atomic.StoreUint32(&db.internal.dbInfo.winBlocks, uint32(winFile.currSize()/int64(blockSize)))
+	db.internal.checkpoint.set(topicHash, next)
+	if err := db.sync(); err != nil {
+		return err
+	}
+	db.internal.trie.setOffset(_Topic{hash: topicHash, offset: next})
+	db.internal.readEpochs.retire(old)
+	return db.reclaimWindowBlocks()
+}
+
+// compactable returns true if the entry is deleted and its tombstone is not retained. The deleted
+// entry packing the topic is kept, as the topic is loaded on DB open from the first entry of the chain.
+func (db *DB) compactable(seq uint64) bool {
+	if _, err := db.internal.reader.readIndexEntry(seq); err != errMsgIDDeleted && err != errEntryInvalid {
+		return false
+	}
+	return !db.internal.tombstones.has(seq)
+}
+
+// reclaimWindowBlocks clears the retired window blocks no reader may traverse and adds these to the
+// window blocks reused by compaction. The caller must hold the sync lock.
+func (db *DB) reclaimWindowBlocks() error {
+	offsets := db.internal.readEpochs.reclaim()
+	if len(offsets) == 0 {
+		return nil
+	}
+	winFile, err := db.fs.getFile(_FileDesc{fileType: typeTimeWindow})
+	if err != nil {
+		return err
+	}
+	for _, off := range offsets {
+		if _, err := winFile.WriteAt(_WinBlock{}.marshalBinary(), off); err != nil {
+			return err
+		}
+		db.internal.freeWinBlocks = append(db.internal.freeWinBlocks, off)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+// Codec is the compression codec of message payloads.
+type Codec uint8
+
+// Compression codecs. The codec is recorded per entry so entries written using
+// different codecs are decompressed transparently on Get.
+const (
+	// CodecDefault uses the compression codec set on the DB.
+	CodecDefault Codec = iota
+	// CodecSnappy compresses payloads using snappy, it is the default codec of the DB.
+	CodecSnappy
+	// CodecNone stores payloads uncompressed.
+	CodecNone
+	// CodecDeflate compresses payloads using deflate, it is slower than snappy with a higher compression ratio.
+	CodecDeflate
+	// CodecZstd compresses payloads using zstd. The zstd compressor is not built in, it
+	// is used once registered using RegisterCompressor.
+	CodecZstd
+	// CodecGzip marks payloads already compressed by the producer using gzip, the payloads
+	// are stored and returned as is, they are neither recompressed nor decompressed.
+	CodecGzip
+)
+
+// HeaderContentEncoding is the header of the entry marking the encoding of its payload. An entry
+// with the gzip content encoding header is put using CodecGzip, and messages of CodecGzip entries
+// delivered to watchers carry the header.
+const HeaderContentEncoding = "Content-Encoding"
+
+// contentEncodingGzip is the content encoding of the payloads of CodecGzip entries.
+const contentEncodingGzip = "gzip"
+
+// codecMarker marks the value recording its codec. A snappy encoded value of a non empty
+// payload never starts with zero byte, so values written before codecs were recorded
+// and values using the snappy codec are stored without the marker.
+const codecMarker = 0x00
+
+// Compressor compresses and decompresses message payloads.
+type Compressor interface {
+	// Encode returns the encoded src, it may use dst as buffer.
+	Encode(dst, src []byte) []byte
+	// Decode returns the decoded src, it may use dst as buffer.
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+var compressors = struct {
+	sync.RWMutex
+	m map[Codec]Compressor
+}{m: map[Codec]Compressor{
+	CodecSnappy:  _SnappyCompressor{},
+	CodecNone:    _NoneCompressor{},
+	CodecDeflate: _DeflateCompressor{},
+	CodecGzip:    _NoneCompressor{},
+	codecChunked: _NoneCompressor{},
+}}
+
+// RegisterCompressor registers the compressor for the codec, it replaces the compressor
+// registered earlier for the codec. The compressors of CodecDefault and CodecGzip cannot be registered.
+func RegisterCompressor(codec Codec, c Compressor) error {
+	if codec == CodecDefault || codec == CodecGzip || codec == codecChunked || c == nil {
+		return errBadCodec
+	}
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.m[codec] = c
+	return nil
+}
+
+func compressor(codec Codec) (Compressor, error) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	c, ok := compressors.m[codec]
+	if !ok {
+		return nil, errBadCodec
+	}
+	return c, nil
+}
+
+// compress compresses the payload using the codec and records the codec in the value.
+func compress(codec Codec, payload []byte) ([]byte, error) {
+	c, err := compressor(codec)
+	if err != nil {
+		return nil, err
+	}
+	if codec == CodecSnappy {
+		return c.Encode(nil, payload), nil
+	}
+	return c.Encode([]byte{codecMarker, byte(codec)}, payload), nil
+}
+
+// valueCodec returns the codec recorded in the value.
+func valueCodec(val []byte) Codec {
+	if len(val) > 1 && val[0] == codecMarker {
+		return Codec(val[1])
+	}
+	return CodecSnappy
+}
+
+// contentHeaders returns the headers with the content encoding of the codec set.
+func contentHeaders(codec Codec, headers map[string]string) map[string]string {
+	if codec != CodecGzip || headers[HeaderContentEncoding] == contentEncodingGzip {
+		return headers
+	}
+	h := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		h[k] = v
+	}
+	h[HeaderContentEncoding] = contentEncodingGzip
+	return h
+}
+
+// decompress decompresses the value using the codec recorded in the value.
+func decompress(val []byte) ([]byte, error) {
+	codec := CodecSnappy
+	if len(val) > 1 && val[0] == codecMarker {
+		codec = Codec(val[1])
+		val = val[2:]
+	}
+	c, err := compressor(codec)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decode(nil, val)
+}
+
+type (
+	_SnappyCompressor  struct{}
+	_NoneCompressor    struct{}
+	_DeflateCompressor struct{}
+)
+
+func (_SnappyCompressor) Encode(dst, src []byte) []byte {
+	return append(dst, snappy.Encode(nil, src)...)
+}
+
+func (_SnappyCompressor) Decode(dst, src []byte) ([]byte, error) {
+	return snappy.Decode(dst, src)
+}
+
+func (_NoneCompressor) Encode(dst, src []byte) []byte {
+	return append(dst, src...)
+}
+
+func (_NoneCompressor) Decode(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func (_DeflateCompressor) Encode(dst, src []byte) []byte {
+	buf := bytes.NewBuffer(dst)
+	// flate.NewWriter returns error only for invalid compression level.
+	w, _ := flate.NewWriter(buf, flate.DefaultCompression)
+	w.Write(src)
+	w.Close()
+	return buf.Bytes()
+}
+
+func (_DeflateCompressor) Decode(dst, src []byte) ([]byte, error) {
+	val, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(src)))
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, val...), nil
+}
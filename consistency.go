@@ -0,0 +1,94 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"sync/atomic"
+)
+
+// checkConsistency cross-checks header counters against the index and data files on open and
+// corrects stale counters, for example after a crash between sync and the header write.
+// Corrections are logged. It is run after recovery of WAL, so entries recovered from
+// WAL are already written to the index file.
+func (db *DB) checkConsistency() error {
+	r := db.internal.reader
+	if r == nil || r.indexFile == nil || r.dataFile == nil {
+		return nil
+	}
+	indexSize := r.indexFile.currSize()
+	if indexSize%int64(blockSize) != 0 {
+		logger.Warn().Str("context", "db.checkConsistency").Int64("size", indexSize).Msg("index file size is not aligned to block size")
+	}
+	nBlocks := int32(indexSize / int64(blockSize))
+
+	// Find last sequence and the end of data from the last written index block.
+	var lastSeq uint64
+	var dataEnd int64
+	for bIdx := nBlocks - 1; bIdx >= 0 && lastSeq == 0; bIdx-- {
+		b, err := r.readIndexBlockAt(blockOffset(bIdx))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < entriesPerIndexBlock; i++ {
+			e := b.entries[i]
+			if e.seq > lastSeq {
+				lastSeq = e.seq
+			}
+			if e.seq != 0 && e.msgOffset >= 0 && e.msgOffset+int64(e.mSize()) > dataEnd {
+				dataEnd = e.msgOffset + int64(e.mSize())
+			}
+		}
+	}
+
+	if seq := atomic.LoadUint64(&db.internal.dbInfo.sequence); seq < lastSeq {
+		logger.Warn().Str("context", "db.checkConsistency").Uint64("seq", seq).Uint64("corrected", lastSeq).Msg("header seq is behind index, correcting seq")
+		atomic.StoreUint64(&db.internal.dbInfo.sequence, lastSeq)
+	}
+	if dataSize := r.dataFile.currSize(); dataSize < dataEnd {
+		logger.Error().Str("context", "db.checkConsistency").Int64("size", dataSize).Int64("expected", dataEnd).Msg("data file is shorter than index")
+	}
+
+	// count cannot exceed the number of sequences, recount live entries from the index.
+	seq := atomic.LoadUint64(&db.internal.dbInfo.sequence)
+	if count := db.internal.count.load(); count > seq {
+		recount, err := countIndexEntries(r, nBlocks)
+		if err != nil {
+			return err
+		}
+		logger.Warn().Str("context", "db.checkConsistency").Uint64("count", count).Uint64("corrected", recount).Msg("header count exceeds seq, correcting count")
+		db.internal.count.store(recount)
+	}
+
+	return nil
+}
+
+// countIndexEntries counts entries of the index file not deleted.
+func countIndexEntries(r *_BlockReader, nBlocks int32) (uint64, error) {
+	var count uint64
+	for bIdx := int32(0); bIdx < nBlocks; bIdx++ {
+		b, err := r.readIndexBlockAt(blockOffset(bIdx))
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i < entriesPerIndexBlock; i++ {
+			if e := b.entries[i]; e.seq != 0 && e.msgOffset != -1 {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
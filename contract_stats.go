@@ -0,0 +1,198 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/uid"
+)
+
+// contractStatsRecordSize is size of a record of the contract stats file.
+const contractStatsRecordSize = 28
+
+type (
+	// ContractStats holds the storage statistics of a contract.
+	ContractStats struct {
+		Contract uint32 `json:"contract"`
+		// Count is the number of entries of the contract synced to the DB files, chunks of a large message are counted as entries.
+		Count int64 `json:"count"`
+		// Bytes is the size of message IDs, topics and the packed payloads of the entries of the contract.
+		Bytes int64 `json:"bytes"`
+		// Topics is the number of topics of the contract.
+		Topics int `json:"topics"`
+		// LastWrite is the time of the most recent entry of the contract synced to the DB files.
+		LastWrite time.Time `json:"last_write"`
+	}
+
+	// _ContractUsage is the count, the bytes and the time ID of the last write of a contract.
+	_ContractUsage struct {
+		count     int64
+		bytes     int64
+		lastWrite int64
+	}
+
+	// _ContractStats tracks the usage of the contracts incrementally, the entries are added on sync and
+	// removed on delete and expiry. The usage is persisted to the contract stats file on sync.
+	_ContractStats struct {
+		mu    sync.Mutex
+		path  string
+		usage map[uint32]_ContractUsage
+		dirty bool
+	}
+)
+
+func newContractStats(dirName string) (*_ContractStats, error) {
+	s := &_ContractStats{
+		path:  path.Join(dirName, fmt.Sprintf("%s.cstats", prefix)),
+		usage: make(map[uint32]_ContractUsage),
+	}
+	data, err := ioutil.ReadFile(s.path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, err
+	case len(data)%contractStatsRecordSize != 0:
+		return nil, errCorrupted
+	}
+	for ; len(data) > 0; data = data[contractStatsRecordSize:] {
+		s.usage[binary.LittleEndian.Uint32(data[0:4])] = _ContractUsage{
+			count:     int64(binary.LittleEndian.Uint64(data[4:12])),
+			bytes:     int64(binary.LittleEndian.Uint64(data[12:20])),
+			lastWrite: int64(binary.LittleEndian.Uint64(data[20:28])),
+		}
+	}
+	return s, nil
+}
+
+// addEntry adds the entry to the usage of its contract. The contract and the time ID are read from the ID of the entry.
+func addEntry(usage map[uint32]_ContractUsage, id []byte, size int64) {
+	contract := binary.LittleEndian.Uint32(id[4:8])
+	u := usage[contract]
+	u.count++
+	u.bytes += size
+	if t := uid.Time(id[0:4]); t > u.lastWrite {
+		u.lastWrite = t
+	}
+	usage[contract] = u
+}
+
+// apply adds the usage to the usage of the contracts if sign is 1 or removes it if sign is -1.
+func (s *_ContractStats) apply(usage map[uint32]_ContractUsage, sign int64) {
+	if len(usage) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for contract, delta := range usage {
+		u := s.usage[contract]
+		u.count += sign * delta.count
+		u.bytes += sign * delta.bytes
+		if sign > 0 && delta.lastWrite > u.lastWrite {
+			u.lastWrite = delta.lastWrite
+		}
+		if u.count <= 0 {
+			u.count, u.bytes = 0, 0
+		}
+		s.usage[contract] = u
+	}
+	s.dirty = true
+}
+
+// release removes the deleted or expired entry from the usage of its contract.
+func (s *_ContractStats) release(id []byte, size int64) {
+	usage := make(map[uint32]_ContractUsage, 1)
+	addEntry(usage, id, size)
+	s.apply(usage, -1)
+}
+
+func (s *_ContractStats) get(contract uint32) _ContractUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[contract]
+}
+
+// reset replaces the usage of the contracts with the usage recounted from the index file.
+func (s *_ContractStats) reset(usage map[uint32]_ContractUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = usage
+	s.dirty = true
+}
+
+// write writes the usage to the contract stats file if usage has changed since the last write.
+func (s *_ContractStats) write() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	buf := make([]byte, 0, len(s.usage)*contractStatsRecordSize)
+	for contract, u := range s.usage {
+		var scratch [contractStatsRecordSize]byte
+		binary.LittleEndian.PutUint32(scratch[0:4], contract)
+		binary.LittleEndian.PutUint64(scratch[4:12], uint64(u.count))
+		binary.LittleEndian.PutUint64(scratch[12:20], uint64(u.bytes))
+		binary.LittleEndian.PutUint64(scratch[20:28], uint64(u.lastWrite))
+		buf = append(buf, scratch[:]...)
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// releaseStats removes the deleted or expired entry from the stats of its contract.
+func (db *DB) releaseStats(r *_BlockReader, e _IndexEntry) {
+	id, _, err := r.readMessage(e)
+	if err != nil {
+		return
+	}
+	db.internal.contractStats.release(id, int64(e.mSize()))
+}
+
+// ContractStats returns the storage statistics of the contract. The count and the bytes are maintained
+// on sync, so the entries not yet synced are not included.
+func (db *DB) ContractStats(contract uint32) (ContractStats, error) {
+	if err := db.ok(); err != nil {
+		return ContractStats{}, err
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if err := db.authorize(contract, nil, OpGet); err != nil {
+		return ContractStats{}, err
+	}
+	u := db.internal.contractStats.get(contract)
+	stats := ContractStats{Contract: contract, Count: u.count, Bytes: u.bytes, Topics: len(db.internal.trie.contractTopics(contract))}
+	if u.lastWrite != 0 {
+		stats.LastWrite = time.Unix(u.lastWrite, 0)
+	}
+	return stats, nil
+}
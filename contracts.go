@@ -0,0 +1,209 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// contractRecordSize is size of the fixed fields of the contract record preceding the name.
+const contractRecordSize = 22
+
+// ContractInfo holds the metadata of a contract created using NewContract.
+type ContractInfo struct {
+	Contract  uint32
+	Name      string
+	CreatedAt time.Time
+	// RevokedAt is zero unless the contract is revoked using RevokeContract.
+	RevokedAt time.Time
+}
+
+// Revoked returns true if the contract is revoked.
+func (c ContractInfo) Revoked() bool {
+	return !c.RevokedAt.IsZero()
+}
+
+// _ContractOptions is used to set options to create a contract.
+type _ContractOptions struct {
+	name string
+}
+
+// _Contracts holds the contracts created using NewContract and their metadata. The contracts are
+// persisted to the contracts file on each change as contracts are created and revoked rarely.
+type _Contracts struct {
+	mu        sync.RWMutex
+	path      string
+	contracts map[uint32]ContractInfo
+	// revoked holds the revoked contracts checked on each operation.
+	revoked map[uint32]struct{}
+}
+
+func newContracts(dirName string) (*_Contracts, error) {
+	c := &_Contracts{
+		path:      path.Join(dirName, fmt.Sprintf("%s.contracts", prefix)),
+		contracts: make(map[uint32]ContractInfo),
+		revoked:   make(map[uint32]struct{}),
+	}
+	data, err := ioutil.ReadFile(c.path)
+	switch {
+	case os.IsNotExist(err):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+	// Each record is prefixed with its size, so fields added to the record later are read as zero from older records.
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errCorrupted
+		}
+		size := int(binary.LittleEndian.Uint16(data[0:2]))
+		if size < contractRecordSize || len(data) < 2+size {
+			return nil, errCorrupted
+		}
+		rec := data[2 : 2+size]
+		data = data[2+size:]
+		nameSize := int(binary.LittleEndian.Uint16(rec[20:22]))
+		if len(rec) < contractRecordSize+nameSize {
+			return nil, errCorrupted
+		}
+		info := ContractInfo{
+			Contract: binary.LittleEndian.Uint32(rec[0:4]),
+			Name:     string(rec[contractRecordSize : contractRecordSize+nameSize]),
+		}
+		if createdAt := int64(binary.LittleEndian.Uint64(rec[4:12])); createdAt != 0 {
+			info.CreatedAt = time.Unix(0, createdAt)
+		}
+		if revokedAt := int64(binary.LittleEndian.Uint64(rec[12:20])); revokedAt != 0 {
+			info.RevokedAt = time.Unix(0, revokedAt)
+			c.revoked[info.Contract] = struct{}{}
+		}
+		c.contracts[info.Contract] = info
+	}
+	return c, nil
+}
+
+// add adds the contract if it does not exist. It returns false if the contract exists.
+func (c *_Contracts) add(info ContractInfo) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.contracts[info.Contract]; ok {
+		return false, nil
+	}
+	c.contracts[info.Contract] = info
+	return true, c.write()
+}
+
+// revoke marks the contract revoked, a contract not created using NewContract is added as revoked.
+func (c *_Contracts) revoke(contract uint32, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.contracts[contract]
+	if !ok {
+		info = ContractInfo{Contract: contract}
+	}
+	if info.Revoked() {
+		return nil
+	}
+	info.RevokedAt = now
+	c.contracts[contract] = info
+	c.revoked[contract] = struct{}{}
+	return c.write()
+}
+
+func (c *_Contracts) isRevoked(contract uint32) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.revoked) == 0 {
+		return false
+	}
+	_, ok := c.revoked[contract]
+	return ok
+}
+
+// list returns the contracts sorted by creation time.
+func (c *_Contracts) list() []ContractInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	list := make([]ContractInfo, 0, len(c.contracts))
+	for _, info := range c.contracts {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].Contract < list[j].Contract
+	})
+	return list
+}
+
+// write writes the contracts to the contracts file, the caller must hold the contracts lock.
+func (c *_Contracts) write() error {
+	var buf []byte
+	for _, info := range c.contracts {
+		size := contractRecordSize + len(info.Name)
+		rec := make([]byte, 2+size)
+		binary.LittleEndian.PutUint16(rec[0:2], uint16(size))
+		binary.LittleEndian.PutUint32(rec[2:6], info.Contract)
+		if !info.CreatedAt.IsZero() {
+			binary.LittleEndian.PutUint64(rec[6:14], uint64(info.CreatedAt.UnixNano()))
+		}
+		if info.Revoked() {
+			binary.LittleEndian.PutUint64(rec[14:22], uint64(info.RevokedAt.UnixNano()))
+		}
+		binary.LittleEndian.PutUint16(rec[22:24], uint16(len(info.Name)))
+		copy(rec[24:], info.Name)
+		buf = append(buf, rec...)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Contracts returns the contracts created using NewContract along with their metadata, sorted by creation time.
+// Contracts created before the contracts are recorded by the DB are listed only once revoked.
+func (db *DB) Contracts() ([]ContractInfo, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	return db.internal.contracts.list(), nil
+}
+
+// RevokeContract revokes the contract. Writes, reads, deletes and watches of the topics of a revoked
+// contract are rejected, the entries of the contract are kept until these expire or are deleted.
+// A revoked contract cannot be reinstated.
+func (db *DB) RevokeContract(contract uint32) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	if contract == 0 || contract == message.MasterContract {
+		return errBadRequest
+	}
+	return db.internal.contracts.revoke(contract, time.Now())
+}
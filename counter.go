@@ -0,0 +1,70 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// nCounterShards is the number of shards of the entry counter.
+const nCounterShards = 16
+
+type (
+	// _CounterShard is padded to a cache line so writers on different shards do not contend.
+	_CounterShard struct {
+		n int64
+		_ [56]byte
+	}
+
+	// _Counter is the entry count of the DB sharded across cache lines. Writers add to a random shard
+	// and readers aggregate the shards, so puts and deletes do not contend on a single atomic.
+	_Counter struct {
+		shards [nCounterShards]_CounterShard
+	}
+)
+
+func newCounter(n uint64) *_Counter {
+	c := &_Counter{}
+	c.store(n)
+	return c
+}
+
+// add adds the delta to a random shard, a shard may go negative as deletes land on other shards than puts.
+func (c *_Counter) add(delta int64) {
+	atomic.AddInt64(&c.shards[rand.Intn(nCounterShards)].n, delta)
+}
+
+// load returns the sum of the shards.
+func (c *_Counter) load() uint64 {
+	var n int64
+	for i := range c.shards {
+		n += atomic.LoadInt64(&c.shards[i].n)
+	}
+	if n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
+
+// store resets the counter to the count.
+func (c *_Counter) store(n uint64) {
+	for i := 1; i < nCounterShards; i++ {
+		atomic.StoreInt64(&c.shards[i].n, 0)
+	}
+	atomic.StoreInt64(&c.shards[0].n, int64(n))
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// KeySize length of the encryption key.
+	KeySize = chacha20poly1305.KeySize
+
+	// WrappedKeySize length of a wrapped key including nonce and tag.
+	WrappedKeySize = chacha20poly1305.NonceSizeX + KeySize + chacha20poly1305.Overhead
+)
+
+// NewKey generates a new random 256-bit/32 byte data key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WrapKey encrypts the data key using the key encryption key (kek). The additional data
+// binds the wrapped key to its context and must be provided to unwrap the key.
+func WrapKey(kek, key, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX, WrappedKeySize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, additionalData), nil
+}
+
+// UnwrapKey decrypts the data key wrapped using WrapKey.
+func UnwrapKey(kek, wrapped, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) != WrappedKeySize {
+		return nil, errors.New("Invalid wrapped key.")
+	}
+	key, err := aead.Open(nil, wrapped[:chacha20poly1305.NonceSizeX], wrapped[chacha20poly1305.NonceSizeX:], additionalData)
+	if err != nil {
+		return nil, errors.New("Authentication failed.")
+	}
+	return key, nil
+}
@@ -17,19 +17,16 @@
 package unitdb
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"os"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/golang/snappy"
 	"github.com/unit-io/bpool"
-	"github.com/unit-io/unitdb/crypto"
 	fltr "github.com/unit-io/unitdb/filter"
 	"github.com/unit-io/unitdb/memdb"
 	"github.com/unit-io/unitdb/message"
@@ -56,14 +53,25 @@ func Open(path string, opts ...Options) (*DB, error) {
 			opt.set(options)
 		}
 	}
+	if !options.restoreTime.IsZero() && options.walArchivePath == "" {
+		return nil, errArchiveNotSet
+	}
+
+	if err := reserveFiles(options); err != nil {
+		return nil, err
+	}
 
-	lock, err := createLockFile(path)
+	lock, err := createLockFile(path, options.flags.lockTakeover)
 	if err != nil {
 		if err == os.ErrExist {
 			err = errLocked
 		}
 		return nil, err
 	}
+	if ingestIncomplete(path) {
+		lock.unlock()
+		return nil, errIngestIncomplete
+	}
 
 	infoFile, err := newFile(path, 1, _FileDesc{fileType: typeInfo})
 	if err != nil {
@@ -76,43 +84,95 @@ func Open(path string, opts ...Options) (*DB, error) {
 		maxExpDurations:     maxExpDur,
 		backgroundKeyExpiry: options.flags.backgroundKeyExpiry,
 	}
-	winFile, err := newFile(path, 1, _FileDesc{fileType: typeTimeWindow})
-	if err != nil {
-		return nil, err
-	}
+	newDB := infoFile.currSize() == 0
+	var winFile, indexFile, dataFile _FileSet
+	if (newDB && options.singleFileSize > 0) || singleFileExists(path) {
+		winFile, indexFile, dataFile, err = newSingleFile(path, options.singleFileSize)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		winFile, err = newFile(path, 1, _FileDesc{fileType: typeTimeWindow})
+		if err != nil {
+			return nil, err
+		}
 
-	indexFile, err := newFile(path, 1, _FileDesc{fileType: typeIndex})
-	if err != nil {
-		return nil, err
-	}
+		indexFile, err = newFile(path, 1, _FileDesc{fileType: typeIndex})
+		if err != nil {
+			return nil, err
+		}
 
-	dataFile, err := newFile(path, 1, _FileDesc{fileType: typeData})
-	if err != nil {
-		return nil, err
+		dataFile, err = newFile(path, 1, _FileDesc{fileType: typeData})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	dbInfo := _DBInfo{}
-	if infoFile.currSize() == 0 {
+	if newDB {
 		dbInfo = _DBInfo{
 			header: _Header{
 				signature: signature,
 				version:   version,
 			},
 		}
-		if _, err = infoFile.extend(fixed); err != nil {
-			return nil, err
-		}
-		if err := infoFile.writeMarshalableAt(dbInfo, 0); err != nil {
+		if err := writeInfo(infoFile._File, &dbInfo); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := infoFile.readUnmarshalableAt(&dbInfo, fixed, 0); err != nil {
+	if dbInfo, err = readInfo(infoFile._File); err != nil {
 		logger.Error().Err(err).Str("context", "db.readHeader")
 		return nil, err
 	}
-	if !bytes.Equal(dbInfo.header.signature[:], signature[:]) {
-		return nil, errCorrupted
+	// window blocks written after the last sync are not committed, these are truncated so
+	// chains of window blocks are never observed half-written.
+	if winSize := int64(dbInfo.winBlocks) * int64(blockSize); winSize != 0 && winFile.currSize() > winSize {
+		if err := winFile.truncate(winSize); err != nil {
+			return nil, err
+		}
+	}
+	metadata, err := openMetadata(infoFile._File, newDB, options.metadata)
+	if err != nil {
+		return nil, err
+	}
+	quotas, err := newQuotas(path, options)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := newCatalog(path, options.flags.declaredTopics, options.topicSeparator)
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := newContracts(path)
+	if err != nil {
+		return nil, err
+	}
+	contractStats, err := newContractStats(path)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := newRetention(path)
+	if err != nil {
+		return nil, err
+	}
+	tombstones, err := newTombstones(path, options.tombstoneRetention)
+	if err != nil {
+		return nil, err
+	}
+	names, err := newTopicNames(path)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := newTopicAliases(path)
+	if err != nil {
+		return nil, err
+	}
+	var recorder *_Recorder
+	if options.recorderPath != "" {
+		if recorder, err = newRecorder(options.recorderPath, options.recorderSampleRate); err != nil {
+			return nil, err
+		}
 	}
 
 	leaseFile, err := newFile(path, 1, _FileDesc{fileType: typeLease})
@@ -120,6 +180,7 @@ func Open(path string, opts ...Options) (*DB, error) {
 		return nil, err
 	}
 	lease := newLease(leaseFile, options.freeBlockSize)
+	lease.secure = options.flags.secureDelete
 
 	filterFile, err := newFile(path, 1, _FileDesc{fileType: typeFilter})
 	if err != nil {
@@ -129,44 +190,103 @@ func Open(path string, opts ...Options) (*DB, error) {
 	fileset := &_FileSet{mu: new(sync.RWMutex), list: []_FileSet{infoFile, winFile, indexFile, dataFile, leaseFile, filterFile}}
 	internal := &_DB{
 		mutex: newMutex(),
+		path:  path,
 		start: time.Now(),
 		meter: NewMeter(),
+		ttls:  newTTLHistogram(),
+
+		hotTopics: newHotTopics(options.hotTopicsInterval),
+		watchers:  newWatchers(),
+
+		queryCache: newQueryCache(options.queryCacheSize, options.queryCacheTTL),
+
+		tombstones: tombstones,
+		quotas:     quotas,
+		catalog:    catalog,
+		contracts:  contracts,
+		retention:  retention,
+		names:      names,
+		aliases:    aliases,
+		checkpoint: newTrieCheckpoint(path),
+		recorder:   recorder,
 
-		dbInfo: dbInfo,
+		contractStats: contractStats,
+
+		count: newCounter(dbInfo.count),
+
+		dbInfo:   dbInfo,
+		metadata: metadata,
 
 		bufPool: bpool.NewBufferPool(options.bufferSize, &bpool.Options{MaxElapsedTime: 10 * time.Second}),
 
 		info:     infoFile,
-		filter:   Filter{file: filterFile, filterBlock: fltr.NewFilterGenerator()},
+		filter:   Filter{file: filterFile, filterBlock: fltr.NewFilterGenerator(), window: options.filterWindow, genPath: generationsPath(path)},
 		freeList: lease,
 
 		timeWindow: newTimeWindowBucket(timeOptions),
+		readEpochs: newReadEpochs(),
 
 		// Trie
-		trie: newTrie(),
+		trie: newTrie(options.topicSeparator, options.negativeLookupTTL),
 
 		// Block reader
 		reader: newBlockReader(fileset),
 
 		// Sync Handler
-		syncLockC: make(chan struct{}, 1),
+		syncLock: newSyncLock(),
 
 		// Close
 		closeC: make(chan struct{}),
 	}
 
-	// Create a new MAC from the key.
-	if internal.mac, err = crypto.New(options.encryptionKey); err != nil {
+	// Load the filter generations written on close.
+	if err := internal.filter.loadGenerations(time.Now()); err != nil {
+		fileset.close()
+		lock.unlock()
 		return nil, err
 	}
 
+	// Reads of the files extended by sync are retried on EOF races with the concurrent extension.
+	if options.readRetries > 0 {
+		retry := &_ReadRetry{retries: options.readRetries, interval: options.readRetryInterval, counter: internal.meter.ReadRetries}
+		for _, f := range []_FileSet{winFile, indexFile, dataFile} {
+			f.readRetry = retry
+		}
+	}
+
+	// Retrieve the encryption key from the key provider.
+	if options.keyProvider != nil {
+		internal.keyCache = newKeyCache(options.keyProvider, options.keyID, options.keyRefreshInterval)
+		ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+		options.encryptionKey, err = internal.keyCache.get(ctx)
+		cancel()
+		if err != nil {
+			fileset.close()
+			lock.unlock()
+			return nil, err
+		}
+	}
+
+	// Open the keyring of data keys wrapped by the encryption key.
+	if internal.keyring, err = openKeyring(path, options.encryptionKey, newDB && options.flags.encryption && options.encryptor == nil); err != nil {
+		fileset.close()
+		lock.unlock()
+		return nil, err
+	}
+	internal.encryptor = options.encryptor
+	if internal.encryptor == nil {
+		internal.encryptor = _KeyringEncryptor{keyring: internal.keyring}
+	}
+
 	// set encryption flag to encrypt messages.
 	if options.flags.encryption {
 		internal.dbInfo.encryption = 1
 	}
 
 	// Create a blockcache.
-	memdb, err := memdb.Open(memdb.WithLogFilePath(path), memdb.WithMemdbSize(options.memdbSize), memdb.WithBufferSize(options.bufferSize))
+	memdb, err := memdb.Open(memdb.WithLogFilePath(path), memdb.WithMemdbSize(options.memdbSize), memdb.WithBufferSize(options.bufferSize),
+		memdb.WithLogArchivePath(options.walArchivePath), memdb.WithLogRestoreTime(options.restoreTime), memdb.WithTimeBlockInterval(options.timeBlockDuration),
+		memdb.WithLogInterval(options.logInterval))
 	if err != nil {
 		return nil, err
 	}
@@ -182,9 +302,16 @@ func Open(path string, opts ...Options) (*DB, error) {
 
 		internal: internal,
 	}
+	db.countFiles(1)
 
-	if err := db.loadTrie(); err != nil {
-		logger.Error().Err(err).Str("context", "db.loadTrie")
+	if ok, err := db.loadTrieCheckpoint(); !ok {
+		if err != nil {
+			logger.Error().Err(err).Str("context", "db.loadTrieCheckpoint")
+		}
+		db.internal.checkpoint.reset()
+		if err := db.loadTrie(); err != nil {
+			logger.Error().Err(err).Str("context", "db.loadTrie")
+		}
 	}
 
 	// Read freeList.
@@ -193,16 +320,53 @@ func Open(path string, opts ...Options) (*DB, error) {
 		return nil, err
 	}
 
-	if err := db.recoverLog(); err != nil {
+	_, span := db.startSpan(context.Background(), spanRecover)
+	err = db.recoverLog()
+	endSpan(span, err)
+	if err != nil {
 		// if unable to recover db then close db.
 		panic(fmt.Sprintf("Unable to recover db on sync error %v. Closing db...", err))
 	}
 
+	if err := db.loadTopicNames(); err != nil {
+		logger.Error().Err(err).Str("context", "db.loadTopicNames")
+	}
+	if err := db.loadTopicAliases(); err != nil {
+		logger.Error().Err(err).Str("context", "db.loadTopicAliases")
+	}
+
+	if err := db.checkConsistency(); err != nil {
+		logger.Error().Err(err).Str("context", "db.checkConsistency").Msg("unable to check header counters against index and data files")
+	}
+
 	db.internal.syncHandle = _SyncHandle{DB: db}
 	db.startSyncer(options.syncDurationType * time.Duration(options.maxSyncDurations))
+	db.startRetention(retentionInterval)
+	if options.abortTimeout > 0 {
+		db.startAborter(options.abortTimeout)
+	}
+	if options.replicationAddr != "" {
+		if err := db.startReplication(options.replicationAddr); err != nil {
+			db.close()
+			return nil, err
+		}
+	}
+	if options.replicaOf != "" {
+		atomic.StoreUint64(&db.internal.appliedSeq, db.seq())
+		db.startReplica(options.replicaOf)
+	}
+
+	if db.internal.keyCache != nil && db.opts.keyRefreshInterval > 0 {
+		db.startKeyRefresher(db.opts.keyRefreshInterval)
+	}
 
 	if db.opts.flags.backgroundKeyExpiry {
-		db.startExpirer(time.Minute, maxExpDur)
+		if db.opts.ttlJitter > 0 {
+			// smear expiry processing across the expiry window.
+			db.startExpirer(time.Minute/expirySmearFactor, maxExpDur)
+		} else {
+			db.startExpirer(time.Minute, maxExpDur)
+		}
 	}
 
 	return db, nil
@@ -217,113 +381,201 @@ func (db *DB) Close() error {
 	return nil
 }
 
-// Get return items matching the query paramater.
+// Get return items matching the query paramater. The default query limit is applied if
+// the query does not specify a limit and the limit is capped to the max query limit,
+// the applied limit is set to the Limit of the query.
 func (db *DB) Get(q *Query) (items [][]byte, err error) {
-	if err := db.ok(); err != nil {
+	return db.GetContext(context.Background(), q)
+}
+
+// GetContext is Get with a context, the span of the Get is started as a child of the span in the context.
+func (db *DB) GetContext(ctx context.Context, q *Query) (items [][]byte, err error) {
+	_, span := db.startSpan(ctx, spanGet)
+	span.SetAttribute("unitdb.topic", string(q.Topic))
+	defer func() {
+		span.SetAttribute("unitdb.contract", q.Contract)
+		span.SetAttribute("unitdb.limit", q.Limit)
+		span.SetAttribute("unitdb.items", len(items))
+		endSpan(span, err)
+	}()
+	return db.get(q)
+}
+
+func (db *DB) get(q *Query) (items [][]byte, err error) {
+	// the cutoff of the query set using WithRange is part of the cache key, the cutoff of the "last" option is not.
+	from := q.internal.cutoff
+	if err := db.parseQuery(q); err != nil {
 		return nil, err
 	}
-	switch {
-	case len(q.Topic) == 0:
-		return nil, errTopicEmpty
-	case len(q.Topic) > maxTopicLength:
-		return nil, errTopicTooLarge
-	}
-	// // CPU profiling by default
-	// defer profile.Start().Stop()
-	q.internal.opts = &_QueryOptions{defaultQueryLimit: db.opts.queryOptions.defaultQueryLimit, maxQueryLimit: db.opts.queryOptions.maxQueryLimit}
-	if err := q.parse(); err != nil {
-		return nil, err
+	db.internal.recorder.add(recordGet, q.Contract, q.Topic, q.Limit)
+	key, cached := q.cacheKey(from)
+	cached = cached && db.internal.queryCache != nil
+	if !cached {
+		items, _, err = db.getItems(q)
+		return items, err
+	}
+	if items, lastSeq, ok := db.internal.queryCache.get(key); ok {
+		q.internal.lastSeq = lastSeq
+		db.internal.meter.QueryCacheHits.Inc(1)
+		db.internal.meter.Gets.Inc(int64(len(items)))
+		db.internal.hotTopics.add(q.Contract, q.Topic, false)
+		db.internal.meter.OutMsgs.Inc(int64(len(items)))
+		return items, nil
+	}
+	db.internal.meter.QueryCacheMisses.Inc(1)
+	gen := db.internal.queryCache.generation()
+	items, topics, err := db.getItems(q)
+	if err != nil {
+		return items, err
+	}
+	cache := make([][]byte, len(items))
+	for i, item := range items {
+		cache[i] = append([]byte(nil), item...)
 	}
+	db.internal.queryCache.put(gen, key, cache, q.internal.lastSeq, topics, q.internal.topicType == message.TopicWildcard || q.internal.regex)
+	return items, nil
+}
+
+// getItems reads the items of the parsed query and returns the topics the query read.
+func (db *DB) getItems(q *Query) (items [][]byte, topics _Topics, err error) {
 	mu := db.internal.mutex.getMutex(q.internal.prefix)
 	mu.RLock()
 	defer mu.RUnlock()
-	db.lookup(q)
+	topics = db.lookup(q)
 	if len(q.internal.winEntries) == 0 {
 		return
 	}
-	sort.Slice(q.internal.winEntries[:], func(i, j int) bool {
-		return q.internal.winEntries[i].seq > q.internal.winEntries[j].seq
-	})
-	start := 0
-	limit := q.Limit
-	if len(q.internal.winEntries) < int(q.Limit) {
-		limit = len(q.internal.winEntries)
+	q.internal.sortEntries()
+	scanned := 0
+	for _, query := range q.internal.winEntries {
+		if len(items) == q.Limit {
+			break
+		}
+		scanned++
+		if query.seq == 0 {
+			continue
+		}
+		// the cursor is past the entries skipped on read, so the next page does not read these again.
+		q.internal.lastSeq = query.seq
+		item, ok, err := db.readItem(q, query)
+		if err != nil {
+			return items, topics, err
+		}
+		if !ok {
+			continue
+		}
+		items = append(items, item.val)
+	}
+	if len(items) < q.Limit && scanned == len(q.internal.winEntries) && !q.internal.truncated {
+		// last page of results, no cursor to the next page.
+		q.internal.lastSeq = 0
 	}
+	db.internal.meter.Gets.Inc(int64(len(items)))
+	db.internal.hotTopics.add(q.Contract, q.Topic, false)
+	db.internal.meter.OutMsgs.Inc(int64(len(items)))
+	return items, topics, nil
+}
 
-	for {
-		invalidCount := 0
-		for _, query := range q.internal.winEntries[start:limit] {
-			err = func() error {
-				if query.seq == 0 {
-					return nil
-				}
-				s, err := db.readEntry(query)
-				if err != nil {
-					if err == errMsgIDDeleted {
-						invalidCount++
-						return nil
-					}
-					logger.Error().Err(err).Str("context", "db.readEntry")
-					return err
-				}
-				id, val, err := db.internal.reader.readMessage(s)
-				if err != nil {
-					logger.Error().Err(err).Str("context", "data.readMessage")
-					return err
-				}
-				msgID := message.ID(id)
-				if !msgID.EvalPrefix(q.Contract, q.internal.cutoff) {
-					invalidCount++
-					return nil
-				}
-
-				// last bit of ID is an encryption flag.
-				if uint8(id[idSize-1]) == 1 {
-					val, err = db.internal.mac.Decrypt(nil, val)
-					if err != nil {
-						logger.Error().Err(err).Str("context", "mac.decrypt")
-						return err
-					}
-				}
-				var buffer []byte
-				val, err = snappy.Decode(buffer, val)
-				if err != nil {
-					logger.Error().Err(err).Str("context", "snappy.Decode")
-					return err
-				}
-				items = append(items, val)
-				db.internal.meter.OutBytes.Inc(int64(s.valueSize))
-				return nil
-			}()
-			if err != nil {
-				return items, err
-			}
-		}
+// MessageMetadata holds the metadata of a message returned by DB GetMetadata.
+type MessageMetadata struct {
+	ID        []byte    // The ID of the message.
+	Seq       uint64    // The sequence of the message.
+	Size      uint32    // The size of the value of the message in the data file, that is after compression and encryption.
+	StoredAt  time.Time // The time the message was stored.
+	ExpiresAt time.Time // The expiry time of the message, zero if the message does not expire.
+}
 
-		if invalidCount == 0 || len(items) == int(q.Limit) || len(q.internal.winEntries) == limit {
+// GetMetadata returns metadata of the messages matching the query in the order of the query without reading
+// payloads of the messages from the data file. The limit and the cursor of the query are applied as in DB Get.
+func (db *DB) GetMetadata(q *Query) (metas []MessageMetadata, err error) {
+	if err := db.parseQuery(q); err != nil {
+		return nil, err
+	}
+	mu := db.internal.mutex.getMutex(q.internal.prefix)
+	mu.RLock()
+	defer mu.RUnlock()
+	db.lookup(q)
+	q.internal.sortEntries()
+	scanned := 0
+	for _, query := range q.internal.winEntries {
+		if len(metas) == q.Limit {
 			break
 		}
-
-		if len(q.internal.winEntries) <= int(q.Limit+invalidCount) {
-			start = limit
-			limit = len(q.internal.winEntries)
-		} else {
-			start = limit
-			limit = limit + invalidCount
+		scanned++
+		if query.seq == 0 {
+			continue
+		}
+		q.internal.lastSeq = query.seq
+		m, ok, err := db.readMetadata(q, query)
+		if err != nil {
+			return metas, err
 		}
+		if !ok {
+			continue
+		}
+		metas = append(metas, m)
 	}
-	db.internal.meter.Gets.Inc(int64(len(items)))
-	db.internal.meter.OutMsgs.Inc(int64(len(items)))
-	return items, nil
+	if len(metas) < q.Limit && scanned == len(q.internal.winEntries) && !q.internal.truncated {
+		// last page of results, no cursor to the next page.
+		q.internal.lastSeq = 0
+	}
+	db.internal.meter.Gets.Inc(int64(len(metas)))
+	return metas, nil
 }
 
-// NewContract generates a new Contract.
-func (db *DB) NewContract() (uint32, error) {
-	raw := make([]byte, 4)
-	rand.Read(raw)
+// GetByID returns payload of the message with the ID without knowing its topic. The sequence of the
+// message is part of its ID, so the message is resolved from the index file. The query authorizer if set
+// is invoked using the contract of the message and a nil topic.
+func (db *DB) GetByID(id []byte) ([]byte, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	storedID, val, err := db.readID(id, OpGet)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err = db.decodeValue(storedID, val)
+	if err != nil {
+		return nil, err
+	}
+	db.internal.meter.Gets.Inc(1)
+	db.internal.meter.OutMsgs.Inc(1)
+	return val, nil
+}
+
+// Epoch returns the current epoch of the DB, that is the sequence of the most recent entry.
+// Query AsOf the epoch excludes entries put after Epoch returns.
+func (db *DB) Epoch() uint64 {
+	return db.seq()
+}
 
-	contract := uint32(binary.LittleEndian.Uint32(raw[:4]))
-	return contract, nil
+// NewContract generates a new Contract and records it along with its creation time and the name set
+// using WithContractName option, see Contracts.
+func (db *DB) NewContract(opts ...Options) (uint32, error) {
+	if err := db.ok(); err != nil {
+		return 0, err
+	}
+	o := &_Options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(o)
+		}
+	}
+	raw := make([]byte, 4)
+	for {
+		rand.Read(raw)
+		contract := uint32(binary.LittleEndian.Uint32(raw[:4]))
+		if contract == 0 || contract == message.MasterContract {
+			continue
+		}
+		ok, err := db.internal.contracts.add(ContractInfo{Contract: contract, Name: o.contractOptions.name, CreatedAt: time.Now()})
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return contract, nil
+		}
+	}
 }
 
 // NewID generates new ID that is later used to put entry or delete entry.
@@ -336,13 +588,34 @@ func (db *DB) NewID() []byte {
 // It is safe to modify the contents of the argument after Put returns but not
 // before.
 func (db *DB) Put(topic, payload []byte) error {
-	return db.PutEntry(NewEntry(topic, payload))
+	return db.PutEntryContext(context.Background(), NewEntry(topic, payload))
+}
+
+// PutContext is Put with a context, the span of the Put is started as a child of the span in the context.
+func (db *DB) PutContext(ctx context.Context, topic, payload []byte) error {
+	return db.PutEntryContext(ctx, NewEntry(topic, payload))
 }
 
 // PutEntry puts entry into the DB, if Contract is not specified then it uses master Contract.
 // It is safe to modify the contents of the argument after PutEntry returns but not
 // before.
 func (db *DB) PutEntry(e *Entry) error {
+	return db.PutEntryContext(context.Background(), e)
+}
+
+// PutEntryContext is PutEntry with a context, the span of the Put is started as a child of the span in the context.
+func (db *DB) PutEntryContext(ctx context.Context, e *Entry) (err error) {
+	_, span := db.startSpan(ctx, spanPut)
+	span.SetAttribute("unitdb.topic", string(e.Topic))
+	span.SetAttribute("unitdb.contract", e.Contract)
+	span.SetAttribute("unitdb.size", len(e.Payload))
+	defer func() {
+		endSpan(span, err)
+	}()
+	return db.putEntry(e)
+}
+
+func (db *DB) putEntry(e *Entry) error {
 	if err := db.ok(); err != nil {
 		return err
 	}
@@ -357,28 +630,28 @@ func (db *DB) PutEntry(e *Entry) error {
 	case len(e.Payload) > maxValueLength:
 		return errValueTooLarge
 	}
-
-	if err := db.setEntry(e); err != nil {
+	if err := db.authorize(e.Contract, e.Topic, OpPut); err != nil {
 		return err
 	}
-
-	timeID, err := db.internal.mem.Put(e.entry.seq, e.entry.cache)
-	if err != nil {
+	// entry is dropped if it is a duplicate within the dedup window of the topic.
+	if ok, err := db.applyTopic(e); !ok || err != nil {
 		return err
 	}
 
-	if ok := db.internal.timeWindow.add(timeID, e.entry.topicHash, newWinEntry(e.entry.seq, e.entry.expiresAt)); !ok {
-		return errForbidden
+	size := len(e.Payload)
+	if db.opts.chunkSize > 0 && size > db.opts.chunkSize {
+		if err := db.putChunks(e); err != nil {
+			return err
+		}
 	}
-
-	if e.entry.topicSize != 0 {
-		t := new(message.Topic)
-		rawTopic := e.entry.cache[entrySize+idSize : entrySize+idSize+e.entry.topicSize]
-		t.Unmarshal(rawTopic)
-		db.internal.trie.add(newTopic(e.entry.topicHash, 0), t.Parts, t.Depth)
+	if err := db.writeEntry(e); err != nil {
+		return err
 	}
 
 	db.internal.meter.Puts.Inc(1)
+	db.internal.hotTopics.add(e.Contract, e.Topic, true)
+	db.internal.recorder.add(recordPut, e.Contract, e.Topic, size)
+	db.notify(e.entry, e.entry.cache, e.Topic, contentHeaders(e.Compression, e.Headers))
 
 	// reset message entry.
 	e.reset()
@@ -399,6 +672,8 @@ func (db *DB) DeleteEntry(e *Entry) error {
 	switch {
 	case db.opts.flags.immutable:
 		return errImmutable
+	case db.opts.replicaOf != "":
+		return errReplica
 	case len(e.ID) == 0:
 		return errMsgIDEmpty
 	case len(e.Topic) == 0:
@@ -406,23 +681,98 @@ func (db *DB) DeleteEntry(e *Entry) error {
 	case len(e.Topic) > maxTopicLength:
 		return errTopicTooLarge
 	}
-	id := message.ID(e.ID)
-	topic, _, err := db.parseTopic(e.Contract, e.Topic)
-	if err != nil {
+	if err := db.authorize(e.Contract, e.Topic, OpDelete); err != nil {
 		return err
 	}
+	id := message.ID(e.ID)
 	if e.Contract == 0 {
 		e.Contract = message.MasterContract
 	}
+	topic, _, err := db.parseTopic(e.Contract, e.Topic)
+	if err != nil {
+		return err
+	}
 	topic.AddContract(e.Contract)
 
+	if db.opts.chunkSize > 0 {
+		if err := db.deleteChunks(id.Sequence()); err != nil {
+			return err
+		}
+	}
 	if err := db.delete(topic.GetHash(e.Contract), message.ID(id).Sequence()); err != nil {
 		return err
 	}
+	db.internal.recorder.add(recordDelete, e.Contract, e.Topic, 0)
 
 	return nil
 }
 
+// DeleteByID deletes the message with the ID without knowing its topic. The query authorizer if set
+// is invoked using the contract of the message and a nil topic.
+func (db *DB) DeleteByID(id []byte) error {
+	if db.opts.flags.immutable {
+		return errImmutable
+	}
+	if db.opts.replicaOf != "" {
+		return errReplica
+	}
+	if _, _, err := db.readID(id, OpDelete); err != nil {
+		return err
+	}
+	seq := message.ID(id).Sequence()
+	if err := db.deleteChunks(seq); err != nil {
+		return err
+	}
+	return db.delete(0, seq)
+}
+
+// DeleteTopic deletes all messages of the topic and removes the topic from the DB.
+func (db *DB) DeleteTopic(topic []byte) error {
+	return db.DeleteTopicEntry(NewEntry(topic, nil))
+}
+
+// DeleteTopicEntry deletes all messages of the entry topic under the entry contract and removes the
+// topic from the DB. Messages not yet synced are deleted from the memdb, the window blocks of the topic
+// are cleared and data of the messages is freed for reuse.
+//
+// Messages put to the topic concurrently with DeleteTopicEntry may not be deleted.
+func (db *DB) DeleteTopicEntry(e *Entry) error {
+	topicHash, err := db.parseDeleteTopic(e)
+	if err != nil {
+		return err
+	}
+
+	// window blocks are rewritten, so the topic is deleted under the sync lock.
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+
+	return db.deleteTopic(topicHash)
+}
+
+// DeleteRange deletes messages of the topic stored between from and to.
+// A zero from or to leaves that end of the range open.
+func (db *DB) DeleteRange(topic []byte, from, to time.Time) error {
+	return db.DeleteRangeEntry(NewEntry(topic, nil), from, to)
+}
+
+// DeleteRangeEntry deletes messages of the entry topic under the entry contract stored between from
+// and to. A zero from or to leaves that end of the range open. The first message of a new topic
+// packs the topic, it is not deleted until it is synced.
+func (db *DB) DeleteRangeEntry(e *Entry, from, to time.Time) error {
+	topicHash, err := db.parseDeleteTopic(e)
+	if err != nil {
+		return err
+	}
+	var cutoff, until int64
+	if !from.IsZero() {
+		cutoff = from.Unix()
+	}
+	if !to.IsZero() {
+		until = to.Unix()
+	}
+	return db.deleteRange(topicHash, e.Contract, cutoff, until)
+}
+
 // Batch executes a function within the context of a read-write managed transaction.
 // If no error is returned from the function then the transaction is written.
 // If an error is returned then the entire transaction is rolled back.
@@ -437,6 +787,7 @@ func (db *DB) Batch(fn func(*Batch, <-chan struct{}) error) error {
 
 	// If an error is returned from the function then rollback and return error.
 	if err := fn(b, b.commitComplete); err != nil {
+		b.unsetManaged()
 		b.Abort()
 		close(b.commitComplete)
 		return err
@@ -445,22 +796,60 @@ func (db *DB) Batch(fn func(*Batch, <-chan struct{}) error) error {
 	return b.Commit()
 }
 
+// AbortTimeID aborts the time ID of a batch written but not committed. Entries of the time ID are removed
+// from the mem store and the time window and its write ahead logs are released. It returns an error if the
+// time ID is not of an uncommitted batch. Use Stats to get the uncommitted time IDs.
+func (db *DB) AbortTimeID(timeID int64) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	n, err := db.internal.mem.Abort(timeID)
+	if err != nil {
+		return errTimeIDNotFound
+	}
+	db.internal.timeWindow.abort(timeID)
+	logger.Warn().Str("context", "db.AbortTimeID").Int64("timeID", timeID).Int("entries", n).Msg("uncommitted time ID aborted")
+
+	return nil
+}
+
 // Sync syncs entries into DB. Sync happens synchronously.
 // Sync write window entries into summary file and write index, and data to respective index and data files.
 // In case of any error during sync operation recovery is performed on log file (write ahead log).
 func (db *DB) Sync() error {
+	return db.SyncContext(context.Background())
+}
+
+// SyncContext is Sync with a context, the span of the Sync is started as a child of the span in the context.
+func (db *DB) SyncContext(ctx context.Context) error {
+	db.internal.recorder.add(recordSync, 0, nil, 0)
+	return db.syncContext(ctx)
+}
+
+// syncContext syncs entries into DB, it is used by the background syncer so background syncs are traced but not recorded.
+func (db *DB) syncContext(ctx context.Context) (err error) {
 	// start := time.Now()
 	if ok := db.internal.syncHandle.status(); ok {
 		// sync is in-progress.
 		return nil
 	}
 
-	// Sync happens synchronously.
-	db.internal.syncLockC <- struct{}{}
+	_, span := db.startSpan(ctx, spanSync)
+	span.SetAttribute("unitdb.unsynced", atomic.LoadInt64(&db.internal.inFlight.unsynced))
+	span.SetAttribute("unitdb.wal_size", db.internal.mem.LogSize())
 	defer func() {
-		<-db.internal.syncLockC
+		endSpan(span, err)
 	}()
 
+	// Sync happens synchronously.
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+
+	return db.syncLocked()
+}
+
+// syncLocked syncs entries into DB, the caller must hold the sync lock.
+func (db *DB) syncLocked() error {
 	if ok := db.internal.syncHandle.startSync(); !ok {
 		return nil
 	}
@@ -470,6 +859,24 @@ func (db *DB) Sync() error {
 	return db.internal.syncHandle.Sync()
 }
 
+// RotateKey rotates the encryption key. Messages are encrypted using data keys wrapped by the
+// encryption key, so only the data keys are re-wrapped and the payloads are not rewritten.
+// A new data key is used to encrypt messages written after the rotation. The progress func
+// if not nil is called after each data key is re-wrapped.
+//
+// The rotated keyring replaces the previous keyring atomically, the DB must be opened
+// using the new encryption key after RotateKey returns. Keys of the encryptor set on DB
+// are rotated by the encryptor and RotateKey returns an error.
+func (db *DB) RotateKey(newKey []byte, progress func(done, total int)) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	if db.opts.encryptor != nil {
+		return errBadRequest
+	}
+	return db.internal.keyring.rotate(newKey, progress)
+}
+
 // FileSize returns the total size of the disk storage used by the DB.
 func (db *DB) FileSize() (int64, error) {
 	return db.fs.size()
@@ -477,5 +884,5 @@ func (db *DB) FileSize() (int64, error) {
 
 // Count returns the number of items in the DB.
 func (db *DB) Count() uint64 {
-	return atomic.LoadUint64(&db.internal.dbInfo.count)
+	return db.internal.count.load()
 }
@@ -17,12 +17,27 @@
 package unitdb
 
 import (
+	"bytes"
 	"encoding/binary"
+	"hash/crc32"
 )
 
 var (
 	signature = [7]byte{'u', 'n', 'i', 't', 'd', 'b', '\x0e'}
-	fixed     = uint32(32)
+	fixed     = uint32(64)
+
+	// legacyFixed is the size of the single header written by earlier versions.
+	legacyFixed = uint32(32)
+)
+
+// The header is written into two header slots alternately (ping-pong), so a crash in the middle
+// of a header write leaves the previous header intact. Each header carries a monotonically increasing
+// epoch and a checksum, the newest valid header is selected on open.
+const (
+	nInfoSlots     = 2
+	infoEpochOff   = 32
+	infoCheckOff   = 40
+	infoChecksumSz = 4
 )
 
 type (
@@ -35,6 +50,11 @@ type (
 		encryption int8
 		sequence   uint64
 		count      uint64
+		// winBlocks is the number of window blocks committed by the last sync.
+		winBlocks uint32
+
+		// epoch is incremented on each header write.
+		epoch uint64
 	}
 )
 
@@ -43,9 +63,12 @@ func (inf _DBInfo) MarshalBinary() ([]byte, error) {
 	buf := make([]byte, fixed)
 	copy(buf[:7], inf.header.signature[:])
 	binary.LittleEndian.PutUint32(buf[7:11], inf.header.version)
-	buf[12] = uint8(inf.encryption)
+	buf[11] = uint8(inf.encryption)
 	binary.LittleEndian.PutUint64(buf[12:20], inf.sequence)
 	binary.LittleEndian.PutUint64(buf[20:28], inf.count)
+	binary.LittleEndian.PutUint32(buf[28:32], inf.winBlocks)
+	binary.LittleEndian.PutUint64(buf[infoEpochOff:infoCheckOff], inf.epoch)
+	binary.LittleEndian.PutUint32(buf[infoCheckOff:infoCheckOff+infoChecksumSz], crc32.ChecksumIEEE(buf[:infoCheckOff]))
 
 	return buf, nil
 }
@@ -54,9 +77,73 @@ func (inf _DBInfo) MarshalBinary() ([]byte, error) {
 func (inf *_DBInfo) UnmarshalBinary(data []byte) error {
 	copy(inf.header.signature[:], data[:7])
 	inf.header.version = binary.LittleEndian.Uint32(data[7:11])
-	inf.encryption = int8(data[7])
+	inf.encryption = int8(data[11])
 	inf.sequence = binary.LittleEndian.Uint64(data[12:20])
 	inf.count = binary.LittleEndian.Uint64(data[20:28])
+	if len(data) < int(fixed) {
+		return nil
+	}
+	inf.winBlocks = binary.LittleEndian.Uint32(data[28:32])
+	inf.epoch = binary.LittleEndian.Uint64(data[infoEpochOff:infoCheckOff])
+	if crc32.ChecksumIEEE(data[:infoCheckOff]) != binary.LittleEndian.Uint32(data[infoCheckOff:infoCheckOff+infoChecksumSz]) {
+		return errCorrupted
+	}
 
 	return nil
 }
+
+// readInfo reads the newest valid header from the header slots. Header written by
+// earlier versions into a single slot without checksum is read if no valid header is found.
+func readInfo(f *_File) (_DBInfo, error) {
+	var inf _DBInfo
+	found := false
+	size := f.currSize()
+	for i := 0; i < nInfoSlots; i++ {
+		off := int64(i) * int64(fixed)
+		if off+int64(fixed) > size {
+			break
+		}
+		var slot _DBInfo
+		if err := f.readUnmarshalableAt(&slot, fixed, off); err != nil {
+			continue
+		}
+		if !bytes.Equal(slot.header.signature[:], signature[:]) {
+			continue
+		}
+		if !found || slot.epoch > inf.epoch {
+			inf = slot
+			found = true
+		}
+	}
+	if found {
+		return inf, nil
+	}
+
+	// read header written by earlier versions.
+	if size < int64(legacyFixed) {
+		return inf, errCorrupted
+	}
+	buf, err := f.slice(0, int64(legacyFixed))
+	if err != nil {
+		return inf, err
+	}
+	if err := inf.UnmarshalBinary(buf); err != nil {
+		return inf, err
+	}
+	if !bytes.Equal(inf.header.signature[:], signature[:]) {
+		return inf, errCorrupted
+	}
+	return inf, nil
+}
+
+// writeInfo writes the header into the header slot next to the slot of the current header.
+func writeInfo(f *_File, inf *_DBInfo) error {
+	if size := f.currSize(); size < int64(nInfoSlots)*int64(fixed) {
+		if _, err := f.extend(uint32(int64(nInfoSlots)*int64(fixed) - size)); err != nil {
+			return err
+		}
+	}
+	inf.epoch++
+	off := int64(inf.epoch%nInfoSlots) * int64(fixed)
+	return f.writeMarshalableAt(inf, off)
+}
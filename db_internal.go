@@ -17,19 +17,23 @@
 package unitdb
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
 	"math"
+	"math/rand"
+	"runtime"
 	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/golang/snappy"
 	"github.com/unit-io/bpool"
-	"github.com/unit-io/unitdb/crypto"
 	"github.com/unit-io/unitdb/memdb"
 	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/replication"
+	"github.com/unit-io/unitdb/uid"
 )
 
 const (
@@ -39,7 +43,7 @@ const (
 	nShards               = 27
 	nPoolSize             = 27
 	lockPostfix           = ".lock"
-	idSize                = 9 // message ID prefix with additional encryption bit.
+	idSize                = 9 // message ID prefix with additional encryption key id.
 	version               = 1 // file format version.
 
 	// maxExpDur expired keys are deleted from DB after durType*maxExpDur.
@@ -47,6 +51,13 @@ const (
 	// all expired keys are deleted from db in 1 minutes
 	maxExpDur = 1
 
+	// expirySmearFactor splits expiry processing of an expiry window into smaller batches
+	// run at shorter intervals if ttl jitter is set.
+	expirySmearFactor = 6
+
+	// expiryYieldInterval is number of expired entries processed before expiry checks to yield the sync lock to foreground sync.
+	expiryYieldInterval = 100
+
 	// maxWindowDur duration in hours to save summary of records to timewindow files
 	maxWindowDur = 24 * 7
 
@@ -70,13 +81,55 @@ type (
 	_DB struct {
 		mutex _Mutex
 
+		// path is the directory of the DB files.
+		path string
+
 		// The db start time.
 		start time.Time
 		// The metrics to measure timeseries on message events.
 		meter *Meter
+		// The histogram of ttls observed at write time.
+		ttls *_TTLHistogram
+		// The entries accepted but not yet synced to DB files.
+		inFlight _InFlight
+		// The per topic traffic to report hot topics.
+		hotTopics *_HotTopics
+		// The cache of query results set using WithQueryCache.
+		queryCache *_QueryCache
+		// The tombstones of deleted entries for time-travel queries.
+		tombstones *_Tombstones
+		// The stored bytes and quotas per contract.
+		quotas *_Quotas
+
+		// The topics declared using CreateTopic.
+		catalog *_Catalog
+		// The contracts created using NewContract.
+		contracts *_Contracts
+		// The storage statistics per contract.
+		contractStats *_ContractStats
+		// The retention policies set using SetRetention.
+		retention *_Retention
+		// The names of the topic parts of the trie.
+		names *_TopicNames
+		// The topic aliases set using AliasTopic.
+		aliases *_TopicAliases
+		// The checkpoint of the topics of the trie synced to the window file.
+		checkpoint *_TrieCheckpoint
+		// The workload recorder set using WithRecorder.
+		recorder *_Recorder
 
-		dbInfo _DBInfo
-		mac    *crypto.MAC
+		// The watchers of topics.
+		watchers *_Watchers
+
+		// The entry count, dbInfo holds the count as of the last header write.
+		count *_Counter
+
+		dbInfo   _DBInfo
+		metadata *_Metadata
+		keyring  *_Keyring
+		keyCache *_KeyCache
+		// The encryptor of message payloads, it uses keyring unless encryptor is set on DB.
+		encryptor Encryptor
 
 		mem      *memdb.DB
 		bufPool  *bpool.BufferPool
@@ -86,15 +139,26 @@ type (
 
 		timeWindow *_TimeWindowBucket
 
+		// The epochs of the readers of window block chains, see CompactTopic.
+		readEpochs *_ReadEpochs
+		// The window blocks reclaimed from compacted chains, guarded by the sync lock.
+		freeWinBlocks []int64
+
 		// Trie
 		trie *_Trie
 
 		// Block reader
 		reader *_BlockReader
 
+		// replication server if the DB is the leader.
+		replication *replication.Server
+		// appliedSeq is the sequence of the last entry applied from the leader if the DB is a follower.
+		appliedSeq uint64
+
 		// sync handler
-		syncLockC  chan struct{}
+		syncLock   *_SyncLock
 		syncWrites bool
+		freeze     _Freeze
 		syncHandle _SyncHandle
 
 		// Close.
@@ -113,10 +177,16 @@ func (db *DB) writeInfo() error {
 		},
 		encryption: db.internal.dbInfo.encryption,
 		sequence:   atomic.LoadUint64(&db.internal.dbInfo.sequence),
-		count:      atomic.LoadUint64(&db.internal.dbInfo.count),
+		count:      db.internal.count.load(),
+		winBlocks:  atomic.LoadUint32(&db.internal.dbInfo.winBlocks),
+		epoch:      db.internal.dbInfo.epoch,
 	}
+	if err := writeInfo(db.internal.info._File, &inf); err != nil {
+		return err
+	}
+	db.internal.dbInfo.epoch = inf.epoch
 
-	return db.internal.info.writeMarshalableAt(inf, 0)
+	return nil
 }
 
 // Close closes the DB.
@@ -124,12 +194,21 @@ func (db *DB) close() error {
 	if !db.setClosed() {
 		return errClosed
 	}
+	db.countFiles(-1)
 
 	// Signal all goroutines.
 	close(db.internal.closeC)
 
+	// Stop streaming to the followers.
+	if db.internal.replication != nil {
+		db.internal.replication.Stop()
+	}
+
+	// Thaw writes if frozen.
+	db.Thaw()
+
 	// Acquire lock.
-	db.internal.syncLockC <- struct{}{}
+	db.internal.syncLock.lock()
 
 	// Wait for all goroutines to exit.
 	db.internal.closeW.Wait()
@@ -137,9 +216,38 @@ func (db *DB) close() error {
 	// close memdb.
 	db.internal.mem.Close()
 
+	db.internal.watchers.closeAll()
+
 	if err := db.writeInfo(); err != nil {
 		return err
 	}
+	if err := db.internal.checkpoint.commit(db.internal.dbInfo.epoch, db.internal.trie, false); err != nil {
+		return err
+	}
+	if err := db.internal.quotas.write(); err != nil {
+		return err
+	}
+	if err := db.internal.contractStats.write(); err != nil {
+		return err
+	}
+	if err := db.internal.filter.writeGenerations(); err != nil {
+		return err
+	}
+	if err := db.internal.tombstones.close(); err != nil {
+		return err
+	}
+	if err := db.internal.names.close(); err != nil {
+		return err
+	}
+	if err := db.internal.aliases.close(); err != nil {
+		return err
+	}
+	if err := db.internal.recorder.close(); err != nil {
+		return err
+	}
+	if err := db.wipe(); err != nil {
+		return err
+	}
 	db.internal.freeList.defrag()
 	if err := db.internal.freeList.write(); err != nil {
 		return err
@@ -164,35 +272,81 @@ func (db *DB) close() error {
 	return err
 }
 
-// loadTopicHash loads topic and offset from window blocks on stored on disk.
+// loadTopicHash loads topic and offset from window blocks on stored on disk. The topics are read and
+// added to the trie by the goroutines of the shards of the topic hashes.
 func (db *DB) loadTrie() error {
+	type _Head struct {
+		startSeq  uint64
+		topicHash uint64
+		off       int64
+	}
+	nShards := runtime.GOMAXPROCS(0)
+	shards := make([]chan _Head, nShards)
+	errs := make(chan error, nShards)
+	var failed uint32
+	for i := range shards {
+		shards[i] = make(chan _Head, 64)
+		go func(heads <-chan _Head) {
+			var err error
+			for h := range heads {
+				if err != nil {
+					continue
+				}
+				if err = db.loadTopic(h.startSeq, h.topicHash, h.off); err != nil {
+					atomic.StoreUint32(&failed, 1)
+				}
+			}
+			errs <- err
+		}(shards[i])
+	}
 	r := newWindowReader(db.fs)
 	err := r.blockIterator(func(startSeq, topicHash uint64, off int64) (bool, error) {
-		e, err := db.internal.reader.readEntry(startSeq)
-		if err != nil {
-			return true, err
-		}
-		if e.topicSize == 0 {
-			return false, nil
-		}
-		rawtopic, err := db.internal.reader.readTopic(e)
-		if err != nil {
-			return true, err
-		}
-		t := new(message.Topic)
-		err = t.Unmarshal(rawtopic)
-		if err != nil {
-			return true, err
-		}
-		if ok := db.internal.trie.add(newTopic(topicHash, off), t.Parts, t.Depth); !ok {
-			logger.Info().Str("context", "db.loadTrie: topic exist in the trie")
-			return false, nil
+		if atomic.LoadUint32(&failed) == 1 {
+			return true, nil
 		}
+		shards[topicHash%uint64(nShards)] <- _Head{startSeq: startSeq, topicHash: topicHash, off: off}
 		return false, nil
 	})
+	for _, heads := range shards {
+		close(heads)
+	}
+	for range shards {
+		if err1 := <-errs; err1 != nil && err == nil {
+			err = err1
+		}
+	}
 	return err
 }
 
+// loadTopic reads the topic from the first entry of the topic and adds the topic to the trie.
+func (db *DB) loadTopic(startSeq, topicHash uint64, off int64) error {
+	e, err := db.internal.reader.readIndexEntry(startSeq)
+	if err == errMsgIDDeleted {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e.topicSize == 0 {
+		return nil
+	}
+	rawtopic, err := db.internal.reader.readTopic(e)
+	if err != nil {
+		return err
+	}
+	t := new(message.Topic)
+	err = t.Unmarshal(rawtopic)
+	if err != nil {
+		return err
+	}
+	if ok := db.internal.trie.add(newTopic(topicHash, off), t.Parts, t.Depth); !ok {
+		logger.Info().Str("context", "db.loadTrie: topic exist in the trie")
+		return nil
+	}
+	db.internal.checkpoint.set(topicHash, off)
+	return nil
+}
+
 func (db *DB) readEntry(q _Query) (_IndexEntry, error) {
 	data, _ := db.internal.mem.Get(q.seq)
 	if data != nil {
@@ -205,36 +359,339 @@ func (db *DB) readEntry(q _Query) (_IndexEntry, error) {
 
 			cache: data[entrySize:],
 		}
+		db.internal.meter.CacheHits.Inc(1)
 		return e, nil
 	}
 
+	db.internal.meter.CacheMisses.Inc(1)
 	return db.internal.reader.readEntry(q.seq)
 }
 
+// parseQuery validates and parses the query using the query options of the DB.
+func (db *DB) parseQuery(q *Query) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	switch {
+	case len(q.Topic) == 0:
+		return errTopicEmpty
+	case len(q.Topic) > maxTopicLength:
+		return errTopicTooLarge
+	}
+	if err := db.authorize(q.Contract, q.Topic, OpGet); err != nil {
+		return err
+	}
+	if err := db.checkDepth(q.Topic); err != nil {
+		return err
+	}
+	q.internal.opts = &_QueryOptions{defaultQueryLimit: db.opts.queryOptions.defaultQueryLimit, maxQueryLimit: db.opts.queryOptions.maxQueryLimit, separator: db.opts.topicSeparator}
+	return q.parse()
+}
+
+// readItem reads the message of the window entry and returns the decoded value. It returns
+// false if the message is deleted or does not match the contract or time range of the query.
+func (db *DB) readItem(q *Query, query _Query) (_Item, bool, error) {
+	var id, val []byte
+	s, err := db.readEntry(query)
+	// entry deleted before it is synced is neither in memdb nor in the index file.
+	deleted := err == errMsgIDDeleted || err == errEntryInvalid || err == io.EOF
+	if deleted && err != errMsgIDDeleted {
+		db.indexMiss(q, query.seq)
+	}
+	switch {
+	case deleted && q.internal.asOf > 0:
+		// entry deleted after the epoch of the query is read from its tombstone.
+		var ok bool
+		if id, val, ok = db.internal.tombstones.get(query.seq, q.internal.asOf); !ok {
+			return _Item{}, false, nil
+		}
+	case deleted:
+		return _Item{}, false, nil
+	case err != nil:
+		db.dataReadError(q)
+		logger.Error().Err(err).Str("context", "db.readEntry")
+		return _Item{}, false, err
+	default:
+		id, val, err = db.internal.reader.readMessage(s)
+		if err != nil {
+			db.dataReadError(q)
+			logger.Error().Err(err).Str("context", "data.readMessage")
+			return _Item{}, false, err
+		}
+	}
+	size := len(val)
+	msgID := message.ID(id)
+	if !msgID.EvalRange(q.Contract, q.internal.cutoff, q.internal.until) {
+		return _Item{}, false, nil
+	}
+
+	// last byte of ID is the encryption key id.
+	val, err = db.decrypt(uint8(id[idSize-1]), val)
+	if err != nil {
+		logger.Error().Err(err).Str("context", "db.decrypt")
+		return _Item{}, false, err
+	}
+	var codec Codec
+	if isChunked(val) {
+		val, codec, err = db.readChunks(val)
+		if err != nil {
+			db.dataReadError(q)
+			logger.Error().Err(err).Str("context", "db.readChunks")
+			return _Item{}, false, err
+		}
+	} else {
+		codec = valueCodec(val)
+		val, err = decompress(val)
+		if err != nil {
+			logger.Error().Err(err).Str("context", "db.decompress")
+			return _Item{}, false, err
+		}
+	}
+	db.internal.meter.OutBytes.Inc(int64(size))
+	return _Item{id: id, topicHash: query.topicHash, seq: query.seq, val: val, codec: codec}, true, nil
+}
+
+// readMetadata reads the ID of the entry and returns the metadata of the message. The value is
+// not read from the data file unless the entry is deleted and read from its tombstone.
+func (db *DB) readMetadata(q *Query, query _Query) (MessageMetadata, bool, error) {
+	var id []byte
+	var size uint32
+	s, err := db.readEntry(query)
+	deleted := err == errMsgIDDeleted || err == errEntryInvalid || err == io.EOF
+	if deleted && err != errMsgIDDeleted {
+		db.indexMiss(q, query.seq)
+	}
+	switch {
+	case deleted && q.internal.asOf > 0:
+		// entry deleted after the epoch of the query is read from its tombstone.
+		tid, val, ok := db.internal.tombstones.get(query.seq, q.internal.asOf)
+		if !ok {
+			return MessageMetadata{}, false, nil
+		}
+		id, size = tid, uint32(len(val))
+	case deleted:
+		return MessageMetadata{}, false, nil
+	case err != nil:
+		db.dataReadError(q)
+		logger.Error().Err(err).Str("context", "db.readEntry")
+		return MessageMetadata{}, false, err
+	default:
+		id, err = db.internal.reader.readMessageID(s)
+		if err != nil {
+			db.dataReadError(q)
+			logger.Error().Err(err).Str("context", "data.readMessageID")
+			return MessageMetadata{}, false, err
+		}
+		size = s.valueSize
+	}
+	if !message.ID(id).EvalRange(q.Contract, q.internal.cutoff, q.internal.until) {
+		return MessageMetadata{}, false, nil
+	}
+	msgID := make(message.ID, message.ID(nil).Size())
+	copy(msgID, id[:idSize-1])
+	binary.LittleEndian.PutUint64(msgID[8:16], query.seq)
+	m := MessageMetadata{
+		ID:       msgID,
+		Seq:      query.seq,
+		Size:     size,
+		StoredAt: time.Unix(uid.Time(msgID[0:4]), 0),
+	}
+	if query.expiresAt != 0 {
+		m.ExpiresAt = time.Unix(int64(query.expiresAt), 0)
+	}
+	return m, true, nil
+}
+
+// indexMiss counts the entry of the query found in the time window but missing in the index. The miss is
+// a filter false positive if the filter reports the entry present.
+func (db *DB) indexMiss(q *Query, seq uint64) {
+	d := q.internal.diagnostics
+	if db.internal.filter.Test(seq) {
+		db.internal.meter.FilterFalsePositives.Inc(1)
+		if d != nil {
+			d.FilterFalsePositives++
+		}
+		return
+	}
+	db.internal.meter.IndexMisses.Inc(1)
+	if d != nil {
+		d.IndexMisses++
+	}
+}
+
+// dataReadError counts the entry of the query failed to read from the index or the data file.
+func (db *DB) dataReadError(q *Query) {
+	db.internal.meter.DataReadErrors.Inc(1)
+	if q.internal.diagnostics != nil {
+		q.internal.diagnostics.DataReadErrors++
+	}
+}
+
 // lookups are performed in following order
 // ilookup lookups in memory entries from timeWindow
 // lookup lookups persisted entries from timeWindow file.
-func (db *DB) lookup(q *Query) error {
-	topics := db.internal.trie.lookup(q.internal.parts, q.internal.depth, q.internal.topicType)
+// The limit of the query does not apply to the lookup if order of the query is ascending.
+// It returns the topics matching the query.
+func (db *DB) lookup(q *Query) _Topics {
+	// chains are traversed in a read epoch, so blocks of the chains replaced by compaction are not reclaimed under the lookup.
+	epoch := db.internal.readEpochs.enter()
+	defer db.internal.readEpochs.exit(epoch)
+	topics := db.queryTopics(q)
 	sort.Slice(topics[:], func(i, j int) bool {
 		return topics[i].offset > topics[j].offset
 	})
+	q.internal.truncated = false
+	// bound is the sequence of the last entry read of the topics truncated by the limit. Entries
+	// past the bound in the order of the query are left to the next page, as the entries of the
+	// truncated topics in between are not read.
+	var bound uint64
+	filter := q.internal.filter()
 	for _, topic := range topics {
-		if len(q.internal.winEntries) > q.Limit {
-			break
+		if q.internal.order == OrderDesc {
+			wEntries := db.internal.timeWindow.lookup(db.fs, topic.hash, topic.offset, filter, q.Limit)
+			for _, we := range wEntries {
+				q.internal.winEntries = append(q.internal.winEntries, _Query{topicHash: topic.hash, seq: we.seq(), expiresAt: we.expiryTime()})
+			}
+			if len(wEntries) >= q.Limit {
+				q.internal.truncated = true
+				if seq := wEntries.minSeq(); seq > bound {
+					bound = seq
+				}
+			}
+			continue
 		}
-		limit := q.Limit - len(q.internal.winEntries)
-		wEntries := db.internal.timeWindow.lookup(db.fs, topic.hash, topic.offset, q.internal.cutoff, limit)
+		// the chain of the topic is read from the most recent entries to the cursor, and the oldest entries are kept.
+		wEntries := db.internal.timeWindow.lookup(db.fs, topic.hash, topic.offset, filter, math.MaxInt32)
+		var entries []_Query
 		for _, we := range wEntries {
-			q.internal.winEntries = append(q.internal.winEntries, _Query{topicHash: topic.hash, seq: we.seq()})
+			if we.seq() <= q.internal.after {
+				continue
+			}
+			entries = append(entries, _Query{topicHash: topic.hash, seq: we.seq(), expiresAt: we.expiryTime()})
+		}
+		if len(entries) > q.Limit {
+			sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+			entries = entries[:q.Limit]
+			q.internal.truncated = true
+			if seq := entries[q.Limit-1].seq; bound == 0 || seq < bound {
+				bound = seq
+			}
+		}
+		q.internal.winEntries = append(q.internal.winEntries, entries...)
+	}
+	if bound != 0 {
+		entries := q.internal.winEntries[:0]
+		for _, e := range q.internal.winEntries {
+			if (q.internal.order == OrderDesc && e.seq >= bound) || (q.internal.order == OrderAsc && e.seq <= bound) {
+				entries = append(entries, e)
+			}
 		}
+		q.internal.winEntries = entries
+	}
+
+	return topics
+}
+
+// queryTopics returns the topics matching the query. The topics matching a regex query are
+// authorized by their names, so the pattern does not give access to topics the caller cannot get.
+func (db *DB) queryTopics(q *Query) _Topics {
+	missing := db.internal.trie.missing
+	if missing == nil {
+		return db.authorizeTopics(q, db.matchTopics(q))
+	}
+	key, gen := q.lookupKey(), missing.generation()
+	if missing.has(q.Contract, key) {
+		db.internal.meter.NegativeLookupHits.Inc(1)
+		return nil
+	}
+	topics := db.matchTopics(q)
+	if len(topics) == 0 {
+		missing.add(gen, q.Contract, key)
 	}
+	return db.authorizeTopics(q, topics)
+}
+
+// matchTopics returns the topics in the trie matching the query.
+func (db *DB) matchTopics(q *Query) _Topics {
+	switch {
+	case q.internal.wildcard != nil:
+		return db.internal.trie.lookupWildcard(q.internal.parts, q.internal.wildcard, q.internal.depth)
+	case !q.internal.regex:
+		return db.internal.trie.lookup(q.internal.parts, q.internal.depth, q.internal.topicType)
+	}
+	return db.internal.trie.matchRegex(q.Contract, q.internal.patterns)
+}
 
+// authorizeTopics returns the topics matching a regex query the caller is authorized to get.
+func (db *DB) authorizeTopics(q *Query, topics _Topics) _Topics {
+	if !q.internal.regex || db.opts.queryAuthorizer == nil {
+		return topics
+	}
+	allowed := topics[:0]
+	for _, topic := range topics {
+		if _, name, ok := db.internal.trie.topicName(topic.hash); ok && db.authorize(q.Contract, name, OpGet) == nil {
+			allowed = append(allowed, topic)
+		}
+	}
+	return allowed
+}
+
+// authorize rejects the operations of revoked contracts and invokes the query authorizer if set. Master contract
+// is used if contract is not specified.
+func (db *DB) authorize(contract uint32, topic []byte, op Op) error {
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if db.internal.contracts.isRevoked(contract) {
+		return errContractRevoked
+	}
+	if db.opts.queryAuthorizer == nil {
+		return nil
+	}
+	return db.opts.queryAuthorizer(contract, topic, op)
+}
+
+// readID reads the stored ID and the value of the message with the ID and authorizes the operation using
+// the contract of the stored ID. The ID passed by the caller may carry the master contract if it is the ID
+// returned by NewID, so only the time prefix of the ID is matched.
+func (db *DB) readID(id []byte, op Op) (message.ID, []byte, error) {
+	if len(id) == 0 {
+		return nil, nil, errMsgIDEmpty
+	}
+	msgID := message.ID(id)
+	if len(id) != msgID.Size() || msgID.Sequence() == 0 {
+		return nil, nil, errBadRequest
+	}
+	s, err := db.readEntry(_Query{seq: msgID.Sequence()})
+	if err != nil {
+		return nil, nil, errMsgIDDoesNotExist
+	}
+	storedID, val, err := db.internal.reader.readMessage(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(storedID[:4], msgID[:4]) {
+		return nil, nil, errMsgIDDoesNotExist
+	}
+	if err := db.authorize(binary.LittleEndian.Uint32(storedID[4:8]), nil, op); err != nil {
+		return nil, nil, err
+	}
+	return storedID, val, nil
+}
+
+// checkDepth returns TopicDepthError if the topic is deeper than maximum topic depth.
+func (db *DB) checkDepth(topic []byte) error {
+	if depth := db.opts.topicSeparator.Depth(topic); depth > db.opts.maxTopicDepth {
+		return &TopicDepthError{Depth: depth, MaxDepth: db.opts.maxTopicDepth}
+	}
 	return nil
 }
 
 func (db *DB) parseTopic(contract uint32, topic []byte) (*message.Topic, uint32, error) {
-	t := new(message.Topic)
+	if err := db.checkDepth(topic); err != nil {
+		return nil, 0, err
+	}
+	t := &message.Topic{Separator: db.opts.topicSeparator}
 
 	//Parse the Key.
 	t.ParseKey(topic)
@@ -250,26 +707,67 @@ func (db *DB) parseTopic(contract uint32, topic []byte) (*message.Topic, uint32,
 	return t, 0, nil
 }
 
+// writeEntry writes the entry to the mem store and adds it to the time window and its topic to the trie.
+func (db *DB) writeEntry(e *Entry) error {
+	if err := db.setEntry(e); err != nil {
+		return err
+	}
+	if err := db.checkQuota(e.Contract, int64(len(e.entry.cache)-entrySize)); err != nil {
+		return err
+	}
+
+	timeID, err := db.internal.mem.Put(e.entry.seq, e.entry.cache)
+	if err != nil {
+		return err
+	}
+
+	if ok := db.internal.timeWindow.add(timeID, e.entry.topicHash, newWinEntry(e.entry.seq, e.entry.expiresAt)); !ok {
+		return errForbidden
+	}
+
+	added := false
+	if e.entry.topicSize != 0 {
+		t := new(message.Topic)
+		rawTopic := e.entry.cache[entrySize+idSize : entrySize+idSize+e.entry.topicSize]
+		t.Unmarshal(rawTopic)
+		if added = db.internal.trie.add(newTopic(e.entry.topicHash, 0), t.Parts, t.Depth); added {
+			db.addTopicName(e.Topic, t.Parts)
+		}
+	}
+	db.internal.queryCache.invalidate(e.entry.topicHash, added)
+	db.internal.inFlight.add(1, db.internal.meter.Unsynced)
+	return nil
+}
+
 func (db *DB) setEntry(e *Entry) error {
+	// entries of the follower are written by the leader only.
+	if db.opts.replicaOf != "" {
+		return errReplica
+	}
 	var id message.ID
-	var eBit uint8
+	var keyID uint8
 	var seq uint64
 	var rawTopic []byte
 	if !e.entry.parsed {
 		if e.Contract == 0 {
 			e.Contract = message.MasterContract
 		}
-		t, ttl, err := db.parseTopic(e.Contract, e.Topic)
+		// chunks are stored under the salted contract topic so queries of the topic do not match chunks.
+		salt := e.Contract
+		if e.entry.chunk {
+			salt = chunkContract(e.Contract)
+		}
+		t, ttl, err := db.parseTopic(salt, e.Topic)
 		if err != nil {
 			return err
 		}
 		if e.ExpiresAt == 0 && ttl > 0 {
 			e.ExpiresAt = ttl
 		}
-		t.AddContract(e.Contract)
-		e.entry.topicHash = t.GetHash(e.Contract)
+		t.AddContract(salt)
+		e.entry.topicHash = t.GetHash(salt)
 		// topic is packed if it is new topic entry
-		if _, ok := db.internal.trie.getOffset(e.entry.topicHash); !ok {
+		if _, ok := db.internal.trie.getOffset(e.entry.topicHash); !ok || e.entry.packTopic {
 			rawTopic = t.Marshal()
 			e.entry.topicSize = uint16(len(rawTopic))
 		}
@@ -288,11 +786,33 @@ func (db *DB) setEntry(e *Entry) error {
 
 	id.SetContract(e.Contract)
 	e.entry.seq = seq
-	e.entry.expiresAt = e.ExpiresAt
-	val := snappy.Encode(nil, e.Payload)
+	// the histogram holds the ttls as written, before any jitter is applied.
+	if e.ExpiresAt != 0 {
+		db.internal.ttls.add(time.Until(time.Unix(int64(e.ExpiresAt), 0)))
+	}
+	if e.entry.chunk {
+		// chunks expire after the message with any jitter applied to its expiry.
+		e.entry.expiresAt = db.maxJitter(e.ExpiresAt)
+	} else {
+		e.entry.expiresAt = db.jitter(e.ExpiresAt)
+	}
+	codec := e.Compression
+	switch {
+	case e.entry.chunked:
+		codec = codecChunked
+	case e.Headers[HeaderContentEncoding] == contentEncodingGzip:
+		codec = CodecGzip
+	case codec == CodecDefault:
+		codec = db.opts.compression
+	}
+	val, err := compress(codec, e.Payload)
+	if err != nil {
+		return err
+	}
 	if db.internal.dbInfo.encryption == 1 || e.Encryption {
-		eBit = 1
-		val = db.internal.mac.Encrypt(nil, val)
+		if keyID, val, err = db.encrypt(val); err != nil {
+			return err
+		}
 	}
 	e.entry.valueSize = uint32(len(val))
 	mLen := entrySize + idSize + uint32(e.entry.topicSize) + uint32(e.entry.valueSize)
@@ -303,7 +823,7 @@ func (db *DB) setEntry(e *Entry) error {
 	}
 	copy(e.entry.cache, entryData)
 	copy(e.entry.cache[entrySize:], id.Prefix())
-	e.entry.cache[entrySize+idSize-1] = byte(eBit)
+	e.entry.cache[entrySize+idSize-1] = byte(keyID)
 	// topic data is added on first entry for the topic.
 	if e.entry.topicSize != 0 {
 		copy(e.entry.cache[entrySize+idSize:], rawTopic)
@@ -312,14 +832,82 @@ func (db *DB) setEntry(e *Entry) error {
 	return nil
 }
 
+// jitter applies ttl jitter to the expiry time so entries sharing a ttl do not expire in the same expiry window.
+func (db *DB) jitter(expiresAt uint32) uint32 {
+	if db.opts.ttlJitter <= 0 || expiresAt == 0 {
+		return expiresAt
+	}
+	now := uint32(time.Now().Unix())
+	if expiresAt <= now {
+		return expiresAt
+	}
+	max := int64(expiresAt-now) * int64(db.opts.ttlJitter) / 100
+	if max <= 0 {
+		return expiresAt
+	}
+	return expiresAt + uint32(rand.Int63n(max+1))
+}
+
+// maxJitter returns the expiry time with the maximum ttl jitter applied.
+func (db *DB) maxJitter(expiresAt uint32) uint32 {
+	if db.opts.ttlJitter <= 0 || expiresAt == 0 {
+		return expiresAt
+	}
+	now := uint32(time.Now().Unix())
+	if expiresAt <= now {
+		return expiresAt
+	}
+	return expiresAt + uint32(int64(expiresAt-now)*int64(db.opts.ttlJitter)/100)
+}
+
+// expiryLimit returns maximum number of expired entries to process in a run of expirer.
+func (db *DB) expiryLimit() int {
+	limit := db.opts.queryOptions.defaultQueryLimit
+	if db.opts.ttlJitter > 0 {
+		limit = limit / expirySmearFactor
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
 // delete deletes the given key from the DB.
 func (db *DB) delete(topicHash, seq uint64) error {
 	if db.opts.flags.immutable {
 		return nil
 	}
+	// entry deleted by its sequence may be an entry of any topic.
+	if topicHash == 0 {
+		defer db.internal.queryCache.invalidateAll()
+	} else {
+		defer db.internal.queryCache.invalidate(topicHash, false)
+	}
 
 	db.internal.meter.Dels.Inc(1)
-	db.internal.mem.Delete(seq)
+	if db.internal.tombstones.enabled() {
+		if s, err := db.readEntry(_Query{topicHash: topicHash, seq: seq}); err == nil {
+			if id, val, err := db.internal.reader.readMessage(s); err == nil {
+				if err := db.internal.tombstones.add(seq, db.seq(), id, val); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// read the entry to release its size from the quota of its contract.
+	var qe _IndexEntry
+	if db.internal.quotas.enabled() {
+		if e, err := db.readEntry(_Query{seq: seq}); err == nil && e.seq == seq {
+			qe = e
+		}
+	}
+	if err := db.internal.mem.Delete(seq); err == nil {
+		db.internal.inFlight.add(-1, db.internal.meter.Unsynced)
+		if qe.seq != 0 {
+			db.releaseQuota(qe)
+			qe.seq = 0
+		}
+	}
 
 	// Test filter block for the message id presence.
 	if !db.internal.filter.Test(seq) {
@@ -334,14 +922,145 @@ func (db *DB) delete(topicHash, seq uint64) error {
 	if err != nil {
 		return err
 	}
-	db.internal.freeList.freeBlock(e.msgOffset, e.mSize())
+	if e.seq == 0 {
+		// no entry in db to delete.
+		return nil
+	}
+	if err := w.writeIndexBlock(blockIndex(seq)); err != nil {
+		return err
+	}
+	if e.topicSize != 0 {
+		db.internal.freeList.freeBlock(e.msgOffset+int64(idSize)+int64(e.topicSize), e.valueSize)
+	} else {
+		db.internal.freeList.freeBlock(e.msgOffset, e.mSize())
+	}
 	db.decount(1)
+	db.releaseStats(db.internal.reader, e)
+	if qe.seq != 0 {
+		db.releaseQuota(qe)
+	}
 	if db.internal.syncWrites {
 		return db.sync()
 	}
 	return nil
 }
 
+// parseDeleteTopic validates the topic of the entry to delete messages of the topic and returns the topic hash.
+// Wildcard topics are not supported.
+func (db *DB) parseDeleteTopic(e *Entry) (uint64, error) {
+	if err := db.ok(); err != nil {
+		return 0, err
+	}
+	switch {
+	case db.opts.flags.immutable:
+		return 0, errImmutable
+	case db.opts.replicaOf != "":
+		return 0, errReplica
+	case len(e.Topic) == 0:
+		return 0, errTopicEmpty
+	case len(e.Topic) > maxTopicLength:
+		return 0, errTopicTooLarge
+	}
+	if err := db.authorize(e.Contract, e.Topic, OpDelete); err != nil {
+		return 0, err
+	}
+	if e.Contract == 0 {
+		e.Contract = message.MasterContract
+	}
+	topic, _, err := db.parseTopic(e.Contract, e.Topic)
+	if err != nil {
+		return 0, err
+	}
+	if topic.TopicType == message.TopicWildcard {
+		return 0, errBadRequest
+	}
+	topic.AddContract(e.Contract)
+	return topic.GetHash(e.Contract), nil
+}
+
+// deleteTopic deletes all entries of the topic and removes the topic from the trie. The window
+// blocks of the topic are cleared, so the topic is not loaded into the trie on DB open.
+// The caller must hold the sync lock.
+func (db *DB) deleteTopic(topicHash uint64) error {
+	if ok := db.internal.trie.remove(topicHash); !ok {
+		return nil
+	}
+	// the topic is removed from the checkpoint before its window blocks are cleared.
+	db.internal.checkpoint.remove(topicHash)
+	if err := db.internal.checkpoint.commit(db.internal.dbInfo.epoch, db.internal.trie, true); err != nil {
+		return err
+	}
+	defer db.internal.queryCache.invalidate(topicHash, false)
+
+	// delete entries not yet sync to the DB.
+	for _, we := range db.internal.timeWindow.remove(topicHash) {
+		if err := db.delete(topicHash, we.seq()); err != nil {
+			return err
+		}
+	}
+
+	r := newWindowReader(db.fs)
+	if r.winFile == nil {
+		return nil
+	}
+	for windowIdx := int32(1); windowIdx <= r.windowIdx; windowIdx++ {
+		r.offset = winBlockOffset(windowIdx)
+		b, err := r.readWindowBlock()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if b.topicHash != topicHash || b.entryIdx == 0 {
+			continue
+		}
+		for _, we := range b.entries[:b.entryIdx] {
+			if err := db.delete(topicHash, we.seq()); err != nil {
+				return err
+			}
+		}
+		if _, err := r.winFile.WriteAt(_WinBlock{}.marshalBinary(), r.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRange deletes entries of the topic with the time of the message ID in the range. Window blocks
+// of the topic filled before the cutoff are not read.
+func (db *DB) deleteRange(topicHash uint64, contract uint32, cutoff, until int64) error {
+	off, ok := db.internal.trie.getOffset(topicHash)
+	if !ok {
+		return nil
+	}
+	wEntries := db.internal.timeWindow.lookup(db.fs, topicHash, off, _LookupFilter{cutoff: cutoff, until: until}, math.MaxInt32)
+	for _, we := range wEntries {
+		e, err := db.readEntry(_Query{topicHash: topicHash, seq: we.seq()})
+		if err == errMsgIDDeleted || err == errEntryInvalid || err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// The entry packing the topic is kept until it is synced, as the topic is recovered from the log with the entry.
+		if e.topicSize != 0 && e.cache != nil {
+			continue
+		}
+		id, _, err := db.internal.reader.readMessage(e)
+		if err != nil {
+			return err
+		}
+		if !message.ID(id).EvalRange(contract, cutoff, until) {
+			continue
+		}
+		if err := db.delete(topicHash, we.seq()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // batch starts a new batch.
 func (db *DB) batch() *Batch {
 	opts := &_Options{}
@@ -363,12 +1082,12 @@ func (db *DB) nextSeq() uint64 {
 	return atomic.AddUint64(&db.internal.dbInfo.sequence, 1)
 }
 
-func (db *DB) incount(count uint64) uint64 {
-	return atomic.AddUint64(&db.internal.dbInfo.count, count)
+func (db *DB) incount(count uint64) {
+	db.internal.count.add(int64(count))
 }
 
-func (db *DB) decount(count uint64) uint64 {
-	return atomic.AddUint64(&db.internal.dbInfo.count, -count)
+func (db *DB) decount(count uint64) {
+	db.internal.count.add(-int64(count))
 }
 
 // setClosed flag; return true if not already closed.
@@ -17,9 +17,11 @@
 package unitdb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/unit-io/bpool"
@@ -34,6 +36,15 @@ type (
 		inBytes        int64
 		count          int64
 		entriesInvalid uint64
+
+		// counted is the count added to the entry count by the sync, abort rolls back only the counted entries.
+		counted int64
+		// contracts is the usage of the contracts of the entries synced, it is added to the contract stats with the count.
+		contracts        map[uint32]_ContractUsage
+		contractsApplied bool
+
+		// ingest is set if the entries are written by Ingest, the files are synced once the ingest completes.
+		ingest bool
 	}
 	_SyncHandle struct {
 		syncInfo _SyncInfo
@@ -91,6 +102,9 @@ func (db *_SyncHandle) status() (ok bool) {
 func (db *_SyncHandle) reset() error {
 	db.syncInfo.lastSyncSeq = db.syncInfo.upperSeq
 	db.syncInfo.count = 0
+	db.syncInfo.counted = 0
+	db.syncInfo.contracts = nil
+	db.syncInfo.contractsApplied = false
 	db.syncInfo.inBytes = 0
 	db.syncInfo.upperSeq = 0
 
@@ -104,6 +118,14 @@ func (db *_SyncHandle) reset() error {
 	return nil
 }
 
+// syncContract adds the entry to the usage of its contract in the sync.
+func (db *_SyncHandle) syncContract(e _IndexEntry) {
+	if db.syncInfo.contracts == nil {
+		db.syncInfo.contracts = make(map[uint32]_ContractUsage)
+	}
+	addEntry(db.syncInfo.contracts, e.cache[:idSize], int64(e.mSize()))
+}
+
 func (db *_SyncHandle) abort() error {
 	defer db.reset()
 	if db.syncInfo.syncComplete {
@@ -118,7 +140,10 @@ func (db *_SyncHandle) abort() error {
 		return err
 	}
 
-	db.decount(uint64(db.syncInfo.count))
+	db.decount(uint64(db.syncInfo.counted))
+	if db.syncInfo.contractsApplied {
+		db.internal.contractStats.apply(db.syncInfo.contracts, -1)
+	}
 
 	return nil
 }
@@ -136,10 +161,33 @@ func (db *DB) startSyncer(interval time.Duration) {
 			case <-db.internal.closeC:
 				return
 			case <-syncTicker.C:
-				if err := db.Sync(); err != nil {
+				if err := db.syncContext(context.Background()); err != nil {
 					logger.Error().Err(err).Str("context", "startSyncer").Msg("Error syncing to db")
 					panic(err)
 				}
+				if !db.opts.flags.backgroundKeyExpiry {
+					db.internal.filter.release(time.Now())
+				}
+			}
+		}
+	}()
+}
+
+// startAborter aborts time IDs of batches not committed within the timeout.
+func (db *DB) startAborter(timeout time.Duration) {
+	abortTicker := time.NewTicker(timeout / 2)
+	go func() {
+		for {
+			select {
+			case now := <-abortTicker.C:
+				for _, timeID := range db.internal.mem.Uncommitted(now.Add(-timeout)) {
+					if err := db.AbortTimeID(timeID); err != nil {
+						logger.Error().Err(err).Str("context", "db.startAborter").Int64("timeID", timeID)
+					}
+				}
+			case <-db.internal.closeC:
+				abortTicker.Stop()
+				return
 			}
 		}
 	}()
@@ -160,16 +208,41 @@ func (db *DB) startExpirer(durType time.Duration, maxDur int) {
 	}()
 }
 
-func (db *DB) sync() error {
+func (db *DB) sync() (err error) {
+	defer func() {
+		// the checkpoint is stale if the topics changed are not synced.
+		if err != nil {
+			db.internal.checkpoint.invalidate()
+		}
+	}()
 	// writeInfo information to persist correct seq information to disk.
 	if err := db.writeInfo(); err != nil {
 		return err
 	}
-	if err := db.fs.sync(); err != nil {
-		return nil
+	if err := db.internal.quotas.write(); err != nil {
+		return err
+	}
+	if err := db.internal.contractStats.write(); err != nil {
+		return err
+	}
+	if err := db.wipe(); err != nil {
+		return err
+	}
+	if err := db.fs.sync(db.opts.flags.strictSyncOrder, db.opts.flags.dataSync); err != nil {
+		return err
 	}
 
-	return nil
+	return db.internal.checkpoint.commit(db.internal.dbInfo.epoch, db.internal.trie, false)
+}
+
+// wipe zeroes the freed blocks of the data file if secure delete is set.
+func (db *DB) wipe() error {
+	if !db.opts.flags.secureDelete {
+		return nil
+	}
+	n, err := db.internal.freeList.wipe(db.internal.reader.dataFile)
+	db.internal.meter.WipedBytes.Inc(n)
+	return err
 }
 
 func (db *_SyncHandle) sync(recovery bool) error {
@@ -193,11 +266,35 @@ func (db *_SyncHandle) sync(recovery bool) error {
 	}
 
 	db.incount(uint64(db.syncInfo.count))
-	if err := db.DB.sync(); err != nil {
-		return err
+	db.syncInfo.counted = db.syncInfo.count
+	db.internal.contractStats.apply(db.syncInfo.contracts, 1)
+	db.syncInfo.contractsApplied = true
+	// heads are set in the checkpoint before the sync, so the checkpoint committed by the sync has the new heads.
+	for h, off := range db.windowWriter.heads {
+		db.internal.checkpoint.set(h, off)
+	}
+	winBlocks := atomic.LoadUint32(&db.internal.dbInfo.winBlocks)
+	atomic.StoreUint32(&db.internal.dbInfo.winBlocks, uint32(db.windowWriter.winFile.currSize()/int64(blockSize)))
+	if !db.syncInfo.ingest {
+		if err := db.DB.sync(); err != nil {
+			atomic.StoreUint32(&db.internal.dbInfo.winBlocks, winBlocks)
+			return err
+		}
+	}
+	// topics are flipped to the new heads of their window block chains only after the window blocks are synced.
+	for h, off := range db.windowWriter.heads {
+		db.internal.trie.setOffset(_Topic{hash: h, offset: off})
 	}
-	if recovery {
+	if err := db.reclaimWindowBlocks(); err != nil {
+		logger.Error().Err(err).Str("context", "db.reclaimWindowBlocks")
+	}
+	switch {
+	case recovery:
 		db.internal.meter.Recovers.Inc(db.syncInfo.count)
+	case db.syncInfo.ingest:
+		db.internal.meter.Ingested.Inc(db.syncInfo.count)
+	default:
+		db.internal.inFlight.synced(db.syncInfo.count, db.internal.meter.Unsynced)
 	}
 	db.internal.meter.Syncs.Inc(db.syncInfo.count)
 	db.internal.meter.InMsgs.Inc(db.syncInfo.count)
@@ -219,10 +316,34 @@ func (db *_SyncHandle) Sync() error {
 		sort.Slice(seqs[:], func(i, j int) bool {
 			return seqs[i] < seqs[j]
 		})
-		if seqs[len(seqs)-1] > db.syncInfo.upperSeq {
-			db.syncInfo.upperSeq = seqs[len(seqs)-1]
+		// writeWindow appends window entries of the topics to the window writer.
+		writeWindow := func() error {
+			for h := range winEntries {
+				topicOff, ok := db.internal.trie.getOffset(h)
+				if !ok {
+					return errors.New("db.Sync: timeWindow sync error: unable to get topic offset from trie")
+				}
+				if _, err := db.windowWriter.append(h, topicOff, winEntries[h]); err != nil {
+					return err
+				}
+			}
+			winEntries = make(map[uint64]_WindowEntries)
+			return nil
 		}
+		var deletes []_Entry
 		for _, seq := range seqs {
+			if seq&deleteRecordFlag != 0 {
+				// delete record of a batch is applied once the entries of the time block are synced.
+				if memdata, err := db.internal.mem.Lookup(timeID, seq); err == nil {
+					var m _Entry
+					m.UnmarshalBinary(memdata[:entrySize])
+					deletes = append(deletes, m)
+				}
+				continue
+			}
+			if seq > db.syncInfo.upperSeq {
+				db.syncInfo.upperSeq = seq
+			}
 			memdata, err := db.internal.mem.Lookup(timeID, seq)
 			if err != nil || memdata == nil {
 				db.syncInfo.entriesInvalid++
@@ -257,23 +378,26 @@ func (db *_SyncHandle) Sync() error {
 				winEntries[m.topicHash] = _WindowEntries{we}
 			}
 
-			db.internal.filter.Append(we.seq())
+			db.internal.filter.appendWithExpiry(we.seq(), we.expiryTime())
 			db.syncInfo.count++
+			db.syncContract(e)
 			db.syncInfo.inBytes += int64(e.valueSize)
-		}
-		for h := range winEntries {
-			topicOff, ok := db.internal.trie.getOffset(h)
-			if !ok {
-				return true, errors.New("db.Sync: timeWindow sync error: unable to get topic offset from trie")
-			}
-			wOff, err := db.windowWriter.append(h, topicOff, winEntries[h])
-			if err != nil {
-				return true, err
-			}
-			if ok := db.internal.trie.setOffset(_Topic{hash: h, offset: wOff}); !ok {
-				return true, errors.New("db:Sync: timeWindow sync error: unable to set topic offset in trie")
+
+			// A large time block is committed in chunks so a failure rolls back only the last chunk. The time ID
+			// is released once all chunks are committed, entries of committed chunks are skipped if the time ID is synced again.
+			if err1 == nil && (db.syncInfo.count >= int64(db.opts.syncChunkEntries) || db.syncInfo.inBytes >= db.opts.syncChunkSize) {
+				if err := writeWindow(); err != nil {
+					return true, err
+				}
+				if err := db.sync(false); err != nil {
+					return true, err
+				}
+				db.internal.meter.SyncChunks.Inc(1)
 			}
 		}
+		if err := writeWindow(); err != nil {
+			return true, err
+		}
 		if err1 != nil {
 			fmt.Println("db.sync: error ", err1)
 			return true, err1
@@ -283,6 +407,11 @@ func (db *_SyncHandle) Sync() error {
 			fmt.Println("db.sync: sync error ", err)
 			return true, err
 		}
+		for _, e := range deletes {
+			if err := db.applyDelete(e); err != nil {
+				return true, err
+			}
+		}
 		if db.syncInfo.syncComplete {
 			if err := timeRelease(timeID); err != nil {
 				return false, err
@@ -304,25 +433,47 @@ func (db *_SyncHandle) Sync() error {
 
 // expireEntries run expirer to delete entries from db if ttl was set on entries and that has expired.
 func (db *DB) expireEntries() error {
-	// sync happens synchronously.
-	db.internal.syncLockC <- struct{}{}
+	// expiry is a maintenance operation and it yields the sync lock to foreground sync.
+	if !db.internal.syncLock.lockMaintenance(db.internal.closeC) {
+		return nil
+	}
+	locked := true
 	defer func() {
-		<-db.internal.syncLockC
+		if locked {
+			db.internal.syncLock.unlock()
+		}
 	}()
-	expiredEntries := db.internal.timeWindow.expiryWindowBucket.getExpiredEntries(db.opts.queryOptions.defaultQueryLimit)
-	for _, expiredEntry := range expiredEntries {
+	limit := db.expiryLimit()
+	expiredEntries := db.internal.timeWindow.expiryWindowBucket.getExpiredEntries(limit)
+	for i, expiredEntry := range expiredEntries {
+		if i%expiryYieldInterval == 0 && db.internal.syncLock.preempted() {
+			db.internal.syncLock.unlock()
+			if locked = db.internal.syncLock.lockMaintenance(db.internal.closeC); !locked {
+				return nil
+			}
+		}
 		we := expiredEntry.(_WinEntry)
 		/// Test filter block if message hash presence.
 		if !db.internal.filter.Test(we.seq()) {
 			continue
 		}
 		e, err := db.internal.reader.readEntry(we.seq())
+		if err == errMsgIDDeleted {
+			continue
+		}
 		if err != nil {
 			return err
 		}
+		db.releaseQuota(e)
+		db.releaseStats(db.internal.reader, e)
 		db.internal.freeList.free(e.seq, e.msgOffset, e.mSize())
 		db.decount(1)
 	}
 
-	return nil
+	// drop filter generations once expirer has caught up with expired entries.
+	if len(expiredEntries) < limit {
+		db.internal.filter.release(time.Now())
+	}
+
+	return db.trimTopics()
 }
@@ -17,11 +17,32 @@
 package unitdb
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	fltr "github.com/unit-io/unitdb/filter"
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/metrics"
+	"github.com/unit-io/unitdb/uid"
 )
 
 var (
@@ -48,7 +69,7 @@ func TestSimple(t *testing.T) {
 	}
 	topic := []byte("unit1.test")
 
-	if db.internal.dbInfo.count != 0 {
+	if db.Count() != 0 {
 		t.Fatal()
 	}
 
@@ -56,7 +77,7 @@ func TestSimple(t *testing.T) {
 		t.Fatal()
 	}
 
-	if db.internal.dbInfo.count != 0 {
+	if db.Count() != 0 {
 		t.Fatal()
 	}
 
@@ -316,3 +337,4616 @@ func TestWildcardTopics(t *testing.T) {
 		}
 	}
 }
+
+func TestVerify(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic := []byte("unit.verify")
+	for i := 0; i < 100; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%2d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Entries != 100 || report.SampledTopics == 0 {
+		t.Fatalf("verify: unexpected report %+v", report)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	cleanup()
+	key := []byte("4BWm1vZletvrCDGWsF6mex8oBSd59m6I")
+	newKey := []byte("jTOfQnkWpd3xyHDdpFQ3a8LGIHRVdMKm")
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithEncryption(), WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic := []byte("unit.rotate")
+	put := func(start, end int) {
+		for i := start; i < end; i++ {
+			if err := db.Put(topic, []byte(fmt.Sprintf("message.%2d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put(0, 10)
+	var done, total int
+	if err := db.RotateKey(newKey, func(d, n int) { done, total = d, n }); err != nil {
+		t.Fatal(err)
+	}
+	if done != 2 || total != 2 {
+		t.Fatalf("rotate: expected progress 2/2; got %d/%d", done, total)
+	}
+	put(10, 20)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dbPath, WithEncryptionKey(key)); err != errKeyMismatch {
+		t.Fatalf("expected %v; got %v", errKeyMismatch, err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithEncryptionKey(newKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	items, err := db.Get(NewQuery(topic).WithLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 20 {
+		t.Fatalf("expected 20 messages; got %d", len(items))
+	}
+}
+
+func TestKeyProvider(t *testing.T) {
+	cleanup()
+	var key atomic.Value
+	key.Store([]byte("4BWm1vZletvrCDGWsF6mex8oBSd59m6I"))
+	provider := KeyProviderFunc(func(ctx context.Context, keyID string) ([]byte, error) {
+		if keyID != "unitdb" {
+			return nil, errors.New("key not found")
+		}
+		return key.Load().([]byte), nil
+	})
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithEncryption(), WithKeyProvider(provider, "unitdb"), WithKeyRefreshInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("unit.provider")
+	if err := db.Put(topic, []byte("message.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate the key in the provider and refresh.
+	key.Store([]byte("jTOfQnkWpd3xyHDdpFQ3a8LGIHRVdMKm"))
+	time.Sleep(10 * time.Millisecond)
+	if err := db.refreshKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithKeyProvider(provider, "unitdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if items, err := db.Get(NewQuery(topic)); err != nil || len(items) != 1 {
+		t.Fatalf("expected 1 message; got %d, %v", len(items), err)
+	}
+}
+
+func TestQueryAuthorizer(t *testing.T) {
+	cleanup()
+	errDenied := errors.New("denied")
+	authorizer := func(contract uint32, topic []byte, op Op) error {
+		if op != OpGet && string(topic) == "unit.readonly" {
+			return errDenied
+		}
+		return nil
+	}
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithQueryAuthorizer(authorizer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("unit.readonly"), []byte("msg")); err != errDenied {
+		t.Fatalf("expected %v; got %v", errDenied, err)
+	}
+	if err := db.Put([]byte("unit.readwrite"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(NewQuery([]byte("unit.readonly"))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.watch")
+	msgC, cancel, err := db.Watch(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaC, cancelMeta, err := db.Watch(topic, WithWatchMetadataOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancelMeta()
+
+	if err := db.PutEntry(NewEntry(topic, []byte("msg.1")).WithHeaders(map[string]string{"type": "text"})); err != nil {
+		t.Fatal(err)
+	}
+	m := <-msgC
+	if string(m.Payload) != "msg.1" || m.Headers["type"] != "text" || m.Contract != message.MasterContract {
+		t.Fatalf("watch: unexpected message %+v", m)
+	}
+	if err := db.Delete(m.ID, topic); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-metaC; m.Payload != nil || len(m.ID) == 0 {
+		t.Fatalf("watch: unexpected metadata-only message %+v", m)
+	}
+
+	cancel()
+	if _, ok := <-msgC; ok {
+		t.Fatal("watch: expected channel closed on cancel")
+	}
+}
+
+func TestWatchResume(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.resume")
+	msgC, cancel, err := db.Watch(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var token []byte
+	for i := 0; i < 2; i++ {
+		token = (<-msgC).Token
+	}
+	cancel()
+
+	// Resume after the second message.
+	msgC, cancel, err = db.Watch(topic, WithWatchFrom(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if err := db.Put(topic, []byte("msg.5")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < 6; i++ {
+		select {
+		case m := <-msgC:
+			if string(m.Payload) != fmt.Sprintf("msg.%d", i) {
+				t.Fatalf("expected msg.%d; got %s", i, m.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for msg.%d", i)
+		}
+	}
+	if _, _, err := db.Watch(topic, WithWatchFrom([]byte("invalid"))); err != errInvalidToken {
+		t.Fatalf("expected %v; got %v", errInvalidToken, err)
+	}
+}
+
+func TestWatchCoalesce(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.coalesce")
+	msgC, cancel, err := db.Watch(topic, WithWatchCoalesce(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	n := 100
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var delivered, skipped int
+	for delivered+skipped < n {
+		select {
+		case m := <-msgC:
+			delivered++
+			skipped += m.Skipped
+		case <-time.After(time.Second):
+			t.Fatalf("timeout: delivered %d, skipped %d", delivered, skipped)
+		}
+	}
+	if delivered >= n {
+		t.Fatalf("expected coalesced delivery; got %d messages", delivered)
+	}
+
+	// messages of a wildcard watch are coalesced for each topic.
+	msgC, cancel, err = db.Watch([]byte("unit.wildcard.*"), WithWatchCoalesce(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	topics := []string{"unit.wildcard.topic1", "unit.wildcard.topic2"}
+	for i := 0; i < 3; i++ {
+		for _, topic := range topics {
+			if err := db.Put([]byte(topic), []byte(fmt.Sprintf("%s.%d", topic, i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the first message of each topic is delivered, then the latest message of each topic carrying its skipped messages.
+	latest := make(map[string]Message)
+	for i := 0; i < 2*len(topics); i++ {
+		select {
+		case m := <-msgC:
+			latest[string(m.Topic)] = m
+		case <-time.After(time.Second):
+			t.Fatalf("timeout: delivered %d messages", i)
+		}
+	}
+	for _, topic := range topics {
+		m, ok := latest[topic]
+		if !ok || string(m.Payload) != topic+".2" || m.Skipped != 1 {
+			t.Fatalf("topic %s: unexpected latest message %+v", topic, m)
+		}
+	}
+	select {
+	case m := <-msgC:
+		t.Fatalf("unexpected message %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatchOverflow(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.overflow")
+	msgC, cancel, err := db.Watch(topic, WithWatchBufferSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	n := 10
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var token []byte
+	for i := 0; i < 2; i++ {
+		m := <-msgC
+		if m.Err != nil || string(m.Payload) != fmt.Sprintf("msg.%d", i) {
+			t.Fatalf("expected msg.%d; got %+v", i, m)
+		}
+		token = m.Token
+	}
+	m, ok := <-msgC
+	if !ok || m.Err != errWatchOverflow || !bytes.Equal(m.Token, token) {
+		t.Fatalf("expected overflow message with token of the last message delivered; got %+v", m)
+	}
+	if _, ok := <-msgC; ok {
+		t.Fatal("expected channel closed on overflow")
+	}
+
+	// Resume from the overflow token, the stored messages are replayed in pages of the buffer size.
+	msgC, cancel, err = db.Watch(topic, WithWatchBufferSize(2), WithWatchFrom(m.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	for i := 2; i < n; i++ {
+		select {
+		case m := <-msgC:
+			if m.Err != nil || string(m.Payload) != fmt.Sprintf("msg.%d", i) {
+				t.Fatalf("expected msg.%d; got %+v", i, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for msg.%d", i)
+		}
+	}
+}
+
+func TestSyncLockPriority(t *testing.T) {
+	l := newSyncLock()
+	closeC := make(chan struct{})
+	if !l.lockMaintenance(closeC) {
+		t.Fatal("expected maintenance lock")
+	}
+	locked := make(chan struct{})
+	go func() {
+		l.lock()
+		close(locked)
+	}()
+	for !l.preempted() {
+		time.Sleep(time.Millisecond)
+	}
+	l.unlock()
+	<-locked
+
+	// Maintenance waits for foreground operation and returns on close.
+	close(closeC)
+	if l.lockMaintenance(closeC) {
+		t.Fatal("expected maintenance lock to fail on close")
+	}
+	l.unlock()
+}
+
+func TestHeaderSlots(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("unit.header"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	// Sync the entry so it is not recovered from the WAL on open.
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the newest header slot, the previous header is selected on open.
+	f, err := os.OpenFile(filePath(dbPath, _FileDesc{fileType: typeInfo}), os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, nInfoSlots*fixed)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	var slots [nInfoSlots]_DBInfo
+	newest := 0
+	for i := range slots {
+		if err := slots[i].UnmarshalBinary(buf[uint32(i)*fixed : uint32(i+1)*fixed]); err != nil {
+			t.Fatal(err)
+		}
+		if slots[i].epoch > slots[newest].epoch {
+			newest = i
+		}
+	}
+	if _, err := f.WriteAt([]byte{0xff}, int64(uint32(newest)*fixed)+12); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.internal.dbInfo.epoch != slots[1-newest].epoch {
+		t.Fatalf("expected header epoch %d; got %d", slots[1-newest].epoch, db.internal.dbInfo.epoch)
+	}
+}
+
+func TestConsistencyCheck(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("unit.consistency")
+	for i := 0; i < 10; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Simulate stale header counters.
+	db.internal.dbInfo.sequence = 2
+	db.internal.count.store(100)
+	if err := db.checkConsistency(); err != nil {
+		t.Fatal(err)
+	}
+	if db.internal.dbInfo.sequence != 10 || db.Count() != 10 {
+		t.Fatalf("expected seq 10 and count 10; got seq %d and count %d", db.internal.dbInfo.sequence, db.Count())
+	}
+}
+
+func TestFreezeWrites(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithMaxFreezeDuration(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.freeze")
+	if err := db.Put(topic, []byte("msg.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FreezeWrites(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FreezeWrites(context.Background()); err != errFrozen {
+		t.Fatalf("expected %v; got %v", errFrozen, err)
+	}
+	// Puts are accepted while frozen and syncs are blocked until thaw.
+	if err := db.Put(topic, []byte("msg.2")); err != nil {
+		t.Fatal(err)
+	}
+	synced := make(chan error, 1)
+	go func() {
+		synced <- db.Sync()
+	}()
+	select {
+	case <-synced:
+		t.Fatal("expected sync blocked while writes are frozen")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := db.Thaw(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-synced; err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes are thawed after max freeze duration.
+	if err := db.FreezeWrites(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := db.Thaw(); err != errNotFrozen {
+		t.Fatalf("expected %v; got %v", errNotFrozen, err)
+	}
+}
+
+func TestTrieLookupDedup(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		topics [][]byte
+		query  []byte
+	}{
+		{[][]byte{[]byte("dedup.b.b1"), []byte("dedup.*.b1"), []byte("dedup.b..."), []byte("dedup...")}, []byte("dedup.b.b1")},
+		{[][]byte{[]byte("shape.*.*"), []byte("shape.*..."), []byte("shape...."), []byte("shape.a.*")}, []byte("shape.a.b")},
+		{[][]byte{[]byte("deep.a..."), []byte("deep.a.*.c..."), []byte("deep.*.b.c.d")}, []byte("deep.a.b.c.d")},
+	}
+	for _, tt := range tests {
+		for _, topic := range tt.topics {
+			if err := db.Put(topic, topic); err != nil {
+				t.Fatal(err)
+			}
+		}
+		q := NewQuery(tt.query).WithLimit(100)
+		q.internal.opts = &_QueryOptions{defaultQueryLimit: 100, maxQueryLimit: 100}
+		if err := q.parse(); err != nil {
+			t.Fatal(err)
+		}
+		topics := db.internal.trie.lookup(q.internal.parts, q.internal.depth, q.internal.topicType)
+		seen := make(map[uint64]bool)
+		for _, topic := range topics {
+			if seen[topic.hash] {
+				t.Fatalf("lookup %s: duplicate topic %d", tt.query, topic.hash)
+			}
+			seen[topic.hash] = true
+		}
+		items, err := db.Get(NewQuery(tt.query).WithLimit(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != len(tt.topics) {
+			t.Fatalf("query %s: expected %d messages; got %d", tt.query, len(tt.topics), len(items))
+		}
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("range.test")
+	var n = 600
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%2d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	tests := []struct {
+		from, to time.Time
+		count    int
+	}{
+		{now.Add(-time.Hour), now.Add(time.Minute), n},
+		{now.Add(-time.Hour), time.Time{}, n},
+		{time.Time{}, now.Add(-time.Hour), 0},
+		{now.Add(-2 * time.Hour), now.Add(-time.Hour), 0},
+		{now.Add(time.Minute), time.Time{}, 0},
+	}
+	for i, tt := range tests {
+		items, err := db.Get(NewQuery(topic).WithRange(tt.from, tt.to).WithLimit(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != tt.count {
+			t.Fatalf("range %d: expected %d messages; got %d", i, tt.count, len(items))
+		}
+	}
+}
+
+func TestTopicDepth(t *testing.T) {
+	deepTopic := func(prefix string, depth int) []byte {
+		topic := []byte(prefix)
+		for i := 1; i < depth; i++ {
+			topic = append(topic, []byte(fmt.Sprintf(".p%d", i))...)
+		}
+		return topic
+	}
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// generic wildcard topic at maximum depth matches static topic at maximum depth.
+	wtopic := append(deepTopic("deep", message.TopicMaxDepth-1), []byte("...")...)
+	if err := db.Put(wtopic, []byte("generic")); err != nil {
+		t.Fatal(err)
+	}
+	topic := deepTopic("deep", message.TopicMaxDepth)
+	if err := db.Put(topic, []byte("static")); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := db.Get(NewQuery(topic).WithLimit(10)); len(msgs) != 2 || err != nil {
+		t.Fatalf("expected 2 messages; got %d, %v", len(msgs), err)
+	}
+	var depthErr *TopicDepthError
+	topic = deepTopic("deep", message.TopicMaxDepth+1)
+	if err := db.Put(topic, []byte("too deep")); !errors.As(err, &depthErr) || depthErr.Depth != message.TopicMaxDepth+1 {
+		t.Fatalf("expected topic depth error; got %v", err)
+	}
+	if _, err := db.Get(NewQuery(topic)); !errors.As(err, &depthErr) {
+		t.Fatalf("expected topic depth error; got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup()
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithMaxTopicDepth(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("a.b.c..."), []byte("generic")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("a.b.c.d"), []byte("static")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("a.b.c.d.e"), []byte("too deep")); !errors.As(err, &depthErr) || depthErr.MaxDepth != 4 {
+		t.Fatalf("expected topic depth error; got %v", err)
+	}
+	if msgs, err := db.Get(NewQuery([]byte("a.b.c.d")).WithLimit(10)); len(msgs) != 2 || err != nil {
+		t.Fatalf("expected 2 messages; got %d, %v", len(msgs), err)
+	}
+}
+
+func TestQueryCursor(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("cursor.test")
+	put := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put(0, 400)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	put(400, 430)
+
+	seen := make(map[string]bool)
+	q := NewQuery(topic).WithLimit(50)
+	pages := 0
+	for {
+		items, err := db.Get(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			if seen[string(item)] {
+				t.Fatalf("page %d: duplicate message %s", pages, item)
+			}
+			seen[string(item)] = true
+		}
+		pages++
+		cursor := q.Cursor()
+		if cursor == nil {
+			break
+		}
+		q = NewQuery(topic).WithLimit(50).WithCursor(cursor)
+	}
+	if len(seen) != 430 || pages != 9 {
+		t.Fatalf("expected 430 messages in 9 pages; got %d in %d pages", len(seen), pages)
+	}
+	if _, err := db.Get(NewQuery([]byte("cursor")).WithCursor(make([]byte, 16))); err != errInvalidCursor {
+		t.Fatalf("expected invalid cursor error; got %v", err)
+	}
+}
+
+func TestCursorWildcard(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics := [][]byte{[]byte("page.a"), []byte("page.b"), []byte("page.c")}
+	deleted := make(map[string]bool)
+	n := 0
+	put := func(topic []byte, count int) {
+		for i := 0; i < count; i++ {
+			msg := fmt.Sprintf("msg.%d", n)
+			id := db.NewID()
+			if err := db.PutEntry(NewEntry(topic, []byte(msg)).WithID(id)); err != nil {
+				t.Fatal(err)
+			}
+			// deleted entries are skipped on read, so pages are filled from the entries after these.
+			if n%7 == 3 || (n >= 140 && n < 175) {
+				if err := db.Delete(id, topic); err != nil {
+					t.Fatal(err)
+				}
+				deleted[msg] = true
+			}
+			n++
+		}
+	}
+	put(topics[0], 120)
+	put(topics[1], 60)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	put(topics[2], 60)
+	put(topics[0], 30)
+	put(topics[1], 30)
+
+	for _, order := range []Order{OrderDesc, OrderAsc} {
+		seen := make(map[string]bool)
+		last := -1
+		q := NewQuery([]byte("page.*")).WithLimit(20).WithOrder(order)
+		for pages := 0; ; pages++ {
+			if pages > n {
+				t.Fatalf("order %d: pagination does not end", order)
+			}
+			items, err := db.Get(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range items {
+				var i int
+				fmt.Sscanf(string(item), "msg.%d", &i)
+				if last >= 0 && ((order == OrderDesc && i >= last) || (order == OrderAsc && i <= last)) {
+					t.Fatalf("order %d: message %s out of order after msg.%d", order, item, last)
+				}
+				last = i
+				seen[string(item)] = true
+			}
+			cursor := q.Cursor()
+			if cursor == nil {
+				break
+			}
+			q = NewQuery([]byte("page.*")).WithLimit(20).WithOrder(order).WithCursor(cursor)
+		}
+		if len(seen) != n-len(deleted) {
+			t.Fatalf("order %d: expected %d messages; got %d", order, n-len(deleted), len(seen))
+		}
+	}
+}
+
+func TestQueryOrder(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("order.test")
+	put := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put(0, 400)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	put(400, 430)
+
+	items, err := db.Get(NewQuery(topic).WithLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 10 || string(items[0]) != "msg.429" {
+		t.Fatalf("expected 10 messages most recent first; got %d", len(items))
+	}
+	next := 0
+	q := NewQuery(topic).WithLimit(50).WithOrder(OrderAsc)
+	for {
+		items, err := db.Get(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			if want := fmt.Sprintf("msg.%d", next); string(item) != want {
+				t.Fatalf("expected message %s; got %s", want, item)
+			}
+			next++
+		}
+		cursor := q.Cursor()
+		if cursor == nil {
+			break
+		}
+		q = NewQuery(topic).WithLimit(50).WithOrder(OrderAsc).WithCursor(cursor)
+	}
+	if next != 430 {
+		t.Fatalf("expected 430 messages oldest first; got %d", next)
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithDefaultQueryLimit(10), WithMaxQueryLimit(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("limit.test")
+	for i := 0; i < 50; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		topic []byte
+		limit int
+		want  int
+	}{
+		{topic, 0, 10},
+		{topic, 15, 15},
+		{topic, 100, 20},
+		{append(topic, []byte("?last=1h")...), 100, 20},
+	}
+	for _, tt := range tests {
+		q := NewQuery(tt.topic).WithLimit(tt.limit)
+		items, err := db.Get(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != tt.want || q.Limit != tt.want {
+			t.Fatalf("limit %d: expected %d messages; got %d, applied limit %d", tt.limit, tt.want, len(items), q.Limit)
+		}
+	}
+}
+
+func TestItems(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMaxQueryLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(topic []byte, from, to int) {
+		for i := from; i < to; i++ {
+			if err := db.Put(topic, []byte(fmt.Sprintf("%s.%d", topic, i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put([]byte("items.a"), 0, 700)
+	put([]byte("items..."), 0, 100)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMaxQueryLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	put([]byte("items.a"), 700, 750)
+
+	tests := []struct {
+		query []byte
+		limit int
+		count int
+	}{
+		{[]byte("items.a"), 0, 850},
+		{[]byte("items.a"), 120, 120},
+		{[]byte("items..."), 0, 100},
+	}
+	for _, tt := range tests {
+		it, err := db.Items(NewQuery(tt.query).WithLimit(tt.limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[string]bool)
+		for it.Next() {
+			if seen[string(it.Value())] {
+				t.Fatalf("query %s: duplicate item %s", tt.query, it.Value())
+			}
+			seen[string(it.Value())] = true
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != tt.count {
+			t.Fatalf("query %s: expected %d items; got %d", tt.query, tt.count, len(seen))
+		}
+	}
+	it, err := db.Items(NewQuery([]byte("items.a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 749; i >= 700 && it.Next(); i-- {
+		if want := fmt.Sprintf("items.a.%d", i); string(it.Value()) != want {
+			t.Fatalf("expected item %s; got %s", want, it.Value())
+		}
+	}
+}
+
+func TestWatchWildcard(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	contract, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	starC, cancelStar, err := db.Watch([]byte("wild.*.ch1"), WithWatchContract(contract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancelStar()
+	genericC, cancelGeneric, err := db.Watch([]byte("wild..."), WithWatchContract(contract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancelGeneric()
+	if _, _, err := db.Watch([]byte("wild..."), WithWatchFrom(make([]byte, tokenSize))); err != errBadRequest {
+		t.Fatalf("expected bad request for resumption of wildcard watch; got %v", err)
+	}
+
+	if err := db.PutEntry(NewEntry([]byte("wild.a.ch1?ttl=1h"), []byte("a.ch1")).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry([]byte("wild.a.ch2"), []byte("a.ch2")).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+	// messages of other contract are not delivered.
+	if err := db.Put([]byte("wild.a.ch1"), []byte("master")); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		b.SetOptions(WithBatchContract(contract))
+		return b.Put([]byte("wild.b.ch1"), []byte("b.ch1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recv := func(msgC <-chan Message) (topics []string) {
+		for {
+			select {
+			case m := <-msgC:
+				topics = append(topics, string(m.Topic))
+			case <-time.After(100 * time.Millisecond):
+				return topics
+			}
+		}
+	}
+	if topics := recv(starC); !reflect.DeepEqual(topics, []string{"wild.a.ch1", "wild.b.ch1"}) {
+		t.Fatalf("watch wild.*.ch1: unexpected topics %v", topics)
+	}
+	if topics := recv(genericC); !reflect.DeepEqual(topics, []string{"wild.a.ch1", "wild.a.ch2", "wild.b.ch1"}) {
+		t.Fatalf("watch wild...: unexpected topics %v", topics)
+	}
+}
+
+func TestQueryAsOf(t *testing.T) {
+	for _, retention := range []time.Duration{0, time.Minute} {
+		cleanup()
+		db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithTombstoneRetention(retention))
+		if err != nil {
+			t.Fatal(err)
+		}
+		topic := []byte("asof.test")
+		var ids [][]byte
+		for i := 0; i < 5; i++ {
+			id := db.NewID()
+			if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("msg.%d", i))).WithID(id)); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		epoch := db.Epoch()
+		for i := 5; i < 8; i++ {
+			if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Delete(ids[2], topic); err != nil {
+			t.Fatal(err)
+		}
+		if items, err := db.Get(NewQuery(topic).WithLimit(100)); len(items) != 7 || err != nil {
+			t.Fatalf("expected 7 messages; got %d, %v", len(items), err)
+		}
+		want := 4
+		if retention > 0 {
+			want = 5
+		}
+		items, err := db.Get(NewQuery(topic).AsOf(epoch).WithLimit(100))
+		if len(items) != want || err != nil {
+			t.Fatalf("retention %s: expected %d messages as of epoch; got %d, %v", retention, want, len(items), err)
+		}
+		for _, item := range items {
+			if string(item) > "msg.4" {
+				t.Fatalf("unexpected message %s put after epoch", item)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTx(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic1, topic2 := []byte("tx.topic1"), []byte("tx.topic2")
+	id := db.NewID()
+	if err := db.PutEntry(NewEntry(topic1, []byte("stored")).WithID(id)); err != nil {
+		t.Fatal(err)
+	}
+	count := func(get func(*Query) ([][]byte, error), topic []byte) int {
+		items, err := get(NewQuery(topic).WithLimit(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(items)
+	}
+
+	tx, err := db.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(topic1, []byte("tx.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(topic2, []byte("tx.2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete(id, topic1); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(tx.Get, topic1); n != 1 {
+		t.Fatalf("tx: expected 1 message read from own writes; got %d", n)
+	}
+	if n := count(db.Get, topic1); n != 1 {
+		t.Fatalf("db: expected 1 stored message before commit; got %d", n)
+	}
+	if n := count(db.Get, topic2); n != 0 {
+		t.Fatalf("db: expected no message before commit; got %d", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := db.Get(NewQuery(topic1).WithLimit(10)); len(items) != 1 || string(items[0]) != "tx.1" || err != nil {
+		t.Fatalf("db: unexpected messages after commit %q, %v", items, err)
+	}
+	if n := count(db.Get, topic2); n != 1 {
+		t.Fatalf("db: expected 1 message after commit; got %d", n)
+	}
+	if err := tx.Commit(); err != errTxClosed {
+		t.Fatalf("expected transaction closed error; got %v", err)
+	}
+
+	tx, err = db.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(topic2, []byte("rollback")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(db.Get, topic2); n != 1 {
+		t.Fatalf("db: expected 1 message after rollback; got %d", n)
+	}
+}
+
+func TestTxAtomicCommit(t *testing.T) {
+	cleanup()
+	errDenied := errors.New("delete denied")
+	protected := []byte("tx.protected")
+	authorizer := func(contract uint32, topic []byte, op Op) error {
+		if op == OpDelete && bytes.Equal(topic, protected) {
+			return errDenied
+		}
+		return nil
+	}
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithQueryAuthorizer(authorizer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Close()
+		cleanup()
+	}()
+
+	topic := []byte("tx.topic")
+	id, protectedID := db.NewID(), db.NewID()
+	if err := db.PutEntry(NewEntry(topic, []byte("stored")).WithID(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry(protected, []byte("stored")).WithID(protectedID)); err != nil {
+		t.Fatal(err)
+	}
+	count := func(topic []byte) int {
+		items, err := db.Get(NewQuery(topic).WithLimit(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(items)
+	}
+
+	// a failed delete fails the commit without applying the puts and the deletes.
+	tx, err := db.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(topic, []byte("tx.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete(id, topic); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete(protectedID, protected); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != errDenied {
+		t.Fatalf("expected delete denied error; got %v", err)
+	}
+	if items, err := db.Get(NewQuery(topic).WithLimit(10)); len(items) != 1 || string(items[0]) != "stored" || err != nil {
+		t.Fatalf("db: unexpected messages after failed commit %q, %v", items, err)
+	}
+	if n := count(protected); n != 1 {
+		t.Fatalf("db: expected 1 protected message after failed commit; got %d", n)
+	}
+
+	// puts and deletes are committed together.
+	tx, err = db.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(topic, []byte("tx.2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete(id, topic); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := db.Get(NewQuery(topic).WithLimit(10)); len(items) != 1 || string(items[0]) != "tx.2" || err != nil {
+		t.Fatalf("db: unexpected messages after commit %q, %v", items, err)
+	}
+
+	// a delete record committed to the WAL is replayed on sync if the delete is not applied on commit.
+	syncAll := func() {
+		for i := 0; i < 20; i++ {
+			time.Sleep(100 * time.Millisecond)
+			if err := db.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+				break
+			}
+		}
+	}
+	txID := db.NewID()
+	if err := db.PutEntry(NewEntry(topic, []byte("tx.3")).WithID(txID)); err != nil {
+		t.Fatal(err)
+	}
+	syncAll()
+	b := db.batch()
+	if err := b.Put(topic, []byte("tx.4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete(txID, topic); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	// commit the batch to the WAL without applying the deletes.
+	if err := b.mem.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.internal.inFlight.add(b.count, db.internal.meter.Unsynced)
+	b.Abort()
+	if items, err := db.Get(NewQuery(topic).WithLimit(10)); len(items) != 3 || err != nil {
+		t.Fatalf("db: unexpected messages before delete record is replayed %q, %v", items, err)
+	}
+	syncAll()
+	if items, err := db.Get(NewQuery(topic).WithLimit(10)); len(items) != 2 || string(items[0]) != "tx.4" || string(items[1]) != "tx.2" || err != nil {
+		t.Fatalf("db: unexpected messages after delete record is replayed %q, %v", items, err)
+	}
+}
+
+func TestInFlightStats(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("inflight.topic1")
+	for i := 0; i < 3; i++ {
+		if err := db.Put(topic, []byte("msg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		for i := 0; i < 2; i++ {
+			if err := b.Put(topic, []byte("batch")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.InFlight.Unsynced != 5 {
+		t.Fatalf("expected 5 unsynced entries, got %d", s.InFlight.Unsynced)
+	}
+	if s.InFlight.SyncLag <= 0 {
+		t.Fatalf("expected sync lag for unsynced entries, got %v", s.InFlight.SyncLag)
+	}
+	if v, _ := db.Varz(); v.Unsynced != 5 {
+		t.Fatalf("expected 5 unsynced entries in varz, got %d", v.Unsynced)
+	}
+
+	// Entries are synced once the time block is committed to the log.
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err = db.Stats(); err != nil {
+			t.Fatal(err)
+		}
+		if s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if s.InFlight.Unsynced != 0 || s.InFlight.SyncLag != 0 || s.InFlight.LastSync.IsZero() {
+		t.Fatalf("expected entries synced, got %+v", s.InFlight)
+	}
+}
+
+func TestLockTakeover(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("%s/%s.lock", dbPath, prefix)
+	if owner, ok := readLockOwner(name); !ok || owner.pid != os.Getpid() {
+		t.Fatalf("expected lock owner %d, got %+v", os.Getpid(), owner)
+	}
+
+	// The lock held is never taken over.
+	if _, err := Open(dbPath, WithLockTakeover()); err != errLocked {
+		t.Fatalf("expected errLocked for lock held, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); err != nil {
+		t.Fatalf("expected lock file kept on close, got %v", err)
+	}
+	if owner, ok := readLockOwner(name); ok {
+		t.Fatalf("expected lock owner cleared on close, got %+v", owner)
+	}
+
+	// The lock file left by a crashed process records the owner.
+	if err := ioutil.WriteFile(name, _LockOwner{pid: 1 << 30, bootID: bootID()}.marshal(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner, ok := readLockOwner(name); !ok || owner.pid != os.Getpid() {
+		t.Fatalf("expected lock owner %d, got %+v", os.Getpid(), owner)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type _TestCompressor struct{}
+
+func (_TestCompressor) Encode(dst, src []byte) []byte {
+	return append(dst, src...)
+}
+
+func (_TestCompressor) Decode(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func TestCompression(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithCompression(CodecDeflate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic := []byte("compression.topic1")
+	payload := bytes.Repeat([]byte(`{"sensor":"temperature","value":21.5}`), 16)
+	codecs := []Codec{CodecDefault, CodecSnappy, CodecNone, CodecDeflate}
+	for _, codec := range codecs {
+		if err := db.PutEntry(NewEntry(topic, payload).WithCompression(codec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.PutEntry(NewEntry(topic, payload).WithCompression(CodecZstd)); err != errBadCodec {
+		t.Fatalf("expected errBadCodec for unregistered codec, got %v", err)
+	}
+	defer func() {
+		compressors.Lock()
+		delete(compressors.m, CodecZstd)
+		compressors.Unlock()
+	}()
+	if err := RegisterCompressor(CodecZstd, _TestCompressor{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry(topic, payload).WithCompression(CodecZstd)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	items, err := db.Get(NewQuery(topic).WithLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(codecs)+1 {
+		t.Fatalf("expected %d items, got %d", len(codecs)+1, len(items))
+	}
+	for _, item := range items {
+		if !bytes.Equal(item, payload) {
+			t.Fatalf("expected payload %q, got %q", payload, item)
+		}
+	}
+	if val, err := compress(CodecDeflate, payload); err != nil || len(val) >= len(payload)/5 {
+		t.Fatalf("expected deflate to compress payload 5x, got %d bytes of %d: %v", len(val), len(payload), err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMetadata(map[string]string{"app": "sensors", "schema": "v1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := db.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md["app"] != "sensors" || md["schema"] != "v1" || md[MetadataCreatedAt] == "" {
+		t.Fatalf("unexpected metadata %v", md)
+	}
+	createdAt := md[MetadataCreatedAt]
+	for i := 0; i < 3; i++ {
+		if err := db.SetMetadata("schema", fmt.Sprintf("v%d", i+2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetMetadata("app", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetMetadata("blob", string(make([]byte, metadataSlotSz))); err != errMetadataTooLarge {
+		t.Fatalf("expected errMetadataTooLarge, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMetadata(map[string]string{"region": "eu"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	md, err = db.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{MetadataCreatedAt: createdAt, "schema": "v4", "region": "eu"}
+	if !reflect.DeepEqual(md, expected) {
+		t.Fatalf("expected metadata %v, got %v", expected, md)
+	}
+}
+
+func TestEncryptor(t *testing.T) {
+	cleanup()
+	newGCM := func() cipher.AEAD {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aead
+	}
+	aead1, aead2 := newGCM(), newGCM()
+	enc, err := NewAEADEncryptor(aead1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithEncryption(), WithEncryptor(enc), WithCompression(CodecNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, payload := []byte("encryptor.topic1"), []byte("plaintext-payload-1")
+	if err := db.Put(topic, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RotateKey(make([]byte, 32), nil); err != errBadRequest {
+		t.Fatalf("expected errBadRequest rotating key of encryptor, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dbPath, "data", "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected data files, got %v: %v", files, err)
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, payload) {
+			t.Fatal("expected payload encrypted in the data file")
+		}
+	}
+
+	// Messages encrypted using the earlier key are decrypted after adding a key.
+	if enc, err = NewAEADEncryptor(aead1, aead2); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithEncryption(), WithEncryptor(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put(topic, []byte("plaintext-payload-2")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := db.Get(NewQuery(topic).WithLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || string(items[0]) != "plaintext-payload-2" || string(items[1]) != "plaintext-payload-1" {
+		t.Fatalf("unexpected items %q", items)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	cleanup()
+	contract := uint32(0x1234)
+	payload := bytes.Repeat([]byte("q"), 100)
+	// Stored size of the entry is the message ID, the packed payload and the topic on first entry of the topic.
+	size := int64(idSize + 2 + len(payload))
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable(), WithCompression(CodecNone)}
+	db, err := Open(dbPath, append(opts, WithContractQuota(contract, 5*size))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("quota.topic1")
+	if err := db.Put(topic, payload); err != nil {
+		t.Fatal(err)
+	}
+	var ids [][]byte
+	for {
+		id := db.NewID()
+		err := db.PutEntry(NewEntry(topic, payload).WithID(id).WithContract(contract))
+		var quotaErr *QuotaError
+		if errors.As(err, &quotaErr) && quotaErr.Limit == LimitStoredBytes {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 4 {
+		t.Fatalf("expected 4 entries within quota, got %d", len(ids))
+	}
+	if err := db.DeleteEntry(NewEntry(topic, nil).WithID(ids[1]).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry(topic, payload).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := s.Usage[contract]
+	if usage > 5*size || s.Usage[message.MasterContract] == 0 {
+		t.Fatalf("unexpected usage %v", s.Usage)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Usage is persisted and the oldest entries are evicted.
+	db, err = Open(dbPath, append(opts, WithQuota(5*size, QuotaEvict))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if s, err = db.Stats(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Usage[contract] != usage {
+		t.Fatalf("expected persisted usage %d, got %d", usage, s.Usage[contract])
+	}
+	for i := 0; i < 10; i++ {
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("%0100d", i))).WithContract(contract)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := db.Get(NewQuery(topic).WithContract(contract).WithLimit(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 || string(items[0]) != fmt.Sprintf("%0100d", 9) || string(items[4]) != fmt.Sprintf("%0100d", 5) {
+		t.Fatalf("expected 5 latest items, got %d", len(items))
+	}
+}
+
+func TestDeleteTopic(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic1, topic2 := []byte("purge.topic1"), []byte("purge.topic2")
+	for i := 0; i < 500; i++ {
+		if err := db.Put(topic1, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(topic2, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// entries not yet synced are deleted along with entries on disk.
+	for i := 0; i < 10; i++ {
+		if err := db.Put(topic1, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteTopic([]byte("purge.*")); err != errBadRequest {
+		t.Fatalf("expected errBadRequest for wildcard topic, got %v", err)
+	}
+	if err := db.DeleteTopic(topic1); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := db.Get(NewQuery(topic1).WithLimit(1000)); err != nil || len(items) != 0 {
+		t.Fatalf("expected no items, got %d, err %v", len(items), err)
+	}
+	if items, err := db.Get(NewQuery(topic2).WithLimit(1000)); err != nil || len(items) != 500 {
+		t.Fatalf("expected 500 items, got %d, err %v", len(items), err)
+	}
+	if count := db.Count(); count != 500 {
+		t.Fatalf("expected count 500, got %d", count)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// topic is not loaded on open and is created again on put.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if items, err := db.Get(NewQuery(topic1).WithLimit(1000)); err != nil || len(items) != 0 {
+		t.Fatalf("expected no items after reopen, got %d, err %v", len(items), err)
+	}
+	if err := db.Put(topic1, []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := db.Get(NewQuery(topic1).WithLimit(1000)); err != nil || len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d, err %v", len(items), err)
+	}
+}
+
+func TestCreateTopic(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithDeclaredTopics()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("teams.alpha.ch1"), []byte("msg")); err != errTopicNotDeclared {
+		t.Fatalf("expected errTopicNotDeclared, got %v", err)
+	}
+	if err := db.CreateTopic([]byte("teams.alpha...")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTopic([]byte("teams.beta.ch1"), WithTopicRetention(time.Hour), WithTopicCompression(CodecNone)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("teams.alpha.ch1"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEntry([]byte("teams.beta.ch1"), []byte("msg"))
+	if err := db.PutEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ExpiresAt == 0 || e.Compression != CodecNone {
+		t.Fatalf("expected topic settings applied to entry, got expiresAt %d codec %d", e.ExpiresAt, e.Compression)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// declared topics are persisted.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("teams.alpha.ch2"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("teams.beta.ch2"), []byte("msg")); err != errTopicNotDeclared {
+		t.Fatalf("expected errTopicNotDeclared, got %v", err)
+	}
+	err = db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		return b.Put([]byte("teams.gamma.ch1"), []byte("msg"))
+	})
+	if err != errTopicNotDeclared {
+		t.Fatalf("expected errTopicNotDeclared for batch, got %v", err)
+	}
+	if items, err := db.Get(NewQuery([]byte("teams.beta.ch1"))); err != nil || len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d, err %v", len(items), err)
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("range.topic1")
+	now := time.Now()
+	// newID returns message ID with the time of the message set to the time before now.
+	newID := func(before time.Duration) []byte {
+		id := db.NewID()
+		binary.LittleEndian.PutUint32(id[0:4], math.MaxUint32-uint32(now.Add(-before).Unix()-uid.Offset))
+		return id
+	}
+	for _, before := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour} {
+		for i := 0; i < 10; i++ {
+			if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("msg.%d", i))).WithID(newID(before))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// entries not yet synced are deleted along with entries on disk.
+	for i := 0; i < 10; i++ {
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("msg.%d", i))).WithID(newID(2 * time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteRange(topic, now.Add(-150*time.Minute), now.Add(-90*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := db.Get(NewQuery(topic).WithLimit(100)); err != nil || len(items) != 20 {
+		t.Fatalf("expected 20 items, got %d, err %v", len(items), err)
+	}
+	if err := db.DeleteRange(topic, time.Time{}, now.Add(-150*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if items, err := db.Get(NewQuery(topic).WithLimit(100)); err != nil || len(items) != 10 {
+		t.Fatalf("expected 10 items after reopen, got %d, err %v", len(items), err)
+	}
+}
+
+func TestTopicConfig(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("config.topic1")
+	if err := db.CreateTopic(topic, WithTopicConfig(TopicConfig{MaxEntries: 5, DedupWindow: time.Minute, Compression: CodecDeflate})); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(topic, []byte("msg.first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// topic config is persisted.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 2; i++ {
+		e := NewEntry(topic, []byte("msg.dup"))
+		if err := db.PutEntry(e); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && e.Compression != CodecDeflate {
+			t.Fatalf("expected topic codec applied to entry, got %d", e.Compression)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := db.Get(NewQuery(topic).WithLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 10 {
+		t.Fatalf("expected duplicate entry dropped, got %d items", len(items))
+	}
+	if err := db.expireEntries(); err != nil {
+		t.Fatal(err)
+	}
+	if items, err = db.Get(NewQuery(topic).WithLimit(100)); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 || string(items[0]) != "msg.7" || string(items[4]) != "msg.3" {
+		t.Fatalf("expected 5 latest items, got %q", items)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	newID := func(before time.Duration) []byte {
+		id := db.NewID()
+		binary.LittleEndian.PutUint32(id[0:4], math.MaxUint32-uint32(now.Add(-before).Unix()-uid.Offset))
+		return id
+	}
+	topics := [][]byte{[]byte("retention.ch1"), []byte("retention.ch2"), []byte("other.ch1")}
+	for _, topic := range topics {
+		for _, before := range []time.Duration{3 * time.Hour, 10 * time.Minute} {
+			for i := 0; i < 5; i++ {
+				if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("msg.%d", i))).WithID(newID(before))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRetention([]byte("retention..."), time.Hour, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.applyRetention(); err != nil {
+		t.Fatal(err)
+	}
+	for i, topic := range topics {
+		expected := 3
+		if i == 2 {
+			expected = 10
+		}
+		if items, err := db.Get(NewQuery(topic).WithLimit(100)); err != nil || len(items) != expected {
+			t.Fatalf("expected %d items of topic %s, got %d, err %v", expected, topic, len(items), err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// retention policies are persisted and removed if max age and max count are zero.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if policies := db.internal.retention.snapshot(); len(policies) != 1 || policies[0].maxCount != 3 {
+		t.Fatalf("expected persisted retention policy, got %v", policies)
+	}
+	if err := db.SetRetention([]byte("retention..."), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if policies := db.internal.retention.snapshot(); len(policies) != 0 {
+		t.Fatalf("expected retention policy removed, got %v", policies)
+	}
+}
+
+func TestWalkTopics(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16)}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{"teams.alpha.ch1": 3, "teams.alpha.ch2": 2, "teams.beta.ch1": 4}
+	for topic, n := range counts {
+		for i := 0; i < n; i++ {
+			if err := db.Put([]byte(topic), []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		return b.Put([]byte("devices.d1?ttl=1h"), []byte("msg"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// names of the topic parts are loaded on open.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	nodes := make(map[string]TopicNode)
+	if err := db.WalkTopics(nil, func(node TopicNode) bool {
+		nodes[string(node.Topic)] = node
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 8 {
+		t.Fatalf("expected 8 nodes, got %d", len(nodes))
+	}
+	if n := nodes["teams"]; n.Children != 2 || n.Topics != 3 || n.Entries != 9 {
+		t.Fatalf("unexpected teams node %+v", n)
+	}
+	if n := nodes["teams.alpha.ch1"]; n.Name != "ch1" || n.Depth != 3 || n.Children != 0 || n.Entries != 3 {
+		t.Fatalf("unexpected teams.alpha.ch1 node %+v", n)
+	}
+	if n := nodes["devices.d1"]; n.Entries != 1 {
+		t.Fatalf("unexpected devices.d1 node %+v", n)
+	}
+
+	// subtree of a node is skipped if fn returns false.
+	var topics []string
+	if err := db.WalkTopics([]byte("teams"), func(node TopicNode) bool {
+		topics = append(topics, string(node.Topic))
+		return node.Name != "alpha"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 3 || topics[0] != "teams.alpha" || topics[1] != "teams.beta" || topics[2] != "teams.beta.ch1" {
+		t.Fatalf("unexpected topics walked %v", topics)
+	}
+	if err := db.WalkTopics([]byte("teams.*"), func(node TopicNode) bool { return true }); err != errBadRequest {
+		t.Fatalf("expected errBadRequest for wildcard prefix, got %v", err)
+	}
+}
+
+func TestStorageStats(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("storage.topic1")
+	for i := 0; i < 10; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Get(NewQuery(topic).WithLimit(10)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Storage.CacheHits != 10 || s.Storage.CacheHitRate != 1 {
+		t.Fatalf("expected entries read from mem store, got %+v", s.Storage)
+	}
+	// Entries are synced once the time block is committed to the log.
+	for i := 0; i < 20 && s.Storage.Entries == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err = db.Stats(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Storage.Entries != 10 || s.Storage.Syncs != 10 || s.Storage.IndexSize == 0 || s.Storage.DataSize == 0 || s.Storage.WindowSize == 0 {
+		t.Fatalf("expected entries synced to DB files, got %+v", s.Storage)
+	}
+	if s.Storage.Fragmentation < 0 || s.Storage.Fragmentation > 1 {
+		t.Fatalf("expected fragmentation in range, got %v", s.Storage.Fragmentation)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	cleanup()
+	workload := filepath.Join(os.TempDir(), "unitdb-workload")
+	defer os.Remove(workload)
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, append(opts, WithRecorder(workload, 1))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids [][]byte
+	for i := 0; i < 10; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry([]byte("recorder.topic1"), []byte(fmt.Sprintf("msg.%d", i))).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(ids[0], []byte("recorder.topic1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(NewQuery([]byte("recorder.topic1")).WithLimit(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// workload is replayed against a fresh DB.
+	cleanup()
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stats, err := db.Replay(workload, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Puts != 10 || stats.Syncs != 1 || stats.Deletes != 1 || stats.Gets != 1 || stats.Errors != 0 {
+		t.Fatalf("unexpected replay stats %+v", stats)
+	}
+	if items, err := db.Get(NewQuery([]byte("recorder.topic1")).WithLimit(100)); err != nil || len(items) != 9 {
+		t.Fatalf("expected 9 items replayed, got %d, err %v", len(items), err)
+	}
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) RecordError(err error)                      { s.err = err }
+func (s *testSpan) End()                                       { s.ended = true }
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &testSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func (t *testTracer) find(name string) *testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	cleanup()
+	tracer := &testTracer{}
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	if err := db.PutContext(ctx, []byte("tracing.topic1"), []byte("msg.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutContext(ctx, []byte("tracing.topic1"), nil); err == nil {
+		t.Fatal("expected error putting empty payload")
+	}
+	if err := db.SyncContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetContext(ctx, NewQuery([]byte("tracing.topic1"))); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{spanRecover, spanPut, spanSync, spanGet} {
+		s := tracer.find(name)
+		if s == nil || !s.ended {
+			t.Fatalf("expected span %s ended", name)
+		}
+	}
+	if s := tracer.find(spanPut); s.attrs["unitdb.topic"] != "tracing.topic1" {
+		t.Fatalf("unexpected put span attributes %v", s.attrs)
+	}
+	if s := tracer.find(spanSync); s.attrs["unitdb.unsynced"] == nil || s.attrs["unitdb.wal_size"] == nil {
+		t.Fatalf("unexpected sync span attributes %v", s.attrs)
+	}
+	var failed bool
+	tracer.mu.Lock()
+	for _, s := range tracer.spans {
+		if s.name == spanPut && s.err == errValueEmpty {
+			failed = true
+		}
+	}
+	tracer.mu.Unlock()
+	if !failed {
+		t.Fatal("expected error recorded on put span")
+	}
+}
+
+func TestChunking(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable(), WithChunkSize(16)}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("chunking.topic1")
+	payload := make([]byte, 100)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	id := db.NewID()
+	if err := db.PutEntry(NewEntry(topic, payload).WithID(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(topic, []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := db.Get(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || !bytes.Equal(items[1], payload) {
+		t.Fatalf("expected chunked payload reassembled, got %d items", len(items))
+	}
+	// Entries are synced once the time block is committed to the log.
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	items, err = db.Get(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || !bytes.Equal(items[1], payload) {
+		t.Fatalf("expected chunked payload reassembled after reopen, got %d items", len(items))
+	}
+	count := db.Count()
+	if err := db.Delete(id, topic); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Count(); n != count-8 {
+		t.Fatalf("expected message and its 7 chunks deleted, count %d before %d after", count, n)
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("encoding.topic1")
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte("compressed by producer"))
+	w.Close()
+	gz := buf.Bytes()
+
+	msgC, cancel, err := db.Watch(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if err := db.PutEntry(NewEntry(topic, gz).WithContentEncoding("gzip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry(topic, gz).WithHeaders(map[string]string{HeaderContentEncoding: "gzip"})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-msgC:
+			if !bytes.Equal(m.Payload, gz) || m.Headers[HeaderContentEncoding] != "gzip" {
+				t.Fatalf("expected gzip payload passed through to watcher, got headers %v", m.Headers)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected message delivered to watcher")
+		}
+	}
+	items, err := db.Get(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || !bytes.Equal(items[0], gz) || !bytes.Equal(items[1], gz) {
+		t.Fatalf("expected gzip payloads returned as is, got %d items", len(items))
+	}
+	if err := RegisterCompressor(CodecGzip, _NoneCompressor{}); err != errBadCodec {
+		t.Fatalf("expected gzip codec not registrable, got %v", err)
+	}
+}
+
+func TestGetByID(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	contract, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids [][]byte
+	for i := 0; i < 3; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry([]byte("byid.topic1"), []byte(fmt.Sprintf("msg.%d", i))).WithID(id).WithContract(contract)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	for i, id := range ids {
+		val, err := db.GetByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != fmt.Sprintf("msg.%d", i) {
+			t.Fatalf("unexpected payload %s", val)
+		}
+	}
+	if _, err := db.GetByID(ids[0][:8]); err != errBadRequest {
+		t.Fatalf("expected bad request for short id, got %v", err)
+	}
+	if err := db.DeleteByID(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetByID(ids[1]); err != errMsgIDDoesNotExist {
+		t.Fatalf("expected deleted message not found, got %v", err)
+	}
+	items, err := db.Get(NewQuery([]byte("byid.topic1")).WithContract(contract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items after delete by id, got %d", len(items))
+	}
+}
+
+func TestReindex(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var ids [][]byte
+	for i := 0; i < 10; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry([]byte("reindex.topic1"), []byte(fmt.Sprintf("msg.%d", i))).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+
+	// make the derived structures stale.
+	db.internal.count.store(100)
+	db.internal.filter.reset(fltr.NewFilterGenerator())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.Reindex(ctx, nil); err != context.Canceled {
+		t.Fatalf("expected reindex canceled, got %v", err)
+	}
+	var done, total int
+	report, err := db.Reindex(context.Background(), func(d, n int) { done, total = d, n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entries != 10 || report.Count != 100 || db.Count() != 10 {
+		t.Fatalf("unexpected reindex report %+v, count %d", report, db.Count())
+	}
+	if total == 0 || done != total {
+		t.Fatalf("expected progress reported, got %d of %d", done, total)
+	}
+	for _, id := range ids {
+		if !db.internal.filter.Test(message.ID(id).Sequence()) {
+			t.Fatal("expected entry in rebuilt filter")
+		}
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	cleanup()
+	restorePath := filepath.Join(os.TempDir(), "unitdb-restore")
+	os.RemoveAll(restorePath)
+	defer os.RemoveAll(restorePath)
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("backup.topic1")
+	for i := 0; i < 5; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	// entries not yet synced are archived from the mem store.
+	for i := 5; i < 8; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := db.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+	if err := Restore(restorePath, bytes.NewReader(archive)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(restorePath, bytes.NewReader(archive)); err != errPathNotEmpty {
+		t.Fatalf("expected restore to non empty path rejected, got %v", err)
+	}
+	restored, err := Open(restorePath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	items, err := restored.Get(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 8 {
+		t.Fatalf("expected 8 items restored, got %d", len(items))
+	}
+}
+
+func TestRestoreToTime(t *testing.T) {
+	cleanup()
+	archivePath := filepath.Join(os.TempDir(), "unitdb-archive")
+	restorePath := filepath.Join(os.TempDir(), "unitdb-pitr")
+	os.RemoveAll(archivePath)
+	os.RemoveAll(restorePath)
+	defer os.RemoveAll(archivePath)
+	defer os.RemoveAll(restorePath)
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithWALArchive(archivePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("pitr.topic1")
+	sync := func() {
+		for i := 0; i < 20; i++ {
+			time.Sleep(100 * time.Millisecond)
+			if err := db.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+				break
+			}
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync()
+	time.Sleep(100 * time.Millisecond)
+	restoreTime := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	for i := 5; i < 8; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(restorePath, WithRestoreToTime(restoreTime)); err != errArchiveNotSet {
+		t.Fatalf("expected restore without archive rejected, got %v", err)
+	}
+	restored, err := Open(restorePath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithWALArchive(archivePath), WithRestoreToTime(restoreTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	items, err := restored.Get(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 {
+		t.Fatalf("expected 5 items restored to time, got %d", len(items))
+	}
+}
+
+func TestAbortTimeID(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithAbortTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// simulate a batch writer crash between write and commit.
+	stuck := func(topic []byte) {
+		b := db.batch()
+		for i := 0; i < 3; i++ {
+			if err := b.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.Write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	topic := []byte("abort.topic1")
+	stuck(topic)
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.InFlight.Uncommitted) == 0 {
+		t.Fatal("expected uncommitted time IDs")
+	}
+	for _, timeID := range s.InFlight.Uncommitted {
+		if err := db.AbortTimeID(timeID); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AbortTimeID(timeID); err != errTimeIDNotFound {
+			t.Fatalf("expected abort of aborted time ID rejected, got %v", err)
+		}
+	}
+	items, err := db.Get(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected entries of aborted time ID removed, got %d", len(items))
+	}
+
+	// committed batches are not aborted.
+	if err := db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		return b.Put(topic, []byte("msg.committed"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// stuck time IDs are aborted after the abort timeout.
+	stuck([]byte("abort.topic2"))
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if s, err = db.Stats(); err != nil || len(s.InFlight.Uncommitted) == 0 {
+			break
+		}
+	}
+	if len(s.InFlight.Uncommitted) != 0 {
+		t.Fatalf("expected uncommitted time IDs aborted, got %v", s.InFlight.Uncommitted)
+	}
+	if items, err = db.Get(NewQuery([]byte("abort.topic2"))); err != nil || len(items) != 0 {
+		t.Fatalf("expected entries of aborted time ID removed, got %d %v", len(items), err)
+	}
+	if items, err = db.Get(NewQuery(topic)); err != nil || len(items) != 1 {
+		t.Fatalf("expected committed entry, got %d %v", len(items), err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var want []string
+	put := func(topic string, i int) {
+		payload := fmt.Sprintf("%s.msg.%d", topic, i)
+		if err := db.Put([]byte(topic), []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, topic+"/"+payload)
+	}
+	for i := 0; i < 4; i++ {
+		put("changes.topic1", i)
+		put("changes.topic2", i)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	// changes not yet synced are yielded after the synced changes.
+	for i := 4; i < 6; i++ {
+		put("changes.topic1", i)
+	}
+	changes := func(since uint64) (got []string, seqs []uint64) {
+		it, err := db.Changes(since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for it.Next() {
+			c := it.Change()
+			got = append(got, string(c.Topic)+"/"+string(c.Payload))
+			seqs = append(seqs, c.Seq)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got, seqs
+	}
+	got, seqs := changes(0)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected changes %v, got %v", want, got)
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] <= seqs[i-1] {
+			t.Fatalf("expected changes in commit order, got %v", seqs)
+		}
+	}
+	got, _ = changes(seqs[4])
+	if !reflect.DeepEqual(got, want[5:]) {
+		t.Fatalf("expected changes %v, got %v", want[5:], got)
+	}
+	if got, _ = changes(seqs[len(seqs)-1]); len(got) != 0 {
+		t.Fatalf("expected no changes, got %v", got)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	cleanup()
+	replicaPath := dbPath + "-replica"
+	os.RemoveAll(replicaPath)
+	defer os.RemoveAll(replicaPath)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	leader, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithReplication(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Close()
+	topic := []byte("replication.topic")
+	for i := 0; i < 5; i++ {
+		if err := leader.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leader.Sync()
+	follower, err := Open(replicaPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithReplicaOf(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+	waitFor := func(n int) {
+		for i := 0; i < 50; i++ {
+			if items, err := follower.Get(NewQuery(topic).WithLimit(100)); err == nil && len(items) == n {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("expected %d entries replicated to the follower", n)
+	}
+	waitFor(5)
+	// entries committed on the leader after the follower connects are streamed.
+	for i := 5; i < 8; i++ {
+		if err := leader.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(8)
+	if err := follower.Put(topic, []byte("msg")); err != errReplica {
+		t.Fatalf("expected put on follower to fail with %v, got %v", errReplica, err)
+	}
+}
+
+func TestTimeMarkStats(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithTimeBlockDuration(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("timemark.topic1")
+	for i := 0; i < 10; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := db.batch()
+	if err := b.Put(topic, []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var released int64
+	for _, bucket := range s.TimeMark.ReleaseLatency {
+		released += bucket.Count
+	}
+	if released == 0 {
+		t.Fatal("expected release latency of released time IDs")
+	}
+	if len(s.TimeMark.ReleaseLatency) == 0 || s.TimeMark.ReleaseLatency[len(s.TimeMark.ReleaseLatency)-1].UpperBound != 0 {
+		t.Fatalf("expected last release latency bucket unbounded, got %v", s.TimeMark.ReleaseLatency)
+	}
+	for _, timeID := range s.InFlight.Uncommitted {
+		if err := db.AbortTimeID(timeID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, err = db.Stats(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.TimeMark.Aborted) == 0 {
+		t.Fatal("expected aborted time IDs")
+	}
+}
+
+func TestTargetVisibilityLatency(t *testing.T) {
+	cleanup()
+	latency := 200 * time.Millisecond
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithTargetVisibilityLatency(latency))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.opts.logInterval+db.opts.timeBlockDuration+db.opts.syncDurationType*time.Duration(db.opts.maxSyncDurations) > latency {
+		t.Fatalf("expected tuned intervals within the latency %v", latency)
+	}
+	topic := []byte("visibility.topic1")
+	for i := 0; i < 10; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// entries are synced by the background sync without calling Sync.
+	for i := 0; i < 20; i++ {
+		time.Sleep(latency / 2)
+		if s, err := db.Stats(); err == nil && s.InFlight.Unsynced == 0 {
+			return
+		}
+	}
+	t.Fatal("expected entries synced within the target latency")
+}
+
+func TestSyncChunks(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithSyncChunkSize(10, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("chunks.topic1")
+	n := 55
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if c := db.internal.meter.SyncChunks.Count(); c == 0 {
+		t.Fatal("expected sync committed in chunks")
+	}
+	if c := db.Count(); c != uint64(n) {
+		t.Fatalf("expected %d entries synced, got %d", n, c)
+	}
+	items, err := db.Get(NewQuery(topic).WithLimit(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != n {
+		t.Fatalf("expected %d entries, got %d", n, len(items))
+	}
+}
+
+func TestSyncRollback(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("rollback.topic1")
+	n := 10
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	entries, err := db.changeEntries(0)
+	if err != nil || len(entries) != n {
+		t.Fatalf("expected %d entries synced, got %d, err %v", n, len(entries), err)
+	}
+	topicHash := entries[0].topicHash
+	topicOff, _ := db.internal.trie.getOffset(topicHash)
+	seq := uint64(n + 5)
+
+	// inject a failure after the leased blocks are written and before the sync is complete.
+	bw, err := newBlockWriter(db.fs, db.internal.freeList, db.internal.bufPool.Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.append(_IndexEntry{seq: seq, valueSize: 3, cache: []byte("xyz")}); err != nil {
+		t.Fatal(err)
+	}
+	ww, err := newWindowWriter(db.fs, db.internal.bufPool.Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ww.append(topicHash, topicOff, _WindowEntries{newWinEntry(seq, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.write(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ww.write(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.abort(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ww.abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := _BlockReader{indexFile: bw.indexFile, offset: blockOffset(blockIndex(seq))}
+	b, err := r.readIndexBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(b.entryIdx); i++ {
+		if b.entries[i].seq == seq {
+			t.Fatal("expected leased index block restored on abort")
+		}
+	}
+	wr := _WindowReader{winFile: ww.winFile, offset: topicOff}
+	wb, err := wr.readWindowBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(wb.entryIdx); i++ {
+		if wb.entries[i].sequence == seq {
+			t.Fatal("expected leased window block restored on abort")
+		}
+	}
+	if c := db.Count(); c != uint64(n) {
+		t.Fatalf("expected %d entries, got %d", n, c)
+	}
+	items, err := db.Get(NewQuery(topic).WithLimit(n + 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != n {
+		t.Fatalf("expected %d entries, got %d", n, len(items))
+	}
+}
+
+func TestWindowChainReopen(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16)}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("chain.topic1")
+	n := 800
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// window block written after the last sync is not committed and is discarded on open.
+	path := filePath(dbPath, _FileDesc{fileType: typeTimeWindow})
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(make([]byte, blockSize), fi.Size()); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if fi2, err := os.Stat(path); err != nil || fi2.Size() != fi.Size() {
+		t.Fatal("expected uncommitted window block discarded on open")
+	}
+	items, err := db.Get(NewQuery(topic).WithLimit(n + 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != n {
+		t.Fatalf("expected %d entries, got %d", n, len(items))
+	}
+}
+
+func TestMissDiagnostics(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("diagnostics.topic1")
+	n := 5
+	for i := 0; i < n; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+
+	// drop the last entry from the index, the filter still reports the entry present.
+	seq := db.Seq()
+	r := newBlockReader(db.fs)
+	r.offset = blockOffset(blockIndex(seq))
+	b, err := r.readIndexBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(b.entryIdx); i++ {
+		if b.entries[i].seq == seq {
+			b.entries[i].seq = 0
+		}
+	}
+	if _, err := r.indexFile.WriteAt(b.marshalBinary(), blockOffset(blockIndex(seq))); err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewQuery(topic).WithLimit(n).WithDiagnostics()
+	items, err := db.Get(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != n-1 {
+		t.Fatalf("expected %d entries, got %d", n-1, len(items))
+	}
+	if d := q.Diagnostics(); d.FilterFalsePositives != 1 || d.IndexMisses != 0 || d.DataReadErrors != 0 {
+		t.Fatalf("unexpected query diagnostics %+v", d)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Misses.FilterFalsePositives != 1 {
+		t.Fatalf("expected filter false positive counted, got %+v", s.Misses)
+	}
+}
+
+func TestReadRetry(t *testing.T) {
+	fs, err := newFile(t.TempDir(), 1, _FileDesc{fileType: typeData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	f := fs._File
+	if _, err := f.slice(0, 16); err != io.EOF {
+		t.Fatalf("expected EOF without read retry, got %v", err)
+	}
+
+	// file is extended concurrently to the read.
+	counter := metrics.NewCounter()
+	f.readRetry = &_ReadRetry{retries: 100, interval: time.Millisecond, counter: counter}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.WriteAt(bytes.Repeat([]byte("a"), 16), 0)
+	}()
+	buf, err := f.slice(0, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, bytes.Repeat([]byte("a"), 16)) {
+		t.Fatal("unexpected data read on retry")
+	}
+	if counter.Count() == 0 {
+		t.Fatal("expected read retried")
+	}
+}
+
+func TestCountReconcile(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.count")
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d.%2d", w, i))); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for i := 0; i < 20 && db.Count() != 100; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.Count() != 100 {
+		t.Fatalf("expected count 100, got %d", db.Count())
+	}
+
+	// drift the logical count.
+	db.internal.count.add(7)
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count != 107 || report.Reconciled != 100 {
+		t.Fatalf("expected count 107 and reconciled 100, got %d and %d", report.Count, report.Reconciled)
+	}
+	if db.Count() != 100 {
+		t.Fatalf("expected count corrected to 100, got %d", db.Count())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cleanup()
+	contract := uint32(0x1234)
+	daily := uint32(0x5678)
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithCompression(CodecNone),
+		WithContractRateLimit(contract, 5, 0), WithContractRateLimit(daily, 0, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	topic := []byte("unit.ratelimit")
+	payload := bytes.Repeat([]byte("r"), 100)
+	for i := 0; i < 5; i++ {
+		if err := db.PutEntry(NewEntry(topic, payload).WithContract(contract)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.PutEntry(NewEntry(topic, payload).WithContract(contract))
+	var quotaErr *QuotaError
+	if !errors.Is(err, ErrQuotaExceeded) || !errors.As(err, &quotaErr) || quotaErr.Limit != LimitMessageRate || quotaErr.Contract != contract {
+		t.Fatalf("expected message rate exceeded, got %v", err)
+	}
+	// other contracts are not limited.
+	for i := 0; i < 10; i++ {
+		if err := db.Put(topic, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// tokens are refilled at the rate.
+	time.Sleep(250 * time.Millisecond)
+	if err := db.PutEntry(NewEntry(topic, payload).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for ; n < 10; n++ {
+		if err := db.PutEntry(NewEntry(topic, payload).WithContract(daily)); err != nil {
+			if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitDailyBytes {
+				t.Fatalf("expected daily bytes exceeded, got %v", err)
+			}
+			break
+		}
+	}
+	if n == 0 || n == 10 {
+		t.Fatalf("expected daily bytes exceeded after a few writes, got %d writes", n)
+	}
+	if db.internal.meter.QuotaRejects.Count() != 2 {
+		t.Fatalf("expected 2 quota rejects, got %d", db.internal.meter.QuotaRejects.Count())
+	}
+}
+
+func TestContracts(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha, err := db.NewContract(WithContractName("alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	beta, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("unit.contracts")
+	if err := db.PutEntry(NewEntry(topic, []byte("msg")).WithContract(alpha)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeContract(message.MasterContract); err != errBadRequest {
+		t.Fatalf("expected master contract not revoked, got %v", err)
+	}
+	if err := db.RevokeContract(alpha); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry(topic, []byte("msg")).WithContract(alpha)); err != errContractRevoked {
+		t.Fatalf("expected put rejected, got %v", err)
+	}
+	if _, err := db.Get(NewQuery(topic).WithContract(alpha)); err != errContractRevoked {
+		t.Fatalf("expected get rejected, got %v", err)
+	}
+	if err := db.PutEntry(NewEntry(topic, []byte("msg")).WithContract(beta)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	contracts, err := db.Contracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts) != 2 || contracts[0].Contract != alpha || contracts[0].Name != "alpha" || !contracts[0].Revoked() ||
+		contracts[1].Contract != beta || contracts[1].Revoked() || contracts[1].CreatedAt.IsZero() {
+		t.Fatalf("unexpected contracts %+v", contracts)
+	}
+	if err := db.PutEntry(NewEntry(topic, []byte("msg")).WithContract(alpha)); err != errContractRevoked {
+		t.Fatalf("expected put rejected after reopen, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(),
+		WithMaxTopicDepth(3), WithMaxQueryLimit(500), WithChunkSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	limits := db.Limits()
+	if limits.MaxTopicDepth != 3 || limits.MaxQueryLimit != 500 || limits.ChunkSize != 1<<20 ||
+		limits.MaxTopicLength != MaxTopicLength || limits.MaxPayloadSize != MaxPayloadSize || limits.SeqsPerIndexBlock != SeqsPerIndexBlock {
+		t.Fatalf("unexpected limits %+v", limits)
+	}
+	// the limits reject the input the DB rejects.
+	for _, topic := range [][]byte{nil, []byte("unit.limits.a.b"), bytes.Repeat([]byte("t"), MaxTopicLength+1)} {
+		err := db.Put(topic, []byte("msg"))
+		if err == nil {
+			t.Fatalf("expected put rejected for topic of size %d", len(topic))
+		}
+		if checkErr := limits.CheckTopic(topic); checkErr == nil || checkErr.Error() != err.Error() {
+			t.Fatalf("expected check topic error %v, got %v", err, checkErr)
+		}
+	}
+	if err := limits.CheckTopic([]byte("unit.limits.a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := limits.CheckPayload(nil); err != db.Put([]byte("unit.limits"), nil) {
+		t.Fatalf("expected check payload error, got %v", err)
+	}
+}
+
+func TestScanContract(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	alpha, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	beta, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids [][]byte
+	for i := 0; i < 400; i++ {
+		topic := []byte(fmt.Sprintf("unit.scan.%d", i%3))
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("alpha.%d", i))).WithID(id).WithContract(alpha)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("beta.%d", i))).WithContract(beta)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if err := db.DeleteEntry(NewEntry([]byte("unit.scan.1"), nil).WithID(ids[1]).WithContract(alpha)); err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []Message
+	if err := db.ScanContract(alpha, func(m Message) bool {
+		msgs = append(msgs, m)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 399 {
+		t.Fatalf("expected 399 messages of the contract, got %d", len(msgs))
+	}
+	for i, m := range msgs {
+		n := i
+		if i >= 1 {
+			n = i + 1
+		}
+		if string(m.Payload) != fmt.Sprintf("alpha.%d", n) || string(m.Topic) != fmt.Sprintf("unit.scan.%d", n%3) || m.Contract != alpha {
+			t.Fatalf("unexpected message %d: %s %s", i, m.Topic, m.Payload)
+		}
+	}
+	var n int
+	if err := db.ScanContract(beta, func(m Message) bool {
+		n++
+		return n < 10
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("expected scan stopped after 10 messages, got %d", n)
+	}
+}
+
+func TestContractStats(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids [][]byte
+	for i := 0; i < 30; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry([]byte(fmt.Sprintf("unit.cstats.%d", i%3)), []byte(fmt.Sprintf("msg.%2d", i))).WithID(id).WithContract(contract)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if err := db.Put([]byte("unit.cstats"), []byte("master")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	stats, err := db.ContractStats(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 30 || stats.Topics != 3 || stats.Bytes == 0 || stats.LastWrite.IsZero() {
+		t.Fatalf("unexpected contract stats %+v", stats)
+	}
+	size := stats.Bytes
+	if err := db.DeleteEntry(NewEntry([]byte("unit.cstats.1"), nil).WithID(ids[1]).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = db.ContractStats(contract); err != nil || stats.Count != 29 || stats.Bytes >= size {
+		t.Fatalf("unexpected contract stats after delete %+v, %v", stats, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// stats are persisted and recounted by reindex.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	persisted, err := db.ContractStats(contract)
+	if err != nil || persisted.Count != 29 || persisted.Bytes != stats.Bytes {
+		t.Fatalf("unexpected persisted contract stats %+v, %v", persisted, err)
+	}
+	master, err := db.ContractStats(0)
+	if err != nil || master.Count != 30 || master.Topics != 1 {
+		t.Fatalf("unexpected master contract stats %+v, %v", master, err)
+	}
+	if _, err := db.Reindex(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if reindexed, err := db.ContractStats(contract); err != nil || reindexed.Count != 29 || reindexed.Bytes != stats.Bytes {
+		t.Fatalf("unexpected reindexed contract stats %+v, %v", reindexed, err)
+	}
+}
+
+func TestErase(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(),
+		WithCompression(CodecNone), WithChunkSize(1<<10), WithTombstoneRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	contract, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		topic := []byte(fmt.Sprintf("unit.erase.%d", i%2))
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("alice-secret.%d", i))).WithContract(contract)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(topic, []byte(fmt.Sprintf("bob.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a large message is stored as chunks.
+	if err := db.Put([]byte("unit.erase.0"), append([]byte("alice-secret."), bytes.Repeat([]byte("x"), 3<<10)...)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	epoch := db.Epoch()
+
+	report, err := db.Erase(func(m Message) bool {
+		return bytes.HasPrefix(m.Payload, []byte("alice-secret."))
+	}, WithEraseOverwrite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Erased != 21 || len(report.IDs) != 21 || report.Scanned != 41 || report.Contracts[contract] != 20 || report.Overwritten == 0 {
+		t.Fatalf("unexpected erase report %+v", report)
+	}
+	for _, topic := range []string{"unit.erase.0", "unit.erase.1"} {
+		for _, contract := range []uint32{0, contract} {
+			items, err := db.Get(NewQuery([]byte(topic)).WithContract(contract).WithLimit(100).AsOf(epoch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range items {
+				if bytes.HasPrefix(item, []byte("alice-secret.")) {
+					t.Fatalf("expected erased message not returned, got %s", item)
+				}
+			}
+		}
+	}
+	data, err := ioutil.ReadFile(filePath(dbPath, _FileDesc{fileType: typeData}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("alice-secret.")) || bytes.Contains(data, bytes.Repeat([]byte("x"), 1<<10)) {
+		t.Fatal("expected erased payloads overwritten in the data file")
+	}
+	if !bytes.Contains(data, []byte("bob.1")) {
+		t.Fatal("expected payloads not erased kept in the data file")
+	}
+}
+
+func TestSecureDelete(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(),
+		WithCompression(CodecNone), WithSecureDelete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("unit.secure")
+	syncAll := func() {
+		for i := 0; i < 20; i++ {
+			time.Sleep(100 * time.Millisecond)
+			if err := db.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+				break
+			}
+		}
+	}
+	var ids [][]byte
+	for i := 0; i < 10; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("secret.%d", i))).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if err := db.Put(topic, []byte(fmt.Sprintf("public.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncAll()
+	for _, id := range ids {
+		if err := db.DeleteEntry(NewEntry(topic, nil).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// freed blocks are zeroed on the next sync.
+	if err := db.Put(topic, []byte("public.next")); err != nil {
+		t.Fatal(err)
+	}
+	syncAll()
+	if db.internal.meter.WipedBytes.Count() == 0 {
+		t.Fatal("expected freed blocks zeroed on sync")
+	}
+	data, err := ioutil.ReadFile(filePath(dbPath, _FileDesc{fileType: typeData}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret.")) {
+		t.Fatal("expected deleted payloads zeroed in the data file")
+	}
+	if !bytes.Contains(data, []byte("public.9")) {
+		t.Fatal("expected payloads not deleted kept in the data file")
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithCompression(CodecNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	topic := []byte("unit.metadata")
+	var ids [][]byte
+	for i := 0; i < 30; i++ {
+		id := db.NewID()
+		e := NewEntry(topic, []byte(fmt.Sprintf("msg.%d", i))).WithID(id)
+		if i%2 == 0 {
+			e.WithTTL([]byte("1h"))
+		}
+		if err := db.PutEntry(e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	check := func() {
+		metas, err := db.GetMetadata(NewQuery(topic).WithLimit(10).WithOrder(OrderAsc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metas) != 10 {
+			t.Fatalf("expected 10 messages; got %d", len(metas))
+		}
+		for i, m := range metas {
+			if !bytes.Equal(m.ID[:8], ids[i][:8]) || m.Seq != message.ID(m.ID).Sequence() || m.Size == 0 {
+				t.Fatalf("unexpected metadata %+v of message %d", m, i)
+			}
+			if (i%2 == 0) == m.ExpiresAt.IsZero() {
+				t.Fatalf("unexpected expiry %v of message %d", m.ExpiresAt, i)
+			}
+			if _, err := db.GetByID(m.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check()
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	check()
+}
+
+func TestFileStats(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Files.Open != nDBFiles || s.Files.ByType["data"] != 1 || s.Files.ByType["lock"] != 1 || s.Files.ProcessOpen < int64(nDBFiles) {
+		t.Fatalf("unexpected file stats %+v", s.Files)
+	}
+	path := dbPath + ".files"
+	defer os.RemoveAll(path)
+	if _, err := Open(path, WithMaxOpenFiles(int(s.Files.ProcessOpen)+nDBFiles-1)); err != errTooManyOpenFiles {
+		t.Fatalf("expected too many open files error; got %v", err)
+	}
+	other, err := Open(path, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithMaxOpenFiles(int(s.Files.ProcessOpen)+nDBFiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = db.Stats(); err != nil || s.Files.ProcessOpen < int64(2*nDBFiles) {
+		t.Fatalf("expected files of both DBs counted; got %+v", s.Files)
+	}
+	processOpen := s.Files.ProcessOpen
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = db.Stats(); err != nil || s.Files.ProcessOpen != processOpen-int64(nDBFiles) {
+		t.Fatalf("expected files of closed DB released; got %+v", s.Files)
+	}
+}
+
+func TestSingleFile(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithSingleFile(8<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("unit.single")
+	for i := 0; i < 500; i++ {
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, fileType := range []_FileType{typeIndex, typeTimeWindow, typeData} {
+		if _, err := os.Stat(filePath(dbPath, _FileDesc{fileType: fileType})); !os.IsNotExist(err) {
+			t.Fatalf("expected no %s file; got %v", fileType, err)
+		}
+	}
+
+	// the layout is detected on open.
+	db, err = Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	items, err := db.Get(NewQuery(topic).WithLimit(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 500 || string(items[0]) != "msg.499" {
+		t.Fatalf("expected 500 messages read from the single file; got %d", len(items))
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Files.ByType["single"] != 1 || s.Files.ByType["data"] != 0 || s.Files.Open != nDBFiles-2 || s.Storage.DataSize == 0 {
+		t.Fatalf("unexpected stats of single file %+v %+v", s.Files, s.Storage)
+	}
+	report, err := db.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Entries != 500 {
+		t.Fatalf("unexpected verify report of single file %+v", report)
+	}
+}
+
+func TestCompactTopic(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("unit.compact")
+	var ids [][]byte
+	for i := 0; i < 2000; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("msg.%d", i))).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	for i, id := range ids {
+		if i%10 == 0 {
+			continue
+		}
+		if err := db.DeleteEntry(NewEntry(topic, nil).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the iterator started before compaction reads the replaced chain.
+	it, err := db.Items(NewQuery(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() {
+		t.Fatal("expected iterator to return an item")
+	}
+	if err := db.CompactTopic(topic); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.internal.freeWinBlocks) != 0 {
+		t.Fatal("expected blocks of the replaced chain not reclaimed under the iterator")
+	}
+	items, err := db.Get(NewQuery(topic).WithLimit(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 200 {
+		t.Fatalf("expected 200 messages from the compacted chain; got %d", len(items))
+	}
+	n := 1
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != 200 {
+		t.Fatalf("expected 200 messages from the iterator; got %d, %v", n, it.Err())
+	}
+	db.internal.syncLock.lock()
+	err = db.reclaimWindowBlocks()
+	db.internal.syncLock.unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.internal.freeWinBlocks) != 6 {
+		t.Fatalf("expected 6 blocks of the replaced chain reclaimed; got %d", len(db.internal.freeWinBlocks))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the compacted chain is loaded on open.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	items, err = db.Get(NewQuery(topic).WithLimit(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 200 || string(items[199]) != "msg.0" {
+		t.Fatalf("expected 200 messages after reopen; got %d", len(items))
+	}
+}
+
+func TestQueryRegex(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, topic := range []string{"teams.alpha.ch1", "teams.alpha.ch22", "teams.alpha.chx", "teams.alpha.ch3.u1", "teams.beta.ch1"} {
+		if err := db.Put([]byte(topic), []byte(topic)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := db.Get(NewQuery([]byte("teams.alpha.ch[0-9]+")).WithRegex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, item := range items {
+		got[string(item)] = true
+	}
+	if len(items) != 2 || !got["teams.alpha.ch1"] || !got["teams.alpha.ch22"] {
+		t.Fatalf("expected messages of ch1 and ch22; got %q", items)
+	}
+	// the separator in a character class is part of the regular expression.
+	items, err = db.Get(NewQuery([]byte("teams.[a-z.]+.ch1")).WithRegex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected messages of alpha and beta ch1; got %q", items)
+	}
+	if _, err := db.Get(NewQuery([]byte("teams.(alpha")).WithRegex()); err != errBadPattern {
+		t.Fatalf("expected errBadPattern; got %v", err)
+	}
+}
+
+type testEntryIterator struct {
+	n, total int
+	err      error
+}
+
+func (it *testEntryIterator) Next() (*Entry, error) {
+	if it.n == it.total {
+		if it.err != nil {
+			return nil, it.err
+		}
+		return nil, io.EOF
+	}
+	it.n++
+	return NewEntry([]byte(fmt.Sprintf("unit.ingest.%d", it.n%3)), []byte(fmt.Sprintf("msg.%d", it.n))), nil
+}
+
+func TestIngest(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("unit.ingest.0"), []byte("msg.0")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.Ingest(&testEntryIterator{total: 25000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the entry put before ingest is synced after the ingested entries.
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if n != 25000 || db.Count() != 25001 {
+		t.Fatalf("expected 25000 entries ingested and 25001 entries; got %d, %d", n, db.Count())
+	}
+	if s, err := db.Stats(); err != nil || s.Storage.Ingested != 25000 {
+		t.Fatalf("expected 25000 entries ingested in stats; got %+v, %v", s.Storage, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := db.Get(NewQuery([]byte("unit.ingest.0")).WithLimit(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 8334 || string(items[0]) != "msg.24999" || string(items[8333]) != "msg.0" {
+		t.Fatalf("expected 8334 messages of the topic; got %d", len(items))
+	}
+	// the DB is not opened if the ingest did not complete.
+	if _, err := db.Ingest(&testEntryIterator{total: 10, err: errBadRequest}); err != errBadRequest {
+		t.Fatalf("expected iterator error; got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dbPath, opts...); err != errIngestIncomplete {
+		t.Fatalf("expected errIngestIncomplete; got %v", err)
+	}
+}
+
+func TestQueryWildcard(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, topic := range []string{"teams.alpha.ch1", "teams.beta.ch1", "teams.alpha.ch2", "org.alpha.ch1", "teams.*.ch1"} {
+		if err := db.Put([]byte(topic), []byte(topic)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		topic string
+		want  []string
+	}{
+		{"teams.*.ch1", []string{"teams.alpha.ch1", "teams.beta.ch1", "teams.*.ch1"}},
+		{"*.alpha.ch1", []string{"teams.alpha.ch1", "org.alpha.ch1"}},
+		{"*.*.ch2", []string{"teams.alpha.ch2"}},
+		{"teams.alpha.*", []string{"teams.alpha.ch1", "teams.alpha.ch2"}},
+	}
+	for _, tt := range tests {
+		items, err := db.Get(NewQuery([]byte(tt.topic)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, item := range items {
+			got[string(item)] = true
+		}
+		for _, want := range tt.want {
+			if !got[want] {
+				t.Fatalf("%s: expected message of %s; got %q", tt.topic, want, items)
+			}
+		}
+		if len(items) != len(tt.want) {
+			t.Fatalf("%s: expected %d messages; got %q", tt.topic, len(tt.want), items)
+		}
+	}
+}
+
+func TestExportSegments(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var ids [][]byte
+	for i := 0; i < 3000; i++ {
+		id := db.NewID()
+		if err := db.PutEntry(NewEntry([]byte(fmt.Sprintf("unit.export.%d", i%2)), []byte(fmt.Sprintf("msg.%d", i))).WithID(id)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	if err := db.Delete(ids[0], []byte("unit.export.0")); err != nil {
+		t.Fatal(err)
+	}
+	dir := dbPath + ".segments"
+	defer os.RemoveAll(dir)
+	report, err := db.ExportSegments(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Segments != 2 || report.Messages != 2999 {
+		t.Fatalf("expected 2 segments of 2999 messages; got %+v", report)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 segment files; got %v, %v", files, err)
+	}
+	counts := make(map[string]int)
+	for _, file := range files {
+		var last uint64
+		err := ReadSegment(file, func(m Message) bool {
+			if seq := message.ID(m.ID).Sequence(); seq <= last {
+				t.Fatalf("expected messages in order of sequence; got %d after %d", seq, last)
+			} else {
+				last = seq
+			}
+			counts[string(m.Topic)]++
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counts["unit.export.0"] != 1499 || counts["unit.export.1"] != 1500 {
+		t.Fatalf("expected 1499 and 1500 messages of the topics; got %v", counts)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[100] ^= 0xff
+	if err := ioutil.WriteFile(files[0], data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadSegment(files[0], func(Message) bool { return true }); err != errCorrupted {
+		t.Fatalf("expected errCorrupted; got %v", err)
+	}
+}
+
+func TestTopics(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, topic := range []string{"teams.alpha.ch1", "teams.alpha.ch2", "teams.beta.ch1", "org.alpha"} {
+		for j := 0; j <= i; j++ {
+			if err := db.Put([]byte(topic), []byte(topic)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	contract, err := db.NewContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutEntry(NewEntry([]byte("teams.alpha.ch1"), []byte("other")).WithContract(contract)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := db.Stats(); err != nil || s.InFlight.Unsynced == 0 {
+			break
+		}
+	}
+	topics, err := db.Topics(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 4 || string(topics[0].Topic) != "org.alpha" || topics[0].Entries != 4 || topics[0].Offset == 0 || topics[0].LastWrite.IsZero() {
+		t.Fatalf("expected 4 topics of the master contract; got %+v", topics)
+	}
+	topics, err = db.Topics(0, []byte("teams.*.ch1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 || string(topics[0].Topic) != "teams.alpha.ch1" || topics[0].Entries != 1 || string(topics[1].Topic) != "teams.beta.ch1" || topics[1].Entries != 3 {
+		t.Fatalf("expected 2 topics matching the pattern; got %+v", topics)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		topic := []byte("parquet.ch1")
+		if i%2 == 1 {
+			topic = []byte("parquet.ch2")
+		}
+		if err := db.Put(topic, []byte(fmt.Sprintf("msg.%2d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	n, err := db.ExportParquet(&buf, NewQuery([]byte("parquet.*")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("expected 100 items exported; got %d", n)
+	}
+	b := buf.Bytes()
+	if len(b) < 12 || string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		t.Fatalf("expected parquet magic at start and end of file")
+	}
+	metaSize := int(binary.LittleEndian.Uint32(b[len(b)-8 : len(b)-4]))
+	if metaSize <= 0 || metaSize > len(b)-12 {
+		t.Fatalf("invalid parquet metadata size %d", metaSize)
+	}
+	if !bytes.Contains(b, []byte("parquet.ch2")) || !bytes.Contains(b[len(b)-8-metaSize:], []byte("stored_at")) {
+		t.Fatalf("expected topic values and column names in parquet file")
+	}
+}
+
+func TestAliasTopic(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Put([]byte("channels.general"), []byte("before rename")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AliasTopic([]byte("channels.unknown"), []byte("channels.other")); err != errTopicNotFound {
+		t.Fatalf("expected topic not found error; got %v", err)
+	}
+	if err := db.AliasTopic([]byte("channels.*"), []byte("channels.other")); err != errBadRequest {
+		t.Fatalf("expected bad request error for wildcard topic; got %v", err)
+	}
+	if err := db.AliasTopic([]byte("channels.general"), []byte("channels.lobby")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := db.Get(NewQuery([]byte("channels.lobby")).WithLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 {
+		t.Fatalf("expected 5 items under the new topic; got %d", len(items))
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Put([]byte("channels.lobby"), []byte("after rename")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, topic := range []string{"channels.general", "channels.lobby"} {
+		items, err := db.Get(NewQuery([]byte(topic)).WithLimit(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 8 {
+			t.Fatalf("expected 8 items under topic %s; got %d", topic, len(items))
+		}
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, topic := range []string{"channels.general", "channels.lobby"} {
+		items, err := db.Get(NewQuery([]byte(topic)).WithLimit(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 8 {
+			t.Fatalf("expected 8 items under topic %s after reopen; got %d", topic, len(items))
+		}
+	}
+}
+
+func TestTopicSeparator(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithTopicSeparator('/'), WithMaxTopicDepth(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if limits := db.Limits(); limits.TopicSeparator != '/' || limits.MaxTopicDepth != 200 {
+		t.Fatalf("expected topic separator and max depth in limits; got %+v", limits)
+	}
+	for _, topic := range []string{"sensors/room1/temp", "sensors/room2/temp", "sensors/room1.v2/temp"} {
+		if err := db.Put([]byte(topic), []byte(topic)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for topic, n := range map[string]int{"sensors/room1/temp": 1, "sensors/room1.v2/temp": 1, "sensors/*/temp": 3, "sensors.room1.temp": 0} {
+		items, err := db.Get(NewQuery([]byte(topic)).WithLimit(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != n {
+			t.Fatalf("expected %d items of topic %s; got %d", n, topic, len(items))
+		}
+	}
+	topics, err := db.Topics(0, []byte("sensors/*/temp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 3 || string(topics[0].Topic) != "sensors/room1.v2/temp" {
+		t.Fatalf("expected topics named using the separator; got %+v", topics)
+	}
+	topic := []byte("deep")
+	for i := 1; i < 150; i++ {
+		topic = append(topic, fmt.Sprintf("/p%d", i)...)
+	}
+	if err := db.Put(topic, []byte("deep")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := db.Get(NewQuery(topic))
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected item of topic deeper than the default max depth; got %d items, err %v", len(items), err)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithQueryCache(10, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	get := func(topic string, n int) {
+		items, err := db.Get(NewQuery([]byte(topic)).WithLimit(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != n {
+			t.Fatalf("expected %d items of topic %s; got %d", n, topic, len(items))
+		}
+	}
+	id := db.NewID()
+	if err := db.PutEntry(NewEntry([]byte("dashboard.a"), []byte("msg")).WithID(id)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.Put([]byte("dashboard.a"), []byte("msg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get("dashboard.a?last=1h", 3)
+	items, err := db.Get(NewQuery([]byte("dashboard.a?last=1h")).WithLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || db.internal.meter.QueryCacheHits.Count() != 1 {
+		t.Fatalf("expected query served from the cache; got %d items and %d hits", len(items), db.internal.meter.QueryCacheHits.Count())
+	}
+	// items returned from the cache are copies of the cached items.
+	items[0][0] = 'x'
+	items, err = db.Get(NewQuery([]byte("dashboard.a?last=1h")).WithLimit(100))
+	if err != nil || items[0][0] != 'm' {
+		t.Fatalf("expected cached items unchanged; got %q, err %v", items[0], err)
+	}
+
+	if err := db.Put([]byte("dashboard.a"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	get("dashboard.a?last=1h", 4)
+	get("dashboard.*", 4)
+	if err := db.Put([]byte("dashboard.b"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	get("dashboard.*", 5)
+	if err := db.Delete(id, []byte("dashboard.a")); err != nil {
+		t.Fatal(err)
+	}
+	get("dashboard.a?last=1h", 3)
+	get("dashboard.*", 4)
+	err = db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		return b.Put([]byte("dashboard.a"), []byte("msg"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get("dashboard.a?last=1h", 4)
+}
+
+func TestNegativeLookupCache(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithMutable(), WithNegativeLookupCache(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	get := func(topic string, n int) {
+		items, err := db.Get(NewQuery([]byte(topic)).WithLimit(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != n {
+			t.Fatalf("expected %d items of topic %s; got %d", n, topic, len(items))
+		}
+	}
+	get("sensors.*.temp", 0)
+	get("sensors.*.temp?last=1h", 0)
+	if hits := db.internal.meter.NegativeLookupHits.Count(); hits != 1 {
+		t.Fatalf("expected missing topic served from the cache; got %d hits", hits)
+	}
+	if err := db.Put([]byte("sensors.a.temp"), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	get("sensors.*.temp", 1)
+	get("sensors.a.temp", 1)
+
+	get("sensors.b.temp", 0)
+	err = db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		return b.Put([]byte("sensors.b.temp"), []byte("msg"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get("sensors.b.temp", 1)
+	get("sensors.*.temp", 2)
+}
+
+func TestTrieCheckpoint(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable()}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"fleet.truck1", "fleet.truck2", "fleet.truck3"} {
+		for i := 0; i < 3; i++ {
+			if err := db.Put([]byte(topic), []byte("position")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteTopic([]byte("fleet.truck3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopen := func(loaded bool) {
+		db, err = Open(dbPath, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.internal.checkpoint.rewrite == loaded {
+			t.Fatalf("expected trie loaded from the checkpoint %v", loaded)
+		}
+		for topic, n := range map[string]int{"fleet.truck1": 3, "fleet.truck2": 3, "fleet.truck3": 0, "fleet.*": 6} {
+			items, err := db.Get(NewQuery([]byte(topic)).WithLimit(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != n {
+				t.Fatalf("expected %d items of topic %s after reopen; got %d", n, topic, len(items))
+			}
+		}
+	}
+	reopen(true)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// stale checkpoint is not loaded and the trie is loaded from the window blocks.
+	checkpoint := newTrieCheckpoint(dbPath)
+	if _, ok, err := checkpoint.load(0); ok || err != nil {
+		t.Fatalf("expected stale checkpoint; got %v, err %v", ok, err)
+	}
+	if err := os.Remove(checkpoint.path); err != nil {
+		t.Fatal(err)
+	}
+	reopen(false)
+	db.Close()
+}
+
+func TestLoadTrieParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithMutable(), WithTimeBlockDuration(100 * time.Millisecond)}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// more topics than window blocks read at once, so the window file is read in several batches.
+	nTopics := windowReadBatch + 44
+	for i := 0; i < nTopics; i++ {
+		topic := []byte(fmt.Sprintf("region%d.site%d.meter", i%4, i))
+		if err := db.Put(topic, []byte("reading")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// entries are synced to the window blocks once their time block is released.
+	time.Sleep(200 * time.Millisecond)
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	heads := 0
+	if err := newWindowReader(db.fs).blockIterator(func(startSeq, topicHash uint64, off int64) (bool, error) {
+		heads++
+		return false, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if heads != nTopics {
+		t.Fatalf("expected %d topics in the window blocks; got %d", nTopics, heads)
+	}
+	if n := newWindowReader(db.fs).windowIdx; n <= windowReadBatch {
+		t.Fatalf("expected more than %d window blocks; got %d", windowReadBatch, n)
+	}
+
+	// the trie is rebuilt from the window blocks.
+	db.internal.trie = newTrie(db.opts.topicSeparator, 0)
+	if err := db.loadTrie(); err != nil {
+		t.Fatal(err)
+	}
+	if count := db.internal.trie.Count(); count != nTopics {
+		t.Fatalf("expected %d topics loaded into the trie; got %d", nTopics, count)
+	}
+	items, err := db.Get(NewQuery([]byte("*.*.meter")).WithLimit(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != nTopics {
+		t.Fatalf("expected %d items; got %d", nTopics, len(items))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the trie is rebuilt from the window blocks on open if the trie checkpoint is missing.
+	if err := os.Remove(newTrieCheckpoint(dbPath).path); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if count := db.internal.trie.Count(); count != nTopics {
+		t.Fatalf("expected %d topics loaded into the trie; got %d", nTopics, count)
+	}
+}
+
+func TestHotTopics(t *testing.T) {
+	h := newHotTopics(time.Minute)
+	h.add(0, []byte("unit1.test"), true)
+	h.add(0, []byte("unit2.test?last=1m"), false)
+	h.add(0, []byte("unit1.test"), true)
+	tops := h.top(2)
+	if len(tops) != 2 {
+		t.Fatalf("expected 2 hot topics; got %d", len(tops))
+	}
+	if tops[0].Topic != "unit1.test" || tops[0].Writes != 2 || tops[0].Reads != 0 {
+		t.Fatalf("unexpected hot topic %+v", tops[0])
+	}
+	if tops[1].Topic != "unit2.test" || tops[1].Writes != 0 || tops[1].Reads != 1 {
+		t.Fatalf("unexpected hot topic %+v", tops[1])
+	}
+
+	// a new topic does not evict a candidate with the same traffic.
+	h = newHotTopics(time.Minute)
+	for i := 0; i < maxHotTopics; i++ {
+		h.add(0, []byte(fmt.Sprintf("unit%d.test", i)), true)
+	}
+	h.add(0, []byte("unit.new"), true)
+	for _, c := range h.candidates {
+		if c.Topic == "unit.new" {
+			t.Fatal("expected new topic not to evict a candidate")
+		}
+	}
+
+	// heavy topics admitted to a full table keep their traffic and do not evict each other.
+	for i := 0; i < 10; i++ {
+		h.add(0, []byte("unit.heavy1"), true)
+		h.add(0, []byte("unit.heavy2"), false)
+	}
+	tops = h.top(2)
+	if len(tops) != 2 || tops[0].Writes+tops[0].Reads < 10 || tops[1].Writes+tops[1].Reads < 10 {
+		t.Fatalf("unexpected hot topics %+v", tops)
+	}
+	for _, top := range tops {
+		if top.Topic != "unit.heavy1" && top.Topic != "unit.heavy2" {
+			t.Fatalf("unexpected hot topic %+v", top)
+		}
+	}
+	if tops := h.top(-1); len(tops) != 0 {
+		t.Fatalf("expected no hot topics for negative n; got %d", len(tops))
+	}
+}
+
+func TestTTLHistogramJitter(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithTTLJitter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Close()
+		cleanup()
+	}()
+	const n = 50
+	for i := 0; i < n; i++ {
+		if err := db.Put([]byte("unit.ttl?ttl=50m"), []byte("msg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range s.Expiry.TTLHistogram {
+		if b.UpperBound == time.Hour && b.Count != n {
+			t.Fatalf("expected %d ttls up to %v; got %d", n, b.UpperBound, b.Count)
+		}
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithTTLJitter(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Close()
+		cleanup()
+	}()
+	now := uint32(time.Now().Unix())
+	expiresAt := now + 1000
+	jittered := make(map[uint32]bool)
+	for i := 0; i < 100; i++ {
+		e := db.jitter(expiresAt)
+		// the jitter is at most 50 percent of the ttl, allow a second for the clock.
+		if e < expiresAt || e > expiresAt+501 {
+			t.Fatalf("expected expiry in [%d, %d]; got %d", expiresAt, expiresAt+501, e)
+		}
+		jittered[e] = true
+	}
+	if len(jittered) < 2 {
+		t.Fatal("expected entries sharing a ttl to expire at different times")
+	}
+	if e := db.maxJitter(expiresAt); e < expiresAt+499 || e > expiresAt+500 {
+		t.Fatalf("expected max expiry %d; got %d", expiresAt+500, e)
+	}
+	// entries without ttl or already expired are not jittered.
+	if e := db.jitter(0); e != 0 {
+		t.Fatalf("expected no expiry; got %d", e)
+	}
+	if e := db.jitter(now - 10); e != now-10 {
+		t.Fatalf("expected expiry %d; got %d", now-10, e)
+	}
+	// expiry processing is smeared across the expiry window.
+	if limit := db.expiryLimit(); limit != db.opts.queryOptions.defaultQueryLimit/expirySmearFactor {
+		t.Fatalf("expected expiry limit %d; got %d", db.opts.queryOptions.defaultQueryLimit/expirySmearFactor, limit)
+	}
+}
+
+func TestLookupAfter(t *testing.T) {
+	cleanup()
+	db, err := Open(dbPath, WithBufferSize(1<<16), WithMemdbSize(1<<16), WithFreeBlockSize(1<<16), WithTimeBlockDuration(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Close()
+		cleanup()
+	}()
+	topic := []byte("after.test")
+	var seqs []uint64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 400; j++ {
+			id := db.NewID()
+			if err := db.PutEntry(NewEntry(topic, []byte(fmt.Sprintf("msg.%d", len(seqs)))).WithID(id)); err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, message.ID(id).Sequence())
+		}
+		// entries are written to the window blocks once their time block is released.
+		time.Sleep(200 * time.Millisecond)
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	top, _, err := db.parseTopic(message.MasterContract, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top.AddContract(message.MasterContract)
+	topicHash := top.GetHash(message.MasterContract)
+	off, ok := db.internal.trie.getOffset(topicHash)
+	if !ok {
+		t.Fatal("expected topic in the trie")
+	}
+	after := seqs[len(seqs)-50-1]
+	wEntries := db.internal.timeWindow.lookup(db.fs, topicHash, off, _LookupFilter{after: after}, math.MaxInt32)
+	if len(wEntries) != 50 {
+		t.Fatalf("expected 50 entries after the cursor; got %d", len(wEntries))
+	}
+	for _, we := range wEntries {
+		if we.seq() <= after {
+			t.Fatalf("expected entries after %d; got %d", after, we.seq())
+		}
+	}
+
+	// the ascending pages are bounded by the limit.
+	q := NewQuery(topic).WithLimit(20).WithOrder(OrderAsc)
+	items, err := db.Get(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 20 || string(items[0]) != "msg.0" || q.Cursor() == nil {
+		t.Fatalf("expected first page of 20 messages oldest first; got %d", len(items))
+	}
+	if len(q.internal.winEntries) != 20 {
+		t.Fatalf("expected lookup of 20 entries; got %d", len(q.internal.winEntries))
+	}
+}
+
+func TestFilterGenerations(t *testing.T) {
+	cleanup()
+	opts := []Options{WithBufferSize(1 << 16), WithMemdbSize(1 << 16), WithFreeBlockSize(1 << 16), WithFilterDuplicateWindow(time.Minute)}
+	db, err := Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	expired, live := uint64(1<<40+1), uint64(1<<40+2)
+	db.internal.filter.appendWithExpiry(expired, uint32(now.Add(-2*time.Minute).Unix()))
+	db.internal.filter.appendWithExpiry(live, uint32(now.Add(time.Hour).Unix()))
+	for _, g := range db.internal.filter.generations {
+		if len(g.Bytes()) >= fltr.BlockSize() {
+			t.Fatalf("expected generation smaller than filter block, got %d bytes", len(g.Bytes()))
+		}
+	}
+
+	// The generation of the expired partition is dropped.
+	if n := db.internal.filter.release(now); n != 1 {
+		t.Fatalf("expected 1 generation dropped, got %d", n)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The generation not yet dropped is reloaded.
+	db, err = Open(dbPath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n := len(db.internal.filter.generations); n != 1 {
+		t.Fatalf("expected 1 generation reloaded, got %d", n)
+	}
+	if !db.internal.filter.Test(live) {
+		t.Fatal("expected entry in reloaded generation")
+	}
+	for _, g := range db.internal.filter.generations {
+		if g.Test(expired) {
+			t.Fatal("expected entry of dropped generation not reloaded")
+		}
+	}
+	if n := db.internal.filter.release(now.Add(2 * time.Hour)); n != 1 {
+		t.Fatalf("expected reloaded generation dropped, got %d", n)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	cleanup()
+	if err := os.MkdirAll(dbPath, 0777); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := newTombstones(dbPath, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, idSize)
+	for seq := uint64(1); seq <= 3; seq++ {
+		if err := ts.add(seq, 10, id, []byte(fmt.Sprintf("msg.%d", seq))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.remove(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tombstones are reloaded from the tombstones file.
+	ts, err = newTombstones(dbPath, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, val, ok := ts.get(3, 5); !ok || string(val) != "msg.3" {
+		t.Fatalf("expected tombstone of seq 3 reloaded; got %q, %v", val, ok)
+	}
+	if _, _, ok := ts.get(2, 5); ok {
+		t.Fatal("expected tombstone removed")
+	}
+	if _, _, ok := ts.get(1, 10); ok {
+		t.Fatal("expected tombstone deleted at the epoch not returned")
+	}
+	if err := ts.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tombstones past the retention are dropped and compacted on open.
+	time.Sleep(20 * time.Millisecond)
+	ts, err = newTombstones(dbPath, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.close()
+	if len(ts.entries) != 0 || ts.size != 0 {
+		t.Fatalf("expected tombstones dropped; got %d tombstones, file size %d", len(ts.entries), ts.size)
+	}
+}
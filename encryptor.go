@@ -0,0 +1,128 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// Encryptor encrypts message payloads for data-at-rest encryption. Payloads are encrypted
+// before the entries are appended to the log and the data file, the key id used to encrypt
+// a message is recorded with the message so messages encrypted using earlier keys can be decrypted.
+// Key id zero is reserved for messages not encrypted.
+type Encryptor interface {
+	// KeyID returns the id of the key to encrypt new messages.
+	KeyID() uint8
+	// Seal encrypts the plaintext using the key with the key id and appends the result to dst.
+	Seal(keyID uint8, dst, plaintext []byte) ([]byte, error)
+	// Open decrypts the ciphertext using the key with the key id and appends the result to dst.
+	Open(keyID uint8, dst, ciphertext []byte) ([]byte, error)
+}
+
+// _KeyringEncryptor is the built-in encryptor using the data keys of the keyring.
+type _KeyringEncryptor struct {
+	keyring *_Keyring
+}
+
+func (e _KeyringEncryptor) KeyID() uint8 {
+	id, _ := e.keyring.current()
+	return id
+}
+
+func (e _KeyringEncryptor) Seal(keyID uint8, dst, plaintext []byte) ([]byte, error) {
+	mac, err := e.keyring.mac(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return mac.Encrypt(dst, plaintext), nil
+}
+
+func (e _KeyringEncryptor) Open(keyID uint8, dst, ciphertext []byte) ([]byte, error) {
+	mac, err := e.keyring.mac(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return mac.Decrypt(dst, ciphertext)
+}
+
+// _AEADEncryptor encrypts messages using AEAD ciphers, a random nonce is prefixed to each message.
+type _AEADEncryptor struct {
+	aeads []cipher.AEAD
+}
+
+// NewAEADEncryptor returns an encryptor using the AEAD ciphers, for example AES-GCM
+// or chacha20poly1305. The cipher at index i is used for the key id i+1 and the last
+// cipher is used to encrypt new messages. Up to 255 ciphers are supported.
+func NewAEADEncryptor(aeads ...cipher.AEAD) (Encryptor, error) {
+	if len(aeads) == 0 || len(aeads) > maxDataKeys {
+		return nil, errors.New("number of ciphers must be between 1 and 255")
+	}
+	return &_AEADEncryptor{aeads: aeads}, nil
+}
+
+func (e *_AEADEncryptor) KeyID() uint8 {
+	return uint8(len(e.aeads))
+}
+
+func (e *_AEADEncryptor) aead(keyID uint8) (cipher.AEAD, error) {
+	if keyID == 0 || int(keyID) > len(e.aeads) {
+		return nil, errKeyNotFound
+	}
+	return e.aeads[keyID-1], nil
+}
+
+func (e *_AEADEncryptor) Seal(keyID uint8, dst, plaintext []byte) ([]byte, error) {
+	aead, err := e.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, []byte{keyID}), nil
+}
+
+func (e *_AEADEncryptor) Open(keyID uint8, dst, ciphertext []byte) ([]byte, error) {
+	aead, err := e.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(ciphertext) < n+aead.Overhead() {
+		return nil, errors.New("Authentication failed.")
+	}
+	return aead.Open(dst, ciphertext[:n], ciphertext[n:], []byte{keyID})
+}
+
+// encrypt encrypts the value using the current key of the encryptor, it returns the key id used.
+func (db *DB) encrypt(val []byte) (uint8, []byte, error) {
+	keyID := db.internal.encryptor.KeyID()
+	val, err := db.internal.encryptor.Seal(keyID, nil, val)
+	return keyID, val, err
+}
+
+// decrypt decrypts the value using the key id recorded with the message, key id zero is used for the messages not encrypted.
+func (db *DB) decrypt(keyID uint8, val []byte) ([]byte, error) {
+	if keyID == 0 {
+		return val, nil
+	}
+	return db.internal.encryptor.Open(keyID, nil, val)
+}
@@ -35,18 +35,25 @@ type (
 		expiresAt uint32 // expiresAt for recovery from log and not persisted to index file but persisted to the time window file.
 
 		parsed    bool
+		chunk     bool   // chunk is set if the entry is a chunk of a large message.
+		chunked   bool   // chunked is set if the payload of the entry is the manifest of its chunks.
 		topicHash uint64 // topicHash for recovery from log and not persisted to the DB.
 		cache     []byte // entry from memdb if it exist.
+
+		// packTopic is set to pack the topic into the entry even if the topic is in the trie, see DB Ingest.
+		packTopic bool
 	}
 	// Entry entry is a message entry structure.
 	Entry struct {
-		entry      _Entry
-		ID         []byte // The ID of the message.
-		Topic      []byte // The topic of the message.
-		Payload    []byte // The payload of the message.
-		ExpiresAt  uint32 // The time expiry of the message.
-		Contract   uint32 // The contract is used to as salt to hash topic parts and also used as prefix in the message ID.
-		Encryption bool
+		entry       _Entry
+		ID          []byte // The ID of the message.
+		Topic       []byte // The topic of the message.
+		Payload     []byte // The payload of the message.
+		ExpiresAt   uint32 // The time expiry of the message.
+		Contract    uint32 // The contract is used to as salt to hash topic parts and also used as prefix in the message ID.
+		Encryption  bool
+		Compression Codec             // The codec to compress the payload, CodecDefault uses the codec set on DB.
+		Headers     map[string]string // The headers delivered to the watchers of the topic, headers are not persisted.
 	}
 )
 
@@ -88,18 +95,41 @@ func (e *Entry) WithTTL(ttl []byte) *Entry {
 	return e
 }
 
+// WithHeaders sets headers on entry delivered to the watchers of the topic.
+func (e *Entry) WithHeaders(headers map[string]string) *Entry {
+	e.Headers = headers
+	return e
+}
+
 // WithEncryption sets encryption on entry.
 func (e *Entry) WithEncryption() *Entry {
 	e.Encryption = true
 	return e
 }
 
+// WithContentEncoding marks the payload of the entry as already compressed using the content
+// encoding, the payload is stored and returned as is. The gzip encoding is supported.
+func (e *Entry) WithContentEncoding(encoding string) *Entry {
+	if encoding == contentEncodingGzip {
+		e.Compression = CodecGzip
+	}
+	return e
+}
+
+// WithCompression sets codec to compress payload of the entry.
+func (e *Entry) WithCompression(codec Codec) *Entry {
+	e.Compression = codec
+	return e
+}
+
 func (e *Entry) reset() {
 	e.entry.seq = 0
 	e.entry.topicSize = 0
 	e.entry.cache = nil
+	e.entry.chunked = false
 	e.ID = nil
 	e.Payload = nil
+	e.Headers = nil
 }
 
 func (e _Entry) ExpiresAt() uint32 {
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// EraseReport is the result of erasing the entries matching a predicate, it is kept as the record of the erasure.
+type EraseReport struct {
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt time.Time      `json:"completed_at"`
+	Scanned     int            `json:"scanned"`     // Number of entries scanned.
+	Erased      int            `json:"erased"`      // Number of entries erased.
+	Bytes       int64          `json:"bytes"`       // Stored bytes of the entries erased including the chunks of the messages.
+	Overwritten int64          `json:"overwritten"` // Bytes of the data file overwritten with zeros.
+	Contracts   map[uint32]int `json:"contracts"`   // Number of entries erased per contract.
+	Topics      map[string]int `json:"topics"`      // Number of entries erased per topic.
+	IDs         [][]byte       `json:"ids"`         // IDs of the entries erased.
+}
+
+// _Erasure is an entry matched to erase.
+type _Erasure struct {
+	topicHash uint64
+	seq       uint64
+}
+
+// _EraseOptions is used to set options to erase entries.
+type _EraseOptions struct {
+	overwrite bool
+}
+
+// WithEraseOverwrite overwrites the payloads of the erased entries in the data file with zeros, so the
+// payloads are not left in the data file until the freed blocks are reused.
+func WithEraseOverwrite() Options {
+	return newFuncOption(func(o *_Options) {
+		o.eraseOptions.overwrite = true
+	})
+}
+
+// Erase deletes the entries of all contracts and topics for which match returns true, for example all entries
+// of a producer to comply with an erasure request. The entries are matched on the ID, the topic, the contract and
+// the payload of the message, headers are not persisted so these are not matched. Erased entries are removed from
+// the tombstones so time-travel queries do not return them. Use WithEraseOverwrite option to overwrite the payloads
+// in the data file. Erase syncs the DB before the scan, the entries put during the erasure are not erased.
+func (db *DB) Erase(match func(Message) bool, opts ...Options) (*EraseReport, error) {
+	switch {
+	case db.opts.flags.immutable:
+		return nil, errImmutable
+	case db.opts.replicaOf != "":
+		return nil, errReplica
+	}
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	if err := db.authorize(message.MasterContract, nil, OpDelete); err != nil {
+		return nil, err
+	}
+	o := &_Options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(o)
+		}
+	}
+	report := &EraseReport{StartedAt: time.Now(), Contracts: make(map[uint32]int), Topics: make(map[string]int)}
+	if err := db.Sync(); err != nil {
+		return report, err
+	}
+	entries, err := db.scanWindow(func(uint32) bool { return true })
+	if err != nil {
+		return report, err
+	}
+	var matched []_Erasure
+	if err := db.scanIndex(entries, func(e _IndexEntry, m Message) bool {
+		report.Scanned++
+		if match(m) {
+			matched = append(matched, _Erasure{topicHash: entries[e.seq].topicHash, seq: e.seq})
+			report.Contracts[m.Contract]++
+			report.Topics[string(m.Topic)]++
+			report.IDs = append(report.IDs, m.ID)
+		}
+		return true
+	}); err != nil {
+		return report, err
+	}
+
+	// The sync lock is held while entries are erased, so the blocks freed are not reused by sync before these are overwritten.
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+	for _, m := range matched {
+		seqs := append(db.chunkSeqs(m.seq), m.seq)
+		for _, seq := range seqs {
+			if err := db.eraseEntry(m.topicHash, seq, o.eraseOptions.overwrite, report); err != nil {
+				return report, err
+			}
+		}
+		report.Erased++
+	}
+	if err := db.sync(); err != nil {
+		return report, err
+	}
+	report.CompletedAt = time.Now()
+	return report, nil
+}
+
+// eraseEntry deletes the entry and overwrites its payload in the data file if overwrite is set.
+func (db *DB) eraseEntry(topicHash, seq uint64, overwrite bool, report *EraseReport) error {
+	// the entry is read from the index file as the entry may also be cached in the mem store.
+	e, err := db.internal.reader.readEntry(seq)
+	if err == errMsgIDDeleted {
+		return nil
+	}
+	if err := db.delete(topicHash, seq); err != nil {
+		return err
+	}
+	if err := db.internal.tombstones.remove(seq); err != nil {
+		return err
+	}
+	if err != nil {
+		// a chunk not yet synced is deleted from the mem store.
+		return nil
+	}
+	report.Bytes += int64(e.mSize())
+	if !overwrite {
+		return nil
+	}
+	// the topic packed in the entry is kept to load the topic on open.
+	off := e.msgOffset + int64(idSize) + int64(e.topicSize)
+	if _, err := db.internal.reader.dataFile.WriteAt(make([]byte, e.valueSize), off); err != nil {
+		return err
+	}
+	report.Overwritten += int64(e.valueSize)
+	return nil
+}
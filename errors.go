@@ -18,6 +18,7 @@ package unitdb
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -37,9 +38,61 @@ var (
 	errFull                = errors.New("database is full")
 	errCorrupted           = errors.New("database is corrupted")
 	errLocked              = errors.New("database is locked")
+	errLockUnsupported     = errors.New("lock file is not supported by the file system")
 	errClosed              = errors.New("database is closed")
 	errBatchSeqComplete    = errors.New("batch seq is complete")
 	errWriteConflict       = errors.New("batch write conflict")
 	errBadRequest          = errors.New("The request was invalid or cannot be otherwise served")
 	errForbidden           = errors.New("The request is understood, but it has been refused or access is not allowed")
+	errKeyMismatch         = errors.New("encryption key does not match the keyring")
+	errKeyNotFound         = errors.New("data key not found in the keyring")
+	errInvalidToken        = errors.New("resumption token is invalid")
+	errWatchOverflow       = errors.New("watch buffer is full, resume the watch from the token of the message")
+	errInvalidCursor       = errors.New("query cursor is invalid")
+	errFrozen              = errors.New("database writes are frozen")
+	errNotFrozen           = errors.New("database writes are not frozen")
+	errTxClosed            = errors.New("transaction is closed")
+	errBadCodec            = errors.New("compression codec is not registered")
+	errMetadataTooLarge    = errors.New("metadata is too large")
+	errTopicNotDeclared    = errors.New("topic is not declared")
+	errChunkMissing        = errors.New("chunk of the message is missing")
+	errChunkCorrupted      = errors.New("chunked message failed integrity check")
+	errPathNotEmpty        = errors.New("restore path is not empty")
+	errArchiveNotSet       = errors.New("restore to time requires the WAL archive")
+	errTimeIDNotFound      = errors.New("time ID not found or already committed")
+	errReplica             = errors.New("database is a read-only replica")
+	errContractRevoked     = errors.New("contract is revoked")
+	errTooManyOpenFiles    = errors.New("too many open files")
+	errBadPattern          = errors.New("topic pattern is invalid")
+	errIngestIncomplete    = errors.New("database ingest did not complete")
+	errTopicNotFound       = errors.New("topic does not exist in database")
 )
+
+// ErrQuotaExceeded is wrapped by QuotaError returned if a write exceeds a quota or a rate limit of the contract.
+var ErrQuotaExceeded = errors.New("contract quota exceeded")
+
+// QuotaError is returned if a write exceeds a quota or a rate limit of the contract. It wraps
+// ErrQuotaExceeded, use errors.Is to test for any quota and Limit for the quota exceeded.
+type QuotaError struct {
+	Contract uint32
+	Limit    QuotaLimit
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("contract %d quota exceeded: %s", e.Contract, e.Limit)
+}
+
+// Unwrap returns ErrQuotaExceeded.
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// TopicDepthError is returned if depth of the topic exceeds the maximum topic depth.
+type TopicDepthError struct {
+	Depth    int
+	MaxDepth int
+}
+
+func (e *TopicDepthError) Error() string {
+	return fmt.Sprintf("topic depth %d exceeds maximum topic depth %d", e.Depth, e.MaxDepth)
+}
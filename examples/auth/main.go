@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/unit-io/unitdb"
+)
+
+var errForbidden = errors.New("forbidden")
+
+func main() {
+	if err := run("example", os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run isolates topics of two tenants using contracts. The query authorizer allows
+// each tenant contract to read and write only topics under the tenant prefix.
+func run(dir string, out io.Writer) error {
+	tenants := make(map[uint32][]byte)
+	authorizer := func(contract uint32, topic []byte, op unitdb.Op) error {
+		prefix, ok := tenants[contract]
+		if !ok || !bytes.HasPrefix(topic, prefix) {
+			return errForbidden
+		}
+		return nil
+	}
+	db, err := unitdb.Open(dir, unitdb.WithDefaultOptions(), unitdb.WithQueryAuthorizer(authorizer))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	alpha, err := db.NewContract()
+	if err != nil {
+		return err
+	}
+	beta, err := db.NewContract()
+	if err != nil {
+		return err
+	}
+	tenants[alpha] = []byte("alpha.")
+	tenants[beta] = []byte("beta.")
+
+	if err := db.PutEntry(unitdb.NewEntry([]byte("alpha.ch1"), []byte("msg for tenant alpha")).WithContract(alpha)); err != nil {
+		return err
+	}
+	if err := db.PutEntry(unitdb.NewEntry([]byte("beta.ch1"), []byte("msg for tenant beta")).WithContract(beta)); err != nil {
+		return err
+	}
+
+	// Writing to the topic of another tenant is rejected by the authorizer.
+	err = db.PutEntry(unitdb.NewEntry([]byte("beta.ch1"), []byte("msg from tenant alpha")).WithContract(alpha))
+	fmt.Fprintf(out, "alpha put to beta.ch1: %v\n", err)
+
+	for contract, prefix := range map[uint32]string{alpha: "alpha", beta: "beta"} {
+		msgs, err := db.Get(unitdb.NewQuery([]byte(prefix + ".ch1")).WithContract(contract).WithLimit(10))
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			fmt.Fprintf(out, "%s\n", msg)
+		}
+	}
+	return nil
+}
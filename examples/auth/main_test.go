@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var out bytes.Buffer
+	if err := run(dir, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"alpha put to beta.ch1: forbidden", "msg for tenant alpha", "msg for tenant beta"} {
+		if !bytes.Contains(out.Bytes(), []byte(s)) {
+			t.Fatalf("expected %q in output:\n%s", s, out.String())
+		}
+	}
+	if bytes.Contains(out.Bytes(), []byte("msg from tenant alpha\n")) {
+		t.Fatalf("unexpected message in output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unit-io/unitdb"
+)
+
+func main() {
+	if err := run("example", "example-backup", os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run backs up the DB while it is open by freezing writes and copying the DB directory,
+// and restores the backup by opening the copy. The write ahead log bundled with the
+// backup is replayed on open.
+func run(dir, backupDir string, out io.Writer) error {
+	db, err := unitdb.Open(dir, unitdb.WithDefaultOptions())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := db.Put([]byte("teams.alpha.ch1"), []byte(fmt.Sprintf("msg #%d for team alpha channel1", i))); err != nil {
+			return err
+		}
+	}
+
+	if err := waitSync(db); err != nil {
+		return err
+	}
+
+	// Freeze writes so the DB files are quiescent while the files are copied.
+	if err := db.FreezeWrites(context.Background()); err != nil {
+		return err
+	}
+	err = copyDir(dir, backupDir)
+	if err := db.Thaw(); err != nil {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Restore the backup.
+	restored, err := unitdb.Open(backupDir, unitdb.WithDefaultOptions())
+	if err != nil {
+		return err
+	}
+	defer restored.Close()
+	msgs, err := restored.Get(unitdb.NewQuery([]byte("teams.alpha.ch1")).WithLimit(10))
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		fmt.Fprintf(out, "%s\n", msg)
+	}
+	return nil
+}
+
+// copyDir copies the regular files of the src directory tree to the dst directory.
+// The lock file of the DB is not copied.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0777)
+		case !info.Mode().IsRegular() || strings.HasSuffix(path, ".lock"):
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, in); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// waitSync waits until the entries put to the DB are synced to the DB files.
+func waitSync(db *unitdb.DB) error {
+	for {
+		if err := db.Sync(); err != nil {
+			return err
+		}
+		s, err := db.Stats()
+		if err != nil {
+			return err
+		}
+		if s.InFlight.Unsynced == 0 {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/unit-io/unitdb"
+)
+
+func main() {
+	if err := run("example", os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run writes messages to multiple topics in a batch and reads them back.
+func run(dir string, out io.Writer) error {
+	db, err := unitdb.Open(dir, unitdb.WithDefaultOptions())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Writing to multiple topics in a batch. The batch is committed when the function returns nil.
+	err = db.Batch(func(b *unitdb.Batch, completed <-chan struct{}) error {
+		for i := 1; i <= 3; i++ {
+			b.PutEntry(unitdb.NewEntry([]byte("teams.alpha.ch1.u1"), []byte(fmt.Sprintf("msg #%d for team alpha channel1 receiver1", i))))
+			b.PutEntry(unitdb.NewEntry([]byte("teams.alpha.ch1.u2"), []byte(fmt.Sprintf("msg #%d for team alpha channel1 receiver2", i))))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Writing to a topic in a batch using a contract and ttl.
+	contract, err := db.NewContract()
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(b *unitdb.Batch, completed <-chan struct{}) error {
+		b.SetOptions(unitdb.WithBatchContract(contract))
+		topic := []byte("teams.alpha.ch1.u1?ttl=1h")
+		b.Put(topic, []byte("msg for team alpha channel1 receiver1 with contract"))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, q := range []*unitdb.Query{
+		unitdb.NewQuery([]byte("teams.alpha.ch1.u1?last=1h")).WithLimit(10),
+		unitdb.NewQuery([]byte("teams.alpha.ch1.u2?last=1h")).WithLimit(10),
+		unitdb.NewQuery([]byte("teams.alpha.ch1.u1?last=1h")).WithContract(contract).WithLimit(10),
+	} {
+		msgs, err := db.Get(q)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			fmt.Fprintf(out, "%s\n", msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/unit-io/unitdb"
+)
+
+func main() {
+	if err := run("example", os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run runs a chat room where each user watches the room using a wildcard topic and
+// posts messages to the topic of the user under the room.
+func run(dir string, out io.Writer) error {
+	db, err := unitdb.Open(dir, unitdb.WithDefaultOptions())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	users := []string{"alice", "bob"}
+	msgs, cancel, err := db.Watch([]byte("rooms.lobby.*"))
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	for i, user := range users {
+		topic := []byte("rooms.lobby." + user)
+		if err := db.Put(topic, []byte(fmt.Sprintf("hello from %s #%d", user, i))); err != nil {
+			return err
+		}
+	}
+
+	timeout := time.After(5 * time.Second)
+	for range users {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("watch closed")
+			}
+			fmt.Fprintf(out, "[%s] %s\n", m.Topic, m.Payload)
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for messages")
+		}
+	}
+
+	// The history of the room is read using Get.
+	history, err := db.Get(unitdb.NewQuery([]byte("rooms.lobby.alice?last=1h")).WithLimit(10))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "alice history: %d\n", len(history))
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example-chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var out bytes.Buffer
+	if err := run(dir, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[rooms.lobby.alice] hello from alice #0\n[rooms.lobby.bob] hello from bob #1\nalice history: 1\n"
+	if out.String() != expected {
+		t.Fatalf("expected output:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
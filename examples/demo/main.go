@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/unit-io/unitdb"
+)
+
+// message is the JSON message exchanged with the browser client.
+type message struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+}
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+func main() {
+	addr := flag.String("addr", "localhost:6080", "http address of the demo server")
+	dir := flag.String("dir", "example", "directory of the DB")
+	flag.Parse()
+
+	db, err := unitdb.Open(*dir, unitdb.WithDefaultOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	log.Printf("demo server listening on http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newHandler(db)))
+}
+
+// newHandler returns the handler serving the browser client at "/" and the WebSocket
+// endpoint at "/ws". The WebSocket client watches the topic of the "topic" query
+// parameter and the messages sent by the client are put to the DB.
+func newHandler(db *unitdb.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(indexHTML))
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		topic := r.URL.Query().Get("topic")
+		if topic == "" {
+			http.Error(w, "topic is required", http.StatusBadRequest)
+			return
+		}
+		msgs, cancel, err := db.Watch([]byte(topic))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer cancel()
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		// Send history of the topic followed by the live messages.
+		if history, err := db.Get(unitdb.NewQuery([]byte(topic + "?last=1h")).WithLimit(20)); err == nil {
+			for i := len(history) - 1; i >= 0; i-- {
+				if err := ws.WriteJSON(message{Topic: topic, Payload: string(history[i])}); err != nil {
+					return
+				}
+			}
+		}
+		go func() {
+			for m := range msgs {
+				if err := ws.WriteJSON(message{Topic: string(m.Topic), Payload: string(m.Payload)}); err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			var m message
+			if err := ws.ReadJSON(&m); err != nil {
+				return
+			}
+			if err := db.Put([]byte(m.Topic), []byte(m.Payload)); err != nil {
+				log.Printf("put: %v", err)
+			}
+		}
+	})
+	return mux
+}
+
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head><title>unitdb demo</title></head>
+<body>
+<p>
+  Watch topic <input id="watch" value="rooms.lobby.*"> <button onclick="connect()">Connect</button>
+</p>
+<p>
+  Topic <input id="topic" value="rooms.lobby.guest"> Message <input id="payload">
+  <button onclick="send()">Send</button>
+</p>
+<pre id="log"></pre>
+<script>
+var ws;
+function connect() {
+  if (ws) { ws.close(); }
+  var topic = document.getElementById("watch").value;
+  ws = new WebSocket("ws://" + location.host + "/ws?topic=" + encodeURIComponent(topic));
+  ws.onmessage = function(e) {
+    var m = JSON.parse(e.data);
+    document.getElementById("log").textContent += "[" + m.topic + "] " + m.payload + "\n";
+  };
+}
+function send() {
+  ws.send(JSON.stringify({topic: document.getElementById("topic").value, payload: document.getElementById("payload").value}));
+  document.getElementById("payload").value = "";
+}
+</script>
+</body>
+</html>
+`
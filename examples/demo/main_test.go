@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/unit-io/unitdb"
+)
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example-demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := unitdb.Open(dir, unitdb.WithDefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	srv := httptest.NewServer(newHandler(db))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?topic=rooms.lobby.*"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := ws.WriteJSON(message{Topic: "rooms.lobby.guest", Payload: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m message
+	if err := ws.ReadJSON(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Topic != "rooms.lobby.guest" || m.Payload != "hello" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/unit-io/unitdb"
+)
+
+func main() {
+	if err := run("example", time.Second, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run expires messages using ttl and deletes messages using retention policy and time range.
+func run(dir string, ttl time.Duration, out io.Writer) error {
+	db, err := unitdb.Open(dir, unitdb.WithDefaultOptions(), unitdb.WithMutable())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	count := func(topic string) int {
+		msgs, err := db.Get(unitdb.NewQuery([]byte(topic)).WithLimit(100))
+		if err != nil {
+			return 0
+		}
+		return len(msgs)
+	}
+
+	// Messages put with ttl expire after the ttl duration.
+	topic := fmt.Sprintf("sessions.s1?ttl=%s", ttl)
+	for i := 0; i < 3; i++ {
+		if err := db.Put([]byte(topic), []byte(fmt.Sprintf("session msg #%d", i))); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "sessions.s1 before ttl: %d\n", count("sessions.s1"))
+	time.Sleep(ttl + 500*time.Millisecond)
+	fmt.Fprintf(out, "sessions.s1 after ttl: %d\n", count("sessions.s1"))
+
+	// Retention policy keeps the latest 100 messages of each sensor up to 7 days, older
+	// messages are deleted by the retention job that runs in the background.
+	if err := db.SetRetention([]byte("sensors..."), 7*24*time.Hour, 100); err != nil {
+		return err
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Put([]byte("sensors.s1"), []byte(fmt.Sprintf("reading #%d", i))); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "sensors.s1 before delete range: %d\n", count("sensors.s1"))
+	if err := waitSync(db); err != nil {
+		return err
+	}
+
+	// Messages stored in a time range are deleted on demand.
+	if err := db.DeleteRange([]byte("sensors.s1"), time.Time{}, time.Now().Add(time.Second)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "sensors.s1 after delete range: %d\n", count("sensors.s1"))
+	return nil
+}
+
+// waitSync waits until the entries put to the DB are synced to the DB files.
+func waitSync(db *unitdb.DB) error {
+	for {
+		if err := db.Sync(); err != nil {
+			return err
+		}
+		s, err := db.Stats()
+		if err != nil {
+			return err
+		}
+		if s.InFlight.Unsynced == 0 {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
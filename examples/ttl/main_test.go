@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example-ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var out bytes.Buffer
+	if err := run(dir, time.Second, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "sessions.s1 before ttl: 3\nsessions.s1 after ttl: 0\nsensors.s1 before delete range: 5\nsensors.s1 after delete range: 0\n"
+	if out.String() != expected {
+		t.Fatalf("expected output:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -125,6 +125,22 @@ func (wb *_ExpiryWindowBucket) getExpiredEntries(maxResults int) []timeWindowEnt
 	return expiredEntries
 }
 
+// windowCounts returns number of entries per expiry window.
+func (wb *_ExpiryWindowBucket) windowCounts() map[int64]int {
+	counts := make(map[int64]int)
+	if !wb.backgroundKeyExpiry {
+		return counts
+	}
+	for _, ws := range wb.expiryWindows.expiry {
+		ws.mu.RLock()
+		for windowTime, windowEntries := range ws.windows {
+			counts[windowTime] += len(windowEntries)
+		}
+		ws.mu.RUnlock()
+	}
+	return counts
+}
+
 // addExpiry adds expiry for entries expiring. Entries expires in future are not added to expiry window.
 func (wb *_ExpiryWindowBucket) addExpiry(e timeWindowEntry) error {
 	if !wb.backgroundKeyExpiry {
@@ -0,0 +1,36 @@
+/*
+ * Build the shared library and the example:
+ *   go build -tags ffi -buildmode=c-shared -o libunitdb.so ./ffi
+ *   cc -I ffi ffi/examples/example.c -L . -lunitdb -o example
+ */
+#include <stdio.h>
+#include <string.h>
+#include <unistd.h>
+
+#include "unitdb.h"
+
+static void on_message(void *ctx, const void *data, int len) {
+	printf("%s: %.*s\n", (const char *)ctx, len, (const char *)data);
+}
+
+int main(void) {
+	long db = unitdb_open("example", 1);
+	if (db < 0) {
+		char *err = unitdb_last_error();
+		fprintf(stderr, "open: %s\n", err);
+		unitdb_free_error(err);
+		return 1;
+	}
+
+	long sub = unitdb_subscribe(db, "teams.alpha.ch1", on_message, "subscribe");
+
+	char *msg = "msg for team alpha channel1";
+	unitdb_put(db, "teams.alpha.ch1", msg, strlen(msg));
+	sleep(1);
+
+	unitdb_get(db, "teams.alpha.ch1?last=1h", 10, on_message, "get");
+
+	unitdb_unsubscribe(sub);
+	unitdb_close(db);
+	return 0;
+}
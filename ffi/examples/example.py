@@ -0,0 +1,31 @@
+# Build the shared library first:
+#   go build -tags ffi -buildmode=c-shared -o libunitdb.so ./ffi
+import ctypes
+
+lib = ctypes.CDLL("./libunitdb.so")
+lib.unitdb_open.restype = ctypes.c_long
+lib.unitdb_open.argtypes = [ctypes.c_char_p, ctypes.c_int]
+lib.unitdb_put.argtypes = [ctypes.c_long, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_int]
+lib.unitdb_last_error.restype = ctypes.c_void_p
+lib.unitdb_free_error.argtypes = [ctypes.c_void_p]
+
+MESSAGE_CB = ctypes.CFUNCTYPE(None, ctypes.c_void_p, ctypes.c_void_p, ctypes.c_int)
+lib.unitdb_get.argtypes = [ctypes.c_long, ctypes.c_char_p, ctypes.c_int, MESSAGE_CB, ctypes.c_void_p]
+
+
+@MESSAGE_CB
+def on_message(ctx, data, size):
+    print(ctypes.string_at(data, size).decode())
+
+
+db = lib.unitdb_open(b"example", 1)
+if db < 0:
+    err = lib.unitdb_last_error()
+    msg = ctypes.string_at(err).decode()
+    lib.unitdb_free_error(err)
+    raise RuntimeError(msg)
+
+msg = b"msg for team alpha channel1"
+lib.unitdb_put(db, b"teams.alpha.ch1", msg, len(msg))
+lib.unitdb_get(db, b"teams.alpha.ch1?last=1h", 10, on_message, None)
+lib.unitdb_close(db)
@@ -0,0 +1,158 @@
+//go:build ffi
+// +build ffi
+
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package main provides C shared library bindings for unitdb so that non-Go
+// applications can embed the DB directly. Build the library using:
+//
+//	go build -tags ffi -buildmode=c-shared -o libunitdb.so ./ffi
+package main
+
+/*
+#include <stdlib.h>
+#include "unitdb.h"
+
+static inline void unitdb_call_message_cb(unitdb_message_cb cb, void *ctx, const void *data, int len) {
+	cb(ctx, data, len);
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/unit-io/unitdb"
+)
+
+// unitdb_open opens DB at the path and returns DB handle or -1 on error.
+//
+//export unitdb_open
+func unitdb_open(path *C.char, mutable C.int) C.long {
+	h, err := openDB(C.GoString(path), mutable != 0)
+	if err != nil {
+		setError(err)
+		return -1
+	}
+	return C.long(h)
+}
+
+// unitdb_close stops subscriptions and closes the DB of the handle.
+//
+//export unitdb_close
+func unitdb_close(h C.long) C.int {
+	if err := closeDB(int64(h)); err != nil {
+		setError(err)
+		return -1
+	}
+	return 0
+}
+
+// unitdb_put puts payload to the topic.
+//
+//export unitdb_put
+func unitdb_put(h C.long, topic *C.char, payload unsafe.Pointer, size C.int) C.int {
+	db, err := getDB(int64(h))
+	if err != nil {
+		setError(err)
+		return -1
+	}
+	if err := db.Put([]byte(C.GoString(topic)), C.GoBytes(payload, size)); err != nil {
+		setError(err)
+		return -1
+	}
+	return 0
+}
+
+// unitdb_get gets messages for the topic and calls the callback for each message.
+// It returns number of messages or -1 on error.
+//
+//export unitdb_get
+func unitdb_get(h C.long, topic *C.char, limit C.int, cb C.unitdb_message_cb, ctx unsafe.Pointer) C.int {
+	db, err := getDB(int64(h))
+	if err != nil {
+		setError(err)
+		return -1
+	}
+	msgs, err := db.Get(unitdb.NewQuery([]byte(C.GoString(topic))).WithLimit(int(limit)))
+	if err != nil {
+		setError(err)
+		return -1
+	}
+	for _, msg := range msgs {
+		deliver(msg, cb, ctx)
+	}
+	return C.int(len(msgs))
+}
+
+// unitdb_subscribe watches the topic and calls the callback for each message put to the topic.
+// It returns subscription id or -1 on error.
+//
+//export unitdb_subscribe
+func unitdb_subscribe(h C.long, topic *C.char, cb C.unitdb_message_cb, ctx unsafe.Pointer) C.long {
+	id, err := subscribe(int64(h), []byte(C.GoString(topic)), func(payload []byte) {
+		deliver(payload, cb, ctx)
+	})
+	if err != nil {
+		setError(err)
+		return -1
+	}
+	return C.long(id)
+}
+
+// unitdb_unsubscribe stops the subscription. The callback is not called once it returns,
+// so it must not be called from the callback.
+//
+//export unitdb_unsubscribe
+func unitdb_unsubscribe(id C.long) C.int {
+	if err := unsubscribe(int64(id)); err != nil {
+		setError(err)
+		return -1
+	}
+	return 0
+}
+
+// unitdb_last_error returns a copy of the last error message or NULL. The caller owns
+// the returned string and releases it using unitdb_free_error.
+//
+//export unitdb_last_error
+func unitdb_last_error() *C.char {
+	msg := lastError()
+	if msg == "" {
+		return nil
+	}
+	return C.CString(msg)
+}
+
+// unitdb_free_error releases the error message returned by unitdb_last_error.
+//
+//export unitdb_free_error
+func unitdb_free_error(msg *C.char) {
+	C.free(unsafe.Pointer(msg))
+}
+
+// deliver calls the callback with a copy of the message valid only during the call.
+func deliver(msg []byte, cb C.unitdb_message_cb, ctx unsafe.Pointer) {
+	if cb == nil || len(msg) == 0 {
+		return
+	}
+	data := C.CBytes(msg)
+	C.unitdb_call_message_cb(cb, ctx, data, C.int(len(msg)))
+	C.free(data)
+}
+
+func main() {}
@@ -0,0 +1,141 @@
+//go:build ffi
+// +build ffi
+
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+const dbPath = "test"
+
+func TestSubscribe(t *testing.T) {
+	os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+	h, err := openDB(dbPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgC := make(chan string, 10)
+	id, err := subscribe(h, []byte("ffi.sub"), func(payload []byte) {
+		msgC <- string(payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := getDB(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Put([]byte("ffi.sub"), []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-msgC:
+			if m != fmt.Sprintf("msg.%d", i) {
+				t.Fatalf("expected msg.%d; got %s", i, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for msg.%d", i)
+		}
+	}
+	if err := unsubscribe(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := unsubscribe(id); err != errHandle {
+		t.Fatalf("expected %v; got %v", errHandle, err)
+	}
+	if err := db.Put([]byte("ffi.sub"), []byte("msg.3")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-msgC:
+		t.Fatalf("unexpected message %s after unsubscribe", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := closeDB(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := closeDB(h); err != errHandle {
+		t.Fatalf("expected %v; got %v", errHandle, err)
+	}
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+	h, err := openDB(dbPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(h)
+	db, _ := getDB(h)
+
+	// The callback blocks until the messages overflow the watch buffer.
+	n := 200
+	releaseC := make(chan struct{})
+	msgC := make(chan string, n)
+	if _, err := subscribe(h, []byte("ffi.overflow"), func(payload []byte) {
+		<-releaseC
+		msgC <- string(payload)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := db.Put([]byte("ffi.overflow"), []byte(fmt.Sprintf("msg.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(releaseC)
+
+	// The subscription is resumed after the overflow, so no message is lost.
+	for i := 0; i < n; i++ {
+		select {
+		case m := <-msgC:
+			if m != fmt.Sprintf("msg.%d", i) {
+				t.Fatalf("expected msg.%d; got %s", i, m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for msg.%d", i)
+		}
+	}
+	if lastError() == "" {
+		t.Fatal("expected overflow error set")
+	}
+}
+
+func TestLastError(t *testing.T) {
+	setError(nil)
+	if msg := lastError(); msg != "" {
+		t.Fatalf("expected no error; got %s", msg)
+	}
+	if _, err := subscribe(-1, []byte("ffi.sub"), nil); err != errHandle {
+		t.Fatalf("expected %v; got %v", errHandle, err)
+	}
+	setError(errHandle)
+	if msg := lastError(); msg != errHandle.Error() {
+		t.Fatalf("expected %s; got %s", errHandle, msg)
+	}
+}
@@ -0,0 +1,193 @@
+//go:build ffi
+// +build ffi
+
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/unit-io/unitdb"
+)
+
+// _Subscription is a watch of a topic calling the callback for each message.
+type _Subscription struct {
+	cancel   unitdb.CancelFunc
+	canceled bool
+	doneC    chan struct{}
+}
+
+var (
+	mu        sync.Mutex
+	lastErr   string
+	nextID    int64
+	dbs       = make(map[int64]*unitdb.DB)
+	subs      = make(map[int64]*_Subscription)
+	subsByDB  = make(map[int64][]int64)
+	errHandle = errors.New("ffi: invalid handle")
+)
+
+// setError stores the error to return from unitdb_last_error.
+func setError(err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	lastErr = ""
+	if err != nil {
+		lastErr = err.Error()
+	}
+}
+
+// lastError returns the last error message or an empty string.
+func lastError() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return lastErr
+}
+
+func getDB(h int64) (*unitdb.DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	db, ok := dbs[h]
+	if !ok {
+		return nil, errHandle
+	}
+	return db, nil
+}
+
+// openDB opens DB at the path and returns the DB handle.
+func openDB(path string, mutable bool) (int64, error) {
+	opts := []unitdb.Options{unitdb.WithDefaultOptions()}
+	if mutable {
+		opts = append(opts, unitdb.WithMutable())
+	}
+	db, err := unitdb.Open(path, opts...)
+	if err != nil {
+		return -1, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	nextID++
+	dbs[nextID] = db
+	return nextID, nil
+}
+
+// closeDB stops the subscriptions and closes the DB of the handle.
+func closeDB(h int64) error {
+	mu.Lock()
+	db, ok := dbs[h]
+	delete(dbs, h)
+	var stopped []*_Subscription
+	for _, id := range subsByDB[h] {
+		if sub, ok := subs[id]; ok {
+			sub.stop()
+			stopped = append(stopped, sub)
+			delete(subs, id)
+		}
+	}
+	delete(subsByDB, h)
+	mu.Unlock()
+	for _, sub := range stopped {
+		<-sub.doneC
+	}
+	if !ok {
+		return errHandle
+	}
+	return db.Close()
+}
+
+// subscribe watches the topic and calls fn for each message put to the topic. It returns the subscription id.
+func subscribe(h int64, topic []byte, fn func(payload []byte)) (int64, error) {
+	db, err := getDB(h)
+	if err != nil {
+		return -1, err
+	}
+	msgs, cancel, err := db.Watch(topic)
+	if err != nil {
+		return -1, err
+	}
+	sub := &_Subscription{cancel: cancel, doneC: make(chan struct{})}
+	mu.Lock()
+	nextID++
+	id := nextID
+	subs[id] = sub
+	subsByDB[h] = append(subsByDB[h], id)
+	mu.Unlock()
+
+	go sub.run(db, topic, msgs, fn)
+	return id, nil
+}
+
+// run calls fn for each message of the watch until the subscription is stopped. The watch closed
+// as the subscriber fell behind is resumed from the token of the last message delivered, the watch
+// of a wildcard topic is restarted as it cannot be resumed.
+func (sub *_Subscription) run(db *unitdb.DB, topic []byte, msgs <-chan unitdb.Message, fn func([]byte)) {
+	defer close(sub.doneC)
+	for {
+		var token []byte
+		for m := range msgs {
+			if m.Err != nil {
+				setError(m.Err)
+				token = m.Token
+				continue
+			}
+			fn(m.Payload)
+		}
+		if token == nil {
+			return
+		}
+		mu.Lock()
+		if sub.canceled {
+			mu.Unlock()
+			return
+		}
+		var err error
+		var cancel unitdb.CancelFunc
+		if msgs, cancel, err = db.Watch(topic, unitdb.WithWatchFrom(token)); err != nil {
+			msgs, cancel, err = db.Watch(topic)
+		}
+		if err != nil {
+			mu.Unlock()
+			setError(err)
+			return
+		}
+		sub.cancel = cancel
+		mu.Unlock()
+	}
+}
+
+// stop cancels the watch of the subscription. The caller must hold the lock.
+func (sub *_Subscription) stop() {
+	sub.canceled = true
+	sub.cancel()
+}
+
+// unsubscribe stops the subscription and waits for the callback in progress to return.
+func unsubscribe(id int64) error {
+	mu.Lock()
+	sub, ok := subs[id]
+	if !ok {
+		mu.Unlock()
+		return errHandle
+	}
+	sub.stop()
+	delete(subs, id)
+	mu.Unlock()
+	<-sub.doneC
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#ifndef UNITDB_H
+#define UNITDB_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* unitdb_message_cb is called for each message. The data is valid only during the call. */
+typedef void (*unitdb_message_cb)(void *ctx, const void *data, int len);
+
+/* unitdb_open opens DB at the path and returns DB handle or -1 on error. */
+extern long unitdb_open(char *path, int mutable);
+
+/* unitdb_close stops subscriptions and closes the DB of the handle. */
+extern int unitdb_close(long db);
+
+/* unitdb_put puts payload to the topic. */
+extern int unitdb_put(long db, char *topic, void *payload, int len);
+
+/* unitdb_get gets messages for the topic and returns number of messages or -1 on error. */
+extern int unitdb_get(long db, char *topic, int limit, unitdb_message_cb cb, void *ctx);
+
+/*
+ * unitdb_subscribe watches the topic and calls the callback for each message put to the topic
+ * from a thread of the library. It returns subscription id or -1 on error.
+ */
+extern long unitdb_subscribe(long db, char *topic, unitdb_message_cb cb, void *ctx);
+
+/*
+ * unitdb_unsubscribe stops the subscription. The callback is not called once it returns,
+ * so it must not be called from the callback.
+ */
+extern int unitdb_unsubscribe(long sub);
+
+/*
+ * unitdb_last_error returns a copy of the last error message or NULL. The caller owns the
+ * returned string and releases it using unitdb_free_error.
+ */
+extern char *unitdb_last_error(void);
+
+/* unitdb_free_error releases the error message returned by unitdb_last_error. */
+extern void unitdb_free_error(char *err);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* UNITDB_H */
@@ -20,9 +20,16 @@ import (
 	"encoding"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/metrics"
 )
 
 // _FileType represent a file type.
@@ -90,6 +97,7 @@ func filePath(dirName string, fd _FileDesc) string {
 // _LockFile represents a lock file.
 type _LockFile interface {
 	unlock() error
+	writeOwner(o _LockOwner) error
 }
 
 type (
@@ -97,6 +105,18 @@ type (
 		*os.File
 		fd   _FileDesc
 		size int64
+
+		// readRetry if set retries the reads past the end of the file.
+		readRetry *_ReadRetry
+
+		// region if set is the region of the single file holding the file, see WithSingleFile.
+		region *_Region
+	}
+	// _ReadRetry retries a read past the end of a file extended concurrently by sync.
+	_ReadRetry struct {
+		retries  int
+		interval time.Duration
+		counter  metrics.Counter
 	}
 	_FileSet struct {
 		mu *sync.RWMutex
@@ -107,14 +127,80 @@ type (
 	}
 )
 
-// createLockFile to create lock file.
-func createLockFile(dirName string) (_LockFile, error) {
+// createLockFile to create lock file. The lock owner is written to the lock file
+// through the locked file and cleared on unlock. A lock held by a crashed process is
+// released by the OS, so the lock file is taken over by locking it. The owner recorded
+// is verified only if the file system does not support advisory locks and takeover is set.
+func createLockFile(dirName string, takeover bool) (_LockFile, error) {
 	if err := ensureDir(dirName); err != nil {
 		return nil, err
 	}
-	suffix := fmt.Sprintf("%s.lock", prefix)
+	name := path.Join(dirName, fmt.Sprintf("%s.lock", prefix))
 
-	return newLockFile(path.Join(dirName, suffix))
+	lock, err := newLockFile(name)
+	if err == errLockUnsupported && takeover {
+		if owner, ok := readLockOwner(name); ok && !owner.stale() {
+			return nil, os.ErrExist
+		}
+		lock, err = openLockFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if owner, ok := readLockOwner(name); ok {
+		logger.Warn().Str("context", "createLockFile").Int("pid", owner.pid).Msg("taking over lock file of crashed process")
+	}
+	if err := lock.writeOwner(lockOwner()); err != nil {
+		lock.unlock()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// _LockOwner is the process holding the lock file.
+type _LockOwner struct {
+	pid    int
+	bootID string
+}
+
+func lockOwner() _LockOwner {
+	return _LockOwner{pid: os.Getpid(), bootID: bootID()}
+}
+
+func (o _LockOwner) marshal() []byte {
+	return []byte(fmt.Sprintf("%d %s\n", o.pid, o.bootID))
+}
+
+// readLockOwner reads the lock owner from the lock file. The owner is not recorded if the
+// lock file was unlocked or it was created by an earlier version.
+func readLockOwner(name string) (o _LockOwner, ok bool) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return o, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return o, false
+	}
+	if o.pid, err = strconv.Atoi(fields[0]); err != nil || o.pid <= 0 {
+		return o, false
+	}
+	if len(fields) > 1 {
+		o.bootID = fields[1]
+	}
+	return o, true
+}
+
+// stale reports whether the lock owner is verified as not running. The owner is not
+// running if it was started in a previous boot or no process with owner pid is running.
+func (o _LockOwner) stale() bool {
+	if id := bootID(); id != "" && o.bootID != "" && id != o.bootID {
+		return true
+	}
+	if o.pid == os.Getpid() {
+		return false
+	}
+	return !processAlive(o.pid)
 }
 
 func newFile(path string, nFiles int16, fd _FileDesc) (_FileSet, error) {
@@ -147,6 +233,30 @@ func newFile(path string, nFiles int16, fd _FileDesc) (_FileSet, error) {
 	return fs, nil
 }
 
+// ReadAt reads from the region of the single file if the file is a region of the single file.
+func (f *_File) ReadAt(b []byte, off int64) (int, error) {
+	if f.region != nil {
+		return f.region.readAt(b, off)
+	}
+	return f.File.ReadAt(b, off)
+}
+
+// WriteAt writes to the region of the single file if the file is a region of the single file.
+func (f *_File) WriteAt(b []byte, off int64) (int, error) {
+	if f.region != nil {
+		return f.region.writeAt(b, off)
+	}
+	return f.File.WriteAt(b, off)
+}
+
+// Truncate changes size of the region of the single file if the file is a region of the single file.
+func (f *_File) Truncate(size int64) error {
+	if f.region != nil {
+		return f.region.truncate(size)
+	}
+	return f.File.Truncate(size)
+}
+
 func (f *_File) truncate(size int64) error {
 	if err := f.Truncate(size); err != nil {
 		return err
@@ -165,10 +275,24 @@ func (f *_File) extend(size uint32) (int64, error) {
 	return off, nil
 }
 
-// slice provide the data for start and end offset.
+// slice provide the data for start and end offset. A read past the end of the file is retried with the
+// size of the file refreshed if read retry is set, as the file may be extended concurrently by sync.
 func (f *_File) slice(start int64, end int64) ([]byte, error) {
 	buf := make([]byte, end-start)
 	_, err := f.ReadAt(buf, start)
+	if err != io.EOF || f.readRetry == nil {
+		return buf, err
+	}
+	for i := 0; i < f.readRetry.retries; i++ {
+		f.readRetry.counter.Inc(1)
+		time.Sleep(f.readRetry.interval)
+		if f.Size() < end {
+			continue
+		}
+		if _, err = f.ReadAt(buf, start); err != io.EOF {
+			return buf, err
+		}
+	}
 	return buf, err
 }
 
@@ -199,12 +323,14 @@ func (f *_File) readUnmarshalableAt(m encoding.BinaryUnmarshaler, size uint32, o
 }
 
 func (f *_File) currSize() int64 {
-	stat, _ := f.Stat()
-	f.size = stat.Size()
+	f.size = f.Size()
 	return f.size
 }
 
 func (f *_File) Size() int64 {
+	if f.region != nil {
+		return f.region.currSize()
+	}
 	stat, _ := f.Stat()
 	return stat.Size()
 }
@@ -227,17 +353,79 @@ func (fs *_FileSet) getFile(fd _FileDesc) (*_File, error) {
 	return &_File{}, errors.New("file not found")
 }
 
-func (fs *_FileSet) sync() error {
+// sync flushes the files of the fileset to the disk. Files are synced concurrently, if strict flag is
+// set then files are synced sequentially in the fileset order for strict-ordering filesystems. If
+// dataSync flag is set then fdatasync is used to skip flushing the file metadata.
+func (fs *_FileSet) sync(strict, dataSync bool) error {
 	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-	for _, f := range fs.fileMap {
-		if err := f.Sync(); err != nil {
+	files := fs.files()
+	fs.mu.RUnlock()
+
+	syncFile := func(f *_File) error {
+		if dataSync {
+			return fdatasync(f.File)
+		}
+		return f.Sync()
+	}
+	if strict {
+		for _, f := range files {
+			if err := syncFile(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, f *_File) {
+			defer wg.Done()
+			errs[i] = syncFile(f)
+		}(i, f)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// files returns the open files of the fileset and the filesets in the list.
+func (fs *_FileSet) files() []*_File {
+	var files []*_File
+	if fs._File != nil && fs.File != nil {
+		files = append(files, fs._File)
+	}
+	for num := range fs.fileMap {
+		if fs._File != nil && fs.fd.num == num {
+			continue
+		}
+		f := fs.fileMap[num]
+		files = append(files, &f)
+	}
+	for i := range fs.list {
+		fs.list[i].mu.RLock()
+		files = append(files, fs.list[i].files()...)
+		fs.list[i].mu.RUnlock()
+	}
+	// regions of the single file are synced once.
+	seen := make(map[*os.File]bool, len(files))
+	n := 0
+	for _, f := range files {
+		if f.region == nil || !seen[f.File] {
+			seen[f.File] = true
+			files[n] = f
+			n++
+		}
+	}
+	files = files[:n]
+	return files
+}
+
 func (fs *_FileSet) size() (int64, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
@@ -251,8 +439,14 @@ func (fs *_FileSet) size() (int64, error) {
 func (fs *_FileSet) close() error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	closed := make(map[*os.File]bool)
 	for _, files := range fs.list {
 		for _, f := range files.fileMap {
+			// regions of the single file share the file.
+			if closed[f.File] {
+				continue
+			}
+			closed[f.File] = true
 			if err := f.Close(); err != nil {
 				return err
 			}
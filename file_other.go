@@ -0,0 +1,33 @@
+// +build !linux
+
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"os"
+)
+
+// fdatasync flushes file to the disk, fdatasync is not supported on the platform and fsync is used.
+func fdatasync(f *os.File) error {
+	return f.Sync()
+}
+
+// bootID returns empty boot id, boot id is not supported on the platform.
+func bootID() string {
+	return ""
+}
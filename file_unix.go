@@ -28,18 +28,32 @@ type _UnixFileLock struct {
 	name string
 }
 
-// Unlock removes the lock from file.
+// Unlock clears the lock owner and removes the lock from file. The lock file is not
+// removed as another process may have it open and lock it once the lock is released.
 func (fl *_UnixFileLock) unlock() error {
-	if err := os.Remove(fl.name); err != nil {
+	if err := fl.f.Truncate(0); err != nil {
+		fl.f.Close()
 		return err
 	}
 	return fl.f.Close()
 }
 
+// writeOwner writes the lock owner to the lock file through the locked file.
+func (fl *_UnixFileLock) writeOwner(o _LockOwner) error {
+	if err := fl.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := fl.f.WriteAt(o.marshal(), 0)
+	return err
+}
+
 func lockFile(f *os.File) error {
 	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
-		if err == syscall.EWOULDBLOCK {
+		switch err {
+		case syscall.EWOULDBLOCK:
 			err = os.ErrExist
+		case syscall.ENOLCK, syscall.EOPNOTSUPP:
+			err = errLockUnsupported
 		}
 		return err
 	}
@@ -57,3 +71,29 @@ func newLockFile(name string) (_LockFile, error) {
 	}
 	return &_UnixFileLock{f, name}, nil
 }
+
+// openLockFile opens the lock file without locking it, it is used if the file system
+// does not support advisory locks.
+func openLockFile(name string) (_LockFile, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &_UnixFileLock{f, name}, nil
+}
+
+// processAlive reports whether a process with the pid is running. The process
+// is running if it exists even if the caller is not permitted to signal it.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// openFilesLimit returns the soft limit of open files of the process.
+func openFilesLimit() uint64 {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0
+	}
+	return uint64(rl.Cur)
+}
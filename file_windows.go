@@ -31,7 +31,12 @@ var (
 
 const (
 	errorLockViolation    = 0x21
+	errorNotSupported     = 0x32
 	lockfileExclusiveLock = 3
+
+	errorInvalidParameter          = 0x57
+	processQueryLimitedInformation = 0x1000
+	stillActive                    = 259
 )
 
 type _WindowsFileLock struct {
@@ -39,34 +44,64 @@ type _WindowsFileLock struct {
 	name string
 }
 
-// unlock removes the lock from file.
+// unlock clears the lock owner and removes the lock from file. The lock file is not
+// removed as another process may have it open and lock it once the lock is released.
 func (fl *_WindowsFileLock) unlock() error {
-	if err := os.Remove(fl.name); err != nil {
+	if err := fl.truncate(); err != nil {
+		syscall.Close(fl.fd)
 		return err
 	}
 	return syscall.Close(fl.fd)
 }
 
+// writeOwner writes the lock owner to the lock file through the locked file.
+func (fl *_WindowsFileLock) writeOwner(o _LockOwner) error {
+	if err := fl.truncate(); err != nil {
+		return err
+	}
+	_, err := syscall.Write(fl.fd, o.marshal())
+	return err
+}
+
+func (fl *_WindowsFileLock) truncate() error {
+	if _, err := syscall.Seek(fl.fd, 0, 0); err != nil {
+		return err
+	}
+	return syscall.SetEndOfFile(fl.fd)
+}
+
 func lockFile(h syscall.Handle, flags, reserved, locklow, lockhigh uint32, ol *syscall.Overlapped) error {
 	r1, _, err := syscall.Syscall6(procLockFileEx.Addr(), 6, uintptr(h), uintptr(flags), uintptr(reserved), uintptr(locklow), uintptr(lockhigh), uintptr(unsafe.Pointer(ol)))
-	if r1 == 0 && (err == syscall.ERROR_FILE_EXISTS || err == errorLockViolation) {
-		return os.ErrExist
+	if r1 == 0 {
+		if err == syscall.ERROR_FILE_EXISTS || err == errorLockViolation {
+			return os.ErrExist
+		}
+		if err == errorNotSupported {
+			return errLockUnsupported
+		}
+		return err
 	}
 	return nil
 }
 
-func newLockFile(name string) (_LockFile, error) {
+// createFile opens the lock file, the file is not truncated as the owner is
+// recorded in it by the process holding the lock.
+func createFile(name string) (syscall.Handle, error) {
 	path, err := syscall.UTF16PtrFromString(name)
 	if err != nil {
-		return nil, err
+		return syscall.InvalidHandle, err
 	}
-	fd, err := syscall.CreateFile(path,
+	return syscall.CreateFile(path,
 		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
 		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
 		nil,
-		syscall.CREATE_ALWAYS,
+		syscall.OPEN_ALWAYS,
 		syscall.FILE_ATTRIBUTE_NORMAL,
 		0)
+}
+
+func newLockFile(name string) (_LockFile, error) {
+	fd, err := createFile(name)
 	if err != nil {
 		return nil, os.ErrExist
 	}
@@ -82,3 +117,33 @@ func newLockFile(name string) (_LockFile, error) {
 	}
 	return &_WindowsFileLock{fd, name}, nil
 }
+
+// openLockFile opens the lock file without locking it, it is used if the file system
+// does not support advisory locks.
+func openLockFile(name string) (_LockFile, error) {
+	fd, err := createFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &_WindowsFileLock{fd, name}, nil
+}
+
+// processAlive reports whether a process with the pid is running. The process
+// is running if it exists even if the caller is not permitted to query it.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return err != syscall.Errno(errorInvalidParameter)
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
+
+// openFilesLimit returns zero as the open files limit of the process is not known.
+func openFilesLimit() uint64 {
+	return 0
+}
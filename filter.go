@@ -17,6 +17,14 @@
 package unitdb
 
 import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
 	"github.com/unit-io/unitdb/filter"
 	"github.com/unit-io/unitdb/memdb"
 )
@@ -27,15 +35,78 @@ type Filter struct {
 	filterBlock *filter.Generator
 	blockCache  *memdb.DB
 	cacheID     uint64
+
+	// window is duplicate window of a filter generation. Entries with expiry are appended
+	// to the generation of their expiry partition and the generation is dropped once
+	// all entries in the partition are expired. Generations are keyed by the end of
+	// their partition and written to the generations file on close.
+	window      time.Duration
+	genPath     string
+	mu          sync.RWMutex
+	generations map[int64]*filter.Generator
 }
 
+// generationHeaderSize is size of the end of partition and the number of bits of a filter generation.
+const generationHeaderSize = 16
+
 // Append appends an entry to bloom filter.
 func (f *Filter) Append(h uint64) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	f.filterBlock.Append(h)
 }
 
+// appendWithExpiry appends an entry to the filter generation of its expiry partition.
+// Entries without expiry or if duplicate window is not set are appended to the bloom filter.
+func (f *Filter) appendWithExpiry(h uint64, expiresAt uint32) {
+	if f.window < time.Second || expiresAt == 0 {
+		f.Append(h)
+		return
+	}
+	partition := time.Unix(int64(expiresAt), 0).Truncate(f.window).Add(f.window).Unix()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.generations == nil {
+		f.generations = make(map[int64]*filter.Generator)
+	}
+	g, ok := f.generations[partition]
+	if !ok {
+		g = f.filterBlock.NewGeneration(f.window)
+		f.generations[partition] = g
+	}
+	g.Append(h)
+}
+
+// release drops filter generations of partitions that are fully expired.
+func (f *Filter) release(now time.Time) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int
+	for partition := range f.generations {
+		if time.Unix(partition, 0).After(now) {
+			continue
+		}
+		delete(f.generations, partition)
+		n++
+	}
+	return n
+}
+
 // Test tests entry in bloom filter. It returns false if entry definitely does not exist or true may be entry exist in DB.
 func (f *Filter) Test(h uint64) bool {
+	f.mu.RLock()
+	if f.filterBlock.Test(h) {
+		f.mu.RUnlock()
+		return true
+	}
+	for _, g := range f.generations {
+		if g.Test(h) {
+			f.mu.RUnlock()
+			return true
+		}
+	}
+	f.mu.RUnlock()
+
 	/// Test filter block for presence.
 	fltr, _ := f.getFilterBlock(true)
 	if fltr != nil && !fltr.Test(h) {
@@ -44,6 +115,16 @@ func (f *Filter) Test(h uint64) bool {
 	return true
 }
 
+// reset replaces the bloom filter with the filter rebuilt from the index file. The filter block
+// cached from the filter file is invalidated as the filter file is rewritten.
+func (f *Filter) reset(filterBlock *filter.Generator) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filterBlock = filterBlock
+	f.generations = nil
+	f.cacheID++
+}
+
 // Close finalizes writing filter to file.
 func (f *Filter) close() error {
 	f.writeFilterBlock()
@@ -63,6 +144,68 @@ func (f *Filter) writeFilterBlock() error {
 	return nil
 }
 
+// generationsPath returns path of the generations file.
+func generationsPath(dirName string) string {
+	return path.Join(dirName, fmt.Sprintf("%s.fgen", prefix))
+}
+
+// writeGenerations writes the filter generations not yet dropped to the generations
+// file, so the generations survive the restart.
+func (f *Filter) writeGenerations() error {
+	f.mu.RLock()
+	var buf []byte
+	for partition, g := range f.generations {
+		var hdr [generationHeaderSize]byte
+		binary.LittleEndian.PutUint64(hdr[:8], uint64(partition))
+		binary.LittleEndian.PutUint64(hdr[8:], g.Bits())
+		buf = append(buf, hdr[:]...)
+		buf = append(buf, g.Bytes()...)
+	}
+	f.mu.RUnlock()
+
+	tmp := f.genPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.genPath)
+}
+
+// loadGenerations reads the filter generations from the generations file. The
+// generations of partitions fully expired are dropped.
+func (f *Filter) loadGenerations(now time.Time) error {
+	data, err := ioutil.ReadFile(f.genPath)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(data) > 0 {
+		if len(data) < generationHeaderSize {
+			return errCorrupted
+		}
+		partition := int64(binary.LittleEndian.Uint64(data[:8]))
+		m := binary.LittleEndian.Uint64(data[8:generationHeaderSize])
+		if m == 0 || m > uint64(len(data))*8 {
+			return errCorrupted
+		}
+		n := generationHeaderSize + filter.Size(m)
+		if len(data) < n {
+			return errCorrupted
+		}
+		if time.Unix(partition, 0).After(now) {
+			if f.generations == nil {
+				f.generations = make(map[int64]*filter.Generator)
+			}
+			f.generations[partition] = filter.NewGenerationFromBytes(data[generationHeaderSize:n], m)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
 func (f *Filter) getFilterBlock(fillCache bool) (*filter.Block, error) {
 	if f.file.currSize() <= 0 {
 		return nil, nil
@@ -39,6 +39,18 @@ func newFilter(m, k uint64) *Filter {
 	}
 }
 
+func newFilterWithKeys(m uint64, keys []uint64) *Filter {
+	if m < MMin {
+		return nil
+	}
+	return &Filter{
+		m:    m,
+		n:    0,
+		bits: make([]uint64, (m+63)/64),
+		keys: keys,
+	}
+}
+
 func newFilterFromBytes(b []byte, m, k uint64) *Filter {
 	if m < MMin {
 		return nil
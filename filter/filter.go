@@ -1,8 +1,15 @@
 package filter
 
+import "time"
+
 const (
 	bloomHashes uint64 = 7
 	bloomBits   uint64 = 160000
+
+	// generationWindow is the duplicate window the filter block is sized for, a filter
+	// generation is sized in proportion of its duplicate window to the generation window.
+	generationWindow  = 24 * time.Hour
+	minGenerationBits = 4096
 )
 
 // Generator bloom filter generator.
@@ -30,6 +37,45 @@ func (b *Generator) Bytes() []byte {
 	return b.filter.Bytes()
 }
 
+// Test is used to test for key presence in the filter generator.
+func (b *Generator) Test(h uint64) bool {
+	return b.filter.Test(h)
+}
+
+// NewGeneration returns an empty filter generator sized for the duplicate window and
+// sharing the hash keys of the filter generator.
+func (b *Generator) NewGeneration(window time.Duration) *Generator {
+	m := uint64(float64(bloomBits) * window.Seconds() / generationWindow.Seconds())
+	if m < minGenerationBits {
+		m = minGenerationBits
+	}
+	if m > bloomBits {
+		m = bloomBits
+	}
+	return &Generator{filter: newFilterWithKeys(m, b.filter.keys)}
+}
+
+// NewGenerationFromBytes returns the filter generator of m bits from the contents
+// returned by Bytes.
+func NewGenerationFromBytes(b []byte, m uint64) *Generator {
+	return &Generator{filter: newFilterFromBytes(b, m, bloomHashes)}
+}
+
+// Bits returns number of bits of the filter generator.
+func (b *Generator) Bits() uint64 {
+	return b.filter.m
+}
+
+// Size returns size of contents of the filter generator of m bits.
+func Size(m uint64) int {
+	return int(bloomHashes+(m+63)/64) * Uint64Bytes
+}
+
+// BlockSize returns size of contents of the filter block.
+func BlockSize() int {
+	return Size(bloomBits)
+}
+
 // Block is a filter block
 type Block struct {
 	filter *Filter
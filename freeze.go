@@ -0,0 +1,80 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// _Freeze holds the state of writes frozen for external snapshot.
+type _Freeze struct {
+	mu     sync.Mutex
+	frozen bool
+	timer  *time.Timer
+}
+
+// FreezeWrites syncs entries to the DB files, fsyncs the files and blocks new syncs and expiry,
+// so operators can take filesystem-level snapshots (e.g. LVM or ZFS) of the DB directory. It returns
+// once the DB files are quiescent. Entries not yet synced and the Puts accepted while writes are
+// frozen are kept in the write ahead log, which is recovered on open of a restored snapshot.
+// Writes are thawed automatically after the max freeze duration.
+func (db *DB) FreezeWrites(ctx context.Context) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	f := &db.internal.freeze
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.frozen {
+		return errFrozen
+	}
+	if err := db.internal.syncLock.lockContext(ctx); err != nil {
+		return err
+	}
+	if err := db.syncLocked(); err != nil {
+		db.internal.syncLock.unlock()
+		return err
+	}
+	// sync writes header and fsyncs files even if there are no pending entries.
+	if err := db.sync(); err != nil {
+		db.internal.syncLock.unlock()
+		return err
+	}
+	f.frozen = true
+	f.timer = time.AfterFunc(db.opts.maxFreezeDuration, func() {
+		if err := db.Thaw(); err == nil {
+			logger.Warn().Str("context", "db.FreezeWrites").Dur("duration", db.opts.maxFreezeDuration).Msg("max freeze duration exceeded, writes thawed")
+		}
+	})
+	return nil
+}
+
+// Thaw resumes syncs and expiry blocked by FreezeWrites.
+func (db *DB) Thaw() error {
+	f := &db.internal.freeze
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.frozen {
+		return errNotFrozen
+	}
+	f.timer.Stop()
+	f.frozen = false
+	db.internal.syncLock.unlock()
+	return nil
+}
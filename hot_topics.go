@@ -0,0 +1,199 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	sketchDepth = 4
+	sketchWidth = 1024
+
+	// maxHotTopics is the maximum number of topics tracked as hot topic candidates in an interval.
+	maxHotTopics = 128
+)
+
+type (
+	// HotTopic holds traffic of a topic over the last interval.
+	HotTopic struct {
+		Topic    string
+		Contract uint32
+		Writes   int64
+		Reads    int64
+	}
+
+	// _HotTopics tracks per topic traffic using count-min sketch and keeps top topics by traffic as candidates.
+	_HotTopics struct {
+		mu       sync.Mutex
+		interval time.Duration
+		start    time.Time
+
+		sketch     [sketchDepth][sketchWidth]uint32
+		candidates map[uint64]*HotTopic
+		minCount   uint32
+
+		// last holds the hot topics of the last completed interval.
+		last []HotTopic
+	}
+)
+
+func newHotTopics(interval time.Duration) *_HotTopics {
+	return &_HotTopics{
+		interval:   interval,
+		start:      time.Now(),
+		candidates: make(map[uint64]*HotTopic),
+	}
+}
+
+func (h *_HotTopics) enabled() bool {
+	return h != nil && h.interval > 0
+}
+
+// add records a write or read on the topic.
+func (h *_HotTopics) add(contract uint32, topic []byte, write bool) {
+	if !h.enabled() {
+		return
+	}
+	// topic options are not part of the topic.
+	if i := bytes.IndexByte(topic, '?'); i >= 0 {
+		topic = topic[:i]
+	}
+	hs := fnv.New64a()
+	hs.Write([]byte{byte(contract), byte(contract >> 8), byte(contract >> 16), byte(contract >> 24)})
+	hs.Write(topic)
+	key := hs.Sum64()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.start) >= h.interval {
+		h.rotate()
+	}
+
+	est := ^uint32(0)
+	for i := 0; i < sketchDepth; i++ {
+		idx := (key ^ uint64(i)*0x9e3779b97f4a7c15) % sketchWidth
+		h.sketch[i][idx]++
+		if h.sketch[i][idx] < est {
+			est = h.sketch[i][idx]
+		}
+	}
+
+	c, ok := h.candidates[key]
+	if !ok {
+		if len(h.candidates) >= maxHotTopics {
+			if est <= h.minCount {
+				return
+			}
+			h.evict()
+		}
+		// a new candidate starts with the traffic of the topic estimated by the sketch, so a candidate
+		// admitted to a full table is not evicted by the next topic before its traffic is counted.
+		c = &HotTopic{Topic: string(topic), Contract: contract}
+		if write {
+			c.Writes = int64(est)
+		} else {
+			c.Reads = int64(est)
+		}
+		h.candidates[key] = c
+		h.minCount = h.minTraffic()
+		return
+	}
+	if write {
+		c.Writes++
+	} else {
+		c.Reads++
+	}
+}
+
+// evict removes the candidate with the least traffic.
+func (h *_HotTopics) evict() {
+	var minKey uint64
+	min := int64(-1)
+	for k, c := range h.candidates {
+		if n := c.Writes + c.Reads; min < 0 || n < min {
+			min, minKey = n, k
+		}
+	}
+	delete(h.candidates, minKey)
+}
+
+// minTraffic returns the least traffic of the candidates.
+func (h *_HotTopics) minTraffic() uint32 {
+	min := int64(-1)
+	for _, c := range h.candidates {
+		if n := c.Writes + c.Reads; min < 0 || n < min {
+			min = n
+		}
+	}
+	if min < 0 {
+		return 0
+	}
+	return uint32(min)
+}
+
+// rotate completes the current interval.
+func (h *_HotTopics) rotate() {
+	h.last = h.sorted()
+	h.sketch = [sketchDepth][sketchWidth]uint32{}
+	h.candidates = make(map[uint64]*HotTopic)
+	h.minCount = 0
+	h.start = time.Now()
+}
+
+func (h *_HotTopics) sorted() []HotTopic {
+	tops := make([]HotTopic, 0, len(h.candidates))
+	for _, c := range h.candidates {
+		tops = append(tops, *c)
+	}
+	sort.Slice(tops, func(i, j int) bool { return tops[i].Writes+tops[i].Reads > tops[j].Writes+tops[j].Reads })
+	return tops
+}
+
+// top returns top n topics by traffic over the last interval.
+func (h *_HotTopics) top(n int) []HotTopic {
+	if !h.enabled() {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.start) >= h.interval {
+		h.rotate()
+	}
+	tops := h.last
+	if tops == nil {
+		// no interval is completed yet.
+		tops = h.sorted()
+	}
+	switch {
+	case n < 0:
+		n = 0
+	case n > len(tops):
+		n = len(tops)
+	}
+	return append([]HotTopic(nil), tops[:n]...)
+}
+
+// HotTopics returns the top n topics by traffic over the last interval.
+// It returns nil unless hot topics tracking is set on DB using WithHotTopics option.
+func (db *DB) HotTopics(n int) []HotTopic {
+	return db.internal.hotTopics.top(n)
+}
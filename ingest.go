@@ -0,0 +1,233 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// ingestBatchEntries is the number of entries of the iterator written to the DB files in a batch by Ingest.
+const ingestBatchEntries = 10000
+
+// EntryIterator is the source of the entries written to the DB by Ingest.
+type EntryIterator interface {
+	// Next returns the next entry to ingest, it returns io.EOF if there are no more entries. The
+	// entry returned is retained until its batch is written, so Next returns a new entry on each call.
+	Next() (*Entry, error)
+}
+
+// ingestMarkerPath returns the path of the file marking an ingest in progress.
+func ingestMarkerPath(dirName string) string {
+	return path.Join(dirName, fmt.Sprintf("%s.ingest", prefix))
+}
+
+// ingestIncomplete returns true if an ingest into the DB at the path did not complete.
+func ingestIncomplete(dirName string) bool {
+	_, err := os.Stat(ingestMarkerPath(dirName))
+	return err == nil
+}
+
+// Ingest writes the entries of the iterator directly to the index, window and data files in batches of
+// entries sorted by sequence, skipping the write ahead log and the mem store, it is used for the initial load
+// of a large number of messages. The files are synced and the header is written once all the entries are
+// written, so the DB is marked consistent only after Ingest completes. If Ingest fails or the process stops,
+// Open returns an error until the DB files are removed and the ingest is run again.
+//
+// Ingest holds the sync lock while it runs, and the ingested entries are not sent to watchers or replicas.
+// Topic settings and quotas apply as on Put but the dedup window of the topic is not. It returns the number
+// of entries ingested.
+func (db *DB) Ingest(it EntryIterator) (n int, err error) {
+	if err := db.ok(); err != nil {
+		return 0, err
+	}
+	if db.opts.replicaOf != "" {
+		return 0, errReplica
+	}
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+
+	// entries released by the mem store are synced first, the entries not yet released are synced after the ingest.
+	if err := db.syncLocked(); err != nil {
+		return 0, err
+	}
+	marker, err := os.OpenFile(ingestMarkerPath(db.internal.path), os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return 0, err
+	}
+	if err := marker.Sync(); err != nil {
+		marker.Close()
+		return 0, err
+	}
+	if err := marker.Close(); err != nil {
+		return 0, err
+	}
+
+	h := &_SyncHandle{DB: db}
+	if err := h.startIngest(); err != nil {
+		return 0, err
+	}
+	defer h.finish()
+	packed := make(map[uint64]struct{})
+	entries := make([]*Entry, 0, ingestBatchEntries)
+	for done := false; !done; {
+		entries = entries[:0]
+		for len(entries) < ingestBatchEntries {
+			e, err := it.Next()
+			if err == io.EOF {
+				done = true
+				break
+			}
+			if err != nil {
+				return n, err
+			}
+			if ok, err := db.setIngestEntry(e, packed); err != nil {
+				return n, err
+			} else if ok {
+				entries = append(entries, e)
+			}
+		}
+		if err := h.ingest(entries); err != nil {
+			return n, err
+		}
+		db.internal.queryCache.invalidateAll()
+		n += len(entries)
+	}
+
+	// the header is written and the files are synced before the DB is marked consistent.
+	if err := db.sync(); err != nil {
+		return n, err
+	}
+	return n, os.Remove(ingestMarkerPath(db.internal.path))
+}
+
+// setIngestEntry validates and sets the entry to ingest and adds its topic to the trie. It
+// returns false if the entry is dropped. The topic of the entry is packed if the topic is not yet
+// packed by the ingest and the entries of the topic are only in the mem store, as the ingested
+// entries are written to the window file before the entries in the mem store.
+func (db *DB) setIngestEntry(e *Entry, packed map[uint64]struct{}) (bool, error) {
+	switch {
+	case len(e.Topic) == 0:
+		return false, errTopicEmpty
+	case len(e.Topic) > maxTopicLength:
+		return false, errTopicTooLarge
+	case len(e.Payload) == 0:
+		return false, errValueEmpty
+	case len(e.Payload) > maxValueLength:
+		return false, errValueTooLarge
+	}
+	if err := db.authorize(e.Contract, e.Topic, OpPut); err != nil {
+		return false, err
+	}
+	if ok, err := db.applyTopic(e); !ok || err != nil {
+		return false, err
+	}
+	if e.Contract == 0 {
+		e.Contract = message.MasterContract
+	}
+	t, _, err := db.parseTopic(e.Contract, e.Topic)
+	if err != nil {
+		return false, err
+	}
+	t.AddContract(e.Contract)
+	topicHash := t.GetHash(e.Contract)
+	if off, ok := db.internal.trie.getOffset(topicHash); ok && off == 0 {
+		_, done := packed[topicHash]
+		e.entry.packTopic = !done
+	}
+	if err := db.setEntry(e); err != nil {
+		return false, err
+	}
+	if err := db.checkQuota(e.Contract, int64(len(e.entry.cache)-entrySize)); err != nil {
+		return false, err
+	}
+	if e.entry.topicSize != 0 {
+		packed[topicHash] = struct{}{}
+		if ok := db.internal.trie.add(newTopic(e.entry.topicHash, 0), t.Parts, t.Depth); ok {
+			db.addTopicName(e.Topic, t.Parts)
+		}
+	}
+	return true, nil
+}
+
+// startIngest starts the sync handle to write the entries of an ingest.
+func (db *_SyncHandle) startIngest() error {
+	db.rawWindow = db.internal.bufPool.Get()
+	db.rawBlock = db.internal.bufPool.Get()
+	var err error
+	if db.windowWriter, err = newWindowWriter(db.fs, db.rawWindow); err != nil {
+		return err
+	}
+	if db.blockWriter, err = newBlockWriter(db.fs, db.internal.freeList, db.rawBlock); err != nil {
+		return err
+	}
+	db.syncInfo.syncStatusOk = true
+	db.syncInfo.ingest = true
+	return nil
+}
+
+// ingest writes a batch of entries to the index, window and data files.
+func (db *_SyncHandle) ingest(entries []*Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].entry.seq < entries[j].entry.seq
+	})
+	winEntries := make(map[uint64]_WindowEntries)
+	for _, e := range entries {
+		m := e.entry
+		if m.seq > db.syncInfo.upperSeq {
+			db.syncInfo.upperSeq = m.seq
+		}
+		ie := _IndexEntry{
+			seq:       m.seq,
+			topicSize: m.topicSize,
+			valueSize: m.valueSize,
+
+			cache: m.cache[entrySize:],
+		}
+		if err := db.blockWriter.append(ie); err != nil {
+			if err == errEntryExist {
+				continue
+			}
+			return err
+		}
+		we := newWinEntry(m.seq, m.expiresAt)
+		winEntries[m.topicHash] = append(winEntries[m.topicHash], we)
+		db.internal.filter.appendWithExpiry(we.seq(), we.expiryTime())
+		db.syncInfo.count++
+		db.syncContract(ie)
+		db.syncInfo.inBytes += int64(ie.valueSize)
+	}
+	for h, wEntries := range winEntries {
+		topicOff, ok := db.internal.trie.getOffset(h)
+		if !ok {
+			return errors.New("db.Ingest: unable to get topic offset from trie")
+		}
+		if _, err := db.windowWriter.append(h, topicOff, wEntries); err != nil {
+			return err
+		}
+	}
+	return db.sync(false)
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"math"
+	"sort"
+)
+
+type (
+	// _TopicIterator walks window entries of a topic in reverse time order.
+	_TopicIterator struct {
+		hash    uint64
+		next    int64          // next is offset of next window block to read.
+		started bool           // started is set once the first window block is read.
+		done    bool           // done is set if there are no more window blocks to read.
+		entries _WindowEntries // entries pending to read in descending sequence order.
+	}
+
+	// ItemIterator iterates over items matching the query in reverse time order. It
+	// reads window blocks and messages lazily as the iterator advances so items of
+	// large topics are not materialized in memory.
+	ItemIterator struct {
+		db     *DB
+		query  *Query
+		topics []*_TopicIterator
+		limit  int
+		count  int
+		item   _Item
+		err    error
+
+		// epoch is the read epoch of the iterator, the iterator exits the epoch once it is exhausted.
+		epoch  uint64
+		exited bool
+	}
+)
+
+// Items returns an iterator over items matching the query. The default and max query
+// limits do not apply to the iterator, if the query specify a limit the iterator stops
+// after the limit number of items.
+func (db *DB) Items(q *Query) (*ItemIterator, error) {
+	limit := q.Limit
+	if err := db.parseQuery(q); err != nil {
+		return nil, err
+	}
+	it := &ItemIterator{db: db, query: q, limit: limit, epoch: db.internal.readEpochs.enter()}
+	mu := db.internal.mutex.getMutex(q.internal.prefix)
+	mu.RLock()
+	defer mu.RUnlock()
+	topics := db.queryTopics(q)
+	for _, topic := range topics {
+		t := &_TopicIterator{hash: topic.hash, next: topic.offset}
+		// entries not yet sync to window file are the most recent entries of the topic.
+		t.entries = db.internal.timeWindow.ilookup(topic.hash, q.internal.before, math.MaxInt32)
+		sort.Slice(t.entries, func(i, j int) bool { return t.entries[i].sequence > t.entries[j].sequence })
+		it.topics = append(it.topics, t)
+	}
+	db.internal.hotTopics.add(q.Contract, q.Topic, false)
+	return it, nil
+}
+
+// Next advances the iterator to the next item. It returns false if there are no more
+// items or an error occurred, check Err for the error.
+func (it *ItemIterator) Next() bool {
+	it.item = _Item{}
+	for it.err == nil && (it.limit <= 0 || it.count < it.limit) {
+		if err := it.db.ok(); err != nil {
+			it.err = err
+			it.exit()
+			return false
+		}
+		t := it.nextTopic()
+		if t == nil {
+			it.exit()
+			return false
+		}
+		we := t.entries[0]
+		t.entries = t.entries[1:]
+		item, ok, err := it.read(_Query{topicHash: t.hash, seq: we.seq()})
+		if err != nil {
+			it.err = err
+			it.exit()
+			return false
+		}
+		if !ok {
+			continue
+		}
+		it.item = item
+		it.count++
+		it.query.internal.lastSeq = we.seq()
+		it.db.internal.meter.Gets.Inc(1)
+		it.db.internal.meter.OutMsgs.Inc(1)
+		return true
+	}
+	it.exit()
+	return false
+}
+
+// exit exits the read epoch of the iterator, so window blocks retired by compaction are reclaimed.
+func (it *ItemIterator) exit() {
+	if !it.exited {
+		it.exited = true
+		it.db.internal.readEpochs.exit(it.epoch)
+	}
+}
+
+// Value returns the current item. The value is valid until the next call to Next.
+func (it *ItemIterator) Value() []byte {
+	return it.item.val
+}
+
+// Err returns the error occurred during the iteration, if any.
+func (it *ItemIterator) Err() error {
+	return it.err
+}
+
+func (it *ItemIterator) read(query _Query) (_Item, bool, error) {
+	mu := it.db.internal.mutex.getMutex(it.query.internal.prefix)
+	mu.RLock()
+	defer mu.RUnlock()
+	return it.db.readItem(it.query, query)
+}
+
+// nextTopic returns the topic with the most recent pending entry, it reads window blocks
+// of the topics as needed. It returns nil if there are no more entries to read.
+func (it *ItemIterator) nextTopic() *_TopicIterator {
+	var next *_TopicIterator
+	for _, t := range it.topics {
+		for len(t.entries) == 0 && !t.done {
+			if err := it.readBlock(t); err != nil {
+				it.err = err
+				return nil
+			}
+		}
+		if len(t.entries) == 0 {
+			continue
+		}
+		if next == nil || t.entries[0].sequence > next.entries[0].sequence {
+			next = t
+		}
+	}
+	return next
+}
+
+// readBlock reads the next window block of the topic.
+func (it *ItemIterator) readBlock(t *_TopicIterator) error {
+	if t.started && t.next == 0 {
+		t.done = true
+		return nil
+	}
+	winFile, err := it.db.fs.getFile(_FileDesc{fileType: typeTimeWindow})
+	if err != nil {
+		return err
+	}
+	r := _WindowReader{winFile: winFile, offset: t.next}
+	b, err := r.readWindowBlock()
+	t.started = true
+	if err != nil || b.topicHash != t.hash {
+		// topic does not have entries in window file.
+		t.done = true
+		return nil
+	}
+	if before := it.query.internal.before; before > 0 {
+		b.trim(before)
+	}
+	for i := int(b.entryIdx) - 1; i >= 0; i-- {
+		if we := b.entries[i]; !we.isExpired() {
+			t.entries = append(t.entries, we)
+		}
+	}
+	t.next = b.next
+	if b.cutoff(it.query.internal.cutoff) {
+		t.done = true
+	}
+	return nil
+}
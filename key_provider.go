@@ -0,0 +1,110 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// keyProviderTimeout is timeout to retrieve key from the key provider.
+	keyProviderTimeout = 30 * time.Second
+)
+
+// KeyProvider provides encryption keys from a key management service such as AWS KMS or Vault,
+// so keys are not passed as raw bytes in Options.
+type KeyProvider interface {
+	// GetKey returns the 256-bit/32 byte encryption key for the key id.
+	GetKey(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// KeyProviderFunc is an adapter to use ordinary function as KeyProvider.
+type KeyProviderFunc func(ctx context.Context, keyID string) ([]byte, error)
+
+// GetKey calls f(ctx, keyID).
+func (f KeyProviderFunc) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	return f(ctx, keyID)
+}
+
+// _KeyCache caches the key retrieved from the key provider. If key provider fails to
+// refresh the key, the cached key is used until the key provider is available.
+type _KeyCache struct {
+	mu       sync.Mutex
+	provider KeyProvider
+	keyID    string
+	ttl      time.Duration
+	key      []byte
+	expires  time.Time
+}
+
+func newKeyCache(provider KeyProvider, keyID string, ttl time.Duration) *_KeyCache {
+	return &_KeyCache{provider: provider, keyID: keyID, ttl: ttl}
+}
+
+// get returns cached key or retrieves the key from key provider if cached key has expired.
+func (c *_KeyCache) get(ctx context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key != nil && (c.ttl == 0 || time.Now().Before(c.expires)) {
+		return c.key, nil
+	}
+	key, err := c.provider.GetKey(ctx, c.keyID)
+	if err != nil {
+		if c.key != nil {
+			logger.Error().Err(err).Str("context", "keyCache.get").Msg("using cached key")
+			return c.key, nil
+		}
+		return nil, err
+	}
+	c.key = key
+	c.expires = time.Now().Add(c.ttl)
+	return key, nil
+}
+
+// startKeyRefresher refreshes the encryption key from the key provider. If key provider returns a new key,
+// the keyring is rotated to the new key.
+func (db *DB) startKeyRefresher(interval time.Duration) {
+	refreshTicker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-refreshTicker.C:
+				if err := db.refreshKey(); err != nil {
+					logger.Error().Err(err).Str("context", "startKeyRefresher").Msg("Error refreshing encryption key")
+				}
+			case <-db.internal.closeC:
+				refreshTicker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (db *DB) refreshKey() error {
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	key, err := db.internal.keyCache.get(ctx)
+	if err != nil {
+		return err
+	}
+	if db.internal.keyring.hasKey(key) {
+		return nil
+	}
+	return db.internal.keyring.rotate(key, nil)
+}
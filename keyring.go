@@ -0,0 +1,211 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/unit-io/unitdb/crypto"
+)
+
+const (
+	keyringVersion = 1
+	keyringHeader  = 12
+
+	// maxDataKeys is the maximum number of data keys, the key id of a message is stored in a single byte.
+	maxDataKeys = 255
+)
+
+var keyringSignature = [7]byte{'u', 'n', 'i', 't', 'k', 'e', 'y'}
+
+// _Keyring implements envelope encryption. Messages are encrypted using data keys and data keys are
+// stored wrapped by the encryption key, so rotating the encryption key re-wraps the data keys only.
+// Data key id is stored in the message ID, key id zero is used for the messages not encrypted.
+//
+// A DB without keyring file uses the encryption key as its only data key, the keyring file is
+// written on first key rotation.
+type _Keyring struct {
+	mu       sync.RWMutex
+	rotateMu sync.Mutex // serializes key rotations.
+	path     string
+	kek      []byte
+	dataKeys [][]byte // data key with id i+1 is stored at index i.
+	macs     []*crypto.MAC
+}
+
+// openKeyring opens the keyring from the DB directory. If keyring file does not exist and generate is set, a new
+// random data key is generated and the keyring file is written.
+func openKeyring(dirName string, kek []byte, generate bool) (*_Keyring, error) {
+	k := &_Keyring{path: path.Join(dirName, fmt.Sprintf("%s.keyring", prefix))}
+	// Remove the keyring left from an incomplete rotation, the previous keyring is still in effect.
+	os.Remove(k.path + ".tmp")
+
+	data, err := ioutil.ReadFile(k.path)
+	switch {
+	case os.IsNotExist(err) && generate:
+		dataKey, err := crypto.NewKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := k.write(kek, [][]byte{dataKey}, nil); err != nil {
+			return nil, err
+		}
+		return k, k.set(kek, [][]byte{dataKey})
+	case os.IsNotExist(err):
+		return k, k.set(kek, [][]byte{kek})
+	case err != nil:
+		return nil, err
+	}
+
+	if len(data) < keyringHeader || string(data[:7]) != string(keyringSignature[:]) {
+		return nil, errCorrupted
+	}
+	n := int(binary.LittleEndian.Uint32(data[8:keyringHeader]))
+	if len(data) != keyringHeader+n*crypto.WrappedKeySize {
+		return nil, errCorrupted
+	}
+	dataKeys := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		off := keyringHeader + i*crypto.WrappedKeySize
+		dataKey, err := crypto.UnwrapKey(kek, data[off:off+crypto.WrappedKeySize], []byte{byte(i + 1)})
+		if err != nil {
+			return nil, errKeyMismatch
+		}
+		dataKeys = append(dataKeys, dataKey)
+	}
+	return k, k.set(kek, dataKeys)
+}
+
+func (k *_Keyring) set(kek []byte, dataKeys [][]byte) error {
+	macs := make([]*crypto.MAC, 0, len(dataKeys))
+	for _, dataKey := range dataKeys {
+		mac, err := crypto.New(dataKey)
+		if err != nil {
+			return err
+		}
+		macs = append(macs, mac)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.kek = kek
+	k.dataKeys = dataKeys
+	k.macs = macs
+	return nil
+}
+
+// hasKey returns true if data keys are wrapped using the encryption key.
+func (k *_Keyring) hasKey(kek []byte) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return bytes.Equal(k.kek, kek)
+}
+
+// current returns the data key used to encrypt new messages.
+func (k *_Keyring) current() (uint8, *crypto.MAC) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return uint8(len(k.macs)), k.macs[len(k.macs)-1]
+}
+
+// mac returns the data key for the key id.
+func (k *_Keyring) mac(id uint8) (*crypto.MAC, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if id == 0 || int(id) > len(k.macs) {
+		return nil, errKeyNotFound
+	}
+	return k.macs[id-1], nil
+}
+
+// rotate re-wraps the data keys using the new encryption key. A new data key is added to encrypt new messages.
+func (k *_Keyring) rotate(kek []byte, progress func(done, total int)) error {
+	if _, err := crypto.New(kek); err != nil {
+		return err
+	}
+	k.rotateMu.Lock()
+	defer k.rotateMu.Unlock()
+	k.mu.RLock()
+	dataKeys := append([][]byte(nil), k.dataKeys...)
+	k.mu.RUnlock()
+	if len(dataKeys) < maxDataKeys {
+		dataKey, err := crypto.NewKey()
+		if err != nil {
+			return err
+		}
+		dataKeys = append(dataKeys, dataKey)
+	}
+	if err := k.write(kek, dataKeys, progress); err != nil {
+		return err
+	}
+	return k.set(kek, dataKeys)
+}
+
+// write writes the keyring to a temporary file and renames it over the keyring file, so a crash
+// leaves either the previous or the new keyring in effect.
+func (k *_Keyring) write(kek []byte, dataKeys [][]byte, progress func(done, total int)) error {
+	buf := make([]byte, keyringHeader, keyringHeader+len(dataKeys)*crypto.WrappedKeySize)
+	copy(buf[:7], keyringSignature[:])
+	buf[7] = keyringVersion
+	binary.LittleEndian.PutUint32(buf[8:keyringHeader], uint32(len(dataKeys)))
+	for i, dataKey := range dataKeys {
+		wrapped, err := crypto.WrapKey(kek, dataKey, []byte{byte(i + 1)})
+		if err != nil {
+			return err
+		}
+		buf = append(buf, wrapped...)
+		if progress != nil {
+			progress(i+1, len(dataKeys))
+		}
+	}
+
+	tmp := k.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return err
+	}
+	return syncDir(path.Dir(k.path))
+}
+
+// syncDir flushes the directory entries to disk.
+func syncDir(dirName string) error {
+	d, err := os.Open(dirName)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
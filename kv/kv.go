@@ -0,0 +1,233 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kv provides a key-value adapter on top of unitdb. Keys are mapped onto topics
+// and the value of a key is the retained (latest) message of the topic. It eases migration
+// of applications using a common KV interface for the subset of usage unitdb fits.
+//
+// Keys are topics using '.' as separator, prefix iteration is supported on topic part boundaries
+// and an empty prefix iterates all keys.
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/unit-io/unitdb"
+)
+
+const (
+	flagValue     = 0
+	flagTombstone = 1
+
+	headerSize = 3
+
+	// getLimit is number of latest messages of the topic to scan for the key.
+	getLimit = 16
+
+	// iteratePageSize is number of keys of the key index read per page for prefix iteration.
+	iteratePageSize = 1000
+
+	// indexContract is the contract used to keep key index of the prefixes, so
+	// index topics do not collide with the key topics.
+	indexContract uint32 = 0x6b76
+
+	// rootContract is the contract used to keep key index of all keys under the root topic,
+	// the root index is iterated for an empty prefix.
+	rootContract uint32 = 0x6b77
+	rootTopic           = "keys"
+)
+
+var (
+	// ErrKeyNotFound is returned if key does not exist.
+	ErrKeyNotFound = errors.New("kv: key not found")
+
+	// ErrInvalidKey is returned if key is empty or contains wildcards.
+	ErrInvalidKey = errors.New("kv: invalid key")
+)
+
+// Store is a key-value store backed by unitdb.
+type Store struct {
+	db    *unitdb.DB
+	owned bool
+}
+
+// Open opens the unitdb at the path and returns a key-value store.
+// DB is opened as mutable with default options followed by the opts.
+func Open(path string, opts ...unitdb.Options) (*Store, error) {
+	opts = append([]unitdb.Options{unitdb.WithDefaultOptions(), unitdb.WithMutable()}, opts...)
+	db, err := unitdb.Open(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, owned: true}, nil
+}
+
+// New returns a key-value store using an open DB.
+func New(db *unitdb.DB) *Store {
+	return &Store{db: db}
+}
+
+// Close closes the store and the DB if DB was opened by the store.
+func (s *Store) Close() error {
+	if !s.owned {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Get returns the value of the key.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	v, flag, ok, err := s.record(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || flag == flagTombstone {
+		return nil, ErrKeyNotFound
+	}
+	return v, nil
+}
+
+// record returns the value and flag of the latest record of the key, ok is false if
+// the key has no record.
+func (s *Store) record(key []byte) (value []byte, flag byte, ok bool, err error) {
+	items, err := s.db.Get(unitdb.NewQuery(key).WithLimit(getLimit))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	for _, item := range items {
+		k, v, flag, ok := decode(item)
+		if !ok || !bytes.Equal(k, key) {
+			continue
+		}
+		return v, flag, true, nil
+	}
+	return nil, 0, false, nil
+}
+
+// Set sets the value of the key. A key is added to the key index of the root and each of its
+// prefixes on its first record, the tombstone of a deleted key keeps the key in the index.
+func (s *Store) Set(key, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, _, indexed, err := s.record(key)
+	if err != nil {
+		return err
+	}
+	if !indexed {
+		if err := s.db.PutEntry(unitdb.NewEntry([]byte(rootTopic), key).WithContract(rootContract)); err != nil {
+			return err
+		}
+		for i := range key {
+			if key[i] != '.' {
+				continue
+			}
+			if err := s.db.PutEntry(unitdb.NewEntry(key[:i], key).WithContract(indexContract)); err != nil {
+				return err
+			}
+		}
+	}
+	return s.db.Put(key, encode(key, value, flagValue))
+}
+
+// Delete deletes the key. Delete retains a tombstone as the latest message of the topic.
+func (s *Store) Delete(key []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s.db.Put(key, encode(key, nil, flagTombstone))
+}
+
+// Iterate calls fn for each key with the prefix in key order. The prefix must end on a
+// topic part boundary, an empty prefix iterates all keys. Iteration stops on first error returned by fn.
+func (s *Store) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	prefix = bytes.TrimSuffix(prefix, []byte("."))
+	topic, contract := prefix, indexContract
+	if len(prefix) == 0 {
+		topic, contract = []byte(rootTopic), rootContract
+	} else if err := validateKey(prefix); err != nil {
+		return err
+	}
+	// the key index is read in pages until the cursor of the index is exhausted.
+	var keys [][]byte
+	var cursor []byte
+	for {
+		q := unitdb.NewQuery(topic).WithContract(contract).WithLimit(iteratePageSize).WithCursor(cursor)
+		page, err := s.db.Get(q)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, page...)
+		if cursor = q.Cursor(); cursor == nil {
+			break
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	for i, key := range keys {
+		if i > 0 && bytes.Equal(keys[i-1], key) {
+			continue
+		}
+		value, err := s.Get(key)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateKey validates the key is a topic of one or more non-empty parts separated by '.'. The parts
+// are the prefixes a key is indexed on, so a prefix iterates the keys only if it ends on a part boundary,
+// that is prefix "user" or "user." iterates key "user.alice" but prefix "us" does not.
+func validateKey(key []byte) error {
+	if len(key) == 0 || len(key) > 1<<16-1 || bytes.ContainsAny(key, "*?") || bytes.Contains(key, []byte("..")) ||
+		key[0] == '.' || key[len(key)-1] == '.' {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// encode encodes the record as flag, key length, key and value.
+func encode(key, value []byte, flag byte) []byte {
+	buf := make([]byte, headerSize+len(key)+len(value))
+	buf[0] = flag
+	binary.LittleEndian.PutUint16(buf[1:headerSize], uint16(len(key)))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	return buf
+}
+
+func decode(data []byte) (key, value []byte, flag byte, ok bool) {
+	if len(data) < headerSize {
+		return nil, nil, 0, false
+	}
+	keyLen := int(binary.LittleEndian.Uint16(data[1:headerSize]))
+	if len(data) < headerSize+keyLen {
+		return nil, nil, 0, false
+	}
+	return data[headerSize : headerSize+keyLen], data[headerSize+keyLen:], data[0], true
+}
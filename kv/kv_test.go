@@ -0,0 +1,150 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/unit-io/unitdb"
+)
+
+const dbPath = "test"
+
+func openStore(t *testing.T) *Store {
+	os.RemoveAll(dbPath)
+	s, err := Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		os.RemoveAll(dbPath)
+	})
+	return s
+}
+
+func TestSetGetDelete(t *testing.T) {
+	s := openStore(t)
+	key := []byte("user.alice")
+	if _, err := s.Get(key); err != ErrKeyNotFound {
+		t.Fatalf("expected %v; got %v", ErrKeyNotFound, err)
+	}
+	for _, value := range []string{"v1", "v2"} {
+		if err := s.Set(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Get(key); err != nil || string(v) != value {
+			t.Fatalf("expected %s; got %s, %v", value, v, err)
+		}
+	}
+	if err := s.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(key); err != ErrKeyNotFound {
+		t.Fatalf("expected %v after delete; got %v", ErrKeyNotFound, err)
+	}
+	if err := s.Set(key, []byte("v3")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(key); err != nil || string(v) != "v3" {
+		t.Fatalf("expected v3 after set of deleted key; got %s, %v", v, err)
+	}
+	// the key is indexed once although it is set again after delete.
+	keys, err := s.db.Get(unitdb.NewQuery([]byte("user")).WithContract(indexContract).WithLimit(10))
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected key indexed once; got %q, %v", keys, err)
+	}
+	for _, key := range []string{"", "user..alice", ".user", "user.", "user.*", "user?"} {
+		if err := s.Set([]byte(key), nil); err != ErrInvalidKey {
+			t.Fatalf("key %q: expected %v; got %v", key, ErrInvalidKey, err)
+		}
+	}
+}
+
+func TestIterate(t *testing.T) {
+	s := openStore(t)
+	for _, key := range []string{"user.carol", "user.alice", "user.bob", "user.alice.profile", "group.admin", "admin"} {
+		if err := s.Set([]byte(key), []byte("v."+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete([]byte("user.bob")); err != nil {
+		t.Fatal(err)
+	}
+	iterate := func(prefix string) []string {
+		var keys []string
+		if err := s.Iterate([]byte(prefix), func(key, value []byte) error {
+			if string(value) != "v."+string(key) {
+				t.Fatalf("key %s: unexpected value %s", key, value)
+			}
+			keys = append(keys, string(key))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+	for _, prefix := range []string{"user", "user."} {
+		if keys := fmt.Sprint(iterate(prefix)); keys != "[user.alice user.alice.profile user.carol]" {
+			t.Fatalf("prefix %q: unexpected keys %s", prefix, keys)
+		}
+	}
+	if keys := iterate("user.alice"); len(keys) != 1 || keys[0] != "user.alice.profile" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	// empty prefix iterates all keys.
+	if keys := fmt.Sprint(iterate("")); keys != "[admin group.admin user.alice user.alice.profile user.carol]" {
+		t.Fatalf("empty prefix: unexpected keys %s", keys)
+	}
+	// prefix not ending on a part boundary does not match keys.
+	if keys := iterate("us"); len(keys) != 0 {
+		t.Fatalf("expected no keys; got %v", keys)
+	}
+	stop := fmt.Errorf("stop")
+	var n int
+	if err := s.Iterate([]byte("user"), func(key, value []byte) error {
+		n++
+		return stop
+	}); err != stop || n != 1 {
+		t.Fatalf("expected iteration stopped on error; got %v after %d keys", err, n)
+	}
+}
+
+func TestIteratePages(t *testing.T) {
+	s := openStore(t)
+	n := 2*iteratePageSize + 10
+	for i := 0; i < n; i++ {
+		if err := s.Set([]byte(fmt.Sprintf("page.%05d", i)), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var count int
+	if err := s.Iterate([]byte("page"), func(key, value []byte) error {
+		if want := fmt.Sprintf("page.%05d", count); string(key) != want {
+			t.Fatalf("expected key %s; got %s", want, key)
+		}
+		count++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("expected %d keys; got %d", n, count)
+	}
+}
@@ -39,6 +39,10 @@ type _Lease struct {
 	size                  int64 // Total size of free blocks.
 	minimumFreeBlocksSize int64 // Minimum free blocks size before free blocks are reused for new allocation.
 	consistent            *hash.Consistent
+
+	secure bool         // secure sets freed blocks to be zeroed on wipe, see WithSecureDelete.
+	wipeMu sync.Mutex   // wipeMu guards wipes.
+	wipes  []_FreeBlock // Freed blocks not yet zeroed.
 }
 
 type _FreeBlock struct {
@@ -168,6 +172,11 @@ func (l *_Lease) freeBlock(off int64, size uint32) {
 	fbs.fb = append(fbs.fb, _FreeBlock{offset: off, size: size})
 	fbs.cache[off] = true
 	l.size += int64(size)
+	if l.secure {
+		l.wipeMu.Lock()
+		l.wipes = append(l.wipes, _FreeBlock{offset: off, size: size})
+		l.wipeMu.Unlock()
+	}
 }
 
 func (l *_Lease) free(seq uint64, off int64, size uint32) {
@@ -202,9 +211,72 @@ func (l *_Lease) allocate(size uint32) int64 {
 	}
 	delete(fbs.cache, off)
 	l.size -= int64(size)
+	if l.secure {
+		l.unwipe(off, size)
+	}
 	return off
 }
 
+// unwipe removes the allocated block from the freed blocks not yet zeroed, as the
+// allocated block is overwritten by the entries it is allocated for.
+func (l *_Lease) unwipe(off int64, size uint32) {
+	l.wipeMu.Lock()
+	defer l.wipeMu.Unlock()
+	end := off + int64(size)
+	wipes := make([]_FreeBlock, 0, len(l.wipes))
+	for _, b := range l.wipes {
+		bEnd := b.offset + int64(b.size)
+		if bEnd <= off || b.offset >= end {
+			wipes = append(wipes, b)
+			continue
+		}
+		if b.offset < off {
+			wipes = append(wipes, _FreeBlock{offset: b.offset, size: uint32(off - b.offset)})
+		}
+		if bEnd > end {
+			wipes = append(wipes, _FreeBlock{offset: end, size: uint32(bEnd - end)})
+		}
+	}
+	l.wipes = wipes
+}
+
+// wipe zeroes the freed blocks not yet zeroed and returns the number of bytes zeroed.
+func (l *_Lease) wipe(w io.WriterAt) (int64, error) {
+	l.wipeMu.Lock()
+	defer l.wipeMu.Unlock()
+	var n int64
+	var zeros []byte
+	for i, b := range l.wipes {
+		if int(b.size) > len(zeros) {
+			zeros = make([]byte, b.size)
+		}
+		if _, err := w.WriteAt(zeros[:b.size], b.offset); err != nil {
+			l.wipes = l.wipes[i:]
+			return n, err
+		}
+		n += int64(b.size)
+	}
+	l.wipes = l.wipes[:0]
+	return n, nil
+}
+
+// stats returns the number of free blocks, total size of free blocks and size of the largest free block.
+func (l *_Lease) stats() (count int, size, largest int64) {
+	for i := 0; i < nShards; i++ {
+		fbs := l.blocks[i]
+		fbs.RLock()
+		for _, b := range fbs.fb {
+			count++
+			size += int64(b.size)
+			if int64(b.size) > largest {
+				largest = int64(b.size)
+			}
+		}
+		fbs.RUnlock()
+	}
+	return count, size, largest
+}
+
 func (l *_Lease) read() error {
 	off := int64(0)
 	blocks := &_FreeBlocks{cache: make(map[int64]bool)}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"github.com/unit-io/unitdb/message"
+)
+
+// Limits of the storage layer, the limits are the same for all DBs. See Limits for the limits set using options.
+const (
+	// MaxTopicLength is the maximum size of a topic in bytes.
+	MaxTopicLength = maxTopicLength
+	// MaxPayloadSize is the maximum size of a payload in bytes.
+	MaxPayloadSize = maxValueLength
+	// BlockSize is the size of the index and window blocks in bytes.
+	BlockSize = int(blockSize)
+	// SeqsPerIndexBlock is the number of sequences indexed per index block.
+	SeqsPerIndexBlock = entriesPerIndexBlock
+	// EntriesPerWindowBlock is the number of entries of a topic per window block.
+	EntriesPerWindowBlock = entriesPerWindowBlock
+)
+
+// Limits holds the limits of the DB including the limits set using options, so clients and servers
+// can validate the input using the limits the DB validates it with.
+type Limits struct {
+	MaxTopicLength int `json:"max_topic_length"`
+	// MaxTopicDepth is the maximum number of parts of a topic set using WithMaxTopicDepth.
+	MaxTopicDepth  int `json:"max_topic_depth"`
+	MaxPayloadSize int `json:"max_payload_size"`
+	// TopicSeparator is the character separating the parts of a topic set using WithTopicSeparator.
+	TopicSeparator byte `json:"topic_separator"`
+	// ChunkSize is the size payloads larger than the size are split into chunks, 0 if chunking is disabled.
+	ChunkSize int `json:"chunk_size"`
+	// DefaultQueryLimit is the limit of a query not specifying a limit and MaxQueryLimit caps the limit of a query.
+	DefaultQueryLimit     int `json:"default_query_limit"`
+	MaxQueryLimit         int `json:"max_query_limit"`
+	SeqsPerIndexBlock     int `json:"seqs_per_index_block"`
+	EntriesPerWindowBlock int `json:"entries_per_window_block"`
+}
+
+// Limits returns the limits of the DB.
+func (db *DB) Limits() Limits {
+	return Limits{
+		MaxTopicLength:        MaxTopicLength,
+		MaxTopicDepth:         db.opts.maxTopicDepth,
+		TopicSeparator:        byte(db.opts.topicSeparator),
+		MaxPayloadSize:        MaxPayloadSize,
+		ChunkSize:             db.opts.chunkSize,
+		DefaultQueryLimit:     db.opts.queryOptions.defaultQueryLimit,
+		MaxQueryLimit:         db.opts.queryOptions.maxQueryLimit,
+		SeqsPerIndexBlock:     SeqsPerIndexBlock,
+		EntriesPerWindowBlock: EntriesPerWindowBlock,
+	}
+}
+
+// CheckTopic returns the error the DB rejects the topic with if the topic is empty, too large or too deep.
+func (l Limits) CheckTopic(topic []byte) error {
+	switch {
+	case len(topic) == 0:
+		return errTopicEmpty
+	case len(topic) > l.MaxTopicLength:
+		return errTopicTooLarge
+	}
+	if depth := message.Separator(l.TopicSeparator).Depth(topic); l.MaxTopicDepth > 0 && depth > l.MaxTopicDepth {
+		return &TopicDepthError{Depth: depth, MaxDepth: l.MaxTopicDepth}
+	}
+	return nil
+}
+
+// CheckPayload returns the error the DB rejects the payload with if the payload is empty or too large.
+func (l Limits) CheckPayload(payload []byte) error {
+	switch {
+	case len(payload) == 0:
+		return errValueEmpty
+	case len(payload) > l.MaxPayloadSize:
+		return errValueTooLarge
+	}
+	return nil
+}
@@ -39,6 +39,7 @@ type Batch struct {
 func (b *Batch) newTinyLog() {
 	timeID := _TimeID(time.Now().UTC().UnixNano())
 	b.db.addTimeBlock(timeID)
+	b.db.trackUncommitted(timeID)
 	b.tinyLog = &_TinyLog{id: timeID, _TimeID: timeID, managed: true, doneChan: make(chan struct{})}
 }
 
@@ -109,6 +110,7 @@ func (b *Batch) Commit() error {
 	for _, timeID := range b.batchGroup {
 		b.db.internal.timeMark.add(timeID)
 		b.db.internal.timeMark.release(timeID)
+		b.db.untrackUncommitted(timeID)
 	}
 
 	b.batchGroup = b.batchGroup[:0]
@@ -119,11 +121,20 @@ func (b *Batch) Commit() error {
 //Abort aborts batch or perform cleanup operation on batch complete.
 func (b *Batch) Abort() error {
 	_assert(!b.managed, "managed batch abort not allowed")
+	if b.db == nil {
+		// batch is already aborted.
+		return nil
+	}
 	for _, ID := range b.batchGroup {
+		b.db.untrackUncommitted(ID)
 		if err := b.db.releaseLog(ID); err != nil {
 			return err
 		}
 	}
+	// release the time block of the batch not yet written.
+	if b.db.untrackUncommitted(b.tinyLog.timeID()) {
+		b.db.releaseLog(b.tinyLog.timeID())
+	}
 	b.db = nil
 
 	return nil
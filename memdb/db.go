@@ -66,10 +66,15 @@ func Open(opts ...Options) (*DB, error) {
 		timeMark: newTimeMark(),
 		timeLock: newTimeLock(),
 
+		uncommitted: make(map[_TimeID]time.Time),
+
 		// buffer pool
 		buffer: bufPool,
 	}
-	logOpts := wal.Options{Path: options.logFilePath + "/" + logDir, BufferSize: options.bufferSize, Reset: options.logResetFlag}
+	logOpts := wal.Options{Path: options.logFilePath + "/" + LogDir, BufferSize: options.bufferSize, Reset: options.logResetFlag, ArchivePath: options.logArchivePath}
+	if !options.logRestoreTime.IsZero() {
+		logOpts.RestoreTime = options.logRestoreTime.UTC().UnixNano()
+	}
 	wal, err := wal.New(logOpts)
 	if err != nil {
 		wal.Close()
@@ -422,6 +427,53 @@ func (db *DB) Free(timeID int64) error {
 	return db.releaseLog(_TimeID(timeID))
 }
 
+// TimeMarkStats returns the time IDs pending, released and aborted by the time mark and the release latency histogram.
+func (db *DB) TimeMarkStats() TimeMarkStats {
+	return db.internal.timeMark.stats()
+}
+
+// Uncommitted returns time IDs of batches started before the time and not yet committed or aborted.
+func (db *DB) Uncommitted(before time.Time) []int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var timeIDs []int64
+	for timeID, start := range db.internal.uncommitted {
+		if start.Before(before) {
+			timeIDs = append(timeIDs, int64(timeID))
+		}
+	}
+	sort.Slice(timeIDs, func(i, j int) bool {
+		return timeIDs[i] < timeIDs[j]
+	})
+
+	return timeIDs
+}
+
+// Abort removes the time block of a batch not yet committed and releases its logs written to the WAL.
+// It returns number of entries removed, or an error if time block is not of an uncommitted batch.
+func (db *DB) Abort(timeID int64) (int, error) {
+	if !db.untrackUncommitted(_TimeID(timeID)) {
+		return 0, errEntryDoesNotExist
+	}
+	var n int
+	if block, ok := db.timeBlock(_TimeID(timeID)); ok {
+		block.RLock()
+		n = len(block.records)
+		block.RUnlock()
+	}
+	db.internal.timeMark.abort(_TimeID(timeID))
+	if err := db.releaseLog(_TimeID(timeID)); err != nil && err != errEntryDoesNotExist {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// LogSize returns the total size in bytes of the write ahead logs not yet released.
+func (db *DB) LogSize() int64 {
+	return db.internal.wal.Size()
+}
+
 // Size returns the total number of entries in DB.
 func (db *DB) Size() int64 {
 	size := int64(0)
@@ -32,7 +32,8 @@ import (
 const (
 	dbVersion = 1.0
 
-	logDir = "logs"
+	// LogDir is the directory of the write ahead log under the log file path.
+	LogDir = "logs"
 
 	nPoolSize = 27
 
@@ -67,6 +68,9 @@ type _DB struct {
 	timeRef    _TimeID
 	logManager *_TinyLogManager
 
+	// uncommitted tracks start time of time blocks of batches not yet committed.
+	uncommitted map[_TimeID]time.Time
+
 	// buffer pool
 	buffer *bpool.BufferPool
 
@@ -140,6 +144,22 @@ func (db *DB) addTimeBlock(timeID _TimeID) (ok bool) {
 	return false
 }
 
+// trackUncommitted tracks time block of the batch until the batch is committed or aborted.
+func (db *DB) trackUncommitted(timeID _TimeID) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.internal.uncommitted[timeID] = time.Now()
+}
+
+// untrackUncommitted removes the time block from uncommitted time blocks, it returns false if time block was not tracked.
+func (db *DB) untrackUncommitted(timeID _TimeID) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, ok := db.internal.uncommitted[timeID]
+	delete(db.internal.uncommitted, timeID)
+	return ok
+}
+
 func (db *DB) timeBlock(timeID _TimeID) (*_Block, bool) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
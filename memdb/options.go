@@ -32,6 +32,12 @@ type _Options struct {
 	// logResetFlag flag to skips log recovery on DB open and reset WAL.
 	logResetFlag bool
 
+	// logArchivePath sets directory to archive the applied logs.
+	logArchivePath string
+
+	// logRestoreTime sets time up to which the archived logs are recovered on DB open.
+	logRestoreTime time.Time
+
 	logInterval time.Duration
 
 	timeBlockDuration time.Duration
@@ -120,3 +126,17 @@ func WithTimeBlockInterval(dur time.Duration) Options {
 		o.timeBlockDuration = dur
 	})
 }
+
+// WithLogArchivePath sets directory to move the applied logs to instead of releasing them.
+func WithLogArchivePath(path string) Options {
+	return newFuncOption(func(o *_Options) {
+		o.logArchivePath = path
+	})
+}
+
+// WithLogRestoreTime recovers the archived logs written up to the time on DB open.
+func WithLogRestoreTime(t time.Time) Options {
+	return newFuncOption(func(o *_Options) {
+		o.logRestoreTime = t
+	})
+}
@@ -19,32 +19,55 @@ package memdb
 import (
 	"sort"
 	"sync"
+	"time"
 )
 
+// maxAbortedRecords is the number of the most recent aborted time IDs kept for introspection.
+const maxAbortedRecords = 100
+
+// ReleaseLatencyBounds are upper bounds of the release latency histogram buckets, the last bucket
+// holds latencies larger than all bounds.
+var ReleaseLatencyBounds = []time.Duration{10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second}
+
 type (
 	_TimeRecord struct {
 		refs      int
 		lastUnref _TimeID
+		added     time.Time // added is the time the time ID is first marked.
 	}
 
 	_TimeMark struct {
 		sync.RWMutex
 		records         map[_TimeID]_TimeRecord
 		releasedRecords map[_TimeID]_TimeRecord
+		abortedRecords  []_TimeID
+		releaseLatency  []int64
+	}
+
+	// TimeMarkStats holds time IDs tracked by the time mark and the latency from the time a time ID is marked
+	// to the time it is released for sync.
+	TimeMarkStats struct {
+		Pending  []int64 // The time IDs marked and not yet released.
+		Released []int64 // The time IDs released and not yet synced.
+		Aborted  []int64 // The most recent aborted time IDs.
+		// The number of releases per bucket of ReleaseLatencyBounds, the last bucket holds larger latencies.
+		ReleaseLatency []int64
 	}
 )
 
 func newTimeMark() *_TimeMark {
-	return &_TimeMark{records: make(map[_TimeID]_TimeRecord), releasedRecords: make(map[_TimeID]_TimeRecord)}
+	return &_TimeMark{records: make(map[_TimeID]_TimeRecord), releasedRecords: make(map[_TimeID]_TimeRecord), releaseLatency: make([]int64, len(ReleaseLatencyBounds)+1)}
 }
 
 func (tm *_TimeMark) add(timeID _TimeID) {
 	tm.Lock()
 	defer tm.Unlock()
+	added := time.Now()
 	if r, ok := tm.records[timeID]; ok {
 		r.refs++
+		added = r.added
 	}
-	tm.records[timeID] = _TimeRecord{refs: 1}
+	tm.records[timeID] = _TimeRecord{refs: 1, added: added}
 }
 
 func (tm *_TimeMark) release(timeID _TimeID) {
@@ -62,6 +85,8 @@ func (tm *_TimeMark) release(timeID _TimeID) {
 		delete(tm.records, timeID)
 		timeMark.lastUnref = timeID
 		tm.releasedRecords[timeID] = timeMark
+		latency := time.Since(timeMark.added)
+		tm.releaseLatency[sort.Search(len(ReleaseLatencyBounds), func(i int) bool { return latency <= ReleaseLatencyBounds[i] })]++
 	}
 }
 
@@ -93,9 +118,41 @@ func (tm *_TimeMark) allRefs() (timeIDs []_TimeID) {
 	return timeIDs
 }
 
+// abort removes the time record so the time block is not released for sync.
+func (tm *_TimeMark) abort(timeID _TimeID) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	delete(tm.records, timeID)
+	delete(tm.releasedRecords, timeID)
+	tm.abortedRecords = append(tm.abortedRecords, timeID)
+	if len(tm.abortedRecords) > maxAbortedRecords {
+		tm.abortedRecords = tm.abortedRecords[1:]
+	}
+}
+
 func (tm *_TimeMark) timeUnref(timeID _TimeID) {
 	tm.Lock()
 	defer tm.Unlock()
 
 	delete(tm.releasedRecords, timeID)
 }
+
+// stats returns the time IDs tracked by the time mark sorted by time and the release latency histogram.
+func (tm *_TimeMark) stats() TimeMarkStats {
+	tm.RLock()
+	defer tm.RUnlock()
+	s := TimeMarkStats{ReleaseLatency: append([]int64(nil), tm.releaseLatency...)}
+	for timeID := range tm.records {
+		s.Pending = append(s.Pending, int64(timeID))
+	}
+	for timeID := range tm.releasedRecords {
+		s.Released = append(s.Released, int64(timeID))
+	}
+	for _, timeID := range tm.abortedRecords {
+		s.Aborted = append(s.Aborted, int64(timeID))
+	}
+	sort.Slice(s.Pending, func(i, j int) bool { return s.Pending[i] < s.Pending[j] })
+	sort.Slice(s.Released, func(i, j int) bool { return s.Released[i] < s.Released[j] })
+	return s
+}
@@ -84,3 +84,11 @@ func (id ID) EvalPrefix(contract uint32, cutoff int64) bool {
 	}
 	return binary.LittleEndian.Uint32(id[4:8]) == contract
 }
+
+// EvalRange matches the prefix with the time range. A zero from or until leaves that end of the range open.
+func (id ID) EvalRange(contract uint32, from, until int64) bool {
+	if !id.EvalPrefix(contract, from) {
+		return false
+	}
+	return until == 0 || uid.Time(id[0:4]) <= until
+}
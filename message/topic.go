@@ -54,6 +54,17 @@ type Part struct {
 	Wildchars uint8
 }
 
+// Separator is the character separating the parts of a topic.
+type Separator byte
+
+// char returns the separator character, TopicSeparator if the separator is zero.
+func (sep Separator) char() byte {
+	if sep == 0 {
+		return TopicSeparator
+	}
+	return byte(sep)
+}
+
 // Topic represents a parsed topic.
 type Topic struct {
 	Topic        []byte // Gets or sets the topic string.
@@ -62,6 +73,7 @@ type Topic struct {
 	Depth        uint8
 	Options      []TopicOption // Gets or sets the options.
 	TopicType    uint8
+	Separator    Separator // Gets or sets the separator of the topic parts, TopicSeparator is used if it is zero.
 }
 
 // AddContract adds contract to the parts of a topic.
@@ -87,10 +99,12 @@ func (t *Topic) GetHash(contract uint32) uint64 {
 }
 
 // _SplitFunc various split function to split topic using delimeter.
-type _SplitFunc struct{}
+type _SplitFunc struct {
+	separator Separator
+}
 
-func (_SplitFunc) splitTopic(c rune) bool {
-	return c == TopicSeparator
+func (fn _SplitFunc) splitTopic(c rune) bool {
+	return c == rune(fn.separator.char())
 }
 
 func (_SplitFunc) options(c rune) bool {
@@ -104,6 +118,92 @@ func (_SplitFunc) splitOpsKeyValue(c rune) bool {
 	return c == '='
 }
 
+// SplitTopic splits the topic into parts using the topic separator. The generic
+// wildcard "..." suffix is returned as the last part and the options of the topic,
+// the text following '?', are returned separately. Empty parts are dropped.
+func SplitTopic(topic []byte) (parts [][]byte, options []byte) {
+	return Separator(TopicSeparator).SplitTopic(topic)
+}
+
+// JoinParts joins the topic parts using the topic separator. The generic wildcard
+// "..." is joined without separator and the options are appended following '?' if not empty.
+func JoinParts(parts [][]byte, options []byte) []byte {
+	return Separator(TopicSeparator).JoinParts(parts, options)
+}
+
+// Depth returns the depth of the topic i.e. the number of parts of the topic. The
+// generic wildcard "..." suffix counts as a part and options of the topic are ignored.
+func Depth(topic []byte) int {
+	return Separator(TopicSeparator).Depth(topic)
+}
+
+// SplitTopic splits the topic into parts using the separator, see SplitTopic.
+func (sep Separator) SplitTopic(topic []byte) (parts [][]byte, options []byte) {
+	fn := _SplitFunc{separator: sep}
+	topic, options = splitOptions(topic)
+	generic := bytes.HasSuffix(topic, []byte(TopicGenericSymbol))
+	if generic {
+		topic = bytes.TrimRight(topic, string(TopicGenericSymbol))
+	}
+	parts = bytes.FieldsFunc(topic, fn.splitTopic)
+	if generic {
+		parts = append(parts, []byte(TopicGenericSymbol))
+	}
+	return parts, options
+}
+
+// JoinParts joins the topic parts using the separator, see JoinParts.
+func (sep Separator) JoinParts(parts [][]byte, options []byte) []byte {
+	var topic []byte
+	if l := len(parts); l > 0 && bytes.Equal(parts[l-1], []byte(TopicGenericSymbol)) {
+		topic = append(bytes.Join(parts[:l-1], []byte{sep.char()}), TopicGenericSymbol...)
+	} else {
+		topic = bytes.Join(parts, []byte{sep.char()})
+	}
+	if len(options) > 0 {
+		topic = append(append(topic, '?'), options...)
+	}
+	return topic
+}
+
+// Depth returns the depth of the topic using the separator, see Depth.
+func (sep Separator) Depth(topic []byte) int {
+	parts, _ := sep.SplitTopic(topic)
+	return len(parts)
+}
+
+// ValidDepth reports whether depth of the topic is within TopicMaxDepth.
+func ValidDepth(topic []byte) bool {
+	return Depth(topic) <= TopicMaxDepth
+}
+
+// ReplacePrefix replaces the leading parts of the topic matching the prefix with the
+// new prefix, i.e. "a.b.c" with prefix "a.b" and new prefix "x" becomes "x.c". It
+// returns false if the topic does not start with all parts of the prefix.
+func ReplacePrefix(topic, prefix, newPrefix []byte) ([]byte, bool) {
+	parts, options := SplitTopic(topic)
+	prefixParts, _ := SplitTopic(prefix)
+	if len(prefixParts) > len(parts) {
+		return topic, false
+	}
+	for i, p := range prefixParts {
+		if !bytes.Equal(p, parts[i]) {
+			return topic, false
+		}
+	}
+	newParts, _ := SplitTopic(newPrefix)
+	newParts = append(newParts, parts[len(prefixParts):]...)
+	return JoinParts(newParts, options), true
+}
+
+func splitOptions(topic []byte) ([]byte, []byte) {
+	var fn _SplitFunc
+	if i := bytes.IndexFunc(topic, fn.options); i >= 0 {
+		return topic[:i], topic[i+1:]
+	}
+	return topic, nil
+}
+
 // TTL returns a Time-To-Live option.
 func (t *Topic) TTL() (uint32, bool) {
 	ttl, sec, ok := t.getOption("ttl")
@@ -217,7 +317,7 @@ func parseStaticTopic(contract uint32, topic *Topic) (ok bool) {
 	// defer logger.Debug().Str("context", "topic.parseStaticTopic").Dur("duration", time.Since(start)).Msg("")
 
 	var part Part
-	var fn _SplitFunc
+	fn := _SplitFunc{separator: topic.Separator}
 	topic.Parts = make([]Part, 0, 6)
 	ok = topic.parseOptions(topic.TopicOptions)
 
@@ -244,7 +344,7 @@ func parseWildcardTopic(contract uint32, topic *Topic) (ok bool) {
 	// defer logger.Debug().Str("context", "topic.parseWildcardTopic").Dur("duration", time.Since(start)).Msg("")
 
 	var part Part
-	var fn _SplitFunc
+	fn := _SplitFunc{separator: topic.Separator}
 	topic.Parts = make([]Part, 0, 6)
 	ok = topic.parseOptions(topic.TopicOptions)
 
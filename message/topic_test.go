@@ -0,0 +1,66 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package message
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitJoinTopic(t *testing.T) {
+	tests := []struct {
+		topic   []byte
+		parts   int
+		options []byte
+	}{
+		{[]byte("teams.alpha.ch1"), 3, nil},
+		{[]byte("teams.alpha.ch1?ttl=1h"), 3, []byte("ttl=1h")},
+		{[]byte("teams.*.ch1"), 3, nil},
+		{[]byte("teams.alpha..."), 3, nil},
+		{[]byte("teams..."), 2, nil},
+	}
+	for _, tt := range tests {
+		parts, options := SplitTopic(tt.topic)
+		if len(parts) != tt.parts || !bytes.Equal(options, tt.options) {
+			t.Fatalf("split %s: got %d parts, options %s", tt.topic, len(parts), options)
+		}
+		if Depth(tt.topic) != tt.parts {
+			t.Fatalf("depth %s: expected %d; got %d", tt.topic, tt.parts, Depth(tt.topic))
+		}
+		if topic := JoinParts(parts, options); !bytes.Equal(topic, tt.topic) {
+			t.Fatalf("join %s: got %s", tt.topic, topic)
+		}
+	}
+}
+
+func TestReplacePrefix(t *testing.T) {
+	tests := []struct {
+		topic, prefix, newPrefix, want []byte
+		ok                             bool
+	}{
+		{[]byte("a.b.c"), []byte("a.b"), []byte("x"), []byte("x.c"), true},
+		{[]byte("a.b.c?last=1h"), []byte("a"), []byte("x.y"), []byte("x.y.b.c?last=1h"), true},
+		{[]byte("a.b..."), []byte("a"), []byte("x"), []byte("x.b..."), true},
+		{[]byte("a.bc"), []byte("a.b"), []byte("x"), []byte("a.bc"), false},
+	}
+	for _, tt := range tests {
+		got, ok := ReplacePrefix(tt.topic, tt.prefix, tt.newPrefix)
+		if ok != tt.ok || !bytes.Equal(got, tt.want) {
+			t.Fatalf("replace %s: expected %s %v; got %s %v", tt.topic, tt.want, tt.ok, got, ok)
+		}
+	}
+}
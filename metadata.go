@@ -0,0 +1,248 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetadataCreatedAt is the metadata key holding the DB creation time in RFC 3339 format.
+// It is set when the DB is created.
+const MetadataCreatedAt = "created_at"
+
+// Metadata is written into two metadata slots after the header slots of the info file alternately,
+// the same as the header, so a crash in the middle of a metadata write leaves the previous metadata intact.
+const (
+	metadataSlotSz  = 4096
+	metadataHdrSize = 16
+)
+
+var metadataOff = int64(nInfoSlots) * int64(fixed)
+
+type _Metadata struct {
+	mu sync.RWMutex
+	m  map[string]string
+
+	// epoch is incremented on each metadata write.
+	epoch uint64
+}
+
+// marshalMetadata serializes the metadata as epoch, size, checksum and key/values sorted by key.
+func marshalMetadata(epoch uint64, m map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := make([]byte, metadataHdrSize, metadataSlotSz)
+	for _, k := range keys {
+		buf = appendString(buf, k)
+		buf = appendString(buf, m[k])
+		if len(buf) > metadataSlotSz {
+			return nil, errMetadataTooLarge
+		}
+	}
+	binary.LittleEndian.PutUint64(buf[0:8], epoch)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(buf)-metadataHdrSize))
+	binary.LittleEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(buf[metadataHdrSize:]))
+	return buf, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	var size [2]byte
+	binary.LittleEndian.PutUint16(size[:], uint16(len(s)))
+	buf = append(buf, size[:]...)
+	return append(buf, s...)
+}
+
+// unmarshalMetadata de-serializes the metadata slot, ok is false if the slot is not written or is corrupted.
+func unmarshalMetadata(data []byte) (epoch uint64, m map[string]string, ok bool) {
+	epoch = binary.LittleEndian.Uint64(data[0:8])
+	size := int(binary.LittleEndian.Uint32(data[8:12]))
+	if epoch == 0 || size > len(data)-metadataHdrSize {
+		return 0, nil, false
+	}
+	checksum := binary.LittleEndian.Uint32(data[12:16])
+	data = data[metadataHdrSize : metadataHdrSize+size]
+	if crc32.ChecksumIEEE(data) != checksum {
+		return 0, nil, false
+	}
+	m = make(map[string]string)
+	for len(data) > 0 {
+		k, rest, ok := readString(data)
+		if !ok {
+			return 0, nil, false
+		}
+		v, rest, ok := readString(rest)
+		if !ok {
+			return 0, nil, false
+		}
+		m[k] = v
+		data = rest
+	}
+	return epoch, m, true
+}
+
+func readString(data []byte) (s string, rest []byte, ok bool) {
+	if len(data) < 2 {
+		return "", nil, false
+	}
+	size := int(binary.LittleEndian.Uint16(data[:2]))
+	if len(data) < 2+size {
+		return "", nil, false
+	}
+	return string(data[2 : 2+size]), data[2+size:], true
+}
+
+// readMetadata reads the newest valid metadata from the metadata slots. The info file
+// written by earlier versions does not have metadata slots and empty metadata is returned.
+func readMetadata(f *_File) *_Metadata {
+	md := &_Metadata{m: make(map[string]string)}
+	size := f.currSize()
+	for i := int64(0); i < nInfoSlots; i++ {
+		off := metadataOff + i*metadataSlotSz
+		if off+metadataSlotSz > size {
+			break
+		}
+		data, err := f.slice(off, off+metadataSlotSz)
+		if err != nil {
+			continue
+		}
+		if epoch, m, ok := unmarshalMetadata(data); ok && epoch > md.epoch {
+			md.epoch = epoch
+			md.m = m
+		}
+	}
+	return md
+}
+
+// write writes the metadata into the metadata slot next to the slot of the current metadata and syncs the info file.
+func (md *_Metadata) write(f *_File, m map[string]string) error {
+	buf, err := marshalMetadata(md.epoch+1, m)
+	if err != nil {
+		return err
+	}
+	end := metadataOff + nInfoSlots*metadataSlotSz
+	if size := f.currSize(); size < end {
+		if _, err := f.extend(uint32(end - size)); err != nil {
+			return err
+		}
+	}
+	md.epoch++
+	if _, err := f.WriteAt(buf, metadataOff+int64(md.epoch%nInfoSlots)*metadataSlotSz); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	md.m = m
+	return nil
+}
+
+// set sets the key/values on the metadata, empty value deletes the key.
+func (md *_Metadata) set(f *_File, kvs map[string]string) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	m := make(map[string]string, len(md.m)+len(kvs))
+	for k, v := range md.m {
+		m[k] = v
+	}
+	changed := false
+	for k, v := range kvs {
+		if cur, ok := m[k]; (ok && cur == v) || (!ok && v == "") {
+			continue
+		}
+		if v == "" {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return md.write(f, m)
+}
+
+func (md *_Metadata) get() map[string]string {
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	m := make(map[string]string, len(md.m))
+	for k, v := range md.m {
+		m[k] = v
+	}
+	return m
+}
+
+// openMetadata reads the metadata and sets the key/values from the options, creation time is set on new DB.
+func openMetadata(f *_File, newDB bool, kvs map[string]string) (*_Metadata, error) {
+	md := readMetadata(f)
+	m := make(map[string]string, len(kvs)+1)
+	for k, v := range kvs {
+		m[k] = v
+	}
+	if _, ok := md.m[MetadataCreatedAt]; newDB && !ok {
+		m[MetadataCreatedAt] = time.Now().UTC().Format(time.RFC3339)
+	}
+	if err := md.set(f, m); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// Metadata returns a copy of the DB metadata.
+func (db *DB) Metadata() (map[string]string, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	return db.internal.metadata.get(), nil
+}
+
+// SetMetadata sets the metadata key to the value, empty value deletes the key. Metadata is
+// persisted next to the DB header in the info file and is limited to 4KB in total.
+func (db *DB) SetMetadata(key, value string) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	if key == "" {
+		return errBadRequest
+	}
+	return db.internal.metadata.set(db.internal.info._File, map[string]string{key: value})
+}
+
+// HandleMetadata will process HTTP requests for unitdb metadata.
+func (db *DB) HandleMetadata(w http.ResponseWriter, r *http.Request) {
+	md, err := db.Metadata()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	b, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		logger.Error().Msg("metrics: Error marshaling response to /metadata request: " + err.Error())
+	}
+
+	// Handle response
+	ResponseHandler(w, r, b)
+}
@@ -40,6 +40,31 @@ type Meter struct {
 	OutMsgs    metrics.Counter
 	InBytes    metrics.Counter
 	OutBytes   metrics.Counter
+	// Unsynced is the number of entries accepted into the mem store and the log but not yet synced to DB files.
+	Unsynced metrics.Gauge
+	// CacheHits and CacheMisses are the number of entries read from the mem store and from DB files.
+	CacheHits   metrics.Counter
+	CacheMisses metrics.Counter
+	// SyncChunks is the number of chunks committed before sync of a time block is complete.
+	SyncChunks metrics.Counter
+	// FilterFalsePositives, IndexMisses and DataReadErrors are the number of entries found in the time window
+	// but missed on read, see QueryDiagnostics.
+	FilterFalsePositives metrics.Counter
+	IndexMisses          metrics.Counter
+	DataReadErrors       metrics.Counter
+	// ReadRetries is the number of retries of the reads past the end of a file extended concurrently by sync.
+	ReadRetries metrics.Counter
+	// QuotaRejects is the number of writes rejected on a quota or a rate limit of the contract.
+	QuotaRejects metrics.Counter
+	// WipedBytes is the number of bytes of the freed blocks zeroed, see WithSecureDelete.
+	WipedBytes metrics.Counter
+	// Ingested is the number of entries written to DB files by Ingest.
+	Ingested metrics.Counter
+	// QueryCacheHits and QueryCacheMisses are the number of queries served from and missed in the query cache.
+	QueryCacheHits   metrics.Counter
+	QueryCacheMisses metrics.Counter
+	// NegativeLookupHits is the number of queries served from the negative lookup cache.
+	NegativeLookupHits metrics.Counter
 }
 
 // NewMeter provide meter to capture statistics.
@@ -59,6 +84,22 @@ func NewMeter() *Meter {
 		OutMsgs:    metrics.NewCounter(),
 		InBytes:    metrics.NewCounter(),
 		OutBytes:   metrics.NewCounter(),
+		Unsynced:   metrics.NewGauge(),
+
+		CacheHits:   metrics.NewCounter(),
+		CacheMisses: metrics.NewCounter(),
+		SyncChunks:  metrics.NewCounter(),
+
+		FilterFalsePositives: metrics.NewCounter(),
+		IndexMisses:          metrics.NewCounter(),
+		DataReadErrors:       metrics.NewCounter(),
+		ReadRetries:          metrics.NewCounter(),
+		QuotaRejects:         metrics.NewCounter(),
+		WipedBytes:           metrics.NewCounter(),
+		Ingested:             metrics.NewCounter(),
+		QueryCacheHits:       metrics.NewCounter(),
+		QueryCacheMisses:     metrics.NewCounter(),
+		NegativeLookupHits:   metrics.NewCounter(),
 	}
 
 	c.TimeSeries.Time(func() {})
@@ -66,12 +107,26 @@ func NewMeter() *Meter {
 	Metrics.GetOrRegister("Puts", c.Puts)
 	Metrics.GetOrRegister("leases", c.Leases)
 	Metrics.GetOrRegister("Syncs", c.Syncs)
+	Metrics.GetOrRegister("SyncChunks", c.SyncChunks)
 	Metrics.GetOrRegister("Recovers", c.Recovers)
 	Metrics.GetOrRegister("Aborts", c.Aborts)
 	Metrics.GetOrRegister("Dels", c.Dels)
 	Metrics.GetOrRegister("InMsgs", c.InMsgs)
 	Metrics.GetOrRegister("OutMsgs", c.OutMsgs)
 	Metrics.GetOrRegister("InBytes", c.InBytes)
+	Metrics.GetOrRegister("Unsynced", c.Unsynced)
+	Metrics.GetOrRegister("CacheHits", c.CacheHits)
+	Metrics.GetOrRegister("CacheMisses", c.CacheMisses)
+	Metrics.GetOrRegister("FilterFalsePositives", c.FilterFalsePositives)
+	Metrics.GetOrRegister("IndexMisses", c.IndexMisses)
+	Metrics.GetOrRegister("DataReadErrors", c.DataReadErrors)
+	Metrics.GetOrRegister("ReadRetries", c.ReadRetries)
+	Metrics.GetOrRegister("QuotaRejects", c.QuotaRejects)
+	Metrics.GetOrRegister("WipedBytes", c.WipedBytes)
+	Metrics.GetOrRegister("Ingested", c.Ingested)
+	Metrics.GetOrRegister("QueryCacheHits", c.QueryCacheHits)
+	Metrics.GetOrRegister("QueryCacheMisses", c.QueryCacheMisses)
+	Metrics.GetOrRegister("NegativeLookupHits", c.NegativeLookupHits)
 
 	return c
 }
@@ -99,6 +154,8 @@ type Varz struct {
 	OutMsgs  int64     `json:"out_msgs"`
 	InBytes  int64     `json:"in_bytes"`
 	OutBytes int64     `json:"out_bytes"`
+	Unsynced int64     `json:"unsynced"`
+	LastSync time.Time `json:"last_sync"`
 	HMean    float64   `json:"hmean"` // Event duration harmonic mean.
 	P50      float64   `json:"p50"`   // Event duration nth percentiles.
 	P75      float64   `json:"p75"`
@@ -156,6 +213,8 @@ func (db *DB) Varz() (*Varz, error) {
 	v.OutMsgs = db.internal.meter.OutMsgs.Count()
 	v.InBytes = db.internal.meter.InBytes.Count()
 	v.OutBytes = db.internal.meter.OutBytes.Count()
+	v.Unsynced = db.internal.meter.Unsynced.Value()
+	v.LastSync = db.internal.inFlight.lastSyncTime()
 	ts := db.internal.meter.TimeSeries.Snapshot()
 	v.HMean = float64(ts.HMean())
 	v.P50 = float64(ts.P50())
@@ -17,7 +17,9 @@
 package unitdb
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/unit-io/unitdb/hash"
 )
@@ -46,3 +48,62 @@ func newMutex() _Mutex {
 func (mu *_Mutex) getMutex(blockID uint64) *sync.RWMutex {
 	return mu.internal[mu.consistent.FindBlock(blockID)]
 }
+
+// _SyncLock is the sync lock giving priority to foreground operations such as user sync over maintenance
+// operations such as expiry. Maintenance acquires the lock only if no foreground operation is waiting and
+// yields the lock once a foreground operation is waiting for it.
+type _SyncLock struct {
+	lockC   chan struct{}
+	waiting int32 // number of foreground operations waiting for the lock.
+}
+
+// newSyncLock creates sync lock.
+func newSyncLock() *_SyncLock {
+	return &_SyncLock{lockC: make(chan struct{}, 1)}
+}
+
+// lock acquires the lock for foreground operation.
+func (l *_SyncLock) lock() {
+	atomic.AddInt32(&l.waiting, 1)
+	l.lockC <- struct{}{}
+	atomic.AddInt32(&l.waiting, -1)
+}
+
+// lockContext acquires the lock for foreground operation or returns error if ctx is done before the lock is acquired.
+func (l *_SyncLock) lockContext(ctx context.Context) error {
+	atomic.AddInt32(&l.waiting, 1)
+	defer atomic.AddInt32(&l.waiting, -1)
+	select {
+	case l.lockC <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unlock releases the lock.
+func (l *_SyncLock) unlock() {
+	<-l.lockC
+}
+
+// lockMaintenance acquires the lock for maintenance operation once no foreground operation is waiting.
+// It returns false if closeC is closed before the lock is acquired.
+func (l *_SyncLock) lockMaintenance(closeC <-chan struct{}) bool {
+	for {
+		select {
+		case <-closeC:
+			return false
+		case l.lockC <- struct{}{}:
+		}
+		if !l.preempted() {
+			return true
+		}
+		// hand over the lock to the waiting foreground operation.
+		<-l.lockC
+	}
+}
+
+// preempted returns true if a foreground operation is waiting for the lock.
+func (l *_SyncLock) preempted() bool {
+	return atomic.LoadInt32(&l.waiting) > 0
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"sync"
+	"time"
+)
+
+// maxNegativeEntries is the maximum number of negative lookup results cached, the cache is pruned of
+// the expired results and reset if it is still full.
+const maxNegativeEntries = 1 << 16
+
+type (
+	// _LookupKey is the shape of the query a negative lookup result is cached by, the options of
+	// the topic of the query do not change the topics the query matches.
+	_LookupKey struct {
+		topic string
+		regex bool
+	}
+
+	// _NegativeCache caches the queries matching no topics in the trie set using WithNegativeLookupCache,
+	// so repeated lookups of missing topics do not walk the trie. The results of a contract are invalidated
+	// when a topic of the contract is added to the trie.
+	_NegativeCache struct {
+		mu      sync.Mutex
+		ttl     time.Duration
+		entries map[uint32]map[_LookupKey]int64 // entries maps contract to the expiry time of the missing queries.
+		count   int
+
+		// gen is incremented on each invalidation, a lookup is not cached if a topic is added during the lookup.
+		gen uint64
+	}
+)
+
+func newNegativeCache(ttl time.Duration) *_NegativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &_NegativeCache{ttl: ttl, entries: make(map[uint32]map[_LookupKey]int64)}
+}
+
+// lookupKey returns the shape of the query.
+func (q *Query) lookupKey() _LookupKey {
+	if q.internal.regex {
+		return _LookupKey{topic: string(q.Topic), regex: true}
+	}
+	parts, _ := q.internal.opts.separator.SplitTopic(q.Topic)
+	return _LookupKey{topic: string(q.internal.opts.separator.JoinParts(parts, nil))}
+}
+
+// generation returns the generation of the cache to add the result of a lookup started after the call.
+func (c *_NegativeCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// has reports whether the query of the contract is cached as matching no topics.
+func (c *_NegativeCache) has(contract uint32, key _LookupKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt, ok := c.entries[contract][key]
+	if !ok {
+		return false
+	}
+	if time.Now().UnixNano() > expiresAt {
+		delete(c.entries[contract], key)
+		c.count--
+		return false
+	}
+	return true
+}
+
+// add caches the query of the contract as matching no topics, unless a topic is added since the generation.
+func (c *_NegativeCache) add(gen uint64, contract uint32, key _LookupKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	now := time.Now().UnixNano()
+	if c.count >= maxNegativeEntries {
+		c.prune(now)
+	}
+	keys, ok := c.entries[contract]
+	if !ok {
+		keys = make(map[_LookupKey]int64)
+		c.entries[contract] = keys
+	}
+	if _, ok := keys[key]; !ok {
+		c.count++
+	}
+	keys[key] = now + int64(c.ttl)
+}
+
+// prune removes the expired results, the cache is reset if it is still full. The caller must hold the lock.
+func (c *_NegativeCache) prune(now int64) {
+	for contract, keys := range c.entries {
+		for key, expiresAt := range keys {
+			if now > expiresAt {
+				delete(keys, key)
+				c.count--
+			}
+		}
+		if len(keys) == 0 {
+			delete(c.entries, contract)
+		}
+	}
+	if c.count >= maxNegativeEntries {
+		c.entries = make(map[uint32]map[_LookupKey]int64)
+		c.count = 0
+	}
+}
+
+// invalidate removes the cached results of the contract a topic is added to.
+func (c *_NegativeCache) invalidate(contract uint32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.count -= len(c.entries[contract])
+	delete(c.entries, contract)
+}
+
+// invalidateAll removes all cached results.
+func (c *_NegativeCache) invalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = make(map[uint32]map[_LookupKey]int64)
+	c.count = 0
+}
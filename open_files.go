@@ -0,0 +1,115 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"sync/atomic"
+)
+
+// nDBFiles is the number of files held open by a DB, that is the lock file, the info, window, index, data,
+// lease and filter files, the topic names log and the topic aliases log. The recorder file is held open if
+// recording is enabled, the window, index and data files are a single file if the DB is created using WithSingleFile.
+const nDBFiles = 9
+
+// processFiles is the number of files held open by the DBs of the process.
+var processFiles int64
+
+// FileStats holds the number of files held open by the DB and by all DBs of the process. The write ahead
+// log files are opened on write and read and are not held open.
+type FileStats struct {
+	Open        int            // The number of files held open by the DB.
+	ByType      map[string]int // The number of files held open by the DB by file type.
+	ProcessOpen int64          // The number of files held open by all DBs of the process.
+	Limit       uint64         // The maximum number of files held open by the DBs of the process, zero if unknown.
+}
+
+// String returns name of the file type.
+func (t _FileType) String() string {
+	switch t {
+	case typeInfo:
+		return "info"
+	case typeTimeWindow:
+		return "window"
+	case typeIndex:
+		return "index"
+	case typeData:
+		return "data"
+	case typeLease:
+		return "lease"
+	case typeFilter:
+		return "filter"
+	default:
+		return "unknown"
+	}
+}
+
+// maxOpenFiles returns the maximum number of files held open by the DBs of the process.
+func maxOpenFiles(opts *_Options) uint64 {
+	if opts.maxOpenFiles > 0 {
+		return uint64(opts.maxOpenFiles)
+	}
+	return openFilesLimit()
+}
+
+// reserveFiles checks files to be held open by the DB are within the maximum number of files of the process.
+func reserveFiles(opts *_Options) error {
+	n := int64(nDBFiles)
+	if opts.recorderPath != "" {
+		n++
+	}
+	max := maxOpenFiles(opts)
+	if max > 0 && uint64(atomic.LoadInt64(&processFiles)+n) > max {
+		return errTooManyOpenFiles
+	}
+	return nil
+}
+
+// openFiles returns the files held open by the DB by file type.
+func (db *DB) openFiles() map[string]int {
+	files := map[string]int{"lock": 1, "names": 1, "aliases": 1}
+	for _, fs := range db.fs.list {
+		if fs.region != nil {
+			// regions of the single file share the file.
+			files["single"] = 1
+			continue
+		}
+		files[fs.fd.fileType.String()] += len(fs.fileMap)
+	}
+	if db.internal.recorder != nil {
+		files["recorder"] = 1
+	}
+	return files
+}
+
+// countFiles adds the files held open by the DB to the files held open by the DBs of the process,
+// sign is negative to remove the files of the DB on close.
+func (db *DB) countFiles(sign int64) {
+	for _, n := range db.openFiles() {
+		atomic.AddInt64(&processFiles, sign*int64(n))
+	}
+}
+
+// fileStats returns the number of files held open by the DB and by the DBs of the process.
+func (db *DB) fileStats() FileStats {
+	s := FileStats{ByType: db.openFiles()}
+	for _, n := range s.ByType {
+		s.Open += n
+	}
+	s.ProcessOpen = atomic.LoadInt64(&processFiles)
+	s.Limit = maxOpenFiles(db.opts)
+	return s
+}
@@ -17,6 +17,7 @@
 package unitdb
 
 import (
+	"math"
 	"time"
 
 	"github.com/unit-io/unitdb/message"
@@ -32,6 +33,21 @@ type _Flags struct {
 
 	// backgroundKeyExpiry sets flag to run key expirer.
 	backgroundKeyExpiry bool
+
+	// strictSyncOrder sets flag to fsync files sequentially instead of concurrently.
+	strictSyncOrder bool
+
+	// dataSync sets flag to use fdatasync to sync files.
+	dataSync bool
+
+	// lockTakeover sets flag to take over a stale lock file on open.
+	lockTakeover bool
+
+	// declaredTopics sets flag to reject writes to the topics not declared using CreateTopic.
+	declaredTopics bool
+
+	// secureDelete sets flag to zero the freed blocks of the data file.
+	secureDelete bool
 }
 
 // _BatchOptions is used to set options when using batch operation.
@@ -48,6 +64,18 @@ type _QueryOptions struct {
 
 	// maxQueryLimit limits maximum number of records to fetch if the DB Get or DB Iterator method does not specify a limit or specify a limit larger than MaxQueryResults.
 	maxQueryLimit int
+
+	// separator is the topic separator set using WithTopicSeparator.
+	separator message.Separator
+}
+
+// _WatchOptions is used to set options for DB watch.
+type _WatchOptions struct {
+	contract     uint32
+	metadataOnly bool
+	bufferSize   int
+	from         []byte
+	coalesce     time.Duration
 }
 
 // _Options holds the optional DB parameters.
@@ -55,6 +83,11 @@ type _Options struct {
 	flags        _Flags
 	batchOptions _BatchOptions
 	queryOptions _QueryOptions
+	topicOptions _TopicOptions
+	// contractOptions sets the metadata of the contract for new contract operation.
+	contractOptions _ContractOptions
+	// eraseOptions sets options for erase operation.
+	eraseOptions _EraseOptions
 	// maxSyncDurations sets the amount of time between background fsync() calls.
 	//
 	// Setting the value to 0 disables the automatic background synchronization.
@@ -68,6 +101,13 @@ type _Options struct {
 	// encryptionKey is used for message encryption.
 	encryptionKey []byte
 
+	// keyProvider provides encryption key using keyID, if set encryptionKey is retrieved from the key provider.
+	keyProvider KeyProvider
+	keyID       string
+
+	// keyRefreshInterval sets interval to refresh encryption key from the key provider. Setting the value to 0 disables key refresh.
+	keyRefreshInterval time.Duration
+
 	// bufferSize sets Size of buffer to use for pooling.
 	bufferSize int64
 
@@ -76,6 +116,129 @@ type _Options struct {
 
 	// freeBlockSize minimum freeblocks size before free blocks are allocated and reused.
 	freeBlockSize int64
+
+	// filterWindow sets duplicate window of bloom filter generations. Entries with expiry
+	// are partitioned by expiry time into filter generations and generation is dropped
+	// once its partition is fully expired. Setting the value to 0 disables filter generations.
+	filterWindow time.Duration
+
+	// ttlJitter sets maximum percentage of ttl added as jitter to the expiry of entries at write time.
+	ttlJitter int
+
+	// maxFreezeDuration sets maximum duration writes are frozen before writes are thawed automatically.
+	maxFreezeDuration time.Duration
+
+	// queryAuthorizer if set authorizes each Get, Put and Delete operation.
+	queryAuthorizer func(contract uint32, topic []byte, op Op) error
+
+	// tombstoneRetention sets duration deleted entries are kept for time-travel queries. Setting the value to 0 disables tombstones.
+	tombstoneRetention time.Duration
+
+	// maxTopicDepth sets maximum number of parts of a topic, topics deeper than maxTopicDepth are rejected.
+	maxTopicDepth int
+
+	// topicSeparator sets the character separating the parts of a topic.
+	topicSeparator message.Separator
+
+	// hotTopicsInterval sets interval to report hot topics by traffic. Setting the value to 0 disables hot topics tracking.
+	hotTopicsInterval time.Duration
+
+	// queryCacheSize sets maximum number of query results cached for queryCacheTTL. Setting the value to 0 disables the query cache.
+	queryCacheSize int
+	queryCacheTTL  time.Duration
+
+	// negativeLookupTTL sets duration the queries matching no topics are cached. Setting the value to 0 disables the cache.
+	negativeLookupTTL time.Duration
+
+	// compression sets codec to compress message payloads unless entry sets its codec.
+	compression Codec
+
+	// metadata sets key/values on the DB metadata on open.
+	metadata map[string]string
+
+	// encryptor if set encrypts message payloads instead of the data keys of the keyring.
+	encryptor Encryptor
+
+	// defaultQuota sets quota of stored bytes per contract. Setting the value to 0 disables the default quota.
+	defaultQuota int64
+	// quotas sets quota of stored bytes of the contract overriding the default quota.
+	quotas map[uint32]int64
+	// quotaPolicy sets the action taken on writes exceeding the quota.
+	quotaPolicy QuotaPolicy
+
+	// rateLimit sets the rate limit of writes per contract. Setting the limits to 0 disables the default rate limit.
+	rateLimit RateLimit
+	// rateLimits sets the rate limit of writes of the contract overriding the default rate limit.
+	rateLimits map[uint32]RateLimit
+
+	// recorderPath sets path of the workload file to record operations to. Setting the value to empty disables the recorder.
+	recorderPath string
+	// recorderSampleRate sets fraction of the topics to record operations of.
+	recorderSampleRate float64
+
+	// tracer if set starts spans for Put, Get, Sync and recovery.
+	tracer Tracer
+
+	// chunkSize sets size of chunks to split payloads larger than the size. Setting the value to 0 disables chunking.
+	chunkSize int
+
+	// walArchivePath sets directory to archive the applied WAL logs. Setting the value to empty releases the applied logs.
+	walArchivePath string
+	// restoreTime sets time up to which the archived WAL logs are replayed on DB open.
+	restoreTime time.Time
+
+	// abortTimeout sets duration after which time IDs of batches not committed are aborted. Setting the value to 0 disables automatic abort.
+	abortTimeout time.Duration
+
+	// replicationAddr sets address to stream the WAL segments to the followers on. Setting the value to empty disables replication.
+	replicationAddr string
+	// replicaOf sets address of the leader to follow. The DB is read-only if the value is set.
+	replicaOf string
+
+	// timeBlockDuration sets duration of the time blocks of the mem store, time IDs of a time block are released for sync at this cadence.
+	timeBlockDuration time.Duration
+	// logInterval sets interval the mem store writes the time blocks to the write ahead log and releases the time IDs written.
+	logInterval time.Duration
+
+	// syncChunkEntries sets number of entries after which a sync commits the entries synced so far.
+	syncChunkEntries int
+	// syncChunkSize sets size of values in bytes after which a sync commits the entries synced so far.
+	syncChunkSize int64
+
+	// readRetries sets number of times a read past the end of a file is retried, a negative value disables retry.
+	readRetries int
+	// readRetryInterval sets interval to wait before a read past the end of a file is retried.
+	readRetryInterval time.Duration
+
+	// maxOpenFiles sets maximum number of files held open by the DBs of the process. Setting the value to 0 uses the open files limit of the process.
+	maxOpenFiles int
+
+	// singleFileSize sets capacity of the single file packing the index, window and data files of a new DB. Setting the value to 0 uses a file per file type.
+	singleFileSize int64
+}
+
+// Op represents a DB operation to authorize.
+type Op uint8
+
+// Operations passed to the query authorizer.
+const (
+	OpGet Op = iota + 1
+	OpPut
+	OpDelete
+)
+
+// String returns name of the operation.
+func (op Op) String() string {
+	switch op {
+	case OpGet:
+		return "get"
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
 }
 
 // Options it contains configurable options and flags for DB.
@@ -132,6 +295,49 @@ func WithBackgroundKeyExpiry() Options {
 	})
 }
 
+// WithStrictSyncOrder sets flag to fsync window, index and data files sequentially on sync. By default files
+// are synced concurrently, set the flag for filesystems requiring strict write ordering between files.
+func WithStrictSyncOrder() Options {
+	return newFuncOption(func(o *_Options) {
+		o.flags.strictSyncOrder = true
+	})
+}
+
+// WithDataSync sets flag to use fdatasync instead of fsync on sync, skipping flush of file metadata
+// not needed to read the data back. It is supported on linux, fsync is used on other platforms.
+func WithDataSync() Options {
+	return newFuncOption(func(o *_Options) {
+		o.flags.dataSync = true
+	})
+}
+
+// WithLockTakeover sets flag to take over the lock file left by a crashed process on open if the file
+// system does not support advisory locks. The lock is taken over only if the owner recorded in the lock
+// file is verified as not running, that is the owner process was started in a previous boot or no process
+// with the owner PID is running. The lock held by a crashed process is released by the OS on file systems
+// supporting advisory locks and it is taken over on open without the flag.
+func WithLockTakeover() Options {
+	return newFuncOption(func(o *_Options) {
+		o.flags.lockTakeover = true
+	})
+}
+
+// WithDeclaredTopics sets flag to reject writes to the topics not declared using CreateTopic.
+func WithDeclaredTopics() Options {
+	return newFuncOption(func(o *_Options) {
+		o.flags.declaredTopics = true
+	})
+}
+
+// WithSecureDelete sets flag to zero the blocks of the data file freed by deleted and expired entries. The
+// freed blocks are zeroed on the next sync, blocks reused by new entries before the sync are overwritten by
+// the entries. Free blocks of the DB are zeroed on the first sync after open to cover a crash before the sync.
+func WithSecureDelete() Options {
+	return newFuncOption(func(o *_Options) {
+		o.flags.secureDelete = true
+	})
+}
+
 // WithDefaultBatchOptions will set some default values for Batch operation.
 //   contract: MasterContract
 //   encryption: False
@@ -163,6 +369,98 @@ func WithBatchWriteInterval(dur time.Duration) Options {
 	})
 }
 
+// WatchOption it contains configurable options for DB watch.
+type WatchOption interface {
+	set(*_WatchOptions)
+}
+
+// fWatchOption wraps a function that modifies watch options into an
+// implementation of the WatchOption interface.
+type fWatchOption struct {
+	f func(*_WatchOptions)
+}
+
+func (fo *fWatchOption) set(o *_WatchOptions) {
+	fo.f(o)
+}
+
+func newFuncWatchOption(f func(*_WatchOptions)) *fWatchOption {
+	return &fWatchOption{
+		f: f,
+	}
+}
+
+// WithWatchContract sets contract for watch operation.
+func WithWatchContract(contract uint32) WatchOption {
+	return newFuncWatchOption(func(o *_WatchOptions) {
+		o.contract = contract
+	})
+}
+
+// WithWatchMetadataOnly excludes payloads from the messages delivered to watch, for watchers only needing notifications.
+func WithWatchMetadataOnly() WatchOption {
+	return newFuncWatchOption(func(o *_WatchOptions) {
+		o.metadataOnly = true
+	})
+}
+
+// WithWatchBufferSize sets number of messages buffered for a watch before the watch is closed on overflow.
+func WithWatchBufferSize(size int) WatchOption {
+	return newFuncWatchOption(func(o *_WatchOptions) {
+		o.bufferSize = size
+	})
+}
+
+// WithWatchFrom sets resumption token to resume watch after the message the token is delivered with.
+func WithWatchFrom(token []byte) WatchOption {
+	return newFuncWatchOption(func(o *_WatchOptions) {
+		o.from = token
+	})
+}
+
+// WithWatchCoalesce sets interval to coalesce messages for high-rate topics. At most one message of each topic is
+// delivered per interval, the latest message of the topic is delivered with the count of its skipped messages.
+func WithWatchCoalesce(interval time.Duration) WatchOption {
+	return newFuncWatchOption(func(o *_WatchOptions) {
+		o.coalesce = interval
+	})
+}
+
+// WithContractName sets name of the contract for new contract operation.
+func WithContractName(name string) Options {
+	return newFuncOption(func(o *_Options) {
+		o.contractOptions.name = name
+	})
+}
+
+// WithTopicContract sets contract for create topic operation.
+func WithTopicContract(contract uint32) Options {
+	return newFuncOption(func(o *_Options) {
+		o.topicOptions.contract = contract
+	})
+}
+
+// WithTopicConfig sets settings of the topic for create topic operation.
+func WithTopicConfig(cfg TopicConfig) Options {
+	return newFuncOption(func(o *_Options) {
+		o.topicOptions.config = cfg
+	})
+}
+
+// WithTopicRetention sets retention of the entries put to the topic, the entries expire after the retention duration.
+func WithTopicRetention(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.topicOptions.config.Retention = dur
+	})
+}
+
+// WithTopicCompression sets codec to compress payloads of the entries put to the topic.
+func WithTopicCompression(codec Codec) Options {
+	return newFuncOption(func(o *_Options) {
+		o.topicOptions.config.Compression = codec
+	})
+}
+
 // WithDefaultOptions will open DB with some default values.
 func WithDefaultOptions() Options {
 	return newFuncOption(func(o *_Options) {
@@ -172,6 +470,24 @@ func WithDefaultOptions() Options {
 		if o.syncDurationType == 0 {
 			o.syncDurationType = time.Second
 		}
+		if o.timeBlockDuration == 0 {
+			o.timeBlockDuration = time.Second
+		}
+		if o.logInterval == 0 {
+			o.logInterval = 15 * time.Millisecond
+		}
+		if o.syncChunkEntries == 0 {
+			o.syncChunkEntries = 1 << 16
+		}
+		if o.syncChunkSize == 0 {
+			o.syncChunkSize = 1 << 26 // maximum size of values synced in a chunk (64MB).
+		}
+		if o.readRetries == 0 {
+			o.readRetries = 3
+		}
+		if o.readRetryInterval == 0 {
+			o.readRetryInterval = time.Millisecond
+		}
 		if o.queryOptions.defaultQueryLimit == 0 {
 			o.queryOptions.defaultQueryLimit = 1000
 		}
@@ -190,6 +506,18 @@ func WithDefaultOptions() Options {
 		if o.encryptionKey == nil {
 			o.encryptionKey = []byte("4BWm1vZletvrCDGWsF6mex8oBSd59m6I")
 		}
+		if o.maxFreezeDuration == 0 {
+			o.maxFreezeDuration = time.Minute
+		}
+		if o.maxTopicDepth == 0 {
+			o.maxTopicDepth = message.TopicMaxDepth
+		}
+		if o.topicSeparator == 0 {
+			o.topicSeparator = message.TopicSeparator
+		}
+		if o.compression == CodecDefault {
+			o.compression = CodecSnappy
+		}
 	})
 }
 
@@ -218,6 +546,44 @@ func WithMaxQueryLimit(limit int) Options {
 	})
 }
 
+// WithTombstoneRetention sets duration deleted entries are kept as tombstones, so the query
+// AsOf an epoch before the delete still returns the deleted entries. The messages of the
+// tombstones are kept in the tombstones file, at most 262144 tombstones are retained.
+func WithTombstoneRetention(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.tombstoneRetention = dur
+	})
+}
+
+// WithMaxTopicDepth sets maximum number of parts of a topic. Put and Get
+// return TopicDepthError for topics deeper than the maximum depth. The depth
+// is limited to 255 parts.
+func WithMaxTopicDepth(depth int) Options {
+	return newFuncOption(func(o *_Options) {
+		if depth > math.MaxUint8 {
+			depth = math.MaxUint8
+		}
+		o.maxTopicDepth = depth
+	})
+}
+
+// WithTopicSeparator sets the character separating the parts of a topic, such as '/' for MQTT style
+// topics. The separator is ignored if it is not a printable ASCII character or it is one of the reserved
+// characters '*', '?', '&' and '='. Topic parts are hashed without the separator so entries of the DB do
+// not depend on the separator, but names of the topic parts are logged using the separator, so the DB
+// is opened using the same separator to keep the names of the topics.
+func WithTopicSeparator(sep byte) Options {
+	return newFuncOption(func(o *_Options) {
+		switch {
+		case sep <= ' ' || sep > '~':
+			return
+		case sep == '*' || sep == '?' || sep == '&' || sep == '=':
+			return
+		}
+		o.topicSeparator = message.Separator(sep)
+	})
+}
+
 // WithBufferSize sets Size of buffer to use for pooling.
 func WithBufferSize(size int64) Options {
 	return newFuncOption(func(o *_Options) {
@@ -240,9 +606,305 @@ func WithFreeBlockSize(size int64) Options {
 	})
 }
 
+// WithFilterDuplicateWindow sets duplicate window of bloom filter generations
+// to bound filter memory for entries with expiry. A generation is sized in
+// proportion of the window to a day, the window the bloom filter is sized for.
+func WithFilterDuplicateWindow(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.filterWindow = dur
+	})
+}
+
+// WithTTLJitter sets maximum percentage of ttl added as jitter to the expiry of entries,
+// so entries sharing a ttl do not expire in the same expiry window. It also smears
+// expiry processing across the expiry window.
+func WithTTLJitter(percent int) Options {
+	return newFuncOption(func(o *_Options) {
+		o.ttlJitter = percent
+	})
+}
+
+// WithHotTopics sets tracking of per topic write and read rates
+// to report hot topics by traffic over the last interval.
+func WithHotTopics(interval time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.hotTopicsInterval = interval
+	})
+}
+
+// WithQueryCache sets caching of the results of up to size recent queries for the ttl, so repeated
+// identical queries such as the queries of dashboards are served without reading the DB files. The
+// cached results are invalidated on writes and deletes of the topics the query read, and the results of
+// wildcard queries are also invalidated when a new topic is added. A zero ttl caches the results until
+// these are invalidated or evicted. Queries with a cursor, AsOf or WithDiagnostics are not cached.
+// The results of the queries relative to the current time, such as "last=1h", are cached as of the
+// time the query is read, so use a ttl to bound the staleness of these results.
+func WithQueryCache(size int, ttl time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.queryCacheSize = size
+		o.queryCacheTTL = ttl
+	})
+}
+
+// WithNegativeLookupCache sets caching of the queries matching no topics for the ttl, so the workloads
+// repeatedly querying the topics that do not exist, such as wildcard subscriptions ahead of the writers,
+// do not walk the topic trie on each query. The cached results of a contract are invalidated when a topic
+// of the contract is created.
+func WithNegativeLookupCache(ttl time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.negativeLookupTTL = ttl
+	})
+}
+
+// WithMaxFreezeDuration sets maximum duration writes are frozen by FreezeWrites before writes are thawed automatically.
+func WithMaxFreezeDuration(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.maxFreezeDuration = dur
+	})
+}
+
+// WithCompression sets codec to compress message payloads in the data file. Entry may override the codec
+// using Entry.WithCompression. The default codec is CodecSnappy.
+func WithCompression(codec Codec) Options {
+	return newFuncOption(func(o *_Options) {
+		if codec == CodecDefault {
+			codec = CodecSnappy
+		}
+		o.compression = codec
+	})
+}
+
+// WithMetadata sets the key/values on the DB metadata on open, for example application name or
+// schema tag to identify the DB. Empty value deletes the key. Other keys of the metadata are kept.
+func WithMetadata(kvs map[string]string) Options {
+	return newFuncOption(func(o *_Options) {
+		if o.metadata == nil {
+			o.metadata = make(map[string]string, len(kvs))
+		}
+		for k, v := range kvs {
+			o.metadata[k] = v
+		}
+	})
+}
+
+// WithEncryptor sets encryptor to encrypt message payloads, for example using AES-GCM or
+// KMS-backed envelope encryption. The encryptor replaces the built-in encryption using the
+// data keys of the keyring, so encryption key, key provider and key rotation do not apply.
+// Encryption is enabled using WithEncryption or per entry using Entry.WithEncryption.
+func WithEncryptor(enc Encryptor) Options {
+	return newFuncOption(func(o *_Options) {
+		o.encryptor = enc
+	})
+}
+
+// WithQuota sets quota of stored bytes per contract and the action taken on writes exceeding the quota.
+// Stored bytes of the contract are the size of message IDs, topics and the packed payloads of its entries.
+func WithQuota(bytes int64, policy QuotaPolicy) Options {
+	return newFuncOption(func(o *_Options) {
+		o.defaultQuota = bytes
+		o.quotaPolicy = policy
+	})
+}
+
+// WithContractQuota sets quota of stored bytes of the contract overriding the quota set using WithQuota.
+// Setting the value to 0 disables quota of the contract.
+func WithContractQuota(contract uint32, bytes int64) Options {
+	return newFuncOption(func(o *_Options) {
+		if o.quotas == nil {
+			o.quotas = make(map[uint32]int64)
+		}
+		o.quotas[contract] = bytes
+	})
+}
+
+// WithRateLimit sets the maximum messages per second and the maximum bytes per day a contract is allowed to write.
+// Writes over the limits are rejected with QuotaError. Setting a limit to 0 disables the limit.
+func WithRateLimit(messagesPerSec int, bytesPerDay int64) Options {
+	return newFuncOption(func(o *_Options) {
+		o.rateLimit = RateLimit{MessagesPerSec: messagesPerSec, BytesPerDay: bytesPerDay}
+	})
+}
+
+// WithContractRateLimit sets the rate limit of the contract overriding the rate limit set using WithRateLimit.
+// Setting the limits to 0 disables rate limit of the contract.
+func WithContractRateLimit(contract uint32, messagesPerSec int, bytesPerDay int64) Options {
+	return newFuncOption(func(o *_Options) {
+		if o.rateLimits == nil {
+			o.rateLimits = make(map[uint32]RateLimit)
+		}
+		o.rateLimits[contract] = RateLimit{MessagesPerSec: messagesPerSec, BytesPerDay: bytesPerDay}
+	})
+}
+
+// WithRecorder records Put, Get, Delete and Sync operations to the workload file at the path. The sample rate
+// from 0 to 1 sets the fraction of the topics recorded, all operations of a sampled topic are recorded.
+// Use DB.Replay to replay the recorded workload.
+func WithRecorder(path string, sampleRate float64) Options {
+	return newFuncOption(func(o *_Options) {
+		o.recorderPath = path
+		o.recorderSampleRate = sampleRate
+	})
+}
+
+// WithChunkSize sets chunking of payloads larger than the size. A large payload is split into chunks
+// stored as separate entries and it is reassembled and verified on Get. Chunks of a message are deleted
+// along with the message while chunking is enabled.
+func WithChunkSize(size int) Options {
+	return newFuncOption(func(o *_Options) {
+		o.chunkSize = size
+	})
+}
+
+// WithWALArchive archives the WAL logs to the directory at the path once these are applied to the DB instead of
+// releasing them. Archived logs are not removed by the DB, use WithRestoreToTime to replay archived logs on open.
+func WithWALArchive(path string) Options {
+	return newFuncOption(func(o *_Options) {
+		o.walArchivePath = path
+	})
+}
+
+// WithRestoreToTime opens the DB in the restore mode replaying the archived WAL logs written up to the time.
+// Pending logs written after the time are moved to the archive and are not recovered. It requires WithWALArchive.
+func WithRestoreToTime(t time.Time) Options {
+	return newFuncOption(func(o *_Options) {
+		o.restoreTime = t
+	})
+}
+
+// WithAbortTimeout aborts time IDs of batches not committed within the timeout, for example if the batch writer
+// crashed between write and commit. Entries of an aborted time ID are removed and the abort is logged.
+func WithAbortTimeout(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.abortTimeout = dur
+	})
+}
+
+// WithReplication streams the WAL segments to the followers connecting to the address over gRPC.
+func WithReplication(addr string) Options {
+	return newFuncOption(func(o *_Options) {
+		o.replicationAddr = addr
+	})
+}
+
+// WithReplicaOf opens the DB as a read-only follower of the leader at the address. The follower streams the WAL
+// segments committed on the leader after its last applied sequence and applies them through the recovery path.
+// The follower must use the same encryption key as the leader.
+func WithReplicaOf(addr string) Options {
+	return newFuncOption(func(o *_Options) {
+		o.replicaOf = addr
+	})
+}
+
+// WithTimeBlockDuration sets duration of the time blocks of the mem store. Time IDs are released for sync at this
+// cadence, a shorter duration lowers the latency from write to sync at the cost of more time blocks. The default is 1s.
+func WithTimeBlockDuration(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.timeBlockDuration = dur
+	})
+}
+
+// WithTargetVisibilityLatency tunes the write ahead log interval, the time block duration and the sync interval
+// together so entries put to the DB are synced and queryable from the DB files within about the latency. A
+// lower latency trades write throughput for more frequent log writes and syncs. Options set after this option
+// override the tuned values.
+func WithTargetVisibilityLatency(latency time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		// the latency budget is split between log write, time block release and sync.
+		o.logInterval = latency / 10
+		if o.logInterval < time.Millisecond {
+			o.logInterval = time.Millisecond
+		}
+		o.timeBlockDuration = latency * 4 / 10
+		if o.timeBlockDuration < o.logInterval {
+			o.timeBlockDuration = o.logInterval
+		}
+		o.syncDurationType = latency / 2
+		if o.syncDurationType < time.Millisecond {
+			o.syncDurationType = time.Millisecond
+		}
+		o.maxSyncDurations = 1
+	})
+}
+
+// WithSyncChunkSize sets the number of entries and the size of values in bytes after which a sync commits
+// the entries synced so far. A failure during sync of a large time block rolls back only the last chunk and
+// the chunks committed are not synced again. The defaults are 65536 entries and 64MB.
+func WithSyncChunkSize(entries int, size int64) Options {
+	return newFuncOption(func(o *_Options) {
+		o.syncChunkEntries = entries
+		o.syncChunkSize = size
+	})
+}
+
+// WithReadRetry sets the number of times and the interval a read past the end of the index, data or
+// window file is retried, as a reader may race with sync extending the file. The read is retried once
+// the size of the file covers the read, EOF is returned to the query if retries are exhausted. The
+// defaults are 3 retries and 1ms, use negative retries to disable retry.
+func WithReadRetry(retries int, interval time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.readRetries = retries
+		o.readRetryInterval = interval
+	})
+}
+
+// WithTracer sets tracer to start spans for Put, Get, Sync and recovery of the DB.
+// Use the context aware methods such as PutContext and GetContext to make the spans children of the caller span.
+func WithTracer(tracer Tracer) Options {
+	return newFuncOption(func(o *_Options) {
+		o.tracer = tracer
+	})
+}
+
 // WithEncryptionKey sets encryption key to use for data encryption.
 func WithEncryptionKey(key []byte) Options {
 	return newFuncOption(func(o *_Options) {
 		o.encryptionKey = key
 	})
 }
+
+// WithKeyProvider sets key provider to retrieve encryption key using the key id. The key is cached
+// and refreshed every hour, if key provider returns a new key then data keys are re-wrapped using the new key.
+func WithKeyProvider(provider KeyProvider, keyID string) Options {
+	return newFuncOption(func(o *_Options) {
+		o.keyProvider = provider
+		o.keyID = keyID
+		if o.keyRefreshInterval == 0 {
+			o.keyRefreshInterval = time.Hour
+		}
+	})
+}
+
+// WithKeyRefreshInterval sets interval to refresh encryption key from the key provider.
+func WithKeyRefreshInterval(dur time.Duration) Options {
+	return newFuncOption(func(o *_Options) {
+		o.keyRefreshInterval = dur
+	})
+}
+
+// WithQueryAuthorizer sets authorizer invoked on each Get, Put and Delete operation including batch operations.
+// If authorizer returns an error, the operation is refused and the error is returned to the caller. It is used by
+// embedders multiplexing many end users over one DB handle to authorize contract and topic of the operation.
+func WithQueryAuthorizer(authorizer func(contract uint32, topic []byte, op Op) error) Options {
+	return newFuncOption(func(o *_Options) {
+		o.queryAuthorizer = authorizer
+	})
+}
+
+// WithMaxOpenFiles sets maximum number of files held open by all DBs of the process including the DB. Open returns
+// an error if opening the DB would exceed the maximum. By default the soft limit of open files of the process is used,
+// set the maximum lower to reserve file descriptors for other files of the process such as network connections.
+func WithMaxOpenFiles(n int) Options {
+	return newFuncOption(func(o *_Options) {
+		o.maxOpenFiles = n
+	})
+}
+
+// WithSingleFile packs the index, window and data files of a new DB into a single file of the capacity with
+// a region per file, reducing the files held open by the DB for embedded uses with small datasets. Writes
+// past the capacity of a region return an error. The layout is chosen when the DB is created, so the option
+// is ignored on open of an existing DB and a DB created using the option is opened using the single file.
+func WithSingleFile(size int64) Options {
+	return newFuncOption(func(o *_Options) {
+		o.singleFileSize = size
+	})
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/parquet"
+	"github.com/unit-io/unitdb/uid"
+)
+
+// parquetColumns is the schema of the parquet files written by ExportParquet.
+var parquetColumns = []parquet.Column{
+	{Name: "topic", Type: parquet.ByteArray, Converted: parquet.UTF8},
+	{Name: "id", Type: parquet.ByteArray},
+	{Name: "stored_at", Type: parquet.Int64, Converted: parquet.TimestampMillis},
+	{Name: "payload", Type: parquet.ByteArray},
+	{Name: "headers", Type: parquet.ByteArray, Converted: parquet.JSON},
+}
+
+// ExportParquet writes the items matching the query to w as a parquet file with the columns topic, id,
+// stored_at, payload and headers, so the history of a topic or a wildcard topic is loaded directly into
+// analytics engines. Items are read using the item iterator and written in snappy compressed row groups,
+// so the memory used by the export is bounded by the row group size irrespective of the size of the topic.
+// It returns the number of items written.
+func (db *DB) ExportParquet(w io.Writer, q *Query) (int64, error) {
+	it, err := db.Items(q)
+	if err != nil {
+		return 0, err
+	}
+	defer it.exit()
+	pw := parquet.NewWriter(w, parquetColumns, parquet.Snappy, parquet.DefaultRowGroupSize)
+	topics := make(map[uint64][]byte)
+	var n int64
+	for it.Next() {
+		item := it.item
+		topic, ok := topics[item.topicHash]
+		if !ok {
+			_, topic, _ = db.internal.trie.topicName(item.topicHash)
+			topics[item.topicHash] = topic
+		}
+		id := make(message.ID, message.ID(nil).Size())
+		copy(id, item.id[:idSize-1])
+		binary.LittleEndian.PutUint64(id[8:16], item.seq)
+		headers, err := json.Marshal(contentHeaders(item.codec, map[string]string{}))
+		if err != nil {
+			return n, err
+		}
+		storedAt := uid.Time(id[0:4]) * 1000
+		if err := pw.WriteRow(topic, []byte(id), storedAt, item.val, headers); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	return n, pw.Close()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol types used by the parquet file metadata.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// _Encoder encodes the parquet metadata structures using the thrift compact protocol.
+type _Encoder struct {
+	buf  []byte
+	last []int16 // last field id of the structs being encoded.
+}
+
+func (e *_Encoder) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *_Encoder) zigzag(v int64) {
+	e.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (e *_Encoder) field(id int16, typ byte) {
+	last := &e.last[len(e.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// begin begins a struct, the top level struct and the elements of a list are
+// begun with a zero field id.
+func (e *_Encoder) begin(id int16) {
+	if id != 0 {
+		e.field(id, thriftStruct)
+	}
+	e.last = append(e.last, 0)
+}
+
+// end ends the struct.
+func (e *_Encoder) end() {
+	e.buf = append(e.buf, 0)
+	e.last = e.last[:len(e.last)-1]
+}
+
+func (e *_Encoder) i32(id int16, v int32) {
+	e.field(id, thriftI32)
+	e.zigzag(int64(v))
+}
+
+func (e *_Encoder) i64(id int16, v int64) {
+	e.field(id, thriftI64)
+	e.zigzag(v)
+}
+
+func (e *_Encoder) binary(id int16, v []byte) {
+	e.field(id, thriftBinary)
+	e.varint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// list begins the list of the elements of type.
+func (e *_Encoder) list(id int16, typ byte, n int) {
+	e.field(id, thriftList)
+	if n < 15 {
+		e.buf = append(e.buf, byte(n)<<4|typ)
+		return
+	}
+	e.buf = append(e.buf, 0xf0|typ)
+	e.varint(uint64(n))
+}
+
+// listI32 encodes the list of i32 values.
+func (e *_Encoder) listI32(id int16, v ...int32) {
+	e.list(id, thriftI32, len(v))
+	for _, x := range v {
+		e.zigzag(int64(x))
+	}
+}
+
+// listBinary encodes the list of binary values.
+func (e *_Encoder) listBinary(id int16, v ...[]byte) {
+	e.list(id, thriftBinary, len(v))
+	for _, x := range v {
+		e.varint(uint64(len(x)))
+		e.buf = append(e.buf, x...)
+	}
+}
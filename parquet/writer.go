@@ -0,0 +1,333 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package parquet writes parquet files of flat schemas with required columns. It implements
+// the subset of the format needed to export messages to analytics engines: plain encoded
+// data pages, a data page per column chunk and optional snappy compression.
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	magic   = "PAR1"
+	version = 1
+
+	// DefaultRowGroupSize is the default size in bytes of the row group buffered before it is written.
+	DefaultRowGroupSize = 8 << 20
+)
+
+// Type is the physical type of the column.
+type Type int32
+
+// Physical types of the columns.
+const (
+	Int64     Type = 2
+	ByteArray Type = 6
+)
+
+// ConvertedType is the logical type of the column annotating its physical type.
+type ConvertedType int8
+
+// Converted types of the columns.
+const (
+	None ConvertedType = iota
+	UTF8
+	TimestampMillis
+	JSON
+)
+
+// convertedTypes are the thrift values of the converted types.
+var convertedTypes = map[ConvertedType]int32{
+	UTF8:            0,
+	TimestampMillis: 9,
+	JSON:            19,
+}
+
+// Codec is the compression codec of the column chunks.
+type Codec int32
+
+// Compression codecs.
+const (
+	Uncompressed Codec = 0
+	Snappy       Codec = 1
+)
+
+// Thrift values of parquet enums.
+const (
+	repetitionRequired = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	pageTypeData       = 0
+)
+
+var (
+	errColumnCount  = errors.New("parquet: row does not match the number of columns")
+	errWriterClosed = errors.New("parquet: writer is closed")
+	errPageTooLarge = errors.New("parquet: page too large")
+)
+
+type (
+	// Column is the column of the schema.
+	Column struct {
+		Name      string
+		Type      Type
+		Converted ConvertedType
+	}
+
+	_ColumnChunk struct {
+		offset           int64
+		uncompressedSize int64
+		compressedSize   int64
+	}
+
+	_RowGroup struct {
+		chunks []_ColumnChunk
+		size   int64
+		rows   int64
+	}
+
+	// Writer writes rows to the parquet file. Rows are buffered in memory until the buffered
+	// row group reaches the row group size, so the memory used by the writer is bounded by the
+	// row group size irrespective of the number of rows written.
+	Writer struct {
+		w            io.Writer
+		columns      []Column
+		codec        Codec
+		rowGroupSize int
+		off          int64
+		pages        [][]byte
+		size         int
+		rows         int64
+		groups       []_RowGroup
+		closed       bool
+	}
+)
+
+// NewWriter returns the writer writing rows of the columns to w. The rowGroupSize is the size
+// in bytes of the rows buffered before the row group is written, DefaultRowGroupSize is used if
+// it is zero.
+func NewWriter(w io.Writer, columns []Column, codec Codec, rowGroupSize int) *Writer {
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	return &Writer{
+		w:            w,
+		columns:      columns,
+		codec:        codec,
+		rowGroupSize: rowGroupSize,
+		pages:        make([][]byte, len(columns)),
+	}
+}
+
+// WriteRow writes the row, values are int64 for Int64 columns and []byte or string for ByteArray
+// columns in the order of the columns.
+func (w *Writer) WriteRow(values ...interface{}) error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if len(values) != len(w.columns) {
+		return errColumnCount
+	}
+	for i, c := range w.columns {
+		n := len(w.pages[i])
+		switch v := values[i].(type) {
+		case int64:
+			if c.Type != Int64 {
+				return fmt.Errorf("parquet: column %s: unexpected value of type int64", c.Name)
+			}
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+			w.pages[i] = append(w.pages[i], b[:]...)
+		case []byte:
+			if c.Type != ByteArray {
+				return fmt.Errorf("parquet: column %s: unexpected value of type []byte", c.Name)
+			}
+			w.pages[i] = appendByteArray(w.pages[i], v)
+		case string:
+			if c.Type != ByteArray {
+				return fmt.Errorf("parquet: column %s: unexpected value of type string", c.Name)
+			}
+			w.pages[i] = appendByteArray(w.pages[i], []byte(v))
+		default:
+			return fmt.Errorf("parquet: column %s: unsupported value of type %T", c.Name, v)
+		}
+		w.size += len(w.pages[i]) - n
+	}
+	w.rows++
+	if w.size >= w.rowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func appendByteArray(b []byte, v []byte) []byte {
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(len(v)))
+	b = append(b, l[:]...)
+	return append(b, v...)
+}
+
+// Close writes the buffered rows and the file metadata. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if err := w.writeMagic(); err != nil {
+		return err
+	}
+	w.closed = true
+	meta := w.fileMetadata()
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(len(meta)))
+	if err := w.write(meta); err != nil {
+		return err
+	}
+	if err := w.write(l[:]); err != nil {
+		return err
+	}
+	return w.write([]byte(magic))
+}
+
+// writeMagic writes the magic at the start of the file before the first row group.
+func (w *Writer) writeMagic() error {
+	if w.off > 0 {
+		return nil
+	}
+	return w.write([]byte(magic))
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.off += int64(n)
+	return err
+}
+
+// flush writes the buffered rows as a row group, a column chunk per column with a single data page.
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	if err := w.writeMagic(); err != nil {
+		return err
+	}
+	g := _RowGroup{rows: w.rows}
+	for i, page := range w.pages {
+		data := page
+		if w.codec == Snappy {
+			data = snappy.Encode(nil, page)
+		}
+		if len(page) > int(^uint32(0)>>1) || len(data) > int(^uint32(0)>>1) {
+			return errPageTooLarge
+		}
+		header := w.pageHeader(len(page), len(data))
+		c := _ColumnChunk{
+			offset:           w.off,
+			uncompressedSize: int64(len(header) + len(page)),
+			compressedSize:   int64(len(header) + len(data)),
+		}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(data); err != nil {
+			return err
+		}
+		g.chunks = append(g.chunks, c)
+		g.size += c.uncompressedSize
+		w.pages[i] = page[:0]
+	}
+	w.groups = append(w.groups, g)
+	w.size = 0
+	w.rows = 0
+	return nil
+}
+
+func (w *Writer) pageHeader(uncompressedSize, compressedSize int) []byte {
+	e := &_Encoder{}
+	e.begin(0)
+	e.i32(1, pageTypeData)
+	e.i32(2, int32(uncompressedSize))
+	e.i32(3, int32(compressedSize))
+	e.begin(5)
+	e.i32(1, int32(w.rows))
+	e.i32(2, encodingPlain)
+	e.i32(3, encodingRLE)
+	e.i32(4, encodingRLE)
+	e.end()
+	e.end()
+	return e.buf
+}
+
+func (w *Writer) fileMetadata() []byte {
+	var rows int64
+	for _, g := range w.groups {
+		rows += g.rows
+	}
+	e := &_Encoder{}
+	e.begin(0)
+	e.i32(1, version)
+	e.list(2, thriftStruct, len(w.columns)+1)
+	e.begin(0)
+	e.binary(4, []byte("schema"))
+	e.i32(5, int32(len(w.columns)))
+	e.end()
+	for _, c := range w.columns {
+		e.begin(0)
+		e.i32(1, int32(c.Type))
+		e.i32(3, repetitionRequired)
+		e.binary(4, []byte(c.Name))
+		if t, ok := convertedTypes[c.Converted]; ok {
+			e.i32(6, t)
+		}
+		e.end()
+	}
+	e.i64(3, rows)
+	e.list(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		e.begin(0)
+		e.list(1, thriftStruct, len(g.chunks))
+		for i, c := range g.chunks {
+			e.begin(0)
+			e.i64(2, c.offset)
+			e.begin(3)
+			e.i32(1, int32(w.columns[i].Type))
+			e.listI32(2, encodingPlain, encodingRLE)
+			e.listBinary(3, []byte(w.columns[i].Name))
+			e.i32(4, int32(w.codec))
+			e.i64(5, g.rows)
+			e.i64(6, c.uncompressedSize)
+			e.i64(7, c.compressedSize)
+			e.i64(9, c.offset)
+			e.end()
+			e.end()
+		}
+		e.i64(2, g.size)
+		e.i64(3, g.rows)
+		e.end()
+	}
+	e.binary(6, []byte("unitdb"))
+	e.end()
+	return e.buf
+}
@@ -17,14 +17,32 @@
 package unitdb
 
 import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"sort"
+	"time"
+
 	"github.com/unit-io/unitdb/message"
 )
 
+// cursorSize is the size of the query cursor, the sequence and the prefix of the query.
+const cursorSize = 16
+
 // Query represents a topic to query and optional contract information.
 type (
 	_Query struct {
 		topicHash uint64
 		seq       uint64
+		expiresAt uint32
+	}
+	// _Item is the message read by the query, id is the message ID stored in the data file.
+	_Item struct {
+		id        []byte
+		topicHash uint64
+		seq       uint64
+		val       []byte
+		codec     Codec
 	}
 	_InternalQuery struct {
 		parts      []message.Part // The parts represents a topic which contains a contract and a list of hashes for various parts of the topic.
@@ -32,18 +50,50 @@ type (
 		topicType  uint8
 		prefix     uint64 // The prefix is generated from contract and first of the topic.
 		cutoff     int64  // The cutoff is time limit check on message IDs.
+		until      int64  // The until is upper time limit check on message IDs.
+		cursor     []byte // The cursor to resume the query from, see WithCursor.
+		asOf       uint64 // The asOf is the epoch of the query, entries put after the epoch are excluded.
+		before     uint64 // The before is sequence of the cursor, only messages with lower sequence are returned.
+		after      uint64 // The after is sequence of the cursor of an ascending query, only messages with higher sequence are returned.
+		lastSeq    uint64 // The lastSeq is sequence of the last message returned by the query.
+		truncated  bool   // The truncated is set if the lookup did not read all entries of the topics of the query.
+		order      Order
 		winEntries []_Query
+		// patterns if set are the regular expressions matched against the parts of the topics, see WithRegex.
+		regex    bool
+		patterns []*regexp.Regexp
+		// wildcard is the parts of the topic of a wildcard query matched against the parts of the topics.
+		wildcard [][]byte
+		// diagnostics if set counts the misses of the entries of the query, see WithDiagnostics.
+		diagnostics *QueryDiagnostics
 
 		opts *_QueryOptions
 	}
+	// QueryDiagnostics holds the number of entries of a query found in the time window but missed on read.
+	// Entries deleted before these are synced are also counted as index misses.
+	QueryDiagnostics struct {
+		FilterFalsePositives int // The number of entries missing in the index the filter reported present.
+		IndexMisses          int // The number of entries missing in the index the filter reported absent.
+		DataReadErrors       int // The number of entries failed to read from the index or the data file.
+	}
 	Query struct {
 		internal _InternalQuery
 		Topic    []byte // The topic of the message.
 		Contract uint32 // The contract is used as prefix in the message ID.
-		Limit    int    // The maximum number of elements to return.
+		Limit    int    // The maximum number of elements to return, DB Get sets it to the applied limit.
 	}
 )
 
+// Order is the order of the messages returned by a query.
+type Order uint8
+
+const (
+	// OrderDesc returns the most recent messages first, it is the default order of a query.
+	OrderDesc Order = iota
+	// OrderAsc returns the oldest messages first.
+	OrderAsc
+)
+
 // NewQuery creates a new query structure from the topic.
 func NewQuery(topic []byte) *Query {
 	return &Query{
@@ -63,11 +113,107 @@ func (q *Query) WithLimit(limit int) *Query {
 	return q
 }
 
+// WithOrder sets order of the messages returned by the query. The query limit applies to the
+// oldest messages of the topic if order is ascending, so the whole chain of window blocks of the topic
+// within the time range of the query is read. The cursor of a query is valid for the same order only.
+func (q *Query) WithOrder(order Order) *Query {
+	q.internal.order = order
+	return q
+}
+
+// WithRegex sets the query to match topics using the topic of the query as a pattern. Each part of the
+// pattern is a regular expression matched against the whole name of the topic part at the same depth,
+// e.g. "teams.alpha.ch[0-9]+". The separator splits the pattern unless it is escaped or is in a character
+// class. Topics put before their part names were known to the DB do not match, and the last option
+// of the topic and pending entries of a transaction are not supported by the regex query.
+func (q *Query) WithRegex() *Query {
+	q.internal.regex = true
+	return q
+}
+
+// WithRange sets time range on query so only messages stored between from and to are returned.
+// A zero from or to leaves that end of the range open.
+func (q *Query) WithRange(from, to time.Time) *Query {
+	q.internal.cutoff, q.internal.until = 0, 0
+	if !from.IsZero() {
+		if cutoff := from.Unix(); cutoff > q.internal.cutoff {
+			q.internal.cutoff = cutoff
+		}
+	}
+	if !to.IsZero() {
+		q.internal.until = to.Unix()
+	}
+	return q
+}
+
+// AsOf sets epoch on query obtained from DB Epoch, so entries put after the epoch are
+// excluded from the results. Entries deleted after the epoch are included while their
+// tombstones are retained, see WithTombstoneRetention. Entries put using an ID leased
+// before the epoch are not excluded.
+func (q *Query) AsOf(epoch uint64) *Query {
+	q.internal.asOf = epoch
+	return q
+}
+
+// WithCursor sets cursor on query to return the next page of results. The cursor
+// is obtained from Cursor method of a query for the same topic and contract.
+func (q *Query) WithCursor(cursor []byte) *Query {
+	q.internal.cursor = cursor
+	return q
+}
+
+// WithDiagnostics enables diagnostics on query to count the entries of the query missed on read,
+// use Diagnostics method of the query after the query is used with DB Get.
+func (q *Query) WithDiagnostics() *Query {
+	q.internal.diagnostics = &QueryDiagnostics{}
+	return q
+}
+
+// Diagnostics returns the misses of the entries of the query after the query is used with DB Get.
+// It returns zero diagnostics if diagnostics are not enabled on query.
+func (q *Query) Diagnostics() QueryDiagnostics {
+	if q.internal.diagnostics == nil {
+		return QueryDiagnostics{}
+	}
+	return *q.internal.diagnostics
+}
+
+// Cursor returns a cursor to the next page of results after the query is used
+// with DB Get. It returns nil if the last page of results was returned.
+func (q *Query) Cursor() []byte {
+	if q.internal.lastSeq == 0 {
+		return nil
+	}
+	cursor := make([]byte, cursorSize)
+	binary.LittleEndian.PutUint64(cursor[:8], q.internal.lastSeq)
+	binary.LittleEndian.PutUint64(cursor[8:16], q.internal.prefix)
+	return cursor
+}
+
+// cursorSeq returns sequence of the cursor, entries with sequence less than the cursor
+// sequence are returned by the query, or greater if the order of the query is ascending.
+func (q *Query) cursorSeq() (uint64, error) {
+	if q.internal.cursor == nil {
+		return 0, nil
+	}
+	if len(q.internal.cursor) != cursorSize || binary.LittleEndian.Uint64(q.internal.cursor[8:16]) != q.internal.prefix {
+		return 0, errInvalidCursor
+	}
+	seq := binary.LittleEndian.Uint64(q.internal.cursor[:8])
+	if seq == 0 {
+		return 0, errInvalidCursor
+	}
+	return seq, nil
+}
+
 func (q *Query) parse() error {
 	if q.Contract == 0 {
 		q.Contract = message.MasterContract
 	}
-	topic := new(message.Topic)
+	if q.internal.regex {
+		return q.parseRegex()
+	}
+	topic := &message.Topic{Separator: q.internal.opts.separator}
 	//Parse the Key.
 	topic.ParseKey(q.Topic)
 	// Parse the topic.
@@ -80,20 +226,104 @@ func (q *Query) parse() error {
 	q.internal.depth = topic.Depth
 	q.internal.topicType = topic.TopicType
 	q.internal.prefix = message.Prefix(q.internal.parts)
+	// the generic wildcard query matches the topics written to the generic wildcard topic only.
+	q.internal.wildcard = nil
+	if parts, _ := q.internal.opts.separator.SplitTopic(q.Topic); topic.TopicType == message.TopicWildcard && !bytes.Equal(parts[len(parts)-1], []byte(message.TopicGenericSymbol)) {
+		q.internal.wildcard = parts
+	}
 	// In case of last, include it to the query.
 	if from, limit, ok := topic.Last(); ok {
-		q.internal.cutoff = from.Unix()
-		switch {
-		case (q.Limit == 0 && limit == 0):
-			q.Limit = q.internal.opts.defaultQueryLimit
-		case q.Limit > q.internal.opts.maxQueryLimit || limit > q.internal.opts.maxQueryLimit:
-			q.Limit = q.internal.opts.maxQueryLimit
-		case limit > q.Limit:
+		if cutoff := from.Unix(); cutoff > q.internal.cutoff {
+			q.internal.cutoff = cutoff
+		}
+		if limit > q.Limit {
 			q.Limit = limit
 		}
 	}
-	if q.Limit == 0 {
+	return q.parseLimits()
+}
+
+// parseRegex compiles the parts of the pattern of a regex query.
+func (q *Query) parseRegex() error {
+	parts := splitPattern(q.Topic, q.internal.opts.separator)
+	q.internal.patterns = q.internal.patterns[:0]
+	for _, part := range parts {
+		re, err := regexp.Compile("^(?:" + string(part) + ")$")
+		if err != nil {
+			return errBadPattern
+		}
+		q.internal.patterns = append(q.internal.patterns, re)
+	}
+	q.internal.parts = nil
+	q.internal.depth = uint8(len(parts))
+	q.internal.topicType = message.TopicStatic
+	q.internal.prefix = uint64(q.Contract)
+	return q.parseLimits()
+}
+
+// parseLimits applies the limit and the cursor of the query.
+func (q *Query) parseLimits() error {
+	// Apply default limit if query does not specify a limit and cap the limit to the max limit.
+	if q.Limit <= 0 {
 		q.Limit = q.internal.opts.defaultQueryLimit
 	}
+	if q.Limit > q.internal.opts.maxQueryLimit {
+		q.Limit = q.internal.opts.maxQueryLimit
+	}
+	before, err := q.cursorSeq()
+	if err != nil {
+		return err
+	}
+	q.internal.after = 0
+	if q.internal.order == OrderAsc {
+		q.internal.after, before = before, 0
+	}
+	if q.internal.asOf > 0 && (before == 0 || q.internal.asOf+1 < before) {
+		before = q.internal.asOf + 1
+	}
+	q.internal.before = before
+	q.internal.lastSeq = 0
+	q.internal.winEntries = q.internal.winEntries[:0]
+	if q.internal.diagnostics != nil {
+		*q.internal.diagnostics = QueryDiagnostics{}
+	}
 	return nil
 }
+
+// splitPattern splits the pattern of a regex query into parts at the topic separator. The separator
+// escaped or in a character class is part of the regular expression.
+func splitPattern(pattern []byte, separator message.Separator) (parts [][]byte) {
+	sep := byte(message.TopicSeparator)
+	if separator != 0 {
+		sep = byte(separator)
+	}
+	start, class := 0, false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == sep && !class:
+			parts = append(parts, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+// sortEntries sorts the window entries in the order of the query.
+func (q *_InternalQuery) sortEntries() {
+	sort.Slice(q.winEntries, func(i, j int) bool {
+		if q.order == OrderAsc {
+			return q.winEntries[i].seq < q.winEntries[j].seq
+		}
+		return q.winEntries[i].seq > q.winEntries[j].seq
+	})
+}
+
+func (q *_InternalQuery) filter() _LookupFilter {
+	return _LookupFilter{cutoff: q.cutoff, until: q.until, before: q.before, after: q.after}
+}
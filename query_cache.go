@@ -0,0 +1,214 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type (
+	// _QueryCacheKey is the normalized query the results are cached by.
+	_QueryCacheKey struct {
+		contract uint32
+		topic    string
+		limit    int
+		order    Order
+		regex    bool
+		from     int64
+		until    int64
+	}
+
+	_QueryCacheEntry struct {
+		key       _QueryCacheKey
+		items     [][]byte
+		lastSeq   uint64
+		topics    []uint64
+		expiresAt time.Time
+	}
+
+	// _QueryCache is a LRU cache of the results of recent queries set using WithQueryCache. The results
+	// are invalidated on writes and deletes of the topics the query read, the results of wildcard and
+	// regex queries are also invalidated when a new topic is added, as the new topic may match the query.
+	_QueryCache struct {
+		mu        sync.Mutex
+		size      int
+		ttl       time.Duration
+		lru       *list.List
+		entries   map[_QueryCacheKey]*list.Element
+		topics    map[uint64]map[_QueryCacheKey]struct{} // topics maps topic hash to the keys of the results reading the topic.
+		wildcards map[_QueryCacheKey]struct{}
+
+		// gen is incremented on each invalidation, results of a query read while the cache is
+		// invalidated are not cached as the results may miss the write invalidating the cache.
+		gen uint64
+	}
+)
+
+func newQueryCache(size int, ttl time.Duration) *_QueryCache {
+	if size <= 0 {
+		return nil
+	}
+	return &_QueryCache{
+		size:      size,
+		ttl:       ttl,
+		lru:       list.New(),
+		entries:   make(map[_QueryCacheKey]*list.Element),
+		topics:    make(map[uint64]map[_QueryCacheKey]struct{}),
+		wildcards: make(map[_QueryCacheKey]struct{}),
+	}
+}
+
+// cacheKey returns the key of the query and false if the results of the query are not cached. Queries
+// resuming from a cursor, reading as of an epoch or collecting diagnostics are not cached.
+func (q *Query) cacheKey(from int64) (_QueryCacheKey, bool) {
+	if q.internal.cursor != nil || q.internal.asOf > 0 || q.internal.diagnostics != nil {
+		return _QueryCacheKey{}, false
+	}
+	topic := q.Topic
+	if !q.internal.regex {
+		topic = q.internal.opts.separator.JoinParts(q.internal.opts.separator.SplitTopic(topic))
+	}
+	return _QueryCacheKey{
+		contract: q.Contract,
+		topic:    string(topic),
+		limit:    q.Limit,
+		order:    q.internal.order,
+		regex:    q.internal.regex,
+		from:     from,
+		until:    q.internal.until,
+	}, true
+}
+
+// generation returns the generation of the cache to put the results of a query read after the call.
+func (c *_QueryCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// get returns the cached results of the query. Items are copied, so the caller can modify the items.
+func (c *_QueryCache) get(key _QueryCacheKey) (items [][]byte, lastSeq uint64, ok bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	e := elem.Value.(*_QueryCacheEntry)
+	if c.ttl > 0 && time.Now().After(e.expiresAt) {
+		c.remove(elem)
+		return nil, 0, false
+	}
+	c.lru.MoveToFront(elem)
+	items = make([][]byte, len(e.items))
+	for i, item := range e.items {
+		items[i] = append([]byte(nil), item...)
+	}
+	return items, e.lastSeq, true
+}
+
+// put caches the results of the query reading the topics, the least recently used results are
+// evicted if the cache is full. Wildcard results are invalidated when a new topic is added. The
+// results are not cached if the cache is invalidated since the generation the query is read at.
+func (c *_QueryCache) put(gen uint64, key _QueryCacheKey, items [][]byte, lastSeq uint64, topics _Topics, wildcard bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	e := &_QueryCacheEntry{key: key, items: items, lastSeq: lastSeq, expiresAt: time.Now().Add(c.ttl)}
+	for _, topic := range topics {
+		e.topics = append(e.topics, topic.hash)
+		keys, ok := c.topics[topic.hash]
+		if !ok {
+			keys = make(map[_QueryCacheKey]struct{})
+			c.topics[topic.hash] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	if wildcard {
+		c.wildcards[key] = struct{}{}
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate removes the cached results reading the topic. If the topic is added, the results of wildcard
+// queries are also removed.
+func (c *_QueryCache) invalidate(topicHash uint64, added bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key := range c.topics[topicHash] {
+		c.remove(c.entries[key])
+	}
+	if added {
+		for key := range c.wildcards {
+			c.remove(c.entries[key])
+		}
+	}
+}
+
+// invalidateAll removes all cached results, it is used if the topic of a write or delete is not known.
+func (c *_QueryCache) invalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if c.lru.Len() == 0 {
+		return
+	}
+	c.lru.Init()
+	c.entries = make(map[_QueryCacheKey]*list.Element)
+	c.topics = make(map[uint64]map[_QueryCacheKey]struct{})
+	c.wildcards = make(map[_QueryCacheKey]struct{})
+}
+
+// remove removes the cached results of the element. The caller must hold the lock.
+func (c *_QueryCache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*_QueryCacheEntry)
+	delete(c.entries, e.key)
+	delete(c.wildcards, e.key)
+	for _, topicHash := range e.topics {
+		keys := c.topics[topicHash]
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(c.topics, topicHash)
+		}
+	}
+}
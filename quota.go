@@ -0,0 +1,364 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// QuotaPolicy is the action taken on writes exceeding the quota of the contract.
+type QuotaPolicy uint8
+
+// Quota policies.
+const (
+	// QuotaReject rejects the writes exceeding the quota with QuotaError.
+	QuotaReject QuotaPolicy = iota
+	// QuotaEvict deletes the oldest entries of the contract to make room for the write. The DB must be
+	// mutable to delete entries, the write is rejected with QuotaError if no entry can be evicted.
+	QuotaEvict
+)
+
+// QuotaLimit is the quota or the rate limit of the contract exceeded by a write.
+type QuotaLimit uint8
+
+// Quota limits.
+const (
+	// LimitStoredBytes is the quota of stored bytes set using WithQuota.
+	LimitStoredBytes QuotaLimit = iota
+	// LimitMessageRate is the messages per second set using WithRateLimit.
+	LimitMessageRate
+	// LimitDailyBytes is the bytes per day set using WithRateLimit.
+	LimitDailyBytes
+)
+
+func (l QuotaLimit) String() string {
+	switch l {
+	case LimitMessageRate:
+		return "message rate"
+	case LimitDailyBytes:
+		return "daily bytes"
+	default:
+		return "stored bytes"
+	}
+}
+
+// RateLimit is the maximum messages per second and the maximum bytes per day a contract is allowed to write.
+type RateLimit struct {
+	MessagesPerSec int
+	BytesPerDay    int64
+}
+
+// _Rate is the write rate of a contract. Messages per second is a token bucket holding a second of
+// messages and bytes per day are counted per UTC day.
+type _Rate struct {
+	tokens   float64
+	last     time.Time
+	day      int64
+	dayBytes int64
+}
+
+// _Quotas tracks the stored bytes per contract, that is the size of the message ID, topic and
+// the packed payload of the entries. Quotas are soft, usage is persisted on sync so writes
+// recovered from the log after a crash and batches aborted after the write are not accounted.
+type _Quotas struct {
+	mu           sync.Mutex
+	path         string
+	policy       QuotaPolicy
+	defaultQuota int64
+	quotas       map[uint32]int64
+	usage        map[uint32]int64
+	// evictSeq is the seq to resume scan for the oldest entries of the contract.
+	evictSeq map[uint32]uint64
+	dirty    bool
+
+	// The rate limits and the write rates of the contracts, rates are not persisted.
+	defaultRate RateLimit
+	rateLimits  map[uint32]RateLimit
+	rates       map[uint32]*_Rate
+}
+
+func newQuotas(dirName string, opts *_Options) (*_Quotas, error) {
+	q := &_Quotas{
+		path:         path.Join(dirName, fmt.Sprintf("%s.usage", prefix)),
+		policy:       opts.quotaPolicy,
+		defaultQuota: opts.defaultQuota,
+		quotas:       opts.quotas,
+		usage:        make(map[uint32]int64),
+		evictSeq:     make(map[uint32]uint64),
+
+		defaultRate: opts.rateLimit,
+		rateLimits:  opts.rateLimits,
+		rates:       make(map[uint32]*_Rate),
+	}
+	if !q.enabled() {
+		return q, nil
+	}
+	data, err := ioutil.ReadFile(q.path)
+	switch {
+	case os.IsNotExist(err):
+		return q, nil
+	case err != nil:
+		return nil, err
+	case len(data)%12 != 0:
+		return nil, errCorrupted
+	}
+	for ; len(data) > 0; data = data[12:] {
+		q.usage[binary.LittleEndian.Uint32(data[0:4])] = int64(binary.LittleEndian.Uint64(data[4:12]))
+	}
+	return q, nil
+}
+
+// enabled returns true if quota is set on DB, usage is tracked only if quota is set.
+func (q *_Quotas) enabled() bool {
+	return q.defaultQuota > 0 || len(q.quotas) > 0
+}
+
+func (q *_Quotas) quota(contract uint32) int64 {
+	if quota, ok := q.quotas[contract]; ok {
+		return quota
+	}
+	return q.defaultQuota
+}
+
+// rateEnabled returns true if rate limit is set on DB.
+func (q *_Quotas) rateEnabled() bool {
+	return q.defaultRate != (RateLimit{}) || len(q.rateLimits) > 0
+}
+
+func (q *_Quotas) rateLimit(contract uint32) RateLimit {
+	if limit, ok := q.rateLimits[contract]; ok {
+		return limit
+	}
+	return q.defaultRate
+}
+
+// take takes a message and size bytes from the rate of the contract if these are within the rate limit,
+// otherwise it returns the limit exceeded.
+func (q *_Quotas) take(contract uint32, size int64, now time.Time) (QuotaLimit, bool) {
+	limit := q.rateLimit(contract)
+	if limit == (RateLimit{}) {
+		return 0, true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.rates[contract]
+	if !ok {
+		r = &_Rate{tokens: float64(limit.MessagesPerSec), last: now}
+		q.rates[contract] = r
+	}
+	if limit.MessagesPerSec > 0 {
+		r.tokens += now.Sub(r.last).Seconds() * float64(limit.MessagesPerSec)
+		if r.tokens > float64(limit.MessagesPerSec) {
+			r.tokens = float64(limit.MessagesPerSec)
+		}
+		r.last = now
+		if r.tokens < 1 {
+			return LimitMessageRate, false
+		}
+	}
+	if limit.BytesPerDay > 0 {
+		if day := now.Unix() / 86400; day != r.day {
+			r.day = day
+			r.dayBytes = 0
+		}
+		if r.dayBytes+size > limit.BytesPerDay {
+			return LimitDailyBytes, false
+		}
+		r.dayBytes += size
+	}
+	if limit.MessagesPerSec > 0 {
+		r.tokens--
+	}
+	return 0, true
+}
+
+// untake returns the message and size bytes taken for a write rejected on the stored bytes quota.
+func (q *_Quotas) untake(contract uint32, size int64) {
+	if q.rateLimit(contract) == (RateLimit{}) {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r, ok := q.rates[contract]; ok {
+		r.tokens++
+		r.dayBytes -= size
+	}
+}
+
+// reserve adds size to the usage of the contract if it fits into the quota of the contract, otherwise it returns the bytes over the quota.
+func (q *_Quotas) reserve(contract uint32, size int64) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if quota := q.quota(contract); quota > 0 && q.usage[contract]+size > quota {
+		return q.usage[contract] + size - quota
+	}
+	q.usage[contract] += size
+	q.dirty = true
+	return 0
+}
+
+// release removes size from the usage of the contract.
+func (q *_Quotas) release(contract uint32, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.usage[contract] -= size; q.usage[contract] <= 0 {
+		delete(q.usage, contract)
+	}
+	q.dirty = true
+}
+
+func (q *_Quotas) snapshot() map[uint32]int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage := make(map[uint32]int64, len(q.usage))
+	for contract, size := range q.usage {
+		usage[contract] = size
+	}
+	return usage
+}
+
+// reset replaces the usage of the contracts with the usage recounted from the index file.
+func (q *_Quotas) reset(usage map[uint32]int64) {
+	if !q.enabled() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.usage = usage
+	q.dirty = true
+}
+
+// write writes the usage to the usage file if usage has changed since the last write.
+func (q *_Quotas) write() error {
+	q.mu.Lock()
+	if !q.dirty {
+		q.mu.Unlock()
+		return nil
+	}
+	buf := make([]byte, 0, len(q.usage)*12)
+	for contract, size := range q.usage {
+		var scratch [12]byte
+		binary.LittleEndian.PutUint32(scratch[0:4], contract)
+		binary.LittleEndian.PutUint64(scratch[4:12], uint64(size))
+		buf = append(buf, scratch[:]...)
+	}
+	q.dirty = false
+	q.mu.Unlock()
+
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// checkQuota takes the entry from the rate limit of the contract and reserves the size of the entry in the quota
+// of the contract. If quota policy is QuotaEvict the oldest entries of the contract are deleted to make room for the entry.
+func (db *DB) checkQuota(contract uint32, size int64) error {
+	q := db.internal.quotas
+	if !q.enabled() && !q.rateEnabled() {
+		return nil
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if q.rateEnabled() {
+		if limit, ok := q.take(contract, size, time.Now()); !ok {
+			db.internal.meter.QuotaRejects.Inc(1)
+			return &QuotaError{Contract: contract, Limit: limit}
+		}
+	}
+	if !q.enabled() {
+		return nil
+	}
+	for {
+		over := q.reserve(contract, size)
+		if over == 0 {
+			return nil
+		}
+		if q.policy != QuotaEvict || !db.evict(contract, over) {
+			q.untake(contract, size)
+			db.internal.meter.QuotaRejects.Inc(1)
+			return &QuotaError{Contract: contract, Limit: LimitStoredBytes}
+		}
+	}
+}
+
+// evict deletes the oldest entries of the contract until size bytes are released. It returns false if no entry is deleted.
+func (db *DB) evict(contract uint32, size int64) bool {
+	if db.opts.flags.immutable {
+		return false
+	}
+	q := db.internal.quotas
+	q.mu.Lock()
+	seq := q.evictSeq[contract]
+	q.mu.Unlock()
+	if seq == 0 {
+		seq = 1
+	}
+	var released int64
+	var resume uint64
+	for upper := db.seq(); seq <= upper && released < size; seq++ {
+		e, err := db.readEntry(_Query{seq: seq})
+		if err != nil || e.seq != seq {
+			continue
+		}
+		// The entry packing the topic is kept until it is synced, as the topic is recovered from the log with the entry.
+		if e.topicSize != 0 && e.cache != nil {
+			if resume == 0 {
+				resume = seq
+			}
+			continue
+		}
+		id, _, err := db.internal.reader.readMessage(e)
+		if err != nil || !message.ID(id).EvalPrefix(contract, 0) {
+			continue
+		}
+		if err := db.delete(0, seq); err != nil {
+			logger.Error().Err(err).Str("context", "db.evict")
+			break
+		}
+		released += int64(e.mSize())
+	}
+	if resume != 0 {
+		seq = resume
+	}
+	q.mu.Lock()
+	q.evictSeq[contract] = seq
+	q.mu.Unlock()
+	return released > 0
+}
+
+// releaseQuota removes size of the deleted entry from the usage of its contract.
+func (db *DB) releaseQuota(e _IndexEntry) {
+	if !db.internal.quotas.enabled() {
+		return
+	}
+	id, _, err := db.internal.reader.readMessage(e)
+	if err != nil {
+		return
+	}
+	db.internal.quotas.release(binary.LittleEndian.Uint32(id[4:8]), int64(e.mSize()))
+}
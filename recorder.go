@@ -0,0 +1,243 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	recordPut uint8 = iota + 1
+	recordGet
+	recordDelete
+	recordSync
+
+	// workloadRecordSize is size of the fixed fields of the workload record preceding the topic.
+	workloadRecordSize = 19
+
+	// sampleScale is the scale of the sample rate of the recorder.
+	sampleScale = 10000
+)
+
+type (
+	// ReplayStats holds the number of operations replayed and mean latency of the operations.
+	ReplayStats struct {
+		Puts, Gets, Deletes, Syncs int64
+		Errors                     int64 // The number of replayed operations returning an error.
+		Duration                   time.Duration
+		PutLatency                 time.Duration
+		GetLatency                 time.Duration
+		DeleteLatency              time.Duration
+		SyncLatency                time.Duration
+	}
+
+	_ReplayKey struct {
+		contract uint32
+		topic    string
+	}
+
+	// _Recorder records the operations on the DB to the workload file. Operations on a sample
+	// of the topics are recorded, so recorded topics keep the complete traffic shape. Payloads
+	// are not recorded, only the size of the payload.
+	_Recorder struct {
+		mu     sync.Mutex
+		start  time.Time
+		sample uint64
+		file   *os.File
+		w      *bufio.Writer
+	}
+)
+
+func newRecorder(path string, sampleRate float64) (*_Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &_Recorder{start: time.Now(), sample: uint64(sampleRate * sampleScale), file: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (r *_Recorder) enabled() bool {
+	return r != nil
+}
+
+// add records the operation. The n is the payload size of the put or the limit of the get.
+func (r *_Recorder) add(op uint8, contract uint32, topic []byte, n int) {
+	if !r.enabled() {
+		return
+	}
+	if len(topic) > 0 && r.sample < sampleScale {
+		// topic options are not part of the topic.
+		t := topic
+		if i := bytes.IndexByte(t, '?'); i >= 0 {
+			t = t[:i]
+		}
+		h := fnv.New64a()
+		h.Write(t)
+		if h.Sum64()%sampleScale >= r.sample {
+			return
+		}
+	}
+	size := workloadRecordSize + len(topic)
+	rec := make([]byte, 2+size)
+	binary.LittleEndian.PutUint16(rec[0:2], uint16(size))
+	rec[2] = op
+	binary.LittleEndian.PutUint64(rec[3:11], uint64(time.Since(r.start)))
+	binary.LittleEndian.PutUint32(rec[11:15], contract)
+	binary.LittleEndian.PutUint32(rec[15:19], uint32(n))
+	binary.LittleEndian.PutUint16(rec[19:21], uint16(len(topic)))
+	copy(rec[21:], topic)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.w.Write(rec); err != nil {
+		logger.Error().Err(err).Str("context", "recorder.add")
+		return
+	}
+	if op == recordSync {
+		if err := r.w.Flush(); err != nil {
+			logger.Error().Err(err).Str("context", "recorder.flush")
+		}
+	}
+}
+
+func (r *_Recorder) close() error {
+	if !r.enabled() {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// Replay re-executes the workload recorded using WithRecorder option against the DB. Operations are
+// replayed in the recorded order, with the recorded timing scaled by the speed, for example speed 2
+// replays the workload twice as fast. Setting the speed to 0 replays operations as fast as possible.
+// Payloads of the puts are generated of the recorded size from a fixed seed, so the replay is
+// deterministic. Recorded deletes delete the oldest entry put to the topic by the replay.
+func (db *DB) Replay(path string, speed float64) (*ReplayStats, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	stats := &ReplayStats{}
+	var putTime, getTime, deleteTime, syncTime time.Duration
+	rnd := rand.New(rand.NewSource(1))
+	ids := make(map[_ReplayKey][][]byte) // ids of the entries put by the replay.
+	start := time.Now()
+	hdr := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return stats, err
+		}
+		size := int(binary.LittleEndian.Uint16(hdr))
+		if size < workloadRecordSize {
+			return stats, errCorrupted
+		}
+		rec := make([]byte, size)
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return stats, errCorrupted
+		}
+		op := rec[0]
+		elapsed := time.Duration(binary.LittleEndian.Uint64(rec[1:9]))
+		contract := binary.LittleEndian.Uint32(rec[9:13])
+		n := int(binary.LittleEndian.Uint32(rec[13:17]))
+		topicSize := int(binary.LittleEndian.Uint16(rec[17:19]))
+		if size < workloadRecordSize+topicSize {
+			return stats, errCorrupted
+		}
+		topic := rec[workloadRecordSize : workloadRecordSize+topicSize]
+		if speed > 0 {
+			if d := time.Duration(float64(elapsed)/speed) - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+
+		// topic options are not part of the topic of the replayed entries.
+		name := topic
+		if i := bytes.IndexByte(topic, '?'); i >= 0 {
+			name = topic[:i]
+		}
+		key := _ReplayKey{contract: contract, topic: string(name)}
+		opStart := time.Now()
+		switch op {
+		case recordPut:
+			payload := make([]byte, n)
+			rnd.Read(payload)
+			id := db.NewID()
+			err = db.PutEntry(NewEntry(topic, payload).WithID(id).WithContract(contract))
+			if err == nil {
+				ids[key] = append(ids[key], id)
+			}
+			putTime += time.Since(opStart)
+			stats.Puts++
+		case recordGet:
+			_, err = db.Get(NewQuery(topic).WithContract(contract).WithLimit(n))
+			getTime += time.Since(opStart)
+			stats.Gets++
+		case recordDelete:
+			if len(ids[key]) == 0 {
+				continue
+			}
+			id := ids[key][0]
+			ids[key] = ids[key][1:]
+			err = db.DeleteEntry(NewEntry(name, nil).WithID(id).WithContract(contract))
+			deleteTime += time.Since(opStart)
+			stats.Deletes++
+		case recordSync:
+			err = db.Sync()
+			syncTime += time.Since(opStart)
+			stats.Syncs++
+		default:
+			return stats, errCorrupted
+		}
+		if err != nil {
+			stats.Errors++
+		}
+	}
+	stats.Duration = time.Since(start)
+	mean := func(d time.Duration, n int64) time.Duration {
+		if n == 0 {
+			return 0
+		}
+		return d / time.Duration(n)
+	}
+	stats.PutLatency = mean(putTime, stats.Puts)
+	stats.GetLatency = mean(getTime, stats.Gets)
+	stats.DeleteLatency = mean(deleteTime, stats.Deletes)
+	stats.SyncLatency = mean(syncTime, stats.Syncs)
+	return stats, nil
+}
@@ -17,9 +17,9 @@
 package unitdb
 
 import (
-	"errors"
 	"fmt"
 	"sort"
+	"sync/atomic"
 
 	"github.com/unit-io/unitdb/message"
 	// _ "net/http/pprof"
@@ -31,13 +31,9 @@ func (db *_SyncHandle) recoverWindowBlocks(windowEntries map[uint64]_WindowEntri
 		if !ok {
 			return fmt.Errorf("recovery.recoverWindowBlocks: timeWindow sync error, unable to get topic offset from trie %d", h)
 		}
-		wOff, err := db.windowWriter.append(h, topicOff, wEntries)
-		if err != nil {
+		if _, err := db.windowWriter.append(h, topicOff, wEntries); err != nil {
 			return err
 		}
-		if ok := db.internal.trie.setOffset(_Topic{hash: h, offset: wOff}); !ok {
-			return errors.New("recovery.recoverWindowBlocks: timeWindow sync error, unable to set topic offset in trie")
-		}
 	}
 	return nil
 }
@@ -50,6 +46,12 @@ func (db *_SyncHandle) startRecovery() error {
 		db.internal.closeW.Done()
 	}()
 	fmt.Println("db.recoverLog: start recovery")
+	// Advance the sequence past the entries recovered from the WAL so these are synced and their sequence is not reused.
+	for _, seq := range db.internal.mem.Keys() {
+		if seq&deleteRecordFlag == 0 && seq > db.seq() {
+			atomic.StoreUint64(&db.internal.dbInfo.sequence, seq)
+		}
+	}
 	if ok := db.startSync(); !ok {
 		return nil
 	}
@@ -65,10 +67,20 @@ func (db *_SyncHandle) startRecovery() error {
 		sort.Slice(seqs[:], func(i, j int) bool {
 			return seqs[i] < seqs[j]
 		})
-		if seqs[len(seqs)-1] > db.syncInfo.upperSeq {
-			db.syncInfo.upperSeq = seqs[len(seqs)-1]
-		}
+		var deletes []_Entry
 		for _, seq := range seqs {
+			if seq&deleteRecordFlag != 0 {
+				// delete record of a batch is replayed once the entries of the time block are recovered.
+				if memdata, err := db.internal.mem.Lookup(timeID, seq); err == nil {
+					var m _Entry
+					m.UnmarshalBinary(memdata[:entrySize])
+					deletes = append(deletes, m)
+				}
+				continue
+			}
+			if seq > db.syncInfo.upperSeq {
+				db.syncInfo.upperSeq = seq
+			}
 			memdata, err := db.internal.mem.Lookup(timeID, seq)
 			if err != nil || memdata == nil {
 				db.syncInfo.entriesInvalid++
@@ -109,8 +121,9 @@ func (db *_SyncHandle) startRecovery() error {
 			} else {
 				winEntries[m.topicHash] = _WindowEntries{newWinEntry(m.seq, m.expiresAt)}
 			}
-			db.internal.filter.Append(e.seq)
+			db.internal.filter.appendWithExpiry(e.seq, m.expiresAt)
 			db.syncInfo.count++
+			db.syncContract(e)
 			db.syncInfo.inBytes += int64(e.valueSize)
 		}
 		if err1 != nil {
@@ -136,6 +149,11 @@ func (db *_SyncHandle) startRecovery() error {
 		if err := db.sync(true); err != nil {
 			return true, err
 		}
+		for _, e := range deletes {
+			if err := db.applyDelete(e); err != nil {
+				return true, err
+			}
+		}
 		if db.syncInfo.syncComplete {
 			// if err := timeRelease(timeID); err != nil {
 			// 	return false, err
@@ -164,10 +182,8 @@ func (db *_SyncHandle) startRecovery() error {
 
 func (db *DB) recoverLog() error {
 	// Sync happens synchronously.
-	db.internal.syncLockC <- struct{}{}
-	defer func() {
-		<-db.internal.syncLockC
-	}()
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
 
 	syncHandle := _SyncHandle{DB: db}
 	if err := syncHandle.startRecovery(); err != nil {
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"context"
+	"encoding/binary"
+
+	fltr "github.com/unit-io/unitdb/filter"
+)
+
+// ReindexReport is the result of rebuilding the derived structures of the DB.
+type ReindexReport struct {
+	IndexBlocks int    `json:"index_blocks"` // Number of index blocks scanned.
+	Entries     uint64 `json:"entries"`      // Number of live entries found in the index file.
+	Count       uint64 `json:"count"`        // Entry count recorded in the DB header before reindex.
+	Topics      int    `json:"topics"`       // Number of topics missing from the trie added from the window file.
+}
+
+// Reindex rebuilds the structures derived from the index and window files, that is the bloom filter,
+// the entry count, the topics of the trie, the quota usage and the stats of the contracts. It is used after a bulk
+// import or a repair left the derived structures stale. Reindex runs as a maintenance operation holding
+// the sync lock, Puts and Gets are served while it runs and entries are synced once it completes. The
+// progress func if not nil is called after each index block is scanned. Reindex stops if the context is done.
+func (db *DB) Reindex(ctx context.Context, progress func(done, total int)) (*ReindexReport, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	if !db.internal.syncLock.lockMaintenance(db.internal.closeC) {
+		return nil, errClosed
+	}
+	defer db.internal.syncLock.unlock()
+
+	report := &ReindexReport{Count: db.Count()}
+	r := newBlockReader(db.fs)
+	if r.indexFile == nil {
+		return report, nil
+	}
+	nBlocks := int(r.indexFile.currSize() / int64(blockSize))
+	filterBlock := fltr.NewFilterGenerator()
+	usage := make(map[uint32]int64)
+	contracts := make(map[uint32]_ContractUsage)
+	for bIdx := 0; bIdx < nBlocks; bIdx++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		r.offset = blockOffset(int32(bIdx))
+		b, err := r.readIndexBlock()
+		if err != nil {
+			return report, err
+		}
+		for i := 0; i < entriesPerIndexBlock; i++ {
+			e := b.entries[i]
+			if e.seq == 0 || e.msgOffset == -1 {
+				continue
+			}
+			filterBlock.Append(e.seq)
+			report.Entries++
+			id, _, err := r.readMessage(e)
+			if err != nil || e.valueSize == 0 {
+				continue
+			}
+			addEntry(contracts, id, int64(e.mSize()))
+			if db.internal.quotas.enabled() {
+				usage[binary.LittleEndian.Uint32(id[4:8])] += int64(e.mSize())
+			}
+		}
+		report.IndexBlocks++
+		if progress != nil {
+			progress(bIdx+1, nBlocks)
+		}
+	}
+
+	// topics missing from the trie are added from the window file.
+	topics := db.internal.trie.Count()
+	if err := db.loadTrie(); err != nil {
+		return report, err
+	}
+	report.Topics = db.internal.trie.Count() - topics
+
+	db.internal.filter.reset(filterBlock)
+	if err := db.internal.filter.writeFilterBlock(); err != nil {
+		return report, err
+	}
+	db.internal.count.store(report.Entries)
+	db.internal.quotas.reset(usage)
+	db.internal.contractStats.reset(contracts)
+	return report, db.sync()
+}
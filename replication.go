@@ -0,0 +1,209 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/unit-io/unitdb/replication"
+)
+
+const (
+	// maxSegmentSize is the size of the segment after which no more entries are added to the segment.
+	maxSegmentSize = 1 << 20
+	// replicationPollInterval is the interval the leader checks for entries committed after the segment sent last.
+	replicationPollInterval = 100 * time.Millisecond
+	// replicaRetryInterval is the interval the follower waits before reconnecting to the leader.
+	replicaRetryInterval = time.Second
+)
+
+// _ReplicationSource builds the segments streamed to the followers.
+type _ReplicationSource struct {
+	db *DB
+}
+
+// Segment returns the entries committed after the sequence encoded as the records of the WAL. A record is
+// the entry as it is put to the memdb and the topic is packed in all records, so the follower can add
+// the topics to its trie.
+func (src _ReplicationSource) Segment(since uint64) ([]byte, uint64, error) {
+	db := src.db
+	if err := db.ok(); err != nil {
+		return nil, since, err
+	}
+	entries, err := db.changeEntries(since)
+	if err != nil {
+		return nil, since, err
+	}
+	last := since
+	var seg []byte
+	for _, ce := range entries {
+		if len(seg) >= maxSegmentSize {
+			break
+		}
+		last = ce.seq
+		rawTopic, ok := db.internal.trie.rawTopic(ce.topicHash)
+		if !ok {
+			continue
+		}
+		e, err := db.readEntry(_Query{seq: ce.seq})
+		if err != nil {
+			if err == errMsgIDDeleted || err == errEntryInvalid {
+				continue
+			}
+			return nil, since, err
+		}
+		id, val, err := db.internal.reader.readMessage(e)
+		if err != nil {
+			return nil, since, err
+		}
+		m := _Entry{seq: ce.seq, topicSize: uint16(len(rawTopic)), valueSize: uint32(len(val)), expiresAt: ce.expiresAt, topicHash: ce.topicHash}
+		entryData, err := m.MarshalBinary()
+		if err != nil {
+			return nil, since, err
+		}
+		// record is the length, the delete bit and the key followed by the entry.
+		var scratch [13]byte
+		binary.LittleEndian.PutUint32(scratch[0:4], uint32(len(scratch)+len(entryData)+idSize+len(rawTopic)+len(val)))
+		binary.LittleEndian.PutUint64(scratch[5:13], ce.seq)
+		seg = append(seg, scratch[:]...)
+		seg = append(seg, entryData...)
+		seg = append(seg, id[:idSize]...)
+		seg = append(seg, rawTopic...)
+		seg = append(seg, val...)
+	}
+	return seg, last, nil
+}
+
+// Seq returns the sequence of the last entry of the DB. On a follower it is the sequence of the last entry
+// applied from the leader, so the lag of the follower is the difference of the sequences of the leader and the follower.
+// The sequence of the follower is advanced only after the entries applied are readable.
+func (db *DB) Seq() uint64 {
+	if db.opts.replicaOf != "" {
+		return atomic.LoadUint64(&db.internal.appliedSeq)
+	}
+	return db.seq()
+}
+
+// applySegment puts the records of the segment received from the leader to the memdb and
+// syncs these to the DB using the recovery path.
+func (db *DB) applySegment(seg []byte) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	b := db.internal.mem.NewBatch()
+	var count int
+	var last uint64
+	seen := make(map[uint64]struct{})
+	for off := 0; off < len(seg); {
+		recLen := int(binary.LittleEndian.Uint32(seg[off : off+4]))
+		data := seg[off+13 : off+recLen]
+		seq := binary.LittleEndian.Uint64(seg[off+5 : off+13])
+		off += recLen
+		if seq <= db.seq() {
+			// entry is already applied.
+			continue
+		}
+		var m _Entry
+		if err := m.UnmarshalBinary(data[:entrySize]); err != nil {
+			b.Abort()
+			return err
+		}
+		rawTopic := data[entrySize+idSize : entrySize+idSize+int(m.topicSize)]
+		val := data[entrySize+idSize+int(m.topicSize):]
+		// topic is packed only in the first entry of the topic.
+		_, ok := seen[m.topicHash]
+		if _, exists := db.internal.trie.getOffset(m.topicHash); exists || ok {
+			rawTopic = nil
+		}
+		seen[m.topicHash] = struct{}{}
+		m.topicSize = uint16(len(rawTopic))
+		entryData, err := m.MarshalBinary()
+		if err != nil {
+			b.Abort()
+			return err
+		}
+		cache := make([]byte, 0, entrySize+idSize+len(rawTopic)+len(val))
+		cache = append(cache, entryData...)
+		cache = append(cache, data[entrySize:entrySize+idSize]...)
+		cache = append(cache, rawTopic...)
+		cache = append(cache, val...)
+		if err := b.Put(seq, cache); err != nil {
+			b.Abort()
+			return err
+		}
+		count++
+		if seq > last {
+			last = seq
+		}
+	}
+	if count == 0 {
+		return b.Abort()
+	}
+	if err := b.Commit(); err != nil {
+		return err
+	}
+	if err := db.recoverLog(); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&db.internal.appliedSeq, last)
+	return nil
+}
+
+// startReplication starts the replication server streaming the segments to the followers on the address.
+func (db *DB) startReplication(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	db.internal.replication = replication.NewServer(_ReplicationSource{db: db}, replicationPollInterval)
+	go func() {
+		if err := db.internal.replication.Serve(l); err != nil {
+			logger.Error().Err(err).Str("context", "db.startReplication").Msg("replication server stopped")
+		}
+	}()
+	return nil
+}
+
+// startReplica follows the leader at the address and applies the segments streamed from the leader.
+// The follower reconnects to the leader and resumes from the last sequence applied if the stream fails.
+func (db *DB) startReplica(addr string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-db.internal.closeC
+		cancel()
+	}()
+	go func() {
+		for {
+			err := replication.Follow(ctx, addr, db.seq(), db.applySegment)
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			logger.Warn().Err(err).Str("context", "db.startReplica").Str("leader", addr).Msg("replication stream failed, reconnecting")
+			select {
+			case <-time.After(replicaRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package replication streams WAL segments from a leader DB to its followers over gRPC.
+// A follower requests the segments after the last sequence it has applied and the leader
+// streams the segments as these are committed.
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	pbx "github.com/unit-io/unitdb/server/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	serviceName = "unitdb.Replication"
+	streamName  = "Stream"
+)
+
+var errBadRequest = errors.New("replication request is invalid")
+
+// Source provides the segments to stream to the followers.
+type Source interface {
+	// Segment returns the segment of the entries committed after the sequence and the sequence of the last entry
+	// of the segment. It returns an empty segment if there are no new entries.
+	Segment(since uint64) (seg []byte, last uint64, err error)
+}
+
+// Server streams the segments of the source to the followers.
+type Server struct {
+	src          Source
+	pollInterval time.Duration
+	srv          *grpc.Server
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    streamName,
+			Handler:       streamHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "replication",
+}
+
+// NewServer creates a server streaming the segments of the source, the source is polled for new
+// segments at the interval.
+func NewServer(src Source, pollInterval time.Duration) *Server {
+	s := &Server{src: src, pollInterval: pollInterval, srv: grpc.NewServer()}
+	s.srv.RegisterService(&serviceDesc, s)
+	return s
+}
+
+// Serve accepts the followers on the listener.
+func (s *Server) Serve(l net.Listener) error {
+	return s.srv.Serve(l)
+}
+
+// Stop closes the listener and the streams of the followers.
+func (s *Server) Stop() {
+	s.srv.Stop()
+}
+
+func streamHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(pbx.Packet)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	if len(req.Data) != 8 {
+		return errBadRequest
+	}
+	return srv.(*Server).stream(binary.LittleEndian.Uint64(req.Data), stream)
+}
+
+// stream sends the segments after the sequence until the follower goes away.
+func (s *Server) stream(since uint64, stream grpc.ServerStream) error {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		seg, last, err := s.src.Segment(since)
+		if err != nil {
+			return err
+		}
+		if len(seg) > 0 {
+			if err := stream.SendMsg(&pbx.Packet{Data: seg}); err != nil {
+				return err
+			}
+		}
+		// deleted entries are skipped and the sequence is advanced past these.
+		if last > since {
+			since = last
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Follow streams the segments after the sequence from the leader at the address and applies them in order.
+// It returns once the context is done, the stream fails or apply returns an error.
+func Follow(ctx context.Context, addr string, since uint64, apply func(seg []byte) error) error {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/"+streamName)
+	if err != nil {
+		return err
+	}
+	req := make([]byte, 8)
+	binary.LittleEndian.PutUint64(req, since)
+	if err := stream.SendMsg(&pbx.Packet{Data: req}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		pkt := new(pbx.Packet)
+		if err := stream.RecvMsg(pkt); err != nil {
+			return err
+		}
+		if err := apply(pkt.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+const (
+	// retentionInterval is the interval to run retention job to enforce retention policies.
+	retentionInterval = time.Minute
+
+	// retentionRecordSize is size of the fixed fields of the retention record preceding the pattern.
+	retentionRecordSize = 22
+)
+
+type (
+	// _RetentionPolicy keeps topics matching the pattern within max age and max count of entries.
+	_RetentionPolicy struct {
+		contract uint32
+		pattern  string
+		maxAge   time.Duration
+		maxCount int
+	}
+
+	// _Retention holds the retention policies set using SetRetention. Policies are persisted to
+	// the retention file on each change.
+	_Retention struct {
+		mu       sync.RWMutex
+		path     string
+		policies map[string]_RetentionPolicy // map[pattern]policy
+	}
+)
+
+func newRetention(dirName string) (*_Retention, error) {
+	r := &_Retention{
+		path:     path.Join(dirName, fmt.Sprintf("%s.retention", prefix)),
+		policies: make(map[string]_RetentionPolicy),
+	}
+	data, err := ioutil.ReadFile(r.path)
+	switch {
+	case os.IsNotExist(err):
+		return r, nil
+	case err != nil:
+		return nil, err
+	}
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errCorrupted
+		}
+		size := int(binary.LittleEndian.Uint16(data[0:2]))
+		if size < retentionRecordSize || len(data) < 2+size {
+			return nil, errCorrupted
+		}
+		rec := data[2 : 2+size]
+		data = data[2+size:]
+		patternSize := int(binary.LittleEndian.Uint16(rec[20:22]))
+		if len(rec) < retentionRecordSize+patternSize {
+			return nil, errCorrupted
+		}
+		p := _RetentionPolicy{
+			contract: binary.LittleEndian.Uint32(rec[0:4]),
+			maxAge:   time.Duration(binary.LittleEndian.Uint64(rec[4:12])),
+			maxCount: int(binary.LittleEndian.Uint64(rec[12:20])),
+			pattern:  string(rec[retentionRecordSize : retentionRecordSize+patternSize]),
+		}
+		r.policies[p.pattern] = p
+	}
+	return r, nil
+}
+
+// set adds or updates the policy of the pattern, the policy is removed if both max age and max count are zero.
+func (r *_Retention) set(p _RetentionPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.maxAge == 0 && p.maxCount == 0 {
+		delete(r.policies, p.pattern)
+	} else {
+		r.policies[p.pattern] = p
+	}
+	return r.write()
+}
+
+func (r *_Retention) snapshot() []_RetentionPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	policies := make([]_RetentionPolicy, 0, len(r.policies))
+	for _, p := range r.policies {
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// write writes the policies to the retention file, the caller must hold the retention lock.
+func (r *_Retention) write() error {
+	var buf []byte
+	for _, p := range r.policies {
+		size := retentionRecordSize + len(p.pattern)
+		rec := make([]byte, 2+size)
+		binary.LittleEndian.PutUint16(rec[0:2], uint16(size))
+		binary.LittleEndian.PutUint32(rec[2:6], p.contract)
+		binary.LittleEndian.PutUint64(rec[6:14], uint64(p.maxAge))
+		binary.LittleEndian.PutUint64(rec[14:22], uint64(p.maxCount))
+		binary.LittleEndian.PutUint16(rec[22:24], uint16(len(p.pattern)))
+		copy(rec[24:], p.pattern)
+		buf = append(buf, rec...)
+	}
+
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// SetRetention sets retention policy of the topics matching the pattern. The pattern can be a
+// wildcard topic, for example "teams.alpha..." sets the policy of all topics under the "teams.alpha"
+// prefix. Messages older than max age and the oldest messages exceeding max count of each topic
+// are deleted by the retention job that runs in the background. A zero max age or max count leaves
+// that limit unset, the policy of the pattern is removed if both are zero. The DB must be mutable.
+func (db *DB) SetRetention(pattern []byte, maxAge time.Duration, maxCount int) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	switch {
+	case db.opts.flags.immutable:
+		return errImmutable
+	case len(pattern) == 0:
+		return errTopicEmpty
+	case len(pattern) > maxTopicLength:
+		return errTopicTooLarge
+	case maxAge < 0 || maxCount < 0:
+		return errBadRequest
+	}
+	if err := db.authorize(message.MasterContract, pattern, OpDelete); err != nil {
+		return err
+	}
+	if _, _, err := db.parseTopic(message.MasterContract, pattern); err != nil {
+		return err
+	}
+	return db.internal.retention.set(_RetentionPolicy{contract: message.MasterContract, pattern: string(pattern), maxAge: maxAge, maxCount: maxCount})
+}
+
+func (db *DB) startRetention(interval time.Duration) {
+	retentionTicker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-retentionTicker.C:
+				if err := db.applyRetention(); err != nil {
+					logger.Error().Err(err).Str("context", "db.applyRetention")
+				}
+			case <-db.internal.closeC:
+				retentionTicker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// applyRetention deletes the entries of the topics matching the retention policies past the policy.
+func (db *DB) applyRetention() error {
+	policies := db.internal.retention.snapshot()
+	if len(policies) == 0 {
+		return nil
+	}
+	// retention is a maintenance operation and it yields the sync lock to foreground sync.
+	if !db.internal.syncLock.lockMaintenance(db.internal.closeC) {
+		return nil
+	}
+	defer db.internal.syncLock.unlock()
+	for _, p := range policies {
+		parts, _ := db.opts.topicSeparator.SplitTopic([]byte(p.pattern))
+		for _, topic := range db.internal.trie.match(p.contract, parts) {
+			if p.maxAge > 0 {
+				if err := db.deleteRange(topic.hash, p.contract, 0, time.Now().Add(-p.maxAge).Unix()); err != nil {
+					return err
+				}
+			}
+			if p.maxCount > 0 {
+				if err := db.trimTopic(topic.hash, p.maxCount); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
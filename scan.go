@@ -0,0 +1,173 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/uid"
+)
+
+// _ScanEntry is the topic, the contract and the expiry of an entry found in the window file.
+type _ScanEntry struct {
+	topicHash uint64
+	contract  uint32
+	expiresAt uint32
+}
+
+// _ScanTopic is the contract of a topic found in the window file and whether the contract is scanned.
+type _ScanTopic struct {
+	contract uint32
+	ok       bool
+}
+
+// ScanContract calls fn for each entry of the contract stored in the DB files in the order of sequence
+// until fn returns false. The window file and the index file are read sequentially rather than following
+// the window blocks of each topic, so it is suited for exports, scans and migrations of all entries of a
+// contract where the order of the entries of a topic does not matter. Entries not yet synced, deleted and
+// expired entries are not scanned, call Sync before the scan to include the entries put recently.
+func (db *DB) ScanContract(contract uint32, fn func(Message) bool) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if err := db.authorize(contract, nil, OpGet); err != nil {
+		return err
+	}
+	entries, err := db.scanWindow(func(c uint32) bool { return c == contract })
+	if err != nil {
+		return err
+	}
+	return db.scanIndex(entries, func(_ _IndexEntry, m Message) bool { return fn(m) })
+}
+
+// scanWindow collects the sequences of the entries of the topics of the contracts matching the predicate
+// from the window file. The window file is read under the sync lock as sync writes the window blocks past
+// the blocks committed.
+func (db *DB) scanWindow(match func(contract uint32) bool) (map[uint64]_ScanEntry, error) {
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+
+	entries := make(map[uint64]_ScanEntry)
+	r := newWindowReader(db.fs)
+	if r.winFile == nil {
+		return entries, nil
+	}
+	topics := make(map[uint64]_ScanTopic)
+	for windowIdx := int32(0); windowIdx <= r.windowIdx; windowIdx++ {
+		r.offset = winBlockOffset(windowIdx)
+		b, err := r.readWindowBlock()
+		if err != nil {
+			break
+		}
+		if b.entryIdx == 0 {
+			continue
+		}
+		t, seen := topics[b.topicHash]
+		if !seen {
+			c, _, found := db.internal.trie.topicName(b.topicHash)
+			t = _ScanTopic{contract: c, ok: found && match(c)}
+			topics[b.topicHash] = t
+		}
+		if !t.ok {
+			continue
+		}
+		for i := 0; i < int(b.entryIdx) && i < entriesPerWindowBlock; i++ {
+			if we := b.entries[i]; we.seq() != 0 {
+				entries[we.seq()] = _ScanEntry{topicHash: b.topicHash, contract: t.contract, expiresAt: we.expiryTime()}
+			}
+		}
+	}
+	return entries, nil
+}
+
+// scanIndex reads the index file sequentially and calls fn for each entry collected from the window file
+// in the order of sequence until fn returns false. Chunks of the messages are not passed to fn.
+func (db *DB) scanIndex(entries map[uint64]_ScanEntry, fn func(e _IndexEntry, m Message) bool) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	r := newBlockReader(db.fs)
+	if r == nil || r.indexFile == nil {
+		return nil
+	}
+	nBlocks := int32(r.indexFile.currSize() / int64(blockSize))
+	for bIdx := int32(0); bIdx < nBlocks; bIdx++ {
+		if err := db.ok(); err != nil {
+			return err
+		}
+		r.offset = blockOffset(bIdx)
+		b, err := r.readIndexBlock()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < entriesPerIndexBlock; i++ {
+			e := b.entries[i]
+			se, ok := entries[e.seq]
+			// deleted entries packing the topic are kept with zero value size.
+			if e.seq == 0 || e.msgOffset == -1 || e.valueSize == 0 || !ok {
+				continue
+			}
+			if se.expiresAt != 0 && se.expiresAt <= uint32(time.Now().Unix()) {
+				continue
+			}
+			m, ok, err := db.scanMessage(r, e, se)
+			if err != nil {
+				return err
+			}
+			if ok && !fn(e, m) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// scanMessage reads the message of the entry. It returns false if the entry is a chunk of a message.
+func (db *DB) scanMessage(r *_BlockReader, e _IndexEntry, se _ScanEntry) (Message, bool, error) {
+	id, val, err := r.readMessage(e)
+	if err != nil {
+		return Message{}, false, err
+	}
+	msgID := make(message.ID, message.ID(nil).Size())
+	copy(msgID, id[:idSize-1])
+	binary.LittleEndian.PutUint64(msgID[8:16], e.seq)
+	if !msgID.EvalPrefix(se.contract, 0) {
+		// chunks of a message are stored under the salted contract of the message.
+		return Message{}, false, nil
+	}
+	_, topic, _ := db.internal.trie.topicName(se.topicHash)
+	payload, codec, err := db.decodeValue(id, val)
+	if err != nil {
+		return Message{}, false, err
+	}
+	m := Message{
+		ID:        msgID,
+		Topic:     topic,
+		Contract:  se.contract,
+		Payload:   payload,
+		Headers:   contentHeaders(codec, nil),
+		StoredAt:  time.Unix(uid.Time(msgID[0:4]), 0),
+		ExpiresAt: se.expiresAt,
+		Token:     newToken(e.seq, se.topicHash),
+	}
+	return m, true, nil
+}
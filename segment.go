@@ -0,0 +1,397 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+// Segment files hold the messages of a topic stored in a time partition sorted by sequence. These are
+// written by ExportSegments and are immutable, so analytics engines read the historical messages without
+// the DB. The format of the segment file is described in docs/segment-format.md.
+const (
+	segmentMagic         = "unitdbsg"
+	segmentVersion       = 1
+	segmentBlockSize     = 64 << 10 // data block is cut after the record crossing the block size.
+	segmentFilterBitsKey = 10       // number of filter bits per message.
+	segmentFilterHashes  = 7
+	segmentRecordSize    = 8 + 16 + 8 + 4 + 4 // seq, ID, stored at, expires at and payload size.
+	segmentIndexSize     = 8 + 8 + 8 + 4 + 4  // first seq, last seq, offset, size and records.
+	segmentFooterSize    = 8 + 8 + 8 + 4 + len(segmentMagic)
+)
+
+type (
+	// ExportReport is the result of exporting the messages of a contract to segment files.
+	ExportReport struct {
+		Segments int   // Number of segment files written.
+		Messages int64 // Number of messages exported.
+		Bytes    int64 // Total size in bytes of the segment files.
+	}
+
+	_SegmentBlock struct {
+		firstSeq uint64
+		lastSeq  uint64
+		offset   int64
+		size     uint32
+		records  uint32
+	}
+
+	// _SegmentWriter writes a segment file to a temporary file renamed to the segment file on close.
+	_SegmentWriter struct {
+		path   string
+		f      *os.File
+		w      *bufio.Writer
+		crc    uint32
+		off    int64
+		block  []byte
+		blocks []_SegmentBlock
+		seqs   []uint64
+	}
+)
+
+// ExportSegments writes the messages of the contract stored in the DB files to segment files in the dir, a
+// segment file per topic and time partition of the time messages are stored. Messages of a segment are sorted
+// by sequence in data blocks followed by the block index and the filter of the sequences of the messages.
+// A zero partition exports the messages of a topic to a single segment. Segment files are named using the
+// topic hash and the start time of the partition, existing segment files are replaced. Entries not yet synced,
+// deleted and expired entries are not exported, call Sync before the export to include the entries put recently.
+func (db *DB) ExportSegments(dir string, contract uint32, partition time.Duration) (*ExportReport, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if err := db.authorize(contract, nil, OpGet); err != nil {
+		return nil, err
+	}
+	if err := ensureDir(dir); err != nil {
+		return nil, err
+	}
+	entries, err := db.scanWindow(func(c uint32) bool { return c == contract })
+	if err != nil {
+		return nil, err
+	}
+	topics := make(map[uint64][]uint64)
+	for seq, se := range entries {
+		topics[se.topicHash] = append(topics[se.topicHash], seq)
+	}
+	hashes := make([]uint64, 0, len(topics))
+	for h := range topics {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	report := &ExportReport{}
+	r := newBlockReader(db.fs)
+	for _, h := range hashes {
+		if err := db.exportTopic(dir, r, entries, h, topics[h], partition, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// exportTopic writes the messages of the topic to the segment files of their partitions.
+func (db *DB) exportTopic(dir string, r *_BlockReader, entries map[uint64]_ScanEntry, topicHash uint64, seqs []uint64, partition time.Duration, report *ExportReport) (err error) {
+	writers := make(map[int64]*_SegmentWriter)
+	defer func() {
+		for _, w := range writers {
+			w.abort()
+		}
+	}()
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	now := uint32(time.Now().Unix())
+	for _, seq := range seqs {
+		if err := db.ok(); err != nil {
+			return err
+		}
+		se := entries[seq]
+		if se.expiresAt != 0 && se.expiresAt <= now {
+			continue
+		}
+		e, err := r.readEntry(seq)
+		if err == errMsgIDDeleted || err == errEntryInvalid {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		m, ok, err := db.scanMessage(r, e, se)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var from, to time.Time
+		if partition > 0 {
+			from = m.StoredAt.Truncate(partition)
+			to = from.Add(partition)
+		}
+		w, ok := writers[from.Unix()]
+		if !ok {
+			name := fmt.Sprintf("%016x-%d.seg", topicHash, from.Unix())
+			if partition == 0 {
+				name = fmt.Sprintf("%016x.seg", topicHash)
+			}
+			if w, err = newSegmentWriter(filepath.Join(dir, name), se.contract, m.Topic, from, to); err != nil {
+				return err
+			}
+			writers[from.Unix()] = w
+		}
+		if err := w.append(seq, m); err != nil {
+			return err
+		}
+	}
+	for start, w := range writers {
+		size, err := w.close()
+		if err != nil {
+			return err
+		}
+		delete(writers, start)
+		report.Segments++
+		report.Messages += int64(len(w.seqs))
+		report.Bytes += size
+	}
+	return nil
+}
+
+// newSegmentWriter creates the segment file and writes the header of the segment.
+func newSegmentWriter(path string, contract uint32, topic []byte, from, to time.Time) (*_SegmentWriter, error) {
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	w := &_SegmentWriter{path: path, f: f, w: bufio.NewWriter(f)}
+	var fromUnix, toUnix int64
+	if !from.IsZero() {
+		fromUnix, toUnix = from.Unix(), to.Unix()
+	}
+	hdr := make([]byte, len(segmentMagic)+4+4+2+len(topic)+8+8)
+	n := copy(hdr, segmentMagic)
+	binary.LittleEndian.PutUint32(hdr[n:], segmentVersion)
+	binary.LittleEndian.PutUint32(hdr[n+4:], contract)
+	binary.LittleEndian.PutUint16(hdr[n+8:], uint16(len(topic)))
+	n += 10 + copy(hdr[n+10:], topic)
+	binary.LittleEndian.PutUint64(hdr[n:], uint64(fromUnix))
+	binary.LittleEndian.PutUint64(hdr[n+8:], uint64(toUnix))
+	if err := w.write(hdr); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *_SegmentWriter) write(b []byte) error {
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, b)
+	n, err := w.w.Write(b)
+	w.off += int64(n)
+	return err
+}
+
+// append appends the message to the data block, the block is written once it reaches the block size.
+func (w *_SegmentWriter) append(seq uint64, m Message) error {
+	if len(w.block) == 0 {
+		w.blocks = append(w.blocks, _SegmentBlock{firstSeq: seq, offset: w.off})
+	}
+	var rec [segmentRecordSize]byte
+	binary.LittleEndian.PutUint64(rec[0:8], seq)
+	copy(rec[8:24], m.ID)
+	binary.LittleEndian.PutUint64(rec[24:32], uint64(m.StoredAt.Unix()))
+	binary.LittleEndian.PutUint32(rec[32:36], m.ExpiresAt)
+	binary.LittleEndian.PutUint32(rec[36:40], uint32(len(m.Payload)))
+	w.block = append(append(w.block, rec[:]...), m.Payload...)
+	b := &w.blocks[len(w.blocks)-1]
+	b.lastSeq = seq
+	b.records++
+	w.seqs = append(w.seqs, seq)
+	if len(w.block) >= segmentBlockSize {
+		return w.writeBlock()
+	}
+	return nil
+}
+
+func (w *_SegmentWriter) writeBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	w.blocks[len(w.blocks)-1].size = uint32(len(w.block))
+	err := w.write(w.block)
+	w.block = w.block[:0]
+	return err
+}
+
+// close writes the block index, the filter and the footer of the segment and renames the
+// segment file into place. It returns the size of the segment file.
+func (w *_SegmentWriter) close() (int64, error) {
+	if err := w.writeBlock(); err != nil {
+		w.abort()
+		return 0, err
+	}
+	indexOff := w.off
+	index := make([]byte, 4+segmentIndexSize*len(w.blocks))
+	binary.LittleEndian.PutUint32(index[0:4], uint32(len(w.blocks)))
+	for i, b := range w.blocks {
+		buf := index[4+i*segmentIndexSize:]
+		binary.LittleEndian.PutUint64(buf[0:8], b.firstSeq)
+		binary.LittleEndian.PutUint64(buf[8:16], b.lastSeq)
+		binary.LittleEndian.PutUint64(buf[16:24], uint64(b.offset))
+		binary.LittleEndian.PutUint32(buf[24:28], b.size)
+		binary.LittleEndian.PutUint32(buf[28:32], b.records)
+	}
+	filterOff := indexOff + int64(len(index))
+	footer := make([]byte, segmentFooterSize)
+	binary.LittleEndian.PutUint64(footer[0:8], uint64(indexOff))
+	binary.LittleEndian.PutUint64(footer[8:16], uint64(filterOff))
+	binary.LittleEndian.PutUint64(footer[16:24], uint64(len(w.seqs)))
+	for _, b := range [][]byte{index, newSegmentFilter(w.seqs), footer[:24]} {
+		if err := w.write(b); err != nil {
+			w.abort()
+			return 0, err
+		}
+	}
+	// the checksum covers the segment up to the checksum.
+	binary.LittleEndian.PutUint32(footer[24:28], w.crc)
+	copy(footer[28:], segmentMagic)
+	if _, err := w.w.Write(footer[24:]); err != nil {
+		w.abort()
+		return 0, err
+	}
+	size := w.off + int64(len(footer)-24)
+	if err := w.w.Flush(); err != nil {
+		w.abort()
+		return 0, err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.abort()
+		return 0, err
+	}
+	if err := w.f.Close(); err != nil {
+		os.Remove(w.path + ".tmp")
+		return 0, err
+	}
+	return size, os.Rename(w.path+".tmp", w.path)
+}
+
+// abort closes and removes the temporary file of the segment.
+func (w *_SegmentWriter) abort() {
+	w.f.Close()
+	os.Remove(w.path + ".tmp")
+}
+
+// segmentFilterBit returns the bit of the filter of m bits set for the sequence by the i-th hash.
+func segmentFilterBit(seq uint64, i int, m uint64) uint64 {
+	h1 := seq * 0x9e3779b97f4a7c15
+	h2 := (seq^(seq>>33))*0xc2b2ae3d27d4eb4f | 1
+	return (h1 + uint64(i)*h2) % m
+}
+
+// newSegmentFilter returns the bloom filter of the sequences, the number of bits and the number
+// of hashes of the filter followed by the bits of the filter.
+func newSegmentFilter(seqs []uint64) []byte {
+	m := uint64(len(seqs)*segmentFilterBitsKey+63) / 64 * 64
+	if m == 0 {
+		m = 64
+	}
+	filter := make([]byte, 8+m/8)
+	binary.LittleEndian.PutUint32(filter[0:4], uint32(m))
+	binary.LittleEndian.PutUint32(filter[4:8], segmentFilterHashes)
+	bits := filter[8:]
+	for _, seq := range seqs {
+		for i := 0; i < segmentFilterHashes; i++ {
+			bit := segmentFilterBit(seq, i, m)
+			bits[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return filter
+}
+
+// ReadSegment reads the segment file written by ExportSegments and calls fn for each message of the
+// segment in the order of sequence until fn returns false. The segment file is read into memory and its
+// checksum is verified before the messages are read.
+func ReadSegment(path string, fn func(Message) bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	hdrSize := len(segmentMagic) + 10
+	if len(data) < hdrSize+16+segmentFooterSize || !bytes.Equal(data[:len(segmentMagic)], []byte(segmentMagic)) ||
+		!bytes.Equal(data[len(data)-len(segmentMagic):], []byte(segmentMagic)) {
+		return errCorrupted
+	}
+	footer := data[len(data)-segmentFooterSize:]
+	if crc32.ChecksumIEEE(data[:len(data)-segmentFooterSize+24]) != binary.LittleEndian.Uint32(footer[24:28]) {
+		return errCorrupted
+	}
+	if binary.LittleEndian.Uint32(data[8:12]) != segmentVersion {
+		return errBadRequest
+	}
+	contract := binary.LittleEndian.Uint32(data[12:16])
+	topicSize := int(binary.LittleEndian.Uint16(data[16:18]))
+	if hdrSize+topicSize+16 > len(data) {
+		return errCorrupted
+	}
+	topic := data[hdrSize : hdrSize+topicSize]
+	indexOff := binary.LittleEndian.Uint64(footer[0:8])
+	if indexOff+4 > uint64(len(data)) {
+		return errCorrupted
+	}
+	nBlocks := int(binary.LittleEndian.Uint32(data[indexOff:]))
+	index := data[indexOff+4:]
+	if len(index) < nBlocks*segmentIndexSize {
+		return errCorrupted
+	}
+	for i := 0; i < nBlocks; i++ {
+		buf := index[i*segmentIndexSize:]
+		off, size := binary.LittleEndian.Uint64(buf[16:24]), uint64(binary.LittleEndian.Uint32(buf[24:28]))
+		if off+size > indexOff {
+			return errCorrupted
+		}
+		block := data[off : off+size]
+		for len(block) >= segmentRecordSize {
+			n := segmentRecordSize + int(binary.LittleEndian.Uint32(block[36:40]))
+			if n > len(block) {
+				return errCorrupted
+			}
+			m := Message{
+				ID:        append([]byte(nil), block[8:24]...),
+				Topic:     topic,
+				Contract:  contract,
+				Payload:   block[segmentRecordSize:n],
+				StoredAt:  time.Unix(int64(binary.LittleEndian.Uint64(block[24:32])), 0),
+				ExpiresAt: binary.LittleEndian.Uint32(block[32:36]),
+			}
+			if !fn(m) {
+				return nil
+			}
+			block = block[n:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package auth authenticates the clients of the server frontends and authorizes their requests.
+// Contracts isolate the data of the tenants, an Auth restricts the contracts and the operations
+// a client is allowed to use, so a client cannot use the contract of another tenant.
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+
+	"github.com/unit-io/unitdb"
+)
+
+var errUnauthenticated = errors.New("token is invalid")
+
+type (
+	// Conn is the connection of a client to a server frontend.
+	Conn interface {
+		// RemoteAddr returns the address of the client, it is nil if the frontend does not know the address.
+		RemoteAddr() net.Addr
+		// Token returns the token presented by the client, i.e. the bearer token of an HTTP or gRPC
+		// request or the token sent in the connect packet.
+		Token() []byte
+	}
+
+	// Principal is the identity of an authenticated client.
+	Principal struct {
+		Name string
+		// Contracts the principal is allowed to use, all contracts are allowed if empty.
+		Contracts []uint32
+		// ReadOnly allows only get operations.
+		ReadOnly bool
+	}
+
+	// Auth authenticates the clients and authorizes their requests.
+	Auth interface {
+		// Authenticate returns the principal of the client on the connection or an error if the client is not authenticated.
+		Authenticate(c Conn) (Principal, error)
+		// Authorize reports whether the principal is allowed the operation on the topic of the contract.
+		Authorize(p Principal, contract uint32, topic []byte, op unitdb.Op) bool
+	}
+
+	// Token maps a static token to the principal.
+	Token struct {
+		Token     string   `json:"token"`
+		Name      string   `json:"name"`
+		Contracts []uint32 `json:"contracts,omitempty"`
+		ReadOnly  bool     `json:"read_only,omitempty"`
+	}
+
+	_StaticTokens struct {
+		tokens []Token
+	}
+)
+
+// HasContract reports whether the principal is allowed to use the contract.
+func (p Principal) HasContract(contract uint32) bool {
+	if len(p.Contracts) == 0 {
+		return true
+	}
+	for _, c := range p.Contracts {
+		if c == contract {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStaticTokens returns the default Auth authenticating the clients presenting one of the tokens.
+// A client is authorized to use the contracts of its token, or all contracts if the token has no contracts.
+func NewStaticTokens(tokens []Token) Auth {
+	return &_StaticTokens{tokens: tokens}
+}
+
+// Authenticate returns the principal of the token presented by the client.
+func (a *_StaticTokens) Authenticate(c Conn) (Principal, error) {
+	token := c.Token()
+	if len(token) == 0 {
+		return Principal{}, errUnauthenticated
+	}
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), token) == 1 {
+			return Principal{Name: t.Name, Contracts: t.Contracts, ReadOnly: t.ReadOnly}, nil
+		}
+	}
+	return Principal{}, errUnauthenticated
+}
+
+// Authorize reports whether the principal is allowed to use the contract and the operation.
+func (a *_StaticTokens) Authorize(p Principal, contract uint32, topic []byte, op unitdb.Op) bool {
+	if p.ReadOnly && op != unitdb.OpGet {
+		return false
+	}
+	return p.HasContract(contract)
+}
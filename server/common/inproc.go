@@ -0,0 +1,106 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var (
+	errInProcExists   = errors.New("inproc: listener already exists")
+	errInProcNotFound = errors.New("inproc: listener not found")
+	errInProcClosed   = errors.New("inproc: listener closed")
+
+	inprocMu        sync.Mutex
+	inprocListeners = make(map[string]*InProcListener)
+)
+
+// InProcListener implements net.Listener for in-process transport. Connections are
+// in-memory pipes, so co-located clients and tests can talk to the server without TCP
+// overhead or port allocation.
+type InProcListener struct {
+	name    string
+	connC   chan net.Conn
+	closeC  chan struct{}
+	closeMu sync.Once
+}
+
+type inprocAddr string
+
+func (a inprocAddr) Network() string { return "inproc" }
+func (a inprocAddr) String() string  { return string(a) }
+
+// ListenInProc announces in-process listener with the name.
+func ListenInProc(name string) (*InProcListener, error) {
+	inprocMu.Lock()
+	defer inprocMu.Unlock()
+	if _, ok := inprocListeners[name]; ok {
+		return nil, errInProcExists
+	}
+	l := &InProcListener{
+		name:   name,
+		connC:  make(chan net.Conn),
+		closeC: make(chan struct{}),
+	}
+	inprocListeners[name] = l
+	return l, nil
+}
+
+// DialInProc connects to in-process listener with the name.
+func DialInProc(name string) (net.Conn, error) {
+	inprocMu.Lock()
+	l, ok := inprocListeners[name]
+	inprocMu.Unlock()
+	if !ok {
+		return nil, errInProcNotFound
+	}
+	server, client := net.Pipe()
+	select {
+	case l.connC <- server:
+		return client, nil
+	case <-l.closeC:
+		return nil, errInProcClosed
+	}
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (l *InProcListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.connC:
+		return c, nil
+	case <-l.closeC:
+		return nil, errInProcClosed
+	}
+}
+
+// Close closes the listener.
+func (l *InProcListener) Close() error {
+	l.closeMu.Do(func() {
+		close(l.closeC)
+		inprocMu.Lock()
+		delete(inprocListeners, l.name)
+		inprocMu.Unlock()
+	})
+	return nil
+}
+
+// Addr returns the listener's network address.
+func (l *InProcListener) Addr() net.Addr {
+	return inprocAddr(l.name)
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import "github.com/unit-io/unitdb/server/auth"
+
+// Options it contains configurable options of the server.
+type Options interface {
+	set(*_Options)
+}
+
+type _Options struct {
+	// auth if set authenticates the clients and authorizes their requests.
+	auth auth.Auth
+}
+
+// fOption wraps a function that modifies options into an
+// implementation of the Options interface.
+type fOption struct {
+	f func(*_Options)
+}
+
+func (fo *fOption) set(o *_Options) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*_Options)) *fOption {
+	return &fOption{
+		f: f,
+	}
+}
+
+// WithAuth sets auth to authenticate the clients using the bearer token of the "authorization" metadata of the request and authorize their requests.
+func WithAuth(a auth.Auth) Options {
+	return newFuncOption(func(o *_Options) {
+		o.auth = a
+	})
+}
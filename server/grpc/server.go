@@ -0,0 +1,265 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpc exposes a unitdb database as the versioned Unitdb gRPC service defined in unitdb_v1.proto,
+// so clients in any language can access the database over the network.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/unit-io/unitdb"
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/server/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errEntryEmpty = errors.New("entry is empty")
+	errForbidden  = errors.New("operation is not allowed")
+)
+
+// Server implements the Unitdb service using the database.
+type Server struct {
+	db   *unitdb.DB
+	opts *_Options
+}
+
+// NewServer creates a server serving the Unitdb service using the database. Register the server
+// to a gRPC server using RegisterUnitdbServer.
+func NewServer(db *unitdb.DB, opts ...Options) *Server {
+	s := &Server{db: db, opts: &_Options{}}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(s.opts)
+		}
+	}
+	return s
+}
+
+// Put puts the payload to the topic.
+func (s *Server) Put(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+	if err := s.authorize(ctx, 0, req.Topic, unitdb.OpPut); err != nil {
+		return nil, err
+	}
+	if err := s.db.PutContext(ctx, req.Topic, req.Payload); err != nil {
+		return nil, err
+	}
+	return &PutResponse{}, nil
+}
+
+// PutEntry puts the entry.
+func (s *Server) PutEntry(ctx context.Context, req *PutEntryRequest) (*PutResponse, error) {
+	if req.Entry == nil {
+		return nil, errEntryEmpty
+	}
+	if err := s.authorize(ctx, req.Entry.Contract, req.Entry.Topic, unitdb.OpPut); err != nil {
+		return nil, err
+	}
+	if err := s.db.PutEntryContext(ctx, newEntry(req.Entry)); err != nil {
+		return nil, err
+	}
+	return &PutResponse{}, nil
+}
+
+// Get returns the payloads matching the topic.
+func (s *Server) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	if err := s.authorize(ctx, req.Contract, req.Topic, unitdb.OpGet); err != nil {
+		return nil, err
+	}
+	q := unitdb.NewQuery(req.Topic).WithContract(req.Contract)
+	if req.Limit > 0 {
+		q.WithLimit(int(req.Limit))
+	}
+	items, err := s.db.GetContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &GetResponse{Payloads: items}, nil
+}
+
+// Delete deletes the entry with the ID.
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	if err := s.authorize(ctx, req.Contract, req.Topic, unitdb.OpDelete); err != nil {
+		return nil, err
+	}
+	e := unitdb.NewEntry(req.Topic, nil).WithID(req.Id).WithContract(req.Contract)
+	if err := s.db.DeleteEntry(e); err != nil {
+		return nil, err
+	}
+	return &DeleteResponse{}, nil
+}
+
+// Batch puts and deletes the entries in a single batch, the batch is rolled back if any of the entries fails.
+func (s *Server) Batch(ctx context.Context, req *BatchRequest) (*BatchResponse, error) {
+	for _, e := range req.Puts {
+		if err := s.authorize(ctx, e.Contract, e.Topic, unitdb.OpPut); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range req.Deletes {
+		if err := s.authorize(ctx, e.Contract, e.Topic, unitdb.OpDelete); err != nil {
+			return nil, err
+		}
+	}
+	err := s.db.Batch(func(b *unitdb.Batch, completed <-chan struct{}) error {
+		for _, e := range req.Puts {
+			if err := b.PutEntry(newEntry(e)); err != nil {
+				return err
+			}
+		}
+		for _, e := range req.Deletes {
+			if err := b.DeleteEntry(newEntry(e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BatchResponse{}, nil
+}
+
+// NewContract generates a new contract.
+func (s *Server) NewContract(ctx context.Context, req *NewContractRequest) (*NewContractResponse, error) {
+	if _, err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	contract, err := s.db.NewContract()
+	if err != nil {
+		return nil, err
+	}
+	return &NewContractResponse{Contract: contract}, nil
+}
+
+// Subscribe streams the messages put to the topic until the client cancels the subscription. A client
+// resumes the subscription using the token of the last message received, also if the subscription
+// ends with ResourceExhausted as the client fell behind.
+func (s *Server) Subscribe(req *SubscribeRequest, stream Unitdb_SubscribeServer) error {
+	if err := s.authorize(stream.Context(), req.Contract, req.Topic, unitdb.OpGet); err != nil {
+		return err
+	}
+	opts := []unitdb.WatchOption{unitdb.WithWatchContract(req.Contract)}
+	if len(req.From) > 0 {
+		opts = append(opts, unitdb.WithWatchFrom(req.From))
+	}
+	msgs, cancel, err := s.db.Watch(req.Topic, opts...)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case m, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			if m.Err != nil {
+				return status.Error(codes.ResourceExhausted, m.Err.Error())
+			}
+			if err := stream.Send(&Message{
+				Id:        m.ID,
+				Topic:     m.Topic,
+				Contract:  m.Contract,
+				Payload:   m.Payload,
+				StoredAt:  m.StoredAt.Unix(),
+				ExpiresAt: m.ExpiresAt,
+				Token:     m.Token,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// _Conn is the connection of the client of a request.
+type _Conn struct {
+	ctx context.Context
+}
+
+// RemoteAddr returns the address of the client.
+func (c _Conn) RemoteAddr() net.Addr {
+	if p, ok := peer.FromContext(c.ctx); ok {
+		return p.Addr
+	}
+	return nil
+}
+
+// Token returns the bearer token of the "authorization" metadata of the request.
+func (c _Conn) Token() []byte {
+	md, ok := metadata.FromIncomingContext(c.ctx)
+	if !ok {
+		return nil
+	}
+	vals := md.Get("authorization")
+	if len(vals) == 0 {
+		return nil
+	}
+	return []byte(strings.TrimPrefix(vals[0], "Bearer "))
+}
+
+// authenticate returns the principal of the client of the request.
+func (s *Server) authenticate(ctx context.Context) (auth.Principal, error) {
+	if s.opts.auth == nil {
+		return auth.Principal{}, nil
+	}
+	p, err := s.opts.auth.Authenticate(_Conn{ctx: ctx})
+	if err != nil {
+		return p, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return p, nil
+}
+
+// authorize authenticates the client of the request and authorizes the operation on the topic of the contract.
+func (s *Server) authorize(ctx context.Context, contract uint32, topic []byte, op unitdb.Op) error {
+	if s.opts.auth == nil {
+		return nil
+	}
+	p, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if !s.opts.auth.Authorize(p, contract, topic, op) {
+		return status.Error(codes.PermissionDenied, errForbidden.Error())
+	}
+	return nil
+}
+
+func newEntry(e *Entry) *unitdb.Entry {
+	entry := unitdb.NewEntry(e.Topic, e.Payload).WithContract(e.Contract)
+	if len(e.Id) > 0 {
+		entry.WithID(e.Id)
+	}
+	if e.Encryption {
+		entry.WithEncryption()
+	}
+	entry.ExpiresAt = e.ExpiresAt
+	return entry
+}
+
+var _ UnitdbServer = (*Server)(nil)
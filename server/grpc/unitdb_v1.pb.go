@@ -0,0 +1,1227 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: unitdb_v1.proto
+
+package grpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Entry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            []byte                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Topic         []byte                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Payload       []byte                 `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Contract      uint32                 `protobuf:"varint,4,opt,name=contract,proto3" json:"contract,omitempty"`
+	ExpiresAt     uint32                 `protobuf:"varint,5,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Encryption    bool                   `protobuf:"varint,6,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Entry) Reset() {
+	*x = Entry{}
+	mi := &file_unitdb_v1_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Entry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Entry) ProtoMessage() {}
+
+func (x *Entry) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Entry.ProtoReflect.Descriptor instead.
+func (*Entry) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Entry) GetId() []byte {
+	if x != nil {
+		return x.Id
+	}
+	return nil
+}
+
+func (x *Entry) GetTopic() []byte {
+	if x != nil {
+		return x.Topic
+	}
+	return nil
+}
+
+func (x *Entry) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Entry) GetContract() uint32 {
+	if x != nil {
+		return x.Contract
+	}
+	return 0
+}
+
+func (x *Entry) GetExpiresAt() uint32 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *Entry) GetEncryption() bool {
+	if x != nil {
+		return x.Encryption
+	}
+	return false
+}
+
+type PutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topic         []byte                 `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Payload       []byte                 `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutRequest) Reset() {
+	*x = PutRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutRequest) ProtoMessage() {}
+
+func (x *PutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutRequest.ProtoReflect.Descriptor instead.
+func (*PutRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PutRequest) GetTopic() []byte {
+	if x != nil {
+		return x.Topic
+	}
+	return nil
+}
+
+func (x *PutRequest) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type PutEntryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entry         *Entry                 `protobuf:"bytes,1,opt,name=entry,proto3" json:"entry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutEntryRequest) Reset() {
+	*x = PutEntryRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutEntryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutEntryRequest) ProtoMessage() {}
+
+func (x *PutEntryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutEntryRequest.ProtoReflect.Descriptor instead.
+func (*PutEntryRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PutEntryRequest) GetEntry() *Entry {
+	if x != nil {
+		return x.Entry
+	}
+	return nil
+}
+
+type PutResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutResponse) Reset() {
+	*x = PutResponse{}
+	mi := &file_unitdb_v1_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutResponse) ProtoMessage() {}
+
+func (x *PutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutResponse.ProtoReflect.Descriptor instead.
+func (*PutResponse) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{3}
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topic         []byte                 `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Contract      uint32                 `protobuf:"varint,2,opt,name=contract,proto3" json:"contract,omitempty"`
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetRequest) GetTopic() []byte {
+	if x != nil {
+		return x.Topic
+	}
+	return nil
+}
+
+func (x *GetRequest) GetContract() uint32 {
+	if x != nil {
+		return x.Contract
+	}
+	return 0
+}
+
+func (x *GetRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Payloads      [][]byte               `protobuf:"bytes,1,rep,name=payloads,proto3" json:"payloads,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_unitdb_v1_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetResponse) GetPayloads() [][]byte {
+	if x != nil {
+		return x.Payloads
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            []byte                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Topic         []byte                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Contract      uint32                 `protobuf:"varint,3,opt,name=contract,proto3" json:"contract,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteRequest) GetId() []byte {
+	if x != nil {
+		return x.Id
+	}
+	return nil
+}
+
+func (x *DeleteRequest) GetTopic() []byte {
+	if x != nil {
+		return x.Topic
+	}
+	return nil
+}
+
+func (x *DeleteRequest) GetContract() uint32 {
+	if x != nil {
+		return x.Contract
+	}
+	return 0
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_unitdb_v1_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{7}
+}
+
+type BatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Puts          []*Entry               `protobuf:"bytes,1,rep,name=puts,proto3" json:"puts,omitempty"`
+	Deletes       []*Entry               `protobuf:"bytes,2,rep,name=deletes,proto3" json:"deletes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BatchRequest) GetPuts() []*Entry {
+	if x != nil {
+		return x.Puts
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetDeletes() []*Entry {
+	if x != nil {
+		return x.Deletes
+	}
+	return nil
+}
+
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_unitdb_v1_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{9}
+}
+
+type NewContractRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NewContractRequest) Reset() {
+	*x = NewContractRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NewContractRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewContractRequest) ProtoMessage() {}
+
+func (x *NewContractRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewContractRequest.ProtoReflect.Descriptor instead.
+func (*NewContractRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{10}
+}
+
+type NewContractResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Contract      uint32                 `protobuf:"varint,1,opt,name=contract,proto3" json:"contract,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NewContractResponse) Reset() {
+	*x = NewContractResponse{}
+	mi := &file_unitdb_v1_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NewContractResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewContractResponse) ProtoMessage() {}
+
+func (x *NewContractResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewContractResponse.ProtoReflect.Descriptor instead.
+func (*NewContractResponse) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *NewContractResponse) GetContract() uint32 {
+	if x != nil {
+		return x.Contract
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topic         []byte                 `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Contract      uint32                 `protobuf:"varint,2,opt,name=contract,proto3" json:"contract,omitempty"`
+	From          []byte                 `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_unitdb_v1_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SubscribeRequest) GetTopic() []byte {
+	if x != nil {
+		return x.Topic
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetContract() uint32 {
+	if x != nil {
+		return x.Contract
+	}
+	return 0
+}
+
+func (x *SubscribeRequest) GetFrom() []byte {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            []byte                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Topic         []byte                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Contract      uint32                 `protobuf:"varint,3,opt,name=contract,proto3" json:"contract,omitempty"`
+	Payload       []byte                 `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	StoredAt      int64                  `protobuf:"varint,5,opt,name=stored_at,json=storedAt,proto3" json:"stored_at,omitempty"`
+	ExpiresAt     uint32                 `protobuf:"varint,6,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Token         []byte                 `protobuf:"bytes,7,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_unitdb_v1_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_unitdb_v1_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_unitdb_v1_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Message) GetId() []byte {
+	if x != nil {
+		return x.Id
+	}
+	return nil
+}
+
+func (x *Message) GetTopic() []byte {
+	if x != nil {
+		return x.Topic
+	}
+	return nil
+}
+
+func (x *Message) GetContract() uint32 {
+	if x != nil {
+		return x.Contract
+	}
+	return 0
+}
+
+func (x *Message) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Message) GetStoredAt() int64 {
+	if x != nil {
+		return x.StoredAt
+	}
+	return 0
+}
+
+func (x *Message) GetExpiresAt() uint32 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *Message) GetToken() []byte {
+	if x != nil {
+		return x.Token
+	}
+	return nil
+}
+
+var File_unitdb_v1_proto protoreflect.FileDescriptor
+
+const file_unitdb_v1_proto_rawDesc = "" +
+	"\n" +
+	"\x0funitdb_v1.proto\x12\tunitdb.v1\"\xa2\x01\n" +
+	"\x05Entry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\fR\x02id\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\fR\x05topic\x12\x18\n" +
+	"\apayload\x18\x03 \x01(\fR\apayload\x12\x1a\n" +
+	"\bcontract\x18\x04 \x01(\rR\bcontract\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x05 \x01(\rR\texpiresAt\x12\x1e\n" +
+	"\n" +
+	"encryption\x18\x06 \x01(\bR\n" +
+	"encryption\"<\n" +
+	"\n" +
+	"PutRequest\x12\x14\n" +
+	"\x05topic\x18\x01 \x01(\fR\x05topic\x12\x18\n" +
+	"\apayload\x18\x02 \x01(\fR\apayload\"9\n" +
+	"\x0fPutEntryRequest\x12&\n" +
+	"\x05entry\x18\x01 \x01(\v2\x10.unitdb.v1.EntryR\x05entry\"\r\n" +
+	"\vPutResponse\"T\n" +
+	"\n" +
+	"GetRequest\x12\x14\n" +
+	"\x05topic\x18\x01 \x01(\fR\x05topic\x12\x1a\n" +
+	"\bcontract\x18\x02 \x01(\rR\bcontract\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\")\n" +
+	"\vGetResponse\x12\x1a\n" +
+	"\bpayloads\x18\x01 \x03(\fR\bpayloads\"Q\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\fR\x02id\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\fR\x05topic\x12\x1a\n" +
+	"\bcontract\x18\x03 \x01(\rR\bcontract\"\x10\n" +
+	"\x0eDeleteResponse\"`\n" +
+	"\fBatchRequest\x12$\n" +
+	"\x04puts\x18\x01 \x03(\v2\x10.unitdb.v1.EntryR\x04puts\x12*\n" +
+	"\adeletes\x18\x02 \x03(\v2\x10.unitdb.v1.EntryR\adeletes\"\x0f\n" +
+	"\rBatchResponse\"\x14\n" +
+	"\x12NewContractRequest\"1\n" +
+	"\x13NewContractResponse\x12\x1a\n" +
+	"\bcontract\x18\x01 \x01(\rR\bcontract\"X\n" +
+	"\x10SubscribeRequest\x12\x14\n" +
+	"\x05topic\x18\x01 \x01(\fR\x05topic\x12\x1a\n" +
+	"\bcontract\x18\x02 \x01(\rR\bcontract\x12\x12\n" +
+	"\x04from\x18\x03 \x01(\fR\x04from\"\xb7\x01\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\fR\x02id\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\fR\x05topic\x12\x1a\n" +
+	"\bcontract\x18\x03 \x01(\rR\bcontract\x12\x18\n" +
+	"\apayload\x18\x04 \x01(\fR\apayload\x12\x1b\n" +
+	"\tstored_at\x18\x05 \x01(\x03R\bstoredAt\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x06 \x01(\rR\texpiresAt\x12\x14\n" +
+	"\x05token\x18\a \x01(\fR\x05token2\xbd\x03\n" +
+	"\x06Unitdb\x124\n" +
+	"\x03Put\x12\x15.unitdb.v1.PutRequest\x1a\x16.unitdb.v1.PutResponse\x12>\n" +
+	"\bPutEntry\x12\x1a.unitdb.v1.PutEntryRequest\x1a\x16.unitdb.v1.PutResponse\x124\n" +
+	"\x03Get\x12\x15.unitdb.v1.GetRequest\x1a\x16.unitdb.v1.GetResponse\x12=\n" +
+	"\x06Delete\x12\x18.unitdb.v1.DeleteRequest\x1a\x19.unitdb.v1.DeleteResponse\x12:\n" +
+	"\x05Batch\x12\x17.unitdb.v1.BatchRequest\x1a\x18.unitdb.v1.BatchResponse\x12L\n" +
+	"\vNewContract\x12\x1d.unitdb.v1.NewContractRequest\x1a\x1e.unitdb.v1.NewContractResponse\x12>\n" +
+	"\tSubscribe\x12\x1b.unitdb.v1.SubscribeRequest\x1a\x12.unitdb.v1.Message0\x01B'Z%github.com/unit-io/unitdb/server/grpcb\x06proto3"
+
+var (
+	file_unitdb_v1_proto_rawDescOnce sync.Once
+	file_unitdb_v1_proto_rawDescData []byte
+)
+
+func file_unitdb_v1_proto_rawDescGZIP() []byte {
+	file_unitdb_v1_proto_rawDescOnce.Do(func() {
+		file_unitdb_v1_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_unitdb_v1_proto_rawDesc), len(file_unitdb_v1_proto_rawDesc)))
+	})
+	return file_unitdb_v1_proto_rawDescData
+}
+
+var file_unitdb_v1_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_unitdb_v1_proto_goTypes = []any{
+	(*Entry)(nil),               // 0: unitdb.v1.Entry
+	(*PutRequest)(nil),          // 1: unitdb.v1.PutRequest
+	(*PutEntryRequest)(nil),     // 2: unitdb.v1.PutEntryRequest
+	(*PutResponse)(nil),         // 3: unitdb.v1.PutResponse
+	(*GetRequest)(nil),          // 4: unitdb.v1.GetRequest
+	(*GetResponse)(nil),         // 5: unitdb.v1.GetResponse
+	(*DeleteRequest)(nil),       // 6: unitdb.v1.DeleteRequest
+	(*DeleteResponse)(nil),      // 7: unitdb.v1.DeleteResponse
+	(*BatchRequest)(nil),        // 8: unitdb.v1.BatchRequest
+	(*BatchResponse)(nil),       // 9: unitdb.v1.BatchResponse
+	(*NewContractRequest)(nil),  // 10: unitdb.v1.NewContractRequest
+	(*NewContractResponse)(nil), // 11: unitdb.v1.NewContractResponse
+	(*SubscribeRequest)(nil),    // 12: unitdb.v1.SubscribeRequest
+	(*Message)(nil),             // 13: unitdb.v1.Message
+}
+var file_unitdb_v1_proto_depIdxs = []int32{
+	0,  // 0: unitdb.v1.PutEntryRequest.entry:type_name -> unitdb.v1.Entry
+	0,  // 1: unitdb.v1.BatchRequest.puts:type_name -> unitdb.v1.Entry
+	0,  // 2: unitdb.v1.BatchRequest.deletes:type_name -> unitdb.v1.Entry
+	1,  // 3: unitdb.v1.Unitdb.Put:input_type -> unitdb.v1.PutRequest
+	2,  // 4: unitdb.v1.Unitdb.PutEntry:input_type -> unitdb.v1.PutEntryRequest
+	4,  // 5: unitdb.v1.Unitdb.Get:input_type -> unitdb.v1.GetRequest
+	6,  // 6: unitdb.v1.Unitdb.Delete:input_type -> unitdb.v1.DeleteRequest
+	8,  // 7: unitdb.v1.Unitdb.Batch:input_type -> unitdb.v1.BatchRequest
+	10, // 8: unitdb.v1.Unitdb.NewContract:input_type -> unitdb.v1.NewContractRequest
+	12, // 9: unitdb.v1.Unitdb.Subscribe:input_type -> unitdb.v1.SubscribeRequest
+	3,  // 10: unitdb.v1.Unitdb.Put:output_type -> unitdb.v1.PutResponse
+	3,  // 11: unitdb.v1.Unitdb.PutEntry:output_type -> unitdb.v1.PutResponse
+	5,  // 12: unitdb.v1.Unitdb.Get:output_type -> unitdb.v1.GetResponse
+	7,  // 13: unitdb.v1.Unitdb.Delete:output_type -> unitdb.v1.DeleteResponse
+	9,  // 14: unitdb.v1.Unitdb.Batch:output_type -> unitdb.v1.BatchResponse
+	11, // 15: unitdb.v1.Unitdb.NewContract:output_type -> unitdb.v1.NewContractResponse
+	13, // 16: unitdb.v1.Unitdb.Subscribe:output_type -> unitdb.v1.Message
+	10, // [10:17] is the sub-list for method output_type
+	3,  // [3:10] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_unitdb_v1_proto_init() }
+func file_unitdb_v1_proto_init() {
+	if File_unitdb_v1_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_unitdb_v1_proto_rawDesc), len(file_unitdb_v1_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_unitdb_v1_proto_goTypes,
+		DependencyIndexes: file_unitdb_v1_proto_depIdxs,
+		MessageInfos:      file_unitdb_v1_proto_msgTypes,
+	}.Build()
+	File_unitdb_v1_proto = out.File
+	file_unitdb_v1_proto_goTypes = nil
+	file_unitdb_v1_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// UnitdbClient is the client API for Unitdb service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type UnitdbClient interface {
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	PutEntry(ctx context.Context, in *PutEntryRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	NewContract(ctx context.Context, in *NewContractRequest, opts ...grpc.CallOption) (*NewContractResponse, error)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Unitdb_SubscribeClient, error)
+}
+
+type unitdbClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUnitdbClient(cc grpc.ClientConnInterface) UnitdbClient {
+	return &unitdbClient{cc}
+}
+
+func (c *unitdbClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, "/unitdb.v1.Unitdb/Put", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitdbClient) PutEntry(ctx context.Context, in *PutEntryRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, "/unitdb.v1.Unitdb/PutEntry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitdbClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, "/unitdb.v1.Unitdb/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitdbClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/unitdb.v1.Unitdb/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitdbClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/unitdb.v1.Unitdb/Batch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitdbClient) NewContract(ctx context.Context, in *NewContractRequest, opts ...grpc.CallOption) (*NewContractResponse, error) {
+	out := new(NewContractResponse)
+	err := c.cc.Invoke(ctx, "/unitdb.v1.Unitdb/NewContract", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitdbClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Unitdb_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Unitdb_serviceDesc.Streams[0], "/unitdb.v1.Unitdb/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &unitdbSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Unitdb_SubscribeClient interface {
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type unitdbSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *unitdbSubscribeClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UnitdbServer is the server API for Unitdb service.
+type UnitdbServer interface {
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	PutEntry(context.Context, *PutEntryRequest) (*PutResponse, error)
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	Batch(context.Context, *BatchRequest) (*BatchResponse, error)
+	NewContract(context.Context, *NewContractRequest) (*NewContractResponse, error)
+	Subscribe(*SubscribeRequest, Unitdb_SubscribeServer) error
+}
+
+// UnimplementedUnitdbServer can be embedded to have forward compatible implementations.
+type UnimplementedUnitdbServer struct {
+}
+
+func (*UnimplementedUnitdbServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (*UnimplementedUnitdbServer) PutEntry(context.Context, *PutEntryRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutEntry not implemented")
+}
+func (*UnimplementedUnitdbServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (*UnimplementedUnitdbServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (*UnimplementedUnitdbServer) Batch(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (*UnimplementedUnitdbServer) NewContract(context.Context, *NewContractRequest) (*NewContractResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NewContract not implemented")
+}
+func (*UnimplementedUnitdbServer) Subscribe(*SubscribeRequest, Unitdb_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+
+func RegisterUnitdbServer(s *grpc.Server, srv UnitdbServer) {
+	s.RegisterService(&_Unitdb_serviceDesc, srv)
+}
+
+func _Unitdb_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitdbServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/unitdb.v1.Unitdb/Put",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitdbServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Unitdb_PutEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitdbServer).PutEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/unitdb.v1.Unitdb/PutEntry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitdbServer).PutEntry(ctx, req.(*PutEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Unitdb_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitdbServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/unitdb.v1.Unitdb/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitdbServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Unitdb_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitdbServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/unitdb.v1.Unitdb/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitdbServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Unitdb_Batch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitdbServer).Batch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/unitdb.v1.Unitdb/Batch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitdbServer).Batch(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Unitdb_NewContract_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewContractRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitdbServer).NewContract(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/unitdb.v1.Unitdb/NewContract",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitdbServer).NewContract(ctx, req.(*NewContractRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Unitdb_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UnitdbServer).Subscribe(m, &unitdbSubscribeServer{stream})
+}
+
+type Unitdb_SubscribeServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type unitdbSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *unitdbSubscribeServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Unitdb_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "unitdb.v1.Unitdb",
+	HandlerType: (*UnitdbServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Put",
+			Handler:    _Unitdb_Put_Handler,
+		},
+		{
+			MethodName: "PutEntry",
+			Handler:    _Unitdb_PutEntry_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Unitdb_Get_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Unitdb_Delete_Handler,
+		},
+		{
+			MethodName: "Batch",
+			Handler:    _Unitdb_Batch_Handler,
+		},
+		{
+			MethodName: "NewContract",
+			Handler:    _Unitdb_NewContract_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Unitdb_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "unitdb_v1.proto",
+}
@@ -18,7 +18,9 @@ package config
 
 import (
 	"encoding/json"
+	"time"
 
+	"github.com/unit-io/unitdb/server/auth"
 	"github.com/unit-io/unitdb/server/internal/pkg/log"
 )
 
@@ -33,6 +35,7 @@ type Config struct {
 	// "localhost:80".
 	// Could be blank: if TLS is not configured, will use ":80", otherwise ":443".
 	// Can be overridden from the command line, see option --listen.
+	// Could be a unix socket "unix:/run/unitdb.sock" or an in-process transport "inproc:name".
 	Listen string `json:"listen"`
 
 	// Default HTTP(S) address:port to listen on for grpc. Either a
@@ -42,6 +45,10 @@ type Config struct {
 	// Can be overridden from the command line, see option --listen.
 	GrpcListen string `json:"grpc_listen"`
 
+	// Address:port to listen on for MQTT 3.1.1 clients, e.g. ":1883". MQTT is served on the listener if blank
+	// or same as listen, see ListenerConfig. MQTT clients connect using the client ID issued by the server and the topic key as the password.
+	MqttListen string `json:"mqtt_listen"`
+
 	// Default logging level is "InfoLevel" so to enable the debug log set the "LogLevel" to "DebugLevel".
 	LoggingLevel string `json:"logging_level"`
 
@@ -59,6 +66,18 @@ type Config struct {
 
 	// Config to expose runtime stats
 	VarzPath string `json:"varz_path"`
+
+	// Config for protocols served on the listener
+	ListenerConfig json.RawMessage `json:"listener_config"`
+
+	// Config for message fan-out to subscribers
+	FanOutConfig json.RawMessage `json:"fanout_config"`
+
+	// Config for connection keepalive and expiry
+	ConnConfig json.RawMessage `json:"conn_config"`
+
+	// Config for authentication of the clients
+	AuthConfig json.RawMessage `json:"auth_config"`
 }
 
 // EncryptionConfig represents the configuration for the encryption.
@@ -86,6 +105,149 @@ func (c *Config) Encryption(encrConfig json.RawMessage) EncryptionConfig {
 	return encr
 }
 
+// ListenerConfig represents the configuration for protocols served on the listener.
+type ListenerConfig struct {
+	// GRPC enables gRPC. gRPC is served on the listener if grpc_listen is blank or same as listen.
+	GRPC bool `json:"grpc"`
+
+	// WebSocket enables websocket on the listener.
+	WebSocket bool `json:"websocket"`
+
+	// TCP enables tcp on the listener.
+	TCP bool `json:"tcp"`
+
+	// MQTT enables MQTT. MQTT is served on the listener if mqtt_listen is blank or same as listen.
+	MQTT bool `json:"mqtt"`
+
+	// CertFile and KeyFile to serve all protocols on the listener behind a single TLS certificate.
+	// The certificate is also used for the gRPC and MQTT listeners and is reloaded on SIGHUP.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+
+	// ClientCAFile enables mutual TLS, clients must present a certificate signed by one of the CAs in the file.
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+
+	// MinVersion is the minimum TLS version accepted, "1.2" or "1.3". Defaults to "1.2".
+	MinVersion string `json:"min_version,omitempty"`
+
+	// ALPN is the list of application protocols negotiated with the clients. Defaults to "h2" and "http/1.1".
+	ALPN []string `json:"alpn,omitempty"`
+}
+
+// Listener returns the listener configuration. All protocols are enabled if configuration is blank.
+func (c *Config) Listener(listenerConfig json.RawMessage) ListenerConfig {
+	listener := ListenerConfig{GRPC: true, WebSocket: true, TCP: true, MQTT: true}
+	if len(listenerConfig) == 0 {
+		return listener
+	}
+	if err := json.Unmarshal(listenerConfig, &listener); err != nil {
+		log.Fatal("config.Listener", "error in parsing listener config", err)
+	}
+
+	return listener
+}
+
+// Queue policies applied when outgoing queue of a subscriber is full.
+const (
+	// QueuePolicyDrop drops the new message.
+	QueuePolicyDrop = "drop"
+	// QueuePolicyDropOldest drops the oldest queued message so the new message wins.
+	QueuePolicyDropOldest = "drop_oldest"
+	// QueuePolicyDisconnect disconnects the subscriber.
+	QueuePolicyDisconnect = "disconnect"
+)
+
+// FanOutConfig represents the configuration for message fan-out to subscribers.
+type FanOutConfig struct {
+	// Workers is number of workers in the shared fan-out worker pool.
+	Workers int `json:"workers"`
+
+	// QueueSize is size of bounded outgoing queue per subscriber.
+	QueueSize int `json:"queue_size"`
+
+	// QueuePolicy is applied when outgoing queue of a subscriber is full, i.e. "drop", "drop_oldest" or "disconnect".
+	QueuePolicy string `json:"queue_policy"`
+}
+
+// FanOut returns the fan-out configuration. Defaults are used for the blank values.
+func (c *Config) FanOut(fanOutConfig json.RawMessage) FanOutConfig {
+	fanOut := FanOutConfig{Workers: 8, QueueSize: 64, QueuePolicy: QueuePolicyDrop}
+	if len(fanOutConfig) != 0 {
+		if err := json.Unmarshal(fanOutConfig, &fanOut); err != nil {
+			log.Fatal("config.FanOut", "error in parsing fanout config", err)
+		}
+	}
+	if fanOut.Workers <= 0 {
+		fanOut.Workers = 1
+	}
+	if fanOut.QueueSize <= 0 {
+		fanOut.QueueSize = 1
+	}
+
+	return fanOut
+}
+
+// ConnConfig represents the configuration for connection keepalive and expiry.
+type ConnConfig struct {
+	// KeepAlive is the default keepalive interval if client does not specify keepalive on connect.
+	KeepAlive string `json:"keepalive"`
+
+	// IdleTimeout is the time after which an idle connection is expired. It is never less than 1.5 times
+	// the keepalive of the client, so a client pinging at its keepalive interval is not expired.
+	IdleTimeout string `json:"idle_timeout"`
+}
+
+// Conn returns the connection configuration.
+func (c *Config) Conn(connConfig json.RawMessage) ConnConfig {
+	conn := ConnConfig{KeepAlive: "60s"}
+	if len(connConfig) == 0 {
+		return conn
+	}
+	if err := json.Unmarshal(connConfig, &conn); err != nil {
+		log.Fatal("config.Conn", "error in parsing conn config", err)
+	}
+
+	return conn
+}
+
+// KeepAliveDuration returns the keepalive interval.
+func (c ConnConfig) KeepAliveDuration() time.Duration {
+	d, err := time.ParseDuration(c.KeepAlive)
+	if err != nil || d <= 0 {
+		return 60 * time.Second
+	}
+	return d
+}
+
+// IdleTimeoutDuration returns the idle timeout for the keepalive interval, the larger of
+// the configured idle timeout and 1.5 times the keepalive.
+func (c ConnConfig) IdleTimeoutDuration(keepAlive time.Duration) time.Duration {
+	timeout := keepAlive * 3 / 2
+	if d, err := time.ParseDuration(c.IdleTimeout); err == nil && d > timeout {
+		return d
+	}
+	return timeout
+}
+
+// AuthConfig represents the configuration for authentication of the clients.
+type AuthConfig struct {
+	// Tokens the clients present on connect, each token maps to the contracts the client is allowed to use.
+	Tokens []auth.Token `json:"tokens"`
+}
+
+// Auth returns the authentication configuration. Clients are not authenticated if configuration is blank.
+func (c *Config) Auth(authConfig json.RawMessage) AuthConfig {
+	var a AuthConfig
+	if len(authConfig) == 0 {
+		return a
+	}
+	if err := json.Unmarshal(authConfig, &a); err != nil {
+		log.Fatal("config.Auth", "error in parsing auth config", err)
+	}
+
+	return a
+}
+
 // StoreConfig represents the configuration for the store.
 type StoreConfig struct {
 	// clean cleans logs to start clean and reset message store on service restart
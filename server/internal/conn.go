@@ -24,12 +24,15 @@ import (
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/unit-io/unitdb/server/auth"
 	"github.com/unit-io/unitdb/server/internal/message"
 	"github.com/unit-io/unitdb/server/internal/message/security"
 	lp "github.com/unit-io/unitdb/server/internal/net"
 	"github.com/unit-io/unitdb/server/internal/net/grpc"
+	"github.com/unit-io/unitdb/server/internal/net/mqtt"
 	"github.com/unit-io/unitdb/server/internal/pkg/log"
 	"github.com/unit-io/unitdb/server/internal/pkg/uid"
 	"github.com/unit-io/unitdb/server/internal/store"
@@ -49,11 +52,19 @@ type _Conn struct {
 	stop               chan interface{}
 	insecure           bool           // The insecure flag provided by client will not perform key validation and permissions check on the topic.
 	username           string         // The username provided by the client during connect.
+	will               *lp.Publish    // The will message published on abnormal disconnect.
+	idleTimeout        int64          // The time after which the idle connection is expired, in nanoseconds.
+	lastActive         int64          // The unix time in nanoseconds of the last inbound packet.
 	message.MessageIds                // local identifier of messages
 	clientid           uid.ID         // The clientid provided by client during connect or new Id assigned.
 	connid             uid.LID        // The locally unique id of the connection.
 	service            *_Service      // The service for this connection.
 	subs               *message.Stats // The subscriptions for this connection.
+	session            *_Session      // The session of the client tracking the messages delivered.
+	// The token provided by the client during connect and the principal authenticated using the token.
+	// Principal is nil if the client is not authenticated.
+	token     []byte
+	principal *auth.Principal
 	// Reference to the cluster node where the connection has originated. Set only for cluster RPC sessions
 	clnode *_ClusterNode
 	// Cluster nodes to inform when disconnected
@@ -71,6 +82,8 @@ func (s *_Service) newConn(t net.Conn, proto lp.Proto) *_Conn {
 		lineProto = &grpc.LineProto{}
 	case lp.GRPC_WEB:
 		lineProto = &grpc.LineProto{}
+	case lp.MQTT:
+		lineProto = &mqtt.LineProto{}
 	}
 
 	c := &_Conn{
@@ -79,8 +92,8 @@ func (s *_Service) newConn(t net.Conn, proto lp.Proto) *_Conn {
 		MessageIds: message.NewMessageIds(),
 		send:       make(chan lp.Packet, 1), // buffered
 		recv:       make(chan lp.Packet),
-		pub:        make(chan *lp.Publish),
-		stop:       make(chan interface{}, 1), // Buffered by 1 just to make it non-blocking
+		pub:        make(chan *lp.Publish, s.fanOut.config.QueueSize), // bounded outgoing queue
+		stop:       make(chan interface{}, 1),                         // Buffered by 1 just to make it non-blocking
 		connid:     uid.NewLID(),
 		service:    s,
 		subs:       message.NewStats(),
@@ -88,6 +101,9 @@ func (s *_Service) newConn(t net.Conn, proto lp.Proto) *_Conn {
 		closeC: make(chan struct{}),
 	}
 
+	c.idleTimeout = int64(s.idleTimeout)
+	c.touch()
+
 	// Increment the connection counter
 	s.meter.Connections.Inc(1)
 
@@ -115,6 +131,37 @@ func (s *_Service) newRpcConn(conn interface{}, connid uid.LID, clientid uid.ID)
 	return c
 }
 
+// touch records activity on the connection.
+func (c *_Conn) touch() {
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+// setKeepAlive sets the idle timeout from the keepalive requested by client on connect.
+func (c *_Conn) setKeepAlive(keepAlive time.Duration) {
+	if keepAlive <= 0 {
+		return
+	}
+	atomic.StoreInt64(&c.idleTimeout, int64(c.service.connConfig.IdleTimeoutDuration(keepAlive)))
+}
+
+// expiry returns the time when connection is expired if no packet is received.
+func (c *_Conn) expiry() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastActive)).Add(time.Duration(atomic.LoadInt64(&c.idleTimeout)))
+}
+
+// RemoteAddr returns the address of the client.
+func (c *_Conn) RemoteAddr() net.Addr {
+	if c.socket == nil {
+		return nil
+	}
+	return c.socket.RemoteAddr()
+}
+
+// Token returns the token provided by the client during connect.
+func (c *_Conn) Token() []byte {
+	return c.token
+}
+
 // ID returns the unique identifier of the subscriber.
 func (c *_Conn) ID() string {
 	return strconv.FormatUint(uint64(c.connid), 10)
@@ -136,16 +183,39 @@ func (c *_Conn) SendMessage(msg *message.Message) bool {
 		Payload:   msg.Payload,   // The payload for this message.
 	}
 
-	// Acknowledge the publication
-	select {
-	case c.pub <- &m:
-	case <-time.After(time.Microsecond * 50):
-		return false
+	if c.clnode != nil || c.service == nil || c.service.fanOut == nil {
+		// cluster connections are not queued.
+		// Acknowledge the publication
+		select {
+		case c.pub <- &m:
+			if c.service != nil {
+				c.service.meter.QueueDepth.Inc(1)
+			}
+		case <-time.After(time.Microsecond * 50):
+			return false
+		}
+		return true
 	}
 
+	if !c.enqueue(&m) {
+		return false
+	}
+	if c.session != nil {
+		c.session.deliver(deliveryID(msg.Topic, msg.Payload))
+	}
 	return true
 }
 
+// redeliver sends the message unless it is an exact duplicate of the message delivered to the
+// session before the client reconnected.
+func (c *_Conn) redeliver(msg *message.Message) bool {
+	if c.session != nil && c.session.isDelivered(deliveryID(msg.Topic, msg.Payload)) {
+		c.service.meter.Redeliveries.Inc(1)
+		return false
+	}
+	return c.SendMessage(msg)
+}
+
 // Send forwards raw bytes to the underlying client.
 func (c *_Conn) SendRawBytes(buf []byte) bool {
 	if c == nil {
@@ -242,6 +312,7 @@ func (c *_Conn) publish(msg lp.Publish, messageID uint16, topic *security.Topic,
 		Topic:     topic.Topic[:topic.Size],
 		Payload:   payload,
 	}
+	var subs []*_Conn
 	for _, connid := range conns {
 		qos := connid[0]
 		lid := uid.LID(binary.LittleEndian.Uint32(connid[1:5]))
@@ -252,12 +323,18 @@ func (c *_Conn) publish(msg lp.Publish, messageID uint16, topic *security.Topic,
 				m.MessageID = c.outboundID(mID)
 				m.Qos = qos
 			}
-			if !sub.SendMessage(m) {
-				log.ErrLogger.Err(err).Str("context", "conn.publish")
-			}
+			subs = append(subs, sub)
 			msgCount++
 		}
 	}
+	// Fan-out the message to subscribers using the shared worker pool so a slow subscriber does not delay others.
+	c.service.fanOut.submit(topicKey(c.clientid.Contract(), m.Topic), func() {
+		for _, sub := range subs {
+			if !sub.SendMessage(m) {
+				log.ErrLogger.Debug().Str("context", "conn.publish").Int64("connid", int64(sub.connid)).Msg("message not queued to subscriber")
+			}
+		}
+	})
 	c.service.meter.OutMsgs.Inc(int64(msgCount))
 	c.service.meter.OutBytes.Inc(m.Size() * int64(msgCount))
 
@@ -269,6 +346,23 @@ func (c *_Conn) publish(msg lp.Publish, messageID uint16, topic *security.Topic,
 	return err
 }
 
+// publishWill publishes the will message registered on connect.
+func (c *_Conn) publishWill() {
+	c.Lock()
+	will := c.will
+	c.will = nil
+	c.Unlock()
+	if will == nil || c.clientid == nil {
+		return
+	}
+	// Will message is not acknowledged as the client is gone.
+	pkt := *will
+	pkt.FixedHeader.Qos = 0
+	if err := c.onPublish(pkt, 0, pkt.Topic, pkt.Payload); err != nil {
+		log.ErrLogger.Error().Str("context", "conn.publishWill").Int64("connid", int64(c.connid)).Msg("unable to publish will message")
+	}
+}
+
 // sendClientID generate unique client and send it to new client
 func (c *_Conn) sendClientID(clientidentifier string) {
 	c.SendMessage(&message.Message{
@@ -326,9 +420,12 @@ func (c *_Conn) close() error {
 		defer log.ErrLogger.Debug().Str("context", "conn.closing").Msgf("panic recovered '%v'", debug.Stack())
 	}
 	defer c.socket.Close()
+	// Publish will message if connection is closed without disconnect.
+	c.publishWill()
 	// Signal all goroutines.
 	close(c.closeC)
 	c.closeW.Wait()
+	c.drain()
 	// Unsubscribe from everything, no need to lock since each Unsubscribe is
 	// already locked. Locking the 'Close()' would result in a deadlock.
 	// Don't close clustered connection, their servers are not being shut down.
@@ -341,6 +438,9 @@ func (c *_Conn) close() error {
 	}
 
 	Globals.connCache.delete(c.connid)
+	if c.session != nil {
+		Globals.sessions.detach(c.session, time.Now())
+	}
 	defer log.ConnLogger.Info().Str("context", "conn.close").Int64("connid", int64(c.connid)).Msg("conn closed")
 	Globals.Cluster.connGone(c)
 	close(c.send)
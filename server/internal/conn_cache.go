@@ -18,6 +18,7 @@ package internal
 
 import (
 	"sync"
+	"time"
 
 	"github.com/unit-io/unitdb/server/internal/pkg/uid"
 )
@@ -52,6 +53,19 @@ func (cc *_ConnCache) get(connid uid.LID) *_Conn {
 	return nil
 }
 
+// expired returns connections without activity beyond their idle timeout. Cluster connections are not expired.
+func (cc *_ConnCache) expired(now time.Time) []*_Conn {
+	cc.RLock()
+	defer cc.RUnlock()
+	var conns []*_Conn
+	for _, conn := range cc.m {
+		if conn.socket != nil && conn.clnode == nil && now.After(conn.expiry()) {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
 func (cc *_ConnCache) delete(connid uid.LID) {
 	cc.Lock()
 	defer cc.Unlock()
@@ -17,13 +17,17 @@
 package adapter
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
 	"os"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/unit-io/unitdb"
 	"github.com/unit-io/unitdb/memdb"
+	"github.com/unit-io/unitdb/message"
 	"github.com/unit-io/unitdb/server/internal/pkg/log"
 	"github.com/unit-io/unitdb/server/internal/store"
 )
@@ -42,6 +46,17 @@ const (
 type configType struct {
 	Dir  string `json:"dir,omitempty"`
 	Size int64  `json:"mem_size"`
+	// DefaultQueryLimit is number of messages returned by a query if query does not specify a limit.
+	DefaultQueryLimit int `json:"default_query_limit,omitempty"`
+	// MaxQueryLimit is hard cap on number of messages returned by a query.
+	MaxQueryLimit int `json:"max_query_limit,omitempty"`
+	// ReplicationAddr is address the primary streams the WAL segments to the replicas on.
+	ReplicationAddr string `json:"replication_addr,omitempty"`
+	// Replicas are dirs of the replica databases following the primary, Gets are routed to the replicas.
+	Replicas []string `json:"replicas,omitempty"`
+	// MaxStaleness is number of entries a replica may lag behind the primary to serve a Get. A Get
+	// overrides the bound using the "stale" topic option, for example "teams.alpha.ch1?stale=0".
+	MaxStaleness uint64 `json:"max_staleness,omitempty"`
 	// LogReleaseDur string `json:"log_release_duration,omitempty"`
 	// dur time.Duration
 }
@@ -55,10 +70,12 @@ const (
 
 // Store represents an SSD-optimized storage store.
 type adapter struct {
-	db      *unitdb.DB // The underlying database to store messages.
-	mem     *memdb.DB  // The underlying memdb to store messages.
-	config  *configType
-	version int
+	db       *unitdb.DB   // The underlying database to store messages.
+	replicas []*unitdb.DB // The replicas of the database to route Gets to.
+	next     uint32       // The replica to route the next Get to.
+	mem      *memdb.DB    // The underlying memdb to store messages.
+	config   *configType
+	version  int
 
 	// close
 	closer io.Closer
@@ -83,11 +100,33 @@ func (a *adapter) Open(jsonconfig string, reset bool) error {
 	}
 
 	// Attempt to open the database
-	a.db, err = unitdb.Open(config.Dir+"/"+defaultDatabase, nil, unitdb.WithMutable())
+	dbOpts := []unitdb.Options{unitdb.WithMutable()}
+	if config.DefaultQueryLimit > 0 {
+		dbOpts = append(dbOpts, unitdb.WithDefaultQueryLimit(config.DefaultQueryLimit))
+	}
+	if config.MaxQueryLimit > 0 {
+		dbOpts = append(dbOpts, unitdb.WithMaxQueryLimit(config.MaxQueryLimit))
+	}
+	if len(config.Replicas) > 0 && config.ReplicationAddr == "" {
+		return errors.New("unitdb adapter replicas require replication_addr")
+	}
+	if config.ReplicationAddr != "" {
+		dbOpts = append(dbOpts, unitdb.WithReplication(config.ReplicationAddr))
+	}
+	a.db, err = unitdb.Open(config.Dir+"/"+defaultDatabase, dbOpts...)
 	if err != nil {
 		log.Error("adapter.Open", "Unable to open db")
 		return err
 	}
+	for _, dir := range config.Replicas {
+		replica, err := unitdb.Open(dir, unitdb.WithReplicaOf(config.ReplicationAddr))
+		if err != nil {
+			log.Error("adapter.Open", "Unable to open replica db "+dir)
+			a.Close()
+			return err
+		}
+		a.replicas = append(a.replicas, replica)
+	}
 	// Attempt to open the memdb
 	var opts memdb.Options
 	if reset {
@@ -106,6 +145,10 @@ func (a *adapter) Open(jsonconfig string, reset bool) error {
 // Close closes the underlying database connection
 func (a *adapter) Close() error {
 	var err error
+	for _, replica := range a.replicas {
+		err = replica.Close()
+	}
+	a.replicas = nil
 	if a.db != nil {
 		err = a.db.Close()
 		a.db = nil
@@ -150,7 +193,43 @@ func (a *adapter) Get(contract uint32, topic []byte) (matches [][]byte, err erro
 	// Iterating over key/value pairs.
 	query := unitdb.NewQuery(topic)
 	query.WithContract(contract)
-	return a.db.Get(query)
+	return a.reader(topic).Get(query)
+}
+
+// reader returns the database to route the Get of the topic to. Replicas are picked round robin
+// and a replica lagging behind the primary by more than the staleness bound is skipped. The primary
+// serves the Get if no replica is within the bound.
+func (a *adapter) reader(topic []byte) *unitdb.DB {
+	n := len(a.replicas)
+	if n == 0 {
+		return a.db
+	}
+	maxStaleness := a.config.MaxStaleness
+	if stale, ok := topicOption(topic, "stale"); ok {
+		if v, err := strconv.ParseUint(stale, 10, 64); err == nil {
+			maxStaleness = v
+		}
+	}
+	seq := a.db.Seq()
+	next := atomic.AddUint32(&a.next, 1)
+	for i := 0; i < n; i++ {
+		replica := a.replicas[(int(next)+i)%n]
+		if replicaSeq := replica.Seq(); replicaSeq >= seq || seq-replicaSeq <= maxStaleness {
+			return replica
+		}
+	}
+	return a.db
+}
+
+// topicOption returns value of the option of the topic.
+func topicOption(topic []byte, name string) (string, bool) {
+	_, options := message.SplitTopic(topic)
+	for _, op := range bytes.Split(options, []byte{'&'}) {
+		if kv := bytes.SplitN(op, []byte{'='}, 2); len(kv) == 2 && string(kv[0]) == name {
+			return string(kv[1]), true
+		}
+	}
+	return "", false
 }
 
 // NewID generates a new messageId.
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/unit-io/unitdb/server/internal/config"
+	lp "github.com/unit-io/unitdb/server/internal/net"
+)
+
+// nOrderLocks is number of striped locks serializing the store and fan-out of messages of a topic.
+const nOrderLocks = 256
+
+// _FanOut is the shared worker pool to fan-out messages to subscribers.
+//
+// Messages of a topic are delivered to the subscribers in the order of arrival at the broker, which
+// is the order of their sequence in the store and so the order of Get history. The store and the
+// fan-out submit of a message are done under the ordering lock of its topic, and fan-out jobs of a
+// topic are run by the same worker in the order they are submitted. There is no ordering across
+// topics, a wildcard subscriber may observe messages of different topics interleaved in any order.
+type _FanOut struct {
+	queues []chan func()
+	locks  [nOrderLocks]sync.Mutex
+	config config.FanOutConfig
+}
+
+func newFanOut(cfg config.FanOutConfig) *_FanOut {
+	f := &_FanOut{
+		queues: make([]chan func(), cfg.Workers),
+		config: cfg,
+	}
+	for i := range f.queues {
+		f.queues[i] = make(chan func(), cfg.QueueSize)
+	}
+	return f
+}
+
+// start starts the workers of the fan-out pool.
+func (f *_FanOut) start(ctx context.Context) {
+	for i := range f.queues {
+		go func(jobs chan func()) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-jobs:
+					job()
+				}
+			}
+		}(f.queues[i])
+	}
+}
+
+// lock acquires the ordering lock of the topic key and returns the func to release the lock.
+func (f *_FanOut) lock(key uint64) func() {
+	mu := &f.locks[key%nOrderLocks]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// submit submits the fan-out job of the topic key to the worker of the topic.
+func (f *_FanOut) submit(key uint64, job func()) {
+	f.queues[key%uint64(len(f.queues))] <- job
+}
+
+// topicKey returns the key of the topic of the contract used to order messages of the topic.
+func topicKey(contract uint32, topic []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(topic)
+	return h.Sum64() ^ uint64(contract)
+}
+
+// enqueue adds the message to outgoing queue of the subscriber and applies the queue
+// policy if queue is full. It returns false if message is not queued.
+func (c *_Conn) enqueue(m *lp.Publish) bool {
+	meter := c.service.meter
+	for {
+		select {
+		case <-c.closeC:
+			return false
+		case c.pub <- m:
+			meter.QueueDepth.Inc(1)
+			select {
+			case <-c.closeC:
+				// connection is closed while the message is queued.
+				c.drain()
+				return false
+			default:
+			}
+			return true
+		default:
+		}
+
+		switch c.service.fanOut.config.QueuePolicy {
+		case config.QueuePolicyDropOldest:
+			select {
+			case <-c.pub:
+				meter.QueueDepth.Dec(1)
+				meter.Drops.Inc(1)
+			default:
+			}
+			// retry to queue the new message.
+		case config.QueuePolicyDisconnect:
+			meter.Drops.Inc(1)
+			// closing socket terminates readLoop which closes the connection.
+			c.socket.Close()
+			return false
+		default:
+			meter.Drops.Inc(1)
+			return false
+		}
+	}
+}
+
+// drain removes the messages left in the outgoing queue of the closed connection.
+func (c *_Conn) drain() {
+	for {
+		select {
+		case <-c.pub:
+			c.service.meter.QueueDepth.Dec(1)
+		default:
+			return
+		}
+	}
+}
@@ -19,5 +19,6 @@ package internal
 var Globals struct {
 	Cluster   *_Cluster
 	connCache *_ConnCache
+	sessions  *_Sessions
 	Service   *_Service
 }
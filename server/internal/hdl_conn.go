@@ -23,9 +23,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/unit-io/unitdb"
 	"github.com/unit-io/unitdb/server/internal/message"
 	"github.com/unit-io/unitdb/server/internal/message/security"
 	lp "github.com/unit-io/unitdb/server/internal/net"
+	"github.com/unit-io/unitdb/server/internal/net/mqtt"
 	"github.com/unit-io/unitdb/server/internal/pkg/crypto"
 	"github.com/unit-io/unitdb/server/internal/pkg/log"
 	"github.com/unit-io/unitdb/server/internal/pkg/stats"
@@ -49,7 +51,7 @@ func (c *_Conn) readLoop() error {
 
 	for {
 		// Set read/write deadlines so we can close dangling connections
-		c.socket.SetDeadline(time.Now().Add(time.Second * 120))
+		c.socket.SetDeadline(c.expiry())
 
 		// Decode an incoming packet
 		pkt, err := lp.ReadPacket(c.proto, reader)
@@ -57,6 +59,7 @@ func (c *_Conn) readLoop() error {
 			fmt.Println("readPacket: err", err)
 			return err
 		}
+		c.touch()
 
 		// Message handler
 		if err := c.handle(pkt); err != nil {
@@ -85,6 +88,12 @@ func (c *_Conn) handle(pkt lp.Packet) error {
 
 		c.insecure = packet.InsecureFlag
 		c.username = string(packet.Username)
+		c.setKeepAlive(time.Duration(packet.KeepAlive) * time.Second)
+		if err := c.onAuthenticate(packet); err != nil {
+			status = err.Status
+			c.send <- &lp.Connack{ReturnCode: 0x05, ConnID: uint32(c.connid)} // Unauthorized
+			return err
+		}
 		clientid, err := c.onConnect(packet.ClientID)
 		if err != nil {
 			status = err.Status
@@ -102,6 +111,19 @@ func (c *_Conn) handle(pkt lp.Packet) error {
 
 		c.clientid = clientid
 		c.MessageIds.Reset(message.MID(c.connid))
+		if c.session == nil && err == nil {
+			c.session = Globals.sessions.attach(clientid, packet.CleanSessFlag)
+		}
+		// Register will message to publish on abnormal disconnect.
+		if packet.WillFlag && len(packet.WillTopic) != 0 && err == nil {
+			c.Lock()
+			c.will = &lp.Publish{
+				FixedHeader: lp.FixedHeader{Qos: packet.WillQOS, Retain: packet.WillRetainFlag},
+				Topic:       packet.WillTopic,
+				Payload:     packet.WillMessage,
+			}
+			c.Unlock()
+		}
 		// Take care of any messages in the store
 		if !packet.CleanSessFlag {
 			c.resume()
@@ -156,6 +178,10 @@ func (c *_Conn) handle(pkt lp.Packet) error {
 		c.send <- resp
 
 	case lp.DISCONNECT:
+		// Clean disconnect discards the will message.
+		c.Lock()
+		c.will = nil
+		c.Unlock()
 
 	case lp.PUBLISH:
 		packet := *pkt.(*lp.Publish)
@@ -204,6 +230,7 @@ func (c *_Conn) writeLoop(ctx context.Context) {
 				// Channel closed.
 				return
 			}
+			c.service.meter.QueueDepth.Dec(1)
 			m, err := lp.Encode(c.proto, msg)
 			if err != nil {
 				log.Error("conn.writeLoop", err.Error())
@@ -271,6 +298,10 @@ func (c *_Conn) onSubscribe(pkt lp.Subscribe, msgTopic []byte) *types.Error {
 		return types.ErrBadRequest
 	}
 
+	if err := c.authorize(topic, unitdb.OpGet); err != nil {
+		return err
+	}
+
 	if !c.insecure {
 		if _, err := c.onSecureRequest(topic); err != nil {
 			return err
@@ -289,10 +320,11 @@ func (c *_Conn) onSubscribe(pkt lp.Subscribe, msgTopic []byte) *types.Error {
 		return types.ErrServerError
 	}
 
-	// Range over the messages in the channel and forward them
+	// Range over the messages in the channel and forward them, messages delivered to the session
+	// before the client reconnected are not delivered again.
 	for _, m := range msgs {
 		msg := m // Copy message
-		c.SendMessage(&msg)
+		c.redeliver(&msg)
 	}
 
 	return nil
@@ -311,6 +343,10 @@ func (c *_Conn) onUnsubscribe(pkt lp.Unsubscribe, msgTopic []byte) *types.Error
 		return types.ErrBadRequest
 	}
 
+	if err := c.authorize(topic, unitdb.OpGet); err != nil {
+		return err
+	}
+
 	if !c.insecure {
 		if _, err := c.onSecureRequest(topic); err != nil {
 			return err
@@ -338,10 +374,17 @@ func (c *_Conn) onPublish(pkt lp.Publish, messageID uint16, msgTopic []byte, pay
 
 	// Check whether the key is 'unitdb' which means it's an API request
 	if len(topic.Key) == 5 && string(topic.Key) == "unitdb" {
+		if err := c.authorize(topic, unitdb.OpGet); err != nil {
+			return err
+		}
 		c.onSpecialRequest(topic, payload)
 		return nil
 	}
 
+	if err := c.authorize(topic, unitdb.OpPut); err != nil {
+		return err
+	}
+
 	if !c.insecure {
 		wildcard, err := c.onSecureRequest(topic)
 		if err != nil {
@@ -352,8 +395,12 @@ func (c *_Conn) onPublish(pkt lp.Publish, messageID uint16, msgTopic []byte, pay
 		}
 	}
 
+	// Store and fan-out of the messages of a topic are serialized, so subscribers receive the messages
+	// of the topic in the order of their sequence in the store.
+	unlock := c.service.fanOut.lock(topicKey(c.clientid.Contract(), topic.Topic[:topic.Size]))
 	err := store.Message.Put(c.clientid.Contract(), topic.Topic, payload)
 	if err != nil {
+		unlock()
 		log.Error("conn.onPublish", "store message "+err.Error())
 		return types.ErrServerError
 	}
@@ -363,6 +410,7 @@ func (c *_Conn) onPublish(pkt lp.Publish, messageID uint16, msgTopic []byte, pay
 
 	// Iterate through all subscribers and send them the message
 	c.publish(pkt, messageID, topic, payload)
+	unlock()
 
 	// acknowledge a packet
 	return c.ack(pkt)
@@ -420,6 +468,41 @@ func (c *_Conn) resume() {
 	}
 }
 
+// onAuthenticate authenticates the client using the token provided on connect. TCP, websocket and gRPC
+// clients provide the token as the password, MQTT clients provide the token as the username as the
+// password carries the topic key.
+func (c *_Conn) onAuthenticate(pkt lp.Connect) *types.Error {
+	if c.service.auth == nil {
+		return nil
+	}
+	c.token = pkt.Password
+	if _, ok := c.proto.(*mqtt.LineProto); ok {
+		c.token = pkt.Username
+	}
+	p, err := c.service.auth.Authenticate(c)
+	if err != nil {
+		log.ConnLogger.Info().Str("context", "conn.onAuthenticate").Int64("connid", int64(c.connid)).Msg(err.Error())
+		return types.ErrBadToken
+	}
+	c.principal = &p
+	return nil
+}
+
+// authorize authorizes the operation on the topic for the principal authenticated on connect.
+// Packets forwarded by the cluster nodes are authorized on the node the client is connected to.
+func (c *_Conn) authorize(topic *security.Topic, op unitdb.Op) *types.Error {
+	if c.service == nil || c.service.auth == nil || c.clnode != nil {
+		return nil
+	}
+	if c.principal == nil {
+		return types.ErrUnauthorized
+	}
+	if !c.service.auth.Authorize(*c.principal, c.clientid.Contract(), topic.Topic[:topic.Size], op) {
+		return types.ErrForbidden
+	}
+	return nil
+}
+
 func (c *_Conn) onSecureRequest(topic *security.Topic) (bool, *types.Error) {
 	// Attempt to decode the key
 	key, err := security.DecodeKey(topic.Key)
@@ -35,6 +35,9 @@ type Meter struct {
 	OutMsgs        metrics.Counter
 	InBytes        metrics.Counter
 	OutBytes       metrics.Counter
+	QueueDepth     metrics.Counter
+	Drops          metrics.Counter
+	Redeliveries   metrics.Counter
 }
 
 func NewMeter() *Meter {
@@ -48,6 +51,9 @@ func NewMeter() *Meter {
 		OutMsgs:        metrics.NewCounter(),
 		InBytes:        metrics.NewCounter(),
 		OutBytes:       metrics.NewCounter(),
+		QueueDepth:     metrics.NewCounter(),
+		Drops:          metrics.NewCounter(),
+		Redeliveries:   metrics.NewCounter(),
 	}
 
 	c.ConnTimeSeries.Time(func() {})
@@ -57,6 +63,9 @@ func NewMeter() *Meter {
 	Metrics.GetOrRegister("OutMsgs", c.OutMsgs)
 	Metrics.GetOrRegister("InBytes", c.InBytes)
 	Metrics.GetOrRegister("Connections", c.Connections)
+	Metrics.GetOrRegister("QueueDepth", c.QueueDepth)
+	Metrics.GetOrRegister("Drops", c.Drops)
+	Metrics.GetOrRegister("Redeliveries", c.Redeliveries)
 
 	return c
 }
@@ -76,8 +85,11 @@ type Varz struct {
 	InBytes       int64     `json:"in_bytes"`
 	OutBytes      int64     `json:"out_bytes"`
 	Subscriptions int64     `json:"subscriptions"`
-	HMean         float64   `json:"hmean"` // Event duration harmonic mean.
-	P50           float64   `json:"p50"`   // Event duration nth percentiles ..
+	QueueDepth    int64     `json:"queue_depth"`  // Messages queued to subscribers.
+	Drops         int64     `json:"drops"`        // Messages dropped by queue policy.
+	Redeliveries  int64     `json:"redeliveries"` // Duplicate messages suppressed on resumed sessions.
+	HMean         float64   `json:"hmean"`        // Event duration harmonic mean.
+	P50           float64   `json:"p50"`          // Event duration nth percentiles ..
 	P75           float64   `json:"p75"`
 	P95           float64   `json:"p95"`
 	P99           float64   `json:"p99"`
@@ -128,6 +140,9 @@ func (s *_Service) Varz() (*Varz, error) {
 	v.InBytes = s.meter.InBytes.Count()
 	v.OutBytes = s.meter.OutBytes.Count()
 	v.Subscriptions = s.meter.Subscriptions.Count()
+	v.QueueDepth = s.meter.QueueDepth.Count()
+	v.Drops = s.meter.Drops.Count()
+	v.Redeliveries = s.meter.Redeliveries.Count()
 	ts := s.meter.ConnTimeSeries.Snapshot()
 	v.HMean = float64(ts.HMean())
 	v.P50 = float64(ts.P50())
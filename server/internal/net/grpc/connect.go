@@ -27,15 +27,20 @@ import (
 func encodeConnect(c lp.Connect) (bytes.Buffer, error) {
 	var msg bytes.Buffer
 	conn := pbx.Conn{
-		ProtoName:     string(c.ProtoName),
-		Version:       int32(c.Version),
-		UsernameFlag:  c.UsernameFlag,
-		PasswordFlag:  c.PasswordFlag,
-		CleanSessFlag: c.CleanSessFlag,
-		KeepAlive:     int32(c.KeepAlive),
-		ClientID:      string(c.ClientID),
-		Username:      string(c.Username),
-		Password:      string(c.Password),
+		ProtoName:      string(c.ProtoName),
+		Version:        int32(c.Version),
+		UsernameFlag:   c.UsernameFlag,
+		PasswordFlag:   c.PasswordFlag,
+		CleanSessFlag:  c.CleanSessFlag,
+		KeepAlive:      int32(c.KeepAlive),
+		ClientID:       string(c.ClientID),
+		Username:       string(c.Username),
+		Password:       string(c.Password),
+		WillFlag:       c.WillFlag,
+		WillQos:        int32(c.WillQOS),
+		WillRetainFlag: c.WillRetainFlag,
+		WillTopic:      string(c.WillTopic),
+		WillMessage:    c.WillMessage,
 	}
 
 	pkt, err := proto.Marshal(&conn)
@@ -125,6 +130,14 @@ func unpackConnect(data []byte) lp.Packet {
 	if connect.PasswordFlag {
 		connect.Password = []byte(pkt.Password)
 	}
+
+	if pkt.WillFlag {
+		connect.WillFlag = true
+		connect.WillQOS = uint8(pkt.WillQos)
+		connect.WillRetainFlag = pkt.WillRetainFlag
+		connect.WillTopic = []byte(pkt.WillTopic)
+		connect.WillMessage = pkt.WillMessage
+	}
 	return connect
 }
 
@@ -99,8 +99,8 @@ func (s *GrpcServer) Serve(list net.Listener) error {
 		opts = append(opts, grpc.KeepaliveEnforcementPolicy(kepConfig))
 
 		kpConfig := keepalive.ServerParameters{
-			Time:    60 * time.Second, // Ping the client if it is idle for 60 seconds to ensure the connection is still active
-			Timeout: 20 * time.Second, // Wait 20 second for the ping ack before assuming the connection is dead
+			Time:    s.opts.KeepAliveInterval, // Ping the client if it is idle for keepalive interval to ensure the connection is still active
+			Timeout: 20 * time.Second,         // Wait 20 second for the ping ack before assuming the connection is dead
 		}
 		opts = append(opts, grpc.KeepaliveParams(kpConfig))
 	}
@@ -18,13 +18,17 @@ package listener
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/unit-io/unitdb/server/common"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
 )
@@ -43,6 +47,16 @@ func MatchWS(strs ...string) Proto {
 	return pt.matchPrefix
 }
 
+// MatchHTTP2 only matches the HTTP/2 connection preface, i.e. gRPC connections.
+func MatchHTTP2() Proto {
+	return hasHTTP2Preface
+}
+
+// MatchMQTT only matches the MQTT 3.1.1 CONNECT packet.
+func MatchMQTT() Proto {
+	return hasMQTTConnect
+}
+
 // MatchCT only matches the content-type of the request.
 func MatchCT(strs string) Proto {
 	return func(r io.Reader) bool {
@@ -52,6 +66,31 @@ func MatchCT(strs string) Proto {
 	}
 }
 
+// hasMQTTConnect matches the fixed header of CONNECT packet followed by the MQTT protocol name.
+func hasMQTTConnect(r io.Reader) bool {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil || b[0] != 0x10 {
+		return false
+	}
+	// skip the remaining length, encoded in up to 4 bytes.
+	for i := 0; ; i++ {
+		if i == 4 {
+			return false
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return false
+		}
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+	var name [6]byte
+	if _, err := io.ReadFull(r, name[:]); err != nil {
+		return false
+	}
+	return bytes.Equal(name[:], []byte{0, 4, 'M', 'Q', 'T', 'T'})
+}
+
 func hasHTTP2Preface(r io.Reader) bool {
 	var b [len(http2.ClientPreface)]byte
 	last := 0
@@ -163,8 +202,10 @@ type Listener struct {
 	readTimeout time.Duration
 }
 
+// New creates listener on the address. The address in the form "unix:/run/unitdb.sock"
+// is a unix socket, "inproc:name" is an in-process listener, otherwise TCP host:port.
 func New(address string) (*Listener, error) {
-	l, err := net.Listen("tcp", address)
+	l, err := listen(address)
 	if err != nil {
 		return nil, err
 	}
@@ -178,6 +219,34 @@ func New(address string) (*Listener, error) {
 	}, nil
 }
 
+// NewTLS creates listener that terminates TLS using the config before matching protocols,
+// so all protocols are served behind a single certificate.
+func NewTLS(address string, config *tls.Config) (*Listener, error) {
+	l, err := New(address)
+	if err != nil {
+		return nil, err
+	}
+	l.root = tls.NewListener(l.root, config)
+	return l, nil
+}
+
+func listen(address string) (net.Listener, error) {
+	parts := strings.SplitN(address, ":", 2)
+	if len(parts) == 2 {
+		switch parts[0] {
+		case "unix":
+			// remove stale socket file left by unclean shutdown.
+			if fi, err := os.Stat(parts[1]); err == nil && fi.Mode()&os.ModeSocket != 0 {
+				os.Remove(parts[1])
+			}
+			return net.Listen("unix", parts[1])
+		case "inproc":
+			return common.ListenInProc(parts[1])
+		}
+	}
+	return net.Listen("tcp", address)
+}
+
 type mux struct {
 	protos []Proto
 	listen muxListener
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"bytes"
+
+	lp "github.com/unit-io/unitdb/server/internal/net"
+)
+
+const (
+	protoName    = "MQTT"
+	protoVersion = 4
+)
+
+func (p *LineProto) encodeConnect(c lp.Connect) (bytes.Buffer, error) {
+	body := appendBytes(nil, []byte(protoName))
+	var flags byte
+	if c.UsernameFlag {
+		flags |= 0x80
+	}
+	if c.PasswordFlag {
+		flags |= 0x40
+	}
+	if c.WillRetainFlag {
+		flags |= 0x20
+	}
+	flags |= (c.WillQOS & 0x03) << 3
+	if c.WillFlag {
+		flags |= 0x04
+	}
+	if c.CleanSessFlag {
+		flags |= 0x02
+	}
+	body = append(body, protoVersion, flags)
+	body = append(body, uint16Bytes(c.KeepAlive)...)
+	body = appendBytes(body, c.ClientID)
+	if c.WillFlag {
+		body = appendBytes(body, fromTopic(c.WillTopic))
+		body = appendBytes(body, c.WillMessage)
+	}
+	if c.UsernameFlag {
+		body = appendBytes(body, c.Username)
+	}
+	if c.PasswordFlag {
+		body = appendBytes(body, c.Password)
+	}
+	return pack(lp.CONNECT<<4, body)
+}
+
+// unpackConnect unpacks the connect packet, the password is the key used to access the topics.
+func (p *LineProto) unpackConnect(d *decoder) lp.Packet {
+	connect := &lp.Connect{
+		ProtoName: d.bytes(),
+		Version:   d.byte(),
+	}
+	flags := d.byte()
+	connect.UsernameFlag = flags&0x80 != 0
+	connect.PasswordFlag = flags&0x40 != 0
+	connect.WillRetainFlag = flags&0x20 != 0
+	connect.WillQOS = (flags >> 3) & 0x03
+	connect.WillFlag = flags&0x04 != 0
+	connect.CleanSessFlag = flags&0x02 != 0
+	connect.KeepAlive = d.uint16()
+	connect.ClientID = d.bytes()
+
+	var willTopic []byte
+	if connect.WillFlag {
+		willTopic = d.bytes()
+		connect.WillMessage = d.bytes()
+	}
+	if connect.UsernameFlag {
+		connect.Username = d.bytes()
+	}
+	if connect.PasswordFlag {
+		connect.Password = d.bytes()
+		p.key = connect.Password
+	}
+	if connect.WillFlag {
+		connect.WillTopic = p.toTopic(willTopic)
+	}
+	return connect
+}
+
+func unpackConnack(d *decoder) lp.Packet {
+	d.byte() // session present flag
+	return &lp.Connack{
+		ReturnCode: d.byte(),
+	}
+}
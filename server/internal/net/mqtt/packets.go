@@ -0,0 +1,243 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mqtt encodes and decodes the packets of the line protocol using the MQTT 3.1.1 wire format, so
+// MQTT clients can connect to the server. Levels of MQTT topics separated by '/' are mapped to the levels
+// of the topics separated by '.', and wildcards '+' and '#' are mapped to '*' and '...'.
+package mqtt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	lp "github.com/unit-io/unitdb/server/internal/net"
+)
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// LineProto is the MQTT protocol adapter of a connection. The key provided as the password on connect
+// is prefixed to the topics of the packets read from the connection.
+type LineProto struct {
+	key []byte
+}
+
+// ReadPacket unpacks the packet from the provided reader.
+func (p *LineProto) ReadPacket(r io.Reader) (lp.Packet, error) {
+	var head [1]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	length, err := decodeLength(r)
+	if err != nil {
+		return nil, err
+	}
+	fh := lp.FixedHeader{
+		MessageType:     head[0] >> 4,
+		Dup:             head[0]&0x08 != 0,
+		Qos:             (head[0] >> 1) & 0x03,
+		Retain:          head[0]&0x01 != 0,
+		RemainingLength: length,
+	}
+
+	// Check for empty packets
+	switch fh.MessageType {
+	case lp.PINGREQ:
+		return &lp.Pingreq{}, nil
+	case lp.PINGRESP:
+		return &lp.Pingresp{}, nil
+	case lp.DISCONNECT:
+		return &lp.Disconnect{}, nil
+	}
+
+	msg := make([]byte, fh.RemainingLength)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	// unpack the body
+	d := decoder{buf: msg}
+	var pkt lp.Packet
+	switch fh.MessageType {
+	case lp.CONNECT:
+		pkt = p.unpackConnect(&d)
+	case lp.CONNACK:
+		pkt = unpackConnack(&d)
+	case lp.PUBLISH:
+		pkt = p.unpackPublish(fh, &d)
+	case lp.PUBACK:
+		pkt = &lp.Puback{MessageID: d.uint16()}
+	case lp.PUBREC:
+		pkt = &lp.Pubrec{FixedHeader: fh, MessageID: d.uint16()}
+	case lp.PUBREL:
+		pkt = &lp.Pubrel{FixedHeader: fh, MessageID: d.uint16()}
+	case lp.PUBCOMP:
+		pkt = &lp.Pubcomp{MessageID: d.uint16()}
+	case lp.SUBSCRIBE:
+		pkt = p.unpackSubscribe(fh, &d)
+	case lp.SUBACK:
+		pkt = unpackSuback(&d)
+	case lp.UNSUBSCRIBE:
+		pkt = p.unpackUnsubscribe(fh, &d)
+	case lp.UNSUBACK:
+		pkt = &lp.Unsuback{MessageID: d.uint16()}
+	default:
+		return nil, fmt.Errorf("Invalid packet with type %d", fh.MessageType)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return pkt, nil
+}
+
+// Encode encodes the message into binary data
+func (p *LineProto) Encode(pkt lp.Packet) (bytes.Buffer, error) {
+	switch pkt.Type() {
+	case lp.PINGREQ:
+		return pack(lp.PINGREQ<<4, nil)
+	case lp.PINGRESP:
+		return pack(lp.PINGRESP<<4, nil)
+	case lp.CONNECT:
+		return p.encodeConnect(*pkt.(*lp.Connect))
+	case lp.CONNACK:
+		return pack(lp.CONNACK<<4, []byte{0, pkt.(*lp.Connack).ReturnCode})
+	case lp.DISCONNECT:
+		return pack(lp.DISCONNECT<<4, nil)
+	case lp.SUBSCRIBE:
+		return p.encodeSubscribe(*pkt.(*lp.Subscribe))
+	case lp.SUBACK:
+		return encodeSuback(*pkt.(*lp.Suback))
+	case lp.UNSUBSCRIBE:
+		return p.encodeUnsubscribe(*pkt.(*lp.Unsubscribe))
+	case lp.UNSUBACK:
+		return pack(lp.UNSUBACK<<4, uint16Bytes(pkt.(*lp.Unsuback).MessageID))
+	case lp.PUBLISH:
+		return p.encodePublish(*pkt.(*lp.Publish))
+	case lp.PUBACK:
+		return pack(lp.PUBACK<<4, uint16Bytes(pkt.(*lp.Puback).MessageID))
+	case lp.PUBREC:
+		return pack(lp.PUBREC<<4, uint16Bytes(pkt.(*lp.Pubrec).MessageID))
+	case lp.PUBREL:
+		return pack(lp.PUBREL<<4|0x02, uint16Bytes(pkt.(*lp.Pubrel).MessageID))
+	case lp.PUBCOMP:
+		return pack(lp.PUBCOMP<<4, uint16Bytes(pkt.(*lp.Pubcomp).MessageID))
+	}
+	return bytes.Buffer{}, nil
+}
+
+// pack writes the fixed header and the body of the packet.
+func pack(head byte, body []byte) (bytes.Buffer, error) {
+	var msg bytes.Buffer
+	msg.WriteByte(head)
+	msg.Write(encodeLength(len(body)))
+	_, err := msg.Write(body)
+	return msg, err
+}
+
+// decoder reads the fields of the packet body, the first error is kept and later reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.buf) < 1 {
+		d.err = errMalformed
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.buf) < 2 {
+		d.err = errMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.buf)
+	d.buf = d.buf[2:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := int(d.uint16())
+	if d.err != nil || len(d.buf) < n {
+		d.err = errMalformed
+		return nil
+	}
+	b := append([]byte(nil), d.buf[:n]...)
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) rest() []byte {
+	b := append([]byte(nil), d.buf...)
+	d.buf = nil
+	return b
+}
+
+func (d *decoder) empty() bool {
+	return len(d.buf) == 0
+}
+
+func uint16Bytes(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = append(buf, uint16Bytes(uint16(len(b)))...)
+	return append(buf, b...)
+}
+
+func encodeLength(length int) []byte {
+	var encLength []byte
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		encLength = append(encLength, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return encLength
+}
+
+func decodeLength(r io.Reader) (int, error) {
+	var rLength uint32
+	var multiplier uint32
+	b := make([]byte, 1)
+	for multiplier < 27 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+		digit := b[0]
+		rLength |= uint32(digit&127) << multiplier
+		if (digit & 128) == 0 {
+			return int(rLength), nil
+		}
+		multiplier += 7
+	}
+	return 0, errMalformed
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"bytes"
+
+	lp "github.com/unit-io/unitdb/server/internal/net"
+)
+
+func (p *LineProto) encodePublish(m lp.Publish) (bytes.Buffer, error) {
+	head := byte(lp.PUBLISH<<4) | (m.Qos&0x03)<<1
+	if m.Dup {
+		head |= 0x08
+	}
+	if m.Retain {
+		head |= 0x01
+	}
+	body := appendBytes(nil, fromTopic(m.Topic))
+	if m.Qos > 0 {
+		body = append(body, uint16Bytes(m.MessageID)...)
+	}
+	body = append(body, m.Payload...)
+	return pack(head, body)
+}
+
+func (p *LineProto) unpackPublish(fh lp.FixedHeader, d *decoder) lp.Packet {
+	pub := &lp.Publish{FixedHeader: fh}
+	pub.Topic = p.toTopic(d.bytes())
+	if fh.Qos > 0 {
+		pub.MessageID = d.uint16()
+	}
+	pub.Payload = d.rest()
+	return pub
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"bytes"
+
+	lp "github.com/unit-io/unitdb/server/internal/net"
+)
+
+// retainedOption is appended to the topics subscribed, so the last message stored on the topic is
+// delivered on subscribe as the retained message.
+const retainedOption = "?last=1"
+
+func (p *LineProto) encodeSubscribe(s lp.Subscribe) (bytes.Buffer, error) {
+	body := uint16Bytes(s.MessageID)
+	for _, sub := range s.Subscriptions {
+		body = appendBytes(body, fromTopic(sub.Topic))
+		body = append(body, sub.Qos)
+	}
+	return pack(lp.SUBSCRIBE<<4|0x02, body)
+}
+
+func (p *LineProto) unpackSubscribe(fh lp.FixedHeader, d *decoder) lp.Packet {
+	sub := &lp.Subscribe{FixedHeader: fh, MessageID: d.uint16()}
+	for !d.empty() && d.err == nil {
+		topic := append(p.toTopic(d.bytes()), retainedOption...)
+		sub.Subscriptions = append(sub.Subscriptions, lp.TopicQOSTuple{Topic: topic, Qos: d.byte() & 0x03})
+	}
+	return sub
+}
+
+func encodeSuback(s lp.Suback) (bytes.Buffer, error) {
+	body := uint16Bytes(s.MessageID)
+	body = append(body, s.Qos...)
+	return pack(lp.SUBACK<<4, body)
+}
+
+func unpackSuback(d *decoder) lp.Packet {
+	return &lp.Suback{MessageID: d.uint16(), Qos: d.rest()}
+}
+
+func (p *LineProto) encodeUnsubscribe(u lp.Unsubscribe) (bytes.Buffer, error) {
+	body := uint16Bytes(u.MessageID)
+	for _, sub := range u.Subscriptions {
+		body = appendBytes(body, fromTopic(sub.Topic))
+	}
+	return pack(lp.UNSUBSCRIBE<<4|0x02, body)
+}
+
+func (p *LineProto) unpackUnsubscribe(fh lp.FixedHeader, d *decoder) lp.Packet {
+	unsub := &lp.Unsubscribe{FixedHeader: fh, MessageID: d.uint16()}
+	for !d.empty() && d.err == nil {
+		unsub.Subscriptions = append(unsub.Subscriptions, lp.TopicQOSTuple{Topic: p.toTopic(d.bytes())})
+	}
+	return unsub
+}
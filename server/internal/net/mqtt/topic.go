@@ -0,0 +1,84 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"bytes"
+)
+
+const (
+	levelSeparator = '/'
+	keySeparator   = '/'
+)
+
+// toTopic maps the MQTT topic filter to the topic, the key of the connection if set is prefixed to the topic.
+// The multi-level wildcard '#' is joined to the parent level without separator as the topic wildcard "...".
+func (p *LineProto) toTopic(filter []byte) []byte {
+	var topic []byte
+	if len(p.key) != 0 {
+		topic = append(append(topic, p.key...), keySeparator)
+	}
+	for i, level := range bytes.Split(filter, []byte{levelSeparator}) {
+		switch {
+		case bytes.Equal(level, []byte("#")):
+			return append(topic, "..."...)
+		case i > 0:
+			topic = append(topic, '.')
+		}
+		if bytes.Equal(level, []byte("+")) {
+			topic = append(topic, '*')
+			continue
+		}
+		topic = append(topic, level...)
+	}
+	return topic
+}
+
+// fromTopic maps the topic to the MQTT topic, the key and the options of the topic are removed.
+func fromTopic(topic []byte) []byte {
+	if i := bytes.IndexByte(topic, keySeparator); i >= 0 {
+		topic = topic[i+1:]
+	}
+	if i := bytes.IndexByte(topic, '?'); i >= 0 {
+		topic = topic[:i]
+	}
+	wildcard := bytes.HasSuffix(topic, []byte("..."))
+	if wildcard {
+		topic = topic[:len(topic)-3]
+	}
+	filter := make([]byte, 0, len(topic)+2)
+	for _, part := range bytes.Split(topic, []byte{'.'}) {
+		filter = appendLevel(filter, part)
+	}
+	if wildcard {
+		filter = appendLevel(filter, []byte("#"))
+	}
+	return filter
+}
+
+func appendLevel(filter, level []byte) []byte {
+	if len(level) == 0 {
+		return filter
+	}
+	if bytes.Equal(level, []byte("*")) {
+		level = []byte("+")
+	}
+	if len(filter) > 0 {
+		filter = append(filter, levelSeparator)
+	}
+	return append(filter, level...)
+}
@@ -25,6 +25,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 const (
@@ -43,14 +44,16 @@ const (
 	HTTP
 	GRPC
 	GRPC_WEB
+	MQTT
 )
 
 //Handler is a callback which get called when a tcp, websocket connection is established or a grpc stream is established
 type Handler func(c net.Conn, proto Proto)
 
 type options struct {
-	TLSConfig *tls.Config
-	KeepAlive bool
+	TLSConfig         *tls.Config
+	KeepAlive         bool
+	KeepAliveInterval time.Duration
 }
 
 // Options it contains configurable options for client
@@ -80,10 +83,19 @@ func newFuncOption(f func(*options)) *fOption {
 func WithDefaultOptions() Options {
 	return newFuncOption(func(o *options) {
 		o.KeepAlive = true
+		o.KeepAliveInterval = 60 * time.Second
 		o.TLSConfig = nil
 	})
 }
 
+// WithKeepAliveInterval sets interval to ping idle connections.
+func WithKeepAliveInterval(d time.Duration) Options {
+	return newFuncOption(func(o *options) {
+		o.KeepAlive = d > 0
+		o.KeepAliveInterval = d
+	})
+}
+
 // WithTLSConfig will set an SSL/TLS configuration to be used when connecting
 // to server.
 func WithTLSConfig(t *tls.Config) Options {
@@ -18,6 +18,7 @@ package internal
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"os"
 	"os/signal"
@@ -26,6 +27,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/unit-io/unitdb/server/auth"
+	"github.com/unit-io/unitdb/server/common"
 	"github.com/unit-io/unitdb/server/internal/config"
 	lp "github.com/unit-io/unitdb/server/internal/net"
 	"github.com/unit-io/unitdb/server/internal/net/listener"
@@ -51,12 +54,34 @@ type _Service struct {
 	http    *lp.HttpServer     // The underlying HTTP server.
 	tcp     *lp.TcpServer      // The underlying TCP server.
 	grpc    *lp.GrpcServer     // The underlying GRPC server.
+	mqtt    *lp.TcpServer      // The underlying MQTT server.
 	meter   *Meter             // The metircs to measure timeseries on message events
+	fanOut  *_FanOut           // The shared worker pool to fan-out messages to subscribers.
 	stats   *stats.Stats
+	auth    auth.Auth // The auth to authenticate the clients, nil if clients are not authenticated.
+	tls     *_TLS     // The TLS certificate of the listeners, nil if TLS is not configured.
+
+	// The connection keepalive and expiry configuration.
+	connConfig  config.ConnConfig
+	idleTimeout time.Duration
 }
 
 func NewService(ctx context.Context, cfg *config.Config) (s *_Service, err error) {
 	ctx, cancel := context.WithCancel(context.Background())
+	connConfig := cfg.Conn(cfg.ConnConfig)
+	keepAlive := connConfig.KeepAliveDuration()
+	var t *_TLS
+	if lc := cfg.Listener(cfg.ListenerConfig); lc.CertFile != "" {
+		if t, err = newTLS(lc); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	grpcOpts := []lp.Options{lp.WithKeepAliveInterval(keepAlive)}
+	if t != nil && cfg.GrpcListen != "" && cfg.GrpcListen != cfg.Listen {
+		// gRPC served on its own listener terminates TLS, on the main listener it is behind the TLS of the listener.
+		grpcOpts = append(grpcOpts, lp.WithTLSConfig(t.config()))
+	}
 	s = &_Service{
 		pid:     uid.NewUnique(),
 		cache:   new(sync.Map),
@@ -65,14 +90,28 @@ func NewService(ctx context.Context, cfg *config.Config) (s *_Service, err error
 		cancel:  cancel,
 		start:   time.Now(),
 		// subscriptions: message.NewSubscriptions(),
-		http:  lp.NewHttpServer(),
-		tcp:   lp.NewTcpServer(),
-		grpc:  lp.NewGrpcServer(),
-		meter: NewMeter(),
+		http:   lp.NewHttpServer(),
+		tcp:    lp.NewTcpServer(),
+		grpc:   lp.NewGrpcServer(grpcOpts...),
+		mqtt:   lp.NewTcpServer(),
+		meter:  NewMeter(),
+		fanOut: newFanOut(cfg.FanOut(cfg.FanOutConfig)),
+		tls:    t,
+
 		stats: stats.New(&stats.Config{Addr: "localhost:8094", Size: 50}, stats.MaxPacketSize(1400), stats.MetricPrefix("trace")),
+
+		connConfig:  connConfig,
+		idleTimeout: connConfig.IdleTimeoutDuration(keepAlive),
+	}
+
+	if a := cfg.Auth(cfg.AuthConfig); len(a.Tokens) != 0 {
+		s.auth = auth.NewStaticTokens(a.Tokens)
 	}
 
 	Globals.connCache = NewConnCache()
+	Globals.sessions = newSessions()
+	s.fanOut.start(ctx)
+	s.startConnExpirer(ctx, keepAlive)
 
 	// // Varz
 	// if cfg.VarzPath != "" {
@@ -84,6 +123,7 @@ func NewService(ctx context.Context, cfg *config.Config) (s *_Service, err error
 	s.grpc.Handler = s.onAcceptConn
 	s.http.Handler = s.onAcceptConn
 	s.tcp.Handler = s.onAcceptConn
+	s.mqtt.Handler = func(c net.Conn, _ lp.Proto) { s.onAcceptConn(c, lp.MQTT) }
 
 	// Create a new MAC from the key.
 	if s.mac, err = crypto.New([]byte(s.config.Encryption(s.config.EncryptionConfig).Key)); err != nil {
@@ -99,12 +139,18 @@ func NewService(ctx context.Context, cfg *config.Config) (s *_Service, err error
 	return s, nil
 }
 
-// netListener creates net.Listener for tcp and unix domains:
-// if addr is is in the form "unix:/run/tinode.sock" it's a unix socket, otherwise TCP host:port.
+// netListener creates net.Listener for tcp, unix domains and in-process transport:
+// if addr is is in the form "unix:/run/tinode.sock" it's a unix socket, "inproc:name" is
+// an in-process listener, otherwise TCP host:port.
 func netListener(addr string) (net.Listener, error) {
 	addrParts := strings.SplitN(addr, ":", 2)
-	if len(addrParts) == 2 && addrParts[0] == "unix" {
-		return net.Listen("unix", addrParts[1])
+	if len(addrParts) == 2 {
+		switch addrParts[0] {
+		case "unix":
+			return net.Listen("unix", addrParts[1])
+		case "inproc":
+			return common.ListenInProc(addrParts[1])
+		}
 	}
 	return net.Listen("tcp", addr)
 }
@@ -125,7 +171,14 @@ func (s *_Service) listen(addr string) {
 	//Create a new listener
 	log.Info("service.listen", "starting the listner at "+addr)
 
-	l, err := listener.New(addr)
+	lc := s.config.Listener(s.config.ListenerConfig)
+	var l *listener.Listener
+	var err error
+	if s.tls != nil {
+		l, err = listener.NewTLS(addr, s.tls.config())
+	} else {
+		l, err = listener.New(addr)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -133,19 +186,64 @@ func (s *_Service) listen(addr string) {
 	l.SetReadTimeout(120 * time.Second)
 
 	// Configure the protos
-	if s.config.GrpcListen != "" {
-		grpcList, err := netListener(s.config.GrpcListen)
+	if lc.GRPC {
+		if s.config.GrpcListen == "" || s.config.GrpcListen == addr {
+			// serve gRPC on the listener.
+			l.ServeCallback(listener.MatchHTTP2(), s.grpc.Serve)
+		} else {
+			grpcList, err := netListener(s.config.GrpcListen)
+			if err != nil {
+				return
+			}
+			s.grpc.Serve(grpcList)
+		}
+	}
+	if lc.WebSocket {
+		l.ServeCallback(listener.MatchWS("GET"), s.http.Serve)
+	}
+	if lc.MQTT && (s.config.MqttListen == "" || s.config.MqttListen == addr) {
+		// serve MQTT on the listener, it is matched before tcp which matches any connection.
+		l.ServeCallback(listener.MatchMQTT(), s.mqtt.Serve)
+	}
+	if lc.TCP {
+		l.ServeCallback(listener.MatchAny(), s.tcp.Serve)
+	}
+	if lc.MQTT && s.config.MqttListen != "" && s.config.MqttListen != addr {
+		mqttList, err := netListener(s.config.MqttListen)
 		if err != nil {
-			return
+			log.Error("service.listen", "unable to listen for mqtt "+err.Error())
+		} else {
+			if s.tls != nil {
+				mqttList = tls.NewListener(mqttList, s.tls.config())
+			}
+			go s.mqtt.Serve(mqttList)
 		}
-		s.grpc.Serve(grpcList)
 	}
-	l.ServeCallback(listener.MatchWS("GET"), s.http.Serve)
-	l.ServeCallback(listener.MatchAny(), s.tcp.Serve)
 
 	go l.Serve()
 }
 
+// startConnExpirer closes expired connections, i.e. connections without deadline support
+// such as gRPC streams, so their sessions are cleaned.
+func (s *_Service) startConnExpirer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, c := range Globals.connCache.expired(now) {
+					log.ConnLogger.Info().Str("context", "service.startConnExpirer").Int64("connid", int64(c.connid)).Msg("conn expired")
+					c.socket.Close()
+				}
+				Globals.sessions.expire(now)
+			}
+		}
+	}()
+}
+
 // Handle a new connection request
 func (s *_Service) onAcceptConn(t net.Conn, proto lp.Proto) {
 	conn := s.newConn(t, proto)
@@ -155,6 +253,15 @@ func (s *_Service) onAcceptConn(t net.Conn, proto lp.Proto) {
 
 func (s *_Service) onSignal(sig os.Signal) {
 	switch sig {
+	case syscall.SIGHUP:
+		if s.tls == nil {
+			return
+		}
+		if err := s.tls.reload(); err != nil {
+			log.Error("service.onSignal", "unable to reload TLS certificate "+err.Error())
+			return
+		}
+		log.Info("service.onSignal", "TLS certificate reloaded")
 	case syscall.SIGTERM:
 		fallthrough
 	case syscall.SIGINT:
@@ -166,7 +273,7 @@ func (s *_Service) onSignal(sig os.Signal) {
 
 func (s *_Service) hookSignals() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	go func() {
 		for sig := range c {
@@ -17,18 +17,41 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	jcr "github.com/DisposaBoy/JsonConfigReader"
 	"github.com/stretchr/testify/assert"
+	"github.com/unit-io/unitdb"
+	"github.com/unit-io/unitdb/server/auth"
+	"github.com/unit-io/unitdb/server/common"
 	"github.com/unit-io/unitdb/server/internal/config"
+	"github.com/unit-io/unitdb/server/internal/message/security"
 	lp "github.com/unit-io/unitdb/server/internal/net"
+	"github.com/unit-io/unitdb/server/internal/net/grpc"
+	"github.com/unit-io/unitdb/server/internal/net/listener"
+	"github.com/unit-io/unitdb/server/internal/net/mqtt"
+	"github.com/unit-io/unitdb/server/internal/pkg/uid"
+	"github.com/unit-io/unitdb/server/internal/store"
+	"github.com/unit-io/unitdb/server/internal/types"
 )
 
 func TestPubsub(t *testing.T) {
@@ -42,104 +65,440 @@ func TestPubsub(t *testing.T) {
 	} else if err = json.NewDecoder(jcr.New(file)).Decode(&cfg); err != nil {
 		assert.NoError(t, err)
 	}
+	// serve on a free port and store messages in a temporary dir.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	cfg.Listen, cfg.GrpcListen, cfg.MqttListen = addr, addr, ""
+	cfg.StoreConfig = json.RawMessage(fmt.Sprintf(`{"clean_session": true, "adapters": {"unitdb": {"dir": %q, "mem_size": 1000000}}}`, t.TempDir()))
 	svc, err := NewService(context.Background(), cfg)
 	assert.NoError(t, err)
 
 	defer svc.Close()
 
-	go svc.Listen()
+	svc.listen(addr)
 
 	// Create a client
-	cli, err := net.Dial("tcp", "127.0.0.1:6060")
+	var cli net.Conn
+	for i := 0; i < 50; i++ {
+		if cli, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 	assert.NoError(t, err)
 	defer cli.Close()
+	cli.SetDeadline(time.Now().Add(10 * time.Second))
 
-	{ // Connect to the broker
-		connect := lp.Connect{ClientID: []byte("UCBFDONCNJLaKMCAIeJBaOVfbAXUZHNPLDKKLDKLHZHKYIZLCDPQ")}
-		n := connect.Encode()
-		assert.Equal(t, 14, n)
+	proto := &grpc.LineProto{}
+	write := func(pkt lp.Packet) {
+		m, err := lp.Encode(proto, pkt)
+		assert.NoError(t, err)
+		_, err = cli.Write(m.Bytes())
 		assert.NoError(t, err)
 	}
 
+	{ // Connect to the broker
+		write(&lp.Connect{ClientID: []byte("UCBFDONCNJLaKMCAIeJBaOVfbAXUZHNPLDKKLDKLHZHKYIZLCDPQ")})
+	}
+
 	{ // Read connack
-		msg, err := lp.ReadPacket(cli)
+		msg, err := lp.ReadPacket(proto, cli)
 		assert.NoError(t, err)
 		assert.Equal(t, lp.CONNACK, msg.Type())
 	}
 
 	{ // Ping the broker
-		ping := lp.Pingreq{}
-		n := ping.Encode()
-		assert.Equal(t, 2, n)
-		assert.NoError(t, err)
+		write(&lp.Pingreq{})
 	}
 
 	{ // Read pong
-		msg, err := lp.ReadPacket(cli)
+		msg, err := lp.ReadPacket(proto, cli)
 		assert.NoError(t, err)
 		assert.Equal(t, lp.PINGRESP, msg.Type())
 	}
 
 	{ // Subscribe to a topic
-		sub := lp.Subscribe{
-			FixedHeader: lp.FixedHeader{Qos: 0},
+		write(&lp.Subscribe{
+			MessageID: 1,
 			Subscriptions: []lp.TopicQOSTuple{
 				{Topic: []byte("AYAAMACRZDCHK/..."), Qos: 0},
 			},
-		}
-		sub.Encode()
-		assert.NoError(t, err)
+		})
 	}
 
 	{ // Read suback
-		msg, err := lp.ReadPacket(cli)
+		msg, err := lp.ReadPacket(proto, cli)
 		assert.NoError(t, err)
 		assert.Equal(t, lp.SUBACK, msg.Type())
 	}
 
 	{ // Publish a message
-		msg := lp.Publish{
-			FixedHeader: lp.FixedHeader{Qos: 0},
-			Topic:       []byte("AbYANcEEZDcdY/unit8.b.b1?ttl=3m"),
-			Payload:     []byte("Hi unit8.b.b1!"),
-		}
-		msg.Encode()
-		assert.NoError(t, err)
+		write(&lp.Publish{
+			Topic:   []byte("AbYANcEEZDcdY/unit8.b.b1?ttl=3m"),
+			Payload: []byte("Hi unit8.b.b1!"),
+		})
 	}
 
 	{ // Read the message back
-		msg, err := lp.ReadPacket(cli)
+		msg, err := lp.ReadPacket(proto, cli)
 		assert.NoError(t, err)
-		assert.Equal(t, lp.PUBLISH, msg.Type())
-		assert.Equal(t, &lp.Publish{
-			FixedHeader: lp.FixedHeader{Qos: 0},
-			Topic:       []byte("unit8.b.b1"),
-			Payload:     []byte("Hi unit8.b.b1!"),
-		}, msg)
+		if assert.Equal(t, lp.PUBLISH, msg.Type()) {
+			assert.Equal(t, []byte("unit8.b.b1"), msg.(*lp.Publish).Topic)
+			assert.Equal(t, []byte("Hi unit8.b.b1!"), msg.(*lp.Publish).Payload)
+		}
+	}
+
+	{ // Publish the will message of a client closed without disconnect
+		will, err := net.Dial("tcp", addr)
+		assert.NoError(t, err)
+		will.SetDeadline(time.Now().Add(10 * time.Second))
+		m, err := lp.Encode(proto, &lp.Connect{
+			ClientID:    []byte("UCBFDONCNJLaKMCAIeJBaOVfbAXUZHNPLDKKLDKLHZHKYIZLCDPQ"),
+			WillFlag:    true,
+			WillTopic:   []byte("AbYANcEEZDcdY/unit8.b.b1"),
+			WillMessage: []byte("unit8.b.b1 is gone!"),
+		})
+		assert.NoError(t, err)
+		_, err = will.Write(m.Bytes())
+		assert.NoError(t, err)
+		msg, err := lp.ReadPacket(proto, will)
+		assert.NoError(t, err)
+		assert.Equal(t, lp.CONNACK, msg.Type())
+		will.Close()
+
+		msg, err = lp.ReadPacket(proto, cli)
+		assert.NoError(t, err)
+		if assert.Equal(t, lp.PUBLISH, msg.Type()) {
+			assert.Equal(t, []byte("unit8.b.b1"), msg.(*lp.Publish).Topic)
+			assert.Equal(t, []byte("unit8.b.b1 is gone!"), msg.(*lp.Publish).Payload)
+		}
 	}
 
 	{ // Unsubscribe from the topic
-		sub := lp.Unsubscribe{
-			FixedHeader: lp.FixedHeader{Qos: 0},
-			Topics: []lp.TopicQOSTuple{
+		write(&lp.Unsubscribe{
+			MessageID: 2,
+			Subscriptions: []lp.TopicQOSTuple{
 				{Topic: []byte("AYAAMACRZDCHK/..."), Qos: 0},
 			},
-		}
-		sub.Encode()
-		assert.NoError(t, err)
+		})
 	}
 
 	{ // Read unsuback
-		msg, err := lp.ReadPacket(cli)
+		msg, err := lp.ReadPacket(proto, cli)
 		assert.NoError(t, err)
 		assert.Equal(t, lp.UNSUBACK, msg.Type())
 	}
 
 	{ // Disconnect from the broker
-		disconnect := lp.Disconnect{}
-		n := disconnect.Encode()
-		assert.Equal(t, 2, n)
+		write(&lp.Disconnect{})
+	}
+}
+
+func TestFanOutOrdering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := newFanOut(config.FanOutConfig{Workers: 4, QueueSize: 16})
+	f.start(ctx)
+
+	const publishers, msgs = 8, 100
+	topics := [][]byte{[]byte("unit1.test"), []byte("unit2.test"), []byte("unit3.test")}
+	var mu sync.Mutex
+	history := make(map[string][]int)   // order of store
+	delivered := make(map[string][]int) // order of fan-out
+	var wg sync.WaitGroup
+	wg.Add(publishers * msgs)
+	seq := 0
+	for p := 0; p < publishers; p++ {
+		go func(p int) {
+			for i := 0; i < msgs; i++ {
+				topic := topics[(p+i)%len(topics)]
+				key := topicKey(1, topic)
+				unlock := f.lock(key)
+				mu.Lock()
+				seq++
+				s := seq
+				history[string(topic)] = append(history[string(topic)], s)
+				mu.Unlock()
+				f.submit(key, func() {
+					mu.Lock()
+					delivered[string(topic)] = append(delivered[string(topic)], s)
+					mu.Unlock()
+					wg.Done()
+				})
+				unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	for _, topic := range topics {
+		assert.Equal(t, history[string(topic)], delivered[string(topic)], "messages of topic %s out of order", topic)
+	}
+}
+
+func TestFanOutQueueDepth(t *testing.T) {
+	svc := &_Service{
+		meter:  NewMeter(),
+		fanOut: newFanOut(config.FanOutConfig{Workers: 1, QueueSize: 2, QueuePolicy: config.QueuePolicyDropOldest}),
+	}
+	c := &_Conn{service: svc, pub: make(chan *lp.Publish, 2), closeC: make(chan struct{})}
+	for i := 0; i < 3; i++ {
+		assert.True(t, c.enqueue(&lp.Publish{MessageID: uint16(i + 1)}))
+	}
+	// the oldest message is dropped.
+	assert.Equal(t, int64(2), svc.meter.QueueDepth.Count())
+	assert.Equal(t, int64(1), svc.meter.Drops.Count())
+
+	// messages left in the queue of the closed connection are removed.
+	close(c.closeC)
+	c.drain()
+	assert.Equal(t, int64(0), svc.meter.QueueDepth.Count())
+	assert.False(t, c.enqueue(&lp.Publish{MessageID: 4}))
+	assert.Equal(t, int64(0), svc.meter.QueueDepth.Count())
+}
+
+func TestIdleTimeout(t *testing.T) {
+	conn := config.ConnConfig{KeepAlive: "60s", IdleTimeout: "30s"}
+	// the client keepalive overrides the smaller idle timeout.
+	assert.Equal(t, 90*time.Second, conn.IdleTimeoutDuration(conn.KeepAliveDuration()))
+	assert.Equal(t, 300*time.Second, conn.IdleTimeoutDuration(200*time.Second))
+	// the larger idle timeout is used.
+	assert.Equal(t, 30*time.Second, conn.IdleTimeoutDuration(10*time.Second))
+	conn.IdleTimeout = ""
+	assert.Equal(t, 15*time.Second, conn.IdleTimeoutDuration(10*time.Second))
+}
+
+func TestSessionRedelivery(t *testing.T) {
+	sessions := newSessions()
+	clientid := uid.ID([]byte("client.1"))
+	s := sessions.attach(clientid, false)
+	topic := []byte("unit1.test")
+	for i := 0; i < nDelivered+1; i++ {
+		s.deliver(deliveryID(topic, []byte(fmt.Sprintf("msg.%d", i))))
+	}
+	// the oldest message is evicted.
+	assert.False(t, s.isDelivered(deliveryID(topic, []byte("msg.0"))))
+	assert.True(t, s.isDelivered(deliveryID(topic, []byte("msg.1"))))
+	assert.True(t, s.isDelivered(deliveryID(topic, []byte(fmt.Sprintf("msg.%d", nDelivered)))))
+
+	// session is resumed on reconnect.
+	sessions.detach(s, time.Now())
+	assert.Equal(t, s, sessions.attach(clientid, false))
+	assert.True(t, s.isDelivered(deliveryID(topic, []byte("msg.1"))))
+
+	// clean session starts a new session.
+	sessions.detach(s, time.Now())
+	clean := sessions.attach(clientid, true)
+	assert.False(t, clean.isDelivered(deliveryID(topic, []byte("msg.1"))))
+
+	// session without connection is expired after session timeout.
+	sessions.detach(clean, time.Now())
+	sessions.expire(time.Now().Add(2 * sessionTimeout))
+	assert.NotEqual(t, clean, sessions.attach(clientid, false))
+}
+
+func TestReplicaRouting(t *testing.T) {
+	dir, err := os.MkdirTemp("", "unitdb-replica")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	storeConfig := fmt.Sprintf(`{"adapters": {"unitdb": {"dir": %q, "mem_size": 1000000, "replication_addr": %q, "replicas": [%q, %q], "max_staleness": 1000}}}`,
+		dir, addr, filepath.Join(dir, "replica1"), filepath.Join(dir, "replica2"))
+	assert.NoError(t, store.Open(storeConfig, true))
+	defer store.Close()
+
+	contract := uint32(3376684800)
+	topic := []byte("unit1.replica")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.Message.Put(contract, topic, []byte(fmt.Sprintf("msg.%d", i))))
+	}
+	// a Get with zero staleness is served from the primary or a replica caught up with the primary.
+	for i := 0; i < 4; i++ {
+		msgs, err := store.Message.Get(contract, []byte("unit1.replica?stale=0"))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(msgs))
+	}
+	// replicas catch up with the primary and serve the Gets.
+	for i := 0; i < 50; i++ {
+		msgs, err := store.Message.Get(contract, topic)
+		assert.NoError(t, err)
+		if len(msgs) == 3 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("expected replicas to catch up with the primary")
+}
+
+func TestMqttLineProto(t *testing.T) {
+	proto := &mqtt.LineProto{}
+	str := func(s string) []byte { return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...) }
+	packet := func(head byte, body []byte) []byte { return append([]byte{head, byte(len(body))}, body...) }
+
+	// connect with the topic key as the password.
+	connect := append(str("MQTT"), 4, 0x42, 0, 60)
+	connect = append(append(connect, str("client1")...), str("key1")...)
+	sub := append([]byte{0, 1}, append(str("sensors/+/temp"), 1)...)
+	sub = append(sub, append(str("sensors/#"), 0)...)
+	pub := append(str("sensors/room1/temp"), 0, 2)
+	pub = append(pub, "21.5"...)
+	var buf bytes.Buffer
+	buf.Write(packet(lp.CONNECT<<4, connect))
+	buf.Write(packet(lp.SUBSCRIBE<<4|0x02, sub))
+	buf.Write(packet(lp.PUBLISH<<4|0x02, pub))
+
+	pkt, err := lp.ReadPacket(proto, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("client1"), pkt.(*lp.Connect).ClientID)
+	pkt, err = lp.ReadPacket(proto, &buf)
+	assert.NoError(t, err)
+	subs := pkt.(*lp.Subscribe).Subscriptions
+	assert.Equal(t, "key1/sensors.*.temp?last=1", string(subs[0].Topic))
+	assert.Equal(t, uint8(1), subs[0].Qos)
+	assert.Equal(t, "key1/sensors...?last=1", string(subs[1].Topic))
+	pkt, err = lp.ReadPacket(proto, &buf)
+	assert.NoError(t, err)
+	p := pkt.(*lp.Publish)
+	assert.Equal(t, "key1/sensors.room1.temp", string(p.Topic))
+	assert.Equal(t, uint16(2), p.MessageID)
+	assert.Equal(t, []byte("21.5"), p.Payload)
+
+	// messages are delivered on the MQTT topic.
+	m, err := lp.Encode(proto, &lp.Publish{FixedHeader: lp.FixedHeader{Qos: 1}, MessageID: 3, Topic: []byte("sensors.room1.temp"), Payload: []byte("22")})
+	assert.NoError(t, err)
+	assert.True(t, bytes.Contains(m.Bytes(), []byte("sensors/room1/temp")))
+	pkt, err = (&mqtt.LineProto{}).ReadPacket(&m)
+	assert.NoError(t, err)
+	assert.Equal(t, "sensors.room1.temp", string(pkt.(*lp.Publish).Topic))
+}
+
+func TestMatchMQTT(t *testing.T) {
+	match := listener.MatchMQTT()
+	connect := &lp.Connect{ProtoName: []byte("MQTT"), Version: 4, KeepAlive: 60, ClientID: []byte("client1")}
+	m, err := lp.Encode(&mqtt.LineProto{}, connect)
+	assert.NoError(t, err)
+	assert.True(t, match(bytes.NewReader(m.Bytes())))
+
+	// connections of the other protocols on the listener are not matched.
+	m, err = lp.Encode(&grpc.LineProto{}, connect)
+	assert.NoError(t, err)
+	assert.False(t, match(bytes.NewReader(m.Bytes())))
+	assert.False(t, match(bytes.NewReader([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))))
+	assert.False(t, match(bytes.NewReader([]byte("GET / HTTP/1.1\r\n"))))
+}
+
+func TestListenerTransports(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "unitdb.sock")
+	// stale socket file left by unclean shutdown.
+	stale, err := net.Listen("unix", sock)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	dials := map[string]func() (net.Conn, error){
+		"inproc:unitdb.test": func() (net.Conn, error) { return common.DialInProc("unitdb.test") },
+		"unix:" + sock:       func() (net.Conn, error) { return net.Dial("unix", sock) },
+	}
+	for addr, dial := range dials {
+		l, err := listener.New(addr)
+		if !assert.NoError(t, err, addr) {
+			continue
+		}
+		l.ServeCallback(listener.MatchAny(), func(ml net.Listener) error {
+			c, err := ml.Accept()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			_, err = io.Copy(c, io.LimitReader(c, 4))
+			return err
+		})
+		go l.Serve()
+
+		c, err := dial()
+		if !assert.NoError(t, err, addr) {
+			l.Close()
+			continue
+		}
+		c.Write([]byte("ping"))
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(c, buf)
+		assert.NoError(t, err, addr)
+		assert.Equal(t, "ping", string(buf), addr)
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := &_Service{auth: auth.NewStaticTokens([]auth.Token{{Token: "alpha", Name: "alpha", Contracts: []uint32{1}}, {Token: "reader", Name: "reader", ReadOnly: true}})}
+	clientid := uid.ID(make([]byte, 12))
+	clientid.SetContract(1)
+	topic := security.ParseKey([]byte("key1/unit1.test"))
+
+	// connect with an unknown token is refused.
+	c := &_Conn{service: s, proto: &mqtt.LineProto{}, clientid: clientid}
+	assert.Equal(t, types.ErrBadToken, c.onAuthenticate(lp.Connect{Username: []byte("beta")}))
+	assert.Equal(t, types.ErrUnauthorized, c.authorize(topic, unitdb.OpPut))
+
+	// MQTT clients send the token as the username.
+	assert.Nil(t, c.onAuthenticate(lp.Connect{Username: []byte("alpha"), Password: []byte("key1")}))
+	assert.Equal(t, "alpha", c.principal.Name)
+	assert.Nil(t, c.authorize(topic, unitdb.OpPut))
+
+	// contract of another tenant is refused.
+	other := uid.ID(make([]byte, 12))
+	other.SetContract(2)
+	c = &_Conn{service: s, clientid: other}
+	assert.Nil(t, c.onAuthenticate(lp.Connect{Password: []byte("alpha")}))
+	assert.Equal(t, types.ErrForbidden, c.authorize(topic, unitdb.OpGet))
+
+	// read only principal is refused to publish.
+	assert.Nil(t, c.onAuthenticate(lp.Connect{Password: []byte("reader")}))
+	assert.Nil(t, c.authorize(topic, unitdb.OpGet))
+	assert.Equal(t, types.ErrForbidden, c.authorize(topic, unitdb.OpPut))
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCert := func(name string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: name}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		assert.NoError(t, err)
+		keyDer, err := x509.MarshalECPrivateKey(key)
 		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+		assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
 	}
+	commonName := func(c *tls.Config) string {
+		cfg, err := c.GetConfigForClient(nil)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		assert.NoError(t, err)
+		return cert.Subject.CommonName
+	}
+
+	writeCert("server1")
+	_, err := newTLS(config.ListenerConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.1"})
+	assert.Equal(t, errTLSVersion, err)
+	s, err := newTLS(config.ListenerConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, MinVersion: "1.3"})
+	assert.NoError(t, err)
+	c := s.config()
+	assert.Equal(t, uint16(tls.VersionTLS13), c.MinVersion)
+	assert.Equal(t, "server1", commonName(c))
+	cfg, err := c.GetConfigForClient(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
 
+	// new connections use the reloaded certificate.
+	writeCert("server2")
+	assert.NoError(t, s.reload())
+	assert.Equal(t, "server2", commonName(c))
 }
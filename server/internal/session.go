@@ -0,0 +1,128 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/server/internal/pkg/uid"
+)
+
+const (
+	// nDelivered is number of the last delivered messages tracked per session.
+	nDelivered = 1024
+	// sessionTimeout is the duration after which a session without connection is expired.
+	sessionTimeout = time.Hour
+)
+
+// _Session tracks the messages last delivered to a client so the messages delivered before the
+// client reconnects are not delivered again when the session is resumed.
+type _Session struct {
+	sync.Mutex
+	delivered map[uint64]struct{}
+	ring      [nDelivered]uint64
+	pos       int
+	conns     int
+	lastSeen  time.Time
+}
+
+func newSession() *_Session {
+	return &_Session{delivered: make(map[uint64]struct{}, nDelivered)}
+}
+
+// deliver records the message delivered to the session evicting the oldest message tracked.
+func (s *_Session) deliver(id uint64) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.delivered[id]; ok {
+		return
+	}
+	if old := s.ring[s.pos]; old != 0 {
+		delete(s.delivered, old)
+	}
+	s.ring[s.pos] = id
+	s.pos = (s.pos + 1) % nDelivered
+	s.delivered[id] = struct{}{}
+}
+
+// isDelivered checks if message was recently delivered to the session.
+func (s *_Session) isDelivered(id uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.delivered[id]
+	return ok
+}
+
+// deliveryID returns the ID of a message delivered to the session. Messages with the same topic
+// and payload are exact duplicates and have the same ID.
+func deliveryID(topic, payload []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(topic)
+	h.Write([]byte{0})
+	h.Write(payload)
+	if id := h.Sum64(); id != 0 {
+		return id
+	}
+	return 1
+}
+
+type _Sessions struct {
+	sync.Mutex
+	m map[string]*_Session
+}
+
+func newSessions() *_Sessions {
+	return &_Sessions{m: make(map[string]*_Session)}
+}
+
+// attach returns the session of the client, a new session is started if client requested clean session.
+func (ss *_Sessions) attach(clientid uid.ID, clean bool) *_Session {
+	ss.Lock()
+	defer ss.Unlock()
+	s, ok := ss.m[string(clientid)]
+	if !ok || clean {
+		s = newSession()
+		ss.m[string(clientid)] = s
+	}
+	s.Lock()
+	s.conns++
+	s.Unlock()
+	return s
+}
+
+// detach marks the connection of the session gone, the session is expired after session timeout.
+func (ss *_Sessions) detach(s *_Session, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.conns--
+	s.lastSeen = now
+}
+
+// expire removes sessions without connection beyond the session timeout.
+func (ss *_Sessions) expire(now time.Time) {
+	ss.Lock()
+	defer ss.Unlock()
+	for id, s := range ss.m {
+		s.Lock()
+		if s.conns <= 0 && now.Sub(s.lastSeen) > sessionTimeout {
+			delete(ss.m, id)
+		}
+		s.Unlock()
+	}
+}
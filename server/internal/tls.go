@@ -0,0 +1,110 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+
+	"github.com/unit-io/unitdb/server/internal/config"
+)
+
+var (
+	errClientCA   = errors.New("no client CA certificate found")
+	errTLSVersion = errors.New("TLS min version is invalid, use 1.2 or 1.3")
+)
+
+// _TLS holds the certificate and the client CAs the listeners terminate TLS with. The certificate
+// and the client CAs are reloaded on SIGHUP, new connections use the reloaded certificate.
+type _TLS struct {
+	mu        sync.RWMutex
+	cfg       config.ListenerConfig
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	minVersion uint16
+	nextProtos []string
+}
+
+// newTLS loads the certificate and the client CAs of the listener configuration.
+func newTLS(cfg config.ListenerConfig) (*_TLS, error) {
+	t := &_TLS{cfg: cfg, minVersion: tls.VersionTLS12, nextProtos: cfg.ALPN}
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		t.minVersion = tls.VersionTLS13
+	default:
+		return nil, errTLSVersion
+	}
+	if len(t.nextProtos) == 0 {
+		t.nextProtos = []string{"h2", "http/1.1"}
+	}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reload loads the certificate and the client CAs from the files of the listener configuration.
+func (t *_TLS) reload() error {
+	cert, err := tls.LoadX509KeyPair(t.cfg.CertFile, t.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if t.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(t.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errClientCA
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cert = &cert
+	t.clientCAs = clientCAs
+	return nil
+}
+
+// config returns the TLS configuration of the listeners. Clients must present a certificate
+// signed by one of the client CAs if client CAs are set.
+func (t *_TLS) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: t.minVersion,
+		NextProtos: t.nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			c := &tls.Config{
+				Certificates: []tls.Certificate{*t.cert},
+				MinVersion:   t.minVersion,
+				NextProtos:   t.nextProtos,
+			}
+			if t.clientCAs != nil {
+				c.ClientCAs = t.clientCAs
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return c, nil
+		},
+	}
+}
@@ -826,16 +826,21 @@ func (m *FixedHeader) GetRemainingLength() int32 {
 
 // Connect represents a connect packet.
 type Conn struct {
-	ProtoName     string `protobuf:"bytes,1,opt,name=protoName" json:"protoName,omitempty"`
-	Version       int32  `protobuf:"varint,2,opt,name=version" json:"version,omitempty"`
-	InsecureFlag  bool   `protobuf:"varint,3,opt,name=insecureFlag" json:"insecureFlag,omitempty"`
-	UsernameFlag  bool   `protobuf:"varint,4,opt,name=usernameFlag" json:"usernameFlag,omitempty"`
-	PasswordFlag  bool   `protobuf:"varint,5,opt,name=passwordFlag" json:"passwordFlag,omitempty"`
-	CleanSessFlag bool   `protobuf:"varint,6,opt,name=cleanSessFlag" json:"cleanSessFlag,omitempty"`
-	KeepAlive     int32  `protobuf:"varint,7,opt,name=keepAlive" json:"keepAlive,omitempty"`
-	ClientID      string `protobuf:"bytes,8,opt,name=clientID" json:"clientID,omitempty"`
-	Username      string `protobuf:"bytes,9,opt,name=username" json:"username,omitempty"`
-	Password      string `protobuf:"bytes,10,opt,name=password" json:"password,omitempty"`
+	ProtoName      string `protobuf:"bytes,1,opt,name=protoName" json:"protoName,omitempty"`
+	Version        int32  `protobuf:"varint,2,opt,name=version" json:"version,omitempty"`
+	InsecureFlag   bool   `protobuf:"varint,3,opt,name=insecureFlag" json:"insecureFlag,omitempty"`
+	UsernameFlag   bool   `protobuf:"varint,4,opt,name=usernameFlag" json:"usernameFlag,omitempty"`
+	PasswordFlag   bool   `protobuf:"varint,5,opt,name=passwordFlag" json:"passwordFlag,omitempty"`
+	CleanSessFlag  bool   `protobuf:"varint,6,opt,name=cleanSessFlag" json:"cleanSessFlag,omitempty"`
+	KeepAlive      int32  `protobuf:"varint,7,opt,name=keepAlive" json:"keepAlive,omitempty"`
+	ClientID       string `protobuf:"bytes,8,opt,name=clientID" json:"clientID,omitempty"`
+	Username       string `protobuf:"bytes,9,opt,name=username" json:"username,omitempty"`
+	Password       string `protobuf:"bytes,10,opt,name=password" json:"password,omitempty"`
+	WillFlag       bool   `protobuf:"varint,11,opt,name=willFlag" json:"willFlag,omitempty"`
+	WillQos        int32  `protobuf:"varint,12,opt,name=willQos" json:"willQos,omitempty"`
+	WillRetainFlag bool   `protobuf:"varint,13,opt,name=willRetainFlag" json:"willRetainFlag,omitempty"`
+	WillTopic      string `protobuf:"bytes,14,opt,name=willTopic" json:"willTopic,omitempty"`
+	WillMessage    []byte `protobuf:"bytes,15,opt,name=willMessage,proto3" json:"willMessage,omitempty"`
 }
 
 func (m *Conn) Reset()                    { *m = Conn{} }
@@ -913,6 +918,41 @@ func (m *Conn) GetPassword() string {
 	return ""
 }
 
+func (m *Conn) GetWillFlag() bool {
+	if m != nil {
+		return m.WillFlag
+	}
+	return false
+}
+
+func (m *Conn) GetWillQos() int32 {
+	if m != nil {
+		return m.WillQos
+	}
+	return 0
+}
+
+func (m *Conn) GetWillRetainFlag() bool {
+	if m != nil {
+		return m.WillRetainFlag
+	}
+	return false
+}
+
+func (m *Conn) GetWillTopic() string {
+	if m != nil {
+		return m.WillTopic
+	}
+	return ""
+}
+
+func (m *Conn) GetWillMessage() []byte {
+	if m != nil {
+		return m.WillMessage
+	}
+	return nil
+}
+
 // Connack represents a connack packet.
 // 0x00 connection accepted
 // 0x01 refused: unacceptable proto version
@@ -1630,79 +1670,83 @@ var _Unitdb_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("unitdb.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 1183 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x5d, 0x6f, 0xdb, 0x36,
-	0x17, 0xf6, 0x97, 0x24, 0xeb, 0xc8, 0x49, 0xf4, 0xf2, 0x2d, 0x06, 0x23, 0x2b, 0xfa, 0x21, 0x64,
-	0x6b, 0xd0, 0x61, 0x46, 0x91, 0xed, 0x62, 0xb7, 0x89, 0xed, 0x2e, 0xc6, 0x92, 0xd4, 0xa5, 0xe2,
-	0x61, 0x1f, 0x17, 0x83, 0x2c, 0xb1, 0xa9, 0x10, 0x59, 0x52, 0x48, 0xaa, 0x5d, 0xfe, 0xc1, 0xfe,
-	0xc3, 0x2e, 0xf7, 0x4f, 0x76, 0xb1, 0xdf, 0x35, 0x1c, 0x92, 0xb2, 0x9c, 0x0d, 0xab, 0xb7, 0xa2,
-	0x57, 0xe6, 0x39, 0xcf, 0xa3, 0xf3, 0xf1, 0x90, 0x3c, 0x26, 0x0c, 0xaa, 0x3c, 0x95, 0xc9, 0x72,
-	0x54, 0xf2, 0x42, 0x16, 0x81, 0x03, 0xd6, 0x74, 0x55, 0xca, 0xdb, 0xe0, 0x3e, 0xd8, 0xf3, 0x28,
-	0xbe, 0x66, 0x92, 0x10, 0xe8, 0x25, 0x91, 0x8c, 0x86, 0xed, 0x47, 0xed, 0xc3, 0x01, 0x55, 0xeb,
-	0xe0, 0x47, 0xe8, 0x8f, 0x8b, 0x3c, 0x9f, 0xe5, 0xaf, 0x0a, 0xf2, 0x31, 0xb8, 0x71, 0x96, 0xb2,
-	0x5c, 0xfe, 0x94, 0x26, 0x8a, 0xe4, 0xd2, 0xbe, 0x76, 0xcc, 0x12, 0x32, 0x04, 0x27, 0x67, 0xf2,
-	0x6d, 0xc1, 0xaf, 0x87, 0x1d, 0x05, 0xd5, 0x26, 0x22, 0x51, 0x92, 0x70, 0x26, 0xc4, 0xb0, 0xab,
-	0x11, 0x63, 0x06, 0xbf, 0x74, 0xc0, 0x9a, 0xe5, 0xe7, 0xe2, 0x8a, 0x1c, 0x80, 0x53, 0xa6, 0xf9,
-	0x15, 0x67, 0x37, 0x2a, 0xb0, 0x77, 0xd4, 0x1f, 0xcd, 0xb5, 0x7d, 0xda, 0xa2, 0x35, 0x44, 0x1e,
-	0x40, 0x57, 0x54, 0x4b, 0x15, 0xdf, 0x3b, 0x82, 0x51, 0x58, 0x2d, 0x45, 0xcc, 0xd3, 0x25, 0x3b,
-	0x6d, 0x51, 0x04, 0xc8, 0x01, 0x58, 0x55, 0x8e, 0x8c, 0xae, 0x62, 0x0c, 0x46, 0x0b, 0xb4, 0xd6,
-	0x1c, 0x0d, 0x92, 0xfb, 0xd0, 0x2d, 0xab, 0xe5, 0xb0, 0x57, 0xe7, 0xa9, 0x96, 0x59, 0x2a, 0x5e,
-	0x63, 0x8c, 0xb2, 0x5a, 0x92, 0x4f, 0xc0, 0xba, 0xa9, 0x18, 0xbf, 0x1d, 0x5a, 0x0a, 0xdf, 0x19,
-	0xbd, 0x44, 0x8b, 0xb2, 0x9b, 0x8a, 0x09, 0x89, 0x41, 0x14, 0x4a, 0x1e, 0x62, 0x10, 0x39, 0xb4,
-	0x15, 0xc9, 0x1b, 0xcd, 0x2b, 0xd9, 0x50, 0x10, 0x21, 0x01, 0x74, 0x13, 0x96, 0x0d, 0x1d, 0x45,
-	0xd8, 0x1d, 0x4d, 0x58, 0xc6, 0x24, 0xdb, 0xe0, 0x24, 0x2c, 0x3b, 0x71, 0xc1, 0x39, 0x67, 0x42,
-	0x44, 0x57, 0x2c, 0xf8, 0xa3, 0x03, 0xf6, 0x8b, 0x4a, 0xa2, 0x16, 0x4f, 0xa0, 0xaf, 0x1b, 0x16,
-	0xa5, 0x11, 0xc3, 0x35, 0x62, 0x88, 0xf2, 0xb4, 0x45, 0xd7, 0x20, 0x79, 0x0c, 0xb6, 0xa8, 0x96,
-	0x51, 0x7c, 0x6d, 0x14, 0x71, 0x50, 0x91, 0x28, 0xbe, 0x3e, 0x6d, 0x51, 0x03, 0x60, 0x2c, 0xd5,
-	0x34, 0x92, 0xba, 0x26, 0xd6, 0xc2, 0x38, 0x30, 0x56, 0x0d, 0x6e, 0x11, 0xe5, 0x31, 0xd8, 0xa5,
-	0x0e, 0x62, 0x99, 0x4c, 0xf3, 0x75, 0x26, 0x0d, 0x90, 0x03, 0xe8, 0xa9, 0x8a, 0x6d, 0xd3, 0xb0,
-	0x91, 0x4d, 0x94, 0x45, 0x2e, 0x50, 0x7c, 0x85, 0x92, 0x43, 0x70, 0xca, 0x4a, 0x2a, 0xa2, 0x63,
-	0xf6, 0x48, 0x49, 0xb7, 0xa6, 0xd5, 0x30, 0xf9, 0x0c, 0x9c, 0x84, 0x65, 0x8a, 0xd9, 0x57, 0xcc,
-	0xbd, 0xb5, 0x86, 0x0d, 0xd9, 0x30, 0x36, 0x85, 0xfc, 0xad, 0x0d, 0xde, 0xf3, 0xf4, 0x67, 0x96,
-	0x9c, 0xb2, 0x28, 0x61, 0x9c, 0x8c, 0xc0, 0x5b, 0x69, 0xe8, 0xf2, 0xb6, 0x64, 0x4a, 0xd0, 0xdd,
-	0xa3, 0xc1, 0xe8, 0xbc, 0xf1, 0xd1, 0x4d, 0x02, 0xf1, 0xa1, 0x9b, 0x54, 0xa5, 0x52, 0xb4, 0x4f,
-	0x71, 0x89, 0x9e, 0x9b, 0x42, 0x9f, 0x5d, 0x8b, 0xe2, 0x92, 0x7c, 0x04, 0x36, 0x67, 0x32, 0x4a,
-	0x73, 0xa5, 0x57, 0x9f, 0x1a, 0x8b, 0x1c, 0xc2, 0x1e, 0x67, 0xab, 0x28, 0xcd, 0xd3, 0xfc, 0xea,
-	0x8c, 0xe5, 0x57, 0xf2, 0xb5, 0xd2, 0xcb, 0xa2, 0x7f, 0x75, 0x07, 0xbf, 0x77, 0xa0, 0x87, 0xf7,
-	0x8a, 0xdc, 0x07, 0x57, 0xdd, 0xc7, 0x8b, 0x68, 0xc5, 0xcc, 0x9d, 0x6a, 0x1c, 0x78, 0x75, 0xde,
-	0x30, 0x2e, 0xd2, 0x22, 0x57, 0x05, 0x59, 0xb4, 0x36, 0x49, 0x00, 0x83, 0x34, 0x17, 0x2c, 0xae,
-	0x38, 0x7b, 0x9e, 0x45, 0x57, 0xaa, 0xba, 0x3e, 0xbd, 0xe3, 0x43, 0x4e, 0x25, 0x18, 0xcf, 0xa3,
-	0x95, 0xe6, 0xe8, 0x62, 0xef, 0xf8, 0x90, 0x53, 0x46, 0x42, 0xbc, 0x2d, 0x78, 0xa2, 0x38, 0x96,
-	0xe6, 0x6c, 0xfa, 0xc8, 0x01, 0xec, 0xc4, 0x19, 0x8b, 0xf2, 0x90, 0x09, 0xa1, 0x48, 0xb6, 0x22,
-	0xdd, 0x75, 0x62, 0x27, 0xd7, 0x8c, 0x95, 0xc7, 0x59, 0xfa, 0x86, 0xa9, 0xcd, 0xb5, 0x68, 0xe3,
-	0x20, 0xfb, 0x50, 0x8f, 0x8a, 0x89, 0xda, 0xcf, 0x66, 0x74, 0x4c, 0x10, 0xab, 0x6b, 0x1a, 0xba,
-	0x1a, 0xab, 0x6d, 0xc4, 0xea, 0x5a, 0x86, 0xa0, 0xb1, 0xda, 0x0e, 0x8e, 0xc1, 0x41, 0x0d, 0xf1,
-	0xf4, 0x3d, 0x00, 0xe0, 0x4c, 0x56, 0x3c, 0x1f, 0x17, 0x89, 0xd6, 0xd1, 0xa2, 0x1b, 0x1e, 0xdc,
-	0xb1, 0x18, 0xc7, 0xd8, 0xc4, 0xe8, 0x68, 0xac, 0xc0, 0x05, 0xc7, 0xcc, 0x99, 0x00, 0xa0, 0x5f,
-	0xdf, 0xb2, 0xe0, 0x29, 0xc0, 0x24, 0x15, 0xc8, 0x61, 0xb1, 0xc4, 0xce, 0xcc, 0x09, 0x99, 0x4d,
-	0x4c, 0xec, 0xc6, 0x11, 0x9c, 0xc0, 0x60, 0x73, 0x44, 0xbc, 0x9b, 0x4d, 0xee, 0x81, 0x25, 0x8b,
-	0x32, 0x8d, 0xcd, 0x90, 0xd4, 0x46, 0xf0, 0x0c, 0x6c, 0xca, 0x44, 0x95, 0xc9, 0x06, 0x6f, 0x6f,
-	0xe0, 0x78, 0x04, 0x39, 0x13, 0xc3, 0xce, 0xa3, 0xee, 0xa1, 0x4b, 0x71, 0x19, 0xbc, 0x82, 0x9d,
-	0x3b, 0x37, 0x6c, 0x4b, 0xda, 0xc7, 0xe0, 0x70, 0x95, 0x40, 0x07, 0xc1, 0x1b, 0xac, 0x13, 0xd2,
-	0xda, 0x8f, 0x99, 0x19, 0xe7, 0x05, 0x37, 0x43, 0x5a, 0x1b, 0x41, 0x06, 0xd0, 0xcc, 0xb6, 0xf7,
-	0xe9, 0x0d, 0xcf, 0x70, 0x19, 0xdd, 0x66, 0x45, 0x94, 0xd4, 0xe3, 0xdf, 0x98, 0xd8, 0x95, 0x94,
-	0x99, 0x3a, 0x96, 0x2e, 0xc5, 0x65, 0x70, 0x0c, 0xde, 0xc6, 0x38, 0xd8, 0x9e, 0x4e, 0x17, 0xdc,
-	0xd9, 0x2c, 0x78, 0x0c, 0x3b, 0x77, 0x66, 0xed, 0x7b, 0xed, 0xc7, 0x04, 0x76, 0xef, 0x0e, 0x9b,
-	0xf7, 0x2a, 0x25, 0x05, 0xc7, 0xcc, 0xd1, 0x0f, 0x2f, 0x1c, 0x4e, 0xa4, 0xde, 0x7a, 0x22, 0x05,
-	0x9f, 0x82, 0x3d, 0xaf, 0x07, 0xf9, 0xbb, 0x0e, 0xeb, 0x57, 0x8a, 0xc7, 0x59, 0xbc, 0xa5, 0x22,
-	0x93, 0xa1, 0xd3, 0x64, 0xa8, 0xbf, 0xcc, 0xfe, 0xf3, 0x97, 0x4f, 0x94, 0x0c, 0x71, 0xb1, 0x2a,
-	0xb7, 0x14, 0xf7, 0x25, 0xc0, 0xfa, 0x2f, 0x9d, 0xff, 0x83, 0x28, 0x7f, 0x1b, 0xc6, 0xc1, 0x77,
-	0xe0, 0xae, 0xbf, 0xda, 0x52, 0xdb, 0xe7, 0xe0, 0xad, 0xdf, 0x03, 0xbc, 0xbe, 0x09, 0x5e, 0xf3,
-	0x8e, 0xe0, 0x74, 0x13, 0xc7, 0x96, 0xc3, 0x7f, 0x21, 0x6a, 0xd3, 0x72, 0xb7, 0xae, 0xe9, 0x07,
-	0xf0, 0x36, 0x9e, 0x1e, 0x1f, 0xb6, 0xaa, 0x43, 0xe8, 0x2f, 0x9a, 0x7f, 0xed, 0x77, 0x04, 0x7e,
-	0xfa, 0x6b, 0x07, 0xbc, 0x8d, 0xff, 0x39, 0x32, 0x80, 0x3e, 0x9d, 0x86, 0x53, 0xfa, 0xed, 0x74,
-	0xe2, 0xb7, 0x88, 0x07, 0xce, 0xf8, 0xc5, 0xc5, 0xc5, 0x74, 0x7c, 0xe9, 0xb7, 0x6b, 0xe3, 0x78,
-	0xfc, 0x8d, 0xdf, 0x41, 0x63, 0xbe, 0x38, 0x39, 0x9b, 0x85, 0xa7, 0x7e, 0x97, 0x00, 0xd8, 0xf3,
-	0xc5, 0x09, 0x02, 0x3d, 0xb3, 0xa6, 0xd3, 0xb1, 0x6f, 0xad, 0xd7, 0x67, 0xbe, 0x6d, 0x3e, 0x18,
-	0xbf, 0x38, 0x9f, 0xfb, 0x0e, 0xd9, 0x01, 0x37, 0x5c, 0x9c, 0x84, 0x63, 0x3a, 0x3b, 0x99, 0xfa,
-	0x7d, 0xe4, 0x85, 0xfa, 0x7b, 0x97, 0xec, 0x81, 0xb7, 0xb8, 0x68, 0x40, 0xc0, 0x8a, 0x94, 0x03,
-	0x61, 0x4f, 0x85, 0x99, 0x5d, 0x7c, 0x4d, 0xa7, 0x2f, 0xfd, 0x01, 0x42, 0xda, 0x08, 0xe7, 0xfe,
-	0x0e, 0x71, 0xc1, 0x7a, 0xb9, 0x98, 0xd2, 0xef, 0xfd, 0x5d, 0x0c, 0x48, 0xa7, 0xe1, 0xe2, 0xec,
-	0xd2, 0xdf, 0x23, 0x0e, 0x74, 0xe7, 0x8b, 0x4b, 0xdf, 0xd7, 0x15, 0x5c, 0x2a, 0xf2, 0xff, 0xd0,
-	0x3b, 0x99, 0x9e, 0xf9, 0x04, 0xbd, 0x93, 0xe9, 0x99, 0xf2, 0xfe, 0x9f, 0xec, 0x02, 0x4c, 0x66,
-	0x61, 0xdd, 0xf2, 0xbd, 0xa3, 0x18, 0xec, 0x85, 0x7a, 0x10, 0x93, 0x87, 0x60, 0x85, 0x32, 0xe2,
-	0x92, 0xb8, 0xa3, 0xfa, 0xad, 0xbb, 0xdf, 0x2c, 0x83, 0x16, 0x79, 0x00, 0x76, 0x28, 0x39, 0x8b,
-	0x56, 0xc4, 0x19, 0xe9, 0xb7, 0xf2, 0x7e, 0xbd, 0x38, 0x6c, 0x3f, 0x6b, 0x93, 0x21, 0xf4, 0x42,
-	0x59, 0x94, 0xc4, 0x1e, 0xa9, 0x27, 0xf5, 0xbe, 0xf9, 0x0d, 0x5a, 0x4b, 0x5b, 0xfd, 0x97, 0x7f,
-	0xf1, 0x67, 0x00, 0x00, 0x00, 0xff, 0xff, 0xb1, 0x06, 0x0c, 0x60, 0x7c, 0x0b, 0x00, 0x00,
+	// 1242 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0xdb, 0x6e, 0xdb, 0x46,
+	0x13, 0xb6, 0x0e, 0x24, 0xc5, 0xa1, 0x24, 0xf3, 0xdf, 0x3f, 0x28, 0x08, 0x37, 0xc8, 0x81, 0x70,
+	0x13, 0x23, 0x45, 0x85, 0xc0, 0xed, 0x45, 0x6f, 0x6d, 0x49, 0xa9, 0x85, 0xda, 0x8e, 0xbc, 0xb4,
+	0x8a, 0x1e, 0x2e, 0x0a, 0x4a, 0xdc, 0x38, 0x84, 0x29, 0x92, 0xde, 0x25, 0x93, 0xfa, 0x0d, 0xfa,
+	0x0e, 0xbd, 0xec, 0xbb, 0xf4, 0x39, 0xfa, 0x28, 0xc5, 0xec, 0x2e, 0x45, 0x2a, 0x45, 0xe3, 0x36,
+	0xc8, 0x15, 0x67, 0xe6, 0xfb, 0x76, 0x76, 0xf6, 0x5b, 0xee, 0xec, 0x42, 0xbf, 0x4c, 0xe3, 0x22,
+	0x5a, 0x8e, 0x72, 0x9e, 0x15, 0x99, 0x6f, 0x81, 0x31, 0x5d, 0xe7, 0xc5, 0xad, 0x7f, 0x1f, 0xcc,
+	0x79, 0xb8, 0xba, 0x66, 0x05, 0x21, 0xd0, 0x8d, 0xc2, 0x22, 0xf4, 0x5a, 0x8f, 0x5a, 0x07, 0x7d,
+	0x2a, 0x6d, 0xff, 0x27, 0xe8, 0x8d, 0xb3, 0x34, 0x9d, 0xa5, 0xaf, 0x32, 0xf2, 0x29, 0xd8, 0xab,
+	0x24, 0x66, 0x69, 0xf1, 0x73, 0x1c, 0x49, 0x92, 0x4d, 0x7b, 0x2a, 0x30, 0x8b, 0x88, 0x07, 0x56,
+	0xca, 0x8a, 0xb7, 0x19, 0xbf, 0xf6, 0xda, 0x12, 0xaa, 0x5c, 0x44, 0xc2, 0x28, 0xe2, 0x4c, 0x08,
+	0xaf, 0xa3, 0x10, 0xed, 0xfa, 0xbf, 0xb6, 0xc1, 0x98, 0xa5, 0x67, 0xe2, 0x8a, 0xec, 0x83, 0x95,
+	0xc7, 0xe9, 0x15, 0x67, 0x37, 0x32, 0xb1, 0x73, 0xd8, 0x1b, 0xcd, 0x95, 0x7f, 0xb2, 0x43, 0x2b,
+	0x88, 0x3c, 0x80, 0x8e, 0x28, 0x97, 0x32, 0xbf, 0x73, 0x08, 0xa3, 0xa0, 0x5c, 0x8a, 0x15, 0x8f,
+	0x97, 0xec, 0x64, 0x87, 0x22, 0x40, 0xf6, 0xc1, 0x28, 0x53, 0x64, 0x74, 0x24, 0xa3, 0x3f, 0x5a,
+	0xa4, 0xa2, 0xc1, 0x51, 0x20, 0xb9, 0x0f, 0x9d, 0xbc, 0x5c, 0x7a, 0xdd, 0x6a, 0x9e, 0x72, 0x99,
+	0xc4, 0xe2, 0x35, 0xe6, 0xc8, 0xcb, 0x25, 0xf9, 0x0c, 0x8c, 0x9b, 0x92, 0xf1, 0x5b, 0xcf, 0x90,
+	0xf8, 0x60, 0x74, 0x81, 0x1e, 0x65, 0x37, 0x25, 0x13, 0x05, 0x26, 0x91, 0x28, 0x79, 0x88, 0x49,
+	0x0a, 0xcf, 0x94, 0x24, 0x67, 0x34, 0x2f, 0x8b, 0x9a, 0x82, 0x08, 0xf1, 0xa1, 0x13, 0xb1, 0xc4,
+	0xb3, 0x24, 0x61, 0x38, 0x9a, 0xb0, 0x84, 0x15, 0xac, 0xc1, 0x89, 0x58, 0x72, 0x6c, 0x83, 0x75,
+	0xc6, 0x84, 0x08, 0xaf, 0x98, 0xff, 0x47, 0x1b, 0xcc, 0x97, 0x65, 0x81, 0x5a, 0x3c, 0x85, 0x9e,
+	0x5a, 0xb0, 0xc8, 0xb5, 0x18, 0xb6, 0x16, 0x43, 0xe4, 0x27, 0x3b, 0x74, 0x03, 0x92, 0xc7, 0x60,
+	0x8a, 0x72, 0x19, 0xae, 0xae, 0xb5, 0x22, 0x16, 0x2a, 0x12, 0xae, 0xae, 0x4f, 0x76, 0xa8, 0x06,
+	0x30, 0x57, 0x99, 0x6a, 0x52, 0x47, 0xe7, 0x5a, 0xe8, 0x00, 0xe6, 0xaa, 0xc0, 0x3b, 0x44, 0x79,
+	0x0c, 0x66, 0xae, 0x92, 0x18, 0x7a, 0xa6, 0xf9, 0x66, 0x26, 0x05, 0x90, 0x7d, 0xe8, 0xca, 0x8a,
+	0x4d, 0xbd, 0x60, 0x2d, 0x9b, 0xc8, 0xb3, 0x54, 0xa0, 0xf8, 0x12, 0x25, 0x07, 0x60, 0xe5, 0x65,
+	0x21, 0x89, 0x96, 0xde, 0x23, 0x29, 0xdd, 0x86, 0x56, 0xc1, 0xe4, 0x73, 0xb0, 0x22, 0x96, 0x48,
+	0x66, 0x4f, 0x32, 0x77, 0x37, 0x1a, 0xd6, 0x64, 0xcd, 0x68, 0x0a, 0xf9, 0x7b, 0x0b, 0x9c, 0x17,
+	0xf1, 0x2f, 0x2c, 0x3a, 0x61, 0x61, 0xc4, 0x38, 0x19, 0x81, 0xb3, 0x56, 0xd0, 0xe5, 0x6d, 0xce,
+	0xa4, 0xa0, 0xc3, 0xc3, 0xfe, 0xe8, 0xac, 0x8e, 0xd1, 0x26, 0x81, 0xb8, 0xd0, 0x89, 0xca, 0x5c,
+	0x2a, 0xda, 0xa3, 0x68, 0x62, 0xe4, 0x26, 0x53, 0xff, 0xae, 0x41, 0xd1, 0x24, 0x9f, 0x80, 0xc9,
+	0x59, 0x11, 0xc6, 0xa9, 0xd4, 0xab, 0x47, 0xb5, 0x47, 0x0e, 0x60, 0x97, 0xb3, 0x75, 0x18, 0xa7,
+	0x71, 0x7a, 0x75, 0xca, 0xd2, 0xab, 0xe2, 0xb5, 0xd4, 0xcb, 0xa0, 0xef, 0x86, 0xfd, 0x3f, 0x3b,
+	0xd0, 0xc5, 0x73, 0x45, 0xee, 0x83, 0x2d, 0xcf, 0xe3, 0x79, 0xb8, 0x66, 0xfa, 0x4c, 0xd5, 0x01,
+	0x3c, 0x3a, 0x6f, 0x18, 0x17, 0x71, 0x96, 0xca, 0x82, 0x0c, 0x5a, 0xb9, 0xc4, 0x87, 0x7e, 0x9c,
+	0x0a, 0xb6, 0x2a, 0x39, 0x7b, 0x91, 0x84, 0x57, 0xb2, 0xba, 0x1e, 0xdd, 0x8a, 0x21, 0xa7, 0x14,
+	0x8c, 0xa7, 0xe1, 0x5a, 0x71, 0x54, 0xb1, 0x5b, 0x31, 0xe4, 0xe4, 0xa1, 0x10, 0x6f, 0x33, 0x1e,
+	0x49, 0x8e, 0xa1, 0x38, 0xcd, 0x18, 0xd9, 0x87, 0xc1, 0x2a, 0x61, 0x61, 0x1a, 0x30, 0x21, 0x24,
+	0xc9, 0x94, 0xa4, 0xed, 0x20, 0xae, 0xe4, 0x9a, 0xb1, 0xfc, 0x28, 0x89, 0xdf, 0x30, 0xb9, 0xb9,
+	0x06, 0xad, 0x03, 0x64, 0x0f, 0xaa, 0x56, 0x31, 0xf1, 0x7a, 0x5b, 0xad, 0x63, 0x82, 0x58, 0x55,
+	0x93, 0x67, 0x2b, 0xac, 0xf2, 0x11, 0xab, 0x6a, 0xf1, 0x40, 0x61, 0x95, 0x8f, 0xd8, 0xdb, 0x38,
+	0x49, 0x64, 0x49, 0x8e, 0x2c, 0x69, 0xe3, 0xa3, 0x72, 0x68, 0x5f, 0x64, 0xc2, 0xeb, 0x2b, 0xe5,
+	0xb4, 0x4b, 0x9e, 0xc0, 0x10, 0x4d, 0x2a, 0xb7, 0x4c, 0x8e, 0x1d, 0xc8, 0xb1, 0xef, 0x44, 0x71,
+	0x3d, 0x18, 0xb9, 0xcc, 0xf2, 0x78, 0xe5, 0x0d, 0xd5, 0xce, 0x6c, 0x02, 0xe4, 0x11, 0x38, 0xe8,
+	0xe8, 0xdf, 0xc8, 0xdb, 0x95, 0x2d, 0xb3, 0x19, 0xf2, 0x8f, 0xc0, 0xc2, 0x1d, 0xc6, 0xb3, 0xf1,
+	0x00, 0x80, 0xb3, 0xa2, 0xe4, 0xe9, 0x38, 0x8b, 0xd4, 0x2e, 0x1b, 0xb4, 0x11, 0xc1, 0xff, 0x69,
+	0x85, 0x4d, 0x76, 0xa2, 0x77, 0x59, 0x7b, 0xbe, 0x0d, 0x96, 0xee, 0x82, 0x3e, 0x40, 0xaf, 0xea,
+	0x01, 0xfe, 0x33, 0x80, 0x49, 0x2c, 0x90, 0xc3, 0x56, 0x05, 0xd6, 0xa9, 0xff, 0xdf, 0xd9, 0x44,
+	0xe7, 0xae, 0x03, 0xfe, 0x31, 0xf4, 0x9b, 0x0d, 0xec, 0xfd, 0x6c, 0x72, 0x0f, 0x8c, 0x42, 0xae,
+	0x57, 0xb5, 0x70, 0xe5, 0xf8, 0xcf, 0xc1, 0xa4, 0x4c, 0x94, 0x49, 0x51, 0xe3, 0xad, 0x06, 0x8e,
+	0x07, 0x84, 0x33, 0xe1, 0xb5, 0x1f, 0x75, 0x0e, 0x6c, 0x8a, 0xa6, 0xff, 0x0a, 0x06, 0x5b, 0xe7,
+	0xff, 0x8e, 0x69, 0x1f, 0x83, 0xc5, 0xe5, 0x04, 0x2a, 0x09, 0xf6, 0x17, 0x35, 0x21, 0xad, 0xe2,
+	0x38, 0x33, 0xe3, 0x3c, 0xe3, 0xfa, 0x0a, 0x51, 0x8e, 0x9f, 0x00, 0xd4, 0x9d, 0xf7, 0x43, 0xd6,
+	0x86, 0xff, 0x49, 0x1e, 0xde, 0x26, 0x59, 0x18, 0x55, 0x97, 0x93, 0x76, 0x71, 0x55, 0x45, 0x91,
+	0xc8, 0x43, 0x63, 0x53, 0x34, 0xfd, 0x23, 0x70, 0x1a, 0xcd, 0xea, 0xee, 0xe9, 0x54, 0xc1, 0xed,
+	0x66, 0xc1, 0x63, 0x18, 0x6c, 0xdd, 0x04, 0x1f, 0xb4, 0x1f, 0x13, 0x18, 0x6e, 0xb7, 0xc2, 0x0f,
+	0x2a, 0x25, 0x06, 0x4b, 0x77, 0xf9, 0x8f, 0x2f, 0x1c, 0xf6, 0xcb, 0xee, 0xa6, 0x5f, 0xfa, 0x4f,
+	0xc0, 0x9c, 0x57, 0xd7, 0xcc, 0xfb, 0x7e, 0xd6, 0xaf, 0x25, 0x8f, 0xb3, 0xd5, 0x1d, 0x15, 0xe9,
+	0x19, 0xda, 0xf5, 0x0c, 0xd5, 0xc8, 0xe4, 0x3f, 0x8f, 0x7c, 0x2a, 0x65, 0x58, 0x65, 0xeb, 0xfc,
+	0x8e, 0xe2, 0xbe, 0x02, 0xd8, 0x3c, 0x38, 0xf8, 0x3f, 0x88, 0xf2, 0xb7, 0xab, 0xc2, 0xff, 0x1e,
+	0xec, 0xcd, 0xa8, 0x3b, 0x6a, 0xfb, 0x02, 0x9c, 0xcd, 0x6b, 0x85, 0x57, 0x27, 0xc1, 0xa9, 0x5f,
+	0x39, 0x9c, 0x36, 0x71, 0x5c, 0x72, 0xf0, 0x2f, 0x44, 0xad, 0x97, 0xdc, 0xa9, 0x6a, 0xfa, 0x11,
+	0x9c, 0xc6, 0xc3, 0xe8, 0xe3, 0x56, 0x75, 0x00, 0xbd, 0x45, 0xfd, 0xa6, 0x78, 0x4f, 0xe2, 0x67,
+	0xbf, 0xb5, 0xc1, 0x69, 0xdc, 0xc2, 0xa4, 0x0f, 0x3d, 0x3a, 0x0d, 0xa6, 0xf4, 0xbb, 0xe9, 0xc4,
+	0xdd, 0x21, 0x0e, 0x58, 0xe3, 0x97, 0xe7, 0xe7, 0xd3, 0xf1, 0xa5, 0xdb, 0xaa, 0x9c, 0xa3, 0xf1,
+	0xb7, 0x6e, 0x1b, 0x9d, 0xf9, 0xe2, 0xf8, 0x74, 0x16, 0x9c, 0xb8, 0x1d, 0x02, 0x60, 0xce, 0x17,
+	0xc7, 0x08, 0x74, 0xb5, 0x4d, 0xa7, 0x63, 0xd7, 0xd8, 0xd8, 0xa7, 0xae, 0xa9, 0x07, 0x8c, 0x5f,
+	0x9e, 0xcd, 0x5d, 0x8b, 0x0c, 0xc0, 0x0e, 0x16, 0xc7, 0xc1, 0x98, 0xce, 0x8e, 0xa7, 0x6e, 0x0f,
+	0x79, 0x81, 0x1a, 0x6f, 0x93, 0x5d, 0x70, 0x16, 0xe7, 0x35, 0x08, 0x58, 0xd1, 0xe2, 0x5c, 0xc3,
+	0x8e, 0x4c, 0x33, 0x3b, 0xff, 0x86, 0x4e, 0x2f, 0xdc, 0x3e, 0x42, 0xca, 0x09, 0xe6, 0xee, 0x80,
+	0xd8, 0x60, 0x5c, 0x2c, 0xa6, 0xf4, 0x07, 0x77, 0x88, 0x09, 0xe9, 0x34, 0x58, 0x9c, 0x5e, 0xba,
+	0xbb, 0xc4, 0x82, 0xce, 0x7c, 0x71, 0xe9, 0xba, 0xaa, 0x82, 0x4b, 0x49, 0xfe, 0x1f, 0x46, 0x27,
+	0xd3, 0x53, 0x97, 0x60, 0x74, 0x32, 0x3d, 0x95, 0xd1, 0xff, 0x93, 0x21, 0xc0, 0x64, 0x16, 0x54,
+	0x4b, 0xbe, 0x77, 0xb8, 0x02, 0x73, 0x21, 0x9f, 0xeb, 0xe4, 0x21, 0x18, 0x41, 0x11, 0xf2, 0x82,
+	0xd8, 0xa3, 0xea, 0x25, 0xbe, 0x57, 0x9b, 0xfe, 0x0e, 0x79, 0x00, 0x66, 0x50, 0x70, 0x16, 0xae,
+	0x89, 0x35, 0x52, 0x2f, 0xf9, 0xbd, 0xca, 0x38, 0x68, 0x3d, 0x6f, 0x11, 0x0f, 0xba, 0x41, 0x91,
+	0xe5, 0xc4, 0x1c, 0xc9, 0x07, 0xff, 0x9e, 0xfe, 0xfa, 0x3b, 0x4b, 0x53, 0xbe, 0x34, 0xbe, 0xfc,
+	0x6b, 0x00, 0x32, 0xf4, 0x8f, 0x2f, 0x1a, 0x0c, 0x00, 0x00,
 }
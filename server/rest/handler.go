@@ -0,0 +1,299 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rest exposes a DB over HTTP with JSON request and response bodies. Topics are
+// queried using the topic query string format, so a query such as "teams.alpha.ch1?last=1h"
+// maps to the URL /topics/teams.alpha.ch1?last=1h.
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unit-io/unitdb"
+	"github.com/unit-io/unitdb/message"
+)
+
+const (
+	topicsPath   = "/topics/"
+	messagesPath = "/messages/"
+	messagesName = "messages"
+	limitsPath   = "/limits"
+)
+
+var (
+	errBadPath   = errors.New("path is invalid")
+	errForbidden = errors.New("operation is not allowed")
+)
+
+type (
+	// messageRequest is the body of a request to put a message.
+	messageRequest struct {
+		Payload  string `json:"payload"`
+		Contract uint32 `json:"contract,omitempty"`
+		TTL      string `json:"ttl,omitempty"`
+	}
+	// messageResponse is the body of a response to put a message.
+	messageResponse struct {
+		ID string `json:"id"`
+	}
+	// queryResponse is the body of a response to a topic query.
+	queryResponse struct {
+		Messages []string `json:"messages"`
+		Cursor   string   `json:"cursor,omitempty"`
+	}
+	// errorResponse is the body of a response to a failed request.
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// handler serves the HTTP endpoints using the DB.
+type handler struct {
+	db   *unitdb.DB
+	opts *_Options
+}
+
+// NewHTTPHandler returns a handler serving the DB with endpoints:
+//
+//	POST   /topics/{topic}/messages     puts the message in the request body to the topic.
+//	GET    /topics/{topic}?last=1h      queries the topic, limit, contract and cursor parameters are supported.
+//	DELETE /messages/{id}               deletes the message with the ID.
+//	GET    /watch/{topic}               upgrades to a WebSocket and pushes the messages put to the topic.
+//	GET    /limits                      responds with the limits of the DB to validate the requests with.
+//
+// Message IDs and cursors are encoded using URL safe base64 without padding.
+func NewHTTPHandler(db *unitdb.DB, opts ...Options) http.Handler {
+	h := &handler{db: db, opts: &_Options{}}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(h.opts)
+		}
+	}
+	return h
+}
+
+// ServeHTTP routes the request to the endpoint.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, topicsPath):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, topicsPath), "/")
+		switch {
+		case len(parts) == 2 && parts[1] == messagesName && r.Method == http.MethodPost:
+			h.put(w, r, parts[0])
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			h.get(w, r, parts[0])
+		case len(parts) > 2 || (len(parts) == 2 && parts[1] != messagesName):
+			writeError(w, http.StatusNotFound, errBadPath)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" is not allowed"))
+		}
+	case strings.HasPrefix(r.URL.Path, messagesPath):
+		if r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" is not allowed"))
+			return
+		}
+		h.delete(w, r, strings.TrimPrefix(r.URL.Path, messagesPath))
+	case strings.HasPrefix(r.URL.Path, watchPath):
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" is not allowed"))
+			return
+		}
+		h.watch(w, r, strings.TrimPrefix(r.URL.Path, watchPath))
+	case r.URL.Path == limitsPath:
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" is not allowed"))
+			return
+		}
+		writeJSON(w, http.StatusOK, h.db.Limits())
+	default:
+		writeError(w, http.StatusNotFound, errBadPath)
+	}
+}
+
+// put puts the message to the topic and responds with the ID of the message.
+func (h *handler) put(w http.ResponseWriter, r *http.Request, topic string) {
+	var req messageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limits := h.db.Limits()
+	if err := limits.CheckTopic([]byte(topic)); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := limits.CheckPayload([]byte(req.Payload)); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !h.authorize(w, r, req.Contract, []byte(topic), unitdb.OpPut) {
+		return
+	}
+	id := h.db.NewID()
+	e := unitdb.NewEntry([]byte(topic), []byte(req.Payload)).WithID(id).WithContract(req.Contract)
+	if req.TTL != "" {
+		e.WithTTL([]byte(req.TTL))
+	}
+	if err := h.db.PutEntryContext(r.Context(), e); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, messageResponse{ID: base64.RawURLEncoding.EncodeToString(id)})
+}
+
+// get queries the topic, the query parameters other than limit, contract and cursor are passed
+// to the DB as the topic query string.
+func (h *handler) get(w http.ResponseWriter, r *http.Request, topic string) {
+	params := r.URL.Query()
+	q := unitdb.NewQuery(nil)
+	var contract uint64
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		q.WithLimit(limit)
+	}
+	if v := params.Get("contract"); v != "" {
+		var err error
+		if contract, err = strconv.ParseUint(v, 10, 32); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		q.WithContract(uint32(contract))
+	}
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		q.WithCursor(cursor)
+	}
+	if !h.authorize(w, r, uint32(contract), []byte(topic), unitdb.OpGet) {
+		return
+	}
+	q.Topic = []byte(topic + topicOptions(params))
+	items, err := h.db.GetContext(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	resp := queryResponse{Messages: make([]string, 0, len(items))}
+	for _, item := range items {
+		resp.Messages = append(resp.Messages, string(item))
+	}
+	if cursor := q.Cursor(); cursor != nil {
+		resp.Cursor = base64.RawURLEncoding.EncodeToString(cursor)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// delete deletes the message with the ID.
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, encodedID string) {
+	id, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil || len(id) == 0 {
+		writeError(w, http.StatusBadRequest, errBadPath)
+		return
+	}
+	// contract is used only to authorize the request, the message is deleted by its ID.
+	contract, _ := strconv.ParseUint(r.URL.Query().Get("contract"), 10, 32)
+	if !h.authorize(w, r, uint32(contract), nil, unitdb.OpDelete) {
+		return
+	}
+	if err := h.db.DeleteByID(id); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// _Conn is the connection of the client of a request.
+type _Conn struct {
+	r *http.Request
+}
+
+// RemoteAddr returns the address of the client.
+func (c _Conn) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", c.r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+// Token returns the bearer token of the Authorization header of the request.
+func (c _Conn) Token() []byte {
+	return []byte(strings.TrimPrefix(c.r.Header.Get("Authorization"), "Bearer "))
+}
+
+// authorize authenticates the client of the request and authorizes the operation on the topic of the contract,
+// it responds with the error and returns false if the client is not authorized.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request, contract uint32, topic []byte, op unitdb.Op) bool {
+	if h.opts.auth == nil {
+		return true
+	}
+	p, err := h.opts.auth.Authenticate(_Conn{r: r})
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return false
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if !h.opts.auth.Authorize(p, contract, topic, op) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return false
+	}
+	return true
+}
+
+// topicOptions returns the topic query string from the query parameters of the request.
+func topicOptions(params url.Values) string {
+	var opts []string
+	for k, vs := range params {
+		if k == "limit" || k == "contract" || k == "cursor" {
+			continue
+		}
+		for _, v := range vs {
+			opts = append(opts, k+"="+v)
+		}
+	}
+	sort.Strings(opts)
+	if len(opts) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(opts, "&")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/unit-io/unitdb"
+)
+
+const (
+	watchPath = "/watch/"
+
+	// watchWriteWait is the time allowed to write a message to the client.
+	watchWriteWait = 10 * time.Second
+)
+
+// watchMessage is the message pushed to the client of a topic watch.
+type watchMessage struct {
+	ID       string `json:"id"`
+	Topic    string `json:"topic"`
+	Payload  string `json:"payload"`
+	StoredAt int64  `json:"storedAt"`
+	Token    string `json:"token,omitempty"`
+}
+
+var watchUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// browser dashboards are often served from another origin.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// watch upgrades the connection to a WebSocket and pushes the messages put to the topic as JSON text frames
+// until the client closes the connection. The topic can be a wildcard topic. The contract and from parameters
+// set the contract of the watch and the resumption token of the last message received by the client.
+func (h *handler) watch(w http.ResponseWriter, r *http.Request, topic string) {
+	params := r.URL.Query()
+	var opts []unitdb.WatchOption
+	var contract uint64
+	if v := params.Get("contract"); v != "" {
+		var err error
+		if contract, err = strconv.ParseUint(v, 10, 32); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts = append(opts, unitdb.WithWatchContract(uint32(contract)))
+	}
+	if !h.authorize(w, r, uint32(contract), []byte(topic), unitdb.OpGet) {
+		return
+	}
+	if v := params.Get("from"); v != "" {
+		token, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts = append(opts, unitdb.WithWatchFrom(token))
+	}
+	msgs, cancel, err := h.db.Watch([]byte(topic), opts...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+	ws, err := watchUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has already responded to the client.
+		return
+	}
+	defer ws.Close()
+
+	// messages from the client are discarded, the read fails once the client closes the connection.
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-doneC:
+			return
+		case m, ok := <-msgs:
+			if !ok {
+				ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(watchWriteWait))
+				return
+			}
+			if m.Err != nil {
+				ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, m.Err.Error()), time.Now().Add(watchWriteWait))
+				return
+			}
+			ws.SetWriteDeadline(time.Now().Add(watchWriteWait))
+			if err := ws.WriteJSON(watchMessage{
+				ID:       base64.RawURLEncoding.EncodeToString(m.ID),
+				Topic:    string(m.Topic),
+				Payload:  string(m.Payload),
+				StoredAt: m.StoredAt.Unix(),
+				Token:    base64.RawURLEncoding.EncodeToString(m.Token),
+			}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// singleFileMagic is the signature of the region table of the single file.
+	singleFileMagic = "unitdbsf"
+
+	// regionEntrySize is size of an entry of the region table, the base, capacity and size of the region.
+	regionEntrySize = 24
+
+	// minSingleFileSize is the minimum capacity of the single file.
+	minSingleFileSize = 1 << 20
+)
+
+// singleFileTypes are the file types packed into the single file in the order of the region table.
+var singleFileTypes = []_FileType{typeIndex, typeTimeWindow, typeData}
+
+// _Region is a region of the single file holding the index, window or data file of the DB. Offsets of
+// the file are relative to the base of the region and the size of the file is kept in the region table.
+type _Region struct {
+	mu       sync.Mutex // mu serializes growing and shrinking of the region.
+	file     *os.File
+	entry    int64 // The offset of the region entry in the region table.
+	base     int64
+	capacity int64
+	size     int64
+}
+
+func singleFilePath(dirName string) string {
+	return path.Join(dirName, fmt.Sprintf("%s.db", prefix))
+}
+
+// singleFileExists returns true if the DB at the path is created using the single file layout.
+func singleFileExists(dirName string) bool {
+	_, err := os.Stat(singleFilePath(dirName))
+	return err == nil
+}
+
+// newSingleFile opens the single file and returns the index, window and data files of the DB as regions of the
+// single file. The capacity of the regions is set from the capacity of the single file when the file is created.
+func newSingleFile(dirName string, capacity int64) (winFile, indexFile, dataFile _FileSet, err error) {
+	fi, err := os.OpenFile(singleFilePath(dirName), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return
+	}
+	table := make([]byte, len(singleFileMagic)+regionEntrySize*len(singleFileTypes))
+	stat, err := fi.Stat()
+	if err != nil {
+		return
+	}
+	if stat.Size() == 0 {
+		if capacity < minSingleFileSize {
+			capacity = minSingleFileSize
+		}
+		// index and window regions take 1/8th of the capacity each, the rest is the data region.
+		small := capacity / 8 / int64(blockSize) * int64(blockSize)
+		capacities := []int64{small, small, capacity - 2*small - int64(blockSize)}
+		copy(table, singleFileMagic)
+		base := int64(blockSize)
+		for i, c := range capacities {
+			buf := table[len(singleFileMagic)+i*regionEntrySize:]
+			binary.LittleEndian.PutUint64(buf[0:8], uint64(base))
+			binary.LittleEndian.PutUint64(buf[8:16], uint64(c))
+			base += c
+		}
+		if _, err = fi.WriteAt(table, 0); err != nil {
+			return
+		}
+	} else if _, err = fi.ReadAt(table, 0); err != nil {
+		return
+	}
+	if string(table[:len(singleFileMagic)]) != singleFileMagic {
+		err = errCorrupted
+		return
+	}
+	files := make([]_FileSet, len(singleFileTypes))
+	for i, fileType := range singleFileTypes {
+		off := len(singleFileMagic) + i*regionEntrySize
+		buf := table[off:]
+		r := &_Region{
+			file:     fi,
+			entry:    int64(off),
+			base:     int64(binary.LittleEndian.Uint64(buf[0:8])),
+			capacity: int64(binary.LittleEndian.Uint64(buf[8:16])),
+			size:     int64(binary.LittleEndian.Uint64(buf[16:24])),
+		}
+		f := _File{File: fi, fd: _FileDesc{fileType: fileType, fd: fi.Fd()}, size: r.size, region: r}
+		files[i] = _FileSet{mu: new(sync.RWMutex), fileMap: map[int16]_File{0: f}, _File: &f}
+	}
+	return files[1], files[0], files[2], nil
+}
+
+func (r *_Region) currSize() int64 {
+	return atomic.LoadInt64(&r.size)
+}
+
+// readAt reads from the region, a read past the size of the region returns io.EOF as a read past the end of a file.
+func (r *_Region) readAt(b []byte, off int64) (int, error) {
+	size := r.currSize()
+	if off >= size {
+		return 0, io.EOF
+	}
+	var eof error
+	if off+int64(len(b)) > size {
+		b, eof = b[:size-off], io.EOF
+	}
+	n, err := r.file.ReadAt(b, r.base+off)
+	if err != nil {
+		return n, err
+	}
+	return n, eof
+}
+
+// writeAt writes to the region and grows the region if the write is past the size of the region.
+func (r *_Region) writeAt(b []byte, off int64) (int, error) {
+	end := off + int64(len(b))
+	if end > r.capacity {
+		return 0, errFull
+	}
+	n, err := r.file.WriteAt(b, r.base+off)
+	if err != nil {
+		return n, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if end > r.size {
+		if err := r.setSize(end); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// truncate changes the size of the region. Bytes past the size are zeroed on shrink, so the region
+// reads zeros when it grows again as a file does.
+func (r *_Region) truncate(size int64) error {
+	if size > r.capacity {
+		return errFull
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size < r.size {
+		zeros := make([]byte, blockSize)
+		for off := size; off < r.size; off += int64(blockSize) {
+			n := r.size - off
+			if n > int64(blockSize) {
+				n = int64(blockSize)
+			}
+			if _, err := r.file.WriteAt(zeros[:n], r.base+off); err != nil {
+				return err
+			}
+		}
+	}
+	if size > r.size {
+		// extend the single file so reads of the grown region do not fail past the end of the file.
+		stat, err := r.file.Stat()
+		if err != nil {
+			return err
+		}
+		if stat.Size() < r.base+size {
+			if err := r.file.Truncate(r.base + size); err != nil {
+				return err
+			}
+		}
+	}
+	return r.setSize(size)
+}
+
+// setSize sets the size of the region and writes it to the region table.
+func (r *_Region) setSize(size int64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(size))
+	if _, err := r.file.WriteAt(buf[:], r.entry+16); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&r.size, size)
+	return nil
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/unit-io/unitdb/memdb"
+	"github.com/unit-io/unitdb/metrics"
+)
+
+// ttlBounds are upper bounds of ttl histogram buckets, the last bucket holds ttls larger than all bounds.
+var ttlBounds = []time.Duration{time.Minute, 10 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+type (
+	// ExpiryWindow holds number of entries scheduled to expire in an expiry window.
+	ExpiryWindow struct {
+		Time  time.Time // The time the expiry window is processed.
+		Count int       // The number of entries scheduled to expire.
+	}
+
+	// TTLBucket holds number of entries written with ttl up to the upper bound.
+	// UpperBound is zero for the last bucket holding the larger ttls.
+	TTLBucket struct {
+		UpperBound time.Duration
+		Count      int64
+	}
+
+	// ExpiryStats holds scheduled expiry load and ttls observed at write time.
+	ExpiryStats struct {
+		Windows      []ExpiryWindow // The upcoming expiry windows sorted by time.
+		Pending      int            // The total number of entries scheduled to expire.
+		TTLHistogram []TTLBucket    // The ttls observed at write time.
+	}
+
+	// InFlightStats holds entries in the write pipeline. Entries are visible to Get as soon as
+	// they are accepted, so there is no gauge for entries durable but not yet visible.
+	InFlightStats struct {
+		Unsynced int64         // The number of entries accepted but not yet synced to DB files.
+		LastSync time.Time     // The time of the last completed sync, zero if no sync has completed since open.
+		SyncLag  time.Duration // The time since the last completed sync, or since open, if there are unsynced entries.
+		// The time IDs of batches started but not yet committed, use AbortTimeID to abort a stuck time ID.
+		Uncommitted []int64
+	}
+
+	// StorageStats holds sizes of DB files and mem store, and counters of sync, recovery and cache reads.
+	StorageStats struct {
+		Entries       int64   // The number of entries in DB.
+		IndexSize     int64   // The size in bytes of the index file.
+		DataSize      int64   // The size in bytes of the data file.
+		WindowSize    int64   // The size in bytes of the time window file.
+		FreeBlocks    int     // The number of free blocks of the data file.
+		FreeSize      int64   // The total size in bytes of free blocks.
+		Fragmentation float64 // The fraction of the free size not in the largest free block, from 0 to 1.
+		MemdbEntries  int64   // The number of entries in the mem store.
+		PendingWAL    int64   // The size in bytes of the write ahead logs not yet released.
+		Syncs         int64   // The number of entries synced to DB files since open.
+		Recovers      int64   // The number of entries synced on recovery from the write ahead log since open.
+		Ingested      int64   // The number of entries written to DB files by Ingest since open.
+		CacheHits     int64   // The number of entries read from the mem store.
+		CacheMisses   int64   // The number of entries read from DB files.
+		CacheHitRate  float64 // The fraction of the entries read from the mem store, from 0 to 1.
+	}
+
+	// LatencyBucket holds number of time IDs released with latency up to the upper bound.
+	// UpperBound is zero for the last bucket holding the larger latencies.
+	LatencyBucket struct {
+		UpperBound time.Duration
+		Count      int64
+	}
+
+	// TimeMarkStats holds time IDs of the mem store by release state and the latency from the time a time ID
+	// is marked to the time it is released for sync.
+	TimeMarkStats struct {
+		Pending        []int64         // The time IDs not yet released for sync.
+		Released       []int64         // The time IDs released and not yet synced.
+		Aborted        []int64         // The most recent aborted time IDs.
+		ReleaseLatency []LatencyBucket // The release latency of the time IDs since open.
+	}
+
+	// MissStats holds number of entries found in the time window but missed on read since open.
+	// Use WithDiagnostics on a query to count the misses of the query.
+	MissStats struct {
+		FilterFalsePositives int64 // The number of entries missing in the index the filter reported present.
+		IndexMisses          int64 // The number of entries missing in the index the filter reported absent.
+		DataReadErrors       int64 // The number of entries failed to read from the index or the data file.
+	}
+
+	// Stats holds DB statistics.
+	Stats struct {
+		Expiry   ExpiryStats
+		InFlight InFlightStats
+		Storage  StorageStats
+		TimeMark TimeMarkStats
+		Misses   MissStats
+		Files    FileStats
+		Usage    map[uint32]int64 // The stored bytes per contract, usage is tracked only if quota is set on DB.
+	}
+
+	_InFlight struct {
+		unsynced int64
+		lastSync int64 // unix nano.
+	}
+
+	_TTLHistogram struct {
+		buckets []int64
+	}
+)
+
+// add adds n entries to the unsynced entries and updates the gauge. The count is floored at zero
+// as entries replayed from the log on recovery are not counted as accepted.
+func (f *_InFlight) add(n int64, g metrics.Gauge) {
+	v := atomic.AddInt64(&f.unsynced, n)
+	if v < 0 {
+		atomic.CompareAndSwapInt64(&f.unsynced, v, 0)
+		v = 0
+	}
+	g.Update(v)
+}
+
+// synced removes n synced entries from the unsynced entries and records the sync time.
+func (f *_InFlight) synced(n int64, g metrics.Gauge) {
+	f.add(-n, g)
+	atomic.StoreInt64(&f.lastSync, time.Now().UnixNano())
+}
+
+func (f *_InFlight) lastSyncTime() time.Time {
+	if t := atomic.LoadInt64(&f.lastSync); t != 0 {
+		return time.Unix(0, t)
+	}
+	return time.Time{}
+}
+
+func (f *_InFlight) stats(start time.Time) InFlightStats {
+	s := InFlightStats{Unsynced: atomic.LoadInt64(&f.unsynced), LastSync: f.lastSyncTime()}
+	if s.Unsynced > 0 {
+		if !s.LastSync.IsZero() {
+			start = s.LastSync
+		}
+		s.SyncLag = time.Since(start)
+	}
+	return s
+}
+
+func newTTLHistogram() *_TTLHistogram {
+	return &_TTLHistogram{buckets: make([]int64, len(ttlBounds)+1)}
+}
+
+// add adds the ttl to the histogram.
+func (h *_TTLHistogram) add(ttl time.Duration) {
+	i := sort.Search(len(ttlBounds), func(i int) bool { return ttl <= ttlBounds[i] })
+	atomic.AddInt64(&h.buckets[i], 1)
+}
+
+func (h *_TTLHistogram) snapshot() []TTLBucket {
+	buckets := make([]TTLBucket, len(h.buckets))
+	for i := range h.buckets {
+		if i < len(ttlBounds) {
+			buckets[i].UpperBound = ttlBounds[i]
+		}
+		buckets[i].Count = atomic.LoadInt64(&h.buckets[i])
+	}
+	return buckets
+}
+
+// Stats returns DB statistics. Expiry windows are tracked only if background key expiry is set on DB.
+// In-flight stats let service owners alert when sync stalls.
+func (db *DB) Stats() (*Stats, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	s := &Stats{}
+	windows := db.internal.timeWindow.expiryWindowBucket.windowCounts()
+	for t, count := range windows {
+		s.Expiry.Windows = append(s.Expiry.Windows, ExpiryWindow{Time: time.Unix(t, 0), Count: count})
+		s.Expiry.Pending += count
+	}
+	sort.Slice(s.Expiry.Windows, func(i, j int) bool { return s.Expiry.Windows[i].Time.Before(s.Expiry.Windows[j].Time) })
+	s.Expiry.TTLHistogram = db.internal.ttls.snapshot()
+	s.InFlight = db.internal.inFlight.stats(db.internal.start)
+	s.InFlight.Uncommitted = db.internal.mem.Uncommitted(time.Now())
+	s.Storage = db.storageStats()
+	s.TimeMark = db.timeMarkStats()
+	s.Misses = MissStats{
+		FilterFalsePositives: db.internal.meter.FilterFalsePositives.Count(),
+		IndexMisses:          db.internal.meter.IndexMisses.Count(),
+		DataReadErrors:       db.internal.meter.DataReadErrors.Count(),
+	}
+	s.Files = db.fileStats()
+	if db.internal.quotas.enabled() {
+		s.Usage = db.internal.quotas.snapshot()
+	}
+
+	return s, nil
+}
+
+func (db *DB) timeMarkStats() TimeMarkStats {
+	ts := db.internal.mem.TimeMarkStats()
+	s := TimeMarkStats{Pending: ts.Pending, Released: ts.Released, Aborted: ts.Aborted}
+	s.ReleaseLatency = make([]LatencyBucket, len(ts.ReleaseLatency))
+	for i, count := range ts.ReleaseLatency {
+		if i < len(memdb.ReleaseLatencyBounds) {
+			s.ReleaseLatency[i].UpperBound = memdb.ReleaseLatencyBounds[i]
+		}
+		s.ReleaseLatency[i].Count = count
+	}
+	return s
+}
+
+func (db *DB) storageStats() StorageStats {
+	s := StorageStats{
+		Entries:      int64(db.Count()),
+		MemdbEntries: db.internal.mem.Size(),
+		PendingWAL:   db.internal.mem.LogSize(),
+		Syncs:        db.internal.meter.Syncs.Count(),
+		Recovers:     db.internal.meter.Recovers.Count(),
+		Ingested:     db.internal.meter.Ingested.Count(),
+		CacheHits:    db.internal.meter.CacheHits.Count(),
+		CacheMisses:  db.internal.meter.CacheMisses.Count(),
+	}
+	sizes := []*int64{&s.IndexSize, &s.DataSize, &s.WindowSize}
+	for i, fileType := range []_FileType{typeIndex, typeData, typeTimeWindow} {
+		if f, err := db.fs.getFile(_FileDesc{fileType: fileType}); err == nil {
+			*sizes[i] = f.currSize()
+		}
+	}
+	var largest int64
+	s.FreeBlocks, s.FreeSize, largest = db.internal.freeList.stats()
+	if s.FreeSize > 0 {
+		s.Fragmentation = 1 - float64(largest)/float64(s.FreeSize)
+	}
+	if reads := s.CacheHits + s.CacheMisses; reads > 0 {
+		s.CacheHitRate = float64(s.CacheHits) / float64(reads)
+	}
+	return s
+}
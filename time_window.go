@@ -19,6 +19,7 @@ package unitdb
 import (
 	"encoding/binary"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -120,6 +121,36 @@ type (
 )
 
 type _WindowEntries []_WinEntry
+
+// before returns window entries with sequence less than the seq.
+func (w _WindowEntries) before(seq uint64) _WindowEntries {
+	entries := make(_WindowEntries, 0, len(w))
+	for _, we := range w {
+		if we.sequence < seq {
+			entries = append(entries, we)
+		}
+	}
+	return entries
+}
+
+// minSeq returns the least sequence of the entries.
+func (w _WindowEntries) minSeq() uint64 {
+	var seq uint64
+	for i, we := range w {
+		if i == 0 || we.sequence < seq {
+			seq = we.sequence
+		}
+	}
+	return seq
+}
+
+// _LookupFilter filters window entries on lookup. Zero value of a field does not filter entries.
+type _LookupFilter struct {
+	cutoff int64  // The cutoff skips blocks filled before the cutoff time.
+	until  int64  // The until skips blocks written after the until time.
+	before uint64 // The before skips entries with sequence not less than before, used by cursor pagination.
+	after  uint64 // The after skips entries with sequence not greater than after and stops the lookup at these entries.
+}
 type _Key struct {
 	timeID    int64
 	topicHash uint64
@@ -216,47 +247,123 @@ func (tw *_TimeWindowBucket) release() func(timeID int64) error {
 	}
 }
 
+// remove removes window entries of the topic not yet sync to DB and returns the removed entries.
+func (tw *_TimeWindowBucket) remove(topicHash uint64) (winEntries _WindowEntries) {
+	b := tw.windowBlocks.getWindowBlock(topicHash)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, wEntries := range b.entries {
+		if key.topicHash != topicHash {
+			continue
+		}
+		winEntries = append(winEntries, wEntries...)
+		delete(b.entries, key)
+	}
+	return winEntries
+}
+
+// abort removes window entries of the time ID not yet sync to DB.
+func (tw *_TimeWindowBucket) abort(timeID int64) {
+	for i := 0; i < nShards; i++ {
+		wb := tw.windowBlocks.window[i]
+		wb.mu.Lock()
+		for key := range wb.entries {
+			if key.timeID == timeID {
+				delete(wb.entries, key)
+			}
+		}
+		wb.mu.Unlock()
+	}
+}
+
+// count returns the number of window entries of the topic that are not expired, including the
+// entries not yet synced to DB.
+func (tw *_TimeWindowBucket) count(fs *_FileSet, topicHash uint64, off int64) (n int) {
+	b := tw.windowBlocks.getWindowBlock(topicHash)
+	b.mu.RLock()
+	for key, wEntries := range b.entries {
+		if key.topicHash != topicHash {
+			continue
+		}
+		for _, we := range wEntries {
+			if !we.isExpired() {
+				n++
+			}
+		}
+	}
+	b.mu.RUnlock()
+	winFile, err := fs.getFile(_FileDesc{fileType: typeTimeWindow})
+	if err != nil {
+		return n
+	}
+	for {
+		r := _WindowReader{winFile: winFile, offset: off}
+		b, err := r.readWindowBlock()
+		if err != nil || b.topicHash != topicHash {
+			return n
+		}
+		for _, we := range b.entries[:b.entryIdx] {
+			if !we.isExpired() {
+				n++
+			}
+		}
+		if b.next == 0 {
+			return n
+		}
+		off = b.next
+	}
+}
+
 // ilookup lookups window entries from timeWindowBucket and not yet sync to DB.
-func (tw *_TimeWindowBucket) ilookup(topicHash uint64, limit int) (winEntries _WindowEntries) {
+func (tw *_TimeWindowBucket) ilookup(topicHash uint64, before uint64, limit int) (winEntries _WindowEntries) {
 	winEntries = make([]_WinEntry, 0)
 	// get windowBlock shard.
 	b := tw.windowBlocks.getWindowBlock(topicHash)
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	var l int
-	var expiryCount int
 
 	for key := range b.entries {
 		if key.topicHash != topicHash {
 			continue
 		}
 		wEntries := b.entries[key]
-		if len(wEntries) > 0 {
-			l = limit + expiryCount - l
-			if len(wEntries) < l {
-				l = len(wEntries)
-			}
-			for i := len(wEntries) - 1; i >= len(wEntries)-l; i-- {
-				we := wEntries[i]
-				if we.isExpired() {
-					if err := tw.expiryWindowBucket.addExpiry(we); err != nil {
-						expiryCount++
-						logger.Error().Err(err).Str("context", "timeWindow.addExpiry")
-					}
-					// if id is expired it does not return an error but continue the iteration.
-					continue
+		if before > 0 {
+			wEntries = wEntries.before(before)
+		}
+		for _, we := range wEntries {
+			if we.isExpired() {
+				if err := tw.expiryWindowBucket.addExpiry(we); err != nil {
+					logger.Error().Err(err).Str("context", "timeWindow.addExpiry")
 				}
-				winEntries = append(winEntries, we)
+				// if id is expired it does not return an error but continue the iteration.
+				continue
 			}
+			winEntries = append(winEntries, we)
 		}
 	}
+	// the entries of the topic are spread across time IDs, so the most recent entries are kept.
+	if len(winEntries) > limit {
+		sort.Slice(winEntries, func(i, j int) bool { return winEntries[i].sequence > winEntries[j].sequence })
+		winEntries = winEntries[:limit]
+	}
 	return winEntries
 }
 
-// lookup lookups window entries from window file.
-func (tw *_TimeWindowBucket) lookup(fs *_FileSet, topicHash uint64, off, cutoff int64, limit int) (winEntries _WindowEntries) {
+// lookup lookups window entries from window file. Blocks filled before the cutoff or
+// written after the until time of the filter are skipped.
+func (tw *_TimeWindowBucket) lookup(fs *_FileSet, topicHash uint64, off int64, filter _LookupFilter, limit int) (winEntries _WindowEntries) {
+	cutoff, until := filter.cutoff, filter.until
 	winEntries = make([]_WinEntry, 0)
-	winEntries = tw.ilookup(topicHash, limit)
+	winEntries = tw.ilookup(topicHash, filter.before, limit)
+	if until > 0 {
+		// in memory entries are the most recent entries and are filtered by the range on read,
+		// so these do not count against the limit of entries read from window file.
+		memEntries := winEntries
+		winEntries = make([]_WinEntry, 0)
+		defer func() {
+			winEntries = append(winEntries, memEntries...)
+		}()
+	}
 	if len(winEntries) >= limit {
 		return winEntries
 	}
@@ -281,10 +388,16 @@ func (tw *_TimeWindowBucket) lookup(fs *_FileSet, topicHash uint64, off, cutoff
 		}
 	}
 	expiryCount := 0
-	err = next(off, func(curb _WinBlock) (bool, error) {
-		b := &curb
-		if b.topicHash != topicHash {
-			return true, nil
+	collect := func(b *_WinBlock) bool {
+		if filter.before > 0 {
+			b.trim(filter.before)
+		}
+		// entries of the older blocks in the chain are not greater than after.
+		stop := false
+		if filter.after > 0 {
+			n := b.entryIdx
+			b.trimAfter(filter.after)
+			stop = b.entryIdx < n
 		}
 		if len(winEntries) > limit-int(b.entryIdx) {
 			limit = limit - len(winEntries)
@@ -301,7 +414,7 @@ func (tw *_TimeWindowBucket) lookup(fs *_FileSet, topicHash uint64, off, cutoff
 				winEntries = append(winEntries, we)
 			}
 			if len(winEntries) >= limit {
-				return true, nil
+				return true
 			}
 		}
 		for i := len(b.entries[:b.entryIdx]) - 1; i >= 0; i-- {
@@ -317,11 +430,35 @@ func (tw *_TimeWindowBucket) lookup(fs *_FileSet, topicHash uint64, off, cutoff
 			winEntries = append(winEntries, we)
 
 		}
-		if b.cutoff(cutoff) {
+		return stop
+	}
+	// pending is the newer block waiting on its older block in the chain. Entries of the
+	// pending block are appended after the older block was filled, so the pending block is
+	// skipped if the older block was filled after the until time.
+	var pending *_WinBlock
+	err = next(off, func(curb _WinBlock) (bool, error) {
+		b := &curb
+		if b.topicHash != topicHash {
 			return true, nil
 		}
-		return false, nil
+		if until == 0 {
+			if collect(b) {
+				return true, nil
+			}
+			return b.cutoff(cutoff), nil
+		}
+		if pending != nil && (b.cutoffTime == 0 || b.cutoffTime <= until) {
+			if collect(pending) {
+				pending = nil
+				return true, nil
+			}
+		}
+		pending = b
+		return b.cutoff(cutoff), nil
 	})
+	if pending != nil {
+		collect(pending)
+	}
 	if err != nil {
 		return winEntries
 	}
@@ -329,6 +466,36 @@ func (tw *_TimeWindowBucket) lookup(fs *_FileSet, topicHash uint64, off, cutoff
 	return winEntries
 }
 
+// trim removes entries with sequence not less than the seq from the block.
+func (b *_WinBlock) trim(seq uint64) {
+	n := uint16(0)
+	for _, we := range b.entries[:b.entryIdx] {
+		if we.sequence < seq {
+			b.entries[n] = we
+			n++
+		}
+	}
+	for i := n; i < b.entryIdx; i++ {
+		b.entries[i] = _WinEntry{}
+	}
+	b.entryIdx = n
+}
+
+// trimAfter removes entries with sequence not greater than the seq from the block.
+func (b *_WinBlock) trimAfter(seq uint64) {
+	n := uint16(0)
+	for _, we := range b.entries[:b.entryIdx] {
+		if we.sequence > seq {
+			b.entries[n] = we
+			n++
+		}
+	}
+	for i := n; i < b.entryIdx; i++ {
+		b.entries[i] = _WinEntry{}
+	}
+	b.entryIdx = n
+}
+
 func (b _WinBlock) validation(topicHash uint64) error {
 	if b.topicHash != topicHash {
 		return fmt.Errorf("timeWindow.write: validation failed block topicHash %d, topicHash %d", b.topicHash, topicHash)
@@ -20,6 +20,10 @@ import (
 	"io"
 )
 
+// windowReadBatch is the number of window blocks read at once by blockIterator, so the window file
+// is read sequentially in large reads on DB open.
+const windowReadBatch = 256
+
 type _WindowReader struct {
 	winBlock  _WinBlock
 	windowIdx int32
@@ -54,25 +58,69 @@ func (r *_WindowReader) readWindowBlock() (_WinBlock, error) {
 	return r.winBlock, nil
 }
 
-// blockIterator iterates all window blocks from disk.
+// blockIterator iterates all window blocks from disk and calls f for each topic with the sequence of the first
+// entry of the topic and the offset of the head of the window block chain of the topic. The head is the most
+// recent window block of the topic not linked from another window block.
 func (r *_WindowReader) blockIterator(f func(startSeq, topicHash uint64, off int64) (bool, error)) (err error) {
-	windowIdx := int32(0)
+	type _Chain struct {
+		startSeq uint64
+		blocks   []int64
+	}
+	chains := make(map[uint64]*_Chain)
+	var topics []uint64
+	linked := make(map[int64]struct{})
 	nBlocks := r.windowIdx
-	for windowIdx <= nBlocks {
-		r.offset = winBlockOffset(windowIdx)
-		b, err := r.readWindowBlock()
+	for windowIdx := int32(0); windowIdx < nBlocks; windowIdx += windowReadBatch {
+		n := nBlocks - windowIdx
+		if n > windowReadBatch {
+			n = windowReadBatch
+		}
+		buf, err := r.winFile.slice(winBlockOffset(windowIdx), winBlockOffset(windowIdx+n))
 		if err != nil {
 			if err == io.EOF {
-				return nil
+				break
 			}
 			return err
 		}
-		windowIdx++
-		if b.entryIdx == 0 || b.next != 0 {
+		for i := int32(0); i < n; i++ {
+			if err := r.winBlock.unmarshalBinary(buf[i*blockSize : (i+1)*blockSize]); err != nil {
+				return err
+			}
+			b := r.winBlock
+			if b.entryIdx == 0 {
+				continue
+			}
+			c, ok := chains[b.topicHash]
+			if !ok {
+				c = &_Chain{}
+				chains[b.topicHash] = c
+				topics = append(topics, b.topicHash)
+			}
+			if b.next == 0 {
+				if c.startSeq == 0 {
+					c.startSeq = b.entries[0].sequence
+				}
+			} else {
+				linked[b.next] = struct{}{}
+			}
+			c.blocks = append(c.blocks, winBlockOffset(windowIdx+i))
+		}
+	}
+	for _, h := range topics {
+		c := chains[h]
+		if c.startSeq == 0 {
+			continue
+		}
+		head := int64(-1)
+		for _, off := range c.blocks {
+			if _, ok := linked[off]; !ok {
+				head = off
+			}
+		}
+		if head == -1 {
 			continue
 		}
-		// fmt.Println("timeWindow.blockIterator: topicHash, seq ", b.topicHash, b.entries[0].sequence)
-		if stop, err := f(b.entries[0].sequence, b.topicHash, r.offset); stop || err != nil {
+		if stop, err := f(c.startSeq, h, head); stop || err != nil {
 			return err
 		}
 	}
@@ -26,7 +26,11 @@ import (
 type _WindowWriter struct {
 	windowIdx int32
 	winBlocks map[int32]_WinBlock // map[windowIdx]winBlock
-	winLeases map[int32][]uint64  // map[blockIdx][]seq
+	// rollbackBlocks keeps the blocks as persisted before the sync, map[windowIdx]winBlock.
+	rollbackBlocks map[int32]_WinBlock
+	// heads keeps the heads of the window block chains of the topics appended by the sync, map[topicHash]offset.
+	// The topic offsets in the trie are set to the heads once the sync is complete.
+	heads map[uint64]int64
 
 	fs      *_FileSet
 	buffer  *bpool.Buffer
@@ -35,7 +39,8 @@ type _WindowWriter struct {
 }
 
 func newWindowWriter(fs *_FileSet, buf *bpool.Buffer) (*_WindowWriter, error) {
-	w := &_WindowWriter{windowIdx: -1, winBlocks: make(map[int32]_WinBlock), winLeases: make(map[int32][]uint64), fs: fs, buffer: buf}
+	// window block 0 is reserved as the next offset zero terminates the chain of window blocks of a topic.
+	w := &_WindowWriter{windowIdx: 0, winBlocks: make(map[int32]_WinBlock), rollbackBlocks: make(map[int32]_WinBlock), heads: make(map[uint64]int64), fs: fs, buffer: buf}
 	winFile, err := fs.getFile(_FileDesc{fileType: typeTimeWindow})
 	if err != nil {
 		return nil, err
@@ -49,41 +54,14 @@ func newWindowWriter(fs *_FileSet, buf *bpool.Buffer) (*_WindowWriter, error) {
 	return w, nil
 }
 
-func (w *_WindowWriter) del(seq uint64, winIdx int32) error {
-	r := _WindowReader{winFile: w.winFile, offset: winBlockOffset(winIdx)}
-	b, err := r.readWindowBlock()
-	if err != nil {
-		return err
-	}
-	entryIdx := -1
-	for i := 0; i < int(b.entryIdx); i++ {
-		e := b.entries[i]
-		if e.sequence == seq { //record exist in db.
-			entryIdx = i
-			break
-		}
-	}
-	if entryIdx == -1 {
-		return nil // no entry in db to delete.
-	}
-	b.dirty = true
-	b.entryIdx--
-
-	i := entryIdx
-	for ; i < entriesPerIndexBlock-1; i++ {
-		b.entries[i] = b.entries[i+1]
-	}
-	b.entries[i] = _WinEntry{}
-
-	w.winBlocks[winIdx] = b
-	return nil
-}
-
 // append appends window entries to buffer.
 func (w *_WindowWriter) append(topicHash uint64, off int64, wEntries _WindowEntries) (newOff int64, err error) {
 	var b _WinBlock
 	var ok bool
 	var wIdx int32
+	if head, ok := w.heads[topicHash]; ok {
+		off = head
+	}
 	if off == 0 {
 		w.windowIdx++
 		wIdx = w.windowIdx
@@ -102,6 +80,10 @@ func (w *_WindowWriter) append(topicHash uint64, off int64, wEntries _WindowEntr
 			b.leased = true
 		}
 	}
+	if _, ok := w.rollbackBlocks[wIdx]; !ok && winBlockOffset(wIdx) < w.offset {
+		// keep the persisted block to restore it if the sync is aborted.
+		w.rollbackBlocks[wIdx] = b
+	}
 	b.topicHash = topicHash
 	for _, we := range wEntries {
 		if we.sequence == 0 {
@@ -117,14 +99,12 @@ func (w *_WindowWriter) append(topicHash uint64, off int64, wEntries _WindowEntr
 			wIdx = w.windowIdx
 			b = _WinBlock{topicHash: topicHash, next: next}
 		}
-		if b.leased {
-			w.winLeases[wIdx] = append(w.winLeases[wIdx], we.sequence)
-		}
 		b.entries[b.entryIdx] = _WinEntry{sequence: we.sequence, expiresAt: we.expiresAt}
 		b.dirty = true
 		b.entryIdx++
 	}
 	w.winBlocks[wIdx] = b
+	w.heads[topicHash] = int64(blockSize * wIdx)
 
 	return int64(blockSize * wIdx), nil
 }
@@ -193,19 +173,34 @@ func (w *_WindowWriter) write() error {
 	return nil
 }
 
+// rollback restores the window blocks persisted before the sync. Blocks written by the sync are
+// restored on the disk and synced before rollback returns.
 func (w *_WindowWriter) rollback() error {
-	for bIdx, seqs := range w.winLeases {
-		for _, seq := range seqs {
-			if err := w.del(seq, bIdx); err != nil {
-				return err
-			}
+	// blocks after the window offset are truncated.
+	for wIdx := range w.winBlocks {
+		if winBlockOffset(wIdx) >= w.offset {
+			delete(w.winBlocks, wIdx)
 		}
 	}
-	return nil
+	w.windowIdx = int32(w.offset / int64(blockSize))
+	w.heads = make(map[uint64]int64)
+	if len(w.rollbackBlocks) == 0 {
+		return nil
+	}
+	for wIdx, b := range w.rollbackBlocks {
+		if _, err := w.winFile.WriteAt(b.marshalBinary(), winBlockOffset(wIdx)); err != nil {
+			return err
+		}
+		b.dirty = false
+		w.winBlocks[wIdx] = b
+	}
+	return w.winFile.Sync()
 }
 
 func (w *_WindowWriter) reset() error {
 	w.buffer.Reset()
+	w.rollbackBlocks = make(map[int32]_WinBlock)
+	w.heads = make(map[uint64]int64)
 	w.offset = w.winFile.currSize()
 
 	return nil
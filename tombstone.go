@@ -0,0 +1,262 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// tombstoneHeaderSize is size of the seq, the epoch, the time of delete and the value size of a tombstone record.
+	tombstoneHeaderSize = 28
+
+	// maxTombstones is the maximum number of tombstones retained, the oldest tombstones are dropped past it.
+	maxTombstones = 1 << 18
+
+	// tombstoneCompactSize is the size of the tombstones file past which the file is compacted once
+	// half of it holds dropped tombstones.
+	tombstoneCompactSize = 1 << 20
+)
+
+type (
+	// _Tombstone is the offset of the tombstone record of a deleted entry in the tombstones file
+	// and the epoch it is deleted at. The message of the entry is kept in the file only.
+	_Tombstone struct {
+		epoch     uint64
+		deletedAt int64
+		off       int64
+		size      uint32
+	}
+
+	// _Tombstones keeps deleted entries for the retention duration, so time-travel queries as of
+	// an epoch before the delete still return the deleted entries. The packed messages are appended
+	// to the tombstones file and the file is compacted once the dropped tombstones take half of it.
+	_Tombstones struct {
+		mu        sync.RWMutex
+		retention time.Duration
+		path      string
+		file      *os.File
+		size      int64
+		garbage   int64
+		entries   map[uint64]_Tombstone // map[seq]tombstone
+		order     []uint64              // seq of tombstones in the order entries are deleted.
+	}
+)
+
+func newTombstones(dirName string, retention time.Duration) (*_Tombstones, error) {
+	ts := &_Tombstones{retention: retention, path: path.Join(dirName, fmt.Sprintf("%s.tomb", prefix)), entries: make(map[uint64]_Tombstone)}
+	if !ts.enabled() {
+		return ts, nil
+	}
+	f, err := os.OpenFile(ts.path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	ts.file = f
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// A partially written record at the end of the file is ignored.
+	for off := 0; len(data)-off >= tombstoneHeaderSize+idSize; {
+		rec := data[off:]
+		size := tombstoneHeaderSize + idSize + int(binary.LittleEndian.Uint32(rec[24:28]))
+		if len(rec) < size {
+			break
+		}
+		// the record of a tombstone removed is zeroed.
+		if seq := binary.LittleEndian.Uint64(rec[0:8]); seq != 0 {
+			ts.entries[seq] = _Tombstone{epoch: binary.LittleEndian.Uint64(rec[8:16]), deletedAt: int64(binary.LittleEndian.Uint64(rec[16:24])), off: int64(off), size: uint32(size)}
+			ts.order = append(ts.order, seq)
+		} else {
+			ts.garbage += int64(size)
+		}
+		off += size
+		ts.size = int64(off)
+	}
+	ts.drop(time.Now())
+	if err := ts.compact(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (ts *_Tombstones) enabled() bool {
+	return ts != nil && ts.retention > 0
+}
+
+// add appends tombstone of the deleted entry to the tombstones file and drops tombstones
+// older than the retention.
+func (ts *_Tombstones) add(seq, epoch uint64, id, val []byte) error {
+	if !ts.enabled() {
+		return nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	now := time.Now()
+	rec := make([]byte, tombstoneHeaderSize, tombstoneHeaderSize+idSize+len(val))
+	binary.LittleEndian.PutUint64(rec[0:8], seq)
+	binary.LittleEndian.PutUint64(rec[8:16], epoch)
+	binary.LittleEndian.PutUint64(rec[16:24], uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint32(rec[24:28], uint32(len(val)))
+	rec = append(rec, id[:idSize]...)
+	rec = append(rec, val...)
+	if _, err := ts.file.WriteAt(rec, ts.size); err != nil {
+		return err
+	}
+	if t, ok := ts.entries[seq]; ok {
+		ts.garbage += int64(t.size)
+	}
+	ts.entries[seq] = _Tombstone{epoch: epoch, deletedAt: now.UnixNano(), off: ts.size, size: uint32(len(rec))}
+	ts.order = append(ts.order, seq)
+	ts.size += int64(len(rec))
+	ts.drop(now)
+	if ts.size > tombstoneCompactSize && ts.garbage > ts.size/2 {
+		return ts.compact()
+	}
+	return nil
+}
+
+// drop drops tombstones older than the retention and the oldest tombstones past the maximum
+// number of tombstones. The caller must hold the lock.
+func (ts *_Tombstones) drop(now time.Time) {
+	i := 0
+	for ; i < len(ts.order); i++ {
+		t, ok := ts.entries[ts.order[i]]
+		if ok && now.Sub(time.Unix(0, t.deletedAt)) < ts.retention && len(ts.entries) <= maxTombstones {
+			break
+		}
+		if ok {
+			ts.garbage += int64(t.size)
+			delete(ts.entries, ts.order[i])
+		}
+	}
+	ts.order = ts.order[i:]
+}
+
+// compact rewrites the tombstones file with the tombstones retained. The caller must hold the lock.
+func (ts *_Tombstones) compact() error {
+	if ts.garbage == 0 {
+		return nil
+	}
+	var buf []byte
+	var order []uint64
+	entries := make(map[uint64]_Tombstone, len(ts.entries))
+	for _, seq := range ts.order {
+		t, ok := ts.entries[seq]
+		if _, copied := entries[seq]; !ok || copied {
+			continue
+		}
+		rec := make([]byte, t.size)
+		if _, err := ts.file.ReadAt(rec, t.off); err != nil {
+			return err
+		}
+		t.off = int64(len(buf))
+		entries[seq] = t
+		order = append(order, seq)
+		buf = append(buf, rec...)
+	}
+	tmp := ts.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	if err := ts.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, ts.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ts.path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	ts.file = f
+	ts.entries = entries
+	ts.order = order
+	ts.size = int64(len(buf))
+	ts.garbage = 0
+	return nil
+}
+
+// remove removes tombstone of the entry and zeroes its record in the tombstones file except
+// the value size, so the entry erased is not returned by time-travel queries.
+func (ts *_Tombstones) remove(seq uint64) error {
+	if !ts.enabled() {
+		return nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t, ok := ts.entries[seq]
+	if !ok {
+		return nil
+	}
+	delete(ts.entries, seq)
+	ts.garbage += int64(t.size)
+	if _, err := ts.file.WriteAt(make([]byte, 24), t.off); err != nil {
+		return err
+	}
+	_, err := ts.file.WriteAt(make([]byte, t.size-tombstoneHeaderSize), t.off+tombstoneHeaderSize)
+	return err
+}
+
+// has returns true if tombstone of the entry is retained.
+func (ts *_Tombstones) has(seq uint64) bool {
+	if !ts.enabled() {
+		return false
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.entries[seq]
+	return ok && time.Since(time.Unix(0, t.deletedAt)) < ts.retention
+}
+
+// get reads the packed message of the entry from its tombstone if the entry is deleted after the epoch.
+func (ts *_Tombstones) get(seq, epoch uint64) (id, val []byte, ok bool) {
+	if !ts.enabled() {
+		return nil, nil, false
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.entries[seq]
+	if !ok || t.epoch <= epoch || time.Since(time.Unix(0, t.deletedAt)) >= ts.retention {
+		return nil, nil, false
+	}
+	rec := make([]byte, t.size)
+	if _, err := ts.file.ReadAt(rec, t.off); err != nil {
+		logger.Error().Err(err).Str("context", "tombstones.get").Msg("unable to read the tombstone")
+		return nil, nil, false
+	}
+	return rec[tombstoneHeaderSize : tombstoneHeaderSize+idSize], rec[tombstoneHeaderSize+idSize:], true
+}
+
+// close closes the tombstones file.
+func (ts *_Tombstones) close() error {
+	if !ts.enabled() {
+		return nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.file.Close()
+}
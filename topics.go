@@ -0,0 +1,330 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/uid"
+)
+
+// topicNameRecordSize is size of the fixed fields of the topic name record preceding the topic.
+const topicNameRecordSize = 4
+
+type (
+	// TopicNode is a node of the topic tree visited by WalkTopics. Names of the topic parts are kept
+	// for the topics written to the DB, a wildcard part is shown as '*' and a part with unknown name
+	// is shown as '#' followed by its hash.
+	TopicNode struct {
+		// Topic is the topic of the node, i.e. the parts of the path from the root of the tree to the node.
+		Topic []byte
+		// Name is the name of the topic part of the node.
+		Name  string
+		Depth int
+		// Children is the number of child nodes of the node.
+		Children int
+		// Topics is the number of topics in the subtree of the node including the topic of the node.
+		Topics int
+		// Entries is the number of entries of the topics in the subtree of the node that are not
+		// expired. Deleted entries are counted until the topic is deleted.
+		Entries int
+	}
+
+	// TopicInfo is a topic of the DB listed by Topics.
+	TopicInfo struct {
+		// Topic is the topic, a part with unknown name is shown as '#' followed by its hash.
+		Topic []byte
+		Hash  uint64
+		// Entries is the number of entries of the topic that are not expired. Deleted entries
+		// are counted until the topic is deleted.
+		Entries int
+		// Offset is the offset of the head window block of the topic in the window file, it is
+		// zero if the entries of the topic are not yet synced.
+		Offset int64
+		// LastWrite is the time the most recent entry of the topic is stored, it is zero if the
+		// most recent entry is deleted.
+		LastWrite time.Time
+	}
+
+	// _TopicNames is an append only log of the topics added to the trie. The trie keeps the
+	// hash of the topic parts, names of the parts are loaded from the log on open.
+	_TopicNames struct {
+		mu   sync.Mutex
+		path string
+		file *os.File
+	}
+
+	_TopicName struct {
+		contract uint32
+		topic    []byte
+	}
+)
+
+func newTopicNames(dirName string) (*_TopicNames, error) {
+	n := &_TopicNames{path: path.Join(dirName, fmt.Sprintf("%s.names", prefix))}
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	n.file = f
+	return n, nil
+}
+
+// read reads the topic names from the log. A partially written record at the end of the log is ignored.
+func (n *_TopicNames) read() ([]_TopicName, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	data, err := ioutil.ReadFile(n.path)
+	if err != nil {
+		return nil, err
+	}
+	var names []_TopicName
+	for len(data) >= 2 {
+		size := int(binary.LittleEndian.Uint16(data[0:2]))
+		if size < topicNameRecordSize {
+			return nil, errCorrupted
+		}
+		if len(data) < 2+size {
+			break
+		}
+		rec := data[2 : 2+size]
+		data = data[2+size:]
+		names = append(names, _TopicName{contract: binary.LittleEndian.Uint32(rec[0:4]), topic: rec[topicNameRecordSize:]})
+	}
+	return names, nil
+}
+
+// add appends the topic name to the log. The log is not synced, the names written
+// after the last sync of the file system are unknown after a crash.
+func (n *_TopicNames) add(name _TopicName) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err := n.file.Write(marshalTopicName(name))
+	return err
+}
+
+// rewrite replaces the log with the topic names.
+func (n *_TopicNames) rewrite(names []_TopicName) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var buf []byte
+	for _, name := range names {
+		buf = append(buf, marshalTopicName(name)...)
+	}
+	tmp := n.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0666); err != nil {
+		return err
+	}
+	if err := n.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, n.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	n.file = f
+	return nil
+}
+
+func (n *_TopicNames) close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.file.Close()
+}
+
+func marshalTopicName(name _TopicName) []byte {
+	size := topicNameRecordSize + len(name.topic)
+	rec := make([]byte, 2+size)
+	binary.LittleEndian.PutUint16(rec[0:2], uint16(size))
+	binary.LittleEndian.PutUint32(rec[2:6], name.contract)
+	copy(rec[6:], name.topic)
+	return rec
+}
+
+// addTopicName names the parts of the topic added to the trie and appends the topic to the topic names log.
+func (db *DB) addTopicName(topic []byte, parts []message.Part) {
+	names, _ := db.opts.topicSeparator.SplitTopic(topic)
+	if isWildcard(names) || !db.internal.trie.setNames(parts, names) {
+		return
+	}
+	if err := db.internal.names.add(_TopicName{contract: parts[0].Hash, topic: db.opts.topicSeparator.JoinParts(names, nil)}); err != nil {
+		logger.Error().Err(err).Str("context", "db.addTopicName")
+	}
+}
+
+// loadTopicNames names the parts of the topics in the trie from the topic names log. The log
+// is rewritten if more than half of its records are topics that are no longer in the trie.
+func (db *DB) loadTopicNames() error {
+	names, err := db.internal.names.read()
+	if err != nil {
+		return err
+	}
+	live := names[:0]
+	for _, name := range names {
+		t, _, err := db.parseTopic(name.contract, name.topic)
+		if err != nil {
+			continue
+		}
+		t.AddContract(name.contract)
+		parts, _ := db.opts.topicSeparator.SplitTopic(name.topic)
+		if db.internal.trie.setNames(t.Parts, parts) {
+			live = append(live, name)
+		}
+	}
+	if len(live) < len(names)/2 {
+		return db.internal.names.rewrite(live)
+	}
+	return nil
+}
+
+// WalkTopics walks the topic tree of the topics under the prefix in depth first order. The fn is
+// called for the child nodes in order of their names and the subtree of a node is skipped if fn
+// returns false, so admin views can render the tree lazily one level at a time. Use an empty prefix
+// to walk from the root of the tree. Wildcard prefix is not supported.
+func (db *DB) WalkTopics(prefix []byte, fn func(node TopicNode) bool) error {
+	if err := db.ok(); err != nil {
+		return err
+	}
+	if len(prefix) > maxTopicLength {
+		return errTopicTooLarge
+	}
+	if err := db.authorize(message.MasterContract, prefix, OpGet); err != nil {
+		return err
+	}
+	parts, _ := db.opts.topicSeparator.SplitTopic(prefix)
+	if isWildcard(parts) {
+		return errBadRequest
+	}
+	n, ok := db.internal.trie.node(message.MasterContract, parts)
+	if !ok {
+		return nil
+	}
+	db.walkTopics(db.opts.topicSeparator.JoinParts(parts, nil), len(parts), n, fn)
+	return nil
+}
+
+func (db *DB) walkTopics(topic []byte, depth int, n *_Node, fn func(node TopicNode) bool) {
+	nodes, tops := db.internal.trie.children(n)
+	walk := make([]TopicNode, len(nodes))
+	for i, child := range nodes {
+		node := TopicNode{Name: child.name, Depth: depth + 1, Topics: len(tops[i])}
+		switch {
+		case child.part.hash == message.Wildcard:
+			node.Name = string(message.TopicWildcardSymbol)
+		case node.Name == "":
+			node.Name = fmt.Sprintf("#%08x", child.part.hash)
+		}
+		if len(topic) > 0 {
+			node.Topic = append(append(append([]byte(nil), topic...), byte(db.opts.topicSeparator)), node.Name...)
+		} else {
+			node.Topic = []byte(node.Name)
+		}
+		db.internal.trie.RLock()
+		node.Children = len(child.children)
+		db.internal.trie.RUnlock()
+		for _, top := range tops[i] {
+			node.Entries += db.internal.timeWindow.count(db.fs, top.hash, top.offset)
+		}
+		walk[i] = node
+	}
+	order := make([]int, len(nodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return walk[order[i]].Name < walk[order[j]].Name })
+	for _, i := range order {
+		if fn(walk[i]) {
+			db.walkTopics(walk[i].Topic, walk[i].Depth, nodes[i], fn)
+		}
+	}
+}
+
+// Topics returns the topics of the contract known to the trie matching the pattern in order of the topics. The '*'
+// part of the pattern matches any single part and the trailing "..." matches one or more parts of the topic. Use
+// an empty pattern to list all topics of the contract. Master contract is used if contract is not specified.
+func (db *DB) Topics(contract uint32, pattern []byte) ([]TopicInfo, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	if len(pattern) > maxTopicLength {
+		return nil, errTopicTooLarge
+	}
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	if err := db.authorize(contract, pattern, OpGet); err != nil {
+		return nil, err
+	}
+	var tops _Topics
+	if len(pattern) == 0 {
+		tops = db.internal.trie.contractTopics(contract)
+	} else {
+		parts, _ := db.opts.topicSeparator.SplitTopic(pattern)
+		tops = db.internal.trie.match(contract, parts)
+	}
+	infos := make([]TopicInfo, 0, len(tops))
+	for _, top := range tops {
+		_, topic, ok := db.internal.trie.topicName(top.hash)
+		if !ok {
+			continue
+		}
+		// offset of the topic is read from the trie as sync flips the topic to the new head of its window block chain.
+		off, _ := db.internal.trie.getOffset(top.hash)
+		infos = append(infos, TopicInfo{
+			Topic:     topic,
+			Hash:      top.hash,
+			Entries:   db.internal.timeWindow.count(db.fs, top.hash, off),
+			Offset:    off,
+			LastWrite: db.lastWrite(top.hash, off),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return string(infos[i].Topic) < string(infos[j].Topic) })
+	return infos, nil
+}
+
+// lastWrite returns the time the most recent entry of the topic is stored.
+func (db *DB) lastWrite(topicHash uint64, off int64) time.Time {
+	var seq uint64
+	for _, we := range db.internal.timeWindow.lookup(db.fs, topicHash, off, _LookupFilter{}, 1) {
+		if we.seq() > seq {
+			seq = we.seq()
+		}
+	}
+	if seq == 0 {
+		return time.Time{}
+	}
+	e, err := db.readEntry(_Query{seq: seq})
+	if err != nil {
+		return time.Time{}
+	}
+	id, err := db.internal.reader.readMessageID(e)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(uid.Time(id[0:4]), 0)
+}
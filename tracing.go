@@ -0,0 +1,72 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"context"
+)
+
+// Tracer starts spans for DB operations. It is an adapter for a tracing library such as
+// OpenTelemetry, see docs for an OpenTelemetry adapter. The DB does not depend on a tracing library.
+type Tracer interface {
+	// Start starts a span with the name as a child of the span in the context if any
+	// and returns the context holding the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by the Tracer.
+type Span interface {
+	// SetAttribute sets an attribute of the span.
+	SetAttribute(key string, value interface{})
+	// RecordError records an error of the operation.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// Span names of the traced operations.
+const (
+	spanPut     = "unitdb.Put"
+	spanGet     = "unitdb.Get"
+	spanSync    = "unitdb.Sync"
+	spanRecover = "unitdb.Recover"
+)
+
+type _NoopSpan struct{}
+
+func (_NoopSpan) SetAttribute(key string, value interface{}) {}
+func (_NoopSpan) RecordError(err error)                      {}
+func (_NoopSpan) End()                                       {}
+
+// startSpan starts a span if the tracer is set.
+func (db *DB) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if db.opts.tracer == nil {
+		return ctx, _NoopSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.opts.tracer.Start(ctx, name)
+}
+
+// endSpan records the error if any and ends the span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
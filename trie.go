@@ -17,8 +17,13 @@
 package unitdb
 
 import (
+	"bytes"
+	"fmt"
+	"regexp"
 	"sync"
+	"time"
 
+	"github.com/unit-io/unitdb/hash"
 	"github.com/unit-io/unitdb/message"
 )
 
@@ -57,21 +62,24 @@ type _Part struct {
 
 type _Node struct {
 	part     _Part
+	name     string // name of the part, it is empty if the name is not known.
 	depth    uint8
 	parent   *_Node
 	children map[_Part]*_Node
 	topics   _Topics
+
+	// aliases are the nodes linked to the node by AliasTopic, lookup of the node returns the topics of its aliases.
+	aliases []*_Node
 }
 
+// orphan removes the node from its parent if the node has no topics and no children.
 func (n *_Node) orphan() {
-	if n.parent == nil {
+	if n.parent == nil || len(n.topics) != 0 || len(n.children) != 0 || len(n.aliases) != 0 {
 		return
 	}
 
 	delete(n.parent.children, n.part)
-	if len(n.parent.children) == 0 {
-		n.parent.orphan()
-	}
+	n.parent.orphan()
 }
 
 // _topicTrie represents an efficient collection of Trie with lookup capability.
@@ -95,14 +103,20 @@ type _Trie struct {
 	sync.RWMutex
 	mutex     _Mutex
 	topicTrie *_TopicTrie
+	separator message.Separator // separator is used to join the names of the topic parts.
+
+	// missing caches the queries matching no topics, it is nil if the negative lookup cache is disabled.
+	missing *_NegativeCache
 }
 
 // newTrie new trie creates a Trie with an initialized Trie.
 // Mutex is used to lock concurent read/write on a contract, and it does not lock entire trie.
-func newTrie() *_Trie {
+func newTrie(separator message.Separator, negativeTTL time.Duration) *_Trie {
 	return &_Trie{
 		mutex:     newMutex(),
 		topicTrie: newTopicTrie(),
+		separator: separator,
+		missing:   newNegativeCache(negativeTTL),
 	}
 }
 
@@ -138,7 +152,12 @@ func (t *_Trie) add(topic _Topic, parts []message.Part, depth uint8) (added bool
 				children: make(map[_Part]*_Node),
 			}
 			t.Lock()
-			curr.children[newPart] = child
+			// the node may be added by another topic sharing the part, as topics are added concurrently on DB open.
+			if c, ok := curr.children[newPart]; ok {
+				child = c
+			} else {
+				curr.children[newPart] = child
+			}
 			t.Unlock()
 		}
 		curr = child
@@ -147,24 +166,57 @@ func (t *_Trie) add(topic _Topic, parts []message.Part, depth uint8) (added bool
 	curr.topics.addUnique(topic)
 	t.topicTrie.summary[topic.hash] = curr
 	t.Unlock()
+	t.missing.invalidate(parts[0].Hash)
 	added = true
 	curr.depth = depth
 	return
 }
 
+// _Visit is a node visited by lookup with the number of query parts remaining.
+type _Visit struct {
+	node      *_Node
+	remaining int
+}
+
+// _LookupState tracks nodes visited and topics collected during a lookup. A node is reachable through
+// both exact and wildchar branches, so the node is traversed and its topics collected only once.
+type _LookupState struct {
+	visited map[_Visit]struct{}
+	topics  map[uint64]struct{}
+}
+
+// add appends the topics not yet collected.
+func (state *_LookupState) add(tops *_Topics, topics _Topics) {
+	for _, topic := range topics {
+		if _, ok := state.topics[topic.hash]; ok {
+			continue
+		}
+		state.topics[topic.hash] = struct{}{}
+		*tops = append(*tops, topic)
+	}
+}
+
 // lookup returns window entry set for given topic.
 func (t *_Trie) lookup(query []message.Part, depth, topicType uint8) (tops _Topics) {
 	t.RLock()
 	defer t.RUnlock()
-	t.ilookup(query, depth, topicType, &tops, t.topicTrie.root)
+	state := &_LookupState{visited: make(map[_Visit]struct{}), topics: make(map[uint64]struct{})}
+	t.ilookup(query, depth, topicType, &tops, t.topicTrie.root, state)
 	return
 }
 
-func (t *_Trie) ilookup(query []message.Part, depth, topicType uint8, tops *_Topics, currNode *_Node) {
+func (t *_Trie) ilookup(query []message.Part, depth, topicType uint8, tops *_Topics, currNode *_Node, state *_LookupState) {
+	visit := _Visit{node: currNode, remaining: len(query)}
+	if _, ok := state.visited[visit]; ok {
+		return
+	}
+	state.visited[visit] = struct{}{}
+
 	// Add topics from the current branch.
 	if currNode.depth == depth || (topicType == message.TopicStatic && currNode.part.hash == message.Wildcard) {
-		for _, topic := range currNode.topics {
-			tops.addUnique(topic)
+		state.add(tops, currNode.topics)
+		for _, n := range currNode.aliases {
+			state.add(tops, n.topics)
 		}
 	}
 
@@ -178,15 +230,100 @@ func (t *_Trie) ilookup(query []message.Part, depth, topicType uint8, tops *_Top
 	for part, n := range currNode.children {
 		switch {
 		case part.hash == q.Hash && q.Wildchars == part.wildchars:
-			t.ilookup(query[1:], depth, topicType, tops, n)
+			t.ilookup(query[1:], depth, topicType, tops, n, state)
 		case part.hash == q.Hash && uint8(len(query)) >= part.wildchars+1:
-			t.ilookup(query[part.wildchars+1:], depth, topicType, tops, n)
+			t.ilookup(query[part.wildchars+1:], depth, topicType, tops, n, state)
 		case part.hash == message.Wildcard:
-			t.ilookup(query[:], depth, topicType, tops, n)
+			t.ilookup(query[:], depth, topicType, tops, n, state)
 		}
 	}
 }
 
+// lookupWildcard returns topics of a wildcard query, that is the wildcard topics the query matches and the topics
+// matching the pattern parts of the query, so the wildcards at the beginning and the middle of the query match any part.
+func (t *_Trie) lookupWildcard(query []message.Part, pattern [][]byte, depth uint8) (tops _Topics) {
+	tops = t.lookup(query, depth, message.TopicWildcard)
+	seen := make(map[uint64]struct{}, len(tops))
+	for _, topic := range tops {
+		seen[topic.hash] = struct{}{}
+	}
+	for _, topic := range t.match(query[0].Hash, pattern) {
+		if _, ok := seen[topic.hash]; ok {
+			continue
+		}
+		seen[topic.hash] = struct{}{}
+		tops = append(tops, topic)
+	}
+	return tops
+}
+
+// match returns topics of the contract matching the pattern parts. The '*' part matches any
+// single part and the trailing "..." matches one or more parts of the topic.
+func (t *_Trie) match(contract uint32, pattern [][]byte) (tops _Topics) {
+	t.RLock()
+	defer t.RUnlock()
+	if curr, ok := t.topicTrie.root.children[_Part{hash: contract}]; ok {
+		t.imatch(contract, pattern, curr, &tops)
+	}
+	return
+}
+
+func (t *_Trie) imatch(contract uint32, pattern [][]byte, currNode *_Node, tops *_Topics) {
+	if len(pattern) == 0 {
+		*tops = append(*tops, currNode.topics...)
+		return
+	}
+	p := pattern[0]
+	switch {
+	case bytes.Equal(p, []byte(message.TopicGenericSymbol)):
+		for _, n := range currNode.children {
+			n.collect(tops)
+		}
+	case bytes.HasSuffix(p, []byte{message.TopicWildcardSymbol}):
+		for _, n := range currNode.children {
+			t.imatch(contract, pattern[1:], n, tops)
+		}
+	default:
+		if n, ok := currNode.children[_Part{hash: hash.WithSalt(p, contract)}]; ok {
+			t.imatch(contract, pattern[1:], n, tops)
+		}
+	}
+}
+
+// matchRegex returns topics of the contract with names of the parts matching the patterns at the same depth.
+// The parts with unknown names and the wildcard parts do not match.
+func (t *_Trie) matchRegex(contract uint32, patterns []*regexp.Regexp) (tops _Topics) {
+	t.RLock()
+	defer t.RUnlock()
+	if curr, ok := t.topicTrie.root.children[_Part{hash: contract}]; ok {
+		curr.matchRegex(patterns, &tops)
+	}
+	return
+}
+
+func (n *_Node) matchRegex(patterns []*regexp.Regexp, tops *_Topics) {
+	if len(patterns) == 0 {
+		*tops = append(*tops, n.topics...)
+		return
+	}
+	for part, child := range n.children {
+		if part.hash == message.Wildcard || part.wildchars > 0 || child.name == "" {
+			continue
+		}
+		if patterns[0].MatchString(child.name) {
+			child.matchRegex(patterns[1:], tops)
+		}
+	}
+}
+
+// collect appends topics of the node and its descendants.
+func (n *_Node) collect(tops *_Topics) {
+	*tops = append(*tops, n.topics...)
+	for _, child := range n.children {
+		child.collect(tops)
+	}
+}
+
 func (t *_Trie) getOffset(topicHash uint64) (off int64, ok bool) {
 	t.RLock()
 	defer t.RUnlock()
@@ -209,3 +346,179 @@ func (t *_Trie) setOffset(topic _Topic) (ok bool) {
 	}
 	return false
 }
+
+// remove removes a topic from the trie.
+func (t *_Trie) remove(topicHash uint64) (ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	curr, ok := t.topicTrie.summary[topicHash]
+	if !ok {
+		return false
+	}
+	for i, topic := range curr.topics {
+		if topic.hash == topicHash {
+			curr.topics = append(curr.topics[:i], curr.topics[i+1:]...)
+			break
+		}
+	}
+	delete(t.topicTrie.summary, topicHash)
+	curr.orphan()
+	return true
+}
+
+// alias links the node of the alias parts to the node of the topic, so lookup of either node returns
+// the topics of both nodes. The node of the alias parts is added if it is not in the trie. It returns
+// false if the topic is not in the trie.
+func (t *_Trie) alias(topicHash uint64, parts []message.Part, depth uint8) (ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	n, ok := t.topicTrie.summary[topicHash]
+	if !ok {
+		return false
+	}
+	curr := t.topicTrie.root
+	for _, p := range parts {
+		part := _Part{hash: p.Hash, wildchars: p.Wildchars}
+		child, ok := curr.children[part]
+		if !ok {
+			child = &_Node{
+				part:     part,
+				parent:   curr,
+				children: make(map[_Part]*_Node),
+			}
+			curr.children[part] = child
+		}
+		curr = child
+	}
+	if len(curr.topics) == 0 {
+		curr.depth = depth
+	}
+	if curr == n {
+		return true
+	}
+	for _, a := range curr.aliases {
+		if a == n {
+			return true
+		}
+	}
+	curr.aliases = append(curr.aliases, n)
+	n.aliases = append(n.aliases, curr)
+	t.missing.invalidateAll()
+	return true
+}
+
+// setNames sets names of the nodes on the path of the topic parts. The first part is the
+// contract and the names are names of the remaining parts. It returns false if the path
+// is not in the trie.
+func (t *_Trie) setNames(parts []message.Part, names [][]byte) (ok bool) {
+	if len(parts) != len(names)+1 {
+		return false
+	}
+	t.Lock()
+	defer t.Unlock()
+	curr := t.topicTrie.root
+	var path []*_Node
+	for _, p := range parts {
+		child, ok := curr.children[_Part{hash: p.Hash, wildchars: p.Wildchars}]
+		if !ok {
+			return false
+		}
+		path = append(path, child)
+		curr = child
+	}
+	for i, n := range path[1:] {
+		if n.name == "" {
+			n.name = string(names[i])
+		}
+	}
+	return true
+}
+
+// node returns the node of the contract at the path of the prefix parts.
+func (t *_Trie) node(contract uint32, prefix [][]byte) (*_Node, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	curr, ok := t.topicTrie.root.children[_Part{hash: contract}]
+	for _, p := range prefix {
+		if !ok {
+			break
+		}
+		curr, ok = curr.children[_Part{hash: hash.WithSalt(p, contract)}]
+	}
+	return curr, ok
+}
+
+// all returns the topics of the trie.
+func (t *_Trie) all() (tops _Topics) {
+	t.RLock()
+	defer t.RUnlock()
+	t.topicTrie.root.collect(&tops)
+	return tops
+}
+
+// contractTopics returns the topics of the contract, the topics of a contract are the subtree of the contract part.
+func (t *_Trie) contractTopics(contract uint32) (tops _Topics) {
+	t.RLock()
+	defer t.RUnlock()
+	if n, ok := t.topicTrie.root.children[_Part{hash: contract}]; ok {
+		n.collect(&tops)
+	}
+	return tops
+}
+
+// topicName returns the contract and the name of the topic of the topic hash. A wildcard part is named
+// '*' and a part with unknown name is named '#' followed by its hash.
+func (t *_Trie) topicName(topicHash uint64) (contract uint32, topic []byte, ok bool) {
+	t.RLock()
+	defer t.RUnlock()
+	n, ok := t.topicTrie.summary[topicHash]
+	if !ok {
+		return 0, nil, false
+	}
+	var names []string
+	for ; n.parent != nil && n.parent != t.topicTrie.root; n = n.parent {
+		switch {
+		case n.part.hash == message.Wildcard:
+			names = append(names, string(message.TopicWildcardSymbol))
+		case n.name == "":
+			names = append(names, fmt.Sprintf("#%08x", n.part.hash))
+		default:
+			names = append(names, n.name)
+		}
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		topic = append(topic, names[i]...)
+		if i > 0 {
+			topic = append(topic, byte(t.separator))
+		}
+	}
+	return n.part.hash, topic, true
+}
+
+// children returns the child nodes of the node and the topics of the subtree of each child.
+func (t *_Trie) children(n *_Node) (nodes []*_Node, tops []_Topics) {
+	t.RLock()
+	defer t.RUnlock()
+	for _, child := range n.children {
+		var subtree _Topics
+		child.collect(&subtree)
+		nodes = append(nodes, child)
+		tops = append(tops, subtree)
+	}
+	return nodes, tops
+}
+
+// rawTopic returns the topic of the topic hash in the binary form packed in the first entry of the topic.
+func (t *_Trie) rawTopic(topicHash uint64) ([]byte, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	n, ok := t.topicTrie.summary[topicHash]
+	if !ok {
+		return nil, false
+	}
+	topic := message.Topic{Depth: n.depth}
+	for ; n != t.topicTrie.root; n = n.parent {
+		topic.Parts = append([]message.Part{{Hash: n.part.hash, Wildchars: n.part.wildchars}}, topic.Parts...)
+	}
+	return topic.Marshal(), true
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+const (
+	// checkpointBatchHeaderSize is size of the size and the checksum preceding a batch of the trie checkpoint.
+	checkpointBatchHeaderSize = 4 + 4
+	// checkpointRecordSize is size of the fixed fields of a checkpoint record preceding the raw topic.
+	checkpointRecordSize = 8 + 8 + 2
+	// minCheckpointRecords is the number of records appended to the checkpoint before it is rewritten,
+	// the checkpoint is also rewritten once more records are appended than the number of topics.
+	minCheckpointRecords = 1024
+)
+
+type (
+	// _TrieCheckpoint persists the topics of the trie synced to the window file, so the trie is loaded from
+	// the checkpoint on open instead of scanning all window blocks. The checkpoint is a log of batches of
+	// the topics changed since the previous batch, a batch is appended on each sync and carries the epoch of
+	// the DB header written by the sync. The checkpoint is loaded only if the epoch of its last batch matches
+	// the epoch of the DB header, otherwise the checkpoint is stale and the window blocks are scanned.
+	_TrieCheckpoint struct {
+		mu   sync.Mutex
+		path string
+
+		topics  map[uint64]int64 // topics maps the synced topics to the offsets of the heads of their window block chains.
+		changed map[uint64]bool  // changed maps the topics changed since the last batch, false if the topic is removed.
+
+		appended int  // appended is the number of records appended since the checkpoint is rewritten.
+		rewrite  bool // rewrite is set if the checkpoint does not have all topics and is rewritten on the next commit.
+		disabled bool // disabled is set if a sync failed, the checkpoint is not written until the DB is reopened.
+	}
+
+	_CheckpointTopic struct {
+		hash     uint64
+		offset   int64
+		rawTopic []byte
+	}
+)
+
+func newTrieCheckpoint(dirName string) *_TrieCheckpoint {
+	return &_TrieCheckpoint{
+		path:    path.Join(dirName, fmt.Sprintf("%s.trie", prefix)),
+		topics:  make(map[uint64]int64),
+		changed: make(map[uint64]bool),
+	}
+}
+
+// load reads the topics from the checkpoint. It returns false if the checkpoint does not exist or is stale,
+// the batch partially written at the end of the checkpoint is ignored.
+func (c *_TrieCheckpoint) load(epoch uint64) ([]_CheckpointTopic, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rewrite = true
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	topics := make(map[uint64]_CheckpointTopic)
+	var lastEpoch uint64
+	found := false
+	for len(data) >= checkpointBatchHeaderSize {
+		size := int(binary.LittleEndian.Uint32(data[0:4]))
+		if size < 8 || len(data) < checkpointBatchHeaderSize+size {
+			break
+		}
+		body := data[checkpointBatchHeaderSize : checkpointBatchHeaderSize+size]
+		if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[4:8]) {
+			break
+		}
+		data = data[checkpointBatchHeaderSize+size:]
+		lastEpoch, found = binary.LittleEndian.Uint64(body[0:8]), true
+		for body = body[8:]; len(body) > 0; {
+			if len(body) < checkpointRecordSize {
+				return nil, false, errCorrupted
+			}
+			topic := _CheckpointTopic{
+				hash:   binary.LittleEndian.Uint64(body[0:8]),
+				offset: int64(binary.LittleEndian.Uint64(body[8:16])),
+			}
+			topicSize := int(binary.LittleEndian.Uint16(body[16:18]))
+			if len(body) < checkpointRecordSize+topicSize {
+				return nil, false, errCorrupted
+			}
+			topic.rawTopic = body[checkpointRecordSize : checkpointRecordSize+topicSize]
+			body = body[checkpointRecordSize+topicSize:]
+			if topicSize == 0 {
+				delete(topics, topic.hash)
+				continue
+			}
+			topics[topic.hash] = topic
+		}
+	}
+	if !found || lastEpoch != epoch {
+		return nil, false, nil
+	}
+	loaded := make([]_CheckpointTopic, 0, len(topics))
+	for _, topic := range topics {
+		loaded = append(loaded, topic)
+		c.topics[topic.hash] = topic.offset
+	}
+	c.rewrite = false
+	return loaded, true, nil
+}
+
+// reset removes the topics loaded, so the checkpoint is rewritten with the topics loaded from the window blocks.
+func (c *_TrieCheckpoint) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics = make(map[uint64]int64)
+	c.changed = make(map[uint64]bool)
+	c.rewrite = true
+}
+
+// set sets the offset of the head of the window block chain of the synced topic.
+func (c *_TrieCheckpoint) set(topicHash uint64, off int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics[topicHash] = off
+	c.changed[topicHash] = true
+}
+
+// remove removes the deleted topic.
+func (c *_TrieCheckpoint) remove(topicHash uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.topics[topicHash]; !ok {
+		return
+	}
+	delete(c.topics, topicHash)
+	c.changed[topicHash] = false
+}
+
+// commit appends the topics changed since the last batch to the checkpoint with the epoch of the DB header.
+// The checkpoint is rewritten with all topics if it has more records appended than the number of topics.
+// The DB header of the epoch is written before the batch, so a batch lost on a crash leaves the checkpoint
+// stale. The batch committed without writing the DB header is synced to disk using fsync.
+func (c *_TrieCheckpoint) commit(epoch uint64, t *_Trie, fsync bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.disabled {
+		return nil
+	}
+	if c.rewrite || c.appended+len(c.changed) >= len(c.topics)+minCheckpointRecords {
+		return c.writeAll(epoch, t, fsync)
+	}
+	batch := newCheckpointBatch(epoch)
+	for h, ok := range c.changed {
+		if !ok {
+			batch.add(h, 0, nil)
+			continue
+		}
+		if rawTopic, ok := t.rawTopic(h); ok {
+			batch.add(h, c.topics[h], rawTopic)
+		}
+	}
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(batch.marshal()); err != nil {
+		return err
+	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	c.appended += len(c.changed) + 1
+	c.changed = make(map[uint64]bool)
+	return nil
+}
+
+// writeAll rewrites the checkpoint with all topics. The caller must hold the lock.
+func (c *_TrieCheckpoint) writeAll(epoch uint64, t *_Trie, fsync bool) error {
+	batch := newCheckpointBatch(epoch)
+	for h, off := range c.topics {
+		if rawTopic, ok := t.rawTopic(h); ok {
+			batch.add(h, off, rawTopic)
+		}
+	}
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(batch.marshal()); err != nil {
+		f.Close()
+		return err
+	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.appended = 0
+	c.rewrite = false
+	c.changed = make(map[uint64]bool)
+	return nil
+}
+
+// invalidate removes the checkpoint if a sync failed, as the topics changed may not match the synced window blocks.
+// The window blocks are scanned on the next open.
+func (c *_TrieCheckpoint) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disabled = true
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		logger.Error().Err(err).Str("context", "trieCheckpoint.invalidate")
+	}
+}
+
+// _CheckpointBatch is a batch of the checkpoint records, a record with empty topic removes the topic.
+type _CheckpointBatch []byte
+
+func newCheckpointBatch(epoch uint64) _CheckpointBatch {
+	b := make(_CheckpointBatch, checkpointBatchHeaderSize+8)
+	binary.LittleEndian.PutUint64(b[checkpointBatchHeaderSize:], epoch)
+	return b
+}
+
+func (b *_CheckpointBatch) add(topicHash uint64, off int64, rawTopic []byte) {
+	var rec [checkpointRecordSize]byte
+	binary.LittleEndian.PutUint64(rec[0:8], topicHash)
+	binary.LittleEndian.PutUint64(rec[8:16], uint64(off))
+	binary.LittleEndian.PutUint16(rec[16:18], uint16(len(rawTopic)))
+	*b = append(append(*b, rec[:]...), rawTopic...)
+}
+
+func (b _CheckpointBatch) marshal() []byte {
+	body := b[checkpointBatchHeaderSize:]
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(body)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(body))
+	return b
+}
+
+// loadTrieCheckpoint adds the topics from the trie checkpoint to the trie. It returns false if the
+// checkpoint is stale and the trie is loaded from the window blocks.
+func (db *DB) loadTrieCheckpoint() (bool, error) {
+	topics, ok, err := db.internal.checkpoint.load(db.internal.dbInfo.epoch)
+	if !ok || err != nil {
+		return false, err
+	}
+	parsed := make([]message.Topic, len(topics))
+	for i, topic := range topics {
+		if err := parsed[i].Unmarshal(topic.rawTopic); err != nil {
+			return false, err
+		}
+	}
+	for i, topic := range topics {
+		db.internal.trie.add(newTopic(topic.hash, topic.offset), parsed[i].Parts, parsed[i].Depth)
+	}
+	return true, nil
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"github.com/unit-io/unitdb/message"
+)
+
+type (
+	// _TxPut is a pending put of the transaction.
+	_TxPut struct {
+		entry     Entry
+		topicHash uint64
+	}
+
+	// Tx is a read-write transaction. Writes of the transaction are kept pending and
+	// are written to the DB on Commit in a single batch, so entries put by the
+	// transaction are committed together with a single timeID in the WAL. Deletes are
+	// added to the same batch and applied once the entries are committed. Get on the
+	// transaction returns the pending entries put to the topic of the query along with
+	// the entries in the DB.
+	//
+	// A transaction is not safe for concurrent use.
+	Tx struct {
+		db        *DB
+		opts      *_Options
+		batchOpts []Options
+		puts      []_TxPut
+		deletes   []*Entry
+		deleted   map[uint64]struct{} // seq of pending deletes.
+		closed    bool
+	}
+)
+
+// Tx begins a new transaction. The batch options such as WithBatchContract and
+// WithBatchEncryption are applied to the entries of the transaction.
+func (db *DB) Tx(opts ...Options) (*Tx, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	o := &_Options{}
+	WithDefaultBatchOptions().set(o)
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(o)
+		}
+	}
+	return &Tx{db: db, opts: o, batchOpts: opts, deleted: make(map[uint64]struct{})}, nil
+}
+
+// Put adds entry for the topic to the transaction. It uses the contract of the
+// transaction set using WithBatchContract option.
+func (tx *Tx) Put(topic, payload []byte) error {
+	return tx.PutEntry(NewEntry(topic, payload).WithContract(tx.opts.batchOptions.contract))
+}
+
+// PutEntry adds entry to the transaction. It is safe to modify the contents
+// of the argument after PutEntry returns.
+func (tx *Tx) PutEntry(e *Entry) error {
+	if tx.closed {
+		return errTxClosed
+	}
+	switch {
+	case len(e.Topic) == 0:
+		return errTopicEmpty
+	case len(e.Topic) > maxTopicLength:
+		return errTopicTooLarge
+	case len(e.Payload) == 0:
+		return errValueEmpty
+	case len(e.Payload) > maxValueLength:
+		return errValueTooLarge
+	}
+	contract := e.Contract
+	if contract == 0 {
+		contract = message.MasterContract
+	}
+	t, _, err := tx.db.parseTopic(contract, e.Topic)
+	if err != nil {
+		return err
+	}
+	t.AddContract(contract)
+	put := _TxPut{entry: *e, topicHash: t.GetHash(contract)}
+	put.entry.entry = _Entry{}
+	put.entry.ID = append([]byte(nil), e.ID...)
+	put.entry.Topic = append([]byte(nil), e.Topic...)
+	put.entry.Payload = append([]byte(nil), e.Payload...)
+	tx.puts = append(tx.puts, put)
+	return nil
+}
+
+// Delete adds delete of the entry to the transaction.
+func (tx *Tx) Delete(id, topic []byte) error {
+	return tx.DeleteEntry(NewEntry(topic, nil).WithID(id))
+}
+
+// DeleteEntry adds delete of the entry to the transaction. If the entry is put
+// by the transaction, the pending put is removed from the transaction.
+func (tx *Tx) DeleteEntry(e *Entry) error {
+	if tx.closed {
+		return errTxClosed
+	}
+	switch {
+	case tx.db.opts.flags.immutable:
+		return errImmutable
+	case len(e.ID) == 0:
+		return errMsgIDEmpty
+	case len(e.Topic) == 0:
+		return errTopicEmpty
+	case len(e.Topic) > maxTopicLength:
+		return errTopicTooLarge
+	}
+	seq := message.ID(e.ID).Sequence()
+	for i := range tx.puts {
+		if id := tx.puts[i].entry.ID; id != nil && message.ID(id).Sequence() == seq {
+			tx.puts = append(tx.puts[:i], tx.puts[i+1:]...)
+			break
+		}
+	}
+	tx.deleted[seq] = struct{}{}
+	tx.deletes = append(tx.deletes, &Entry{ID: append([]byte(nil), e.ID...), Topic: append([]byte(nil), e.Topic...), Contract: e.Contract})
+	return nil
+}
+
+// Get returns items matching the query, it includes the pending entries put by the
+// transaction to the topic of the query and excludes the entries deleted by the transaction.
+func (tx *Tx) Get(q *Query) (items [][]byte, err error) {
+	if tx.closed {
+		return nil, errTxClosed
+	}
+	db := tx.db
+	if err := db.parseQuery(q); err != nil {
+		return nil, err
+	}
+	// pending entries are the most recent entries of the topic, these are not matched by a regex query.
+	var pending [][]byte
+	if !q.internal.regex {
+		topicHash := (&message.Topic{Parts: q.internal.parts, Depth: q.internal.depth}).GetHash(q.Contract)
+		for i := range tx.puts {
+			if tx.puts[i].topicHash == topicHash {
+				pending = append(pending, tx.puts[i].entry.Payload)
+			}
+		}
+	}
+	if q.internal.order == OrderDesc {
+		for i := len(pending) - 1; i >= 0 && len(items) < q.Limit; i-- {
+			items = append(items, pending[i])
+		}
+		if len(items) == q.Limit {
+			return items, nil
+		}
+	}
+
+	mu := db.internal.mutex.getMutex(q.internal.prefix)
+	mu.RLock()
+	defer mu.RUnlock()
+	limit := q.Limit
+	q.Limit += len(tx.deleted)
+	db.lookup(q)
+	q.Limit = limit
+	q.internal.sortEntries()
+	for _, query := range q.internal.winEntries {
+		if len(items) == q.Limit {
+			break
+		}
+		if _, ok := tx.deleted[query.seq]; ok || query.seq == 0 {
+			continue
+		}
+		item, ok, err := db.readItem(q, query)
+		if err != nil {
+			return items, err
+		}
+		if ok {
+			items = append(items, item.val)
+		}
+	}
+	if q.internal.order == OrderAsc {
+		for i := 0; i < len(pending) && len(items) < q.Limit; i++ {
+			items = append(items, pending[i])
+		}
+	}
+	return items, nil
+}
+
+// Commit writes the pending entries and deletes of the transaction to the WAL in a single batch
+// under one time ID, the deletes are applied once the batch is committed. If a put or delete of the
+// transaction fails before the batch is committed, no entry of the transaction is applied. A delete
+// not applied on commit is replayed from the WAL on sync or recovery.
+func (tx *Tx) Commit() error {
+	if tx.closed {
+		return errTxClosed
+	}
+	tx.closed = true
+	defer func() {
+		tx.puts, tx.deletes = nil, nil
+	}()
+	if len(tx.puts) == 0 && len(tx.deletes) == 0 {
+		return nil
+	}
+	return tx.db.Batch(func(b *Batch, completed <-chan struct{}) error {
+		b.SetOptions(tx.batchOpts...)
+		for i := range tx.puts {
+			e := tx.puts[i].entry
+			if err := b.PutEntry(&e); err != nil {
+				return err
+			}
+		}
+		for _, e := range tx.deletes {
+			if err := b.DeleteEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback discards the pending writes of the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.closed {
+		return errTxClosed
+	}
+	tx.closed = true
+	tx.puts, tx.deletes = nil, nil
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/unit-io/unitdb/message"
+)
+
+const (
+	// verifySampleSize is number of topics to sample queries from during verification.
+	verifySampleSize = 16
+
+	// verifyMaxErrors is maximum number of errors retained in the verify report.
+	verifyMaxErrors = 100
+)
+
+// VerifyReport is the result of the DB integrity verification.
+type VerifyReport struct {
+	Seq           uint64   `json:"seq"`            // Sequence of the last entry.
+	Count         uint64   `json:"count"`          // Logical entry count maintained on sync and delete.
+	Reconciled    uint64   `json:"reconciled"`     // Entry count recounted from the index file.
+	WindowBlocks  int      `json:"window_blocks"`  // Number of time window blocks scanned.
+	Entries       int      `json:"entries"`        // Number of valid entries.
+	Deleted       int      `json:"deleted"`        // Number of deleted entries.
+	Expired       int      `json:"expired"`        // Number of expired entries already released.
+	Missing       int      `json:"missing"`        // Number of entries in time window missing from index.
+	Corrupted     int      `json:"corrupted"`      // Number of entries whose message cannot be read or decoded.
+	SampledTopics int      `json:"sampled_topics"` // Number of topics sampled for queries.
+	SampleErrors  int      `json:"sample_errors"`  // Number of sampled topics failed to query.
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// OK returns true if verification has not found any error.
+func (r *VerifyReport) OK() bool {
+	return r.Missing == 0 && r.Corrupted == 0 && r.SampleErrors == 0
+}
+
+func (r *VerifyReport) errorf(format string, a ...interface{}) {
+	if len(r.Errors) < verifyMaxErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf(format, a...))
+	}
+}
+
+// Verify verifies integrity of the DB. It reads each entry referenced by the time window blocks,
+// checks the message is readable and decodes, and samples queries on topics found in the trie.
+func (db *DB) Verify() (*VerifyReport, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+	db.internal.syncLock.lock()
+	defer db.internal.syncLock.unlock()
+
+	report := &VerifyReport{Seq: atomic.LoadUint64(&db.internal.dbInfo.sequence), Count: db.Count()}
+	if err := db.reconcileCount(report); err != nil {
+		return report, err
+	}
+	r := newWindowReader(db.fs)
+	if r.winFile == nil {
+		return report, nil
+	}
+	for windowIdx := int32(0); windowIdx <= r.windowIdx; windowIdx++ {
+		r.offset = winBlockOffset(windowIdx)
+		b, err := r.readWindowBlock()
+		if err != nil {
+			break
+		}
+		if b.entryIdx == 0 {
+			continue
+		}
+		report.WindowBlocks++
+		for i := 0; i < int(b.entryIdx) && i < entriesPerWindowBlock; i++ {
+			we := b.entries[i]
+			if we.seq() == 0 {
+				continue
+			}
+			db.verifyEntry(report, we)
+		}
+		// Sample queries on the most recent window block of a topic.
+		if b.next == 0 && report.SampledTopics < verifySampleSize {
+			db.verifyTopic(report, b.topicHash, b.entries[0].seq())
+		}
+	}
+
+	return report, nil
+}
+
+// reconcileCount recounts the entries of the index file and corrects the logical count by the drift
+// if the counts differ. The logical count is not persisted until the next sync.
+func (db *DB) reconcileCount(report *VerifyReport) error {
+	r := newBlockReader(db.fs)
+	if r == nil || r.indexFile == nil {
+		return nil
+	}
+	count := db.Count()
+	reconciled, err := countIndexEntries(r, int32(r.indexFile.currSize()/int64(blockSize)))
+	if err != nil {
+		return err
+	}
+	report.Reconciled = reconciled
+	if reconciled != count {
+		logger.Warn().Str("context", "db.Verify").Uint64("count", count).Uint64("reconciled", reconciled).Msg("entry count drifted from index, correcting count")
+		db.internal.count.add(int64(reconciled) - int64(count))
+	}
+	return nil
+}
+
+func (db *DB) verifyEntry(report *VerifyReport, we _WinEntry) {
+	e, err := db.readEntry(_Query{seq: we.seq()})
+	switch {
+	case err == errMsgIDDeleted:
+		report.Deleted++
+		return
+	case err != nil && we.isExpired():
+		report.Expired++
+		return
+	case err != nil:
+		report.Missing++
+		report.errorf("seq %d: %v", we.seq(), err)
+		return
+	}
+	if e.seq != we.seq() {
+		report.Corrupted++
+		report.errorf("seq %d: index entry has sequence %d", we.seq(), e.seq)
+		return
+	}
+	id, val, err := db.internal.reader.readMessage(e)
+	if err != nil {
+		report.Corrupted++
+		report.errorf("seq %d: %v", we.seq(), err)
+		return
+	}
+	// last byte of ID is the encryption key id.
+	if val, err = db.decrypt(uint8(id[idSize-1]), val); err != nil {
+		report.Corrupted++
+		report.errorf("seq %d: %v", we.seq(), err)
+		return
+	}
+	if _, err := decompress(val); err != nil {
+		report.Corrupted++
+		report.errorf("seq %d: %v", we.seq(), err)
+		return
+	}
+	report.Entries++
+}
+
+// verifyTopic queries the topic of the window block using the trie and checks the topic resolves to its entries.
+func (db *DB) verifyTopic(report *VerifyReport, topicHash, seq uint64) {
+	e, err := db.readEntry(_Query{seq: seq})
+	if err != nil || e.topicSize == 0 {
+		return
+	}
+	rawTopic, err := db.internal.reader.readTopic(e)
+	if err != nil {
+		return
+	}
+	t := new(message.Topic)
+	if err := t.Unmarshal(rawTopic); err != nil {
+		return
+	}
+	for _, part := range t.Parts {
+		if part.Hash == message.Wildcard {
+			return
+		}
+	}
+	report.SampledTopics++
+	for _, topic := range db.internal.trie.lookup(t.Parts, t.Depth, message.TopicStatic) {
+		if topic.hash != topicHash {
+			continue
+		}
+		if len(db.internal.timeWindow.lookup(db.fs, topic.hash, topic.offset, _LookupFilter{}, 1)) == 0 {
+			break
+		}
+		return
+	}
+	report.SampleErrors++
+	report.errorf("topic %d: query returned no entries", topicHash)
+}
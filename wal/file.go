@@ -19,6 +19,7 @@ package wal
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -32,8 +33,9 @@ import (
 type (
 	_FileStore struct {
 		sync.RWMutex
-		dirName string
-		opened  bool
+		dirName    string
+		archiveDir string
+		opened     bool
 	}
 	_FileInfos []os.FileInfo
 )
@@ -61,6 +63,17 @@ func openFile(dirName string, bufferSize int64) (*_FileStore, error) {
 	return fs, nil
 }
 
+// setArchive sets the archive directory to move the released logs to.
+func (fs *_FileStore) setArchive(dirName string) error {
+	if !exists(dirName) {
+		if err := os.MkdirAll(dirName, os.FileMode(0770)); err != nil {
+			return err
+		}
+	}
+	fs.archiveDir = dirName
+	return nil
+}
+
 func (fs *_FileStore) close() {
 	fs.Lock()
 	defer fs.Unlock()
@@ -195,6 +208,26 @@ func (fs *_FileStore) all() []int64 {
 	return timeIDs
 }
 
+// size returns the total size of the logs stored in the file store.
+func (fs *_FileStore) size() int64 {
+	fs.RLock()
+	defer fs.RUnlock()
+	if !fs.opened {
+		return 0
+	}
+	files, err := ioutil.ReadDir(fs.dirName)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, f := range files {
+		if path.Ext(f.Name()) == logExt {
+			size += f.Size()
+		}
+	}
+	return size
+}
+
 func (fs *_FileStore) del(timeID int64) {
 	fs.Lock()
 	defer fs.Unlock()
@@ -209,14 +242,65 @@ func (fs *_FileStore) del(timeID int64) {
 		return
 	}
 
+	if fs.archiveDir != "" {
+		if err := moveFile(log, logPath(fs.archiveDir, timeID)); err == nil {
+			return
+		}
+	}
 	os.Remove(log)
 }
 
+// archive moves the log to the archive directory.
+func (fs *_FileStore) archive(timeID int64) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	return moveFile(logPath(fs.dirName, timeID), logPath(fs.archiveDir, timeID))
+}
+
+// unarchive copies the archived log to the file store. The archived log is kept so the
+// archive can be restored again.
+func (fs *_FileStore) unarchive(timeID int64) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	tmp := tmpPath(fs.dirName, timeID)
+	if err := copyFile(logPath(fs.archiveDir, timeID), tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, logPath(fs.dirName, timeID))
+}
+
+// archived provides a list of all time IDs stored in the archive directory.
+func (fs *_FileStore) archived() []int64 {
+	var timeIDs []int64
+	files, err := ioutil.ReadDir(fs.archiveDir)
+	if err != nil {
+		return nil
+	}
+	for _, f := range files {
+		name := f.Name()
+		if path.Ext(name) != logExt {
+			continue
+		}
+		timeID, err := strconv.ParseInt(name[:len(name)-len(logExt)], 10, 64)
+		if err != nil {
+			continue
+		}
+		timeIDs = append(timeIDs, timeID)
+	}
+
+	return timeIDs
+}
+
 // reset removes all persisted logs from file store.
 func (fs *_FileStore) reset() {
+	archiveDir := fs.archiveDir
+	fs.archiveDir = ""
 	for _, timeID := range fs.all() {
 		fs.del(timeID)
 	}
+	fs.archiveDir = archiveDir
 }
 
 func logPath(dirName string, timeID int64) string {
@@ -234,6 +318,38 @@ func corruptPath(dirName string, timeID int64) string {
 	return path.Join(dirName, suffix)
 }
 
+// moveFile moves the file, it copies the file if the file cannot be renamed across devices.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 func exists(file string) bool {
 	if _, err := os.Stat(file); err != nil {
 		if os.IsNotExist(err) {
@@ -18,6 +18,7 @@ package wal
 
 import (
 	"errors"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -61,10 +62,16 @@ type (
 
 	// Options wal options to create new WAL. WAL logs uses cyclic rotation to avoid fragmentation.
 	// It allocates free blocks only when log reaches target size.
+	//
+	// If ArchivePath is set then applied logs are moved to the archive directory instead of being
+	// released. If RestoreTime is also set then archived logs up to the RestoreTime are recovered on
+	// open and pending logs written after the RestoreTime are moved to the archive directory.
 	Options struct {
-		Path       string
-		BufferSize int64
-		Reset      bool
+		Path        string
+		BufferSize  int64
+		Reset       bool
+		ArchivePath string
+		RestoreTime int64
 	}
 )
 
@@ -77,12 +84,23 @@ func newWal(opts Options) (wal *WAL, err error) {
 	if err != nil {
 		return wal, err
 	}
+	if opts.ArchivePath != "" {
+		if err := wal.logStore.setArchive(opts.ArchivePath); err != nil {
+			return wal, err
+		}
+	}
 
 	if opts.Reset {
 		wal.logStore.reset()
 		return wal, nil
 	}
 
+	if opts.ArchivePath != "" && opts.RestoreTime > 0 {
+		if err := wal.restoreWal(opts.RestoreTime); err != nil {
+			return wal, err
+		}
+	}
+
 	wal.recoverWal()
 
 	return wal, nil
@@ -91,6 +109,36 @@ func newWal(opts Options) (wal *WAL, err error) {
 // recoverWal recovers a WAL for the log written but not released. It also updates free blocks.
 func (wal *WAL) recoverWal() {
 	wal.recoveredTimeIDs = wal.logStore.all()
+	if wal.opts.RestoreTime > 0 {
+		sort.Slice(wal.recoveredTimeIDs, func(i, j int) bool {
+			return wal.recoveredTimeIDs[i] < wal.recoveredTimeIDs[j]
+		})
+	}
+}
+
+// restoreWal copies the archived logs written up to the restore time to the log store so these are
+// recovered in the order of time and archives the pending logs written after the restore time.
+func (wal *WAL) restoreWal(restoreTime int64) error {
+	for _, timeID := range wal.logStore.all() {
+		if timeID > restoreTime {
+			if err := wal.logStore.archive(timeID); err != nil {
+				return err
+			}
+		}
+	}
+	archived := wal.logStore.archived()
+	sort.Slice(archived, func(i, j int) bool {
+		return archived[i] < archived[j]
+	})
+	for _, timeID := range archived {
+		if timeID > restoreTime {
+			break
+		}
+		if err := wal.logStore.unarchive(timeID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Close closes the wal, frees used resources and checks for active
@@ -117,7 +165,8 @@ func (wal *WAL) put(log _LogInfo, data *bpool.Buffer) error {
 	return wal.logStore.put(log, data)
 }
 
-// SignalLogApplied informs the WAL that it is safe to reuse blocks.
+// SignalLogApplied informs the WAL that it is safe to reuse blocks. The log is moved to the archive
+// directory if the WAL archive is set.
 func (wal *WAL) SignalLogApplied(timeID int64) error {
 	wal.mu.RLock()
 	wal.wg.Add(1)
@@ -132,6 +181,11 @@ func (wal *WAL) SignalLogApplied(timeID int64) error {
 	return nil
 }
 
+// Size returns the total size in bytes of the logs not yet applied and released.
+func (wal *WAL) Size() int64 {
+	return wal.logStore.size()
+}
+
 // Reset removes all persistested logs from log store.
 func (wal *WAL) Reset() {
 	wal.logStore.reset()
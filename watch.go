@@ -0,0 +1,608 @@
+/*
+ * Copyright 2020 Saffat Technologies, Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unitdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/unit-io/unitdb/message"
+	"github.com/unit-io/unitdb/uid"
+)
+
+const (
+	// defaultWatchBuffer is the default number of messages buffered for a watcher.
+	defaultWatchBuffer = 64
+
+	// tokenSize is the size of the resumption token.
+	tokenSize = 16
+)
+
+type (
+	// Message is an entry delivered to the watchers of a topic.
+	Message struct {
+		ID        []byte            // The ID of the message.
+		Topic     []byte            // The topic of the message, for wildcard watches it is the topic the message is put to.
+		Contract  uint32            // The contract of the message.
+		Payload   []byte            // The payload of the message, nil for metadata-only watches.
+		Headers   map[string]string // The headers set on the entry.
+		StoredAt  time.Time         // The time message is stored to the DB.
+		ExpiresAt uint32            // The time expiry of the message.
+		Token     []byte            // The resumption token to resume the watch after this message.
+		Skipped   int               // The number of messages coalesced into this message since the previous delivery.
+		Err       error             // The error set on the last message if the watcher fell behind, its Token is the token of the last message delivered.
+	}
+
+	// CancelFunc cancels the watch and closes the watch channel.
+	CancelFunc func()
+
+	_Watcher struct {
+		mu        sync.Mutex
+		topic     []byte
+		topicHash uint64
+		// pattern is the parts of the wildcard topic, it is nil for the static topic.
+		pattern [][]byte
+		opts    *_WatchOptions
+		msgC    chan Message
+		// doneC is closed once delivery to the watcher stops, cancelC is closed on cancel or on DB close.
+		doneC    chan struct{}
+		cancelC  chan struct{}
+		closed   bool
+		canceled bool
+
+		// overflowed is set if the channel buffer is full, the watcher is closed and the overflow
+		// message carrying the token of the last message delivered is sent as the last message.
+		overflowed bool
+		lastToken  []byte
+
+		// replaying is set while messages after the resumption token are replayed,
+		// live messages are kept pending until replay completes.
+		replaying bool
+		pending   []Message
+		lastSeq   uint64
+
+		// coalesce holds the coalesced messages of each topic delivered within the coalesce interval.
+		coalesce map[uint64]*_Coalesce // map[topicHash]coalesce
+	}
+
+	// _Coalesce holds the latest message and count of skipped messages of a topic within the coalesce interval.
+	_Coalesce struct {
+		timer   *time.Timer
+		latest  *Message
+		skipped int
+	}
+
+	_Watchers struct {
+		sync.RWMutex
+		watchers  map[uint64][]*_Watcher // map[topicHash]watchers
+		wildcards []*_Watcher            // watchers of wildcard topics matched on topic parts.
+	}
+)
+
+func newWatchers() *_Watchers {
+	return &_Watchers{watchers: make(map[uint64][]*_Watcher)}
+}
+
+// Watch watches the topic and delivers the messages put to the topic after the watch is started.
+// The topic can be a wildcard topic, the '*' part matches any single part and the trailing "..."
+// matches one or more parts of the topic the message is put to. Only messages put using the
+// contract of the watch are delivered. Watch options WithWatchContract, WithWatchMetadataOnly and WithWatchBufferSize are used to set
+// the watch. Messages are delivered to the channel before they are synced to the disk. If the channel
+// buffer is full the watcher is closed, the last message sent carries the overflow error in its Err and
+// the token of the last message delivered. The channel is closed on cancel or on DB close.
+//
+// If coalesce interval is set using WithWatchCoalesce option, at most one message is delivered per
+// interval for each topic and the message carries the count of skipped messages of the topic.
+//
+// Each message carries a resumption token. A restarted watcher passes the token of the last message
+// received using WithWatchFrom option to first receive the stored messages after the token, followed
+// by the live messages. The stored messages are read in pages of the buffer size and sent as the channel
+// is drained. Resumption is not supported for wildcard topics.
+func (db *DB) Watch(topic []byte, opts ...WatchOption) (<-chan Message, CancelFunc, error) {
+	if err := db.ok(); err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case len(topic) == 0:
+		return nil, nil, errTopicEmpty
+	case len(topic) > maxTopicLength:
+		return nil, nil, errTopicTooLarge
+	}
+	wo := &_WatchOptions{bufferSize: defaultWatchBuffer}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.set(wo)
+		}
+	}
+	if wo.contract == 0 {
+		wo.contract = message.MasterContract
+	}
+	if err := db.authorize(wo.contract, topic, OpGet); err != nil {
+		return nil, nil, err
+	}
+	t, _, err := db.parseTopic(wo.contract, topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.AddContract(wo.contract)
+	topicHash := t.GetHash(wo.contract)
+
+	var pattern [][]byte
+	if t.TopicType == message.TopicWildcard {
+		if wo.from != nil {
+			return nil, nil, errBadRequest
+		}
+		pattern, _ = db.opts.topicSeparator.SplitTopic(topic)
+	}
+
+	var from uint64
+	if wo.from != nil {
+		seq, hash, ok := parseToken(wo.from)
+		if !ok || hash != topicHash {
+			return nil, nil, errInvalidToken
+		}
+		from = seq
+	}
+
+	w := &_Watcher{topic: topic, topicHash: topicHash, pattern: pattern, opts: wo, msgC: make(chan Message, wo.bufferSize), doneC: make(chan struct{}), cancelC: make(chan struct{})}
+	w.replaying = wo.from != nil
+	db.internal.watchers.add(topicHash, w)
+	if w.replaying {
+		db.internal.closeW.Add(1)
+		go db.replay(w, from)
+	}
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			db.internal.watchers.remove(topicHash, w)
+		})
+	}
+	return w.msgC, cancel, nil
+}
+
+func (ws *_Watchers) add(topicHash uint64, w *_Watcher) {
+	ws.Lock()
+	defer ws.Unlock()
+	if w.pattern != nil {
+		ws.wildcards = append(ws.wildcards, w)
+		return
+	}
+	ws.watchers[topicHash] = append(ws.watchers[topicHash], w)
+}
+
+func (ws *_Watchers) remove(topicHash uint64, w *_Watcher) {
+	ws.Lock()
+	defer ws.Unlock()
+	if w.pattern != nil {
+		for i := range ws.wildcards {
+			if ws.wildcards[i] == w {
+				ws.wildcards = append(ws.wildcards[:i], ws.wildcards[i+1:]...)
+				w.close()
+				break
+			}
+		}
+		return
+	}
+	watchers := ws.watchers[topicHash]
+	for i := range watchers {
+		if watchers[i] == w {
+			watchers = append(watchers[:i], watchers[i+1:]...)
+			w.close()
+			break
+		}
+	}
+	if len(watchers) == 0 {
+		delete(ws.watchers, topicHash)
+		return
+	}
+	ws.watchers[topicHash] = watchers
+}
+
+// closeAll closes the channels of all watchers.
+func (ws *_Watchers) closeAll() {
+	ws.Lock()
+	defer ws.Unlock()
+	for topicHash, watchers := range ws.watchers {
+		for _, w := range watchers {
+			w.close()
+		}
+		delete(ws.watchers, topicHash)
+	}
+	for _, w := range ws.wildcards {
+		w.close()
+	}
+	ws.wildcards = nil
+}
+
+// hasWildcards reports whether there are watchers of wildcard topics.
+func (ws *_Watchers) hasWildcards() bool {
+	ws.RLock()
+	defer ws.RUnlock()
+	return len(ws.wildcards) > 0
+}
+
+// match returns watchers of the topic hash and the watchers of wildcard topics matching the topic parts.
+func (ws *_Watchers) match(topicHash uint64, contract uint32, parts [][]byte) []*_Watcher {
+	watchers := ws.watchers[topicHash]
+	if len(ws.wildcards) == 0 || len(parts) == 0 || isWildcard(parts) {
+		return watchers
+	}
+	var matched []*_Watcher
+	for _, w := range ws.wildcards {
+		if w.opts.contract == contract && matchTopic(w.pattern, parts) {
+			matched = append(matched, w)
+		}
+	}
+	if len(matched) == 0 {
+		return watchers
+	}
+	return append(matched, watchers...)
+}
+
+// matchTopic matches the topic parts with the parts of the wildcard topic. The '*' part
+// matches any single part and the trailing "..." matches one or more parts.
+func matchTopic(pattern, parts [][]byte) bool {
+	for i, p := range pattern {
+		if bytes.Equal(p, []byte(message.TopicGenericSymbol)) {
+			return len(parts) > i
+		}
+		if i >= len(parts) {
+			return false
+		}
+		if bytes.HasSuffix(p, []byte{message.TopicWildcardSymbol}) {
+			continue
+		}
+		if !bytes.Equal(p, parts[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(parts)
+}
+
+// isWildcard reports whether any of the topic parts is a wildcard.
+func isWildcard(parts [][]byte) bool {
+	for _, p := range parts {
+		if bytes.HasSuffix(p, []byte{message.TopicWildcardSymbol}) || bytes.Equal(p, []byte(message.TopicGenericSymbol)) {
+			return true
+		}
+	}
+	return false
+}
+
+// notify delivers the packed entry to the watchers of the topic and the watchers of the wildcard
+// topics matching the topic. The topic is used to match the wildcard topics, it can be nil. The payload
+// is decoded and delivered to the matched watchers after the watchers lock is released.
+func (db *DB) notify(e _Entry, data []byte, topic []byte, headers map[string]string) {
+	ws := db.internal.watchers
+	ws.RLock()
+	if len(ws.watchers[e.topicHash]) == 0 && len(ws.wildcards) == 0 {
+		ws.RUnlock()
+		return
+	}
+
+	id := make(message.ID, message.ID(nil).Size())
+	copy(id, data[entrySize:entrySize+idSize-1])
+	binary.LittleEndian.PutUint64(id[8:16], e.seq)
+	contract := binary.LittleEndian.Uint32(id[4:8])
+	var parts [][]byte
+	if len(ws.wildcards) > 0 && topic != nil {
+		parts, _ = db.opts.topicSeparator.SplitTopic(topic)
+		topic = db.opts.topicSeparator.JoinParts(parts, nil)
+	}
+	// the watchers are copied as the slice of watchers of the topic is modified in place on remove.
+	watchers := append([]*_Watcher(nil), ws.match(e.topicHash, contract, parts)...)
+	ws.RUnlock()
+
+	storedAt := time.Now()
+	var payload []byte
+	for _, w := range watchers {
+		if payload == nil && !w.opts.metadataOnly {
+			val, _, err := db.decodeValue(data[entrySize:entrySize+idSize], data[entrySize+idSize+uint32(e.topicSize):])
+			if err != nil {
+				logger.Error().Err(err).Str("context", "db.notify").Msg("unable to decode the message of the watch")
+				return
+			}
+			payload = val
+		}
+		m := Message{
+			ID:        id,
+			Topic:     w.topic,
+			Contract:  contract,
+			Headers:   headers,
+			StoredAt:  storedAt,
+			ExpiresAt: e.expiresAt,
+			Token:     newToken(e.seq, w.topicHash),
+		}
+		if w.pattern != nil {
+			m.Topic = topic
+		}
+		if !w.opts.metadataOnly {
+			m.Payload = payload
+		}
+		w.deliver(m, e.seq, e.topicHash)
+	}
+}
+
+// deliver delivers the live message of the topic to the watcher. If watcher is replaying messages after resumption token
+// then message is kept pending until replay completes.
+func (w *_Watcher) deliver(m Message, seq, topicHash uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.closed:
+		return
+	case w.replaying:
+		if len(w.pending) >= w.opts.bufferSize {
+			w.overflow()
+			return
+		}
+		w.pending = append(w.pending, m)
+		return
+	case seq <= w.lastSeq:
+		// message is already delivered during replay.
+		return
+	case w.opts.coalesce > 0:
+		if c, ok := w.coalesce[topicHash]; ok {
+			// coalesce messages of the topic within the interval into the latest message.
+			if c.latest != nil {
+				c.skipped++
+			}
+			c.latest = &m
+			return
+		}
+		if w.coalesce == nil {
+			w.coalesce = make(map[uint64]*_Coalesce)
+		}
+		w.coalesce[topicHash] = &_Coalesce{timer: time.AfterFunc(w.opts.coalesce, func() { w.flush(topicHash) })}
+	}
+	w.send(m)
+}
+
+// flush delivers the latest message of the topic coalesced within the interval. The topic
+// is removed from the coalesced topics if no message is coalesced within the interval.
+func (w *_Watcher) flush(topicHash uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.coalesce[topicHash]
+	if w.closed || !ok {
+		return
+	}
+	if c.latest == nil {
+		delete(w.coalesce, topicHash)
+		return
+	}
+	m := *c.latest
+	m.Skipped = c.skipped
+	c.latest = nil
+	c.skipped = 0
+	w.send(m)
+	if !w.closed {
+		c.timer.Reset(w.opts.coalesce)
+	}
+}
+
+// send sends message to the watcher. If the channel buffer is full the watcher is closed on overflow.
+func (w *_Watcher) send(m Message) {
+	select {
+	case w.msgC <- m:
+		w.lastToken = m.Token
+	default:
+		w.overflow()
+	}
+}
+
+// overflow stops delivery to the slow watcher. The overflow message is sent once the channel is
+// drained and the channel is closed after it. If watcher is replaying, it is sent once the replay exits.
+func (w *_Watcher) overflow() {
+	w.overflowed = true
+	w.stop()
+	if !w.replaying {
+		go w.sendOverflow(w.lastToken)
+	}
+}
+
+// sendOverflow sends the overflow message carrying the token of the last message delivered and
+// closes the channel. The message is dropped if the watch is canceled before the channel is drained.
+func (w *_Watcher) sendOverflow(token []byte) {
+	m := Message{Topic: w.topic, Contract: w.opts.contract, Token: token, Err: errWatchOverflow}
+	select {
+	case w.msgC <- m:
+	case <-w.cancelC:
+	}
+	close(w.msgC)
+}
+
+// stop stops delivery to the watcher.
+func (w *_Watcher) stop() {
+	w.closed = true
+	for _, c := range w.coalesce {
+		c.timer.Stop()
+	}
+	close(w.doneC)
+}
+
+// close closes the watcher. If watcher is replaying, the channel is closed once the replay exits.
+func (w *_Watcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.canceled {
+		w.canceled = true
+		close(w.cancelC)
+	}
+	if w.closed {
+		return
+	}
+	w.stop()
+	if !w.replaying {
+		close(w.msgC)
+	}
+}
+
+// replay delivers stored messages after the seq to the watcher and then delivers the pending live messages.
+// The stored messages are read in pages of the buffer size, a page is read once the previous page is sent.
+func (db *DB) replay(w *_Watcher, from uint64) {
+	defer db.internal.closeW.Done()
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.replaying = false
+		if w.closed {
+			if w.overflowed {
+				go w.sendOverflow(w.lastToken)
+				return
+			}
+			close(w.msgC)
+			return
+		}
+		for _, m := range w.pending {
+			if seq, _, _ := parseToken(m.Token); seq <= w.lastSeq {
+				continue
+			}
+			w.send(m)
+			if w.closed {
+				break
+			}
+		}
+		w.pending = nil
+	}()
+
+	for after := from; after != 0; {
+		msgs, next, err := db.readAfter(w, after)
+		if err != nil {
+			logger.Error().Err(err).Str("context", "db.replay").Msg("unable to read stored messages of the watch")
+			return
+		}
+		for _, m := range msgs {
+			select {
+			case w.msgC <- m:
+				seq, _, _ := parseToken(m.Token)
+				w.mu.Lock()
+				w.lastSeq = seq
+				w.lastToken = m.Token
+				w.mu.Unlock()
+			case <-w.doneC:
+				return
+			case <-db.internal.closeC:
+				return
+			}
+		}
+		after = next
+	}
+}
+
+// readAfter reads a page of stored messages of the watch topic after the seq in the order messages are
+// stored. It returns the seq to read the next page after, or 0 if the stored messages are exhausted.
+func (db *DB) readAfter(w *_Watcher, after uint64) ([]Message, uint64, error) {
+	if err := db.ok(); err != nil {
+		return nil, 0, err
+	}
+	limit := w.opts.bufferSize
+	if limit <= 0 || limit > db.opts.queryOptions.maxQueryLimit {
+		limit = db.opts.queryOptions.maxQueryLimit
+	}
+	q := NewQuery(w.topic).WithContract(w.opts.contract).WithLimit(limit).WithOrder(OrderAsc)
+	q.internal.opts = &_QueryOptions{defaultQueryLimit: limit, maxQueryLimit: limit, separator: db.opts.topicSeparator}
+	if err := q.parse(); err != nil {
+		return nil, 0, err
+	}
+	q.internal.after = after
+	mu := db.internal.mutex.getMutex(q.internal.prefix)
+	mu.RLock()
+	defer mu.RUnlock()
+	db.lookup(q)
+	q.internal.sortEntries()
+	winEntries := q.internal.winEntries
+	if len(winEntries) > limit {
+		winEntries = winEntries[:limit]
+	}
+	var next uint64
+	if len(winEntries) == limit {
+		next = winEntries[len(winEntries)-1].seq
+	}
+	var msgs []Message
+	for _, we := range winEntries {
+		if we.seq <= after {
+			continue
+		}
+		e, err := db.readEntry(we)
+		if err != nil {
+			if err == errMsgIDDeleted || err == errEntryInvalid {
+				continue
+			}
+			return nil, 0, err
+		}
+		id, val, err := db.internal.reader.readMessage(e)
+		if err != nil {
+			return nil, 0, err
+		}
+		msgID := make(message.ID, message.ID(nil).Size())
+		copy(msgID, id[:idSize-1])
+		binary.LittleEndian.PutUint64(msgID[8:16], we.seq)
+		if !msgID.EvalPrefix(q.Contract, 0) {
+			continue
+		}
+		m := Message{
+			ID:       msgID,
+			Topic:    w.topic,
+			Contract: q.Contract,
+			StoredAt: time.Unix(uid.Time(msgID[0:4]), 0),
+			Token:    newToken(we.seq, w.topicHash),
+		}
+		if !w.opts.metadataOnly {
+			var codec Codec
+			if m.Payload, codec, err = db.decodeValue(id, val); err != nil {
+				return nil, 0, err
+			}
+			m.Headers = contentHeaders(codec, nil)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, next, nil
+}
+
+// newToken encodes the resumption token from the seq and topic hash.
+func newToken(seq, topicHash uint64) []byte {
+	token := make([]byte, tokenSize)
+	binary.LittleEndian.PutUint64(token[0:8], seq)
+	binary.LittleEndian.PutUint64(token[8:16], topicHash)
+	return token
+}
+
+// parseToken decodes the seq and topic hash from the resumption token.
+func parseToken(token []byte) (seq, topicHash uint64, ok bool) {
+	if len(token) != tokenSize {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint64(token[0:8]), binary.LittleEndian.Uint64(token[8:16]), true
+}
+
+// decodeValue decrypts and decodes the packed value of the message, it returns the codec of the value.
+func (db *DB) decodeValue(id, val []byte) ([]byte, Codec, error) {
+	// last byte of ID is the encryption key id.
+	val, err := db.decrypt(uint8(id[idSize-1]), val)
+	if err != nil {
+		return nil, 0, err
+	}
+	if isChunked(val) {
+		return db.readChunks(val)
+	}
+	codec := valueCodec(val)
+	val, err = decompress(val)
+	return val, codec, err
+}